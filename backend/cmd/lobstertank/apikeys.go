@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/auth"
+)
+
+// runAPIKeys creates or revokes API keys in the local data store, such as
+// the first admin key, which the API cannot create without one. Usage:
+// apikeys create --name name [--roles r1,r2] [--org org] [--ttl duration]
+// or apikeys revoke id.
+func runAPIKeys(ctx context.Context, keys *auth.APIKeyProvider, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: apikeys (create | revoke) ...")
+	}
+	switch args[0] {
+	case "create":
+		return createAPIKey(ctx, keys, args[1:])
+	case "revoke":
+		return revokeAPIKey(ctx, keys, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q; available: apikeys create, apikeys revoke", "apikeys "+args[0])
+	}
+}
+
+// createAPIKey creates a key and prints it, with the key itself, as JSON.
+func createAPIKey(ctx context.Context, keys *auth.APIKeyProvider, args []string) error {
+	const usage = "usage: apikeys create --name name [--roles r1,r2] [--org org] [--ttl duration]"
+
+	fs := flag.NewFlagSet("apikeys create", flag.ContinueOnError)
+	name := fs.String("name", "", "what the key is for")
+	roles := fs.String("roles", "admin", "comma-separated roles the key grants")
+	org := fs.String("org", "", "organization the key is scoped to; empty is unscoped")
+	ttl := fs.Duration("ttl", 0, "how long the key is valid; 0 never expires")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q; %s", fs.Arg(0), usage)
+	}
+	if strings.TrimSpace(*name) == "" || *ttl < 0 {
+		return errors.New(usage)
+	}
+
+	var expiresAt *time.Time
+	if *ttl > 0 {
+		t := time.Now().Add(*ttl).UTC()
+		expiresAt = &t
+	}
+	roleList := []string{}
+	for _, role := range strings.Split(*roles, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roleList = append(roleList, role)
+		}
+	}
+
+	k, err := keys.CreateKey(ctx, strings.TrimSpace(*name), roleList, strings.TrimSpace(*org), "cli", expiresAt)
+	if err != nil {
+		return fmt.Errorf("create api key: %w", err)
+	}
+	out, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode api key: %w", err)
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// revokeAPIKey revokes the key with the given ID.
+func revokeAPIKey(ctx context.Context, keys *auth.APIKeyProvider, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: apikeys revoke id")
+	}
+	k, err := keys.RevokeKey(ctx, args[0], "")
+	if err != nil {
+		return fmt.Errorf("revoke api key: %w", err)
+	}
+	fmt.Printf("revoked api key %s (%s)\n", k.ID, k.Name)
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/AdamPippert/Lobstertank/internal/gateway"
+)
+
+// runClientCommand runs a subcommand that talks to a running server over
+// its API, such as "gateways export". It reports false when args name no
+// such command, leaving them for runCommand. "gateway" is accepted for
+// "gateways".
+func runClientCommand(ctx context.Context, args []string) (bool, error) {
+	if len(args) < 2 {
+		return false, nil
+	}
+
+	switch args[0] + " " + args[1] {
+	case "gateways export", "gateway export":
+		return true, exportGateways(ctx, args[2:])
+	case "gateways import", "gateway import":
+		return true, importGateways(ctx, args[2:])
+	case "fleet health":
+		return true, fleetHealth(ctx, args[2:])
+	default:
+		return false, nil
+	}
+}
+
+// runCommand dispatches an administrative subcommand that operates on the
+// local data store, such as "gateways migrate-secrets".
+func runCommand(ctx context.Context, registry *gateway.Registry, args []string) error {
+	switch strings.Join(args, " ") {
+	case "gateways migrate-secrets", "gateway migrate-secrets":
+		n, err := registry.MigrateInlineSecrets(ctx)
+		if err != nil {
+			return fmt.Errorf("migrate gateway secrets (%d migrated before failure): %w", n, err)
+		}
+		fmt.Printf("migrated %d gateway token(s) to the secrets provider\n", n)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q; available: apikeys create, apikeys revoke, db backup, db restore, fleet health, gateways export, gateways import, gateways migrate-secrets, migrate", strings.Join(args, " "))
+	}
+}
+
+// clientFlags registers the flags every client command accepts and returns
+// a function building the API client from them.
+func clientFlags(fs *flag.FlagSet) func() (*apiClient, error) {
+	baseURL := fs.String("url", os.Getenv("LT_API_URL"), "server base URL (default $LT_API_URL)")
+	token := fs.String("token", os.Getenv("LT_API_TOKEN"), "API bearer token (default $LT_API_TOKEN)")
+	return func() (*apiClient, error) {
+		return newAPIClient(*baseURL, *token)
+	}
+}
+
+// exportGateways fetches the server's gateway export document and writes it
+// to stdout or a file. Usage: gateways export [--out file].
+func exportGateways(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("gateways export", flag.ContinueOnError)
+	out := fs.String("out", "", "write the export to this file instead of stdout")
+	client := clientFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q; usage: gateways export [--out file]", fs.Arg(0))
+	}
+
+	c, err := client()
+	if err != nil {
+		return err
+	}
+	body, _, err := c.do(ctx, "GET", "/api/v1/gateways/export", "", nil)
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		_, err = os.Stdout.Write(body)
+		return err
+	}
+	if err := os.WriteFile(*out, body, 0o600); err != nil {
+		return fmt.Errorf("write export file: %w", err)
+	}
+	return nil
+}
+
+// importGateways sends an export document to the server. Usage:
+// gateways import [--dry-run] (--file file | file).
+func importGateways(ctx context.Context, args []string) error {
+	const usage = "usage: gateways import [--dry-run] (--file file | file)"
+
+	fs := flag.NewFlagSet("gateways import", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "report what would change without writing anything")
+	path := fs.String("file", "", "export document to import")
+	client := clientFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	switch {
+	case *path == "" && fs.NArg() == 1:
+		*path = fs.Arg(0)
+	case fs.NArg() > 0:
+		return fmt.Errorf("unexpected argument %q; %s", fs.Arg(0), usage)
+	}
+	if *path == "" {
+		return errors.New(usage)
+	}
+
+	f, err := os.Open(*path)
+	if err != nil {
+		return fmt.Errorf("open import file: %w", err)
+	}
+	defer f.Close()
+
+	c, err := client()
+	if err != nil {
+		return err
+	}
+	body, _, err := c.do(ctx, "POST", fmt.Sprintf("/api/v1/gateways/import?dry_run=%t", *dryRun), "application/yaml", f)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(body)
+	return err
+}
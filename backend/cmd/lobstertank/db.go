@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/store"
+)
+
+// runDB backs up or restores the configured data store. Usage:
+// db backup [--out file | --sqlite-copy file] or db restore [--dry-run]
+// [--on-conflict policy] (--file file | file).
+func runDB(ctx context.Context, s store.Store, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: db (backup | restore) ...")
+	}
+	switch args[0] {
+	case "backup":
+		return backupDB(ctx, s, args[1:])
+	case "restore":
+		return restoreDB(ctx, s, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q; available: db backup, db restore", "db "+args[0])
+	}
+}
+
+// backupDB writes a backup document to stdout or a file, or with
+// --sqlite-copy a copy of a SQLite database file.
+func backupDB(ctx context.Context, s store.Store, args []string) error {
+	const usage = "usage: db backup [--out file | --sqlite-copy file]"
+
+	fs := flag.NewFlagSet("db backup", flag.ContinueOnError)
+	out := fs.String("out", "", "write the backup document to this file instead of stdout")
+	sqliteCopy := fs.String("sqlite-copy", "", "write a copy of the SQLite database file here instead")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q; %s", fs.Arg(0), usage)
+	}
+	if *out != "" && *sqliteCopy != "" {
+		return errors.New(usage)
+	}
+
+	if *sqliteCopy != "" {
+		ss, ok := store.Unwrap(s).(*store.SQLiteStore)
+		if !ok {
+			return errors.New("--sqlite-copy needs the sqlite driver")
+		}
+		if err := ss.CopyTo(ctx, *sqliteCopy); err != nil {
+			return err
+		}
+		fmt.Printf("copied the database to %s\n", *sqliteCopy)
+		return nil
+	}
+
+	b, err := store.TakeBackup(ctx, s, time.Now())
+	if err != nil {
+		return fmt.Errorf("back up database: %w", err)
+	}
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode backup: %w", err)
+	}
+	data = append(data, '\n')
+
+	if *out == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	// The backup holds the builtin provider's secrets and the API key
+	// hashes, so only the owner may read it.
+	if err := os.WriteFile(*out, data, 0o600); err != nil {
+		return fmt.Errorf("write backup file: %w", err)
+	}
+	fmt.Printf("backed up %d gateway(s), %d group(s), %d secret(s), %d API key(s), and %d audit event(s) to %s\n",
+		len(b.Gateways), len(b.Groups), len(b.Secrets), len(b.APIKeys), len(b.AuditEvents), *out)
+	return nil
+}
+
+// restoreDB restores a backup document and prints what it did.
+func restoreDB(ctx context.Context, s store.Store, args []string) error {
+	const usage = "usage: db restore [--dry-run] [--on-conflict fail|skip|overwrite] (--file file | file)"
+
+	fs := flag.NewFlagSet("db restore", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "report what would change without writing anything")
+	onConflict := fs.String("on-conflict", string(store.ConflictFail),
+		"what to do with existing records that differ from the backup: fail restores nothing, skip keeps them, overwrite replaces them")
+	path := fs.String("file", "", "backup document to restore")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	switch {
+	case *path == "" && fs.NArg() == 1:
+		*path = fs.Arg(0)
+	case fs.NArg() > 0:
+		return fmt.Errorf("unexpected argument %q; %s", fs.Arg(0), usage)
+	}
+	if *path == "" {
+		return errors.New(usage)
+	}
+
+	data, err := os.ReadFile(*path)
+	if err != nil {
+		return fmt.Errorf("read backup file: %w", err)
+	}
+	var b store.Backup
+	if err := json.Unmarshal(data, &b); err != nil {
+		return fmt.Errorf("parse backup file: %w", err)
+	}
+
+	result, restoreErr := store.Restore(ctx, s, &b, store.ConflictPolicy(*onConflict), *dryRun)
+	// A restore that failed while writing was rolled back, so its result
+	// would describe changes that were not made; conflicts are worth listing.
+	if restoreErr == nil || errors.Is(restoreErr, store.ErrRestoreConflict) {
+		out, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return fmt.Errorf("encode restore result: %w", err)
+		}
+		fmt.Println(string(out))
+	}
+	return restoreErr
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/AdamPippert/Lobstertank/internal/metaagent"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// fleetHealth runs a health sweep on the server and prints the report as
+// tables. Usage: fleet health [--gateway id,...] [--group id]
+// [--selector key=value,...] [--json].
+func fleetHealth(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("fleet health", flag.ContinueOnError)
+	ids := fs.String("gateway", "", "comma-separated gateway IDs to check (default all)")
+	group := fs.String("group", "", "check the members of this group")
+	selector := fs.String("selector", "", "comma-separated key=value labels the gateways must have")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	client := clientFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q; usage: fleet health [--gateway id,...] [--group id] [--selector key=value,...] [--json]", fs.Arg(0))
+	}
+
+	req := metaagent.HealthSweepRequest{GroupID: *group}
+	if *ids != "" {
+		req.GatewayIDs = strings.Split(*ids, ",")
+	}
+	if *selector != "" {
+		req.Selector = make(map[string]string)
+		for _, pair := range strings.Split(*selector, ",") {
+			k, v, ok := strings.Cut(pair, "=")
+			if !ok || k == "" {
+				return fmt.Errorf("invalid selector %q; want key=value", pair)
+			}
+			req.Selector[k] = v
+		}
+	}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+
+	c, err := client()
+	if err != nil {
+		return err
+	}
+	body, _, err := c.do(ctx, "POST", "/api/v1/meta/health", "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		_, err = os.Stdout.Write(body)
+		return err
+	}
+
+	var report metaagent.HealthReport
+	if err := json.Unmarshal(body, &report); err != nil {
+		return fmt.Errorf("decode health report: %w", err)
+	}
+	return printHealthReport(os.Stdout, &report)
+}
+
+// printHealthReport writes a health report as plain-text tables.
+func printHealthReport(out io.Writer, report *metaagent.HealthReport) error {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "%d gateway(s) checked in %dms\n\n", report.Total, report.DurationMillis)
+	fmt.Fprintln(tw, "STATUS\tGATEWAYS")
+	for _, s := range []model.Status{
+		model.StatusOnline, model.StatusDegraded, model.StatusOffline, model.StatusUnknown, model.StatusMaintenance,
+	} {
+		if n := report.Counts[s]; n > 0 {
+			fmt.Fprintf(tw, "%s\t%d\n", s, n)
+		}
+	}
+
+	if len(report.Slowest) > 0 {
+		fmt.Fprintln(tw, "\nSLOWEST\tID\tSTATUS\tLATENCY")
+		for _, h := range report.Slowest {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%dms\n", h.GatewayName, h.GatewayID, h.Status, h.LatencyMillis)
+		}
+	}
+
+	if len(report.NewlyDegraded) > 0 {
+		fmt.Fprintln(tw, "\nNEWLY DEGRADED\tID\tWAS\tNOW\tERROR")
+		for _, h := range report.NewlyDegraded {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", h.GatewayName, h.GatewayID, h.PreviousStatus, h.Status, h.Error)
+		}
+	}
+	return tw.Flush()
+}
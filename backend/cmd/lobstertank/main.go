@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -9,26 +10,62 @@ import (
 
 	"github.com/AdamPippert/Lobstertank/internal/audit"
 	"github.com/AdamPippert/Lobstertank/internal/auth"
+	"github.com/AdamPippert/Lobstertank/internal/clock"
 	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/events"
 	"github.com/AdamPippert/Lobstertank/internal/gateway"
 	"github.com/AdamPippert/Lobstertank/internal/metaagent"
+	"github.com/AdamPippert/Lobstertank/internal/monitor"
 	"github.com/AdamPippert/Lobstertank/internal/secrets"
 	"github.com/AdamPippert/Lobstertank/internal/server"
 	"github.com/AdamPippert/Lobstertank/internal/store"
 	"github.com/AdamPippert/Lobstertank/internal/transport"
+	"github.com/AdamPippert/Lobstertank/internal/webhook"
 )
 
 func main() {
+	logLevel := new(slog.LevelVar)
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
+		Level: logLevel,
 	}))
 	slog.SetDefault(logger)
 
-	cfg, err := config.Load()
+	configPath := flag.String("config", os.Getenv("LT_CONFIG_FILE"),
+		"YAML config file; environment variables override its values")
+	flag.Parse()
+	args := flag.Args()
+
+	// Commands that talk to a running server need no local configuration.
+	if handled, err := runClientCommand(context.Background(), args); handled {
+		if err != nil {
+			slog.Error("command failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	cfg, err := config.LoadFile(*configPath)
 	if err != nil {
 		slog.Error("failed to load configuration", "error", err)
 		os.Exit(1)
 	}
+	if err := cfg.Validate(); err != nil {
+		slog.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
+	logLevel.Set(cfg.Log.Level)
+
+	// Migrations run against the database directly, since opening the store
+	// may refuse a schema that is not current.
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrate(context.Background(), cfg.Database, args[1:]); err != nil {
+			slog.Error("command failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	clk := clock.Real()
 
 	// Initialize audit logger.
 	auditor := audit.New(cfg.Audit)
@@ -48,38 +85,128 @@ func main() {
 	}
 	defer dataStore.Close()
 
+	// Back up or restore the data store instead of running the server if
+	// asked. This comes before anything else can write to the store.
+	if len(args) > 0 && args[0] == "db" {
+		if err := runDB(context.Background(), dataStore, args[1:]); err != nil {
+			slog.Error("command failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+	auditor.SetStore(dataStore)
+
+	// Manage API keys instead of running the server if asked, e.g. to create
+	// the first admin key. This needs no auth provider, which may depend on
+	// an identity provider being reachable.
+	if len(args) > 0 && args[0] == "apikeys" {
+		if err := runAPIKeys(context.Background(), auth.NewAPIKeyProvider(dataStore, clk, nil), args[1:]); err != nil {
+			slog.Error("command failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Keep builtin secrets in the data store so they survive restarts.
+	if bp, ok := secretProvider.(*secrets.BuiltinProvider); ok {
+		if cfg.Secrets.EncryptionKey == "" {
+			slog.Warn("builtin secrets are stored unencrypted; set LT_SECRETS_ENCRYPTION_KEY outside development")
+		}
+		if err := bp.Persist(context.Background(), dataStore); err != nil {
+			slog.Error("failed to load persisted secrets", "error", err)
+			os.Exit(1)
+		}
+	}
+
 	// Initialize transport provider.
 	transportProvider := transport.NewProvider(cfg.Transport)
 
 	// Initialize auth provider.
-	authProvider, err := auth.NewProvider(cfg.Auth, secretProvider)
+	authProvider, err := auth.NewProvider(cfg.Auth, secretProvider, clk)
 	if err != nil {
 		slog.Error("failed to initialize auth provider", "error", err)
 		os.Exit(1)
 	}
+	// API keys are accepted alongside the provider's own credentials.
+	apiKeys := auth.NewAPIKeyProvider(dataStore, clk, authProvider)
+	// Client certificates are verified by the TLS listener itself.
+	clientCerts, _ := authProvider.(*auth.MTLSProvider)
 
 	// Initialize gateway registry.
-	registry := gateway.NewRegistry(dataStore, auditor)
+	registry := gateway.NewRegistry(dataStore, auditor, clk, cfg.Health.HistoryRetention, secretProvider, cfg.Secrets.GatewayPrefix)
+	registry.SetStatusCacheTTL(cfg.Health.StatusCacheTTL)
+	registry.SetDeletedRetention(cfg.Database.DeletedRetention)
+
+	// Run a one-off administrative command instead of the server if asked.
+	if len(args) > 0 {
+		if err := runCommand(context.Background(), registry, args); err != nil {
+			slog.Error("command failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Initialize the live event hub.
+	hub := events.NewHub()
+	registry.SetEventHub(hub)
+
+	// Share gateway writes with other replicas on the same database.
+	if cfg.Database.NotifyChanges {
+		if feed, ok := store.Unwrap(dataStore).(store.ChangeFeed); ok {
+			registry.SetChangeFeed(feed)
+		} else {
+			slog.Info("change notifications need postgres; ignoring LT_DB_NOTIFY_CHANGES", "driver", cfg.Database.Driver)
+		}
+	}
+
+	// Initialize webhook notifications of status transitions.
+	webhooks := webhook.New(cfg.Webhook, clk)
+	registry.AddNotifier(webhooks)
 
 	// Initialize gateway client factory.
-	clientFactory := gateway.NewClientFactory(transportProvider, secretProvider)
+	clientFactory := gateway.NewClientFactory(transportProvider, secretProvider, cfg.Retry, cfg.Breaker, clk)
+
+	// Initialize bulk health prober.
+	prober := gateway.NewProber(registry, clientFactory, cfg.Health.Concurrency, cfg.Health.Timeout)
 
 	// Initialize meta-agent.
-	agent := metaagent.New(registry, clientFactory, auditor)
+	agent := metaagent.New(registry, clientFactory, prober, auditor)
+	jobs := metaagent.NewJobs(agent, dataStore, clk, cfg.FanOut)
+
+	// Initialize background health monitor.
+	var mon *monitor.Monitor
+	if cfg.Monitor.Enabled {
+		mon = monitor.New(registry, prober, auditor, clk, cfg.Monitor)
+	}
 
 	// Build and start the HTTP server.
 	srv := server.New(server.Dependencies{
 		Config:        cfg,
+		Store:         dataStore,
+		Secrets:       secretProvider,
 		Registry:      registry,
 		ClientFactory: clientFactory,
+		Prober:        prober,
 		MetaAgent:     agent,
-		AuthProvider:  authProvider,
+		Jobs:          jobs,
+		Monitor:       mon,
+		Webhooks:      webhooks,
+		Events:        hub,
+		AuthProvider:  apiKeys,
+		ClientCerts:   clientCerts,
 		Auditor:       auditor,
+		Clock:         clk,
+		LogLevel:      logLevel,
 	})
 
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go reloadOnSignal(ctx, srv, *configPath, hup)
+
 	if err := srv.Run(ctx); err != nil {
 		slog.Error("server exited with error", "error", err)
 		os.Exit(1)
@@ -87,3 +214,34 @@ func main() {
 
 	slog.Info("lobstertank shutdown complete")
 }
+
+// reloader applies a new configuration to a running server.
+type reloader interface {
+	Reload(cfg *config.Config)
+}
+
+// reloadOnSignal rereads the configuration on every signal from hup until
+// the context is canceled and applies what can change without a restart. A
+// configuration that fails to load or validate is logged and leaves the
+// server as it was.
+func reloadOnSignal(ctx context.Context, srv reloader, configPath string, hup <-chan os.Signal) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+
+		slog.Info("SIGHUP received, reloading configuration")
+		cfg, err := config.LoadFile(configPath)
+		if err != nil {
+			slog.Error("failed to reload configuration", "error", err)
+			continue
+		}
+		if err := cfg.Validate(); err != nil {
+			slog.Error("invalid configuration; keeping the current one", "error", err)
+			continue
+		}
+		srv.Reload(cfg)
+	}
+}
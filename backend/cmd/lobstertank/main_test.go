@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/config"
+)
+
+// recordingReloader records the configurations it is given.
+type recordingReloader chan *config.Config
+
+func (r recordingReloader) Reload(cfg *config.Config) { r <- cfg }
+
+// writeConfig writes content to a configuration file in a temporary
+// directory and returns its path. The environment supplies the settings
+// every valid configuration needs.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	t.Setenv("LT_AUTH_TOKEN_SECRET", "test-token")
+	t.Setenv("LT_SECRETS_ALLOW_PLAINTEXT", "true")
+	path := filepath.Join(t.TempDir(), "lobstertank.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestReloadOnSIGHUP(t *testing.T) {
+	path := writeConfig(t, "log:\n  level: debug\n")
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloaded := make(recordingReloader, 1)
+	go reloadOnSignal(ctx, reloaded, path, hup)
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatalf("send SIGHUP: %v", err)
+	}
+	select {
+	case cfg := <-reloaded:
+		if cfg.Log.Level != slog.LevelDebug {
+			t.Errorf("reloaded log level = %v, want debug", cfg.Log.Level)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGHUP did not reload the configuration")
+	}
+}
+
+func TestReloadOnSignalKeepsBadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"unparsable", "log: [\n"},
+		{"unknown key", "log:\n  colour: red\n"},
+		{"invalid value", "log:\n  level: loud\n"},
+		{"fails validation", "server:\n  port: 0\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, tt.content)
+			ctx, cancel := context.WithCancel(context.Background())
+			hup := make(chan os.Signal)
+			reloaded := make(recordingReloader, 1)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				reloadOnSignal(ctx, reloaded, path, hup)
+			}()
+
+			hup <- syscall.SIGHUP
+			cancel()
+			<-done
+			if len(reloaded) != 0 {
+				t.Errorf("reloaded %+v", <-reloaded)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+	"github.com/AdamPippert/Lobstertank/internal/store/migrations"
+)
+
+// runMigrate inspects or applies schema migrations on the configured
+// database without starting the server. Usage: migrate (--status | --up).
+func runMigrate(ctx context.Context, cfg config.DatabaseConfig, args []string) error {
+	const usage = "usage: migrate (--status | --up)"
+
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	status := fs.Bool("status", false, "list known migrations and whether each is applied")
+	up := fs.Bool("up", false, "apply pending migrations")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q; %s", fs.Arg(0), usage)
+	}
+	if *status == *up {
+		return errors.New(usage)
+	}
+
+	db, err := store.Open(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	m := migrations.New(db, cfg.Driver)
+
+	if *up {
+		n, err := m.Up(ctx)
+		if err != nil {
+			return fmt.Errorf("apply migrations (%d applied before failure): %w", n, err)
+		}
+		fmt.Printf("applied %d migration(s); schema is at version %d\n", n, migrations.Latest())
+		return nil
+	}
+
+	states, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	current, err := m.Current(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+	for _, s := range states {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if current > migrations.Latest() {
+		fmt.Printf("database is at version %d, newer than this binary (%d)\n", current, migrations.Latest())
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package audit
+
+import "context"
+
+type contextKey string
+
+const (
+	requestIDKey contextKey = "audit.request_id"
+	subjectKey   contextKey = "audit.subject"
+)
+
+// ContextWithRequestID stores the ID of the request being served, which
+// events logged with the context carry.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFromContext returns the request ID stored in ctx, or "".
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// ContextWithSubject stores the authenticated principal acting in ctx,
+// which events logged with the context carry unless they name another.
+func ContextWithSubject(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, subjectKey, subject)
+}
+
+// SubjectFromContext returns the subject stored in ctx, or "".
+func SubjectFromContext(ctx context.Context) string {
+	s, _ := ctx.Value(subjectKey).(string)
+	return s
+}
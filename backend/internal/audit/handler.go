@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/httputil"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// Limits on the number of events returned per page.
+const (
+	defaultQueryLimit = 100
+	maxQueryLimit     = 1000
+)
+
+// Handler exposes persisted audit events over HTTP.
+type Handler struct {
+	logger *Logger
+}
+
+// NewHandler creates an audit query handler.
+func NewHandler(l *Logger) *Handler {
+	return &Handler{logger: l}
+}
+
+// Query handles GET /api/v1/audit.
+func (h *Handler) Query(w http.ResponseWriter, r *http.Request) {
+	if !h.logger.Persisting() {
+		httputil.WriteError(w, r, http.StatusNotImplemented, "audit queries require LT_AUDIT_STORE=true", nil)
+		return
+	}
+
+	q, err := parseQuery(r)
+	if err != nil {
+		httputil.WriteError(w, r, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	events, err := h.logger.Query(r.Context(), q)
+	if err != nil {
+		httputil.WriteError(w, r, http.StatusInternalServerError, "failed to query audit events", err)
+		return
+	}
+
+	page := model.AuditPage{Events: events}
+	if len(events) == q.Limit {
+		page.NextCursor = strconv.FormatInt(events[len(events)-1].ID, 10)
+	}
+	httputil.WriteJSON(w, http.StatusOK, page)
+}
+
+// parseQuery reads the filters and paging parameters of an audit query.
+func parseQuery(r *http.Request) (model.AuditQuery, error) {
+	v := r.URL.Query()
+	q := model.AuditQuery{
+		Action:   v.Get("action"),
+		Resource: v.Get("resource"),
+		Limit:    defaultQueryLimit,
+	}
+
+	for name, dst := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if s := v.Get(name); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return q, fmt.Errorf("invalid %s parameter: want an RFC 3339 time", name)
+			}
+			*dst = t
+		}
+	}
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxQueryLimit {
+			return q, fmt.Errorf("invalid limit parameter: want 1 to %d", maxQueryLimit)
+		}
+		q.Limit = n
+	}
+	if s := v.Get("cursor"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || id < 1 {
+			return q, fmt.Errorf("invalid cursor parameter")
+		}
+		q.BeforeID = id
+	}
+	return q, nil
+}
@@ -9,6 +9,15 @@ import (
 	"time"
 
 	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+const (
+	// storeWriteTimeout bounds persisting one event, which outlives the
+	// request that caused it.
+	storeWriteTimeout = 5 * time.Second
+	// maxPruneInterval caps the time between retention sweeps.
+	maxPruneInterval = time.Hour
 )
 
 // Event represents a single auditable action.
@@ -18,22 +27,44 @@ type Event struct {
 	Resource  string `json:"resource,omitempty"`
 	Subject   string `json:"subject,omitempty"`
 	Detail    string `json:"detail,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Store persists audit events for querying.
+type Store interface {
+	AppendAuditEvent(ctx context.Context, e *model.AuditEvent) error
+	ListAuditEvents(ctx context.Context, q model.AuditQuery) ([]model.AuditEvent, error)
+	PruneAuditEvents(ctx context.Context, before time.Time) (int64, error)
 }
 
 // Logger writes structured audit events.
 type Logger struct {
-	mu      sync.Mutex
-	enabled bool
-	output  *os.File
+	mu       sync.Mutex
+	enabled  bool
+	output   *os.File
+	redactor *Redactor
+
+	persist   bool  // whether the store sink is configured
+	store     Store // nil until SetStore when persist is set
+	retention time.Duration
 }
 
 // New creates an audit logger from the given configuration.
 func New(cfg config.AuditConfig) *Logger {
-	l := &Logger{enabled: cfg.Enabled}
+	l := &Logger{enabled: cfg.Enabled, persist: cfg.Store, retention: cfg.Retention}
 	if !cfg.Enabled {
 		return l
 	}
 
+	redactor, err := NewRedactor(cfg.RedactDefaults, cfg.RedactPatterns)
+	if err != nil {
+		// Load validates the patterns, so this only happens with a
+		// hand-built config. Fall back to the built-in rules.
+		slog.Error("invalid audit redaction rules, using defaults", "error", err)
+		redactor, _ = NewRedactor(true, nil)
+	}
+	l.redactor = redactor
+
 	switch cfg.Output {
 	case "file":
 		f, err := os.OpenFile(cfg.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
@@ -50,14 +81,39 @@ func New(cfg config.AuditConfig) *Logger {
 	return l
 }
 
-// Log records an audit event. It is safe for concurrent use.
-func (l *Logger) Log(_ context.Context, evt Event) {
+// SetStore persists events to s, alongside the stream output, when the
+// store sink is configured. It must be called before the logger is used.
+func (l *Logger) SetStore(s Store) {
+	if l.enabled && l.persist {
+		l.store = s
+	}
+}
+
+// Log records an audit event. Events without a subject or request ID take
+// them from ctx. It is safe for concurrent use.
+func (l *Logger) Log(ctx context.Context, evt Event) {
 	if !l.enabled {
 		return
 	}
 
-	evt.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	now := time.Now().UTC()
+	evt.Timestamp = now.Format(time.RFC3339Nano)
+	evt.Detail = l.redactor.Redact(evt.Detail)
+	if evt.Subject == "" {
+		evt.Subject = SubjectFromContext(ctx)
+	}
+	if evt.RequestID == "" {
+		evt.RequestID = RequestIDFromContext(ctx)
+	}
+
+	l.write(evt)
+	if l.store != nil {
+		l.append(ctx, now, evt)
+	}
+}
 
+// write appends evt to the stream output.
+func (l *Logger) write(evt Event) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
@@ -73,6 +129,60 @@ func (l *Logger) Log(_ context.Context, evt Event) {
 	}
 }
 
+// append persists evt. The write is not canceled with the request, so an
+// action that completed is recorded even if its client went away.
+func (l *Logger) append(ctx context.Context, at time.Time, evt Event) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), storeWriteTimeout)
+	defer cancel()
+
+	err := l.store.AppendAuditEvent(ctx, &model.AuditEvent{
+		Timestamp: at,
+		Action:    evt.Action,
+		Resource:  evt.Resource,
+		Subject:   evt.Subject,
+		Detail:    evt.Detail,
+		RequestID: evt.RequestID,
+	})
+	if err != nil {
+		slog.Error("failed to persist audit event", "action", evt.Action, "error", err)
+	}
+}
+
+// Persisting reports whether events are persisted and can be queried.
+func (l *Logger) Persisting() bool {
+	return l.store != nil
+}
+
+// Query returns persisted events matching q, newest first.
+func (l *Logger) Query(ctx context.Context, q model.AuditQuery) ([]model.AuditEvent, error) {
+	return l.store.ListAuditEvents(ctx, q)
+}
+
+// Run deletes persisted events older than the retention period until ctx
+// is canceled. It returns at once when events are not persisted or are
+// kept forever.
+func (l *Logger) Run(ctx context.Context) {
+	if l.store == nil || l.retention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(min(l.retention, maxPruneInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := l.store.PruneAuditEvents(ctx, time.Now().Add(-l.retention))
+			if err != nil {
+				slog.Warn("failed to prune audit events", "error", err)
+			} else if n > 0 {
+				slog.Debug("pruned audit events", "count", n)
+			}
+		}
+	}
+}
+
 // Close releases any resources held by the logger.
 func (l *Logger) Close() error {
 	if l.output != nil && l.output != os.Stdout && l.output != os.Stderr {
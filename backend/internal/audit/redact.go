@@ -0,0 +1,81 @@
+package audit
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// redacted replaces every value a redaction rule matches.
+const redacted = "[REDACTED]"
+
+// defaultRedactPatterns catch the credentials most likely to leak into an
+// event detail. Where a pattern has a capture group, only the group is
+// replaced so the surrounding context ("Bearer", "token=") stays readable.
+var defaultRedactPatterns = []string{
+	`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`,
+	`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`,
+	`(?i)\b(?:token|secret|password|passwd|api[_-]?key|access[_-]?key|client[_-]?secret)["']?\s*[=:]\s*["']?([^\s"'&,;]+)`,
+	`://([^/\s:@]+:[^/\s@]+)@`,
+	`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+}
+
+// Redactor masks sensitive values in audit event details.
+type Redactor struct {
+	rules []*regexp.Regexp
+}
+
+// NewRedactor compiles the built-in rules, when defaults is set, followed by
+// the given patterns.
+func NewRedactor(defaults bool, patterns []string) (*Redactor, error) {
+	var all []string
+	if defaults {
+		all = append(all, defaultRedactPatterns...)
+	}
+	all = append(all, patterns...)
+
+	r := &Redactor{rules: make([]*regexp.Regexp, 0, len(all))}
+	for _, p := range all {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("compile redaction pattern %q: %w", p, err)
+		}
+		r.rules = append(r.rules, re)
+	}
+	return r, nil
+}
+
+// Redact returns s with every rule applied in order. A nil Redactor returns
+// s unchanged.
+func (r *Redactor) Redact(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	for _, re := range r.rules {
+		s = redactMatches(re, s)
+	}
+	return s
+}
+
+// redactMatches replaces the first capture group of each match, or the whole
+// match when the pattern has no groups or the group did not participate.
+func redactMatches(re *regexp.Regexp, s string) string {
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if len(m) >= 4 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(redacted)
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
@@ -0,0 +1,296 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/httputil"
+	"github.com/AdamPippert/Lobstertank/internal/logging"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+	"github.com/google/uuid"
+)
+
+// APIKeyPrefix begins every API key, which reads ltk_<id>_<secret>, so
+// keys can be told apart from other bearer tokens.
+const APIKeyPrefix = "ltk_"
+
+// apiKeySecretBytes is how many random bytes an API key's secret holds.
+const apiKeySecretBytes = 32
+
+// lastUsedResolution is how stale an API key's last use may get before it
+// is recorded again, so a busy key does not write on every request.
+const lastUsedResolution = time.Minute
+
+// APIKeyStore persists API keys; store.Store implements it.
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, k *model.APIKey) error
+	GetAPIKey(ctx context.Context, id string) (*model.APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]model.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id string) error
+	TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error
+}
+
+// APIKeyProvider authenticates API keys and passes every other request to
+// the provider it wraps, so keys work alongside the configured credentials.
+// It also creates and revokes keys.
+type APIKeyProvider struct {
+	store APIKeyStore
+	clock clock.Clock
+	next  Provider
+}
+
+// NewAPIKeyProvider creates a provider authenticating the keys in s and
+// leaving other bearer tokens to next.
+func NewAPIKeyProvider(s APIKeyStore, clk clock.Clock, next Provider) *APIKeyProvider {
+	return &APIKeyProvider{store: s, clock: clk, next: next}
+}
+
+// Authenticate validates a bearer API key, comparing its secret with the
+// stored hash in constant time, and records that the key was used. The
+// principal holds the key's roles and organization.
+func (p *APIKeyProvider) Authenticate(ctx context.Context, r *http.Request) (*Principal, error) {
+	token := extractBearerToken(r)
+	if !strings.HasPrefix(token, APIKeyPrefix) {
+		return p.next.Authenticate(ctx, r)
+	}
+
+	id, secret, ok := strings.Cut(strings.TrimPrefix(token, APIKeyPrefix), "_")
+	if !ok || id == "" || secret == "" {
+		return nil, fmt.Errorf("malformed api key")
+	}
+	k, err := p.store.GetAPIKey(ctx, id)
+	if err != nil {
+		if errors.Is(err, store.ErrAPIKeyNotFound) {
+			return nil, fmt.Errorf("unknown api key %s", id)
+		}
+		return nil, fmt.Errorf("look up api key: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(hashAPIKeySecret(secret)), []byte(k.Hash)) != 1 {
+		return nil, fmt.Errorf("invalid api key %s", id)
+	}
+	if k.Revoked {
+		return nil, fmt.Errorf("api key %s is revoked", id)
+	}
+	now := p.clock.Now()
+	if k.ExpiresAt != nil && !now.Before(*k.ExpiresAt) {
+		return nil, fmt.Errorf("api key %s expired", id)
+	}
+
+	if k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) >= lastUsedResolution {
+		// The key is valid either way, so failing to record its use is
+		// logged rather than refused.
+		if err := p.store.TouchAPIKey(ctx, id, now); err != nil {
+			logging.LoggerFromContext(ctx).Warn("failed to record api key use", "id", id, "error", err)
+		}
+	}
+
+	return &Principal{
+		Subject: "apikey:" + k.ID,
+		Roles:   k.Roles,
+		Org:     k.Org,
+		Name:    k.Name,
+	}, nil
+}
+
+// CreateKey makes an API key and returns it with the key itself, which is
+// not stored and cannot be shown again. A nil expiresAt never expires.
+func (p *APIKeyProvider) CreateKey(ctx context.Context, name string, roles []string, org, createdBy string, expiresAt *time.Time) (*model.CreatedAPIKey, error) {
+	raw := make([]byte, apiKeySecretBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("generate api key: %w", err)
+	}
+	secret := base64.RawURLEncoding.EncodeToString(raw)
+
+	k := model.APIKey{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Roles:     roles,
+		Org:       org,
+		CreatedBy: createdBy,
+		CreatedAt: p.clock.Now().UTC(),
+		ExpiresAt: expiresAt,
+		Hash:      hashAPIKeySecret(secret),
+	}
+	if k.Roles == nil {
+		k.Roles = []string{}
+	}
+	if err := p.store.CreateAPIKey(ctx, &k); err != nil {
+		return nil, err
+	}
+	return &model.CreatedAPIKey{APIKey: k, Key: APIKeyPrefix + k.ID + "_" + secret}, nil
+}
+
+// ListKeys returns the API keys in org, or every key when org is empty,
+// oldest first.
+func (p *APIKeyProvider) ListKeys(ctx context.Context, org string) ([]model.APIKey, error) {
+	keys, err := p.store.ListAPIKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if org == "" {
+		return keys, nil
+	}
+	scoped := keys[:0]
+	for _, k := range keys {
+		if k.Org == org {
+			scoped = append(scoped, k)
+		}
+	}
+	return scoped, nil
+}
+
+// RevokeKey revokes the API key id. Keys outside org, when org is set, are
+// reported as not found.
+func (p *APIKeyProvider) RevokeKey(ctx context.Context, id, org string) (*model.APIKey, error) {
+	k, err := p.store.GetAPIKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if org != "" && k.Org != org {
+		return nil, fmt.Errorf("%w: %s", store.ErrAPIKeyNotFound, id)
+	}
+	if err := p.store.RevokeAPIKey(ctx, id); err != nil {
+		return nil, err
+	}
+	k.Revoked = true
+	return k, nil
+}
+
+// hashAPIKeySecret returns the stored form of an API key's secret. The
+// secret is random and long, so a fast hash is enough.
+func hashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey handles POST /api/v1/apikeys.
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	if h.keys == nil {
+		httputil.WriteError(w, r, http.StatusNotImplemented, "api keys are not enabled", nil)
+		return
+	}
+
+	var req model.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.WriteBodyError(w, r, err)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		httputil.WriteError(w, r, http.StatusBadRequest, "name is required", nil)
+		return
+	}
+	for _, role := range req.Roles {
+		if strings.TrimSpace(role) == "" {
+			httputil.WriteError(w, r, http.StatusBadRequest, "roles must not be empty", nil)
+			return
+		}
+	}
+
+	// A caller scoped to an organization can only create keys within it.
+	var createdBy, callerOrg string
+	if p, ok := PrincipalFromContext(r.Context()); ok {
+		createdBy, callerOrg = p.Subject, p.Org
+	}
+	req.Org = strings.TrimSpace(req.Org)
+	switch {
+	case req.Org == "":
+		req.Org = callerOrg
+	case callerOrg != "" && req.Org != callerOrg:
+		httputil.WriteError(w, r, http.StatusForbidden, "forbidden", fmt.Errorf("cannot create api keys for organization %q", req.Org))
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil || d <= 0 {
+			httputil.WriteError(w, r, http.StatusBadRequest, "ttl must be a positive Go duration", nil)
+			return
+		}
+		t := h.keys.clock.Now().Add(d).UTC()
+		expiresAt = &t
+	}
+
+	k, err := h.keys.CreateKey(r.Context(), req.Name, req.Roles, req.Org, createdBy, expiresAt)
+	if err != nil {
+		httputil.WriteError(w, r, http.StatusInternalServerError, "failed to create api key", err)
+		return
+	}
+
+	expiry := "never expiring"
+	if expiresAt != nil {
+		expiry = "expiring " + expiresAt.Format(time.RFC3339)
+	}
+	h.auditor.Log(r.Context(), audit.Event{
+		Action:   "auth.apikey_created",
+		Resource: k.ID,
+		Subject:  createdBy,
+		Detail:   fmt.Sprintf("created api key %q with roles [%s] %s", k.Name, strings.Join(k.Roles, ", "), expiry),
+	})
+
+	httputil.WriteJSON(w, http.StatusCreated, k)
+}
+
+// ListAPIKeys handles GET /api/v1/apikeys.
+func (h *Handler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if h.keys == nil {
+		httputil.WriteError(w, r, http.StatusNotImplemented, "api keys are not enabled", nil)
+		return
+	}
+
+	var org string
+	if p, ok := PrincipalFromContext(r.Context()); ok {
+		org = p.Org
+	}
+	keys, err := h.keys.ListKeys(r.Context(), org)
+	if err != nil {
+		httputil.WriteError(w, r, http.StatusInternalServerError, "failed to list api keys", err)
+		return
+	}
+	httputil.WriteJSON(w, http.StatusOK, keys)
+}
+
+// RevokeAPIKey handles DELETE /api/v1/apikeys/{id}. The key is kept,
+// revoked, so it stays listed.
+func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if h.keys == nil {
+		httputil.WriteError(w, r, http.StatusNotImplemented, "api keys are not enabled", nil)
+		return
+	}
+
+	var subject, org string
+	if p, ok := PrincipalFromContext(r.Context()); ok {
+		subject, org = p.Subject, p.Org
+	}
+	k, err := h.keys.RevokeKey(r.Context(), r.PathValue("id"), org)
+	if err != nil {
+		if errors.Is(err, store.ErrAPIKeyNotFound) {
+			httputil.WriteError(w, r, http.StatusNotFound, "api key not found", err)
+			return
+		}
+		httputil.WriteError(w, r, http.StatusInternalServerError, "failed to revoke api key", err)
+		return
+	}
+
+	h.auditor.Log(r.Context(), audit.Event{
+		Action:   "auth.apikey_revoked",
+		Resource: k.ID,
+		Subject:  subject,
+		Detail:   fmt.Sprintf("revoked api key %q", k.Name),
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
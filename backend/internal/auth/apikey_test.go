@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+)
+
+func newTestAPIKeyProvider(t *testing.T, next Provider) (*APIKeyProvider, store.Store, *clock.FakeClock) {
+	t.Helper()
+	s, err := store.NewSQLiteStore(":memory:", false, true)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	clk := clock.NewFake(testEpoch)
+	return NewAPIKeyProvider(s, clk, next), s, clk
+}
+
+func TestAPIKeyCreateAndAuthenticate(t *testing.T) {
+	p, s, clk := newTestAPIKeyProvider(t, nil)
+	ctx := context.Background()
+
+	created, err := p.CreateKey(ctx, "ci", []string{"operator"}, "acme", "alice", nil)
+	if err != nil {
+		t.Fatalf("CreateKey: %v", err)
+	}
+	if !strings.HasPrefix(created.Key, APIKeyPrefix+created.ID+"_") {
+		t.Errorf("key %q does not read %s<id>_<secret>", created.Key, APIKeyPrefix)
+	}
+	if created.CreatedBy != "alice" || !created.CreatedAt.Equal(testEpoch) || created.ExpiresAt != nil {
+		t.Errorf("created = %+v, want made by alice now, never expiring", created.APIKey)
+	}
+
+	// Only the hash of the secret is stored.
+	secret := strings.TrimPrefix(created.Key, APIKeyPrefix+created.ID+"_")
+	stored, err := s.GetAPIKey(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetAPIKey: %v", err)
+	}
+	if stored.Hash == "" || stored.Hash != hashAPIKeySecret(secret) || strings.Contains(stored.Hash, secret) {
+		t.Errorf("stored hash %q is not the hash of the secret", stored.Hash)
+	}
+
+	clk.Advance(time.Hour)
+	principal, err := p.Authenticate(ctx, bearerRequest(created.Key))
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if principal.Subject != "apikey:"+created.ID || principal.Org != "acme" || principal.Name != "ci" ||
+		!slices.Equal(principal.Roles, []string{"operator"}) {
+		t.Errorf("principal = %+v, want the key's roles and org", principal)
+	}
+	if stored, _ := s.GetAPIKey(ctx, created.ID); stored.LastUsedAt == nil || !stored.LastUsedAt.Equal(clk.Now()) {
+		t.Errorf("last used = %v, want %v", stored.LastUsedAt, clk.Now())
+	}
+}
+
+func TestAPIKeyRejected(t *testing.T) {
+	p, _, clk := newTestAPIKeyProvider(t, nil)
+	ctx := context.Background()
+
+	expiresAt := testEpoch.Add(time.Hour)
+	expiring, err := p.CreateKey(ctx, "short", nil, "", "alice", &expiresAt)
+	if err != nil {
+		t.Fatalf("CreateKey: %v", err)
+	}
+	revoked, err := p.CreateKey(ctx, "revoked", nil, "", "alice", nil)
+	if err != nil {
+		t.Fatalf("CreateKey: %v", err)
+	}
+	if _, err := p.RevokeKey(ctx, revoked.ID, ""); err != nil {
+		t.Fatalf("RevokeKey: %v", err)
+	}
+	clk.Advance(time.Hour)
+
+	for name, key := range map[string]string{
+		"revoked":       revoked.Key,
+		"expired":       expiring.Key,
+		"wrong secret":  APIKeyPrefix + revoked.ID + "_not-the-secret",
+		"unknown id":    APIKeyPrefix + "00000000-0000-0000-0000-000000000000_secret",
+		"no secret":     APIKeyPrefix + revoked.ID,
+		"empty id":      APIKeyPrefix + "_secret",
+		"swapped stems": APIKeyPrefix + expiring.ID + strings.TrimPrefix(revoked.Key, APIKeyPrefix+revoked.ID),
+	} {
+		if principal, err := p.Authenticate(ctx, bearerRequest(key)); err == nil {
+			t.Errorf("%s: key accepted as %+v", name, principal)
+		}
+	}
+}
+
+func TestAPIKeyRevokeScopedToOrg(t *testing.T) {
+	p, _, _ := newTestAPIKeyProvider(t, nil)
+	ctx := context.Background()
+	k, err := p.CreateKey(ctx, "ci", nil, "acme", "alice", nil)
+	if err != nil {
+		t.Fatalf("CreateKey: %v", err)
+	}
+
+	if _, err := p.RevokeKey(ctx, k.ID, "initech"); !errors.Is(err, store.ErrAPIKeyNotFound) {
+		t.Errorf("RevokeKey from another org: got %v, want ErrAPIKeyNotFound", err)
+	}
+	if _, err := p.Authenticate(ctx, bearerRequest(k.Key)); err != nil {
+		t.Errorf("key stopped working after a refused revoke: %v", err)
+	}
+
+	revoked, err := p.RevokeKey(ctx, k.ID, "acme")
+	if err != nil || !revoked.Revoked {
+		t.Fatalf("RevokeKey = %+v, %v; want revoked", revoked, err)
+	}
+	keys, err := p.ListKeys(ctx, "acme")
+	if err != nil || len(keys) != 1 || !keys[0].Revoked {
+		t.Errorf("ListKeys = %+v, %v; want the key, listed as revoked", keys, err)
+	}
+	if keys, err := p.ListKeys(ctx, "initech"); err != nil || len(keys) != 0 {
+		t.Errorf("ListKeys(initech) = %+v, %v; want none", keys, err)
+	}
+}
+
+func TestAPIKeyFallback(t *testing.T) {
+	p, _, _ := newTestAPIKeyProvider(t, NewTokenProvider("shared-secret", ""))
+
+	principal, err := p.Authenticate(context.Background(), bearerRequest("shared-secret"))
+	if err != nil || !principal.HasRole("admin") {
+		t.Fatalf("shared secret: principal %+v, err %v; want the wrapped provider's admin", principal, err)
+	}
+	if _, err := p.Authenticate(context.Background(), bearerRequest("not-the-secret")); err == nil {
+		t.Error("wrong shared secret accepted")
+	}
+	// Something shaped like an API key is never passed on.
+	if _, err := p.Authenticate(context.Background(), bearerRequest(APIKeyPrefix+"shared-secret")); err == nil {
+		t.Error("malformed api key accepted")
+	}
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+)
+
+// CFAccessHeader carries the JWT Cloudflare Access adds to every request it
+// lets through to the origin.
+const CFAccessHeader = "Cf-Access-Jwt-Assertion"
+
+// cfAccessClockSkew is how far Cloudflare's clock may be ahead of or behind
+// ours when checking an assertion's exp, nbf, and iat claims.
+const cfAccessClockSkew = time.Minute
+
+// CloudflareAccessProvider authenticates requests fronted by Cloudflare
+// Access by validating the assertion in the Cf-Access-Jwt-Assertion header
+// against the team's public keys. The principal's subject is the user's
+// email, or a service token's client ID.
+type CloudflareAccessProvider struct {
+	issuer   string // team URL, e.g. https://myteam.cloudflareaccess.com
+	audience string // application AUD tag
+	roles    []string
+	admins   []string
+	keys     *jwksKeys
+	clock    clock.Clock
+}
+
+// NewCloudflareAccessProvider creates a provider for the Access application
+// cfg.CFAccessAudience in team cfg.CFAccessTeamDomain. The team's keys are
+// fetched when the first assertion arrives. Every principal gets
+// cfg.CFAccessRoles, and those in cfg.CFAccessAdmins also get admin.
+func NewCloudflareAccessProvider(cfg config.AuthConfig, clk clock.Clock) (*CloudflareAccessProvider, error) {
+	if cfg.CFAccessTeamDomain == "" {
+		return nil, fmt.Errorf("Cloudflare Access team domain is required")
+	}
+	if cfg.CFAccessAudience == "" {
+		return nil, fmt.Errorf("Cloudflare Access AUD tag is required")
+	}
+
+	issuer := strings.TrimRight(cfg.CFAccessTeamDomain, "/")
+	if !strings.Contains(issuer, "://") {
+		issuer = "https://" + issuer
+	}
+
+	return &CloudflareAccessProvider{
+		issuer:   issuer,
+		audience: cfg.CFAccessAudience,
+		roles:    cfg.CFAccessRoles,
+		admins:   cfg.CFAccessAdmins,
+		keys: &jwksKeys{
+			url:    issuer + "/cdn-cgi/access/certs",
+			name:   "Cloudflare Access certs",
+			client: &http.Client{Timeout: 10 * time.Second},
+			clock:  clk,
+		},
+		clock: clk,
+	}, nil
+}
+
+// cfAccessClaims holds the claims of an Access assertion. Service token
+// assertions have no email; common_name is the token's client ID.
+type cfAccessClaims struct {
+	jwtClaims
+	CommonName string `json:"common_name,omitempty"`
+}
+
+// Authenticate validates the request's Access assertion.
+func (p *CloudflareAccessProvider) Authenticate(ctx context.Context, r *http.Request) (*Principal, error) {
+	token := r.Header.Get(CFAccessHeader)
+	if token == "" {
+		return nil, fmt.Errorf("missing %s header", CFAccessHeader)
+	}
+
+	claims, err := p.validateToken(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid access assertion: %w", err)
+	}
+
+	subject := claims.Email
+	if subject == "" {
+		subject = claims.CommonName
+	}
+	if subject == "" {
+		return nil, fmt.Errorf("invalid access assertion: no email or common_name")
+	}
+
+	roles := slices.Clone(p.roles)
+	if slices.Contains(p.admins, subject) && !slices.Contains(roles, "admin") {
+		roles = append(roles, "admin")
+	}
+
+	return &Principal{
+		Subject: subject,
+		Roles:   roles,
+		Email:   claims.Email,
+		Name:    claims.Name,
+	}, nil
+}
+
+// validateToken verifies the assertion's RS256 signature and checks its
+// issuer, audience, and validity period.
+func (p *CloudflareAccessProvider) validateToken(ctx context.Context, token string) (*cfAccessClaims, error) {
+	payload, err := p.keys.verifyRS256(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	var claims cfAccessClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("unmarshal JWT claims: %w", err)
+	}
+
+	if claims.Issuer != p.issuer {
+		return nil, fmt.Errorf("issuer mismatch: got %q, want %q", claims.Issuer, p.issuer)
+	}
+	if !audienceContains(claims.Audience, p.audience) {
+		return nil, fmt.Errorf("audience %q not found in token", p.audience)
+	}
+	if err := checkTokenTimes(&claims.jwtClaims, p.clock.Now(), cfAccessClockSkew, true); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+)
+
+const testCFAudience = "test-aud-tag"
+
+// claims returns valid assertion claims for email at the fake clock's now.
+func (team *testIssuer) claims(email string) map[string]any {
+	return map[string]any{
+		"iss":   team.url,
+		"aud":   []string{testCFAudience},
+		"email": email,
+		"sub":   "user-id",
+		"iat":   testEpoch.Unix(),
+		"nbf":   testEpoch.Unix(),
+		"exp":   testEpoch.Add(time.Hour).Unix(),
+	}
+}
+
+func newTestCFAccessProvider(t *testing.T, team *testIssuer) (*CloudflareAccessProvider, *clock.FakeClock) {
+	t.Helper()
+	clk := clock.NewFake(testEpoch)
+	p, err := NewCloudflareAccessProvider(config.AuthConfig{
+		CFAccessTeamDomain: team.url,
+		CFAccessAudience:   testCFAudience,
+		CFAccessRoles:      []string{"user"},
+		CFAccessAdmins:     []string{"boss@example.com"},
+	}, clk)
+	if err != nil {
+		t.Fatalf("NewCloudflareAccessProvider: %v", err)
+	}
+	return p, clk
+}
+
+func cfAccessRequest(assertion string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/gateways", nil)
+	if assertion != "" {
+		r.Header.Set(CFAccessHeader, assertion)
+	}
+	return r
+}
+
+func TestCFAccessValidAssertion(t *testing.T) {
+	team := newTestIssuer(t, "k1")
+	p, _ := newTestCFAccessProvider(t, team)
+
+	principal, err := p.Authenticate(context.Background(), cfAccessRequest(team.sign(t, "k1", team.claims("alice@example.com"))))
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if principal.Subject != "alice@example.com" || principal.Email != "alice@example.com" || !slices.Equal(principal.Roles, []string{"user"}) {
+		t.Errorf("principal = %+v, want alice with role user", principal)
+	}
+
+	principal, err = p.Authenticate(context.Background(), cfAccessRequest(team.sign(t, "k1", team.claims("boss@example.com"))))
+	if err != nil {
+		t.Fatalf("Authenticate admin: %v", err)
+	}
+	if !principal.HasRole("admin") || !principal.HasRole("user") {
+		t.Errorf("admin principal roles = %v, want user and admin", principal.Roles)
+	}
+
+	// Service tokens carry their client ID instead of an email.
+	service := team.claims("")
+	delete(service, "email")
+	service["common_name"] = "client-id.access"
+	principal, err = p.Authenticate(context.Background(), cfAccessRequest(team.sign(t, "k1", service)))
+	if err != nil || principal.Subject != "client-id.access" {
+		t.Errorf("service token: principal %+v, err %v; want subject client-id.access", principal, err)
+	}
+}
+
+func TestCFAccessInvalidAssertions(t *testing.T) {
+	team := newTestIssuer(t, "k1")
+	rogue := newTestIssuer(t, "k1", "k9") // k1 is a different key under the same ID
+	p, _ := newTestCFAccessProvider(t, team)
+
+	with := func(mutate func(map[string]any)) map[string]any {
+		c := team.claims("alice@example.com")
+		mutate(c)
+		return c
+	}
+	// Swap in a payload naming an admin, keeping alice's signature.
+	parts := strings.Split(team.sign(t, "k1", team.claims("alice@example.com")), ".")
+	forged, err := json.Marshal(team.claims("boss@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString(forged) + "." + parts[2]
+
+	for name, assertion := range map[string]string{
+		"missing":          "",
+		"malformed":        "not-a-jwt",
+		"wrong key":        rogue.sign(t, "k1", team.claims("alice@example.com")),
+		"unknown key":      rogue.sign(t, "k9", team.claims("alice@example.com")),
+		"tampered payload": tampered,
+		"wrong issuer":     team.sign(t, "k1", with(func(c map[string]any) { c["iss"] = "https://other.cloudflareaccess.com" })),
+		"wrong audience":   team.sign(t, "k1", with(func(c map[string]any) { c["aud"] = []string{"other-app"} })),
+		"expired":          team.sign(t, "k1", with(func(c map[string]any) { c["exp"] = testEpoch.Add(-2 * time.Minute).Unix() })),
+		"no expiry":        team.sign(t, "k1", with(func(c map[string]any) { delete(c, "exp") })),
+		"not yet valid":    team.sign(t, "k1", with(func(c map[string]any) { c["nbf"] = testEpoch.Add(time.Hour).Unix() })),
+		"no identity":      team.sign(t, "k1", with(func(c map[string]any) { delete(c, "email") })),
+	} {
+		if principal, err := p.Authenticate(context.Background(), cfAccessRequest(assertion)); err == nil {
+			t.Errorf("%s: assertion accepted as %+v", name, principal)
+		}
+	}
+}
+
+func TestCFAccessKeyRotation(t *testing.T) {
+	team := newTestIssuer(t, "old", "new")
+	team.publish.Store([]string{"old"})
+	p, clk := newTestCFAccessProvider(t, team)
+
+	if _, err := p.Authenticate(context.Background(), cfAccessRequest(team.sign(t, "old", team.claims("alice@example.com")))); err != nil {
+		t.Fatalf("Authenticate with the published key: %v", err)
+	}
+
+	// Cloudflare rotates to a new key. Until the refetch interval has
+	// passed, assertions signed with it are refused without another fetch.
+	team.publish.Store([]string{"old", "new"})
+	assertion := team.sign(t, "new", team.claims("alice@example.com"))
+	if _, err := p.Authenticate(context.Background(), cfAccessRequest(assertion)); err == nil {
+		t.Fatal("assertion with an unfetched key accepted before the refetch interval")
+	}
+	if got := team.fetches.Load(); got != 1 {
+		t.Fatalf("keys fetched %d times, want 1", got)
+	}
+
+	clk.Advance(jwksRefetchInterval)
+	if _, err := p.Authenticate(context.Background(), cfAccessRequest(assertion)); err != nil {
+		t.Fatalf("Authenticate with the rotated key: %v", err)
+	}
+	if got := team.fetches.Load(); got != 2 {
+		t.Errorf("keys fetched %d times, want 2", got)
+	}
+}
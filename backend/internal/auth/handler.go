@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/httputil"
+)
+
+// defaultTokenTTL is the lifetime of an issued token when the request sets
+// none.
+const defaultTokenTTL = time.Hour
+
+// Issuer mints signed tokens for a subject.
+type Issuer interface {
+	Issue(subject string, roles []string, org string, ttl time.Duration) (token string, expiresAt time.Time, err error)
+}
+
+// IssueTokenRequest is the payload for minting a token.
+type IssueTokenRequest struct {
+	Subject string   `json:"subject"`
+	Roles   []string `json:"roles,omitempty"`
+	Org     string   `json:"org,omitempty"` // defaults to the caller's organization
+	TTL     string   `json:"ttl,omitempty"` // Go duration; defaults to 1h, capped by server config
+}
+
+// IssueTokenResponse carries a minted token.
+type IssueTokenResponse struct {
+	Token     string    `json:"token"`
+	Subject   string    `json:"subject"`
+	Roles     []string  `json:"roles"`
+	Org       string    `json:"org,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Handler exposes token issuing and API key management over HTTP.
+type Handler struct {
+	issuer  Issuer          // nil when the configured provider cannot issue tokens
+	keys    *APIKeyProvider // nil when API keys are not accepted
+	auditor *audit.Logger
+	maxTTL  time.Duration
+}
+
+// NewHandler creates a token handler. API keys can be managed when p is an
+// *APIKeyProvider, and tokens can only be issued when p, or the provider an
+// *APIKeyProvider wraps, implements Issuer; maxTTL caps their lifetime.
+func NewHandler(p Provider, auditor *audit.Logger, maxTTL time.Duration) *Handler {
+	keys, _ := p.(*APIKeyProvider)
+	if keys != nil {
+		p = keys.next
+	}
+	issuer, _ := p.(Issuer)
+	return &Handler{issuer: issuer, keys: keys, auditor: auditor, maxTTL: maxTTL}
+}
+
+// IssueToken handles POST /api/v1/auth/token.
+func (h *Handler) IssueToken(w http.ResponseWriter, r *http.Request) {
+	if h.issuer == nil {
+		httputil.WriteError(w, r, http.StatusNotImplemented, "token issuing requires LT_AUTH_PROVIDER=hmac", nil)
+		return
+	}
+
+	var req IssueTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.WriteBodyError(w, r, err)
+		return
+	}
+	req.Subject = strings.TrimSpace(req.Subject)
+	if req.Subject == "" {
+		httputil.WriteError(w, r, http.StatusBadRequest, "subject is required", nil)
+		return
+	}
+	for _, role := range req.Roles {
+		if strings.TrimSpace(role) == "" {
+			httputil.WriteError(w, r, http.StatusBadRequest, "roles must not be empty", nil)
+			return
+		}
+	}
+	if req.Roles == nil {
+		req.Roles = []string{}
+	}
+
+	// A caller scoped to an organization can only issue tokens within it.
+	var issuedBy, callerOrg string
+	if p, ok := PrincipalFromContext(r.Context()); ok {
+		issuedBy, callerOrg = p.Subject, p.Org
+	}
+	req.Org = strings.TrimSpace(req.Org)
+	switch {
+	case req.Org == "":
+		req.Org = callerOrg
+	case callerOrg != "" && req.Org != callerOrg:
+		httputil.WriteError(w, r, http.StatusForbidden, "forbidden", fmt.Errorf("cannot issue tokens for organization %q", req.Org))
+		return
+	}
+
+	ttl := defaultTokenTTL
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil || d <= 0 {
+			httputil.WriteError(w, r, http.StatusBadRequest, "ttl must be a positive Go duration", nil)
+			return
+		}
+		ttl = d
+	}
+	if h.maxTTL > 0 && ttl > h.maxTTL {
+		httputil.WriteJSON(w, http.StatusBadRequest, httputil.ErrorResponse{
+			Error:   "ttl too long",
+			Message: fmt.Sprintf("ttl %s exceeds the maximum of %s", ttl, h.maxTTL),
+		})
+		return
+	}
+
+	token, expires, err := h.issuer.Issue(req.Subject, req.Roles, req.Org, ttl)
+	if err != nil {
+		httputil.WriteError(w, r, http.StatusInternalServerError, "failed to issue token", err)
+		return
+	}
+
+	h.auditor.Log(r.Context(), audit.Event{
+		Action:   "auth.token_issued",
+		Resource: req.Subject,
+		Subject:  issuedBy,
+		Detail:   fmt.Sprintf("issued token with roles [%s] expiring %s", strings.Join(req.Roles, ", "), expires.UTC().Format(time.RFC3339)),
+	})
+
+	httputil.WriteJSON(w, http.StatusCreated, IssueTokenResponse{
+		Token:     token,
+		Subject:   req.Subject,
+		Roles:     req.Roles,
+		Org:       req.Org,
+		ExpiresAt: expires.UTC(),
+	})
+}
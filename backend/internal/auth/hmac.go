@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+)
+
+// MinHMACKeyBytes is the shortest signing key NewHMACTokenProvider accepts.
+const MinHMACKeyBytes = 32
+
+// hmacTokenIssuer is the iss claim of tokens the server signs, so they are
+// not mistaken for tokens from another issuer sharing the key.
+const hmacTokenIssuer = "lobstertank"
+
+// ErrTokenExpired is returned for a signed token past its expiry.
+var ErrTokenExpired = errors.New("token expired")
+
+// hs256Header is the fixed, pre-encoded JOSE header of every signed token.
+var hs256Header = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// HMACTokenProvider issues and validates HS256-signed JWTs carrying a
+// subject, roles, and an expiry, giving each user their own expiring
+// credential without an external identity provider.
+type HMACTokenProvider struct {
+	key   []byte
+	clock clock.Clock
+
+	// fallback, when set, authenticates requests whose bearer token is not
+	// a signed token, so the shared secret can mint the first tokens.
+	fallback Provider
+}
+
+// hmacClaims is the payload of a signed token.
+type hmacClaims struct {
+	Issuer   string   `json:"iss"`
+	Subject  string   `json:"sub"`
+	Roles    []string `json:"roles"`
+	Org      string   `json:"org,omitempty"`
+	IssuedAt int64    `json:"iat"`
+	Expiry   int64    `json:"exp"`
+}
+
+// NewHMACTokenProvider creates a provider signing with key, which must be at
+// least MinHMACKeyBytes long. A non-nil fallback authenticates bearer tokens
+// that are not signed tokens.
+func NewHMACTokenProvider(key []byte, clk clock.Clock, fallback Provider) (*HMACTokenProvider, error) {
+	if len(key) < MinHMACKeyBytes {
+		return nil, fmt.Errorf("HMAC signing key must be at least %d bytes, got %d", MinHMACKeyBytes, len(key))
+	}
+	return &HMACTokenProvider{key: key, clock: clk, fallback: fallback}, nil
+}
+
+// Issue signs a token for subject with the given roles, valid for ttl. A
+// non-empty org scopes the token to that organization.
+func (p *HMACTokenProvider) Issue(subject string, roles []string, org string, ttl time.Duration) (string, time.Time, error) {
+	now := p.clock.Now()
+	expires := now.Add(ttl).Truncate(time.Second)
+
+	payload, err := json.Marshal(hmacClaims{
+		Issuer:   hmacTokenIssuer,
+		Subject:  subject,
+		Roles:    roles,
+		Org:      org,
+		IssuedAt: now.Unix(),
+		Expiry:   expires.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("marshal token claims: %w", err)
+	}
+
+	signingInput := hs256Header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + p.sign(signingInput), expires, nil
+}
+
+// Authenticate validates a signed bearer token. Tokens that are not
+// three dot-separated parts go to the fallback provider, if any.
+func (p *HMACTokenProvider) Authenticate(ctx context.Context, r *http.Request) (*Principal, error) {
+	token := extractBearerToken(r)
+	if token == "" {
+		return nil, fmt.Errorf("missing bearer token")
+	}
+	if strings.Count(token, ".") != 2 && p.fallback != nil {
+		return p.fallback.Authenticate(ctx, r)
+	}
+
+	claims, err := p.validate(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+	return &Principal{Subject: claims.Subject, Roles: claims.Roles, Org: claims.Org}, nil
+}
+
+// validate checks a token's header, signature, issuer, and expiry.
+func (p *HMACTokenProvider) validate(token string) (*hmacClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token: expected 3 parts, got %d", len(parts))
+	}
+
+	// The header is fixed, so comparing it rejects any other algorithm.
+	if parts[0] != hs256Header {
+		return nil, fmt.Errorf("unsupported token header")
+	}
+	signingInput := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(p.sign(signingInput))) {
+		return nil, fmt.Errorf("signature mismatch")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("decode token payload: %w", err)
+	}
+	var claims hmacClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("unmarshal token claims: %w", err)
+	}
+
+	if claims.Issuer != hmacTokenIssuer {
+		return nil, fmt.Errorf("issuer mismatch: got %q", claims.Issuer)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("token has no subject")
+	}
+	if !p.clock.Now().Before(time.Unix(claims.Expiry, 0)) {
+		return nil, ErrTokenExpired
+	}
+	return &claims, nil
+}
+
+func (p *HMACTokenProvider) sign(signingInput string) string {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(signingInput))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+)
+
+var testEpoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var testHMACKey = []byte("0123456789abcdef0123456789abcdef")
+
+func newTestHMACProvider(t *testing.T, fallback Provider) (*HMACTokenProvider, *clock.FakeClock) {
+	t.Helper()
+	clk := clock.NewFake(testEpoch)
+	p, err := NewHMACTokenProvider(testHMACKey, clk, fallback)
+	if err != nil {
+		t.Fatalf("NewHMACTokenProvider: %v", err)
+	}
+	return p, clk
+}
+
+// bearerRequest returns a request carrying token as its bearer token.
+func bearerRequest(token string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/gateways", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func TestHMACTokenRoundTrip(t *testing.T) {
+	p, _ := newTestHMACProvider(t, nil)
+	token, expires, err := p.Issue("alice", []string{"operator", "viewer"}, "acme", time.Hour)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if want := testEpoch.Add(time.Hour); !expires.Equal(want) {
+		t.Errorf("expires = %v, want %v", expires, want)
+	}
+
+	principal, err := p.Authenticate(context.Background(), bearerRequest(token))
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if principal.Subject != "alice" || principal.Org != "acme" || !slices.Equal(principal.Roles, []string{"operator", "viewer"}) {
+		t.Errorf("principal = %+v, want alice in acme with operator and viewer", principal)
+	}
+}
+
+func TestHMACTokenExpiry(t *testing.T) {
+	p, clk := newTestHMACProvider(t, nil)
+	token, _, err := p.Issue("alice", nil, "", time.Minute)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	clk.Advance(time.Minute - time.Second)
+	if _, err := p.Authenticate(context.Background(), bearerRequest(token)); err != nil {
+		t.Fatalf("token rejected before expiry: %v", err)
+	}
+	clk.Advance(time.Second)
+	if _, err := p.Authenticate(context.Background(), bearerRequest(token)); !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("Authenticate at expiry = %v, want ErrTokenExpired", err)
+	}
+}
+
+func TestHMACTokenRejectsTampering(t *testing.T) {
+	p, _ := newTestHMACProvider(t, nil)
+	token, _, err := p.Issue("alice", []string{"viewer"}, "acme", time.Hour)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	parts := strings.Split(token, ".")
+
+	// Rewrite the payload to grant admin, keeping the original signature.
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	claims["roles"] = []string{"admin"}
+	forged, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherKey, err := NewHMACTokenProvider(bytes.Repeat([]byte("k"), MinHMACKeyBytes), clock.NewFake(testEpoch), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, _, err := otherKey.Issue("alice", []string{"admin"}, "acme", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	noneHeader := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	flipped := []byte(parts[2])
+	flipped[0] ^= 1
+
+	for name, tampered := range map[string]string{
+		"payload":     parts[0] + "." + base64.RawURLEncoding.EncodeToString(forged) + "." + parts[2],
+		"signature":   parts[0] + "." + parts[1] + "." + string(flipped),
+		"unsigned":    parts[0] + "." + parts[1] + ".",
+		"alg none":    noneHeader + "." + parts[1] + ".",
+		"another key": foreign,
+	} {
+		if principal, err := p.Authenticate(context.Background(), bearerRequest(tampered)); err == nil {
+			t.Errorf("%s: tampered token accepted as %+v", name, principal)
+		}
+	}
+}
+
+func TestHMACTokenFallback(t *testing.T) {
+	p, _ := newTestHMACProvider(t, NewTokenProvider("shared-secret", ""))
+
+	principal, err := p.Authenticate(context.Background(), bearerRequest("shared-secret"))
+	if err != nil || !principal.HasRole("admin") {
+		t.Fatalf("shared secret: principal %+v, err %v; want the fallback's admin", principal, err)
+	}
+	// Something shaped like a signed token is never passed on.
+	if _, err := p.Authenticate(context.Background(), bearerRequest("a.b.c")); err == nil {
+		t.Fatal("malformed signed token accepted")
+	}
+}
+
+func TestIssueTokenHandler(t *testing.T) {
+	p, _ := newTestHMACProvider(t, nil)
+	h := NewHandler(p, audit.New(config.AuditConfig{}), 24*time.Hour)
+
+	issue := func(caller *Principal, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/auth/token", strings.NewReader(body))
+		r = r.WithContext(ContextWithPrincipal(r.Context(), caller))
+		rec := httptest.NewRecorder()
+		h.IssueToken(rec, r)
+		return rec
+	}
+	admin := &Principal{Subject: "root", Roles: []string{"admin"}, Org: "acme"}
+
+	rec := issue(admin, `{"subject":"alice","roles":["viewer"],"ttl":"30m"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201: %s", rec.Code, rec.Body)
+	}
+	var resp IssueTokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if want := testEpoch.Add(30 * time.Minute); !resp.ExpiresAt.Equal(want) || resp.Org != "acme" {
+		t.Errorf("response = %+v, want expiry %v in the caller's org", resp, want)
+	}
+	principal, err := p.Authenticate(context.Background(), bearerRequest(resp.Token))
+	if err != nil || principal.Subject != "alice" || principal.Org != "acme" {
+		t.Fatalf("minted token: principal %+v, err %v; want alice in acme", principal, err)
+	}
+
+	for body, want := range map[string]int{
+		`{"roles":["viewer"]}`:                http.StatusBadRequest, // no subject
+		`{"subject":"alice","ttl":"48h"}`:     http.StatusBadRequest, // over the maximum
+		`{"subject":"alice","ttl":"-1h"}`:     http.StatusBadRequest,
+		`{"subject":"alice","org":"initech"}`: http.StatusForbidden,
+	} {
+		if rec := issue(admin, body); rec.Code != want {
+			t.Errorf("%s: status = %d, want %d", body, rec.Code, want)
+		}
+	}
+}
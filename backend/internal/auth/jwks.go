@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+)
+
+const (
+	// jwksKeysTTL is how long an issuer's signing keys are used before they
+	// are fetched again.
+	jwksKeysTTL = time.Hour
+
+	// jwksRefetchInterval limits refetching the keys when a token names a
+	// key that is not among them, as happens after a rotation.
+	jwksRefetchInterval = time.Minute
+)
+
+// jwksKeys caches an issuer's RSA signing keys, read from its JWKS endpoint
+// when the first token arrives.
+type jwksKeys struct {
+	url    string
+	name   string // describes the endpoint in errors
+	client *http.Client
+	clock  clock.Clock
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey // by key ID
+	fetchedAt time.Time
+}
+
+// verifyRS256 checks token's RS256 signature against the issuer's keys and
+// returns the decoded payload. Nothing in the payload may be trusted before
+// it has been verified.
+func (k *jwksKeys) verifyRS256(ctx context.Context, token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed JWT: expected 3 parts, got %d", len(parts))
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("decode JWT header: %w", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, fmt.Errorf("unmarshal JWT header: %w", err)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", header.Alg)
+	}
+
+	key, err := k.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("decode JWT signature: %w", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, fmt.Errorf("signature mismatch")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("decode JWT payload: %w", err)
+	}
+	return payload, nil
+}
+
+// key returns the signing key kid, fetching the keys when they are stale
+// or, at most once per jwksRefetchInterval, when kid is unknown.
+func (k *jwksKeys) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := k.clock.Now()
+	age := now.Sub(k.fetchedAt)
+	key, ok := k.keys[kid]
+	if k.keys == nil || age >= jwksKeysTTL || (!ok && age >= jwksRefetchInterval) {
+		keys, err := k.fetch(ctx)
+		if err != nil {
+			if k.keys == nil {
+				return nil, err
+			}
+			// Keep using the keys we have until the issuer's are reachable.
+		} else {
+			k.keys, k.fetchedAt = keys, now
+		}
+		key, ok = k.keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// fetch reads the issuer's RSA signing keys from its JWKS endpoint.
+func (k *jwksKeys) fetch(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build %s request: %w", k.name, err)
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", k.name, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", k.name, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned HTTP %d", k.name, resp.StatusCode)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &jwks); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", k.name, err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, key := range jwks.Keys {
+		if key.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, fmt.Errorf("decode modulus of key %q: %w", key.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, fmt.Errorf("decode exponent of key %q: %w", key.Kid, err)
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("key %q has an invalid exponent", key.Kid)
+		}
+		keys[key.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s hold no RSA keys", k.name)
+	}
+	return keys, nil
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// testIssuer is a mock token issuer: it serves its signing keys' JWKS where
+// Cloudflare Access does, OIDC discovery pointing there, and signs tokens
+// with the keys.
+type testIssuer struct {
+	url     string
+	keys    map[string]*rsa.PrivateKey // by key ID
+	publish atomic.Value               // []string of the key IDs the JWKS lists
+	fetches atomic.Int32
+}
+
+func newTestIssuer(t *testing.T, kids ...string) *testIssuer {
+	t.Helper()
+	iss := &testIssuer{keys: make(map[string]*rsa.PrivateKey)}
+	for _, kid := range kids {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("generate key: %v", err)
+		}
+		iss.keys[kid] = key
+	}
+	iss.publish.Store(kids)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{"issuer": iss.url, "jwks_uri": iss.url + "/cdn-cgi/access/certs"})
+			return
+		case "/cdn-cgi/access/certs":
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		iss.fetches.Add(1)
+		type jwk struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		}
+		var jwks struct {
+			Keys []jwk `json:"keys"`
+		}
+		for _, kid := range iss.publish.Load().([]string) {
+			pub := iss.keys[kid].PublicKey
+			jwks.Keys = append(jwks.Keys, jwk{
+				Kty: "RSA",
+				Kid: kid,
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	t.Cleanup(srv.Close)
+	iss.url = srv.URL
+	return iss
+}
+
+// sign returns an RS256 token over claims signed with key kid.
+func (iss *testIssuer) sign(t *testing.T, kid string, claims map[string]any) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, iss.keys[kid], crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
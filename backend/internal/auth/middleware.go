@@ -1,28 +1,74 @@
 package auth
 
 import (
-	"log/slog"
+	"fmt"
 	"net/http"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/logging"
 )
 
 // Middleware returns an HTTP middleware that enforces authentication using
-// the given provider.
-func Middleware(provider Provider) func(http.Handler) http.Handler {
+// the given provider. Every attempt is recorded with the auditor as
+// auth.success or auth.failure; credentials never are.
+func Middleware(provider Provider, auditor *audit.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			principal, err := provider.Authenticate(r.Context(), r)
 			if err != nil {
-				slog.Warn("authentication failed",
-					"path", r.URL.Path,
+				logging.LoggerFromContext(r.Context()).Warn("authentication failed",
 					"remote", r.RemoteAddr,
 					"error", err,
 				)
+				auditor.Log(r.Context(), audit.Event{
+					Action:   "auth.failure",
+					Resource: r.URL.Path,
+					Detail:   fmt.Sprintf("%s %s from %s rejected: %v", r.Method, r.URL.Path, r.RemoteAddr, err),
+				})
 				http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
 				return
 			}
 
+			auditor.Log(r.Context(), audit.Event{
+				Action:   "auth.success",
+				Resource: r.URL.Path,
+				Subject:  principal.Subject,
+				Detail:   fmt.Sprintf("%s %s from %s", r.Method, r.URL.Path, r.RemoteAddr),
+			})
 			ctx := ContextWithPrincipal(r.Context(), principal)
+			ctx = audit.ContextWithSubject(ctx, principal.Subject)
+			ctx = logging.With(ctx, "principal", principal.Subject)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// RequireRole returns an HTTP middleware that rejects principals lacking
+// role with 403. It must run after Middleware.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := PrincipalFromContext(r.Context())
+			if !ok || !p.HasRole(role) {
+				http.Error(w, `{"error":"forbidden"}`, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireAnyRole returns an HTTP middleware that rejects principals holding
+// no role at all with 403. It must run after Middleware.
+func RequireAnyRole() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := PrincipalFromContext(r.Context())
+			if !ok || len(p.Roles) == 0 {
+				http.Error(w, `{"error":"forbidden"}`, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+)
+
+// newFileAuditor returns an audit logger writing to a temporary file, and
+// a function reading back the events logged so far along with the raw file.
+func newFileAuditor(t *testing.T) (*audit.Logger, func() ([]audit.Event, string)) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l := audit.New(config.AuditConfig{Enabled: true, Output: "file", Path: path, RedactDefaults: true})
+	t.Cleanup(func() { l.Close() })
+
+	return l, func() ([]audit.Event, string) {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read audit log: %v", err)
+		}
+		var events []audit.Event
+		sc := bufio.NewScanner(strings.NewReader(string(data)))
+		for sc.Scan() {
+			var e audit.Event
+			if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+				t.Fatalf("decode audit line %q: %v", sc.Text(), err)
+			}
+			events = append(events, e)
+		}
+		return events, string(data)
+	}
+}
+
+func TestMiddlewareAuditsAttempts(t *testing.T) {
+	const secret = "s3cr3t-shared-token"
+	auditor, events := newFileAuditor(t)
+
+	var reached bool
+	h := Middleware(NewTokenProvider(secret, ""), auditor)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		if p, ok := PrincipalFromContext(r.Context()); !ok || p.Subject != "token-user" {
+			t.Errorf("principal in context = %+v, want token-user", p)
+		}
+	}))
+
+	request := func(token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/gateways", nil)
+		r.RemoteAddr = "192.0.2.7:4321"
+		r.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	if rec := request(secret); rec.Code != http.StatusOK || !reached {
+		t.Fatalf("valid token: status = %d, reached = %v", rec.Code, reached)
+	}
+	const wrong = "not-the-shared-token"
+	reached = false
+	if rec := request(wrong); rec.Code != http.StatusUnauthorized || reached {
+		t.Fatalf("invalid token: status = %d, reached = %v; want 401", rec.Code, reached)
+	}
+
+	logged, raw := events()
+	if len(logged) != 2 {
+		t.Fatalf("logged %d events, want 2: %s", len(logged), raw)
+	}
+	success, failure := logged[0], logged[1]
+	if success.Action != "auth.success" || success.Subject != "token-user" || success.Resource != "/api/v1/gateways" {
+		t.Errorf("success event = %+v", success)
+	}
+	if failure.Action != "auth.failure" || failure.Subject != "" || failure.Resource != "/api/v1/gateways" {
+		t.Errorf("failure event = %+v", failure)
+	}
+	for _, e := range logged {
+		if !strings.Contains(e.Detail, "192.0.2.7:4321") {
+			t.Errorf("%s detail %q lacks the remote address", e.Action, e.Detail)
+		}
+	}
+	for _, token := range []string{secret, wrong} {
+		if strings.Contains(raw, token) {
+			t.Errorf("audit log contains the bearer token %q: %s", token, raw)
+		}
+	}
+}
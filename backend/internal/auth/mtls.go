@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// MTLSProvider authenticates requests by the client certificate presented
+// on the TLS connection, verified against a CA bundle. The principal's
+// subject is the certificate's common name, or failing that its first DNS,
+// email, or URI SAN. Its roles are the certificate's organizational units
+// and, when a role URI prefix is set, the rest of every URI SAN under it.
+// Its organization is the certificate's organization (O); a certificate
+// without one is unscoped unless the provider requires an organization.
+type MTLSProvider struct {
+	clientCAs  *x509.CertPool
+	uriPrefix  string // URI SAN prefix naming a role, e.g. "spiffe://example.org/role/"; empty disables
+	requireOrg bool   // reject certificates without an organization
+
+	// fallback, when set, authenticates requests made without a client
+	// certificate; the listener then asks for certificates without
+	// requiring them.
+	fallback Provider
+}
+
+// NewMTLSProvider creates a provider trusting the CAs in the PEM file
+// caFile. When requireOrg is set, certificates must name an organization. A
+// non-nil fallback authenticates requests that carry no client certificate,
+// so certificate and bearer-token clients can share a listener.
+func NewMTLSProvider(caFile, roleURIPrefix string, requireOrg bool, fallback Provider) (*MTLSProvider, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("read client CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("client CA bundle %s holds no PEM certificates", caFile)
+	}
+	return &MTLSProvider{clientCAs: pool, uriPrefix: roleURIPrefix, requireOrg: requireOrg, fallback: fallback}, nil
+}
+
+// ConfigureTLS makes a server using c verify client certificates against
+// the provider's CAs, requiring one unless there is a fallback provider.
+func (p *MTLSProvider) ConfigureTLS(c *tls.Config) {
+	c.ClientCAs = p.clientCAs
+	c.ClientAuth = tls.RequireAndVerifyClientCert
+	if p.fallback != nil {
+		c.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+}
+
+// Authenticate maps the request's verified client certificate to a
+// principal. Requests without one go to the fallback provider, if any.
+func (p *MTLSProvider) Authenticate(ctx context.Context, r *http.Request) (*Principal, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		if p.fallback != nil {
+			return p.fallback.Authenticate(ctx, r)
+		}
+		return nil, fmt.Errorf("missing client certificate")
+	}
+	// The TLS handshake has already verified the chain; a certificate
+	// without one was not checked against our CAs.
+	if len(r.TLS.VerifiedChains) == 0 {
+		return nil, fmt.Errorf("client certificate not verified")
+	}
+
+	cert := r.TLS.PeerCertificates[0]
+	subject := certSubject(cert)
+	if subject == "" {
+		return nil, fmt.Errorf("client certificate has no common name or subject alternative name")
+	}
+	org, err := p.certOrg(cert)
+	if err != nil {
+		return nil, err
+	}
+
+	var email string
+	if len(cert.EmailAddresses) > 0 {
+		email = cert.EmailAddresses[0]
+	}
+	return &Principal{
+		Subject: subject,
+		Roles:   p.certRoles(cert),
+		Org:     org,
+		Email:   email,
+		Name:    cert.Subject.CommonName,
+	}, nil
+}
+
+// certSubject names the holder of cert: its common name, or else its first
+// DNS, email, or URI subject alternative name.
+func certSubject(cert *x509.Certificate) string {
+	switch {
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	}
+	return ""
+}
+
+// certOrg returns the organization cert scopes its holder to. A certificate
+// naming several is refused, since it is unclear which one was meant.
+func (p *MTLSProvider) certOrg(cert *x509.Certificate) (string, error) {
+	switch orgs := cert.Subject.Organization; {
+	case len(orgs) > 1:
+		return "", fmt.Errorf("client certificate names %d organizations, want one", len(orgs))
+	case len(orgs) == 1 && orgs[0] != "":
+		return orgs[0], nil
+	case p.requireOrg:
+		return "", fmt.Errorf("client certificate names no organization")
+	}
+	return "", nil
+}
+
+// certRoles returns the roles cert grants, each once: its organizational
+// units and the roles its URI SANs name under the role prefix.
+func (p *MTLSProvider) certRoles(cert *x509.Certificate) []string {
+	var roles []string
+	add := func(role string) {
+		if role != "" && !slices.Contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		add(ou)
+	}
+	if p.uriPrefix != "" {
+		for _, u := range cert.URIs {
+			if role, ok := strings.CutPrefix(u.String(), p.uriPrefix); ok {
+				add(role)
+			}
+		}
+	}
+	return roles
+}
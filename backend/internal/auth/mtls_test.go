@@ -0,0 +1,350 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRolePrefix = "spiffe://example.org/role/"
+
+// testCA is a certificate authority issuing client certificates for tests.
+type testCA struct {
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	file   string // PEM bundle holding cert
+	serial int64
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate CA key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create CA certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse CA certificate: %v", err)
+	}
+	file := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write CA bundle: %v", err)
+	}
+	return &testCA{cert: cert, key: key, file: file, serial: 1}
+}
+
+// issue signs a client certificate carrying the identity in tmpl.
+func (ca *testCA) issue(t *testing.T, tmpl x509.Certificate) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate client key: %v", err)
+	}
+	ca.serial++
+	tmpl.SerialNumber = big.NewInt(ca.serial)
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("create client certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse client certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestCertSubject(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		cert x509.Certificate
+		want string
+	}{
+		{"common name", x509.Certificate{Subject: pkix.Name{CommonName: "alice"}, DNSNames: []string{"alice.example.com"}}, "alice"},
+		{"DNS SAN", x509.Certificate{DNSNames: []string{"svc.example.com"}, EmailAddresses: []string{"svc@example.com"}}, "svc.example.com"},
+		{"email SAN", x509.Certificate{EmailAddresses: []string{"bob@example.com"}}, "bob@example.com"},
+		{"URI SAN", x509.Certificate{URIs: []*url.URL{mustParseURL(t, "spiffe://example.org/ns/prod/sa/deployer")}}, "spiffe://example.org/ns/prod/sa/deployer"},
+		{"no identity", x509.Certificate{Subject: pkix.Name{Organization: []string{"Example"}}}, ""},
+	} {
+		if got := certSubject(&tt.cert); got != tt.want {
+			t.Errorf("%s: certSubject = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCertRoles(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject: pkix.Name{CommonName: "alice", OrganizationalUnit: []string{"operator", "viewer"}},
+		URIs: []*url.URL{
+			mustParseURL(t, testRolePrefix+"admin"),
+			mustParseURL(t, testRolePrefix+"viewer"), // already granted by an OU
+			mustParseURL(t, "spiffe://other.org/role/root"),
+		},
+	}
+
+	p := &MTLSProvider{uriPrefix: testRolePrefix}
+	if got, want := p.certRoles(cert), []string{"operator", "viewer", "admin"}; !slices.Equal(got, want) {
+		t.Errorf("roles = %v, want %v", got, want)
+	}
+	// Without a prefix, URI SANs grant nothing.
+	p = &MTLSProvider{}
+	if got, want := p.certRoles(cert), []string{"operator", "viewer"}; !slices.Equal(got, want) {
+		t.Errorf("roles without a prefix = %v, want %v", got, want)
+	}
+}
+
+func TestNewMTLSProviderRequiresCABundle(t *testing.T) {
+	if _, err := NewMTLSProvider(filepath.Join(t.TempDir(), "missing.pem"), "", false, nil); err == nil {
+		t.Error("missing CA bundle accepted")
+	}
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(empty, []byte("not a certificate\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewMTLSProvider(empty, "", false, nil); err == nil {
+		t.Error("CA bundle without certificates accepted")
+	}
+}
+
+func TestMTLSConfigureTLS(t *testing.T) {
+	ca := newTestCA(t, "test CA")
+	for _, tt := range []struct {
+		fallback Provider
+		want     tls.ClientAuthType
+	}{
+		{nil, tls.RequireAndVerifyClientCert},
+		{NewTokenProvider("shared-secret", ""), tls.VerifyClientCertIfGiven},
+	} {
+		p, err := NewMTLSProvider(ca.file, "", false, tt.fallback)
+		if err != nil {
+			t.Fatalf("NewMTLSProvider: %v", err)
+		}
+		var c tls.Config
+		p.ConfigureTLS(&c)
+		if c.ClientAuth != tt.want || c.ClientCAs == nil {
+			t.Errorf("fallback %v: ClientAuth = %v, ClientCAs set = %v; want %v with the CA pool", tt.fallback != nil, c.ClientAuth, c.ClientCAs != nil, tt.want)
+		}
+	}
+}
+
+func TestMTLSAuthenticateRequiresVerifiedCert(t *testing.T) {
+	ca := newTestCA(t, "test CA")
+	cert := ca.issue(t, x509.Certificate{Subject: pkix.Name{CommonName: "alice"}})
+	anonymous := ca.issue(t, x509.Certificate{Subject: pkix.Name{Organization: []string{"Example"}}})
+	verified := func(c tls.Certificate) *tls.ConnectionState {
+		return &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{c.Leaf},
+			VerifiedChains:   [][]*x509.Certificate{{c.Leaf, ca.cert}},
+		}
+	}
+
+	withFallback, err := NewMTLSProvider(ca.file, "", false, NewTokenProvider("shared-secret", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutFallback, err := NewMTLSProvider(ca.file, "", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		p       *MTLSProvider
+		state   *tls.ConnectionState
+		subject string // empty when authentication must fail
+	}{
+		{"verified", withoutFallback, verified(cert), "alice"},
+		{"plain HTTP", withoutFallback, nil, ""},
+		{"no certificate", withoutFallback, &tls.ConnectionState{}, ""},
+		{"no certificate with fallback", withFallback, &tls.ConnectionState{}, "token-user"},
+		{"unverified", withFallback, &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert.Leaf}}, ""},
+		{"no identity", withoutFallback, verified(anonymous), ""},
+	} {
+		r := bearerRequest("shared-secret")
+		r.TLS = tt.state
+		principal, err := tt.p.Authenticate(context.Background(), r)
+		switch {
+		case tt.subject == "" && err == nil:
+			t.Errorf("%s: authenticated as %+v", tt.name, principal)
+		case tt.subject != "" && (err != nil || principal.Subject != tt.subject):
+			t.Errorf("%s: principal %+v, err %v; want %s", tt.name, principal, err, tt.subject)
+		}
+	}
+}
+
+func TestMTLSOrg(t *testing.T) {
+	ca := newTestCA(t, "test CA")
+	issue := func(orgs ...string) *tls.ConnectionState {
+		c := ca.issue(t, x509.Certificate{Subject: pkix.Name{CommonName: "client", Organization: orgs}})
+		return &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{c.Leaf},
+			VerifiedChains:   [][]*x509.Certificate{{c.Leaf, ca.cert}},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		state      *tls.ConnectionState
+		requireOrg bool
+		wantOrg    string
+		wantErr    bool
+	}{
+		{"org A", issue("acme"), false, "acme", false},
+		{"org B", issue("initech"), true, "initech", false},
+		{"no org", issue(), false, "", false},
+		{"no org required", issue(), true, "", true},
+		{"several orgs", issue("acme", "initech"), false, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewMTLSProvider(ca.file, "", tt.requireOrg, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/gateways", nil)
+			r.TLS = tt.state
+			principal, err := p.Authenticate(context.Background(), r)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("authenticated as %+v", principal)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if principal.Org != tt.wantOrg {
+				t.Errorf("org = %q, want %q", principal.Org, tt.wantOrg)
+			}
+		})
+	}
+}
+
+// newMTLSServer serves the principal p authenticates, as "subject roles...",
+// over a TLS listener configured by p.
+func newMTLSServer(t *testing.T, p *MTLSProvider) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := p.Authenticate(r.Context(), r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, strings.Join(append([]string{principal.Subject}, principal.Roles...), " "))
+	}))
+	srv.TLS = &tls.Config{}
+	p.ConfigureTLS(srv.TLS)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// getAs requests srv's root presenting cert, if any, and the bearer token
+// "shared-secret". It returns the response body, or the error that stopped
+// the request.
+func getAs(srv *httptest.Server, cert *tls.Certificate) (string, error) {
+	tr := srv.Client().Transport.(*http.Transport).Clone()
+	if cert != nil {
+		tr.TLSClientConfig.Certificates = []tls.Certificate{*cert}
+	}
+	defer tr.CloseIdleConnections()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer shared-secret")
+	resp, err := (&http.Client{Transport: tr}).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status %d: %s", resp.StatusCode, body)
+	}
+	return string(body), nil
+}
+
+func TestMTLSOverTLS(t *testing.T) {
+	ca := newTestCA(t, "test CA")
+	rogue := newTestCA(t, "test CA") // same name, different key
+	alice := ca.issue(t, x509.Certificate{
+		Subject: pkix.Name{CommonName: "alice", OrganizationalUnit: []string{"operator"}},
+		URIs:    []*url.URL{mustParseURL(t, testRolePrefix+"viewer")},
+	})
+	mallory := rogue.issue(t, x509.Certificate{
+		Subject: pkix.Name{CommonName: "alice", OrganizationalUnit: []string{"admin"}},
+	})
+
+	for _, tt := range []struct {
+		name     string
+		fallback Provider
+		cert     *tls.Certificate
+		want     string // empty when the request must be refused
+	}{
+		{"trusted certificate", nil, &alice, "alice operator viewer"},
+		{"untrusted certificate", nil, &mallory, ""},
+		{"no certificate", nil, nil, ""},
+		{"trusted certificate with fallback", NewTokenProvider("shared-secret", ""), &alice, "alice operator viewer"},
+		{"untrusted certificate with fallback", NewTokenProvider("shared-secret", ""), &mallory, ""},
+		{"no certificate with fallback", NewTokenProvider("shared-secret", ""), nil, "token-user admin"},
+	} {
+		p, err := NewMTLSProvider(ca.file, testRolePrefix, false, tt.fallback)
+		if err != nil {
+			t.Fatalf("NewMTLSProvider: %v", err)
+		}
+		got, err := getAs(newMTLSServer(t, p), tt.cert)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("%s: request served as %q", tt.name, got)
+		case tt.want != "" && (err != nil || got != tt.want):
+			t.Errorf("%s: got %q, err %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
@@ -2,13 +2,16 @@ package auth
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
 )
 
 // OIDCProvider validates JWT tokens against an OIDC issuer using the
@@ -17,8 +20,15 @@ type OIDCProvider struct {
 	issuer   string
 	clientID string
 	audience string
-	jwksURI  string
-	client   *http.Client
+	orgClaim string // claim naming the principal's organization; empty disables scoping
+	keys     *jwksKeys
+
+	rolesClaim string              // dotted path to the claim listing the principal's groups
+	roleMap    map[string][]string // group to roles; nil uses groups as roles
+
+	clock         clock.Clock
+	clockSkew     time.Duration // leeway for the issuer's clock in the exp, nbf, and iat checks
+	requireExpiry bool          // reject tokens without an exp claim
 }
 
 // oidcDiscovery represents the OIDC discovery document.
@@ -27,9 +37,14 @@ type oidcDiscovery struct {
 	JWKSURI string `json:"jwks_uri"`
 }
 
-// NewOIDCProvider creates an OIDC-based auth provider. It performs OIDC
-// discovery to resolve the JWKS endpoint for token validation.
-func NewOIDCProvider(ctx context.Context, issuer, clientID, audience string) (*OIDCProvider, error) {
+// NewOIDCProvider creates an OIDC-based auth provider from the OIDC settings
+// in cfg. It performs OIDC discovery to resolve the JWKS endpoint whose keys
+// verify token signatures; they are fetched when the first token arrives. The string claim named by cfg.OIDCOrgClaim, when set, scopes
+// principals to an organization. Principals get the roles that
+// cfg.OIDCRoleMap maps their groups, read from cfg.OIDCRolesClaim, to; with
+// no map, the groups themselves are the roles.
+func NewOIDCProvider(ctx context.Context, cfg config.AuthConfig, clk clock.Clock) (*OIDCProvider, error) {
+	issuer, clientID, audience := cfg.OIDCIssuer, cfg.OIDCClientID, cfg.OIDCAudience
 	if issuer == "" {
 		return nil, fmt.Errorf("OIDC issuer URL is required")
 	}
@@ -77,21 +92,38 @@ func NewOIDCProvider(ctx context.Context, issuer, clientID, audience string) (*O
 		issuer:   issuer,
 		clientID: clientID,
 		audience: audience,
-		jwksURI:  discovery.JWKSURI,
-		client:   client,
+		orgClaim: cfg.OIDCOrgClaim,
+		keys: &jwksKeys{
+			url:    discovery.JWKSURI,
+			name:   "OIDC JWKS",
+			client: client,
+			clock:  clk,
+		},
+
+		rolesClaim: cfg.OIDCRolesClaim,
+		roleMap:    cfg.OIDCRoleMap,
+
+		clock:         clk,
+		clockSkew:     cfg.OIDCClockSkew,
+		requireExpiry: cfg.OIDCRequireExpiry,
 	}, nil
 }
 
 // jwtClaims holds the standard JWT claims we validate.
 type jwtClaims struct {
-	Issuer   string      `json:"iss"`
-	Subject  string      `json:"sub"`
-	Audience jwtAudience `json:"aud"`
-	Expiry   float64     `json:"exp"`
-	IssuedAt float64     `json:"iat"`
-	Email    string      `json:"email,omitempty"`
-	Name     string      `json:"name,omitempty"`
-	Groups   []string    `json:"groups,omitempty"`
+	Issuer    string      `json:"iss"`
+	Subject   string      `json:"sub"`
+	Audience  jwtAudience `json:"aud"`
+	Expiry    float64     `json:"exp"`
+	NotBefore float64     `json:"nbf"`
+	IssuedAt  float64     `json:"iat"`
+	Email     string      `json:"email,omitempty"`
+	Name      string      `json:"name,omitempty"`
+
+	// Groups and Org are read from the provider's configured roles and
+	// organization claims.
+	Groups []string `json:"-"`
+	Org    string   `json:"-"`
 }
 
 // jwtAudience handles the "aud" claim which can be a string or array.
@@ -123,39 +155,68 @@ func (p *OIDCProvider) Authenticate(ctx context.Context, r *http.Request) (*Prin
 		return nil, fmt.Errorf("invalid token: %w", err)
 	}
 
-	// Build principal from validated claims.
+	// Build principal from validated claims. A principal whose groups map
+	// to no role is left without one for the RBAC layer to deny.
 	principal := &Principal{
 		Subject: claims.Subject,
-		Roles:   claims.Groups,
-	}
-
-	if len(principal.Roles) == 0 {
-		principal.Roles = []string{"user"}
+		Roles:   p.mapRoles(claims.Groups),
+		Org:     claims.Org,
+		Email:   claims.Email,
+		Name:    claims.Name,
 	}
 
 	return principal, nil
 }
 
-// validateToken performs basic JWT validation: decodes the payload, checks
-// issuer, audience, and expiry. In production, the token signature should be
-// verified against the JWKS keys.
-func (p *OIDCProvider) validateToken(_ context.Context, token string) (*jwtClaims, error) {
-	// Split the JWT into its three parts.
-	parts := strings.SplitN(token, ".", 3)
-	if len(parts) != 3 {
-		return nil, fmt.Errorf("malformed JWT: expected 3 parts, got %d", len(parts))
+// mapRoles returns the roles groups map to, each once. Groups missing from
+// the role map map to nothing.
+func (p *OIDCProvider) mapRoles(groups []string) []string {
+	if p.roleMap == nil {
+		return groups
+	}
+	var roles []string
+	for _, g := range groups {
+		for _, role := range p.roleMap[g] {
+			if !slices.Contains(roles, role) {
+				roles = append(roles, role)
+			}
+		}
 	}
+	return roles
+}
 
-	// Decode the payload (part 2).
-	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+// validateToken verifies the token's RS256 signature against the issuer's
+// JWKS, then reads its claims and checks its issuer, audience, and validity
+// period. The organization and roles claims decide what the principal may
+// reach, so they are only read from a verified payload.
+func (p *OIDCProvider) validateToken(ctx context.Context, token string) (*jwtClaims, error) {
+	payload, err := p.keys.verifyRS256(ctx, token)
 	if err != nil {
-		return nil, fmt.Errorf("decode JWT payload: %w", err)
+		return nil, err
 	}
 
 	var claims jwtClaims
 	if err := json.Unmarshal(payload, &claims); err != nil {
 		return nil, fmt.Errorf("unmarshal JWT claims: %w", err)
 	}
+	var extra map[string]any
+	if err := json.Unmarshal(payload, &extra); err != nil {
+		return nil, fmt.Errorf("unmarshal JWT claims: %w", err)
+	}
+	if p.orgClaim != "" {
+		if v, ok := extra[p.orgClaim]; ok {
+			org, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("claim %q must be a string", p.orgClaim)
+			}
+			claims.Org = org
+		}
+	}
+	if p.rolesClaim != "" {
+		if claims.Groups, err = stringsClaim(extra, p.rolesClaim); err != nil {
+			return nil, err
+		}
+	}
 
 	// Validate issuer.
 	if claims.Issuer != p.issuer {
@@ -167,15 +228,80 @@ func (p *OIDCProvider) validateToken(_ context.Context, token string) (*jwtClaim
 		return nil, fmt.Errorf("audience %q not found in token", p.audience)
 	}
 
-	// Validate expiry.
-	now := float64(time.Now().Unix())
-	if claims.Expiry > 0 && now > claims.Expiry {
-		return nil, fmt.Errorf("token expired")
+	if err := p.checkTimes(&claims); err != nil {
+		return nil, err
 	}
 
 	return &claims, nil
 }
 
+// checkTimes validates the exp, nbf, and iat claims, allowing for the
+// issuer's clock being up to the configured skew ahead of or behind ours.
+func (p *OIDCProvider) checkTimes(claims *jwtClaims) error {
+	return checkTokenTimes(claims, p.clock.Now(), p.clockSkew, p.requireExpiry)
+}
+
+// checkTokenTimes validates the exp, nbf, and iat claims at now, allowing
+// for the issuer's clock being up to skew ahead of or behind ours. A token
+// expires at exp itself, as RFC 7519 specifies.
+func checkTokenTimes(claims *jwtClaims, now time.Time, skew time.Duration, requireExpiry bool) error {
+	switch {
+	case claims.Expiry > 0:
+		if !now.Before(claimTime(claims.Expiry).Add(skew)) {
+			return fmt.Errorf("token expired")
+		}
+	case requireExpiry:
+		return fmt.Errorf("token has no expiry")
+	}
+	if claims.NotBefore > 0 && now.Before(claimTime(claims.NotBefore).Add(-skew)) {
+		return fmt.Errorf("token not valid yet")
+	}
+	if claims.IssuedAt > 0 && now.Before(claimTime(claims.IssuedAt).Add(-skew)) {
+		return fmt.Errorf("token issued in the future")
+	}
+	return nil
+}
+
+// claimTime converts a NumericDate claim, which may have a fraction, to a time.
+func claimTime(v float64) time.Time {
+	return time.UnixMilli(int64(v * 1000))
+}
+
+// stringsClaim reads the claim at a dotted path into nested objects, such
+// as "realm_access.roles", as a list of strings. A single string is a list
+// of one; a missing claim is an empty list.
+func stringsClaim(claims map[string]any, path string) ([]string, error) {
+	var v any = claims
+	for _, name := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, nil
+		}
+		if v, ok = obj[name]; !ok {
+			return nil, nil
+		}
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("claim %q must be a string or a list of strings", path)
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("claim %q must be a string or a list of strings", path)
+	}
+}
+
 func audienceContains(aud []string, target string) bool {
 	for _, a := range aud {
 		if a == target {
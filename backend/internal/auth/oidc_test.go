@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+)
+
+const testOIDCClientID = "lobstertank"
+
+// newTestOIDCProvider returns a provider trusting iss, configured by cfg on
+// top of the issuer and client ID.
+func newTestOIDCProvider(t *testing.T, iss *testIssuer, cfg config.AuthConfig) *OIDCProvider {
+	t.Helper()
+	cfg.OIDCIssuer, cfg.OIDCClientID, cfg.OIDCClockSkew = iss.url, testOIDCClientID, time.Minute
+	p, err := NewOIDCProvider(context.Background(), cfg, clock.NewFake(testEpoch))
+	if err != nil {
+		t.Fatalf("NewOIDCProvider: %v", err)
+	}
+	return p
+}
+
+// oidcClaims returns valid ID token claims from iss for subject in org.
+func oidcClaims(iss *testIssuer, subject, org string) map[string]any {
+	return map[string]any{
+		"iss": iss.url,
+		"aud": testOIDCClientID,
+		"sub": subject,
+		"org": org,
+		"iat": testEpoch.Unix(),
+		"exp": testEpoch.Add(time.Hour).Unix(),
+	}
+}
+
+// forge returns token with its payload replaced by claims, keeping its
+// header and signature.
+func forge(t *testing.T, token string, claims map[string]any) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+	return parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+}
+
+// unsigned returns an alg "none" token over claims.
+func unsigned(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(payload) + "."
+}
+
+func TestOIDCAuthenticate(t *testing.T) {
+	iss := newTestIssuer(t, "k1")
+	p := newTestOIDCProvider(t, iss, config.AuthConfig{OIDCOrgClaim: "org"})
+
+	principal, err := p.Authenticate(context.Background(), bearerRequest(iss.sign(t, "k1", oidcClaims(iss, "alice", "acme"))))
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if principal.Subject != "alice" || principal.Org != "acme" {
+		t.Errorf("principal = %+v, want alice in acme", principal)
+	}
+}
+
+func TestOIDCRejectsUnverifiedTokens(t *testing.T) {
+	iss := newTestIssuer(t, "k1")
+	rogue := newTestIssuer(t, "k1", "k9") // k1 is a different key under the same ID
+	p := newTestOIDCProvider(t, iss, config.AuthConfig{OIDCOrgClaim: "org"})
+	alice := iss.sign(t, "k1", oidcClaims(iss, "alice", "acme"))
+	other := oidcClaims(iss, "alice", "initech")
+
+	for name, token := range map[string]string{
+		"other org's payload": forge(t, alice, other),
+		"unsigned":            unsigned(t, other),
+		"wrong key":           rogue.sign(t, "k1", other),
+		"unknown key":         rogue.sign(t, "k9", other),
+		"no signature":        strings.Join(strings.Split(alice, ".")[:2], ".") + ".",
+		"malformed":           "not-a-jwt",
+	} {
+		if principal, err := p.Authenticate(context.Background(), bearerRequest(token)); err == nil {
+			t.Errorf("%s: token accepted as %+v", name, principal)
+		}
+	}
+}
+
+func TestCheckTokenTimes(t *testing.T) {
+	now := testEpoch
+	at := func(d time.Duration) float64 { return float64(now.Add(d).UnixMilli()) / 1000 }
+	const skew = time.Minute
+
+	tests := []struct {
+		name          string
+		claims        jwtClaims
+		skew          time.Duration
+		requireExpiry bool
+		wantErr       string
+	}{
+		{name: "valid", claims: jwtClaims{Expiry: at(time.Hour), NotBefore: at(-time.Hour), IssuedAt: at(-time.Hour)}, skew: skew},
+		{name: "expired within skew", claims: jwtClaims{Expiry: at(-skew + time.Millisecond)}, skew: skew},
+		{name: "expired at skew", claims: jwtClaims{Expiry: at(-skew)}, skew: skew, wantErr: "token expired"},
+		{name: "expired past skew", claims: jwtClaims{Expiry: at(-2 * skew)}, skew: skew, wantErr: "token expired"},
+		{name: "expires now without skew", claims: jwtClaims{Expiry: at(0)}, wantErr: "token expired"},
+		{name: "expires after now without skew", claims: jwtClaims{Expiry: at(time.Millisecond)}},
+		{name: "fractional exp", claims: jwtClaims{Expiry: at(-skew) + 0.5}, skew: skew},
+		{name: "nbf within skew", claims: jwtClaims{NotBefore: at(skew)}, skew: skew},
+		{name: "nbf past skew", claims: jwtClaims{NotBefore: at(skew + time.Millisecond)}, skew: skew, wantErr: "token not valid yet"},
+		{name: "nbf ahead without skew", claims: jwtClaims{NotBefore: at(time.Millisecond)}, wantErr: "token not valid yet"},
+		{name: "nbf now without skew", claims: jwtClaims{NotBefore: at(0)}},
+		{name: "iat within skew", claims: jwtClaims{IssuedAt: at(skew)}, skew: skew},
+		{name: "iat past skew", claims: jwtClaims{IssuedAt: at(skew + time.Millisecond)}, skew: skew, wantErr: "token issued in the future"},
+		{name: "no exp", claims: jwtClaims{}, skew: skew},
+		{name: "no exp required", claims: jwtClaims{}, skew: skew, requireExpiry: true, wantErr: "token has no expiry"},
+		{name: "exp required and present", claims: jwtClaims{Expiry: at(time.Hour)}, skew: skew, requireExpiry: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkTokenTimes(&tt.claims, now, tt.skew, tt.requireExpiry)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkTokenTimes: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("checkTokenTimes: got %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDCRoleMapping(t *testing.T) {
+	iss := newTestIssuer(t, "k1")
+	p := newTestOIDCProvider(t, iss, config.AuthConfig{
+		OIDCRolesClaim: "realm_access.roles",
+		OIDCRoleMap:    map[string][]string{"ops": {"admin", "user"}, "dev": {"user"}},
+	})
+	withGroups := func(groups ...string) map[string]any {
+		c := oidcClaims(iss, "alice", "")
+		c["realm_access"] = map[string]any{"roles": groups}
+		return c
+	}
+	dev := iss.sign(t, "k1", withGroups("dev"))
+
+	tests := []struct {
+		name      string
+		token     string
+		wantRoles []string
+		wantErr   bool
+	}{
+		{"mapped", iss.sign(t, "k1", withGroups("ops", "dev")), []string{"admin", "user"}, false},
+		{"unmapped group", iss.sign(t, "k1", withGroups("finance")), nil, false},
+		{"forged admin group", forge(t, dev, withGroups("ops")), nil, true},
+		{"unsigned admin group", unsigned(t, withGroups("ops")), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := p.Authenticate(context.Background(), bearerRequest(tt.token))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("token accepted as %+v", principal)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if !slices.Equal(principal.Roles, tt.wantRoles) {
+				t.Errorf("roles = %v, want %v", principal.Roles, tt.wantRoles)
+			}
+		})
+	}
+}
@@ -2,9 +2,12 @@ package auth
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"net/http"
+	"slices"
 
+	"github.com/AdamPippert/Lobstertank/internal/clock"
 	"github.com/AdamPippert/Lobstertank/internal/config"
 	"github.com/AdamPippert/Lobstertank/internal/secrets"
 )
@@ -13,6 +16,16 @@ import (
 type Principal struct {
 	Subject string
 	Roles   []string
+	Org     string // organization the principal is scoped to; empty is unscoped
+
+	// Email and Name describe the principal when the provider knows them.
+	Email string
+	Name  string
+}
+
+// HasRole reports whether the principal holds role.
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
 }
 
 type contextKey string
@@ -38,13 +51,23 @@ type Provider interface {
 }
 
 // NewProvider constructs the appropriate auth provider based on configuration.
-func NewProvider(cfg config.AuthConfig, sp secrets.Provider) (Provider, error) {
+func NewProvider(cfg config.AuthConfig, sp secrets.Provider, clk clock.Clock) (Provider, error) {
 	switch cfg.Provider {
 	case "token":
 		if cfg.TokenSecret == "" {
 			return nil, fmt.Errorf("LT_AUTH_TOKEN_SECRET is required when auth provider is 'token'")
 		}
-		return NewTokenProvider(cfg.TokenSecret), nil
+		return NewTokenProvider(cfg.TokenSecret, cfg.TokenOrg), nil
+	case "hmac":
+		key, err := base64.StdEncoding.DecodeString(cfg.HMACKey)
+		if err != nil {
+			return nil, fmt.Errorf("LT_AUTH_HMAC_KEY must be base64: %w", err)
+		}
+		var fallback Provider
+		if cfg.TokenSecret != "" {
+			fallback = NewTokenProvider(cfg.TokenSecret, cfg.TokenOrg)
+		}
+		return NewHMACTokenProvider(key, clk, fallback)
 	case "oidc":
 		if cfg.OIDCIssuer == "" {
 			return nil, fmt.Errorf("LT_AUTH_OIDC_ISSUER is required when auth provider is 'oidc'")
@@ -52,7 +75,32 @@ func NewProvider(cfg config.AuthConfig, sp secrets.Provider) (Provider, error) {
 		if cfg.OIDCClientID == "" {
 			return nil, fmt.Errorf("LT_AUTH_OIDC_CLIENT_ID is required when auth provider is 'oidc'")
 		}
-		return NewOIDCProvider(context.Background(), cfg.OIDCIssuer, cfg.OIDCClientID, cfg.OIDCAudience)
+		return NewOIDCProvider(context.Background(), cfg, clk)
+	case "cloudflare_access":
+		if cfg.CFAccessTeamDomain == "" {
+			return nil, fmt.Errorf("LT_AUTH_CF_ACCESS_TEAM_DOMAIN is required when auth provider is 'cloudflare_access'")
+		}
+		if cfg.CFAccessAudience == "" {
+			return nil, fmt.Errorf("LT_AUTH_CF_ACCESS_AUD is required when auth provider is 'cloudflare_access'")
+		}
+		return NewCloudflareAccessProvider(cfg, clk)
+	case "mtls":
+		if cfg.MTLSClientCAFile == "" {
+			return nil, fmt.Errorf("LT_AUTH_MTLS_CA_FILE is required when auth provider is 'mtls'")
+		}
+		var fallback Provider
+		if cfg.MTLSFallback != "" {
+			if cfg.MTLSFallback == "mtls" {
+				return nil, fmt.Errorf("LT_AUTH_MTLS_FALLBACK cannot be 'mtls'")
+			}
+			fallbackCfg := cfg
+			fallbackCfg.Provider = cfg.MTLSFallback
+			var err error
+			if fallback, err = NewProvider(fallbackCfg, sp, clk); err != nil {
+				return nil, fmt.Errorf("mtls fallback: %w", err)
+			}
+		}
+		return NewMTLSProvider(cfg.MTLSClientCAFile, cfg.MTLSRoleURIPrefix, cfg.MTLSRequireOrg, fallback)
 	default:
 		return nil, fmt.Errorf("unknown auth provider: %s", cfg.Provider)
 	}
@@ -11,11 +11,13 @@ import (
 // TokenProvider implements bearer-token authentication.
 type TokenProvider struct {
 	secret string
+	org    string
 }
 
-// NewTokenProvider creates a TokenProvider that validates against the given secret.
-func NewTokenProvider(secret string) *TokenProvider {
-	return &TokenProvider{secret: secret}
+// NewTokenProvider creates a TokenProvider that validates against the given
+// secret. Callers holding it are scoped to org, or unscoped if org is empty.
+func NewTokenProvider(secret, org string) *TokenProvider {
+	return &TokenProvider{secret: secret, org: org}
 }
 
 // Authenticate extracts and validates a Bearer token from the Authorization header.
@@ -38,5 +40,6 @@ func (p *TokenProvider) Authenticate(_ context.Context, r *http.Request) (*Princ
 	return &Principal{
 		Subject: "token-user",
 		Roles:   []string{"admin"},
+		Org:     p.org,
 	}, nil
 }
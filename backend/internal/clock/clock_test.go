@@ -0,0 +1,62 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFakeAfterFiresAtDeadline(t *testing.T) {
+	c := NewFake(epoch)
+	ch := c.After(time.Minute)
+
+	c.Advance(time.Minute - time.Nanosecond)
+	select {
+	case <-ch:
+		t.Fatal("fired before the deadline")
+	default:
+	}
+
+	c.Advance(time.Nanosecond)
+	select {
+	case got := <-ch:
+		if want := epoch.Add(time.Minute); !got.Equal(want) {
+			t.Errorf("fired with %v, want %v", got, want)
+		}
+	default:
+		t.Fatal("did not fire at the deadline")
+	}
+}
+
+func TestFakeAfterNonPositiveFiresImmediately(t *testing.T) {
+	c := NewFake(epoch)
+	select {
+	case got := <-c.After(0):
+		if !got.Equal(epoch) {
+			t.Errorf("fired with %v, want %v", got, epoch)
+		}
+	default:
+		t.Fatal("After(0) did not fire immediately")
+	}
+}
+
+func TestFakeAdvanceFiresOnlyDueWaiters(t *testing.T) {
+	c := NewFake(epoch)
+	soon, later := c.After(time.Second), c.After(time.Hour)
+
+	c.Advance(2 * time.Second)
+	select {
+	case <-soon:
+	default:
+		t.Fatal("due waiter did not fire")
+	}
+	select {
+	case <-later:
+		t.Fatal("waiter fired an hour early")
+	default:
+	}
+	if got, want := c.Now(), epoch.Add(2*time.Second); !got.Equal(want) {
+		t.Errorf("Now() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadServerTimeouts(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    ServerConfig // only the timeouts are compared
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			want: ServerConfig{ReadHeaderTimeout: 10 * time.Second, ReadTimeout: 30 * time.Second, WriteTimeout: time.Minute, IdleTimeout: 2 * time.Minute},
+		},
+		{
+			name: "overrides",
+			env: map[string]string{
+				"LT_SERVER_READ_HEADER_TIMEOUT": "2s",
+				"LT_SERVER_READ_TIMEOUT":        "5s",
+				"LT_SERVER_WRITE_TIMEOUT":       "10m",
+				"LT_SERVER_IDLE_TIMEOUT":        "30s",
+			},
+			want: ServerConfig{ReadHeaderTimeout: 2 * time.Second, ReadTimeout: 5 * time.Second, WriteTimeout: 10 * time.Minute, IdleTimeout: 30 * time.Second},
+		},
+		{
+			name: "zero disables",
+			env:  map[string]string{"LT_SERVER_WRITE_TIMEOUT": "0s"},
+			want: ServerConfig{ReadHeaderTimeout: 10 * time.Second, ReadTimeout: 30 * time.Second, IdleTimeout: 2 * time.Minute},
+		},
+		{name: "negative", env: map[string]string{"LT_SERVER_READ_TIMEOUT": "-1s"}, wantErr: "invalid LT_SERVER_READ_TIMEOUT"},
+		{name: "not a duration", env: map[string]string{"LT_SERVER_IDLE_TIMEOUT": "2"}, wantErr: "invalid LT_SERVER_IDLE_TIMEOUT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			cfg, err := LoadFile("")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadFile: got %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadFile: %v", err)
+			}
+			got := cfg.Server
+			if got.ReadHeaderTimeout != tt.want.ReadHeaderTimeout || got.ReadTimeout != tt.want.ReadTimeout ||
+				got.WriteTimeout != tt.want.WriteTimeout || got.IdleTimeout != tt.want.IdleTimeout {
+				t.Errorf("timeouts = %v/%v/%v/%v, want %v/%v/%v/%v",
+					got.ReadHeaderTimeout, got.ReadTimeout, got.WriteTimeout, got.IdleTimeout,
+					tt.want.ReadHeaderTimeout, tt.want.ReadTimeout, tt.want.WriteTimeout, tt.want.IdleTimeout)
+			}
+		})
+	}
+}
+
+func TestLoadRedactPatterns(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          map[string]string
+		want         []string
+		wantDefaults bool
+		wantErr      string
+	}{
+		{name: "none", wantDefaults: true},
+		{
+			name:         "numbered",
+			env:          map[string]string{"LT_AUDIT_REDACT_1": `sk-\w+`, "LT_AUDIT_REDACT_2": `tenant=(\w+)`},
+			want:         []string{`sk-\w+`, `tenant=(\w+)`},
+			wantDefaults: true,
+		},
+		{
+			name:         "stops at a gap",
+			env:          map[string]string{"LT_AUDIT_REDACT_1": `sk-\w+`, "LT_AUDIT_REDACT_3": `tenant=(\w+)`},
+			want:         []string{`sk-\w+`},
+			wantDefaults: true,
+		},
+		{name: "defaults off", env: map[string]string{"LT_AUDIT_REDACT_DEFAULTS": "false"}},
+		{name: "invalid", env: map[string]string{"LT_AUDIT_REDACT_1": "("}, wantErr: "invalid LT_AUDIT_REDACT_1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			cfg, err := LoadFile("")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadFile: got %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadFile: %v", err)
+			}
+			if !slices.Equal(cfg.Audit.RedactPatterns, tt.want) || cfg.Audit.RedactDefaults != tt.wantDefaults {
+				t.Errorf("patterns = %q, defaults %v; want %q, %v", cfg.Audit.RedactPatterns, cfg.Audit.RedactDefaults, tt.want, tt.wantDefaults)
+			}
+		})
+	}
+}
+
+func TestLoadOIDCTimeChecks(t *testing.T) {
+	tests := []struct {
+		name          string
+		env           map[string]string
+		wantSkew      time.Duration
+		requireExpiry bool
+		wantErr       string
+	}{
+		{name: "defaults", wantSkew: time.Minute},
+		{
+			name:          "overrides",
+			env:           map[string]string{"LT_AUTH_OIDC_CLOCK_SKEW": "5s", "LT_AUTH_OIDC_REQUIRE_EXPIRY": "true"},
+			wantSkew:      5 * time.Second,
+			requireExpiry: true,
+		},
+		{name: "no skew", env: map[string]string{"LT_AUTH_OIDC_CLOCK_SKEW": "0s"}},
+		{name: "negative skew", env: map[string]string{"LT_AUTH_OIDC_CLOCK_SKEW": "-1s"}, wantErr: "invalid LT_AUTH_OIDC_CLOCK_SKEW"},
+		{name: "invalid require expiry", env: map[string]string{"LT_AUTH_OIDC_REQUIRE_EXPIRY": "sometimes"}, wantErr: "invalid LT_AUTH_OIDC_REQUIRE_EXPIRY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			cfg, err := LoadFile("")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadFile: got %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadFile: %v", err)
+			}
+			if cfg.Auth.OIDCClockSkew != tt.wantSkew || cfg.Auth.OIDCRequireExpiry != tt.requireExpiry {
+				t.Errorf("skew %v, require expiry %v; want %v, %v",
+					cfg.Auth.OIDCClockSkew, cfg.Auth.OIDCRequireExpiry, tt.wantSkew, tt.requireExpiry)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// readConfigFile reads a YAML config file and flattens it into environment
+// variable names, so a file goes through exactly the parsing and defaults
+// that the environment does. Nested keys join with underscores under the LT_
+// prefix:
+//
+//	server:
+//	  port: 8443          # LT_SERVER_PORT
+//	cors_allowed_origins: # lists become comma-separated values
+//	  - https://a.example.com
+//	webhook:
+//	  1:
+//	    url: https://...  # LT_WEBHOOK_1_URL
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	if len(doc.Content) == 0 {
+		return values, nil // empty file
+	}
+	if err := flattenNode(doc.Content[0], "LT", values); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+func flattenNode(n *yaml.Node, key string, out map[string]string) error {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			name := strings.ToUpper(strings.ReplaceAll(n.Content[i].Value, "-", "_"))
+			if err := flattenNode(n.Content[i+1], key+"_"+name, out); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		items := make([]string, 0, len(n.Content))
+		for _, item := range n.Content {
+			if item.Kind != yaml.ScalarNode {
+				return fmt.Errorf("line %d: %s: lists may only hold plain values", item.Line, key)
+			}
+			items = append(items, item.Value)
+		}
+		out[key] = strings.Join(items, ",")
+	case yaml.ScalarNode:
+		if n.Tag != "!!null" {
+			out[key] = n.Value
+		}
+	case yaml.AliasNode:
+		return flattenNode(n.Alias, key, out)
+	default:
+		return fmt.Errorf("line %d: %s: unsupported value", n.Line, key)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes a YAML config file and returns its path.
+func writeConfigFile(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "lobstertank.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadFilePopulatesNestedConfig(t *testing.T) {
+	path := writeConfigFile(t, `
+server:
+  port: 8443
+  write-timeout: 5m
+cors_allowed_origins:
+  - https://a.example.com
+  - https://b.example.com
+db:
+  driver: postgres
+  dsn: postgres://db.internal/lt
+secrets:
+  provider: vault
+  vault:
+    addr: https://vault.internal
+    token: s.file
+webhook:
+  1:
+    url: https://hooks.example.com/lt
+    selector: [env=prod]
+audit:
+  redact:
+    defaults: null
+`)
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if cfg.Server.Port != 8443 || cfg.Server.WriteTimeout != 5*time.Minute {
+		t.Errorf("server = port %d, write timeout %v; want 8443, 5m", cfg.Server.Port, cfg.Server.WriteTimeout)
+	}
+	if want := []string{"https://a.example.com", "https://b.example.com"}; !slices.Equal(cfg.Server.CORSAllowedOrigins, want) {
+		t.Errorf("CORS origins = %v, want %v", cfg.Server.CORSAllowedOrigins, want)
+	}
+	if cfg.Database.Driver != "postgres" || cfg.Database.DSN != "postgres://db.internal/lt" {
+		t.Errorf("database = %+v, want postgres at db.internal", cfg.Database)
+	}
+	if cfg.Secrets.Provider != "vault" || cfg.Secrets.VaultAddr != "https://vault.internal" || cfg.Secrets.VaultToken != "s.file" {
+		t.Errorf("secrets = %s at %s, want vault at https://vault.internal", cfg.Secrets.Provider, cfg.Secrets.VaultAddr)
+	}
+	if len(cfg.Webhook.Endpoints) != 1 || cfg.Webhook.Endpoints[0].Selector["env"] != "prod" {
+		t.Errorf("webhooks = %+v, want one selecting env=prod", cfg.Webhook.Endpoints)
+	}
+	if !cfg.Audit.RedactDefaults {
+		t.Error("a null value did not leave the default in place")
+	}
+}
+
+func TestLoadFileEnvOverridesFile(t *testing.T) {
+	path := writeConfigFile(t, "server:\n  port: 8443\nlog:\n  level: debug\n")
+	t.Setenv("LT_SERVER_PORT", "9000")
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if cfg.Server.Port != 9000 {
+		t.Errorf("port = %d, want the environment's 9000", cfg.Server.Port)
+	}
+	if cfg.Log.Level != slog.LevelDebug {
+		t.Errorf("log level = %v, want the file's debug", cfg.Log.Level)
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"unknown key", "server:\n  prot: 8443\n", "unknown settings LT_SERVER_PROT"},
+		{"every unknown key", "sever:\n  port: 1\ndb:\n  drvier: mysql\n", "unknown settings LT_DB_DRVIER, LT_SEVER_PORT"},
+		{"nested list", "cors_allowed_origins:\n  - [a, b]\n", "lists may only hold plain values"},
+		{"malformed", "server: [port\n", "parse config file"},
+		{"invalid value", "server:\n  port: https\n", "invalid LT_SERVER_PORT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadFile(writeConfigFile(t, tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadFile: got %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := LoadFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("LoadFile read a missing file")
+	}
+}
+
+func TestLoadFileEmpty(t *testing.T) {
+	fromFile, err := LoadFile(writeConfigFile(t, ""))
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	fromEnv, err := LoadFile("")
+	if err != nil {
+		t.Fatalf("LoadFile without a file: %v", err)
+	}
+	if fromFile.Server.Port != fromEnv.Server.Port || fromFile.Database != fromEnv.Database {
+		t.Errorf("an empty file changed the defaults: %+v, want %+v", fromFile.Server, fromEnv.Server)
+	}
+}
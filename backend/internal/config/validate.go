@@ -0,0 +1,160 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Validate checks that settings which only make sense together are all
+// present, so a misconfiguration fails at startup rather than on first use.
+// Every problem found is reported, joined into one error.
+func (c *Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		add("LT_SERVER_PORT must be between 1 and 65535, got %d", c.Server.Port)
+	}
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		add("LT_SERVER_TLS_CERT and LT_SERVER_TLS_KEY must be set together")
+	}
+	if c.Server.MaxBodyBytes < 1 {
+		add("LT_SERVER_MAX_BODY_BYTES must be positive, got %d", c.Server.MaxBodyBytes)
+	}
+	if c.Server.MaxHeaderBytes < 1 {
+		add("LT_SERVER_MAX_HEADER_BYTES must be positive, got %d", c.Server.MaxHeaderBytes)
+	}
+
+	switch c.Database.Driver {
+	case "sqlite", "postgres", "mysql":
+		if c.Database.DSN == "" {
+			add("LT_DB_DSN is required when LT_DB_DRIVER is %q", c.Database.Driver)
+		}
+	default:
+		add("LT_DB_DRIVER must be sqlite, postgres, or mysql, got %q", c.Database.Driver)
+	}
+
+	// checkAuth checks the settings provider needs, where setting names
+	// the variable that selected it.
+	var checkAuth func(setting, provider string)
+	checkAuth = func(setting, provider string) {
+		switch provider {
+		case "token":
+			if c.Auth.TokenSecret == "" {
+				add("LT_AUTH_TOKEN_SECRET is required when %s is %q", setting, provider)
+			}
+		case "oidc":
+			if c.Auth.OIDCIssuer == "" {
+				add("LT_AUTH_OIDC_ISSUER is required when %s is %q", setting, provider)
+			} else if u, err := url.Parse(c.Auth.OIDCIssuer); err != nil || u.Scheme == "" || u.Host == "" {
+				add("LT_AUTH_OIDC_ISSUER must be an absolute URL, got %q", c.Auth.OIDCIssuer)
+			}
+			if c.Auth.OIDCClientID == "" {
+				add("LT_AUTH_OIDC_CLIENT_ID is required when %s is %q", setting, provider)
+			}
+		case "hmac":
+			if c.Auth.HMACKey == "" {
+				add("LT_AUTH_HMAC_KEY is required when %s is %q", setting, provider)
+			} else if key, err := base64.StdEncoding.DecodeString(c.Auth.HMACKey); err != nil || len(key) < 32 {
+				add("LT_AUTH_HMAC_KEY must be at least 32 bytes, base64-encoded")
+			}
+		case "cloudflare_access":
+			if c.Auth.CFAccessTeamDomain == "" {
+				add("LT_AUTH_CF_ACCESS_TEAM_DOMAIN is required when %s is %q", setting, provider)
+			}
+			if c.Auth.CFAccessAudience == "" {
+				add("LT_AUTH_CF_ACCESS_AUD is required when %s is %q", setting, provider)
+			}
+		case "mtls":
+			if setting != "LT_AUTH_PROVIDER" {
+				add("%s cannot be %q", setting, provider)
+				return
+			}
+			if c.Auth.MTLSClientCAFile == "" {
+				add("LT_AUTH_MTLS_CA_FILE is required when %s is %q", setting, provider)
+			}
+			if c.Server.TLSCertFile == "" {
+				add("LT_SERVER_TLS_CERT and LT_SERVER_TLS_KEY are required when %s is %q", setting, provider)
+			}
+			if c.Auth.MTLSFallback != "" {
+				checkAuth("LT_AUTH_MTLS_FALLBACK", c.Auth.MTLSFallback)
+			}
+		default:
+			add("%s must be token, hmac, oidc, cloudflare_access, or mtls, got %q", setting, provider)
+		}
+	}
+	checkAuth("LT_AUTH_PROVIDER", c.Auth.Provider)
+
+	switch c.Secrets.Provider {
+	case "builtin":
+		// Builtin secrets are kept in the database, which without a key
+		// would hold gateway tokens in plaintext. In-memory SQLite keeps
+		// nothing.
+		persistent := c.Database.Driver != "sqlite" || c.Database.DSN != ":memory:"
+		if c.Secrets.EncryptionKey == "" && persistent && !c.Secrets.AllowPlaintext {
+			add("LT_SECRETS_ENCRYPTION_KEY is required when LT_SECRETS_PROVIDER is \"builtin\"; set LT_SECRETS_ALLOW_PLAINTEXT=true to store secrets unencrypted for development")
+		}
+		if c.Secrets.EncryptionKey != "" {
+			key, err := base64.StdEncoding.DecodeString(c.Secrets.EncryptionKey)
+			switch {
+			case err != nil:
+				add("LT_SECRETS_ENCRYPTION_KEY must be base64: %w", err)
+			case len(key) != 32:
+				add("LT_SECRETS_ENCRYPTION_KEY must decode to 32 bytes, got %d", len(key))
+			}
+		}
+	case "vault":
+		if c.Secrets.VaultAddr == "" {
+			add("LT_SECRETS_VAULT_ADDR is required when LT_SECRETS_PROVIDER is \"vault\"")
+		}
+		if c.Secrets.VaultToken == "" {
+			add("LT_SECRETS_VAULT_TOKEN is required when LT_SECRETS_PROVIDER is \"vault\"")
+		}
+	default:
+		add("LT_SECRETS_PROVIDER must be builtin or vault, got %q", c.Secrets.Provider)
+	}
+
+	if !slices.Contains([]string{"https", "tailscale", "headscale", "cloudflare"}, c.Transport.Default) {
+		add("LT_TRANSPORT_DEFAULT must be https, tailscale, headscale, or cloudflare, got %q", c.Transport.Default)
+	}
+
+	if c.Audit.Enabled {
+		switch c.Audit.Output {
+		case "stdout":
+		case "file":
+			if c.Audit.Path == "" {
+				add("LT_AUDIT_PATH is required when LT_AUDIT_OUTPUT is \"file\"")
+			}
+		default:
+			add("LT_AUDIT_OUTPUT must be stdout or file, got %q", c.Audit.Output)
+		}
+	}
+	if c.Audit.Retention < 0 {
+		add("LT_AUDIT_RETENTION_DAYS must not be negative")
+	}
+
+	for _, route := range slices.Sorted(maps.Keys(c.RateLimit.Routes)) {
+		if !slices.Contains(RateLimitRoutes, route) {
+			add("LT_RATELIMIT_ROUTES names unknown route %q; must be one of %s", route, strings.Join(RateLimitRoutes, ", "))
+		}
+	}
+
+	if c.Monitor.Enabled && c.Monitor.Interval <= 0 {
+		add("LT_MONITOR_INTERVAL must be positive when the monitor is enabled")
+	}
+
+	for _, ep := range c.Webhook.Endpoints {
+		if u, err := url.Parse(ep.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("webhook %s: URL must be an absolute http or https URL", ep.Name)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+// loadEnv loads a configuration from the environment variables env on top
+// of the defaults.
+func loadEnv(t *testing.T, env map[string]string) *Config {
+	t.Helper()
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+	cfg, err := LoadFile("")
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	return cfg
+}
+
+// testEncryptionKey is a valid LT_SECRETS_ENCRYPTION_KEY.
+const testEncryptionKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+
+func TestValidateBuiltinSecretsNeedKey(t *testing.T) {
+	const errKey = "LT_SECRETS_ENCRYPTION_KEY is required"
+	for _, tt := range []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{"no key", map[string]string{}, true},
+		{"postgres without key", map[string]string{"LT_DB_DRIVER": "postgres", "LT_DB_DSN": "postgres://localhost/lt"}, true},
+		{"key", map[string]string{"LT_SECRETS_ENCRYPTION_KEY": testEncryptionKey}, false},
+		{"plaintext allowed", map[string]string{"LT_SECRETS_ALLOW_PLAINTEXT": "true"}, false},
+		{"in-memory database", map[string]string{"LT_DB_DSN": ":memory:"}, false},
+		{"vault", map[string]string{"LT_SECRETS_PROVIDER": "vault", "LT_SECRETS_VAULT_ADDR": "https://vault", "LT_SECRETS_VAULT_TOKEN": "s.x"}, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"LT_AUTH_TOKEN_SECRET": "secret"}
+			for k, v := range tt.env {
+				env[k] = v
+			}
+			err := loadEnv(t, env).Validate()
+			if got := err != nil && strings.Contains(err.Error(), errKey); got != tt.wantErr {
+				t.Errorf("Validate() = %v; want the missing key reported: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := map[string]string{
+		"LT_AUTH_TOKEN_SECRET":      "secret",
+		"LT_SECRETS_ENCRYPTION_KEY": testEncryptionKey,
+	}
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr []string // every message expected in the joined error
+	}{
+		{name: "valid"},
+		{name: "valid postgres and oidc", env: map[string]string{
+			"LT_DB_DRIVER":           "postgres",
+			"LT_DB_DSN":              "postgres://localhost/lt",
+			"LT_AUTH_PROVIDER":       "oidc",
+			"LT_AUTH_OIDC_ISSUER":    "https://id.example.com",
+			"LT_AUTH_OIDC_CLIENT_ID": "lobstertank",
+		}},
+		{name: "postgres without dsn", env: map[string]string{"LT_DB_DRIVER": "postgres", "LT_DB_DSN": ""},
+			wantErr: []string{`LT_DB_DSN is required when LT_DB_DRIVER is "postgres"`}},
+		{name: "unknown driver", env: map[string]string{"LT_DB_DRIVER": "oracle"},
+			wantErr: []string{"LT_DB_DRIVER must be sqlite, postgres, or mysql"}},
+		{name: "oidc without issuer", env: map[string]string{"LT_AUTH_PROVIDER": "oidc", "LT_AUTH_OIDC_CLIENT_ID": "lobstertank"},
+			wantErr: []string{`LT_AUTH_OIDC_ISSUER is required when LT_AUTH_PROVIDER is "oidc"`}},
+		{name: "oidc relative issuer", env: map[string]string{"LT_AUTH_PROVIDER": "oidc", "LT_AUTH_OIDC_ISSUER": "id.example.com", "LT_AUTH_OIDC_CLIENT_ID": "lobstertank"},
+			wantErr: []string{"LT_AUTH_OIDC_ISSUER must be an absolute URL"}},
+		{name: "vault without addr or token", env: map[string]string{"LT_SECRETS_PROVIDER": "vault"},
+			wantErr: []string{"LT_SECRETS_VAULT_ADDR is required", "LT_SECRETS_VAULT_TOKEN is required"}},
+		{name: "short encryption key", env: map[string]string{"LT_SECRETS_ENCRYPTION_KEY": "c2hvcnQ="},
+			wantErr: []string{"LT_SECRETS_ENCRYPTION_KEY must decode to 32 bytes, got 5"}},
+		{name: "mtls fallback cannot be mtls", env: map[string]string{
+			"LT_AUTH_PROVIDER":      "mtls",
+			"LT_AUTH_MTLS_CA_FILE":  "/etc/lt/ca.pem",
+			"LT_AUTH_MTLS_FALLBACK": "mtls",
+			"LT_SERVER_TLS_CERT":    "/etc/lt/tls.crt",
+			"LT_SERVER_TLS_KEY":     "/etc/lt/tls.key",
+		}, wantErr: []string{`LT_AUTH_MTLS_FALLBACK cannot be "mtls"`}},
+		{name: "audit file without path", env: map[string]string{"LT_AUDIT_OUTPUT": "file"},
+			wantErr: []string{`LT_AUDIT_PATH is required when LT_AUDIT_OUTPUT is "file"`}},
+		{name: "every problem reported", env: map[string]string{
+			"LT_DB_DRIVER":         "postgres",
+			"LT_DB_DSN":            "",
+			"LT_SECRETS_PROVIDER":  "vault",
+			"LT_TRANSPORT_DEFAULT": "carrier-pigeon",
+		}, wantErr: []string{"LT_DB_DSN is required", "LT_SECRETS_VAULT_ADDR is required", "LT_TRANSPORT_DEFAULT must be"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := maps.Clone(valid)
+			maps.Copy(env, tt.env)
+			err := loadEnv(t, env).Validate()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, want %q", tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() = %v, want it to report %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/auth"
+	"github.com/AdamPippert/Lobstertank/internal/httputil"
+	"github.com/AdamPippert/Lobstertank/internal/logging"
+)
+
+// keepAliveInterval spaces comment lines sent on an idle stream so proxies
+// do not time it out.
+const keepAliveInterval = 15 * time.Second
+
+// Handler exposes the event stream over HTTP.
+type Handler struct {
+	hub *Hub
+}
+
+// NewHandler creates a new event stream HTTP handler.
+func NewHandler(h *Hub) *Handler {
+	return &Handler{hub: h}
+}
+
+// Stream handles GET /api/v1/events as a Server-Sent Events stream of the
+// events about gateways the caller's organization owns. A Last-Event-ID
+// header resumes after that event when it is still buffered.
+func (h *Handler) Stream(w http.ResponseWriter, r *http.Request) {
+	var lastID uint64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			httputil.WriteError(w, r, http.StatusBadRequest, "invalid Last-Event-ID", nil)
+			return
+		}
+		lastID = id
+	}
+
+	rc := http.NewResponseController(w)
+	// The stream outlives the server's write timeout by design.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		logging.LoggerFromContext(r.Context()).Debug("cannot clear write deadline for event stream", "error", err)
+	}
+
+	var org string
+	if p, ok := auth.PrincipalFromContext(r.Context()); ok {
+		org = p.Org
+	}
+	sub := h.hub.Subscribe(lastID, org)
+	defer h.hub.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		logging.LoggerFromContext(r.Context()).Error("event stream does not support flushing", "error", err)
+		return
+	}
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case evt, ok := <-sub.C:
+			if !ok {
+				if sub.Evicted() {
+					// Tell the client to reconnect; Last-Event-ID resumes it.
+					_, _ = fmt.Fprint(w, "event: evicted\ndata: {}\n\n")
+					_ = rc.Flush()
+				}
+				return
+			}
+			data, err := json.Marshal(evt)
+			if err != nil {
+				logging.LoggerFromContext(r.Context()).Error("failed to encode event", "error", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", evt.ID, evt.Type, data); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Package events fans gateway lifecycle events out to live subscribers.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Event types published by the gateway registry.
+const (
+	GatewayCreated       = "gateway.created"
+	GatewayUpdated       = "gateway.updated"
+	GatewayDeleted       = "gateway.deleted"
+	GatewayRestored      = "gateway.restored"
+	GatewayStatusChanged = "gateway.status_changed"
+	GatewayHealthChecked = "gateway.health_checked"
+)
+
+const (
+	// subscriberBuffer is how many events a subscriber may fall behind by
+	// before it is evicted.
+	subscriberBuffer = 64
+
+	// historySize is how many recent events are kept for Last-Event-ID
+	// resume.
+	historySize = 256
+)
+
+// Event is one published occurrence. IDs increase monotonically for the
+// lifetime of the process.
+type Event struct {
+	ID        uint64          `json:"id"`
+	Type      string          `json:"type"`
+	GatewayID string          `json:"gateway_id"`
+	OrgID     string          `json:"org_id,omitempty"` // the gateway's organization
+	Time      time.Time       `json:"time"`
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+// Hub distributes events to subscribers. Each subscriber has a buffered
+// channel; a subscriber whose buffer is full is evicted rather than allowed
+// to block publishers. A nil *Hub discards everything published to it.
+type Hub struct {
+	mu      sync.Mutex
+	nextID  uint64
+	subs    map[*Subscription]struct{}
+	history []Event // ring of the most recent events, oldest first
+	closed  bool
+}
+
+// Subscription receives events on C until it is closed by Unsubscribe,
+// eviction, or hub shutdown.
+type Subscription struct {
+	C <-chan Event
+
+	ch      chan Event
+	org     string // only events about this organization's gateways; empty for all
+	evicted bool
+}
+
+// sees reports whether evt is delivered to s.
+func (s *Subscription) sees(evt Event) bool {
+	return s.org == "" || evt.OrgID == s.org
+}
+
+// Evicted reports whether the subscription was dropped for falling behind.
+// It is only meaningful once C has been closed.
+func (s *Subscription) Evicted() bool {
+	return s.evicted
+}
+
+// NewHub creates an empty hub. Call Run to tie its lifetime to a context.
+func NewHub() *Hub {
+	return &Hub{subs: make(map[*Subscription]struct{})}
+}
+
+// Publish marshals data and sends the event about a gateway in organization
+// orgID to every subscriber that may see it.
+func (h *Hub) Publish(typ, gatewayID, orgID string, data any) {
+	if h == nil {
+		return
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		slog.Error("failed to marshal event", "type", typ, "error", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+
+	h.nextID++
+	evt := Event{ID: h.nextID, Type: typ, GatewayID: gatewayID, OrgID: orgID, Time: time.Now().UTC(), Data: raw}
+
+	if len(h.history) == historySize {
+		h.history = append(h.history[:0], h.history[1:]...)
+	}
+	h.history = append(h.history, evt)
+
+	for sub := range h.subs {
+		if !sub.sees(evt) {
+			continue
+		}
+		select {
+		case sub.ch <- evt:
+		default:
+			sub.evicted = true
+			h.remove(sub)
+			slog.Warn("evicted slow event subscriber", "last_event_id", evt.ID)
+		}
+	}
+}
+
+// Subscribe registers a new subscriber to the events about gateways in
+// organization org, or about every gateway when org is empty. Events after
+// lastID that are still in the hub's history are delivered first; a lastID
+// of zero, or one from before a restart, replays nothing.
+func (h *Hub) Subscribe(lastID uint64, org string) *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub := &Subscription{org: org}
+	var replay []Event
+	if lastID > 0 && lastID < h.nextID {
+		for _, evt := range h.history {
+			if evt.ID > lastID && sub.sees(evt) {
+				replay = append(replay, evt)
+			}
+		}
+	}
+
+	ch := make(chan Event, subscriberBuffer+len(replay))
+	sub.C, sub.ch = ch, ch
+	if h.closed {
+		close(ch)
+		return sub
+	}
+	for _, evt := range replay {
+		ch <- evt
+	}
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe stops delivery to sub and closes its channel. It is safe to
+// call more than once.
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(sub)
+}
+
+// remove must be called with h.mu held.
+func (h *Hub) remove(sub *Subscription) {
+	if _, ok := h.subs[sub]; !ok {
+		return
+	}
+	delete(h.subs, sub)
+	close(sub.ch)
+}
+
+// Run blocks until ctx is canceled, then closes every subscription so
+// streaming handlers return and the server can shut down.
+func (h *Hub) Run(ctx context.Context) {
+	<-ctx.Done()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for sub := range h.subs {
+		h.remove(sub)
+	}
+}
@@ -0,0 +1,218 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/auth"
+)
+
+// drain returns the IDs of the gateways whose events are waiting on sub.
+func drain(sub *Subscription) []string {
+	var ids []string
+	for {
+		select {
+		case evt := <-sub.C:
+			ids = append(ids, evt.GatewayID)
+		default:
+			return ids
+		}
+	}
+}
+
+// drainIDs returns the IDs of the events waiting on sub.
+func drainIDs(sub *Subscription) []uint64 {
+	var ids []uint64
+	for {
+		select {
+		case evt, ok := <-sub.C:
+			if !ok {
+				return ids
+			}
+			ids = append(ids, evt.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+// closed reports whether sub's channel has been closed, once any waiting
+// events are read.
+func closed(sub *Subscription) bool {
+	for {
+		select {
+		case _, ok := <-sub.C:
+			if !ok {
+				return true
+			}
+		default:
+			return false
+		}
+	}
+}
+
+func TestHubResume(t *testing.T) {
+	h := NewHub()
+	// Events 1 to historySize+10; the first ten have left the history.
+	for i := range historySize + 10 {
+		org := "acme"
+		if i%2 == 1 {
+			org = "initech"
+		}
+		h.Publish(GatewayUpdated, fmt.Sprintf("gw-%d", i), org, nil)
+	}
+	last := uint64(historySize + 10)
+	var kept []uint64
+	for id := uint64(11); id <= last; id++ {
+		kept = append(kept, id)
+	}
+
+	tests := []struct {
+		name   string
+		lastID uint64
+		org    string
+		want   []uint64
+	}{
+		{"fresh", 0, "", nil},
+		{"caught up", last, "", nil},
+		{"from before a restart", last + 5, "", nil},
+		{"recent", last - 3, "", []uint64{last - 2, last - 1, last}},
+		{"recent in org", last - 3, "initech", []uint64{last - 2, last}},
+		{"older than history", 5, "", kept},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := h.Subscribe(tt.lastID, tt.org)
+			defer h.Unsubscribe(sub)
+			if got := drainIDs(sub); !slices.Equal(got, tt.want) {
+				t.Errorf("replayed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHubEvictsFullSubscriber(t *testing.T) {
+	h := NewHub()
+	slow := h.Subscribe(0, "")
+	other := h.Subscribe(0, "initech")
+	for i := range subscriberBuffer {
+		h.Publish(GatewayUpdated, fmt.Sprintf("gw-%d", i), "acme", nil)
+	}
+	if closed(other) || other.Evicted() {
+		t.Fatal("subscriber to another organization was affected by events it does not see")
+	}
+	if slow.Evicted() {
+		t.Fatal("subscriber evicted with room left in its buffer")
+	}
+
+	h.Publish(GatewayUpdated, "gw-overflow", "acme", nil)
+	if got := drainIDs(slow); len(got) != subscriberBuffer {
+		t.Errorf("evicted subscriber got %d events, want the %d buffered", len(got), subscriberBuffer)
+	}
+	if !closed(slow) || !slow.Evicted() {
+		t.Error("full subscriber not evicted")
+	}
+
+	// Publishing goes on for the rest, and Unsubscribe after eviction is
+	// harmless.
+	h.Unsubscribe(slow)
+	h.Publish(GatewayUpdated, "gw-next", "initech", nil)
+	if got := drain(other); !slices.Equal(got, []string{"gw-next"}) {
+		t.Errorf("remaining subscriber got %v, want gw-next", got)
+	}
+}
+
+func TestHubRunClosesOnCancel(t *testing.T) {
+	h := NewHub()
+	sub := h.Subscribe(0, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		h.Run(ctx)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after its context was canceled")
+	}
+	if !closed(sub) || sub.Evicted() {
+		t.Error("subscription not closed by shutdown, or reported evicted")
+	}
+
+	h.Publish(GatewayCreated, "gw-late", "", nil)
+	late := h.Subscribe(1, "")
+	if got := drainIDs(late); len(got) != 0 || !closed(late) {
+		t.Errorf("subscription after shutdown got %v, want a closed channel", got)
+	}
+}
+
+func TestHubDeliversOnlyVisibleEvents(t *testing.T) {
+	h := NewHub()
+	acme := h.Subscribe(0, "acme")
+	all := h.Subscribe(0, "")
+
+	h.Publish(GatewayCreated, "gw-acme", "acme", nil)
+	h.Publish(GatewayCreated, "gw-initech", "initech", nil)
+	h.Publish(GatewayCreated, "gw-unscoped", "", nil)
+
+	if got := strings.Join(drain(acme), ","); got != "gw-acme" {
+		t.Errorf("acme subscriber got %q, want gw-acme", got)
+	}
+	if got := strings.Join(drain(all), ","); got != "gw-acme,gw-initech,gw-unscoped" {
+		t.Errorf("unscoped subscriber got %q, want every event", got)
+	}
+
+	// Resuming replays only the organization's events.
+	resumed := h.Subscribe(1, "initech")
+	if got := strings.Join(drain(resumed), ","); got != "gw-initech" {
+		t.Errorf("resumed initech subscriber got %q, want gw-initech", got)
+	}
+}
+
+func TestStreamScopesToCallerOrg(t *testing.T) {
+	h := NewHub()
+	stream := NewHandler(h)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := &auth.Principal{Subject: "alice", Roles: []string{"viewer"}, Org: "acme"}
+		stream.Stream(w, r.WithContext(auth.ContextWithPrincipal(r.Context(), p)))
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// The stream is subscribed once its headers are sent.
+	h.Publish(GatewayCreated, "gw-initech", "initech", nil)
+	h.Publish(GatewayCreated, "gw-acme", "acme", nil)
+
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		data, ok := strings.CutPrefix(sc.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var evt Event
+		if err := json.Unmarshal([]byte(data), &evt); err != nil {
+			t.Fatalf("decode event %q: %v", data, err)
+		}
+		if evt.GatewayID != "gw-acme" || evt.OrgID != "acme" {
+			t.Errorf("first event = %+v, want gw-acme in acme", evt)
+		}
+		return
+	}
+	t.Fatalf("stream ended without an event: %v", sc.Err())
+}
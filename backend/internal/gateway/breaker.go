@@ -0,0 +1,190 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// ErrCircuitOpen matches any *CircuitOpenError via errors.Is.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitOpenError is returned without contacting a gateway whose breaker is
+// open. RetryAfter is how long until a probe request will be let through.
+type CircuitOpenError struct {
+	GatewayID  string
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker open for gateway %s, retry in %s", e.GatewayID, e.RetryAfter.Round(time.Second))
+}
+
+// Is reports whether target is ErrCircuitOpen.
+func (e *CircuitOpenError) Is(target error) bool { return target == ErrCircuitOpen }
+
+// Transport params that override the default breaker settings for one gateway.
+const (
+	paramCircuitThreshold = "circuit_threshold"
+	paramCircuitCooldown  = "circuit_cooldown"
+)
+
+// Breaker states as reported by model.CircuitState.
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half_open"
+	circuitDisabled = "disabled"
+)
+
+// breaker is a consecutive-failure circuit breaker for one gateway. After
+// threshold failures in a row it opens and rejects calls until cooldown has
+// elapsed, then half-opens and admits a single probe whose outcome decides
+// whether to close again or re-open.
+type breaker struct {
+	clock     clock.Clock
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// breakerSettings returns the default settings with any per-gateway
+// overrides from params applied. A threshold of zero disables the breaker.
+func breakerSettings(defaults config.BreakerConfig, params map[string]string) (threshold int, cooldown time.Duration) {
+	threshold, cooldown = defaults.Threshold, defaults.Cooldown
+	if n, err := strconv.Atoi(params[paramCircuitThreshold]); err == nil && n >= 0 {
+		threshold = n
+	}
+	if d, err := time.ParseDuration(params[paramCircuitCooldown]); err == nil && d > 0 {
+		cooldown = d
+	}
+	return threshold, cooldown
+}
+
+// validateBreakerParams checks the per-gateway breaker overrides, if present.
+func validateBreakerParams(params map[string]string, verr *ValidationError) {
+	if v, ok := params[paramCircuitThreshold]; ok {
+		if n, err := strconv.Atoi(v); err != nil || n < 0 {
+			verr.add("transport.params."+paramCircuitThreshold, "must be a non-negative integer")
+		}
+	}
+	if v, ok := params[paramCircuitCooldown]; ok {
+		if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+			verr.add("transport.params."+paramCircuitCooldown, "must be a positive duration such as 30s")
+		}
+	}
+}
+
+func newBreaker(clk clock.Clock, threshold int, cooldown time.Duration) *breaker {
+	return &breaker{clock: clk, threshold: threshold, cooldown: cooldown, state: circuitClosed}
+}
+
+// allow reports whether a call may proceed. When the breaker is open it
+// returns how long until the next probe will be admitted.
+func (b *breaker) allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if wait := b.openedAt.Add(b.cooldown).Sub(b.clock.Now()); wait > 0 {
+			return false, wait
+		}
+		b.state = circuitHalfOpen
+		b.probing = true
+		return true, 0
+	case circuitHalfOpen:
+		if b.probing {
+			return false, b.cooldown
+		}
+		b.probing = true
+		return true, 0
+	default:
+		return true, 0
+	}
+}
+
+// record updates the breaker with the outcome of an admitted call. A call
+// abandoned by its caller says nothing about the gateway and only releases
+// the half-open probe slot.
+func (b *breaker) record(err error, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	if !failed {
+		b.state = circuitClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		b.state = circuitOpen
+		b.openedAt = b.clock.Now()
+	}
+}
+
+// snapshot reports the breaker's current state.
+func (b *breaker) snapshot(gatewayID string) model.CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cs := model.CircuitState{
+		GatewayID:           gatewayID,
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		Threshold:           b.threshold,
+		Cooldown:            b.cooldown.String(),
+	}
+	if b.state != circuitClosed {
+		openedAt := b.openedAt.UTC()
+		retryAt := openedAt.Add(b.cooldown)
+		cs.OpenedAt = &openedAt
+		cs.RetryAt = &retryAt
+	}
+	return cs
+}
+
+// breakerFor returns the breaker for gw, creating it on first use. It
+// returns nil when breaking is disabled for the gateway.
+func (f *ClientFactory) breakerFor(gw *model.Gateway) *breaker {
+	threshold, cooldown := breakerSettings(f.breakerDefaults, gw.Transport.Params)
+	if threshold == 0 || gw.ID == "" {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b, ok := f.breakers[gw.ID]
+	if !ok {
+		b = newBreaker(f.clock, threshold, cooldown)
+		f.breakers[gw.ID] = b
+	}
+	return b
+}
+
+// Circuit reports the state of gw's circuit breaker.
+func (f *ClientFactory) Circuit(gw *model.Gateway) model.CircuitState {
+	b := f.breakerFor(gw)
+	if b == nil {
+		return model.CircuitState{GatewayID: gw.ID, State: circuitDisabled}
+	}
+	return b.snapshot(gw.ID)
+}
@@ -0,0 +1,170 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/secrets"
+	"github.com/AdamPippert/Lobstertank/internal/transport"
+)
+
+// newBreakerClient returns a client for a gateway served at endpoint, with a
+// breaker that opens after threshold failures and cools down for cooldown.
+func newBreakerClient(t *testing.T, clk clock.Clock, endpoint string, threshold int, cooldown time.Duration) *Client {
+	t.Helper()
+	sp, err := secrets.NewBuiltinProvider("")
+	if err != nil {
+		t.Fatalf("NewBuiltinProvider: %v", err)
+	}
+	cf := NewClientFactory(transport.NewProvider(config.TransportConfig{Default: "https"}), sp,
+		config.RetryConfig{}, config.BreakerConfig{Threshold: threshold, Cooldown: cooldown}, clk)
+	return cf.ClientFor(&model.Gateway{
+		ID:        "gw-1",
+		Name:      "alpha",
+		Endpoint:  endpoint,
+		Transport: model.TransportConfig{Type: "https"},
+	})
+}
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	clk := clock.NewFake(testEpoch)
+	var hits atomic.Int32
+	var healthy atomic.Bool
+	c := newBreakerClient(t, clk, fakeGateway(t, func(w http.ResponseWriter, _ *http.Request) {
+		hits.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}), 3, 30*time.Second)
+	ctx := context.Background()
+
+	for i := range 3 {
+		res, err := c.HealthCheck(ctx)
+		if err != nil || res.Status != model.StatusDegraded {
+			t.Fatalf("check %d = %+v, %v; want degraded", i, res, err)
+		}
+	}
+	if got := c.breaker.snapshot("gw-1"); got.State != circuitOpen || got.ConsecutiveFailures != 3 {
+		t.Fatalf("after 3 failures: %+v, want open", got)
+	}
+
+	// An open breaker fails fast without contacting the gateway.
+	res, err := c.HealthCheck(ctx)
+	var open *CircuitOpenError
+	if !errors.As(err, &open) || !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("check while open: got %v, want a *CircuitOpenError", err)
+	}
+	if open.RetryAfter != 30*time.Second {
+		t.Errorf("RetryAfter = %v, want the full 30s cooldown", open.RetryAfter)
+	}
+	if res.ErrorKind != model.ErrorKindCircuitOpen {
+		t.Errorf("ErrorKind = %s, want %s", res.ErrorKind, model.ErrorKindCircuitOpen)
+	}
+	if n := hits.Load(); n != 3 {
+		t.Errorf("gateway saw %d requests, want 3", n)
+	}
+
+	clk.Advance(29 * time.Second)
+	if _, err := c.HealthCheck(ctx); !errors.As(err, &open) || open.RetryAfter != time.Second {
+		t.Fatalf("check a second before the cooldown ends: got %v, want open with 1s left", err)
+	}
+
+	// Once the cooldown is over, one probe is let through; its success
+	// closes the breaker.
+	clk.Advance(time.Second)
+	healthy.Store(true)
+	if res, err := c.HealthCheck(ctx); err != nil || res.Status != model.StatusOnline {
+		t.Fatalf("probe after cooldown = %+v, %v; want online", res, err)
+	}
+	if got := c.breaker.snapshot("gw-1"); got.State != circuitClosed || got.ConsecutiveFailures != 0 || got.OpenedAt != nil {
+		t.Errorf("after a successful probe: %+v, want closed", got)
+	}
+	if n := hits.Load(); n != 4 {
+		t.Errorf("gateway saw %d requests, want 4", n)
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	clk := clock.NewFake(testEpoch)
+	b := newBreaker(clk, 2, time.Minute)
+	errDown := errors.New("connection refused")
+	b.record(errDown, true)
+	b.record(errDown, true)
+	if ok, wait := b.allow(); ok || wait != time.Minute {
+		t.Fatalf("allow when just opened = %v, %v; want false, 1m", ok, wait)
+	}
+
+	clk.Advance(time.Minute)
+	if ok, _ := b.allow(); !ok {
+		t.Fatal("allow after cooldown = false, want a probe let through")
+	}
+	if got := b.snapshot("gw-1").State; got != circuitHalfOpen {
+		t.Errorf("state while probing = %s, want %s", got, circuitHalfOpen)
+	}
+	if ok, _ := b.allow(); ok {
+		t.Error("allow while a probe is in flight = true, want only one probe")
+	}
+
+	// A probe abandoned by its caller frees the slot without a verdict.
+	b.record(context.Canceled, true)
+	if got := b.snapshot("gw-1").State; got != circuitHalfOpen {
+		t.Errorf("state after a canceled probe = %s, want %s", got, circuitHalfOpen)
+	}
+	if ok, _ := b.allow(); !ok {
+		t.Fatal("allow after a canceled probe = false, want another probe")
+	}
+
+	// A failed probe re-opens the breaker for another full cooldown.
+	clk.Advance(10 * time.Second)
+	b.record(errDown, true)
+	got := b.snapshot("gw-1")
+	if got.State != circuitOpen || got.OpenedAt == nil || !got.OpenedAt.Equal(clk.Now()) {
+		t.Errorf("after a failed probe: %+v, want open since now", got)
+	}
+	if ok, wait := b.allow(); ok || wait != time.Minute {
+		t.Errorf("allow after a failed probe = %v, %v; want false, 1m", ok, wait)
+	}
+}
+
+func TestBreakerSuccessResetsFailures(t *testing.T) {
+	b := newBreaker(clock.NewFake(testEpoch), 3, time.Minute)
+	errDown := errors.New("connection refused")
+	b.record(errDown, true)
+	b.record(errDown, true)
+	b.record(nil, false)
+	b.record(errDown, true)
+	b.record(errDown, true)
+	if got := b.snapshot("gw-1"); got.State != circuitClosed || got.ConsecutiveFailures != 2 {
+		t.Errorf("got %+v, want closed with 2 failures; only consecutive failures count", got)
+	}
+}
+
+func TestBreakerSettings(t *testing.T) {
+	defaults := config.BreakerConfig{Threshold: 5, Cooldown: 30 * time.Second}
+	tests := []struct {
+		name          string
+		params        map[string]string
+		wantThreshold int
+		wantCooldown  time.Duration
+	}{
+		{"defaults", nil, 5, 30 * time.Second},
+		{"overrides", map[string]string{paramCircuitThreshold: "2", paramCircuitCooldown: "1m"}, 2, time.Minute},
+		{"disabled", map[string]string{paramCircuitThreshold: "0"}, 0, 30 * time.Second},
+		{"invalid ignored", map[string]string{paramCircuitThreshold: "-1", paramCircuitCooldown: "0s"}, 5, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			threshold, cooldown := breakerSettings(defaults, tt.params)
+			if threshold != tt.wantThreshold || cooldown != tt.wantCooldown {
+				t.Errorf("breakerSettings = %d, %v; want %d, %v", threshold, cooldown, tt.wantThreshold, tt.wantCooldown)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/events"
+	"github.com/AdamPippert/Lobstertank/internal/httputil"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+)
+
+// UpdateMany applies req to every gateway the caller can see whose labels
+// match selector, in one store transaction: either every match is updated
+// or, if any update fails validation or the write, none is. Gateways that
+// stop matching before their turn are left alone.
+func (r *Registry) UpdateMany(ctx context.Context, selector map[string]string, req model.UpdateGatewayRequest) (*model.BulkUpdateResult, error) {
+	verr := &ValidationError{}
+	if len(selector) == 0 {
+		verr.add("selector", "must match at least one label")
+	}
+	if req.Name != nil {
+		verr.add("update.name", "cannot be set for several gateways")
+	}
+	// Sealing an inline token writes the secret store, which cannot join
+	// the transaction below; a shared token belongs in a secret_ref.
+	if req.Auth != nil {
+		if _, ok := req.Auth.Params[inlineTokenParam]; ok {
+			verr.add("update.auth.params.token", "cannot be set for several gateways; use auth.secret_ref")
+		}
+	}
+	if len(verr.Violations) > 0 {
+		return nil, verr
+	}
+
+	filter := model.GatewayFilter{Labels: selector}
+	matched, err := r.List(ctx, filter, model.ListSort{})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(matched))
+	for i := range matched {
+		ids[i] = matched[i].ID
+	}
+	// Lock in ID order so concurrent bulk updates cannot deadlock.
+	slices.Sort(ids)
+	for _, id := range ids {
+		defer r.lockGateway(id)()
+	}
+
+	var updated []*model.Gateway
+	err = r.store.InTx(ctx, func(tx store.Store) error {
+		updated = updated[:0]
+		for _, id := range ids {
+			gw, err := tx.GetGateway(ctx, id)
+			if errors.Is(err, store.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("get gateway for update %s: %w", id, err)
+			}
+			if !filter.Matches(gw) || !visible(ctx, gw) {
+				continue
+			}
+
+			prevAuth := gw.Auth
+			applyUpdate(gw, req)
+			err = validateGateway(gw)
+			if err == nil {
+				err = r.checkSecretRefs(gw, prevAuth)
+			}
+			if err != nil {
+				var gwErr *ValidationError
+				if !errors.As(err, &gwErr) {
+					return err
+				}
+				for _, v := range gwErr.Violations {
+					verr.add(fmt.Sprintf("gateways[%s].%s", id, v.Field), "%s", v.Message)
+				}
+				continue
+			}
+			if len(verr.Violations) > 0 {
+				continue
+			}
+			if err := tx.UpdateGateway(ctx, gw); err != nil {
+				return fmt.Errorf("update gateway %s: %w", id, err)
+			}
+			updated = append(updated, gw)
+		}
+		if len(verr.Violations) > 0 {
+			return verr
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &model.BulkUpdateResult{IDs: make([]string, 0, len(updated))}
+	for _, gw := range updated {
+		r.cache.invalidate(gw.ID)
+		r.auditor.Log(ctx, audit.Event{
+			Action:   "gateway.updated",
+			Resource: gw.ID,
+			Detail:   fmt.Sprintf("updated gateway %q in a bulk update", gw.Name),
+		})
+		r.events.Publish(events.GatewayUpdated, gw.ID, gw.OrgID, redactGateway(gw))
+		result.IDs = append(result.IDs, gw.ID)
+	}
+	result.Count = len(result.IDs)
+	return result, nil
+}
+
+// BulkUpdate handles PATCH /api/v1/gateways.
+func (h *Handler) BulkUpdate(w http.ResponseWriter, r *http.Request) {
+	var req model.BulkUpdateGatewaysRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.WriteBodyError(w, r, err)
+		return
+	}
+
+	result, err := h.registry.UpdateMany(r.Context(), req.Selector, req.Update)
+	if err != nil {
+		writeRegistryError(w, r, "failed to update gateways", err)
+		return
+	}
+	for _, id := range result.IDs {
+		h.clientFactory.Invalidate(id)
+	}
+
+	httputil.WriteJSON(w, http.StatusOK, result)
+}
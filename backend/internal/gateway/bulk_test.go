@@ -0,0 +1,81 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+func TestUpdateManyUpdatesOnlyMatchingGateways(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	ctx := context.Background()
+	prodA := createGateway(t, r, "prod-a", map[string]string{"env": "prod", "team": "a"})
+	prodB := createGateway(t, r, "prod-b", map[string]string{"env": "prod", "team": "b"})
+	staging := createGateway(t, r, "staging", map[string]string{"env": "staging", "team": "a"})
+
+	desc := "bulk"
+	result, err := r.UpdateMany(ctx, map[string]string{"env": "prod"}, model.UpdateGatewayRequest{Description: &desc})
+	if err != nil {
+		t.Fatalf("UpdateMany: %v", err)
+	}
+	want := []string{prodA.ID, prodB.ID}
+	slices.Sort(want)
+	got := slices.Sorted(slices.Values(result.IDs))
+	if result.Count != 2 || !slices.Equal(got, want) {
+		t.Fatalf("updated %d %v, want %v", result.Count, got, want)
+	}
+
+	for _, id := range want {
+		gw, err := r.Get(ctx, id)
+		if err != nil {
+			t.Fatalf("Get %s: %v", id, err)
+		}
+		if gw.Description != desc {
+			t.Errorf("gateway %s description = %q, want %q", gw.Name, gw.Description, desc)
+		}
+	}
+	gw, err := r.Get(ctx, staging.ID)
+	if err != nil {
+		t.Fatalf("Get staging: %v", err)
+	}
+	if gw.Description != "" {
+		t.Errorf("non-matching gateway updated: description = %q", gw.Description)
+	}
+}
+
+func TestUpdateManyRollsBackOnValidationFailure(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	ctx := context.Background()
+	a := createGateway(t, r, "a", map[string]string{"env": "prod"})
+	createGateway(t, r, "b", map[string]string{"env": "prod"})
+
+	endpoint := "not a url"
+	_, err := r.UpdateMany(ctx, map[string]string{"env": "prod"}, model.UpdateGatewayRequest{Endpoint: &endpoint})
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Violations) != 2 {
+		t.Fatalf("UpdateMany error = %v, want a violation per gateway", err)
+	}
+	gw, err := r.Get(ctx, a.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if gw.Endpoint != a.Endpoint {
+		t.Errorf("endpoint = %q after a failed bulk update, want %q", gw.Endpoint, a.Endpoint)
+	}
+}
+
+func TestUpdateManyRejectsInlineToken(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	createGateway(t, r, "a", map[string]string{"env": "prod"})
+
+	_, err := r.UpdateMany(context.Background(), map[string]string{"env": "prod"}, model.UpdateGatewayRequest{
+		Auth: &model.GatewayAuthConfig{Type: "token", Params: map[string]string{"token": "s3cret"}},
+	})
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Violations[0].Field != "update.auth.params.token" {
+		t.Fatalf("UpdateMany error = %v, want a violation on update.auth.params.token", err)
+	}
+}
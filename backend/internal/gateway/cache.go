@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// statusCache keeps recently read gateways for a short TTL so that polling
+// a gateway's status does not query the store on every request. The
+// registry invalidates a gateway's entry whenever it writes the gateway;
+// writes from other processes become visible once the entry expires, or at
+// once when a change feed is followed.
+type statusCache struct {
+	ttl   time.Duration
+	clock clock.Clock
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	// gen counts invalidations, so a read that raced with a write does not
+	// cache what it read before the write.
+	gen uint64
+}
+
+type cacheEntry struct {
+	gw      model.Gateway
+	expires time.Time
+}
+
+func newStatusCache(ttl time.Duration, clk clock.Clock) *statusCache {
+	return &statusCache{ttl: ttl, clock: clk, entries: make(map[string]cacheEntry)}
+}
+
+// get returns a copy of the cached gateway, if fresh, and the generation to
+// pass to put after a miss.
+func (c *statusCache) get(id string) (*model.Gateway, uint64) {
+	if c == nil {
+		return nil, 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[id]
+	if !ok {
+		return nil, c.gen
+	}
+	if !c.clock.Now().Before(e.expires) {
+		delete(c.entries, id)
+		return nil, c.gen
+	}
+	return cloneGateway(&e.gw), c.gen
+}
+
+// put caches a gateway read from the store, unless something was
+// invalidated since the read began.
+func (c *statusCache) put(gw *model.Gateway, gen uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return
+	}
+	c.entries[gw.ID] = cacheEntry{gw: *cloneGateway(gw), expires: c.clock.Now().Add(c.ttl)}
+}
+
+// invalidate drops a gateway's entry. It must be called after the write
+// reaches the store.
+func (c *statusCache) invalidate(id string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, id)
+	c.gen++
+}
+
+// cloneGateway copies gw deeply enough that callers may modify the copy.
+func cloneGateway(gw *model.Gateway) *model.Gateway {
+	out := *gw
+	out.Transport.Params = maps.Clone(gw.Transport.Params)
+	out.Auth.Params = maps.Clone(gw.Auth.Params)
+	out.Labels = maps.Clone(gw.Labels)
+	if gw.LastSeenAt != nil {
+		t := *gw.LastSeenAt
+		out.LastSeenAt = &t
+	}
+	if gw.TTLSeconds != nil {
+		n := *gw.TTLSeconds
+		out.TTLSeconds = &n
+	}
+	if gw.MaintenanceUntil != nil {
+		t := *gw.MaintenanceUntil
+		out.MaintenanceUntil = &t
+	}
+	return &out
+}
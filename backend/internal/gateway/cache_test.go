@@ -0,0 +1,182 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/secrets"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+)
+
+// countingStore is a store that counts gateway reads by ID.
+type countingStore struct {
+	store.Store
+	reads atomic.Int32
+}
+
+func (s *countingStore) GetGateway(ctx context.Context, id string) (*model.Gateway, error) {
+	s.reads.Add(1)
+	return s.Store.GetGateway(ctx, id)
+}
+
+func (s *countingStore) ListGatewaysByIDs(ctx context.Context, ids []string) ([]model.Gateway, []string, error) {
+	s.reads.Add(1)
+	return s.Store.ListGatewaysByIDs(ctx, ids)
+}
+
+// newCachingRegistry returns a registry over a counting in-memory store
+// that caches reads for ttl.
+func newCachingRegistry(t testing.TB, ttl time.Duration) (*Registry, *countingStore, *clock.FakeClock) {
+	t.Helper()
+	s, err := store.NewSQLiteStore(":memory:", false, true)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	sp, err := secrets.NewBuiltinProvider("")
+	if err != nil {
+		t.Fatalf("NewBuiltinProvider: %v", err)
+	}
+	cs, clk := &countingStore{Store: s}, clock.NewFake(testEpoch)
+	r := NewRegistry(cs, audit.New(config.AuditConfig{}), clk, 0, sp, "builtin://gateways/")
+	r.SetStatusCacheTTL(ttl)
+	return r, cs, clk
+}
+
+func TestStatusCacheServesRepeatedReads(t *testing.T) {
+	tests := []struct {
+		name      string
+		ttl       time.Duration
+		advance   time.Duration
+		wantReads int32
+	}{
+		{"within ttl", 2 * time.Second, time.Second, 1},
+		{"expired", 2 * time.Second, 2 * time.Second, 2},
+		{"disabled", 0, 0, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, cs, clk := newCachingRegistry(t, tt.ttl)
+			gw := createGateway(t, r, "alpha", nil)
+			ctx := context.Background()
+
+			first, err := r.Get(ctx, gw.ID)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			first.Name = "changed by the caller"
+			clk.Advance(tt.advance)
+			second, err := r.Get(ctx, gw.ID)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if got := cs.reads.Load(); got != tt.wantReads {
+				t.Errorf("store read %d times, want %d", got, tt.wantReads)
+			}
+			if second.Name != "alpha" {
+				t.Errorf("cached gateway name = %q; a caller's change leaked into the cache", second.Name)
+			}
+		})
+	}
+}
+
+func TestStatusCacheInvalidatedByWrites(t *testing.T) {
+	desc := "updated"
+	tests := []struct {
+		name  string
+		write func(ctx context.Context, r *Registry, id string) error
+		check func(gw *model.Gateway) bool
+	}{
+		{"status update", func(ctx context.Context, r *Registry, id string) error {
+			return r.UpdateStatus(ctx, model.HealthCheckResult{GatewayID: id, Status: model.StatusOffline})
+		}, func(gw *model.Gateway) bool { return gw.Status == model.StatusOffline }},
+		{"update", func(ctx context.Context, r *Registry, id string) error {
+			_, err := r.Update(ctx, id, model.UpdateGatewayRequest{Description: &desc})
+			return err
+		}, func(gw *model.Gateway) bool { return gw.Description == desc }},
+		{"patch", func(ctx context.Context, r *Registry, id string) error {
+			_, err := r.Patch(ctx, id, model.PatchGatewayRequest{Labels: map[string]*string{"env": &desc}})
+			return err
+		}, func(gw *model.Gateway) bool { return gw.Labels["env"] == desc }},
+		{"maintenance", func(ctx context.Context, r *Registry, id string) error {
+			_, err := r.SetMaintenance(ctx, id, model.MaintenanceRequest{Enabled: true})
+			return err
+		}, func(gw *model.Gateway) bool { return gw.Status == model.StatusMaintenance }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _, _ := newCachingRegistry(t, time.Hour)
+			gw := createGateway(t, r, "alpha", nil)
+			ctx := context.Background()
+			if _, err := r.Get(ctx, gw.ID); err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+
+			if err := tt.write(ctx, r, gw.ID); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			got, err := r.Get(ctx, gw.ID)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if !tt.check(got) {
+				t.Errorf("Get after the write served a stale gateway: %+v", got)
+			}
+		})
+	}
+}
+
+func TestStatusCacheInvalidatedByDelete(t *testing.T) {
+	r, _, _ := newCachingRegistry(t, time.Hour)
+	gw := createGateway(t, r, "alpha", nil)
+	ctx := context.Background()
+	if _, err := r.Get(ctx, gw.ID); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if err := r.Delete(ctx, gw.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := r.Get(ctx, gw.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get after Delete: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestStatusCacheAuthorizesCachedReads(t *testing.T) {
+	r, cs, _ := newCachingRegistry(t, time.Hour)
+	gw := createOrgGateway(t, r, "acme", "acme-edge")
+	if _, err := r.Get(orgContext("acme"), gw.ID); err != nil {
+		t.Fatalf("acme Get: %v", err)
+	}
+	if _, err := r.Get(orgContext("initech"), gw.ID); !errors.Is(err, ErrForbidden) {
+		t.Errorf("initech Get of a cached acme gateway: got %v, want ErrForbidden", err)
+	}
+	if n := cs.reads.Load(); n != 1 {
+		t.Errorf("store read %d times, want 1", n)
+	}
+}
+
+func TestStatusCacheDropsReadsRacingWrites(t *testing.T) {
+	clk := clock.NewFake(testEpoch)
+	c := newStatusCache(time.Minute, clk)
+	gw := &model.Gateway{ID: "gw-1", Status: model.StatusOnline}
+
+	_, gen := c.get(gw.ID) // a read misses and goes to the store...
+	c.invalidate(gw.ID)    // ...while a write lands
+	c.put(gw, gen)
+	if cached, _ := c.get(gw.ID); cached != nil {
+		t.Error("a read that began before a write was cached")
+	}
+
+	_, gen = c.get(gw.ID)
+	c.put(gw, gen)
+	if cached, _ := c.get(gw.ID); cached == nil || cached.Status != model.StatusOnline {
+		t.Errorf("cached = %+v, want the gateway read after the write", cached)
+	}
+}
@@ -0,0 +1,220 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/events"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+)
+
+// Delays before reconnecting a lost change feed; each failed attempt
+// doubles the delay up to the maximum.
+const (
+	minChangeBackoff = time.Second
+	maxChangeBackoff = time.Minute
+)
+
+// SetChangeFeed makes FollowChanges apply gateway writes that other replicas
+// make through f. It must be called before the registry is in use.
+func (r *Registry) SetChangeFeed(f store.ChangeFeed) {
+	r.changes = f
+}
+
+// FollowChanges applies gateway writes made by other replicas until the
+// context is canceled: it drops their gateways from the status cache and
+// publishes the events the writing replica published, so every replica
+// streams the same events. When the feed is lost it reconnects with backoff
+// and resyncs by listing the gateways, publishing the events it missed. It
+// returns at once when no feed is set.
+func (r *Registry) FollowChanges(ctx context.Context) {
+	if r.changes == nil {
+		return
+	}
+
+	f := &changeFollower{r: r}
+	backoff := minChangeBackoff
+	for {
+		err := r.changes.WatchChanges(ctx, func() {
+			backoff = minChangeBackoff
+			f.resync(ctx)
+		}, func(c store.Change) {
+			f.apply(ctx, c)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("gateway change feed lost; reconnecting", "error", err, "retry_in", backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.clock.After(backoff):
+		}
+		backoff = min(2*backoff, maxChangeBackoff)
+	}
+}
+
+// changeFollower tracks what it last knew of each gateway, so a resync can
+// tell which events were missed. It is used from one goroutine only.
+type changeFollower struct {
+	r     *Registry
+	known map[string]knownGateway // nil until the first resync
+}
+
+type knownGateway struct {
+	name    string
+	org     string
+	status  model.Status
+	deleted bool
+	version string // the fields an update can change, encoded
+}
+
+func knowGateway(gw *model.Gateway) knownGateway {
+	// Status and liveness change through health checks rather than updates.
+	v := *gw
+	v.Status, v.LastSeenAt, v.DeletedAt = "", nil, nil
+	version, _ := json.Marshal(&v)
+
+	return knownGateway{
+		name:    gw.Name,
+		org:     gw.OrgID,
+		status:  gw.Status,
+		deleted: gw.DeletedAt != nil,
+		version: string(version),
+	}
+}
+
+// apply handles one change. This registry already acted on its own writes,
+// so those only refresh what the follower knows.
+func (f *changeFollower) apply(ctx context.Context, c store.Change) {
+	id := c.GatewayID
+	if c.Kind == store.ChangePurged {
+		delete(f.known, id)
+		if !c.Local {
+			f.r.cache.invalidate(id)
+		}
+		return
+	}
+
+	prev := f.known[id]
+	gw := f.refresh(ctx, id)
+	if c.Local {
+		return
+	}
+	f.r.cache.invalidate(id)
+
+	name, org := prev.name, prev.org
+	if gw != nil {
+		name, org = gw.Name, gw.OrgID
+	}
+	switch c.Kind {
+	case store.ChangeStatus:
+		f.r.events.Publish(events.GatewayStatusChanged, id, org, c.Data)
+	case store.ChangeDeleted:
+		f.r.events.Publish(events.GatewayDeleted, id, org, map[string]string{"id": id, "name": name})
+	case store.ChangeCreated, store.ChangeUpdated, store.ChangeRestored:
+		if gw == nil || gw.DeletedAt != nil {
+			return // deleted since; its own notification follows
+		}
+		typ := map[store.ChangeKind]string{
+			store.ChangeCreated:  events.GatewayCreated,
+			store.ChangeUpdated:  events.GatewayUpdated,
+			store.ChangeRestored: events.GatewayRestored,
+		}[c.Kind]
+		f.r.events.Publish(typ, id, gw.OrgID, redactGateway(gw))
+	}
+}
+
+// refresh rereads a gateway, live or deleted, and records it as known. It
+// returns nil when the gateway is gone or cannot be read.
+func (f *changeFollower) refresh(ctx context.Context, id string) *model.Gateway {
+	gw, err := f.r.store.GetGateway(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		gw, err = f.r.store.GetDeletedGateway(ctx, id)
+	}
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			slog.Warn("failed to read changed gateway", "id", id, "error", err)
+		}
+		delete(f.known, id)
+		return nil
+	}
+	if f.known != nil {
+		f.known[id] = knowGateway(gw)
+	}
+	return gw
+}
+
+// resync lists every gateway and, unless this is the first sync, publishes
+// the events missed since the last one. Writes this replica made while the
+// feed was down are among them, so their events may repeat.
+func (f *changeFollower) resync(ctx context.Context) {
+	live, err := f.r.store.ListGateways(ctx, model.GatewayFilter{}, model.ListSort{})
+	if err != nil {
+		slog.Warn("failed to resync gateway changes", "error", err)
+		return
+	}
+	deleted, err := f.r.store.ListDeletedGateways(ctx, model.GatewayFilter{}, model.ListSort{})
+	if err != nil {
+		slog.Warn("failed to resync gateway changes", "error", err)
+		return
+	}
+
+	current := make(map[string]knownGateway, len(live)+len(deleted))
+	for _, gateways := range [][]model.Gateway{live, deleted} {
+		for i := range gateways {
+			gw := &gateways[i]
+			now := knowGateway(gw)
+			current[gw.ID] = now
+			if f.known != nil {
+				was, ok := f.known[gw.ID]
+				f.publishMissed(gw, was, ok, now)
+			}
+		}
+	}
+	for id, was := range f.known {
+		if _, ok := current[id]; !ok && !was.deleted {
+			// Deleted and purged while the feed was down.
+			f.r.cache.invalidate(id)
+			f.r.events.Publish(events.GatewayDeleted, id, was.org, map[string]string{"id": id, "name": was.name})
+		}
+	}
+	f.known = current
+}
+
+// publishMissed publishes the events that took gw from was, if known, to now.
+func (f *changeFollower) publishMissed(gw *model.Gateway, was knownGateway, known bool, now knownGateway) {
+	if known && was == now {
+		return
+	}
+	f.r.cache.invalidate(gw.ID)
+
+	switch {
+	case !known:
+		if !now.deleted {
+			f.r.events.Publish(events.GatewayCreated, gw.ID, gw.OrgID, redactGateway(gw))
+		}
+	case !was.deleted && now.deleted:
+		f.r.events.Publish(events.GatewayDeleted, gw.ID, gw.OrgID, map[string]string{"id": gw.ID, "name": gw.Name})
+	case was.deleted && !now.deleted:
+		f.r.events.Publish(events.GatewayRestored, gw.ID, gw.OrgID, redactGateway(gw))
+	case !now.deleted:
+		if was.version != now.version {
+			f.r.events.Publish(events.GatewayUpdated, gw.ID, gw.OrgID, redactGateway(gw))
+		}
+		if was.status != now.status {
+			// The transitions themselves were not seen; report the net one.
+			f.r.events.Publish(events.GatewayStatusChanged, gw.ID, gw.OrgID, model.StatusTransition{
+				GatewayID:  gw.ID,
+				From:       was.status,
+				To:         now.status,
+				ObservedAt: f.r.clock.Now().UTC(),
+			})
+		}
+	}
+}
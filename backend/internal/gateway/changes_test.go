@@ -0,0 +1,244 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/events"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/secrets"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+)
+
+// fakeFeed is a change feed whose connections the test drives. Each
+// WatchChanges call is handed to the test as a feedConn.
+type fakeFeed struct {
+	conns chan *feedConn
+}
+
+// feedConn is one connection of a fakeFeed. The test accepts or refuses
+// it, then sends changes until it closes changes to drop the connection.
+type feedConn struct {
+	accepted chan bool
+	changes  chan store.Change
+}
+
+func newFakeFeed() *fakeFeed {
+	return &fakeFeed{conns: make(chan *feedConn)}
+}
+
+func (f *fakeFeed) WatchChanges(ctx context.Context, ready func(), fn func(store.Change)) error {
+	c := &feedConn{accepted: make(chan bool), changes: make(chan store.Change)}
+	select {
+	case f.conns <- c:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if !<-c.accepted {
+		return errors.New("connection refused")
+	}
+	ready()
+
+	for {
+		select {
+		case change, ok := <-c.changes:
+			if !ok {
+				return errors.New("connection lost")
+			}
+			fn(change)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// next returns the follower's next connection attempt.
+func (f *fakeFeed) next(t *testing.T) *feedConn {
+	t.Helper()
+	select {
+	case c := <-f.conns:
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatal("the follower did not connect")
+		return nil
+	}
+}
+
+// followChanges runs r.FollowChanges over feed until the test ends.
+func followChanges(t *testing.T, r *Registry, feed *fakeFeed) {
+	t.Helper()
+	r.SetChangeFeed(feed)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.FollowChanges(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// waitForSleep waits until the follower is waiting on clk.
+func waitForSleep(t *testing.T, clk *clock.FakeClock) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); clk.Waiters() == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("the follower did not wait to reconnect")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// nextEvents returns the type and gateway of the next n events on sub.
+func nextEvents(t *testing.T, sub *events.Subscription, n int) map[string]string {
+	t.Helper()
+	got := make(map[string]string, n)
+	for range n {
+		select {
+		case evt := <-sub.C:
+			got[evt.GatewayID] = evt.Type
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got events %v, then nothing", got)
+		}
+	}
+	return got
+}
+
+func TestFollowChangesBackoff(t *testing.T) {
+	r, _, clk := newCachingRegistry(t, 0)
+	feed := newFakeFeed()
+	followChanges(t, r, feed)
+
+	// Each refused attempt doubles the delay up to the maximum; a connection
+	// that gets as far as listening resets it.
+	for i, tt := range []struct {
+		accept    bool
+		wantDelay time.Duration
+	}{
+		{false, time.Second},
+		{false, 2 * time.Second},
+		{false, 4 * time.Second},
+		{false, 8 * time.Second},
+		{false, 16 * time.Second},
+		{false, 32 * time.Second},
+		{false, time.Minute},
+		{false, time.Minute},
+		{true, time.Second},
+		{false, 2 * time.Second},
+		{false, 4 * time.Second},
+	} {
+		c := feed.next(t)
+		c.accepted <- tt.accept
+		if tt.accept {
+			close(c.changes)
+		}
+		waitForSleep(t, clk)
+		clk.Advance(tt.wantDelay - time.Nanosecond)
+		if clk.Waiters() != 1 {
+			t.Fatalf("attempt %d: reconnected before %v", i, tt.wantDelay)
+		}
+		clk.Advance(time.Nanosecond)
+	}
+	feed.next(t).accepted <- false
+}
+
+func TestFollowChangesResync(t *testing.T) {
+	r, cs, clk := newCachingRegistry(t, time.Hour)
+	hub := events.NewHub()
+	r.SetEventHub(hub)
+	sp, err := secrets.NewBuiltinProvider("")
+	if err != nil {
+		t.Fatalf("NewBuiltinProvider: %v", err)
+	}
+	// Another replica writing to the same database.
+	other := NewRegistry(cs.Store, audit.New(config.AuditConfig{}), clk, 0, sp, "builtin://gateways/")
+	ctx := context.Background()
+
+	alpha := createGateway(t, r, "alpha", nil)
+	bravo := createGateway(t, r, "bravo", nil)
+	charlie := createGateway(t, r, "charlie", nil)
+	for _, id := range []string{alpha.ID, bravo.ID} {
+		if _, err := r.Get(ctx, id); err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+	}
+	sub := hub.Subscribe(0, "")
+	t.Cleanup(func() { hub.Unsubscribe(sub) })
+	feed := newFakeFeed()
+	followChanges(t, r, feed)
+
+	description := func(id string) string {
+		t.Helper()
+		gw, err := r.Get(ctx, id)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		return gw.Description
+	}
+	describe := func(id, text string) {
+		t.Helper()
+		if _, err := other.Patch(ctx, id, model.PatchGatewayRequest{Description: &text}); err != nil {
+			t.Fatalf("Patch: %v", err)
+		}
+	}
+
+	// The first sync only learns the gateways; a change then arrives live.
+	c := feed.next(t)
+	c.accepted <- true
+	describe(alpha.ID, "patched live")
+	c.changes <- store.Change{Kind: store.ChangeUpdated, GatewayID: alpha.ID}
+	if got, want := nextEvents(t, sub, 1), map[string]string{alpha.ID: events.GatewayUpdated}; !maps.Equal(got, want) {
+		t.Errorf("live change published %v, want %v", got, want)
+	}
+	if got := description(alpha.ID); got != "patched live" {
+		t.Errorf("alpha description = %q after the change, want it reread", got)
+	}
+
+	// Writes made while the feed is down are found by the resync once it
+	// reconnects.
+	close(c.changes)
+	describe(bravo.ID, "patched while down")
+	if err := other.Delete(ctx, charlie.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	delta := createGateway(t, other, "delta", nil)
+	waitForSleep(t, clk)
+	clk.Advance(minChangeBackoff)
+	feed.next(t).accepted <- true
+
+	want := map[string]string{
+		bravo.ID:   events.GatewayUpdated,
+		charlie.ID: events.GatewayDeleted,
+		delta.ID:   events.GatewayCreated,
+	}
+	if got := nextEvents(t, sub, len(want)); !maps.Equal(got, want) {
+		t.Errorf("resync published %v, want %v", got, want)
+	}
+	if got := description(bravo.ID); got != "patched while down" {
+		t.Errorf("bravo description = %q after the resync, want it reread", got)
+	}
+	if extra := nextEventsNow(sub); len(extra) > 0 {
+		t.Errorf("resync also published %v", extra)
+	}
+}
+
+// nextEventsNow returns the type and gateway of the events already on sub.
+func nextEventsNow(sub *events.Subscription) map[string]string {
+	got := map[string]string{}
+	for {
+		select {
+		case evt := <-sub.C:
+			got[evt.GatewayID] = evt.Type
+		default:
+			return got
+		}
+	}
+}
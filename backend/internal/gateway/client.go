@@ -4,11 +4,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
 	"github.com/AdamPippert/Lobstertank/internal/model"
 	"github.com/AdamPippert/Lobstertank/internal/secrets"
 	"github.com/AdamPippert/Lobstertank/internal/transport"
@@ -19,28 +24,98 @@ type Client struct {
 	gateway    *model.Gateway
 	httpClient *http.Client
 	secretProv secrets.Provider
+	retry      retryPolicy
+	breaker    *breaker // nil when circuit breaking is disabled
+	factory    *ClientFactory
+	tlsLoaded  bool // client certificate installed for mtls gateways
+	ephemeral  bool // settings overridden for one request; shares no cached state
 }
 
 // ClientFactory creates gateway clients configured with the correct transport
 // and authentication.
 type ClientFactory struct {
-	transport  transport.Provider
-	secretProv secrets.Provider
+	transport       transport.Provider
+	secretProv      secrets.Provider
+	retry           config.RetryConfig
+	breakerDefaults config.BreakerConfig
+	clock           clock.Clock
+
+	mu          sync.Mutex
+	breakers    map[string]*breaker      // keyed by gateway ID
+	tlsMaterial map[string]*clientTLS    // keyed by gateway ID
+	clients     map[string]*pooledClient // keyed by transport type and params
+	lastSweep   time.Time                // last check for idle pooled clients
 }
 
-// NewClientFactory returns a factory that builds gateway clients.
-func NewClientFactory(tp transport.Provider, sp secrets.Provider) *ClientFactory {
-	return &ClientFactory{transport: tp, secretProv: sp}
+// NewClientFactory returns a factory that builds gateway clients. rc and bc
+// are the default retry and circuit breaker settings; gateways may override
+// them via transport params.
+func NewClientFactory(tp transport.Provider, sp secrets.Provider, rc config.RetryConfig, bc config.BreakerConfig, clk clock.Clock) *ClientFactory {
+	return &ClientFactory{
+		transport:       tp,
+		secretProv:      sp,
+		retry:           rc,
+		breakerDefaults: bc,
+		clock:           clk,
+		breakers:        make(map[string]*breaker),
+		tlsMaterial:     make(map[string]*clientTLS),
+		clients:         make(map[string]*pooledClient),
+	}
 }
 
-// ClientFor builds a Client configured for the given gateway.
+// ClientFor builds a Client configured for the given gateway. Its HTTP
+// client, and so its connection pool, is shared with every gateway that has
+// the same transport settings.
 func (f *ClientFactory) ClientFor(gw *model.Gateway) *Client {
-	httpClient := f.transport.HTTPClient(gw.Transport.Type, gw.Transport.Params)
 	return &Client{
 		gateway:    gw,
-		httpClient: httpClient,
+		httpClient: f.httpClientFor(gw),
+		secretProv: f.secretProv,
+		retry:      retryPolicyFor(f.retry, gw.Transport.Params),
+		breaker:    f.breakerFor(gw),
+		factory:    f,
+	}
+}
+
+// ClientForOverride builds a Client for a gateway whose settings were
+// changed for one request and not stored. It shares no circuit breaker or
+// cached client certificate with the stored gateway, so the override
+// neither uses nor disturbs their state.
+func (f *ClientFactory) ClientForOverride(gw *model.Gateway) *Client {
+	return &Client{
+		gateway:    gw,
+		httpClient: f.transport.HTTPClient(gw.Transport.Type, gw.Transport.Params),
 		secretProv: f.secretProv,
+		retry:      retryPolicyFor(f.retry, gw.Transport.Params),
+		factory:    f,
+		ephemeral:  true,
+	}
+}
+
+// Invalidate discards per-gateway client state, such as the circuit breaker
+// and cached mTLS certificate, so that the next client built for the gateway
+// starts fresh. Call it when a gateway record is updated or deleted.
+func (f *ClientFactory) Invalidate(gatewayID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.breakers, gatewayID)
+	delete(f.tlsMaterial, gatewayID)
+}
+
+// do sends req through the gateway's circuit breaker and retry policy. An
+// open breaker fails fast with a *CircuitOpenError. Transport errors and 5xx
+// responses count as failures.
+func (c *Client) do(req *http.Request) (*http.Response, int, error) {
+	if c.breaker == nil {
+		return c.doWithRetry(req)
+	}
+
+	if ok, wait := c.breaker.allow(); !ok {
+		return nil, 0, &CircuitOpenError{GatewayID: c.gateway.ID, RetryAfter: wait}
 	}
+	resp, attempts, err := c.doWithRetry(req)
+	c.breaker.record(err, err != nil || resp.StatusCode >= 500)
+	return resp, attempts, err
 }
 
 // HealthCheck probes the gateway and returns its status.
@@ -51,29 +126,39 @@ func (c *Client) HealthCheck(ctx context.Context) (*model.HealthCheckResult, err
 		CheckedAt: start.UTC().Format(time.RFC3339),
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.gateway.Endpoint+"/healthz", nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL()+"/healthz", nil)
 	if err != nil {
 		result.Status = model.StatusOffline
 		result.Error = err.Error()
+		result.ErrorKind = model.ErrorKindUnknown
 		return result, fmt.Errorf("build health request: %w", err)
 	}
 
 	if err := c.applyAuth(ctx, req); err != nil {
 		result.Status = model.StatusUnknown
 		result.Error = "auth setup failed"
+		result.ErrorKind = model.ErrorKindAuth
 		return result, fmt.Errorf("apply auth: %w", err)
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, attempts, err := c.do(req)
+	result.Attempts = attempts
+	if errors.Is(err, ErrCircuitOpen) {
+		result.Status = model.StatusOffline
+		result.Error = err.Error()
+		result.ErrorKind = model.ErrorKindCircuitOpen
+		return result, err
+	}
 	if err != nil {
 		result.Status = model.StatusOffline
 		result.Error = err.Error()
-		result.Latency = time.Since(start).String()
+		result.ErrorKind = classifyError(err)
+		setLatency(result, time.Since(start))
 		return result, nil // Not an application error — gateway is simply unreachable.
 	}
 	defer resp.Body.Close()
 
-	result.Latency = time.Since(start).String()
+	setLatency(result, time.Since(start))
 
 	switch {
 	case resp.StatusCode >= 200 && resp.StatusCode < 300:
@@ -81,14 +166,23 @@ func (c *Client) HealthCheck(ctx context.Context) (*model.HealthCheckResult, err
 	case resp.StatusCode >= 500:
 		result.Status = model.StatusDegraded
 		result.Error = fmt.Sprintf("HTTP %d", resp.StatusCode)
+		result.ErrorKind = classifyStatus(resp.StatusCode)
 	default:
 		result.Status = model.StatusUnknown
 		result.Error = fmt.Sprintf("HTTP %d", resp.StatusCode)
+		result.ErrorKind = classifyStatus(resp.StatusCode)
 	}
 
 	return result, nil
 }
 
+// setLatency records d on the result as both a human-readable string and
+// whole milliseconds.
+func setLatency(result *model.HealthCheckResult, d time.Duration) {
+	result.Latency = d.String()
+	result.LatencyMillis = d.Milliseconds()
+}
+
 // openClawRequest is the request body for the OpenClaw completions endpoint.
 type openClawRequest struct {
 	Prompt   string            `json:"prompt"`
@@ -101,44 +195,89 @@ type openClawResponse struct {
 	ID       string `json:"id"`
 	Response string `json:"response"`
 	Model    string `json:"model,omitempty"`
+	Usage    struct {
+		PromptTokens     int64 `json:"prompt_tokens"`
+		CompletionTokens int64 `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// UpstreamError is returned when a gateway answers with a non-2xx status.
+type UpstreamError struct {
+	GatewayID  string
+	StatusCode int
+	Body       []byte
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("gateway %s returned HTTP %d: %s", e.GatewayID, e.StatusCode, string(e.Body))
 }
 
-// SendPrompt sends a prompt to the OpenClaw gateway and returns the raw response body.
-func (c *Client) SendPrompt(ctx context.Context, prompt string) ([]byte, error) {
+// SendPrompt sends a prompt to the OpenClaw gateway and returns the raw
+// response body along with the token usage it reports. A non-2xx answer is
+// reported as an *UpstreamError.
+func (c *Client) SendPrompt(ctx context.Context, prompt string, metadata map[string]string) ([]byte, model.Usage, error) {
 	body, err := json.Marshal(openClawRequest{
-		Prompt: prompt,
-		Stream: false,
+		Prompt:   prompt,
+		Stream:   false,
+		Metadata: metadata,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("marshal prompt request: %w", err)
+		return nil, model.Usage{}, fmt.Errorf("marshal prompt request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.gateway.Endpoint+"/v1/completions", bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL()+"/v1/completions", bytes.NewReader(body))
 	if err != nil {
-		return nil, fmt.Errorf("build prompt request: %w", err)
+		return nil, model.Usage{}, fmt.Errorf("build prompt request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
 	if err := c.applyAuth(ctx, req); err != nil {
-		return nil, fmt.Errorf("apply auth: %w", err)
+		return nil, model.Usage{}, fmt.Errorf("apply auth: %w", err)
 	}
 
-	resp, err := c.httpClient.Do(req)
+	// Only failures before a response arrives are retried, so a prompt the
+	// gateway has started answering is never submitted twice.
+	resp, _, err := c.do(req)
 	if err != nil {
-		return nil, fmt.Errorf("send prompt to gateway %s: %w", c.gateway.ID, err)
+		return nil, model.Usage{}, fmt.Errorf("send prompt to gateway %s: %w", c.gateway.ID, err)
 	}
 	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20)) // 10 MiB limit
 	if err != nil {
-		return nil, fmt.Errorf("read response from gateway %s: %w", c.gateway.ID, err)
+		return nil, model.Usage{}, fmt.Errorf("read response from gateway %s: %w", c.gateway.ID, err)
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("gateway %s returned HTTP %d: %s", c.gateway.ID, resp.StatusCode, string(respBody))
+		return nil, model.Usage{}, &UpstreamError{GatewayID: c.gateway.ID, StatusCode: resp.StatusCode, Body: respBody}
+	}
+
+	return respBody, parseUsage(respBody), nil
+}
+
+// parseUsage extracts the model and token counts from a completion
+// response. Fields a gateway does not report are left zero.
+func parseUsage(body []byte) model.Usage {
+	var resp openClawResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return model.Usage{}
+	}
+	return model.Usage{
+		Model:            resp.Model,
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
 	}
+}
 
-	return respBody, nil
+// baseURL returns the gateway endpoint as a URL prefix. Tailnet gateways may
+// be registered by bare hostname; those are reached over plain HTTP since the
+// tunnel already encrypts the traffic.
+func (c *Client) baseURL() string {
+	endpoint := strings.TrimRight(c.gateway.Endpoint, "/")
+	if !strings.Contains(endpoint, "://") {
+		return "http://" + endpoint
+	}
+	return endpoint
 }
 
 // applyAuth adds authentication headers or TLS config to the outbound request.
@@ -151,7 +290,8 @@ func (c *Client) applyAuth(ctx context.Context, req *http.Request) error {
 		}
 		req.Header.Set("Authorization", "Bearer "+token)
 	case "mtls":
-		// mTLS is handled at the transport/TLS layer; no header needed.
+		// The certificate is presented during the TLS handshake; no header needed.
+		return c.useClientTLS(ctx)
 	case "oidc":
 		token, err := c.resolveSecret(ctx, c.gateway.Auth.SecretRef)
 		if err != nil {
@@ -0,0 +1,151 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/events"
+	"github.com/AdamPippert/Lobstertank/internal/logging"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+)
+
+// maxPurgeInterval bounds how long deleted gateways linger past their
+// retention.
+const maxPurgeInterval = time.Hour
+
+// Run purges gateways deleted longer ago than the retention set with
+// SetDeletedRetention until the context is canceled. It returns at once
+// when deleted gateways are kept indefinitely.
+func (r *Registry) Run(ctx context.Context) {
+	if r.deletedRetention <= 0 {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.clock.After(min(r.deletedRetention, maxPurgeInterval)):
+			n, err := r.PurgeDeleted(ctx, r.clock.Now().Add(-r.deletedRetention))
+			if err != nil {
+				slog.Warn("failed to purge deleted gateways", "error", err)
+			} else if n > 0 {
+				slog.Info("purged deleted gateways", "count", n)
+			}
+		}
+	}
+}
+
+// PurgeDeleted purges every gateway deleted before the given time, along
+// with the auth secrets Lobstertank owns for them, and returns how many it
+// purged.
+func (r *Registry) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	gateways, err := r.store.ListDeletedGateways(ctx, model.GatewayFilter{}, model.ListSort{})
+	if err != nil {
+		return 0, fmt.Errorf("list deleted gateways: %w", err)
+	}
+
+	purged := 0
+	for i := range gateways {
+		gw := &gateways[i]
+		if !gw.DeletedAt.Before(before) {
+			continue
+		}
+		unlock := r.lockGateway(gw.ID)
+		err := r.purge(ctx, gw, false)
+		unlock()
+		if errors.Is(err, store.ErrNotFound) {
+			continue // purged concurrently
+		}
+		if err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// Purge removes a gateway for good, whether or not it was deleted first.
+// Unless keepSecret is set, an auth secret that Lobstertank owns is deleted
+// from the secrets provider as well; failing to do so is logged and
+// recorded in the audit event, not returned.
+func (r *Registry) Purge(ctx context.Context, id string, keepSecret bool) error {
+	unlock := r.lockGateway(id)
+	defer unlock()
+
+	gw, err := r.store.GetGateway(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		gw, err = r.store.GetDeletedGateway(ctx, id)
+	}
+	if err != nil {
+		return fmt.Errorf("get gateway for purge %s: %w", id, err)
+	}
+	if err := authorize(ctx, gw); err != nil {
+		return err
+	}
+	return r.purge(ctx, gw, keepSecret)
+}
+
+// purge removes gw and, unless keepSecret is set, its owned auth secrets.
+func (r *Registry) purge(ctx context.Context, gw *model.Gateway, keepSecret bool) error {
+	if err := r.store.PurgeGateway(ctx, gw.ID); err != nil {
+		return fmt.Errorf("purge gateway %s: %w", gw.ID, err)
+	}
+	r.cache.invalidate(gw.ID)
+	r.latencies.Delete(gw.ID)
+
+	detail := "gateway purged"
+	if outcome := r.cleanupSecrets(ctx, gw, keepSecret); outcome != "" {
+		detail += "; " + outcome
+	}
+
+	r.auditor.Log(ctx, audit.Event{
+		Action:   "gateway.purged",
+		Resource: gw.ID,
+		Detail:   detail,
+	})
+	if gw.DeletedAt == nil {
+		r.events.Publish(events.GatewayDeleted, gw.ID, gw.OrgID, map[string]string{"id": gw.ID, "name": gw.Name})
+	}
+
+	logging.LoggerFromContext(ctx).Info("gateway purged", "id", gw.ID)
+	return nil
+}
+
+// Restore brings back a deleted gateway. It fails with ErrNameConflict when
+// another gateway has taken the name since.
+func (r *Registry) Restore(ctx context.Context, id string) (*model.Gateway, error) {
+	unlock := r.lockGateway(id)
+	defer unlock()
+
+	gw, err := r.store.GetDeletedGateway(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("get gateway for restore %s: %w", id, err)
+	}
+	if err := authorize(ctx, gw); err != nil {
+		return nil, err
+	}
+
+	if err := r.store.RestoreGateway(ctx, id); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			return nil, fmt.Errorf("%w: %s", ErrNameConflict, gw.Name)
+		}
+		return nil, fmt.Errorf("restore gateway %s: %w", id, err)
+	}
+	r.cache.invalidate(id)
+	gw.DeletedAt = nil
+
+	r.auditor.Log(ctx, audit.Event{
+		Action:   "gateway.restored",
+		Resource: id,
+		Detail:   fmt.Sprintf("restored gateway %q", gw.Name),
+	})
+	r.events.Publish(events.GatewayRestored, id, gw.OrgID, redactGateway(gw))
+
+	logging.LoggerFromContext(ctx).Info("gateway restored", "id", id)
+	return gw, nil
+}
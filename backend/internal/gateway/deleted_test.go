@@ -0,0 +1,166 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+)
+
+// serveGateway sends a request for the gateway id to handle.
+func serveGateway(handle http.HandlerFunc, method, target, id string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.SetPathValue("id", id)
+	rec := httptest.NewRecorder()
+	handle(rec, req)
+	return rec
+}
+
+// listNames lists gateways through h, returning their names.
+func listNames(t *testing.T, h *Handler, target string) []string {
+	t.Helper()
+	rec := serveGateway(h.List, http.MethodGet, target, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d: %s", target, rec.Code, rec.Body)
+	}
+	var gateways []model.Gateway
+	if err := json.NewDecoder(rec.Body).Decode(&gateways); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	names := make([]string, 0, len(gateways))
+	for _, gw := range gateways {
+		names = append(names, gw.Name)
+	}
+	return names
+}
+
+func TestSoftDeleteAndRestore(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	h := newTestHandler(t, r)
+	gw := createGateway(t, r, "alpha", map[string]string{"env": "prod"})
+	createGateway(t, r, "beta", nil)
+
+	if rec := serveGateway(h.Delete, http.MethodDelete, "/api/v1/gateways/"+gw.ID, gw.ID); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := serveGateway(h.Get, http.MethodGet, "/api/v1/gateways/"+gw.ID, gw.ID); rec.Code != http.StatusNotFound {
+		t.Errorf("get deleted gateway: status %d, want 404", rec.Code)
+	}
+	if names := listNames(t, h, "/api/v1/gateways"); len(names) != 1 || names[0] != "beta" {
+		t.Errorf("list = %v, want only beta", names)
+	}
+	if names := listNames(t, h, "/api/v1/gateways?deleted=true"); len(names) != 1 || names[0] != "alpha" {
+		t.Errorf("list deleted = %v, want only alpha", names)
+	}
+	if rec := serveGateway(h.List, http.MethodGet, "/api/v1/gateways?deleted=maybe", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("list deleted=maybe: status %d, want 400", rec.Code)
+	}
+
+	rec := serveGateway(h.Restore, http.MethodPost, "/api/v1/gateways/"+gw.ID+"/restore", gw.ID)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("restore: status %d: %s", rec.Code, rec.Body)
+	}
+	var restored model.Gateway
+	if err := json.NewDecoder(rec.Body).Decode(&restored); err != nil {
+		t.Fatalf("decode restore: %v", err)
+	}
+	if restored.DeletedAt != nil || restored.Labels["env"] != "prod" || restored.Endpoint != gw.Endpoint {
+		t.Errorf("restored = %+v, want alpha as it was", restored)
+	}
+	if names := listNames(t, h, "/api/v1/gateways"); len(names) != 2 {
+		t.Errorf("list after restore = %v, want both gateways", names)
+	}
+	if rec := serveGateway(h.Restore, http.MethodPost, "/api/v1/gateways/"+gw.ID+"/restore", gw.ID); rec.Code != http.StatusNotFound {
+		t.Errorf("restore a live gateway: status %d, want 404", rec.Code)
+	}
+}
+
+func TestRestoreNameTaken(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	h := newTestHandler(t, r)
+	ctx := context.Background()
+	gw := createGateway(t, r, "alpha", nil)
+	if err := r.Delete(ctx, gw.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	createGateway(t, r, "alpha", nil) // the name is free again
+
+	if rec := serveGateway(h.Restore, http.MethodPost, "/api/v1/gateways/"+gw.ID+"/restore", gw.ID); rec.Code != http.StatusConflict {
+		t.Errorf("restore with the name taken: status %d, want 409: %s", rec.Code, rec.Body)
+	}
+	if deleted, _ := r.ListDeleted(ctx, model.GatewayFilter{}, model.ListSort{}); len(deleted) != 1 {
+		t.Errorf("%d deleted gateways after a failed restore, want 1", len(deleted))
+	}
+}
+
+func TestDeletePurge(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	h := newTestHandler(t, r)
+	live := createGateway(t, r, "live", nil)
+	deleted := createGateway(t, r, "deleted", nil)
+	if err := r.Delete(context.Background(), deleted.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	for _, gw := range []*model.Gateway{live, deleted} {
+		if rec := serveGateway(h.Delete, http.MethodDelete, "/api/v1/gateways/"+gw.ID+"?purge=true", gw.ID); rec.Code != http.StatusNoContent {
+			t.Errorf("purge %s: status %d: %s", gw.Name, rec.Code, rec.Body)
+		}
+	}
+	if names := listNames(t, h, "/api/v1/gateways?deleted=true"); len(names) != 0 {
+		t.Errorf("list deleted after purge = %v, want none", names)
+	}
+	if rec := serveGateway(h.Restore, http.MethodPost, "/api/v1/gateways/"+deleted.ID+"/restore", deleted.ID); rec.Code != http.StatusNotFound {
+		t.Errorf("restore a purged gateway: status %d, want 404", rec.Code)
+	}
+}
+
+func TestPurgeDeletedAfterRetention(t *testing.T) {
+	r, clk := newTestRegistry(t)
+	ctx := context.Background()
+	old := createGateway(t, r, "old", nil)
+	recent := createGateway(t, r, "recent", nil)
+	if err := r.Delete(ctx, old.ID); err != nil {
+		t.Fatalf("Delete old: %v", err)
+	}
+	clk.Advance(48 * time.Hour)
+	if err := r.Delete(ctx, recent.ID); err != nil {
+		t.Fatalf("Delete recent: %v", err)
+	}
+	clk.Advance(time.Hour)
+
+	r.SetDeletedRetention(24 * time.Hour)
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.Run(ctx)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for clk.Waiters() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(maxPurgeInterval)
+	for {
+		_, err := r.store.GetDeletedGateway(ctx, old.ID)
+		if errors.Is(err, store.ErrNotFound) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("gateway deleted past the retention was not purged: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if _, err := r.store.GetDeletedGateway(context.Background(), recent.ID); err != nil {
+		t.Errorf("gateway deleted within the retention was purged: %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// classifyError maps a transport error to the kind of failure it represents
+// by inspecting the wrapped error chain.
+func classifyError(err error) model.ErrorKind {
+	var (
+		dnsErr       *net.DNSError
+		netErr       net.Error
+		verifyErr    *tls.CertificateVerificationError
+		recordErr    tls.RecordHeaderError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrCircuitOpen):
+		return model.ErrorKindCircuitOpen
+	case errors.Is(err, context.DeadlineExceeded):
+		return model.ErrorKindTimeout
+	case errors.As(err, &dnsErr):
+		if dnsErr.IsTimeout {
+			return model.ErrorKindTimeout
+		}
+		return model.ErrorKindDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return model.ErrorKindConnectionRefused
+	case errors.As(err, &verifyErr), errors.As(err, &recordErr),
+		errors.As(err, &authorityErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		return model.ErrorKindTLS
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return model.ErrorKindTimeout
+	default:
+		return model.ErrorKindUnknown
+	}
+}
+
+// classifyStatus maps an unsuccessful HTTP status code to an error kind.
+func classifyStatus(code int) model.ErrorKind {
+	switch {
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return model.ErrorKindAuth
+	case code >= 500:
+		return model.ErrorKindHTTP5xx
+	case code >= 400:
+		return model.ErrorKindHTTP4xx
+	default:
+		return model.ErrorKindUnknown
+	}
+}
@@ -0,0 +1,126 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/secrets"
+	"github.com/AdamPippert/Lobstertank/internal/transport"
+)
+
+// timeoutError is a net.Error that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// urlError wraps err as the HTTP client does.
+func urlError(err error) error {
+	return &url.Error{Op: "Get", URL: "https://edge.example.com/healthz", Err: err}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want model.ErrorKind
+	}{
+		{"nil", nil, ""},
+		{"circuit open", fmt.Errorf("send: %w", &CircuitOpenError{GatewayID: "gw-1"}), model.ErrorKindCircuitOpen},
+		{"deadline", urlError(context.DeadlineExceeded), model.ErrorKindTimeout},
+		{"dns", urlError(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "edge.example.com", IsNotFound: true}}), model.ErrorKindDNS},
+		{"dns timeout", urlError(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "timeout", Name: "edge.example.com", IsTimeout: true}}), model.ErrorKindTimeout},
+		{"refused", urlError(&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}), model.ErrorKindConnectionRefused},
+		{"unknown authority", urlError(x509.UnknownAuthorityError{}), model.ErrorKindTLS},
+		{"hostname", urlError(x509.HostnameError{Host: "edge.example.com"}), model.ErrorKindTLS},
+		{"expired", urlError(x509.CertificateInvalidError{Reason: x509.Expired}), model.ErrorKindTLS},
+		{"verification", urlError(&tls.CertificateVerificationError{Err: errors.New("bad chain")}), model.ErrorKindTLS},
+		{"plain http to tls", urlError(tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}), model.ErrorKindTLS},
+		{"net timeout", urlError(&net.OpError{Op: "read", Err: timeoutError{}}), model.ErrorKindTimeout},
+		{"other", urlError(errors.New("unexpected EOF")), model.ErrorKindUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyError(tt.err); got != tt.want {
+				t.Errorf("classifyError(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyStatus(t *testing.T) {
+	tests := []struct {
+		code int
+		want model.ErrorKind
+	}{
+		{http.StatusUnauthorized, model.ErrorKindAuth},
+		{http.StatusForbidden, model.ErrorKindAuth},
+		{http.StatusNotFound, model.ErrorKindHTTP4xx},
+		{http.StatusTooManyRequests, model.ErrorKindHTTP4xx},
+		{http.StatusInternalServerError, model.ErrorKindHTTP5xx},
+		{http.StatusServiceUnavailable, model.ErrorKindHTTP5xx},
+		{http.StatusMovedPermanently, model.ErrorKindUnknown},
+	}
+	for _, tt := range tests {
+		if got := classifyStatus(tt.code); got != tt.want {
+			t.Errorf("classifyStatus(%d) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestHealthCheckErrorKind(t *testing.T) {
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	untrusted := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(untrusted.Close)
+
+	tests := []struct {
+		name       string
+		endpoint   string
+		wantStatus model.Status
+		want       model.ErrorKind
+	}{
+		{"refused", closed.URL, model.StatusOffline, model.ErrorKindConnectionRefused},
+		{"untrusted certificate", untrusted.URL, model.StatusOffline, model.ErrorKindTLS},
+		{"unauthorized", fakeGateway(t, func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}), model.StatusUnknown, model.ErrorKindAuth},
+		{"server error", fakeGateway(t, func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}), model.StatusDegraded, model.ErrorKindHTTP5xx},
+		{"healthy", fakeGateway(t, func(w http.ResponseWriter, _ *http.Request) {}), model.StatusOnline, ""},
+	}
+	sp, err := secrets.NewBuiltinProvider("")
+	if err != nil {
+		t.Fatalf("NewBuiltinProvider: %v", err)
+	}
+	cf := NewClientFactory(transport.NewProvider(config.TransportConfig{Default: "https"}), sp,
+		config.RetryConfig{}, config.BreakerConfig{}, clock.NewFake(testEpoch))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &model.Gateway{ID: "gw-1", Endpoint: tt.endpoint, Transport: model.TransportConfig{Type: "https"}}
+			res, err := cf.ClientFor(gw).HealthCheck(context.Background())
+			if err != nil {
+				t.Fatalf("HealthCheck: %v", err)
+			}
+			if res.Status != tt.wantStatus || res.ErrorKind != tt.want {
+				t.Errorf("HealthCheck = %s, %q (%s); want %s, %q", res.Status, res.ErrorKind, res.Error, tt.wantStatus, tt.want)
+			}
+		})
+	}
+}
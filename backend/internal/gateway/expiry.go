@@ -0,0 +1,20 @@
+package gateway
+
+import (
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// Expired reports whether gw has a TTL and has not been seen online within
+// it. Gateways never seen count from their enrollment.
+func (r *Registry) Expired(gw *model.Gateway) bool {
+	if gw.TTLSeconds == nil {
+		return false
+	}
+	last := gw.EnrolledAt
+	if gw.LastSeenAt != nil {
+		last = *gw.LastSeenAt
+	}
+	return r.clock.Now().After(last.Add(time.Duration(*gw.TTLSeconds) * time.Second))
+}
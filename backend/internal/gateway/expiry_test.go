@@ -0,0 +1,68 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+func TestExpiredAtExactTTL(t *testing.T) {
+	r, clk := newTestRegistry(t)
+	ctx := context.Background()
+
+	ttl := 60
+	gw, err := r.Create(ctx, model.CreateGatewayRequest{
+		Name:       "ephemeral",
+		Endpoint:   "https://ephemeral.example.com",
+		Transport:  model.TransportConfig{Type: "https"},
+		TTLSeconds: &ttl,
+	}, nil)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if !gw.EnrolledAt.Equal(testEpoch) {
+		t.Fatalf("EnrolledAt = %v, want the fake clock's %v", gw.EnrolledAt, testEpoch)
+	}
+
+	// A gateway never seen counts from enrollment.
+	clk.Advance(time.Minute)
+	if r.Expired(gw) {
+		t.Fatal("expired at exactly its TTL")
+	}
+	clk.Advance(time.Nanosecond)
+	if !r.Expired(gw) {
+		t.Fatal("not expired just past its TTL")
+	}
+
+	// Being seen online restarts the TTL.
+	if err := r.UpdateStatus(ctx, model.HealthCheckResult{GatewayID: gw.ID, Status: model.StatusOnline}); err != nil {
+		t.Fatalf("UpdateStatus: %v", err)
+	}
+	gw, err = r.Get(ctx, gw.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if want := testEpoch.Add(time.Minute + time.Nanosecond); gw.LastSeenAt == nil || !gw.LastSeenAt.Equal(want) {
+		t.Fatalf("LastSeenAt = %v, want the fake clock's %v", gw.LastSeenAt, want)
+	}
+	clk.Advance(time.Minute)
+	if r.Expired(gw) {
+		t.Fatal("expired a TTL after it was last seen, not past it")
+	}
+	clk.Advance(time.Nanosecond)
+	if !r.Expired(gw) {
+		t.Fatal("not expired past a TTL since it was last seen")
+	}
+}
+
+func TestExpiredWithoutTTL(t *testing.T) {
+	r, clk := newTestRegistry(t)
+	gw := createGateway(t, r, "forever", nil)
+
+	clk.Advance(365 * 24 * time.Hour)
+	if r.Expired(gw) {
+		t.Fatal("gateway without a TTL expired")
+	}
+}
@@ -0,0 +1,277 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/httputil"
+	"github.com/AdamPippert/Lobstertank/internal/logging"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+	"gopkg.in/yaml.v3"
+)
+
+// MaxImportBytes bounds the size of an import document.
+const MaxImportBytes = 10 << 20
+
+// Export returns every gateway the caller's organization owns as a portable
+// bundle ordered by name. Inline tokens are left out; secret refs are kept.
+func (r *Registry) Export(ctx context.Context) (*model.GatewayBundle, error) {
+	gateways, err := r.List(ctx, model.GatewayFilter{}, model.ListSort{Field: "name"})
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &model.GatewayBundle{
+		Version:  model.GatewayBundleVersion,
+		Gateways: make([]model.GatewaySpec, 0, len(gateways)),
+	}
+	for i := range gateways {
+		bundle.Gateways = append(bundle.Gateways, specFromGateway(redactGateway(&gateways[i])))
+	}
+	return bundle, nil
+}
+
+// Import creates or updates gateways in the caller's organization from a
+// bundle, matching on name, so repeating an import is a no-op. Every spec is validated before anything is
+// written; on a dry run nothing is written and the result describes what
+// would happen. Names given more than once are reported as conflicts and, on
+// a real run, abort the import.
+func (r *Registry) Import(ctx context.Context, bundle *model.GatewayBundle, dryRun bool) (*model.ImportResult, error) {
+	if bundle.Version != model.GatewayBundleVersion {
+		verr := &ValidationError{}
+		verr.add("version", "unsupported bundle version %d (expected %d)", bundle.Version, model.GatewayBundleVersion)
+		return nil, verr
+	}
+
+	result := &model.ImportResult{
+		DryRun:    dryRun,
+		Created:   []string{},
+		Updated:   []string{},
+		Unchanged: []string{},
+		Conflicts: []string{},
+	}
+
+	verr := &ValidationError{}
+	seen := make(map[string]int, len(bundle.Gateways))
+	for i := range bundle.Gateways {
+		spec := &bundle.Gateways[i]
+		if err := validateGateway(gatewayFromRequest(requestFromSpec(spec))); err != nil {
+			var specErr *ValidationError
+			if !errors.As(err, &specErr) {
+				return nil, err
+			}
+			for _, v := range specErr.Violations {
+				verr.add(fmt.Sprintf("gateways[%d].%s", i, v.Field), "%s", v.Message)
+			}
+		}
+		seen[spec.Name]++
+		if seen[spec.Name] == 2 {
+			result.Conflicts = append(result.Conflicts, spec.Name)
+		}
+	}
+	if len(verr.Violations) > 0 {
+		return nil, verr
+	}
+
+	// Plan every change before applying any of them.
+	type change struct {
+		spec     *model.GatewaySpec
+		existing *model.Gateway
+	}
+	var changes []change
+	org := callerOrg(ctx)
+	for i := range bundle.Gateways {
+		spec := &bundle.Gateways[i]
+		if seen[spec.Name] > 1 {
+			continue
+		}
+		existing, err := r.store.GetGatewayByName(ctx, org, spec.Name)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			r.checkImportedSecretRefs(verr, i, spec, nil)
+			result.Created = append(result.Created, spec.Name)
+			changes = append(changes, change{spec: spec})
+		case err != nil:
+			return nil, fmt.Errorf("look up gateway %q: %w", spec.Name, err)
+		case specsEqual(specFromGateway(existing), *spec):
+			result.Unchanged = append(result.Unchanged, spec.Name)
+		default:
+			r.checkImportedSecretRefs(verr, i, spec, existing)
+			result.Updated = append(result.Updated, spec.Name)
+			changes = append(changes, change{spec: spec, existing: existing})
+		}
+	}
+
+	if len(verr.Violations) > 0 {
+		return nil, verr
+	}
+	if dryRun || len(result.Conflicts) > 0 {
+		return result, nil
+	}
+
+	for _, c := range changes {
+		req := requestFromSpec(c.spec)
+		if c.existing == nil {
+			if _, err := r.Create(ctx, req, nil); err != nil {
+				return result, fmt.Errorf("import gateway %q: %w", c.spec.Name, err)
+			}
+			continue
+		}
+
+		labels := req.Labels
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		if _, err := r.Update(ctx, c.existing.ID, model.UpdateGatewayRequest{
+			Description: &req.Description,
+			Endpoint:    &req.Endpoint,
+			Transport:   &req.Transport,
+			Auth:        &req.Auth,
+			Labels:      labels,
+			TTLSeconds:  req.TTLSeconds,
+		}); err != nil {
+			return result, fmt.Errorf("import gateway %q: %w", c.spec.Name, err)
+		}
+	}
+
+	r.auditor.Log(ctx, audit.Event{
+		Action: "gateway.imported",
+		Detail: fmt.Sprintf("imported gateways: %d created, %d updated, %d unchanged",
+			len(result.Created), len(result.Updated), len(result.Unchanged)),
+	})
+	return result, nil
+}
+
+// checkImportedSecretRefs adds to verr the secret refs the i-th gateway of
+// an import may not name. existing is the gateway it updates, or nil when it
+// creates one.
+func (r *Registry) checkImportedSecretRefs(verr *ValidationError, i int, spec *model.GatewaySpec, existing *model.Gateway) {
+	gw := gatewayFromRequest(requestFromSpec(spec))
+	var prev model.GatewayAuthConfig
+	if existing != nil {
+		gw.ID, prev = existing.ID, existing.Auth
+	}
+	var refErr *ValidationError
+	if errors.As(r.checkSecretRefs(gw, prev), &refErr) {
+		for _, v := range refErr.Violations {
+			verr.add(fmt.Sprintf("gateways[%d].%s", i, v.Field), "%s", v.Message)
+		}
+	}
+}
+
+// specFromGateway extracts the user-supplied configuration of a gateway.
+func specFromGateway(gw *model.Gateway) model.GatewaySpec {
+	return model.GatewaySpec{
+		Name:        gw.Name,
+		Description: gw.Description,
+		Endpoint:    gw.Endpoint,
+		Transport:   gw.Transport,
+		Auth:        gw.Auth,
+		Labels:      gw.Labels,
+		TTLSeconds:  gw.TTLSeconds,
+	}
+}
+
+func requestFromSpec(spec *model.GatewaySpec) model.CreateGatewayRequest {
+	return model.CreateGatewayRequest{
+		Name:        spec.Name,
+		Description: spec.Description,
+		Endpoint:    spec.Endpoint,
+		Transport:   spec.Transport,
+		Auth:        spec.Auth,
+		Labels:      spec.Labels,
+		TTLSeconds:  spec.TTLSeconds,
+	}
+}
+
+// specsEqual compares two specs, treating nil and empty maps as equal.
+func specsEqual(a, b model.GatewaySpec) bool {
+	for _, spec := range []*model.GatewaySpec{&a, &b} {
+		spec.Transport.Params = nilIfEmpty(spec.Transport.Params)
+		spec.Auth.Params = nilIfEmpty(spec.Auth.Params)
+		spec.Labels = nilIfEmpty(spec.Labels)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func nilIfEmpty(m map[string]string) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	return maps.Clone(m)
+}
+
+// Export handles GET /api/v1/gateways/export.
+func (h *Handler) Export(w http.ResponseWriter, r *http.Request) {
+	bundle, err := h.registry.Export(r.Context())
+	if err != nil {
+		httputil.WriteError(w, r, http.StatusInternalServerError, "failed to export gateways", err)
+		return
+	}
+
+	out, err := yaml.Marshal(bundle)
+	if err != nil {
+		httputil.WriteError(w, r, http.StatusInternalServerError, "failed to encode export", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Header().Set("Content-Disposition", `attachment; filename="gateways.yaml"`)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(out); err != nil {
+		logging.LoggerFromContext(r.Context()).Error("failed to write gateway export", "error", err)
+	}
+}
+
+// Import handles POST /api/v1/gateways/import. The body is a YAML (or JSON)
+// bundle as produced by Export.
+func (h *Handler) Import(w http.ResponseWriter, r *http.Request) {
+	var dryRun bool
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			httputil.WriteError(w, r, http.StatusBadRequest, "invalid dry_run parameter", err)
+			return
+		}
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxImportBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			httputil.WriteError(w, r, http.StatusRequestEntityTooLarge, "import document too large", err)
+			return
+		}
+		httputil.WriteError(w, r, http.StatusBadRequest, "failed to read request body", err)
+		return
+	}
+
+	var bundle model.GatewayBundle
+	dec := yaml.NewDecoder(bytes.NewReader(body))
+	dec.KnownFields(true) // catch misspelled keys instead of dropping them
+	if err := dec.Decode(&bundle); err != nil {
+		httputil.WriteError(w, r, http.StatusBadRequest, "invalid import document", err)
+		return
+	}
+
+	result, err := h.registry.Import(r.Context(), &bundle, dryRun)
+	if err != nil {
+		writeRegistryError(w, r, "failed to import gateways", err)
+		return
+	}
+
+	status := http.StatusOK
+	if len(result.Conflicts) > 0 && !dryRun {
+		status = http.StatusConflict
+	}
+	httputil.WriteJSON(w, status, result)
+}
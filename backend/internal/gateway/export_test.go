@@ -0,0 +1,193 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"gopkg.in/yaml.v3"
+)
+
+// exportFixture registers gateways covering every field of a spec.
+func exportFixture(t *testing.T, r *Registry) {
+	t.Helper()
+	ttl := 300
+	for _, req := range []model.CreateGatewayRequest{
+		{
+			Name:        "edge",
+			Description: "edge gateway",
+			Endpoint:    "https://edge.example.com",
+			Transport:   model.TransportConfig{Type: "cloudflare", Params: map[string]string{"client_id": "edge"}},
+			Auth:        model.GatewayAuthConfig{Type: "token", SecretRef: "vault://lt/edge-token"},
+			Labels:      map[string]string{"env": "prod", "region": "us-east"},
+			TTLSeconds:  &ttl,
+		},
+		{
+			Name:      "core",
+			Endpoint:  "https://core.example.com",
+			Transport: model.TransportConfig{Type: "https"},
+			Auth:      model.GatewayAuthConfig{Type: "token", Params: map[string]string{"token": "s3cr3t"}},
+		},
+	} {
+		if _, err := r.Create(context.Background(), req, nil); err != nil {
+			t.Fatalf("Create %s: %v", req.Name, err)
+		}
+	}
+}
+
+// importBundle posts doc to the import endpoint.
+func importBundle(t *testing.T, h *Handler, doc []byte, dryRun bool) (int, model.ImportResult) {
+	t.Helper()
+	target := "/api/v1/gateways/import"
+	if dryRun {
+		target += "?dry_run=true"
+	}
+	rec := httptest.NewRecorder()
+	h.Import(rec, httptest.NewRequest(http.MethodPost, target, bytes.NewReader(doc)))
+	var result model.ImportResult
+	if rec.Code == http.StatusOK || rec.Code == http.StatusConflict {
+		if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+			t.Fatalf("decode import result: %v", err)
+		}
+	}
+	return rec.Code, result
+}
+
+func TestBundleYAMLRoundTrip(t *testing.T) {
+	ttl := 60
+	want := model.GatewayBundle{Version: model.GatewayBundleVersion, Gateways: []model.GatewaySpec{
+		{
+			Name:        "edge",
+			Description: "edge gateway",
+			Endpoint:    "https://edge.example.com",
+			Transport:   model.TransportConfig{Type: "tailscale", Params: map[string]string{"tailnet": "example.ts.net"}},
+			Auth:        model.GatewayAuthConfig{Type: "mtls", SecretRef: "vault://lt/edge-cert", Params: map[string]string{"key_ref": "vault://lt/edge-key"}},
+			Labels:      map[string]string{"env": "prod"},
+			TTLSeconds:  &ttl,
+		},
+		{Name: "bare", Endpoint: "https://bare.example.com", Transport: model.TransportConfig{Type: "https"}},
+	}}
+
+	out, err := yaml.Marshal(want)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var got model.GatewayBundle
+	dec := yaml.NewDecoder(bytes.NewReader(out))
+	dec.KnownFields(true)
+	if err := dec.Decode(&got); err != nil {
+		t.Fatalf("Decode:\n%s\n%v", out, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip =\n%+v\nwant\n%+v", got, want)
+	}
+	for _, omitted := range []string{"description: \"\"", "labels: {}", "ttl_seconds: null"} {
+		if bytes.Contains(out, []byte(omitted)) {
+			t.Errorf("document carries empty field %q:\n%s", omitted, out)
+		}
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	src, _ := newTestRegistry(t)
+	exportFixture(t, src)
+
+	rec := httptest.NewRecorder()
+	newTestHandler(t, src).Export(rec, httptest.NewRequest(http.MethodGet, "/api/v1/gateways/export", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/yaml" {
+		t.Fatalf("export: status %d, Content-Type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	doc := rec.Body.Bytes()
+	if bytes.Contains(doc, []byte("s3cr3t")) {
+		t.Fatalf("export leaks an inline token:\n%s", doc)
+	}
+	if !bytes.Contains(doc, []byte("secret_ref: vault://lt/edge-token")) {
+		t.Errorf("export dropped the secret ref:\n%s", doc)
+	}
+
+	// core's sealed token belongs to the source instance, so it is dropped
+	// before the document is reused.
+	var bundle model.GatewayBundle
+	if err := yaml.Unmarshal(doc, &bundle); err != nil {
+		t.Fatalf("decode export: %v", err)
+	}
+	if names := []string{bundle.Gateways[0].Name, bundle.Gateways[1].Name}; !slices.Equal(names, []string{"core", "edge"}) {
+		t.Errorf("exported %v, want gateways ordered by name", names)
+	}
+	bundle.Gateways[0].Auth = model.GatewayAuthConfig{}
+	doc, _ = yaml.Marshal(bundle)
+
+	dst, _ := newTestRegistry(t)
+	h := newTestHandler(t, dst)
+	ctx := context.Background()
+
+	code, result := importBundle(t, h, doc, true)
+	if code != http.StatusOK || !result.DryRun || len(result.Created) != 2 {
+		t.Errorf("dry run: status %d, result %+v; want both gateways to be created", code, result)
+	}
+	if gws, _ := dst.List(ctx, model.GatewayFilter{}, model.ListSort{}); len(gws) != 0 {
+		t.Fatalf("dry run registered %d gateways", len(gws))
+	}
+
+	if code, result = importBundle(t, h, doc, false); code != http.StatusOK || !slices.Equal(result.Created, []string{"core", "edge"}) {
+		t.Fatalf("import: status %d, result %+v; want core and edge created", code, result)
+	}
+	for _, spec := range bundle.Gateways {
+		gw, err := dst.store.GetGatewayByName(ctx, "", spec.Name)
+		if err != nil {
+			t.Fatalf("GetGatewayByName %s: %v", spec.Name, err)
+		}
+		if !specsEqual(specFromGateway(gw), spec) {
+			t.Errorf("imported %s = %+v, want %+v", spec.Name, specFromGateway(gw), spec)
+		}
+	}
+
+	if code, result = importBundle(t, h, doc, false); code != http.StatusOK || len(result.Unchanged) != 2 || len(result.Created)+len(result.Updated) != 0 {
+		t.Errorf("repeated import: status %d, result %+v; want everything unchanged", code, result)
+	}
+
+	bundle.Gateways[1].Labels["env"] = "staging"
+	doc, _ = yaml.Marshal(bundle)
+	if code, result = importBundle(t, h, doc, false); code != http.StatusOK || !slices.Equal(result.Updated, []string{"edge"}) {
+		t.Errorf("changed import: status %d, result %+v; want edge updated", code, result)
+	}
+	if gw, _ := dst.store.GetGatewayByName(ctx, "", "edge"); gw.Labels["env"] != "staging" {
+		t.Errorf("edge labels = %v after update", gw.Labels)
+	}
+}
+
+func TestImportRejects(t *testing.T) {
+	tests := []struct {
+		name       string
+		doc        string
+		wantStatus int
+		wantBody   string
+	}{
+		{"unknown field", "version: 1\ngateways:\n  - name: a\n    endpiont: https://a.example.com\n", http.StatusBadRequest, "invalid import document"},
+		{"wrong version", "version: 2\ngateways: []\n", http.StatusBadRequest, "version"},
+		{"invalid spec", "version: 1\ngateways:\n  - name: a\n    endpoint: not a url\n    transport: {type: https}\n", http.StatusBadRequest, "gateways[0]"},
+		{"duplicate names", "version: 1\ngateways:\n" +
+			"  - {name: a, endpoint: https://a.example.com, transport: {type: https}}\n" +
+			"  - {name: a, endpoint: https://b.example.com, transport: {type: https}}\n", http.StatusConflict, `"conflicts":["a"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newTestRegistry(t)
+			rec := httptest.NewRecorder()
+			newTestHandler(t, r).Import(rec, httptest.NewRequest(http.MethodPost, "/api/v1/gateways/import", strings.NewReader(tt.doc)))
+			if rec.Code != tt.wantStatus || !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("status = %d, body %s; want %d mentioning %q", rec.Code, rec.Body, tt.wantStatus, tt.wantBody)
+			}
+			if gws, _ := r.List(context.Background(), model.GatewayFilter{}, model.ListSort{}); len(gws) != 0 {
+				t.Errorf("rejected import registered %d gateways", len(gws))
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+)
+
+// gatewayIDs returns the IDs of gateways, in order.
+func gatewayIDs(gateways []model.Gateway) []string {
+	ids := make([]string, len(gateways))
+	for i, gw := range gateways {
+		ids[i] = gw.ID
+	}
+	return ids
+}
+
+func TestGetMany(t *testing.T) {
+	r, cs, _ := newCachingRegistry(t, 0)
+	a := createGateway(t, r, "alpha", nil).ID
+	b := createGateway(t, r, "bravo", nil).ID
+	c := createGateway(t, r, "charlie", nil).ID
+
+	tests := []struct {
+		name    string
+		ids     []string
+		want    []string
+		wantErr string
+	}{
+		{"requested order", []string{c, a, b}, []string{c, a, b}, ""},
+		{"repeats dropped", []string{b, a, b, b}, []string{b, a}, ""},
+		{"empty", nil, []string{}, ""},
+		{"one missing", []string{a, "gw-x"}, nil, "gateways not found: gw-x"},
+		{"every missing named", []string{"gw-y", a, "gw-x", "gw-y"}, nil, "gateways not found: gw-y, gw-x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := cs.reads.Load()
+			got, err := r.GetMany(context.Background(), tt.ids)
+			if tt.wantErr != "" {
+				if !errors.Is(err, store.ErrNotFound) || !strings.HasSuffix(err.Error(), ": "+tt.wantErr) {
+					t.Errorf("GetMany: got %v, want ErrNotFound %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetMany: %v", err)
+			}
+			if ids := gatewayIDs(got); !slices.Equal(ids, tt.want) {
+				t.Errorf("GetMany = %v, want %v", ids, tt.want)
+			}
+			if n, want := cs.reads.Load()-before, min(len(tt.ids), 1); n != int32(want) {
+				t.Errorf("GetMany made %d store reads, want %d", n, want)
+			}
+		})
+	}
+}
+
+func TestGetManyReadsOnce(t *testing.T) {
+	r, cs, clk := newCachingRegistry(t, time.Minute)
+	ids := make([]string, 100)
+	for i := range ids {
+		ids[i] = createGateway(t, r, fmt.Sprintf("gw-%03d", i), nil).ID
+	}
+	ctx := context.Background()
+
+	cs.reads.Store(0)
+	if _, err := r.GetMany(ctx, ids); err != nil {
+		t.Fatalf("GetMany: %v", err)
+	}
+	if n := cs.reads.Load(); n != 1 {
+		t.Errorf("resolving %d gateways made %d store reads, want 1", len(ids), n)
+	}
+
+	// Cached gateways are not read again, and once some expire they are
+	// read back together in one query.
+	if _, err := r.GetMany(ctx, ids); err != nil {
+		t.Fatalf("GetMany: %v", err)
+	}
+	if n := cs.reads.Load(); n != 1 {
+		t.Errorf("cached gateways made %d more store reads", n-1)
+	}
+	clk.Advance(time.Minute)
+	if _, err := r.Get(ctx, ids[0]); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	cs.reads.Store(0)
+	got, err := r.GetMany(ctx, ids)
+	if err != nil {
+		t.Fatalf("GetMany: %v", err)
+	}
+	if n := cs.reads.Load(); n != 1 || !slices.Equal(gatewayIDs(got), ids) {
+		t.Errorf("after expiry: %d store reads, order kept %v; want 1 read in order", n, slices.Equal(gatewayIDs(got), ids))
+	}
+}
+
+func TestGetManyForbidden(t *testing.T) {
+	r, _, _ := newCachingRegistry(t, 0)
+	acme := createOrgGateway(t, r, "acme", "acme-edge")
+	initech := createOrgGateway(t, r, "initech", "initech-edge")
+
+	if _, err := r.GetMany(orgContext("acme"), []string{acme.ID, initech.ID}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("GetMany across orgs: got %v, want ErrForbidden", err)
+	}
+	if got, err := r.GetMany(orgContext("acme"), []string{acme.ID}); err != nil || len(got) != 1 {
+		t.Errorf("GetMany in org = %v, %v; want the acme gateway", got, err)
+	}
+}
+
+func BenchmarkGetMany(b *testing.B) {
+	r, _, _ := newCachingRegistry(b, 0)
+	ids := make([]string, 100)
+	for i := range ids {
+		ids[i] = createGateway(b, r, fmt.Sprintf("gw-%03d", i), nil).ID
+	}
+	ctx := context.Background()
+	for b.Loop() {
+		if _, err := r.GetMany(ctx, ids); err != nil {
+			b.Fatalf("GetMany: %v", err)
+		}
+	}
+}
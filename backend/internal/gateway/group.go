@@ -0,0 +1,273 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/httputil"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+	"github.com/google/uuid"
+)
+
+// ErrGroupNameConflict is returned when a group name is already registered.
+var ErrGroupNameConflict = errors.New("group name already in use")
+
+// ListGroups returns the gateway groups the caller's organization owns.
+func (r *Registry) ListGroups(ctx context.Context) ([]model.Group, error) {
+	groups, err := r.store.ListGroups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list groups: %w", err)
+	}
+	matched := groups[:0]
+	for _, g := range groups {
+		if inCallerOrg(ctx, g.OrgID) {
+			matched = append(matched, g)
+		}
+	}
+	return matched, nil
+}
+
+// GetGroup returns a single group by ID. It fails with ErrForbidden when
+// another organization owns the group.
+func (r *Registry) GetGroup(ctx context.Context, id string) (*model.Group, error) {
+	g, err := r.store.GetGroup(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("get group %s: %w", id, err)
+	}
+	if !inCallerOrg(ctx, g.OrgID) {
+		return nil, fmt.Errorf("%w: group %s", ErrForbidden, id)
+	}
+	return g, nil
+}
+
+// CreateGroup creates a named group of existing gateways, in the requested
+// organization or else the caller's.
+func (r *Registry) CreateGroup(ctx context.Context, req model.CreateGroupRequest) (*model.Group, error) {
+	org, ok := ownerOrg(ctx, req.OrgID)
+	if !ok {
+		return nil, fmt.Errorf("%w: cannot create a group in organization %q", ErrForbidden, req.OrgID)
+	}
+	g := &model.Group{
+		ID:          uuid.New().String(),
+		Name:        req.Name,
+		Description: req.Description,
+		GatewayIDs:  dedupe(req.GatewayIDs),
+		CreatedAt:   r.clock.Now().UTC(),
+		OrgID:       org,
+	}
+
+	if err := r.validateGroup(ctx, g); err != nil {
+		return nil, err
+	}
+
+	if err := r.store.CreateGroup(ctx, g); err != nil {
+		if errors.Is(err, store.ErrGroupConflict) {
+			return nil, fmt.Errorf("%w: %s", ErrGroupNameConflict, g.Name)
+		}
+		return nil, fmt.Errorf("create group: %w", err)
+	}
+
+	r.auditor.Log(ctx, audit.Event{
+		Action:   "group.created",
+		Resource: g.ID,
+		Detail:   fmt.Sprintf("created group %q with %d gateways", g.Name, len(g.GatewayIDs)),
+	})
+	return g, nil
+}
+
+// UpdateGroup modifies a group's name, description, or membership.
+func (r *Registry) UpdateGroup(ctx context.Context, id string, req model.UpdateGroupRequest) (*model.Group, error) {
+	g, err := r.GetGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		g.Name = *req.Name
+	}
+	if req.Description != nil {
+		g.Description = *req.Description
+	}
+	if req.GatewayIDs != nil {
+		g.GatewayIDs = dedupe(req.GatewayIDs)
+	}
+
+	if err := r.validateGroup(ctx, g); err != nil {
+		return nil, err
+	}
+
+	if err := r.store.UpdateGroup(ctx, g); err != nil {
+		if errors.Is(err, store.ErrGroupConflict) {
+			return nil, fmt.Errorf("%w: %s", ErrGroupNameConflict, g.Name)
+		}
+		return nil, fmt.Errorf("update group %s: %w", id, err)
+	}
+
+	r.auditor.Log(ctx, audit.Event{
+		Action:   "group.updated",
+		Resource: g.ID,
+		Detail:   fmt.Sprintf("updated group %q with %d gateways", g.Name, len(g.GatewayIDs)),
+	})
+	return g, nil
+}
+
+// DeleteGroup removes a group. Member gateways are unaffected.
+func (r *Registry) DeleteGroup(ctx context.Context, id string) error {
+	if _, err := r.GetGroup(ctx, id); err != nil {
+		return err
+	}
+	if err := r.store.DeleteGroup(ctx, id); err != nil {
+		return fmt.Errorf("delete group %s: %w", id, err)
+	}
+
+	r.auditor.Log(ctx, audit.Event{
+		Action:   "group.deleted",
+		Resource: id,
+		Detail:   "group deleted",
+	})
+	return nil
+}
+
+// ResolveGroup returns the member gateways of a group.
+func (r *Registry) ResolveGroup(ctx context.Context, id string) ([]model.Gateway, error) {
+	g, err := r.GetGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := r.getMany(ctx, g.GatewayIDs)
+	if err != nil {
+		return nil, err
+	}
+	gateways := make([]model.Gateway, 0, len(members))
+	for _, gw := range members {
+		if visible(ctx, &gw) { // members in other organizations are not the caller's to use
+			gateways = append(gateways, gw)
+		}
+	}
+	return gateways, nil
+}
+
+// validateGroup checks the group name and that every member exists in the
+// group's organization. Gateways the caller cannot see are reported as
+// unknown, like missing ones, so as not to reveal them.
+func (r *Registry) validateGroup(ctx context.Context, g *model.Group) error {
+	verr := &ValidationError{}
+	if strings.TrimSpace(g.Name) == "" {
+		verr.add("name", "is required")
+	}
+	found, _, err := r.store.ListGatewaysByIDs(ctx, g.GatewayIDs)
+	if err != nil {
+		return fmt.Errorf("look up group members: %w", err)
+	}
+	known := make(map[string]bool, len(found))
+	for i := range found {
+		known[found[i].ID] = visible(ctx, &found[i]) && (g.OrgID == "" || found[i].OrgID == g.OrgID)
+	}
+	for _, gwID := range g.GatewayIDs {
+		if !known[gwID] {
+			verr.add("gateway_ids", "unknown gateway %s", gwID)
+		}
+	}
+	if len(verr.Violations) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// dedupe returns ids without duplicates, preserving first-seen order.
+func dedupe(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// ListGroups handles GET /api/v1/groups.
+func (h *Handler) ListGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.registry.ListGroups(r.Context())
+	if err != nil {
+		httputil.WriteError(w, r, http.StatusInternalServerError, "failed to list groups", err)
+		return
+	}
+	httputil.WriteJSON(w, http.StatusOK, groups)
+}
+
+// CreateGroup handles POST /api/v1/groups.
+func (h *Handler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	var req model.CreateGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.WriteBodyError(w, r, err)
+		return
+	}
+
+	g, err := h.registry.CreateGroup(r.Context(), req)
+	if err != nil {
+		writeGroupError(w, r, "failed to create group", err)
+		return
+	}
+	httputil.WriteJSON(w, http.StatusCreated, g)
+}
+
+// GetGroup handles GET /api/v1/groups/{id}.
+func (h *Handler) GetGroup(w http.ResponseWriter, r *http.Request) {
+	g, err := h.registry.GetGroup(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeGroupError(w, r, "failed to get group", err)
+		return
+	}
+	httputil.WriteJSON(w, http.StatusOK, g)
+}
+
+// UpdateGroup handles PUT /api/v1/groups/{id}.
+func (h *Handler) UpdateGroup(w http.ResponseWriter, r *http.Request) {
+	var req model.UpdateGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.WriteBodyError(w, r, err)
+		return
+	}
+
+	g, err := h.registry.UpdateGroup(r.Context(), r.PathValue("id"), req)
+	if err != nil {
+		writeGroupError(w, r, "failed to update group", err)
+		return
+	}
+	httputil.WriteJSON(w, http.StatusOK, g)
+}
+
+// DeleteGroup handles DELETE /api/v1/groups/{id}.
+func (h *Handler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	if err := h.registry.DeleteGroup(r.Context(), r.PathValue("id")); err != nil {
+		writeGroupError(w, r, "failed to delete group", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeGroupError maps group registry errors onto HTTP status codes.
+func writeGroupError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	var verr *ValidationError
+	switch {
+	case errors.As(err, &verr):
+		writeValidationError(w, verr)
+	case errors.Is(err, ErrGroupNameConflict):
+		httputil.WriteJSON(w, http.StatusConflict, httputil.ErrorResponse{Error: "group name already in use", Message: err.Error()})
+	case errors.Is(err, store.ErrGroupNotFound):
+		httputil.WriteError(w, r, http.StatusNotFound, "group not found", err)
+	case errors.Is(err, ErrForbidden):
+		httputil.WriteError(w, r, http.StatusForbidden, "forbidden", err)
+	default:
+		httputil.WriteError(w, r, http.StatusInternalServerError, msg, err)
+	}
+}
@@ -0,0 +1,202 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/AdamPippert/Lobstertank/internal/auth"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// orgContext returns a context carrying a principal scoped to org.
+func orgContext(org string) context.Context {
+	return auth.ContextWithPrincipal(context.Background(), &auth.Principal{Subject: org + "-admin", Roles: []string{"admin"}, Org: org})
+}
+
+// createOrgGateway registers a gateway named name as a caller in org.
+func createOrgGateway(t *testing.T, r *Registry, org, name string) *model.Gateway {
+	t.Helper()
+	gw, err := r.Create(orgContext(org), model.CreateGatewayRequest{
+		Name:      name,
+		Endpoint:  "https://" + name + ".example.com",
+		Transport: model.TransportConfig{Type: "https"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Create %s: %v", name, err)
+	}
+	return gw
+}
+
+// sameMembers reports whether two member lists hold the same IDs; the store
+// does not keep their order.
+func sameMembers(a, b []string) bool {
+	return slices.Equal(slices.Sorted(slices.Values(a)), slices.Sorted(slices.Values(b)))
+}
+
+// violations returns the messages of err's violations of field, or nil when
+// err is not a validation error.
+func violations(err error, field string) []string {
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		return nil
+	}
+	var msgs []string
+	for _, v := range verr.Violations {
+		if v.Field == field {
+			msgs = append(msgs, v.Message)
+		}
+	}
+	return msgs
+}
+
+func TestCreateGroup(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	ctx := context.Background()
+	a := createGateway(t, r, "alpha", nil).ID
+	b := createGateway(t, r, "bravo", nil).ID
+	if _, err := r.CreateGroup(ctx, model.CreateGroupRequest{Name: "taken"}); err != nil {
+		t.Fatalf("CreateGroup taken: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		req         model.CreateGroupRequest
+		wantMembers []string
+		wantErr     error
+		wantInvalid []string // gateway_ids violations
+	}{
+		{"members", model.CreateGroupRequest{Name: "fleet", GatewayIDs: []string{b, a}}, []string{a, b}, nil, nil},
+		{"repeats dropped", model.CreateGroupRequest{Name: "twice", GatewayIDs: []string{a, a, b}}, []string{a, b}, nil, nil},
+		{"empty", model.CreateGroupRequest{Name: "empty"}, []string{}, nil, nil},
+		{"unknown gateway", model.CreateGroupRequest{Name: "ghost", GatewayIDs: []string{a, "gw-x"}}, nil, nil,
+			[]string{"unknown gateway gw-x"}},
+		{"name taken", model.CreateGroupRequest{Name: "taken"}, nil, ErrGroupNameConflict, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := r.CreateGroup(ctx, tt.req)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("CreateGroup: got %v, want %v", err, tt.wantErr)
+				}
+				return
+			case tt.wantInvalid != nil:
+				if got := violations(err, "gateway_ids"); !slices.Equal(got, tt.wantInvalid) {
+					t.Errorf("CreateGroup violations = %v (err %v), want %v", got, err, tt.wantInvalid)
+				}
+				return
+			case err != nil:
+				t.Fatalf("CreateGroup: %v", err)
+			}
+			stored, err := r.GetGroup(ctx, g.ID)
+			if err != nil {
+				t.Fatalf("GetGroup: %v", err)
+			}
+			if stored.Name != tt.req.Name || !sameMembers(stored.GatewayIDs, tt.wantMembers) {
+				t.Errorf("stored group %q has %v, want %q with %v", stored.Name, stored.GatewayIDs, tt.req.Name, tt.wantMembers)
+			}
+		})
+	}
+}
+
+func TestUpdateGroupMembers(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	ctx := context.Background()
+	a := createGateway(t, r, "alpha", nil).ID
+	b := createGateway(t, r, "bravo", nil).ID
+	c := createGateway(t, r, "charlie", nil).ID
+
+	tests := []struct {
+		name        string
+		members     []string
+		wantMembers []string
+		wantInvalid []string
+	}{
+		{"add", []string{a, b, c}, []string{a, b, c}, nil},
+		{"remove", []string{a}, []string{a}, nil},
+		{"remove all", []string{}, []string{}, nil},
+		{"unknown gateway", []string{a, "gw-x", "gw-y"}, []string{a, b}, []string{"unknown gateway gw-x", "unknown gateway gw-y"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := r.CreateGroup(ctx, model.CreateGroupRequest{Name: tt.name, GatewayIDs: []string{a, b}})
+			if err != nil {
+				t.Fatalf("CreateGroup: %v", err)
+			}
+			_, err = r.UpdateGroup(ctx, g.ID, model.UpdateGroupRequest{GatewayIDs: tt.members})
+			if got := violations(err, "gateway_ids"); !slices.Equal(got, tt.wantInvalid) {
+				t.Errorf("UpdateGroup violations = %v (err %v), want %v", got, err, tt.wantInvalid)
+			}
+			if tt.wantInvalid == nil && err != nil {
+				t.Fatalf("UpdateGroup: %v", err)
+			}
+
+			members, err := r.ResolveGroup(ctx, g.ID)
+			if err != nil {
+				t.Fatalf("ResolveGroup: %v", err)
+			}
+			if ids := gatewayIDs(members); !sameMembers(ids, tt.wantMembers) {
+				t.Errorf("members = %v, want %v", ids, tt.wantMembers)
+			}
+		})
+	}
+}
+
+func TestGroupsScopedToOrg(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	acme, initech := orgContext("acme"), orgContext("initech")
+	acmeGW := createOrgGateway(t, r, "acme", "acme-edge")
+	initechGW := createOrgGateway(t, r, "initech", "initech-edge")
+
+	g, err := r.CreateGroup(acme, model.CreateGroupRequest{Name: "fleet", GatewayIDs: []string{acmeGW.ID}})
+	if err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+	if g.OrgID != "acme" {
+		t.Errorf("group org = %q, want the caller's", g.OrgID)
+	}
+
+	// Another organization's gateways are unknown, not merely off limits.
+	var verr *ValidationError
+	_, err = r.CreateGroup(acme, model.CreateGroupRequest{Name: "mixed", GatewayIDs: []string{acmeGW.ID, initechGW.ID}})
+	if !errors.As(err, &verr) || len(verr.Violations) != 1 || verr.Violations[0].Message != "unknown gateway "+initechGW.ID {
+		t.Errorf("group with another org's gateway: err = %v, want it reported unknown", err)
+	}
+	// Unscoped callers can see every gateway, but a group's members stay in
+	// its organization.
+	ids := []string{acmeGW.ID, initechGW.ID}
+	if _, err := r.UpdateGroup(context.Background(), g.ID, model.UpdateGroupRequest{GatewayIDs: ids}); !errors.As(err, &verr) {
+		t.Errorf("unscoped update adding another org's gateway: err = %v, want a validation error", err)
+	}
+	if _, err := r.CreateGroup(acme, model.CreateGroupRequest{Name: "theirs", OrgID: "initech"}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("group in another org: err = %v, want ErrForbidden", err)
+	}
+
+	groups, err := r.ListGroups(initech)
+	if err != nil || len(groups) != 0 {
+		t.Errorf("initech ListGroups = %+v, %v; want none", groups, err)
+	}
+	if groups, err := r.ListGroups(context.Background()); err != nil || len(groups) != 1 {
+		t.Errorf("unscoped ListGroups = %+v, %v; want fleet", groups, err)
+	}
+	name := "renamed"
+	for op, call := range map[string]func() error{
+		"get":     func() error { _, err := r.GetGroup(initech, g.ID); return err },
+		"resolve": func() error { _, err := r.ResolveGroup(initech, g.ID); return err },
+		"update": func() error {
+			_, err := r.UpdateGroup(initech, g.ID, model.UpdateGroupRequest{Name: &name})
+			return err
+		},
+		"delete": func() error { return r.DeleteGroup(initech, g.ID) },
+	} {
+		if err := call(); !errors.Is(err, ErrForbidden) {
+			t.Errorf("initech %s: err = %v, want ErrForbidden", op, err)
+		}
+	}
+	if got, err := r.GetGroup(acme, g.ID); err != nil || got.Name != "fleet" {
+		t.Errorf("group after refused writes = %+v, %v; want fleet unchanged", got, err)
+	}
+}
@@ -1,56 +1,142 @@
 package gateway
 
 import (
+	"context"
 	"encoding/json"
-	"log/slog"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/httputil"
+	"github.com/AdamPippert/Lobstertank/internal/logging"
 	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/store"
 )
 
 // Handler exposes gateway CRUD operations over HTTP.
 type Handler struct {
 	registry      *Registry
 	clientFactory *ClientFactory
+	prober        *Prober
 	auditor       *audit.Logger
+	prompt        config.PromptConfig
 }
 
 // NewHandler constructs a gateway HTTP handler.
-func NewHandler(r *Registry, cf *ClientFactory, a *audit.Logger) *Handler {
-	return &Handler{registry: r, clientFactory: cf, auditor: a}
+func NewHandler(r *Registry, cf *ClientFactory, p *Prober, a *audit.Logger, pc config.PromptConfig) *Handler {
+	return &Handler{registry: r, clientFactory: cf, prober: p, auditor: a, prompt: pc}
 }
 
 // List handles GET /api/v1/gateways.
 func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
-	gateways, err := h.registry.List(r.Context())
+	filter, err := parseFilter(r)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to list gateways", err)
+		httputil.WriteError(w, r, http.StatusBadRequest, "invalid filter", err)
 		return
 	}
-	writeJSON(w, http.StatusOK, gateways)
+
+	sort, err := model.ParseListSort(r.URL.Query().Get("sort"), r.URL.Query().Get("order"))
+	if err != nil {
+		httputil.WriteError(w, r, http.StatusBadRequest, "invalid sort", err)
+		return
+	}
+
+	deleted, err := queryBool(r, "deleted")
+	if err != nil {
+		httputil.WriteError(w, r, http.StatusBadRequest, "invalid deleted parameter", err)
+		return
+	}
+
+	list := h.registry.List
+	if deleted {
+		list = h.registry.ListDeleted
+	}
+	gateways, err := list(r.Context(), filter, sort)
+	if err != nil {
+		httputil.WriteError(w, r, http.StatusInternalServerError, "failed to list gateways", err)
+		return
+	}
+	for i := range gateways {
+		gateways[i] = *redactGateway(&gateways[i])
+	}
+	httputil.WriteJSON(w, http.StatusOK, gateways)
 }
 
 // Create handles POST /api/v1/gateways.
 func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 	var req model.CreateGatewayRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid request body", err)
+		httputil.WriteBodyError(w, r, err)
 		return
 	}
 
-	if req.Name == "" || req.Endpoint == "" {
-		writeError(w, http.StatusBadRequest, "name and endpoint are required", nil)
-		return
+	if v := r.URL.Query().Get("probe"); v != "" {
+		probe, err := strconv.ParseBool(v)
+		if err != nil {
+			httputil.WriteError(w, r, http.StatusBadRequest, "invalid probe parameter", err)
+			return
+		}
+		req.Probe = req.Probe || probe
+	}
+
+	// A repeated create with a known key returns the original gateway
+	// without probing again.
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if key != "" {
+		if err := validateIdempotencyKey(key); err != nil {
+			writeRegistryError(w, r, "failed to create gateway", err)
+			return
+		}
+		if h.replayCreate(w, r, key) {
+			return
+		}
+	}
+
+	var initial *model.HealthCheckResult
+	if req.Probe || req.RequireReachable {
+		draft := gatewayFromRequest(req)
+		if err := validateGateway(draft); err != nil {
+			writeRegistryError(w, r, "failed to create gateway", err)
+			return
+		}
+
+		result := h.prober.Check(r.Context(), draft)
+		if req.RequireReachable && result.Status != model.StatusOnline {
+			httputil.WriteJSON(w, http.StatusUnprocessableEntity, httputil.ErrorResponse{
+				Error:   "gateway unreachable",
+				Message: fmt.Sprintf("probe returned %s: %s", result.Status, result.Error),
+			})
+			return
+		}
+		initial = &result
 	}
 
-	gw, err := h.registry.Create(r.Context(), req)
+	var (
+		gw      *model.Gateway
+		created = true
+		err     error
+	)
+	if key != "" {
+		gw, created, err = h.registry.CreateIdempotent(r.Context(), key, req, initial)
+	} else {
+		gw, err = h.registry.Create(r.Context(), req, initial)
+	}
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to create gateway", err)
+		writeRegistryError(w, r, "failed to create gateway", err)
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, gw)
+	if !created {
+		httputil.WriteJSON(w, http.StatusOK, redactGateway(gw))
+		return
+	}
+	httputil.WriteJSON(w, http.StatusCreated, redactGateway(gw))
 }
 
 // Get handles GET /api/v1/gateways/{id}.
@@ -58,10 +144,10 @@ func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	gw, err := h.registry.Get(r.Context(), id)
 	if err != nil {
-		writeError(w, http.StatusNotFound, "gateway not found", err)
+		writeRegistryError(w, r, "failed to get gateway", err)
 		return
 	}
-	writeJSON(w, http.StatusOK, gw)
+	httputil.WriteJSON(w, http.StatusOK, redactGateway(gw))
 }
 
 // Update handles PUT /api/v1/gateways/{id}.
@@ -69,35 +155,84 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	var req model.UpdateGatewayRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid request body", err)
+		httputil.WriteBodyError(w, r, err)
 		return
 	}
 
 	gw, err := h.registry.Update(r.Context(), id, req)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to update gateway", err)
+		writeRegistryError(w, r, "failed to update gateway", err)
+		return
+	}
+	h.clientFactory.Invalidate(id)
+
+	httputil.WriteJSON(w, http.StatusOK, redactGateway(gw))
+}
+
+// Patch handles PATCH /api/v1/gateways/{id}.
+func (h *Handler) Patch(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var req model.PatchGatewayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.WriteBodyError(w, r, err)
+		return
+	}
+
+	gw, err := h.registry.Patch(r.Context(), id, req)
+	if err != nil {
+		writeRegistryError(w, r, "failed to patch gateway", err)
 		return
 	}
+	h.clientFactory.Invalidate(id)
 
-	writeJSON(w, http.StatusOK, gw)
+	httputil.WriteJSON(w, http.StatusOK, redactGateway(gw))
 }
 
-// Delete handles DELETE /api/v1/gateways/{id}.
+// Delete handles DELETE /api/v1/gateways/{id}. The gateway is only marked
+// deleted unless purge is set.
 func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
-	if err := h.registry.Delete(r.Context(), id); err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to delete gateway", err)
+
+	purge, err := queryBool(r, "purge")
+	if err != nil {
+		httputil.WriteError(w, r, http.StatusBadRequest, "invalid purge parameter", err)
+		return
+	}
+	keepSecret, err := queryBool(r, "keep_secret")
+	if err != nil {
+		httputil.WriteError(w, r, http.StatusBadRequest, "invalid keep_secret parameter", err)
+		return
+	}
+
+	if purge {
+		err = h.registry.Purge(r.Context(), id, keepSecret)
+	} else {
+		err = h.registry.Delete(r.Context(), id)
+	}
+	if err != nil {
+		writeRegistryError(w, r, "failed to delete gateway", err)
 		return
 	}
+	h.clientFactory.Invalidate(id)
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// Restore handles POST /api/v1/gateways/{id}/restore.
+func (h *Handler) Restore(w http.ResponseWriter, r *http.Request) {
+	gw, err := h.registry.Restore(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeRegistryError(w, r, "failed to restore gateway", err)
+		return
+	}
+	httputil.WriteJSON(w, http.StatusOK, redactGateway(gw))
+}
+
 // HealthCheck handles POST /api/v1/gateways/{id}/health.
 func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	gw, err := h.registry.Get(r.Context(), id)
 	if err != nil {
-		writeError(w, http.StatusNotFound, "gateway not found", err)
+		writeRegistryError(w, r, "failed to get gateway", err)
 		return
 	}
 
@@ -105,32 +240,320 @@ func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	result, _ := client.HealthCheck(r.Context())
 
 	// Update the stored status regardless of probe outcome.
-	if err := h.registry.UpdateStatus(r.Context(), id, result.Status); err != nil {
-		slog.Warn("failed to persist gateway status", "id", id, "error", err)
+	if err := h.registry.UpdateStatus(r.Context(), *result); err != nil {
+		logging.LoggerFromContext(r.Context()).Warn("failed to persist gateway status", "id", id, "error", err)
 	}
 
-	writeJSON(w, http.StatusOK, result)
+	httputil.WriteJSON(w, http.StatusOK, result)
 }
 
-// --- helpers ---
+// HealthCheckAll handles POST /api/v1/gateways/health.
+func (h *Handler) HealthCheckAll(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r)
+	if err != nil {
+		httputil.WriteError(w, r, http.StatusBadRequest, "invalid filter", err)
+		return
+	}
+
+	gateways, err := h.registry.List(r.Context(), filter, model.ListSort{})
+	if err != nil {
+		httputil.WriteError(w, r, http.StatusInternalServerError, "failed to list gateways", err)
+		return
+	}
 
-type apiError struct {
-	Error   string `json:"error"`
-	Message string `json:"message,omitempty"`
+	results := h.prober.ProbeAll(r.Context(), gateways)
+	httputil.WriteJSON(w, http.StatusOK, results)
 }
 
-func writeJSON(w http.ResponseWriter, status int, v any) {
+// Prompt handles POST /api/v1/gateways/{id}/prompt.
+func (h *Handler) Prompt(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var req model.PromptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.WriteBodyError(w, r, err)
+		return
+	}
+	if req.Prompt == "" {
+		httputil.WriteError(w, r, http.StatusBadRequest, "prompt is required", nil)
+		return
+	}
+
+	timeout := h.prompt.MaxTimeout
+	if req.Timeout != "" {
+		d, err := time.ParseDuration(req.Timeout)
+		if err != nil || d <= 0 {
+			httputil.WriteError(w, r, http.StatusBadRequest, "invalid timeout", err)
+			return
+		}
+		timeout = min(d, h.prompt.MaxTimeout)
+	}
+
+	gw, err := h.registry.Get(r.Context(), id)
+	if err != nil {
+		writeRegistryError(w, r, "failed to get gateway", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	resp, usage, err := h.clientFactory.ClientFor(gw).SendPrompt(ctx, req.Prompt, req.Metadata)
+
+	// The prompt text is deliberately kept out of the audit trail.
+	outcome := "succeeded"
+	if err != nil {
+		outcome = "failed"
+	}
+	h.auditor.Log(r.Context(), audit.Event{
+		Action:   "gateway.prompt",
+		Resource: id,
+		Detail:   fmt.Sprintf("prompt %s in %s", outcome, time.Since(start).Round(time.Millisecond)),
+	})
+
+	if err != nil {
+		var (
+			upstream    *UpstreamError
+			circuitOpen *CircuitOpenError
+		)
+		switch {
+		case errors.As(err, &circuitOpen):
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(circuitOpen.RetryAfter.Seconds()))))
+			httputil.WriteError(w, r, http.StatusServiceUnavailable, "gateway circuit open", err)
+		case errors.As(err, &upstream):
+			httputil.WriteJSON(w, http.StatusBadGateway, upstreamErrorResponse{
+				ErrorResponse:  httputil.ErrorResponse{Error: "gateway returned an error", Message: string(upstream.Body)},
+				UpstreamStatus: upstream.StatusCode,
+			})
+		case errors.Is(err, context.DeadlineExceeded):
+			httputil.WriteError(w, r, http.StatusGatewayTimeout, "gateway timed out", err)
+		default:
+			httputil.WriteError(w, r, http.StatusBadGateway, "gateway unreachable", err)
+		}
+		return
+	}
+
+	h.registry.RecordUsage(r.Context(), id, usage)
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	if err := json.NewEncoder(w).Encode(v); err != nil {
-		slog.Error("failed to encode response", "error", err)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(resp); err != nil {
+		logging.LoggerFromContext(r.Context()).Error("failed to relay gateway response", "id", id, "error", err)
+	}
+}
+
+// Circuit handles GET /api/v1/gateways/{id}/circuit.
+func (h *Handler) Circuit(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	gw, err := h.registry.Get(r.Context(), id)
+	if err != nil {
+		writeRegistryError(w, r, "failed to get gateway", err)
+		return
+	}
+
+	httputil.WriteJSON(w, http.StatusOK, h.clientFactory.Circuit(gw))
+}
+
+// Verify handles POST /api/v1/gateways/{id}/verify.
+func (h *Handler) Verify(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	gw, err := h.registry.Get(r.Context(), id)
+	if err != nil {
+		writeRegistryError(w, r, "failed to get gateway", err)
+		return
+	}
+
+	result := h.clientFactory.ClientFor(gw).Verify(r.Context())
+
+	outcome := "passed"
+	if !result.Passed {
+		outcome = "failed"
 	}
+	h.auditor.Log(r.Context(), audit.Event{
+		Action:   "gateway.verified",
+		Resource: id,
+		Detail:   fmt.Sprintf("verification %s", outcome),
+	})
+
+	httputil.WriteJSON(w, http.StatusOK, result)
+}
+
+// Bounds on the number of health checks returned with a gateway's history.
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 1000
+)
+
+// History handles GET /api/v1/gateways/{id}/history.
+func (h *Handler) History(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	since, err := parseSince(r.URL.Query().Get("since"), h.registry.clock.Now())
+	if err != nil {
+		httputil.WriteError(w, r, http.StatusBadRequest, "invalid since parameter", err)
+		return
+	}
+
+	limit := defaultHistoryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxHistoryLimit {
+			httputil.WriteError(w, r, http.StatusBadRequest,
+				fmt.Sprintf("invalid limit parameter: want 1 to %d", maxHistoryLimit), nil)
+			return
+		}
+		limit = n
+	}
+
+	history, err := h.registry.History(r.Context(), id, since, limit)
+	if err != nil {
+		writeRegistryError(w, r, "failed to load gateway history", err)
+		return
+	}
+	httputil.WriteJSON(w, http.StatusOK, history)
 }
 
-func writeError(w http.ResponseWriter, status int, msg string, err error) {
-	resp := apiError{Error: msg}
+// Usage handles GET /api/v1/gateways/{id}/usage.
+func (h *Handler) Usage(w http.ResponseWriter, r *http.Request) {
+	since, err := parseSince(r.URL.Query().Get("since"), h.registry.clock.Now())
+	if err != nil {
+		httputil.WriteError(w, r, http.StatusBadRequest, "invalid since parameter", err)
+		return
+	}
+
+	report, err := h.registry.Usage(r.Context(), r.PathValue("id"), since)
 	if err != nil {
-		slog.Error(msg, "error", err)
+		writeRegistryError(w, r, "failed to load gateway usage", err)
+		return
+	}
+	httputil.WriteJSON(w, http.StatusOK, report)
+}
+
+// UsageSummary handles GET /api/v1/meta/usage.
+func (h *Handler) UsageSummary(w http.ResponseWriter, r *http.Request) {
+	since, err := parseSince(r.URL.Query().Get("since"), h.registry.clock.Now())
+	if err != nil {
+		httputil.WriteError(w, r, http.StatusBadRequest, "invalid since parameter", err)
+		return
+	}
+
+	report, err := h.registry.UsageSummary(r.Context(), since)
+	if err != nil {
+		httputil.WriteError(w, r, http.StatusInternalServerError, "failed to load usage", err)
+		return
+	}
+	httputil.WriteJSON(w, http.StatusOK, report)
+}
+
+// --- helpers ---
+
+// maxLookbackDays bounds a relative since, which keeps "Nd" from
+// overflowing.
+const (
+	maxLookbackDays = 366
+	maxLookback     = maxLookbackDays * 24 * time.Hour
+)
+
+// parseSince interprets a history window start. It accepts a lookback such
+// as "90m", "24h", or "7d", up to maxLookback, or an absolute RFC 3339
+// timestamp. Empty means the last 24 hours.
+func parseSince(v string, now time.Time) (time.Time, error) {
+	if v == "" {
+		return now.Add(-24 * time.Hour), nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+
+	var lookback time.Duration
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%q is not a duration or timestamp", v)
+		}
+		if n > maxLookbackDays {
+			return time.Time{}, fmt.Errorf("lookback %q must not exceed %dd", v, maxLookbackDays)
+		}
+		lookback = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%q is not a duration or timestamp", v)
+		}
+		lookback = d
+	}
+
+	if lookback <= 0 {
+		return time.Time{}, fmt.Errorf("lookback %q must be positive", v)
+	}
+	if lookback > maxLookback {
+		return time.Time{}, fmt.Errorf("lookback %q must not exceed %dd", v, maxLookbackDays)
+	}
+	return now.Add(-lookback), nil
+}
+
+// parseFilter builds a GatewayFilter from the status and label query
+// parameters. Labels are given as repeated label=key=value pairs.
+func parseFilter(r *http.Request) (model.GatewayFilter, error) {
+	q := r.URL.Query()
+	filter := model.GatewayFilter{Status: model.Status(q.Get("status"))}
+
+	for _, l := range q["label"] {
+		k, v, ok := strings.Cut(l, "=")
+		if !ok || k == "" {
+			return filter, fmt.Errorf("label selector %q must be key=value", l)
+		}
+		if filter.Labels == nil {
+			filter.Labels = make(map[string]string)
+		}
+		filter.Labels[k] = v
+	}
+	return filter, nil
+}
+
+// queryBool parses an optional boolean query parameter; absent is false.
+func queryBool(r *http.Request, name string) (bool, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(v)
+}
+
+// validationErrorResponse is the body of a 400 listing every violation.
+type validationErrorResponse struct {
+	httputil.ErrorResponse
+	Violations []Violation `json:"violations"`
+}
+
+// upstreamErrorResponse is the body of a 502 relaying a gateway's error.
+type upstreamErrorResponse struct {
+	httputil.ErrorResponse
+	UpstreamStatus int `json:"upstream_status"`
+}
+
+// writeValidationError reports a request that failed validation.
+func writeValidationError(w http.ResponseWriter, verr *ValidationError) {
+	httputil.WriteJSON(w, http.StatusBadRequest, validationErrorResponse{
+		ErrorResponse: httputil.ErrorResponse{Error: "validation failed"},
+		Violations:    verr.Violations,
+	})
+}
+
+// writeRegistryError maps registry errors onto HTTP status codes.
+func writeRegistryError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	var verr *ValidationError
+	switch {
+	case errors.As(err, &verr):
+		writeValidationError(w, verr)
+	case errors.Is(err, ErrNameConflict):
+		httputil.WriteJSON(w, http.StatusConflict, httputil.ErrorResponse{Error: "gateway name already in use", Message: err.Error()})
+	case errors.Is(err, store.ErrNotFound):
+		httputil.WriteError(w, r, http.StatusNotFound, "gateway not found", err)
+	case errors.Is(err, ErrForbidden):
+		httputil.WriteError(w, r, http.StatusForbidden, "forbidden", err)
+	default:
+		httputil.WriteError(w, r, http.StatusInternalServerError, msg, err)
 	}
-	writeJSON(w, status, resp)
 }
@@ -0,0 +1,301 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/secrets"
+	"github.com/AdamPippert/Lobstertank/internal/transport"
+)
+
+// probeTimeout is the per-gateway timeout of test handlers' probers.
+const probeTimeout = 200 * time.Millisecond
+
+// newTestHandler returns a handler over r that reaches gateways over plain
+// HTTPS clients, without retries or circuit breakers.
+func newTestHandler(t *testing.T, r *Registry) *Handler {
+	t.Helper()
+	sp, err := secrets.NewBuiltinProvider("")
+	if err != nil {
+		t.Fatalf("NewBuiltinProvider: %v", err)
+	}
+	cf := NewClientFactory(transport.NewProvider(config.TransportConfig{Default: "https"}), sp,
+		config.RetryConfig{}, config.BreakerConfig{}, r.clock)
+	p := NewProber(r, cf, 10, probeTimeout)
+	return NewHandler(r, cf, p, audit.New(config.AuditConfig{}), config.PromptConfig{})
+}
+
+// fakeGateway serves /healthz with handle until the test ends.
+func fakeGateway(t *testing.T, handle http.HandlerFunc) string {
+	t.Helper()
+	srv := httptest.NewServer(handle)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestHealthCheckAllProbesConcurrently(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	h := newTestHandler(t, r)
+
+	release := make(chan struct{})
+	slow := createGatewayAt(t, r, "slow", fakeGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}), nil)
+	t.Cleanup(func() { close(release) }) // runs before the server closes
+	failing := createGatewayAt(t, r, "failing", fakeGateway(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}), nil)
+	healthy := createGatewayAt(t, r, "healthy", fakeGateway(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), nil)
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	h.HealthCheckAll(rec, httptest.NewRequest(http.MethodPost, "/api/v1/gateways/health", nil))
+	if elapsed := time.Since(start); elapsed > 5*probeTimeout {
+		t.Errorf("batch took %v; a slow gateway should only cost its own timeout of %v", elapsed, probeTimeout)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+
+	var results []model.HealthCheckResult
+	if err := json.NewDecoder(rec.Body).Decode(&results); err != nil {
+		t.Fatalf("decode results: %v", err)
+	}
+	got := make(map[string]model.HealthCheckResult)
+	for _, res := range results {
+		got[res.GatewayID] = res
+	}
+	if len(got) != 3 {
+		t.Fatalf("got results for %d gateways, want 3: %+v", len(got), results)
+	}
+
+	for _, tc := range []struct {
+		gw     *model.Gateway
+		status model.Status
+	}{
+		{slow, model.StatusOffline},
+		{failing, model.StatusDegraded},
+		{healthy, model.StatusOnline},
+	} {
+		if res := got[tc.gw.ID]; res.Status != tc.status {
+			t.Errorf("%s: result status = %q (%s), want %q", tc.gw.Name, res.Status, res.Error, tc.status)
+		}
+		stored, err := r.Get(context.Background(), tc.gw.ID)
+		if err != nil {
+			t.Fatalf("Get %s: %v", tc.gw.Name, err)
+		}
+		if stored.Status != tc.status {
+			t.Errorf("%s: stored status = %q, want %q", tc.gw.Name, stored.Status, tc.status)
+		}
+	}
+}
+
+func TestHealthCheckAllFiltersByLabel(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	h := newTestHandler(t, r)
+
+	ok := func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }
+	prod := createGatewayAt(t, r, "prod", fakeGateway(t, ok), map[string]string{"env": "prod"})
+	staging := createGatewayAt(t, r, "staging", fakeGateway(t, ok), map[string]string{"env": "staging"})
+
+	rec := httptest.NewRecorder()
+	h.HealthCheckAll(rec, httptest.NewRequest(http.MethodPost, "/api/v1/gateways/health?label=env=prod", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var results []model.HealthCheckResult
+	if err := json.NewDecoder(rec.Body).Decode(&results); err != nil {
+		t.Fatalf("decode results: %v", err)
+	}
+	if len(results) != 1 || results[0].GatewayID != prod.ID {
+		t.Fatalf("results = %+v, want only %s", results, prod.Name)
+	}
+
+	stored, err := r.Get(context.Background(), staging.ID)
+	if err != nil {
+		t.Fatalf("Get staging: %v", err)
+	}
+	if stored.Status == model.StatusOnline {
+		t.Errorf("unselected gateway was probed: status = %q", stored.Status)
+	}
+}
+
+func TestListSort(t *testing.T) {
+	r, clk := newTestRegistry(t)
+	h := newTestHandler(t, r)
+	ids := make(map[string]string)
+	for _, name := range []string{"bravo", "alpha", "charlie"} {
+		ids[name] = createGateway(t, r, name, nil).ID
+		clk.Advance(time.Minute)
+	}
+	// charlie is seen first and goes offline; alpha is seen later and
+	// online; bravo is never seen and keeps its unknown status.
+	for _, name := range []string{"charlie", "alpha"} {
+		status := model.StatusOffline
+		if name == "alpha" {
+			status = model.StatusOnline
+		}
+		if err := r.UpdateStatus(context.Background(), model.HealthCheckResult{GatewayID: ids[name], Status: status}); err != nil {
+			t.Fatalf("UpdateStatus %s: %v", name, err)
+		}
+		clk.Advance(time.Minute)
+	}
+
+	list := func(query string) (int, []string) {
+		rec := httptest.NewRecorder()
+		h.List(rec, httptest.NewRequest(http.MethodGet, "/api/v1/gateways"+query, nil))
+		if rec.Code != http.StatusOK {
+			return rec.Code, nil
+		}
+		var gateways []model.Gateway
+		if err := json.NewDecoder(rec.Body).Decode(&gateways); err != nil {
+			t.Fatalf("decode %s: %v", query, err)
+		}
+		var names []string
+		for _, gw := range gateways {
+			names = append(names, gw.Name)
+		}
+		return rec.Code, names
+	}
+
+	for query, want := range map[string][]string{
+		"":                             {"charlie", "alpha", "bravo"},
+		"?sort=name":                   {"charlie", "bravo", "alpha"}, // order defaults to desc
+		"?sort=name&order=asc":         {"alpha", "bravo", "charlie"},
+		"?sort=enrolled_at&order=asc":  {"bravo", "alpha", "charlie"},
+		"?sort=last_seen_at":           {"alpha", "charlie", "bravo"}, // never seen sorts last
+		"?sort=last_seen_at&order=asc": {"charlie", "alpha", "bravo"},
+		"?sort=status&order=asc":       {"charlie", "alpha", "bravo"},
+		"?sort=status":                 {"bravo", "alpha", "charlie"},
+	} {
+		code, names := list(query)
+		if code != http.StatusOK || !slices.Equal(names, want) {
+			t.Errorf("GET %q: status %d, names %v; want 200, %v", query, code, names, want)
+		}
+	}
+
+	for _, query := range []string{"?sort=endpoint", "?sort=name%3BDROP%20TABLE%20gateways", "?sort=name&order=sideways"} {
+		if code, _ := list(query); code != http.StatusBadRequest {
+			t.Errorf("GET %q: status %d, want 400", query, code)
+		}
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := testEpoch
+	for _, tt := range []struct {
+		v    string
+		want time.Time // zero when v must be rejected
+	}{
+		{"", now.Add(-24 * time.Hour)},
+		{"90m", now.Add(-90 * time.Minute)},
+		{"7d", now.Add(-7 * 24 * time.Hour)},
+		{"366d", now.Add(-maxLookback)},
+		{"2024-12-31T12:00:00Z", time.Date(2024, 12, 31, 12, 0, 0, 0, time.UTC)},
+		{"367d", time.Time{}},
+		{"9000h", time.Time{}},
+		{"999999999999d", time.Time{}}, // overflows a Duration
+		{"0d", time.Time{}},
+		{"-1h", time.Time{}},
+		{"yesterday", time.Time{}},
+	} {
+		got, err := parseSince(tt.v, now)
+		switch {
+		case tt.want.IsZero() && err == nil:
+			t.Errorf("parseSince(%q) = %v, want an error", tt.v, got)
+		case !tt.want.IsZero() && (err != nil || !got.Equal(tt.want)):
+			t.Errorf("parseSince(%q) = %v, %v; want %v", tt.v, got, err, tt.want)
+		}
+	}
+}
+
+func TestHistoryLookbackUsesRegistryClock(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	gw := createGateway(t, r, "edge", nil)
+	h := newTestHandler(t, r)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/gateways/"+gw.ID+"/history?since=1h", nil)
+	req.SetPathValue("id", gw.ID)
+	rec := httptest.NewRecorder()
+	h.History(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var history model.StatusHistory
+	if err := json.NewDecoder(rec.Body).Decode(&history); err != nil {
+		t.Fatalf("decode history: %v", err)
+	}
+	if want := testEpoch.Add(-time.Hour); !history.Since.Equal(want) {
+		t.Errorf("since = %v, want an hour before the registry's clock, %v", history.Since, want)
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	h := newTestHandler(t, r)
+	h.prompt.MaxTimeout = 5 * time.Second
+	createGateway(t, r, "edge", nil)
+	failing, err := r.Create(context.Background(), model.CreateGatewayRequest{
+		Name: "failing",
+		Endpoint: fakeGateway(t, func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte("slow down"))
+		}),
+		Transport: model.TransportConfig{Type: "https"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		handle     http.HandlerFunc
+		id         string
+		body       string
+		wantStatus int
+		want       string // the response body, as JSON
+	}{
+		{"validation", h.Create, "", `{"name":"","endpoint":"https://x.example.com","transport":{"type":"https"}}`, http.StatusBadRequest,
+			`{"error":"validation failed","violations":[{"field":"name","message":"is required"}]}`},
+		{"name conflict", h.Create, "", `{"name":"edge","endpoint":"https://x.example.com","transport":{"type":"https"}}`, http.StatusConflict,
+			`{"error":"gateway name already in use","message":"gateway name already in use: edge"}`},
+		{"upstream error", h.Prompt, failing.ID, `{"prompt":"hello"}`, http.StatusBadGateway,
+			`{"error":"gateway returned an error","message":"slow down","upstream_status":429}`},
+		{"not found", h.Prompt, "gw-missing", `{"prompt":"hello"}`, http.StatusNotFound,
+			`{"error":"gateway not found"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			req.SetPathValue("id", tt.id)
+			rec := httptest.NewRecorder()
+			tt.handle(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			var got, want any
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode %s: %v", rec.Body, err)
+			}
+			json.Unmarshal([]byte(tt.want), &want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("body = %s, want %s", rec.Body, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"net/http"
+
+	"github.com/AdamPippert/Lobstertank/internal/httputil"
+	"github.com/AdamPippert/Lobstertank/internal/logging"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+)
+
+// IdempotencyKeyHeader lets a client retry a registration safely: every
+// create carrying the same key yields the same gateway.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLen bounds client-supplied keys.
+const maxIdempotencyKeyLen = 255
+
+// idempotencyLockStripes is how many mutexes idempotency keys share.
+const idempotencyLockStripes = 64
+
+// idempotencySeed hashes idempotency keys to their mutex.
+var idempotencySeed = maphash.MakeSeed()
+
+// lockIdempotencyKey locks the mutex key hashes to and returns the unlock
+// function. Unrelated keys occasionally wait on each other.
+func (r *Registry) lockIdempotencyKey(key string) func() {
+	mu := &r.keyLocks[maphash.String(idempotencySeed, key)%idempotencyLockStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// validateIdempotencyKey rejects keys that are too long or not printable
+// ASCII.
+func validateIdempotencyKey(key string) error {
+	verr := &ValidationError{}
+	if len(key) > maxIdempotencyKeyLen {
+		verr.add(IdempotencyKeyHeader, "must be at most %d characters", maxIdempotencyKeyLen)
+	}
+	for _, c := range key {
+		if c < 0x21 || c > 0x7e {
+			verr.add(IdempotencyKeyHeader, "must be printable ASCII without spaces")
+			break
+		}
+	}
+	if len(verr.Violations) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// GatewayForKey returns the gateway previously created with an idempotency
+// key. It returns store.ErrNotFound when the key is unused or its gateway
+// has since been deleted.
+func (r *Registry) GatewayForKey(ctx context.Context, key string) (*model.Gateway, error) {
+	id, err := r.store.GetIdempotencyKey(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("look up idempotency key: %w", err)
+	}
+	gw, err := r.store.GetGateway(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("get gateway for idempotency key: %w", err)
+	}
+	if err := authorize(ctx, gw); err != nil {
+		return nil, err
+	}
+	return gw, nil
+}
+
+// CreateIdempotent registers a gateway unless one was already created with
+// key, in which case that gateway is returned and created is false. Creates
+// sharing a key are serialized within the process.
+func (r *Registry) CreateIdempotent(ctx context.Context, key string, req model.CreateGatewayRequest, initial *model.HealthCheckResult) (gw *model.Gateway, created bool, err error) {
+	unlock := r.lockIdempotencyKey(key)
+	defer unlock()
+
+	gw, err = r.GatewayForKey(ctx, key)
+	switch {
+	case err == nil:
+		return gw, false, nil
+	case !errors.Is(err, store.ErrNotFound):
+		return nil, false, err
+	}
+
+	gw, err = r.Create(ctx, req, initial)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// The gateway exists either way; a retry after a failure here gets a
+	// name conflict rather than a duplicate.
+	if err := r.store.PutIdempotencyKey(ctx, key, gw.ID, r.clock.Now().UTC()); err != nil {
+		logging.LoggerFromContext(ctx).Warn("failed to record idempotency key", "id", gw.ID, "error", err)
+	}
+	return gw, true, nil
+}
+
+// replayCreate answers a create whose idempotency key has already been used
+// and reports whether it did so.
+func (h *Handler) replayCreate(w http.ResponseWriter, r *http.Request, key string) bool {
+	gw, err := h.registry.GatewayForKey(r.Context(), key)
+	switch {
+	case err == nil:
+		httputil.WriteJSON(w, http.StatusOK, redactGateway(gw))
+		return true
+	case errors.Is(err, store.ErrNotFound):
+		return false
+	case errors.Is(err, ErrForbidden):
+		writeRegistryError(w, r, "failed to create gateway", err)
+		return true
+	default:
+		httputil.WriteError(w, r, http.StatusInternalServerError, "failed to create gateway", err)
+		return true
+	}
+}
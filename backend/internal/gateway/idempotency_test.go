@@ -0,0 +1,66 @@
+package gateway
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+func TestCreateIdempotentCreatesOnce(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	req := model.CreateGatewayRequest{
+		Name:      "edge",
+		Endpoint:  "https://edge.example.com",
+		Transport: model.TransportConfig{Type: "https"},
+	}
+
+	const n = 8
+	var (
+		wg      sync.WaitGroup
+		ids     [n]string
+		created [n]bool
+		errs    [n]error
+	)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gw, ok, err := r.CreateIdempotent(context.Background(), "retry-1", req, nil)
+			if err == nil {
+				ids[i], created[i] = gw.ID, ok
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+
+	creates := 0
+	for i := range n {
+		if errs[i] != nil {
+			t.Fatalf("CreateIdempotent: %v", errs[i])
+		}
+		if ids[i] != ids[0] {
+			t.Errorf("call %d got gateway %s, want %s", i, ids[i], ids[0])
+		}
+		if created[i] {
+			creates++
+		}
+	}
+	if creates != 1 {
+		t.Errorf("%d calls created the gateway, want 1", creates)
+	}
+
+	// Keys are not tracked per key, so arbitrarily many leave nothing behind.
+	for _, key := range []string{"retry-2", "retry-3"} {
+		req.Name = key
+		if _, _, err := r.CreateIdempotent(context.Background(), key, req, nil); err != nil {
+			t.Fatalf("CreateIdempotent %s: %v", key, err)
+		}
+	}
+	r.locks.Range(func(k, _ any) bool {
+		t.Errorf("lock held for %v after creates", k)
+		return true
+	})
+}
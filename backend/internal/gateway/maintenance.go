@@ -0,0 +1,117 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/httputil"
+	"github.com/AdamPippert/Lobstertank/internal/logging"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// MaintenanceActive reports whether gw is in maintenance mode that has not
+// yet reached its end time.
+func (r *Registry) MaintenanceActive(gw *model.Gateway) bool {
+	if gw.Status != model.StatusMaintenance {
+		return false
+	}
+	return gw.MaintenanceUntil == nil || r.clock.Now().Before(*gw.MaintenanceUntil)
+}
+
+// SetMaintenance puts a gateway into maintenance mode or takes it out again.
+// While in maintenance the gateway keeps its status regardless of health
+// checks; on leaving, its status reverts to unknown until the next probe.
+func (r *Registry) SetMaintenance(ctx context.Context, id string, req model.MaintenanceRequest) (*model.Gateway, error) {
+	now := r.clock.Now().UTC()
+	if req.Enabled && req.Until != nil && !req.Until.After(now) {
+		verr := &ValidationError{}
+		verr.add("until", "must be in the future")
+		return nil, verr
+	}
+
+	unlock := r.lockGateway(id)
+	defer unlock()
+
+	gw, err := r.store.GetGateway(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("get gateway for maintenance %s: %w", id, err)
+	}
+	if err := authorize(ctx, gw); err != nil {
+		return nil, err
+	}
+
+	prev := gw.Status
+	var action, detail string
+	switch {
+	case req.Enabled:
+		gw.Status = model.StatusMaintenance
+		gw.MaintenanceReason = req.Reason
+		gw.MaintenanceUntil = nil
+		if req.Until != nil {
+			until := req.Until.UTC()
+			gw.MaintenanceUntil = &until
+		}
+		action, detail = "gateway.maintenance_started", "maintenance started"
+		if req.Reason != "" {
+			detail += ": " + req.Reason
+		}
+		if gw.MaintenanceUntil != nil {
+			detail += fmt.Sprintf(" (until %s)", gw.MaintenanceUntil.Format(time.RFC3339))
+		}
+	case prev == model.StatusMaintenance:
+		gw.Status = model.StatusUnknown
+		gw.MaintenanceReason = ""
+		gw.MaintenanceUntil = nil
+		action, detail = "gateway.maintenance_ended", "maintenance ended"
+	default:
+		return gw, nil // Not in maintenance; nothing to clear.
+	}
+
+	if err := r.store.SetGatewayMaintenance(ctx, id, string(gw.Status), gw.MaintenanceReason, gw.MaintenanceUntil); err != nil {
+		return nil, fmt.Errorf("set maintenance for %s: %w", id, err)
+	}
+	r.cache.invalidate(id)
+
+	if gw.Status != prev {
+		transition := model.StatusTransition{
+			GatewayID:  id,
+			From:       prev,
+			To:         gw.Status,
+			ObservedAt: now,
+		}
+		if err := r.store.InsertStatusTransition(ctx, &transition); err != nil {
+			logging.LoggerFromContext(ctx).Warn("failed to record maintenance transition", "id", id, "error", err)
+		} else {
+			r.notify(gw, transition)
+		}
+	}
+
+	r.auditor.Log(ctx, audit.Event{
+		Action:   action,
+		Resource: id,
+		Detail:   detail,
+	})
+
+	return gw, nil
+}
+
+// Maintenance handles PUT /api/v1/gateways/{id}/maintenance.
+func (h *Handler) Maintenance(w http.ResponseWriter, r *http.Request) {
+	var req model.MaintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.WriteBodyError(w, r, err)
+		return
+	}
+
+	gw, err := h.registry.SetMaintenance(r.Context(), r.PathValue("id"), req)
+	if err != nil {
+		writeRegistryError(w, r, "failed to set maintenance", err)
+		return
+	}
+
+	httputil.WriteJSON(w, http.StatusOK, redactGateway(gw))
+}
@@ -0,0 +1,131 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/transport"
+)
+
+// Auth params for gateways using mTLS. Auth.SecretRef holds the client
+// certificate PEM, optionally followed by its private key; when the key is
+// stored separately, key_ref points at it. ca_ref names a PEM bundle used
+// instead of the system roots to verify the gateway.
+const (
+	paramKeyRef = "key_ref"
+	paramCARef  = "ca_ref"
+)
+
+// clientTLS is the parsed mTLS material for one gateway.
+type clientTLS struct {
+	cert  tls.Certificate
+	roots *x509.CertPool // nil uses the system pool
+
+	// base and client cache the pooled client last wrapped to present cert,
+	// so the gateway's connections are reused too. Guarded by the
+	// factory's mutex.
+	base, client *http.Client
+}
+
+// useClientTLS switches the client to a transport that presents the
+// gateway's client certificate. It is a no-op after the first call.
+func (c *Client) useClientTLS(ctx context.Context) error {
+	if c.tlsLoaded {
+		return nil
+	}
+	if c.ephemeral {
+		material, err := c.factory.loadClientTLS(ctx, c.gateway)
+		if err != nil {
+			return err
+		}
+		c.httpClient = transport.WithClientTLS(c.httpClient, material.cert, material.roots)
+		c.tlsLoaded = true
+		return nil
+	}
+
+	material, err := c.factory.clientTLSFor(ctx, c.gateway)
+	if err != nil {
+		return err
+	}
+	c.httpClient = c.factory.wrapClientTLS(material, c.httpClient)
+	c.tlsLoaded = true
+	return nil
+}
+
+// wrapClientTLS returns base wrapped to present the gateway's certificate,
+// reusing the previous wrapper while base is unchanged.
+func (f *ClientFactory) wrapClientTLS(material *clientTLS, base *http.Client) *http.Client {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if material.base != base {
+		material.base = base
+		material.client = transport.WithClientTLS(base, material.cert, material.roots)
+	}
+	return material.client
+}
+
+// clientTLSFor returns the gateway's parsed mTLS material, loading it from
+// the secrets provider on first use. Invalidate drops the cached copy.
+func (f *ClientFactory) clientTLSFor(ctx context.Context, gw *model.Gateway) (*clientTLS, error) {
+	f.mu.Lock()
+	material, ok := f.tlsMaterial[gw.ID]
+	f.mu.Unlock()
+	if ok {
+		return material, nil
+	}
+
+	material, err := f.loadClientTLS(ctx, gw)
+	if err != nil {
+		return nil, err
+	}
+
+	if gw.ID != "" {
+		f.mu.Lock()
+		f.tlsMaterial[gw.ID] = material
+		f.mu.Unlock()
+	}
+	return material, nil
+}
+
+func (f *ClientFactory) loadClientTLS(ctx context.Context, gw *model.Gateway) (*clientTLS, error) {
+	if gw.Auth.SecretRef == "" {
+		return nil, fmt.Errorf("gateway %s: mtls requires a secret_ref holding the client certificate", gw.ID)
+	}
+
+	certPEM, err := f.secretProv.Resolve(ctx, gw.Auth.SecretRef)
+	if err != nil {
+		return nil, fmt.Errorf("resolve client certificate: %w", err)
+	}
+
+	// A combined PEM carries the key alongside the certificate.
+	keyPEM := certPEM
+	if ref := gw.Auth.Params[paramKeyRef]; ref != "" {
+		keyPEM, err = f.secretProv.Resolve(ctx, ref)
+		if err != nil {
+			return nil, fmt.Errorf("resolve client key: %w", err)
+		}
+	}
+
+	cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return nil, fmt.Errorf("parse client certificate for gateway %s: %w", gw.ID, err)
+	}
+
+	material := &clientTLS{cert: cert}
+	if ref := gw.Auth.Params[paramCARef]; ref != "" {
+		caPEM, err := f.secretProv.Resolve(ctx, ref)
+		if err != nil {
+			return nil, fmt.Errorf("resolve CA bundle: %w", err)
+		}
+		material.roots = x509.NewCertPool()
+		if !material.roots.AppendCertsFromPEM([]byte(caPEM)) {
+			return nil, errors.New("CA bundle contains no PEM certificates")
+		}
+	}
+	return material, nil
+}
@@ -0,0 +1,199 @@
+package gateway
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/secrets"
+	"github.com/AdamPippert/Lobstertank/internal/transport"
+)
+
+// testCA is a certificate authority issuing client certificates for tests.
+type testCA struct {
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	serial int64
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate CA key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create CA certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse CA certificate: %v", err)
+	}
+	return &testCA{cert: cert, key: key, serial: 1}
+}
+
+// issue signs a client certificate for name and returns it and its key as
+// PEM.
+func (ca *testCA) issue(t *testing.T, name string) (certPEM, keyPEM string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate client key: %v", err)
+	}
+	ca.serial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("create client certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal client key: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+}
+
+// mtlsGateway serves completions over TLS to clients presenting a
+// certificate issued by ca, answering with the certificate's common name.
+// It returns the server's URL and its certificate as PEM.
+func mtlsGateway(t *testing.T, ca *testCA) (url, serverCA string) {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"response": r.TLS.PeerCertificates[0].Subject.CommonName})
+	}))
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: roots}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv.URL, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+}
+
+// newMTLSFactory returns a client factory without retries or breakers,
+// resolving secrets from sp.
+func newMTLSFactory(sp secrets.Provider) *ClientFactory {
+	return NewClientFactory(transport.NewProvider(config.TransportConfig{Default: "https"}), sp,
+		config.RetryConfig{}, config.BreakerConfig{}, clock.NewFake(testEpoch))
+}
+
+// storeClientCert issues a certificate for id and stores it, its key and
+// the gateway's CA bundle under id's refs. It returns an mTLS gateway at
+// endpoint using them.
+func storeClientCert(t *testing.T, sp secrets.Provider, ca *testCA, id, endpoint, serverCA string) *model.Gateway {
+	t.Helper()
+	ctx := context.Background()
+	prefix := "builtin://gateways/" + id + "/"
+	certPEM, keyPEM := ca.issue(t, id)
+	for ref, value := range map[string]string{prefix + "cert": certPEM, prefix + "key": keyPEM, prefix + "ca": serverCA} {
+		if err := sp.Store(ctx, ref, value); err != nil {
+			t.Fatalf("Store %s: %v", ref, err)
+		}
+	}
+	return &model.Gateway{
+		ID:        id,
+		Name:      id,
+		Endpoint:  endpoint,
+		Transport: model.TransportConfig{Type: "https"},
+		Auth: model.GatewayAuthConfig{Type: "mtls", SecretRef: prefix + "cert",
+			Params: map[string]string{paramKeyRef: prefix + "key", paramCARef: prefix + "ca"}},
+	}
+}
+
+// presented sends a prompt to gw and returns the name on the certificate
+// the gateway saw.
+func presented(t *testing.T, f *ClientFactory, gw *model.Gateway) string {
+	t.Helper()
+	body, _, err := f.ClientFor(gw).SendPrompt(context.Background(), "who am I?", nil)
+	if err != nil {
+		t.Fatalf("SendPrompt to %s: %v", gw.ID, err)
+	}
+	var resp openClawResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return resp.Response
+}
+
+func TestMTLSPresentsEachGatewaysCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	endpoint, serverCA := mtlsGateway(t, ca)
+	sp, err := secrets.NewBuiltinProvider("")
+	if err != nil {
+		t.Fatalf("NewBuiltinProvider: %v", err)
+	}
+	f := newMTLSFactory(sp)
+
+	// Both gateways share a transport, and so a pooled client, and sit
+	// behind the same server; kept-alive connections must not carry one
+	// gateway's certificate into the other's requests.
+	a := storeClientCert(t, sp, ca, "gw-a", endpoint, serverCA)
+	b := storeClientCert(t, sp, ca, "gw-b", endpoint, serverCA)
+	for i, gw := range []*model.Gateway{a, b, a, b, b, a} {
+		if got := presented(t, f, gw); got != gw.ID {
+			t.Errorf("request %d to %s presented %s's certificate", i, gw.ID, got)
+		}
+	}
+
+	// A rotated certificate is picked up once the cached one is dropped.
+	certPEM, keyPEM := ca.issue(t, "gw-a-rotated")
+	for ref, value := range map[string]string{a.Auth.SecretRef: certPEM, a.Auth.Params[paramKeyRef]: keyPEM} {
+		if err := sp.Store(context.Background(), ref, value); err != nil {
+			t.Fatalf("Store %s: %v", ref, err)
+		}
+	}
+	if got := presented(t, f, a); got != "gw-a" {
+		t.Errorf("before Invalidate presented %s, want the cached gw-a", got)
+	}
+	f.Invalidate(a.ID)
+	if got := presented(t, f, a); got != "gw-a-rotated" {
+		t.Errorf("after Invalidate presented %s, want gw-a-rotated", got)
+	}
+}
+
+func TestMTLSRequiresTrustedServer(t *testing.T) {
+	ca := newTestCA(t)
+	endpoint, _ := mtlsGateway(t, ca)
+	sp, err := secrets.NewBuiltinProvider("")
+	if err != nil {
+		t.Fatalf("NewBuiltinProvider: %v", err)
+	}
+
+	// The bundle names some other CA, so the server is not trusted.
+	other, _ := newTestCA(t).issue(t, "other")
+	gw := storeClientCert(t, sp, ca, "gw-a", endpoint, other)
+	if _, _, err := newMTLSFactory(sp).ClientFor(gw).SendPrompt(context.Background(), "who am I?", nil); err == nil {
+		t.Error("gateway served over TLS its CA bundle does not trust")
+	}
+}
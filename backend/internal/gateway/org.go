@@ -0,0 +1,69 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/AdamPippert/Lobstertank/internal/auth"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// ErrForbidden is returned when the caller's organization does not own the
+// gateway it asked for.
+var ErrForbidden = errors.New("gateway belongs to another organization")
+
+// callerOrg returns the organization the request's principal is scoped to.
+// It is empty for unscoped principals and for work the server does on its
+// own behalf, such as monitoring, which carries no principal.
+func callerOrg(ctx context.Context) string {
+	if p, ok := auth.PrincipalFromContext(ctx); ok {
+		return p.Org
+	}
+	return ""
+}
+
+// visible reports whether the caller may see gw.
+func visible(ctx context.Context, gw *model.Gateway) bool {
+	return inCallerOrg(ctx, gw.OrgID)
+}
+
+// inCallerOrg reports whether the caller may see what organization org owns.
+func inCallerOrg(ctx context.Context, org string) bool {
+	caller := callerOrg(ctx)
+	return caller == "" || org == caller
+}
+
+// authorize returns ErrForbidden when the caller may not access gw.
+func authorize(ctx context.Context, gw *model.Gateway) error {
+	if !visible(ctx, gw) {
+		return fmt.Errorf("%w: %s", ErrForbidden, gw.ID)
+	}
+	return nil
+}
+
+// assignOrg sets the organization of a gateway being registered: the one
+// requested, or else the caller's. Scoped callers may only register
+// gateways in their own organization.
+func assignOrg(ctx context.Context, gw *model.Gateway, requested string) error {
+	org, ok := ownerOrg(ctx, requested)
+	if !ok {
+		return fmt.Errorf("%w: cannot register a gateway in organization %q", ErrForbidden, requested)
+	}
+	gw.OrgID = org
+	return nil
+}
+
+// ownerOrg returns the organization something the caller creates belongs
+// to: the one requested, or else the caller's. It reports false when a
+// scoped caller requests another organization.
+func ownerOrg(ctx context.Context, requested string) (string, bool) {
+	org := callerOrg(ctx)
+	switch {
+	case requested == "":
+		return org, true
+	case org == "" || requested == org:
+		return requested, true
+	}
+	return "", false
+}
@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+func TestGatewaysScopedToOrg(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	h := newTestHandler(t, r)
+	acmeGW := createOrgGateway(t, r, "acme", "acme-edge")
+	initechGW := createOrgGateway(t, r, "initech", "initech-edge")
+
+	// serve sends a request to h as an admin of org.
+	serve := func(org string, handle http.HandlerFunc, method, id, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1/gateways/"+id, strings.NewReader(body))
+		req = req.WithContext(orgContext(org))
+		req.SetPathValue("id", id)
+		rec := httptest.NewRecorder()
+		handle(rec, req)
+		return rec
+	}
+
+	rec := serve("acme", h.List, http.MethodGet, "", "")
+	var listed []model.Gateway
+	if err := json.NewDecoder(rec.Body).Decode(&listed); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if len(listed) != 1 || listed[0].ID != acmeGW.ID {
+		t.Errorf("acme List = %+v, want only %s", listed, acmeGW.Name)
+	}
+
+	for _, tt := range []struct {
+		op     string
+		handle http.HandlerFunc
+		method string
+		body   string
+	}{
+		{"get", h.Get, http.MethodGet, ""},
+		{"update", h.Update, http.MethodPut, `{"description":"taken over"}`},
+		{"patch", h.Patch, http.MethodPatch, `{"labels":{"owner":"acme"}}`},
+		{"delete", h.Delete, http.MethodDelete, ""},
+	} {
+		if rec := serve("acme", tt.handle, tt.method, initechGW.ID, tt.body); rec.Code != http.StatusForbidden {
+			t.Errorf("acme %s of initech's gateway: status = %d, want 403: %s", tt.op, rec.Code, rec.Body)
+		}
+	}
+
+	stored, err := r.Get(orgContext("initech"), initechGW.ID)
+	if err != nil {
+		t.Fatalf("initech Get: %v", err)
+	}
+	if stored.Description != initechGW.Description || len(stored.Labels) != 0 {
+		t.Errorf("initech's gateway changed: %+v", stored)
+	}
+
+	if rec := serve("acme", h.Get, http.MethodGet, acmeGW.ID, ""); rec.Code != http.StatusOK {
+		t.Errorf("acme get of its own gateway: status = %d, want 200", rec.Code)
+	}
+}
+
+func TestGatewayNamesScopedToOrg(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	h := newTestHandler(t, r)
+	acmeGW := createOrgGateway(t, r, "acme", "edge")
+	initechGW := createOrgGateway(t, r, "initech", "edge")
+	createOrgGateway(t, r, "initech", "core")
+
+	tests := []struct {
+		name string
+		org  string
+		body string
+		want int
+	}{
+		{"taken in own org", "acme", `{"name":"edge","endpoint":"https://edge2.example.com","transport":{"type":"https"}}`, http.StatusConflict},
+		{"free in own org", "acme", `{"name":"core","endpoint":"https://core.example.com","transport":{"type":"https"}}`, http.StatusCreated},
+		{"taken only elsewhere", "globex", `{"name":"edge","endpoint":"https://edge.example.com","transport":{"type":"https"}}`, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/gateways", strings.NewReader(tt.body))
+			req = req.WithContext(orgContext(tt.org))
+			rec := httptest.NewRecorder()
+			h.Create(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+
+	initech, name := orgContext("initech"), "core"
+	if _, err := r.Patch(initech, initechGW.ID, model.PatchGatewayRequest{Name: &name}); !errors.Is(err, ErrNameConflict) {
+		t.Errorf("rename onto a name in the same org: got %v, want ErrNameConflict", err)
+	}
+
+	// Importing into acme updates acme's edge and leaves initech's alone.
+	bundle := &model.GatewayBundle{Version: model.GatewayBundleVersion, Gateways: []model.GatewaySpec{{
+		Name:      "edge",
+		Endpoint:  "https://edge.acme.example.com",
+		Transport: model.TransportConfig{Type: "https"},
+	}}}
+	result, err := r.Import(orgContext("acme"), bundle, false)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if len(result.Updated) != 1 || len(result.Created) != 0 {
+		t.Errorf("Import = %+v, want edge updated", result)
+	}
+	if gw, _ := r.Get(initech, initechGW.ID); gw.Endpoint != initechGW.Endpoint {
+		t.Errorf("initech's edge endpoint = %s, want %s", gw.Endpoint, initechGW.Endpoint)
+	}
+	if gw, _ := r.Get(orgContext("acme"), acmeGW.ID); gw.Endpoint != "https://edge.acme.example.com" {
+		t.Errorf("acme's edge endpoint = %s, want the imported one", gw.Endpoint)
+	}
+}
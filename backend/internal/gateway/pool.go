@@ -0,0 +1,71 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+const (
+	// idleClientTTL is how long a pooled HTTP client may go unused before
+	// it is dropped and its idle connections closed.
+	idleClientTTL = 10 * time.Minute
+	// poolSweepInterval is the least time between sweeps for idle clients.
+	poolSweepInterval = time.Minute
+)
+
+// pooledClient is an HTTP client shared by every gateway with the same
+// transport settings, so keep-alive connections outlive a single request.
+type pooledClient struct {
+	client   *http.Client
+	lastUsed time.Time
+}
+
+// httpClientFor returns the shared HTTP client for gw's transport settings,
+// building it on first use. Clients unused for idleClientTTL are dropped.
+func (f *ClientFactory) httpClientFor(gw *model.Gateway) *http.Client {
+	key := poolKey(gw.Transport)
+	now := f.clock.Now()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if now.Sub(f.lastSweep) >= poolSweepInterval {
+		f.sweepClients(now)
+	}
+	if pc, ok := f.clients[key]; ok {
+		pc.lastUsed = now
+		return pc.client
+	}
+	pc := &pooledClient{
+		client:   f.transport.HTTPClient(gw.Transport.Type, gw.Transport.Params),
+		lastUsed: now,
+	}
+	f.clients[key] = pc
+	return pc.client
+}
+
+// sweepClients drops pooled clients idle for idleClientTTL. f.mu must be
+// held.
+func (f *ClientFactory) sweepClients(now time.Time) {
+	f.lastSweep = now
+	for key, pc := range f.clients {
+		if now.Sub(pc.lastUsed) >= idleClientTTL {
+			pc.client.CloseIdleConnections()
+			delete(f.clients, key)
+		}
+	}
+}
+
+// poolKey identifies a transport configuration. Params are hashed, since
+// they may hold credentials such as Cloudflare service tokens; encoding
+// them as JSON sorts the keys, so equal maps give equal keys.
+func poolKey(t model.TransportConfig) string {
+	params, _ := json.Marshal(t.Params) // a map[string]string always encodes
+	sum := sha256.Sum256(params)
+	return t.Type + ":" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,123 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/secrets"
+	"github.com/AdamPippert/Lobstertank/internal/transport"
+)
+
+// poolGateway is a gateway with the given transport.
+func poolGateway(id, typ string, params map[string]string) *model.Gateway {
+	return &model.Gateway{
+		ID:        id,
+		Endpoint:  "https://" + id + ".example.com",
+		Transport: model.TransportConfig{Type: typ, Params: params},
+	}
+}
+
+func TestPoolSharesClientsByTransport(t *testing.T) {
+	sp, err := secrets.NewBuiltinProvider("")
+	if err != nil {
+		t.Fatalf("NewBuiltinProvider: %v", err)
+	}
+	f := NewClientFactory(transport.NewProvider(config.TransportConfig{Default: "https"}), sp,
+		config.RetryConfig{}, config.BreakerConfig{}, clock.NewFake(testEpoch))
+	edge := map[string]string{"client_id": "edge", "client_secret": "s3cret"}
+
+	base := f.ClientFor(poolGateway("gw-1", "cloudflare", edge)).httpClient
+	for _, tt := range []struct {
+		name  string
+		gw    *model.Gateway
+		equal bool
+	}{
+		{"equal params", poolGateway("gw-2", "cloudflare", map[string]string{"client_secret": "s3cret", "client_id": "edge"}), true},
+		{"different params", poolGateway("gw-3", "cloudflare", map[string]string{"client_id": "core", "client_secret": "s3cret"}), false},
+		{"no params", poolGateway("gw-4", "cloudflare", nil), false},
+		{"different type", poolGateway("gw-5", "https", edge), false},
+	} {
+		if got := f.ClientFor(tt.gw).httpClient == base; got != tt.equal {
+			t.Errorf("%s: shares gw-1's client = %v, want %v", tt.name, got, tt.equal)
+		}
+	}
+}
+
+func TestPoolKeepsMTLSMaterialApart(t *testing.T) {
+	ca := newTestCA(t)
+	sp, err := secrets.NewBuiltinProvider("")
+	if err != nil {
+		t.Fatalf("NewBuiltinProvider: %v", err)
+	}
+	f := newMTLSFactory(sp)
+	_, serverCA := mtlsGateway(t, ca)
+	a := storeClientCert(t, sp, ca, "gw-a", "https://a.example.com", serverCA)
+	b := storeClientCert(t, sp, ca, "gw-b", "https://b.example.com", serverCA)
+
+	// The gateways share a pooled client, each wrapped with its own
+	// certificate; the wrapper is reused across clients for one gateway.
+	wrapped := func(gw *model.Gateway) *Client {
+		t.Helper()
+		c := f.ClientFor(gw)
+		if err := c.useClientTLS(context.Background()); err != nil {
+			t.Fatalf("useClientTLS %s: %v", gw.ID, err)
+		}
+		return c
+	}
+	a1, a2, b1 := wrapped(a), wrapped(a), wrapped(b)
+	if base := f.httpClientFor(a); base != f.httpClientFor(b) {
+		t.Error("gateways with equal transports got different pooled clients")
+	} else if a1.httpClient == base || b1.httpClient == base {
+		t.Error("an mTLS client is the bare pooled client")
+	}
+	if a1.httpClient != a2.httpClient {
+		t.Error("two clients for gw-a built different certificate wrappers")
+	}
+	if a1.httpClient == b1.httpClient {
+		t.Error("gw-a and gw-b share a certificate wrapper")
+	}
+}
+
+func TestPoolSweepsIdleClients(t *testing.T) {
+	sp, err := secrets.NewBuiltinProvider("")
+	if err != nil {
+		t.Fatalf("NewBuiltinProvider: %v", err)
+	}
+	clk := clock.NewFake(testEpoch)
+	f := NewClientFactory(transport.NewProvider(config.TransportConfig{Default: "https"}), sp,
+		config.RetryConfig{}, config.BreakerConfig{}, clk)
+	busy := poolGateway("gw-busy", "https", nil)
+	idle := poolGateway("gw-idle", "https", map[string]string{"insecure": "true"})
+
+	busyClient, idleClient := f.httpClientFor(busy), f.httpClientFor(idle)
+	for range 10 {
+		clk.Advance(idleClientTTL / 10)
+		if f.httpClientFor(busy) != busyClient {
+			t.Fatal("client in use was replaced")
+		}
+	}
+	if len(f.clients) != 1 {
+		t.Errorf("pool holds %d clients, want only the busy one", len(f.clients))
+	}
+	if f.httpClientFor(idle) == idleClient {
+		t.Error("client idle for the TTL was reused")
+	}
+
+	// Sweeps are rate limited, so a client lingers past the TTL until the
+	// next one.
+	clk.Advance(idleClientTTL - poolSweepInterval/2)
+	f.httpClientFor(busy)
+	clk.Advance(poolSweepInterval / 2)
+	f.httpClientFor(busy)
+	if len(f.clients) != 2 {
+		t.Errorf("pool holds %d clients between sweeps, want 2", len(f.clients))
+	}
+	clk.Advance(poolSweepInterval / 2)
+	f.httpClientFor(busy)
+	if len(f.clients) != 1 {
+		t.Errorf("pool holds %d clients after a sweep, want 1", len(f.clients))
+	}
+}
@@ -0,0 +1,132 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/logging"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// Prober health-checks many gateways concurrently using a bounded worker pool.
+type Prober struct {
+	registry      *Registry
+	clientFactory *ClientFactory
+	concurrency   int
+	timeout       time.Duration
+}
+
+// NewProber creates a Prober. concurrency bounds the number of in-flight
+// probes and timeout caps each individual probe.
+func NewProber(r *Registry, cf *ClientFactory, concurrency int, timeout time.Duration) *Prober {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Prober{
+		registry:      r,
+		clientFactory: cf,
+		concurrency:   concurrency,
+		timeout:       timeout,
+	}
+}
+
+// ProbeAll health-checks the given gateways, persists each resulting status,
+// and returns the results in the same order as the input.
+func (p *Prober) ProbeAll(ctx context.Context, gateways []model.Gateway) []model.HealthCheckResult {
+	return p.ProbeStaggered(ctx, gateways, nil, nil)
+}
+
+// ProbeStaggered is ProbeAll with each gateway's probe held back by its
+// delay, as measured by clk, so that probes are spread over time rather than
+// started together. A nil delays starts every probe at once.
+func (p *Prober) ProbeStaggered(ctx context.Context, gateways []model.Gateway, delays []time.Duration, clk clock.Clock) []model.HealthCheckResult {
+	results := make([]model.HealthCheckResult, len(gateways))
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, p.concurrency)
+	)
+
+	for i := range gateways {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if delays != nil && delays[i] > 0 {
+				select {
+				case <-clk.After(delays[i]):
+				case <-ctx.Done():
+					results[i] = canceledResult(ctx, &gateways[i])
+					return
+				}
+			}
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				results[i] = canceledResult(ctx, &gateways[i])
+				return
+			}
+			defer func() { <-sem }()
+
+			results[i] = p.probe(ctx, &gateways[i])
+		}()
+	}
+
+	wg.Wait()
+	return results
+}
+
+// Timeout returns the cap on each individual probe; zero means none.
+func (p *Prober) Timeout() time.Duration {
+	return p.timeout
+}
+
+// canceledResult reports a probe that never ran because ctx ended.
+func canceledResult(ctx context.Context, gw *model.Gateway) model.HealthCheckResult {
+	return model.HealthCheckResult{
+		GatewayID: gw.ID,
+		Status:    model.StatusUnknown,
+		Error:     ctx.Err().Error(),
+		CheckedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// Check runs a single health check bounded by the per-gateway timeout. It
+// does not persist the result, so it can be used on unregistered gateways.
+func (p *Prober) Check(ctx context.Context, gw *model.Gateway) model.HealthCheckResult {
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+
+	client := p.clientFactory.ClientFor(gw)
+	result, err := client.HealthCheck(ctx)
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+		logging.LoggerFromContext(ctx).Debug("gateway health check skipped", "id", gw.ID, "error", err)
+	case err != nil:
+		logging.LoggerFromContext(ctx).Warn("gateway health check failed", "id", gw.ID, "error", err)
+	}
+	return *result
+}
+
+// probe checks a registered gateway and persists the resulting status.
+func (p *Prober) probe(ctx context.Context, gw *model.Gateway) model.HealthCheckResult {
+	result := p.Check(ctx, gw)
+
+	// A canceled batch says nothing about the gateway, so only persist when
+	// the probe itself ran to completion or hit its own timeout.
+	if ctx.Err() != nil {
+		return result
+	}
+	if err := p.registry.UpdateStatus(ctx, result); err != nil {
+		logging.LoggerFromContext(ctx).Warn("failed to persist gateway status", "id", gw.ID, "error", err)
+	}
+
+	return result
+}
@@ -2,12 +2,20 @@ package gateway
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/events"
+	"github.com/AdamPippert/Lobstertank/internal/logging"
 	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/secrets"
 	"github.com/AdamPippert/Lobstertank/internal/store"
 	"github.com/google/uuid"
 )
@@ -16,68 +24,278 @@ import (
 type Registry struct {
 	store   store.Store
 	auditor *audit.Logger
+	clock   clock.Clock
+	locks   sync.Map // gateway ID -> *sync.Mutex guarding read-modify-write
+
+	// keyLocks serializes creates sharing an idempotency key. Keys are
+	// client-chosen and unbounded, so they share a fixed set of mutexes.
+	keyLocks [idempotencyLockStripes]sync.Mutex
+
+	// latencies holds the round trip of each gateway's latest successful
+	// health check. It lives in memory only and is rebuilt as checks run.
+	latencies sync.Map // gateway ID -> time.Duration
+
+	cache *statusCache // nil disables caching reads
+
+	secrets      secrets.Provider
+	secretPrefix string // ref prefix for tokens the registry stores
+
+	historyRetention time.Duration // zero keeps status and health check history forever
+	deletedRetention time.Duration // zero keeps deleted gateways until purged explicitly
+
+	notifiers []TransitionNotifier
+	events    *events.Hub // nil disables event publishing
+
+	changes store.ChangeFeed // nil when writes are not shared between replicas
+}
+
+// TransitionNotifier is told about every status transition the registry
+// records. Implementations must not block.
+type TransitionNotifier interface {
+	NotifyTransition(gw *model.Gateway, t model.StatusTransition)
+}
+
+// NewRegistry creates a Registry backed by the given store. The clock
+// supplies enrollment and last-seen timestamps, and historyRetention bounds
+// how long status transitions and health checks are kept. Inline gateway
+// tokens are moved into sp under secretPrefix rather than stored with the
+// gateway.
+func NewRegistry(s store.Store, auditor *audit.Logger, clk clock.Clock, historyRetention time.Duration, sp secrets.Provider, secretPrefix string) *Registry {
+	return &Registry{
+		store:            s,
+		auditor:          auditor,
+		clock:            clk,
+		secrets:          sp,
+		secretPrefix:     secretPrefix,
+		historyRetention: historyRetention,
+	}
+}
+
+// SetStatusCacheTTL makes Get serve gateways read within the last ttl from
+// memory instead of the store. Zero disables the cache. It must be called
+// before the registry is in use.
+func (r *Registry) SetStatusCacheTTL(ttl time.Duration) {
+	r.cache = nil
+	if ttl > 0 {
+		r.cache = newStatusCache(ttl, r.clock)
+	}
+}
+
+// SetDeletedRetention makes Run purge gateways deleted more than d ago.
+// Zero keeps them until purged explicitly. It must be called before the
+// registry is in use.
+func (r *Registry) SetDeletedRetention(d time.Duration) {
+	r.deletedRetention = d
+}
+
+// AddNotifier registers n to receive status transitions. It must be called
+// before the registry is in use.
+func (r *Registry) AddNotifier(n TransitionNotifier) {
+	r.notifiers = append(r.notifiers, n)
+}
+
+// SetEventHub makes the registry publish lifecycle events to h. It must be
+// called before the registry is in use.
+func (r *Registry) SetEventHub(h *events.Hub) {
+	r.events = h
 }
 
-// NewRegistry creates a Registry backed by the given store.
-func NewRegistry(s store.Store, auditor *audit.Logger) *Registry {
-	return &Registry{store: s, auditor: auditor}
+// notify passes a recorded transition of gw to every notifier and publishes
+// it as an event.
+func (r *Registry) notify(gw *model.Gateway, t model.StatusTransition) {
+	for _, n := range r.notifiers {
+		n.NotifyTransition(gw, t)
+	}
+	r.events.Publish(events.GatewayStatusChanged, gw.ID, gw.OrgID, t)
 }
 
-// List returns all registered gateways.
-func (r *Registry) List(ctx context.Context) ([]model.Gateway, error) {
-	gateways, err := r.store.ListGateways(ctx)
+// List returns the registered gateways matching the filter in the given
+// order, limited to those the caller's organization owns. The store applies
+// the filter, so label selectors can use its indexes.
+func (r *Registry) List(ctx context.Context, filter model.GatewayFilter, sort model.ListSort) ([]model.Gateway, error) {
+	gateways, err := r.store.ListGateways(ctx, filter, sort)
 	if err != nil {
 		return nil, fmt.Errorf("list gateways: %w", err)
 	}
-	return gateways, nil
+	return filterVisible(ctx, gateways), nil
+}
+
+// ListDeleted is List for gateways that were deleted but not yet purged.
+func (r *Registry) ListDeleted(ctx context.Context, filter model.GatewayFilter, sort model.ListSort) ([]model.Gateway, error) {
+	gateways, err := r.store.ListDeletedGateways(ctx, filter, sort)
+	if err != nil {
+		return nil, fmt.Errorf("list deleted gateways: %w", err)
+	}
+	return filterVisible(ctx, gateways), nil
+}
+
+// filterVisible keeps the gateways the caller's organization owns.
+func filterVisible(ctx context.Context, gateways []model.Gateway) []model.Gateway {
+	matched := gateways[:0]
+	for i := range gateways {
+		if visible(ctx, &gateways[i]) {
+			matched = append(matched, gateways[i])
+		}
+	}
+	return matched
 }
 
-// Get returns a single gateway by ID.
+// Get returns a single gateway by ID, from the status cache when fresh. It
+// fails with ErrForbidden when another organization owns the gateway.
 func (r *Registry) Get(ctx context.Context, id string) (*model.Gateway, error) {
+	cached, gen := r.cache.get(id)
+	if cached != nil {
+		return cached, authorize(ctx, cached)
+	}
+
 	gw, err := r.store.GetGateway(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("get gateway %s: %w", id, err)
 	}
+	r.cache.put(gw, gen)
+	if err := authorize(ctx, gw); err != nil {
+		return nil, err
+	}
 	return gw, nil
 }
 
-// Create registers a new gateway and returns it.
-func (r *Registry) Create(ctx context.Context, req model.CreateGatewayRequest) (*model.Gateway, error) {
-	now := time.Now().UTC()
-	gw := &model.Gateway{
-		ID:          uuid.New().String(),
-		Name:        req.Name,
-		Description: req.Description,
-		Endpoint:    req.Endpoint,
-		Transport:   req.Transport,
-		Auth:        req.Auth,
-		Status:      model.StatusUnknown,
-		Labels:      req.Labels,
-		EnrolledAt:  now,
-		TTLSeconds:  req.TTLSeconds,
+// GetMany returns the gateways with the given IDs, in that order and
+// without repeats, reading every one not cached in a single query. It fails
+// with ErrNotFound naming every missing gateway, or with ErrForbidden for
+// the first the caller may not see.
+func (r *Registry) GetMany(ctx context.Context, ids []string) ([]model.Gateway, error) {
+	gateways, err := r.getMany(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range gateways {
+		if err := authorize(ctx, &gateways[i]); err != nil {
+			return nil, err
+		}
+	}
+	return gateways, nil
+}
+
+// getMany is GetMany without the authorization check.
+func (r *Registry) getMany(ctx context.Context, ids []string) ([]model.Gateway, error) {
+	ids = dedupe(ids)
+	byID := make(map[string]*model.Gateway, len(ids))
+	var (
+		missed []string
+		gen    uint64
+	)
+	for _, id := range ids {
+		cached, g := r.cache.get(id)
+		if cached != nil {
+			byID[id] = cached
+			continue
+		}
+		if len(missed) == 0 {
+			gen = g // the oldest generation, so a racing write is not cached
+		}
+		missed = append(missed, id)
+	}
+
+	if len(missed) > 0 {
+		found, missing, err := r.store.ListGatewaysByIDs(ctx, missed)
+		if err != nil {
+			return nil, fmt.Errorf("get gateways: %w", err)
+		}
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("%w: gateways not found: %s", store.ErrNotFound, strings.Join(missing, ", "))
+		}
+		for i := range found {
+			r.cache.put(&found[i], gen)
+			byID[found[i].ID] = &found[i]
+		}
+	}
+
+	gateways := make([]model.Gateway, 0, len(ids))
+	for _, id := range ids {
+		gateways = append(gateways, *byID[id])
+	}
+	return gateways, nil
+}
+
+// Create registers a new gateway and returns it. When initial is non-nil it
+// is the result of a pre-registration probe and seeds the stored status.
+func (r *Registry) Create(ctx context.Context, req model.CreateGatewayRequest, initial *model.HealthCheckResult) (*model.Gateway, error) {
+	now := r.clock.Now().UTC()
+	gw := gatewayFromRequest(req)
+	gw.ID = uuid.New().String()
+	gw.EnrolledAt = now
+	if err := assignOrg(ctx, gw, req.OrgID); err != nil {
+		return nil, err
+	}
+
+	detail := fmt.Sprintf("registered gateway %q at %s", gw.Name, gw.Endpoint)
+	if initial != nil {
+		gw.Status = initial.Status
+		if initial.Status == model.StatusOnline {
+			gw.LastSeenAt = &now
+		}
+		detail += fmt.Sprintf("; initial probe %s", initial.Status)
+		if initial.Error != "" {
+			detail += fmt.Sprintf(" (%s)", initial.Error)
+		}
+	}
+
+	if err := validateGateway(gw); err != nil {
+		return nil, err
+	}
+	if err := r.checkSecretRefs(gw, model.GatewayAuthConfig{}); err != nil {
+		return nil, err
+	}
+	if err := r.checkNameAvailable(ctx, gw.OrgID, gw.Name, ""); err != nil {
+		return nil, err
+	}
+	_, rollback, err := r.sealInlineToken(ctx, gw, "")
+	if err != nil {
+		return nil, err
 	}
 
 	if err := r.store.CreateGateway(ctx, gw); err != nil {
+		rollback()
+		if errors.Is(err, store.ErrConflict) {
+			return nil, fmt.Errorf("%w: %s", ErrNameConflict, gw.Name)
+		}
 		return nil, fmt.Errorf("create gateway: %w", err)
 	}
 
 	r.auditor.Log(ctx, audit.Event{
 		Action:   "gateway.created",
 		Resource: gw.ID,
-		Detail:   fmt.Sprintf("registered gateway %q at %s", gw.Name, gw.Endpoint),
+		Detail:   detail,
 	})
+	r.events.Publish(events.GatewayCreated, gw.ID, gw.OrgID, redactGateway(gw))
 
-	slog.Info("gateway registered", "id", gw.ID, "name", gw.Name)
+	logging.LoggerFromContext(ctx).Info("gateway registered", "id", gw.ID, "name", gw.Name)
 	return gw, nil
 }
 
-// Update modifies a registered gateway.
-func (r *Registry) Update(ctx context.Context, id string, req model.UpdateGatewayRequest) (*model.Gateway, error) {
-	gw, err := r.store.GetGateway(ctx, id)
-	if err != nil {
-		return nil, fmt.Errorf("get gateway for update %s: %w", id, err)
+// gatewayFromRequest builds an unsaved gateway from a registration request.
+// The caller assigns the ID and enrollment time.
+func gatewayFromRequest(req model.CreateGatewayRequest) *model.Gateway {
+	return &model.Gateway{
+		Name:        req.Name,
+		Description: req.Description,
+		Endpoint:    req.Endpoint,
+		Transport:   req.Transport,
+		Auth:        req.Auth,
+		Status:      model.StatusUnknown,
+		Labels:      req.Labels,
+		TTLSeconds:  req.TTLSeconds,
 	}
+}
+
+// Update modifies a registered gateway. Fields present in the request
+// replace the stored values wholesale, including the label map.
+func (r *Registry) Update(ctx context.Context, id string, req model.UpdateGatewayRequest) (*model.Gateway, error) {
+	return r.modify(ctx, id, func(gw *model.Gateway) { applyUpdate(gw, req) })
+}
 
+// applyUpdate replaces the fields of gw that req sets.
+func applyUpdate(gw *model.Gateway, req model.UpdateGatewayRequest) {
 	if req.Name != nil {
 		gw.Name = *req.Name
 	}
@@ -94,46 +312,315 @@ func (r *Registry) Update(ctx context.Context, id string, req model.UpdateGatewa
 		gw.Auth = *req.Auth
 	}
 	if req.Labels != nil {
-		gw.Labels = req.Labels
+		gw.Labels = maps.Clone(req.Labels)
 	}
 	if req.TTLSeconds != nil {
 		gw.TTLSeconds = req.TTLSeconds
 	}
+}
+
+// Patch applies a JSON Merge Patch to a registered gateway. Labels are merged
+// key by key: a null value removes the label and any other value upserts it.
+func (r *Registry) Patch(ctx context.Context, id string, req model.PatchGatewayRequest) (*model.Gateway, error) {
+	return r.modify(ctx, id, func(gw *model.Gateway) {
+		if req.Name != nil {
+			gw.Name = *req.Name
+		}
+		if req.Description != nil {
+			gw.Description = *req.Description
+		}
+		if req.Endpoint != nil {
+			gw.Endpoint = *req.Endpoint
+		}
+		if req.Transport != nil {
+			gw.Transport = *req.Transport
+		}
+		if req.Auth != nil {
+			gw.Auth = *req.Auth
+		}
+		if req.TTLSeconds != nil {
+			gw.TTLSeconds = req.TTLSeconds
+		}
+		for k, v := range req.Labels {
+			if v == nil {
+				delete(gw.Labels, k)
+				continue
+			}
+			if gw.Labels == nil {
+				gw.Labels = make(map[string]string)
+			}
+			gw.Labels[k] = *v
+		}
+	})
+}
+
+// modify performs a read-modify-write of a gateway under a per-gateway lock
+// so that concurrent partial updates do not overwrite each other.
+func (r *Registry) modify(ctx context.Context, id string, mutate func(*model.Gateway)) (*model.Gateway, error) {
+	unlock := r.lockGateway(id)
+	defer unlock()
+
+	gw, err := r.store.GetGateway(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("get gateway for update %s: %w", id, err)
+	}
+	if err := authorize(ctx, gw); err != nil {
+		return nil, err
+	}
+
+	prevName, prevAuth := gw.Name, gw.Auth
+	mutate(gw)
+
+	if err := validateGateway(gw); err != nil {
+		return nil, err
+	}
+	if err := r.checkSecretRefs(gw, prevAuth); err != nil {
+		return nil, err
+	}
+	if gw.Name != prevName {
+		if err := r.checkNameAvailable(ctx, gw.OrgID, gw.Name, gw.ID); err != nil {
+			return nil, err
+		}
+	}
+	_, rollback, err := r.sealInlineToken(ctx, gw, prevAuth.SecretRef)
+	if err != nil {
+		return nil, err
+	}
 
 	if err := r.store.UpdateGateway(ctx, gw); err != nil {
+		rollback()
+		if errors.Is(err, store.ErrConflict) {
+			return nil, fmt.Errorf("%w: %s", ErrNameConflict, gw.Name)
+		}
 		return nil, fmt.Errorf("update gateway %s: %w", id, err)
 	}
+	r.cache.invalidate(id)
 
 	r.auditor.Log(ctx, audit.Event{
 		Action:   "gateway.updated",
 		Resource: gw.ID,
 		Detail:   fmt.Sprintf("updated gateway %q", gw.Name),
 	})
+	r.events.Publish(events.GatewayUpdated, gw.ID, gw.OrgID, redactGateway(gw))
 
 	return gw, nil
 }
 
-// Delete removes a gateway registration.
+// lockGateway acquires the write lock for a gateway ID and returns its
+// release function. Locks are per process; they are not released on delete
+// since the entry is tiny and IDs are never reused.
+func (r *Registry) lockGateway(id string) func() {
+	v, _ := r.locks.LoadOrStore(id, &sync.Mutex{})
+	mu := v.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// Delete marks a gateway deleted. It disappears from listings and lookups
+// but keeps its configuration, history, and auth secret until it is
+// restored or purged.
 func (r *Registry) Delete(ctx context.Context, id string) error {
-	if err := r.store.DeleteGateway(ctx, id); err != nil {
+	unlock := r.lockGateway(id)
+	defer unlock()
+
+	gw, err := r.store.GetGateway(ctx, id)
+	if err != nil {
+		return fmt.Errorf("get gateway for delete %s: %w", id, err)
+	}
+	if err := authorize(ctx, gw); err != nil {
+		return err
+	}
+
+	if err := r.store.DeleteGateway(ctx, id, r.clock.Now()); err != nil {
 		return fmt.Errorf("delete gateway %s: %w", id, err)
 	}
+	r.cache.invalidate(id)
+	r.latencies.Delete(id)
 
 	r.auditor.Log(ctx, audit.Event{
 		Action:   "gateway.deleted",
 		Resource: id,
-		Detail:   "gateway deregistered",
+		Detail:   "gateway deregistered; restorable until purged",
 	})
+	r.events.Publish(events.GatewayDeleted, id, gw.OrgID, map[string]string{"id": id, "name": gw.Name})
 
-	slog.Info("gateway deregistered", "id", id)
+	logging.LoggerFromContext(ctx).Info("gateway deregistered", "id", id)
 	return nil
 }
 
-// UpdateStatus records a new status for a gateway.
-func (r *Registry) UpdateStatus(ctx context.Context, id string, status model.Status) error {
-	now := time.Now().UTC()
-	if err := r.store.UpdateGatewayStatus(ctx, id, string(status), &now); err != nil {
+// UpdateStatus records the outcome of a health check and appends it to the
+// gateway's health check history. When the status differs from the stored
+// one, the transition is appended to the gateway's status history. History
+// older than the retention window is pruned. Gateways in maintenance keep
+// their status.
+func (r *Registry) UpdateStatus(ctx context.Context, result model.HealthCheckResult) error {
+	id := result.GatewayID
+	unlock := r.lockGateway(id)
+	defer unlock()
+
+	prev, err := r.store.GetGateway(ctx, id)
+	if err != nil {
+		return fmt.Errorf("get gateway for status update %s: %w", id, err)
+	}
+
+	// Maintenance is left only explicitly or by the monitor once it expires.
+	if prev.Status == model.StatusMaintenance {
+		return nil
+	}
+
+	now := r.clock.Now().UTC()
+	if err := r.store.UpdateGatewayStatus(ctx, id, string(result.Status), &now); err != nil {
 		return fmt.Errorf("update status for %s: %w", id, err)
 	}
+	r.cache.invalidate(id)
+	r.events.Publish(events.GatewayHealthChecked, id, prev.OrgID, result)
+	r.recordLatency(result)
+
+	if err := r.store.InsertHealthCheck(ctx, &result, now); err != nil {
+		return fmt.Errorf("record health check for %s: %w", id, err)
+	}
+	if r.historyRetention > 0 {
+		if _, err := r.store.PruneHealthChecks(ctx, id, now.Add(-r.historyRetention)); err != nil {
+			slog.Warn("failed to prune health check history", "id", id, "error", err)
+		}
+	}
+
+	if prev.Status == result.Status {
+		return nil
+	}
+
+	transition := model.StatusTransition{
+		GatewayID:  id,
+		From:       prev.Status,
+		To:         result.Status,
+		Latency:    result.Latency,
+		Error:      result.Error,
+		ErrorKind:  result.ErrorKind,
+		ObservedAt: now,
+	}
+	if err := r.store.InsertStatusTransition(ctx, &transition); err != nil {
+		return fmt.Errorf("record status transition for %s: %w", id, err)
+	}
+
+	prev.Status = result.Status
+	prev.LastSeenAt = &now
+	r.notify(prev, transition)
+
+	if r.historyRetention > 0 {
+		if _, err := r.store.PruneStatusHistory(ctx, now.Add(-r.historyRetention)); err != nil {
+			slog.Warn("failed to prune status history", "error", err)
+		}
+	}
+	return nil
+}
+
+// recordLatency remembers the latency of a check that reached the gateway
+// and forgets it after one that did not.
+func (r *Registry) recordLatency(result model.HealthCheckResult) {
+	switch result.Status {
+	case model.StatusOnline, model.StatusDegraded:
+		r.latencies.Store(result.GatewayID, time.Duration(result.LatencyMillis)*time.Millisecond)
+	default:
+		r.latencies.Delete(result.GatewayID)
+	}
+}
+
+// RecentLatency returns the latency of the gateway's latest health check,
+// or false when the latest check failed or none has run since startup.
+func (r *Registry) RecentLatency(id string) (time.Duration, bool) {
+	v, ok := r.latencies.Load(id)
+	if !ok {
+		return 0, false
+	}
+	return v.(time.Duration), true
+}
+
+// History returns a gateway's status transitions since the given time along
+// with the fraction of the window it spent online, and its latest limit
+// health checks.
+func (r *Registry) History(ctx context.Context, id string, since time.Time, limit int) (*model.StatusHistory, error) {
+	gw, err := r.store.GetGateway(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("get gateway %s: %w", id, err)
+	}
+	if err := authorize(ctx, gw); err != nil {
+		return nil, err
+	}
+
+	transitions, err := r.store.ListStatusTransitions(ctx, id, since)
+	if err != nil {
+		return nil, fmt.Errorf("list status history for %s: %w", id, err)
+	}
+	checks, err := r.store.ListHealthChecks(ctx, id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list health checks for %s: %w", id, err)
+	}
+
+	now := r.clock.Now().UTC()
+	return &model.StatusHistory{
+		GatewayID:     id,
+		Since:         since.UTC(),
+		Until:         now,
+		Transitions:   transitions,
+		UptimePercent: uptimePercent(gw, transitions, since, now),
+		Checks:        checks,
+	}, nil
+}
+
+// uptimePercent computes the share of [since, until] the gateway spent
+// online. The window is clipped to the enrollment time, and the status before
+// the first transition is taken from that transition's from-status (or the
+// current status when nothing changed in the window).
+func uptimePercent(gw *model.Gateway, transitions []model.StatusTransition, since, until time.Time) float64 {
+	if gw.EnrolledAt.After(since) {
+		since = gw.EnrolledAt
+	}
+	window := until.Sub(since)
+	if window <= 0 {
+		if gw.Status == model.StatusOnline {
+			return 100
+		}
+		return 0
+	}
+
+	status := gw.Status
+	if len(transitions) > 0 {
+		status = transitions[0].From
+	}
+
+	var online time.Duration
+	cursor := since
+	for _, t := range transitions {
+		at := t.ObservedAt
+		if at.Before(cursor) {
+			at = cursor
+		}
+		if status == model.StatusOnline {
+			online += at.Sub(cursor)
+		}
+		cursor = at
+		status = t.To
+	}
+	if status == model.StatusOnline {
+		online += until.Sub(cursor)
+	}
+
+	return float64(online) / float64(window) * 100
+}
+
+// checkNameAvailable returns ErrNameConflict if name is registered in org to
+// a gateway other than selfID. The unique index remains the final arbiter
+// for concurrent writers.
+func (r *Registry) checkNameAvailable(ctx context.Context, org, name, selfID string) error {
+	existing, err := r.store.GetGatewayByName(ctx, org, name)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("look up gateway name %q: %w", name, err)
+	}
+	if existing.ID != selfID {
+		return fmt.Errorf("%w: %s", ErrNameConflict, name)
+	}
 	return nil
 }
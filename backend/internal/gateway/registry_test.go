@@ -0,0 +1,143 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/secrets"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+)
+
+// testEpoch is the time test registries' fake clocks start at.
+var testEpoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newTestRegistry returns a registry on an in-memory SQLite store, with a
+// fake clock and an unencrypted builtin secrets provider.
+func newTestRegistry(t *testing.T) (*Registry, *clock.FakeClock) {
+	t.Helper()
+	s, err := store.NewSQLiteStore(":memory:", false, true)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	sp, err := secrets.NewBuiltinProvider("")
+	if err != nil {
+		t.Fatalf("NewBuiltinProvider: %v", err)
+	}
+	clk := clock.NewFake(testEpoch)
+	r := NewRegistry(s, audit.New(config.AuditConfig{}), clk, 0, sp, "builtin://gateways/")
+	return r, clk
+}
+
+// createGateway registers an HTTPS gateway named name with labels.
+func createGateway(t testing.TB, r *Registry, name string, labels map[string]string) *model.Gateway {
+	t.Helper()
+	return createGatewayAt(t, r, name, "https://"+name+".example.com", labels)
+}
+
+// createGatewayAt registers a gateway named name served at endpoint.
+func createGatewayAt(t testing.TB, r *Registry, name, endpoint string, labels map[string]string) *model.Gateway {
+	t.Helper()
+	gw, err := r.Create(context.Background(), model.CreateGatewayRequest{
+		Name:      name,
+		Endpoint:  endpoint,
+		Transport: model.TransportConfig{Type: "https"},
+		Labels:    labels,
+	}, nil)
+	if err != nil {
+		t.Fatalf("Create %s: %v", name, err)
+	}
+	return gw
+}
+
+func TestPatchMergesLabels(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		want  map[string]string
+	}{
+		{"upsert", `{"labels":{"tier":"gold","env":"staging"}}`, map[string]string{"env": "staging", "region": "eu", "tier": "gold"}},
+		{"null removes", `{"labels":{"region":null}}`, map[string]string{"env": "prod"}},
+		{"unknown null", `{"labels":{"missing":null}}`, map[string]string{"env": "prod", "region": "eu"}},
+		{"absent untouched", `{"description":"edge node"}`, map[string]string{"env": "prod", "region": "eu"}},
+		{"empty untouched", `{"labels":{}}`, map[string]string{"env": "prod", "region": "eu"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newTestRegistry(t)
+			gw := createGateway(t, r, "edge", map[string]string{"env": "prod", "region": "eu"})
+
+			var req model.PatchGatewayRequest
+			if err := json.Unmarshal([]byte(tt.patch), &req); err != nil {
+				t.Fatalf("decode patch: %v", err)
+			}
+			patched, err := r.Patch(context.Background(), gw.ID, req)
+			if err != nil {
+				t.Fatalf("Patch: %v", err)
+			}
+			stored, err := r.Get(context.Background(), gw.ID)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			for _, got := range []map[string]string{patched.Labels, stored.Labels} {
+				if !maps.Equal(got, tt.want) {
+					t.Errorf("labels = %v, want %v", got, tt.want)
+				}
+			}
+			if stored.Name != "edge" || stored.Endpoint != gw.Endpoint {
+				t.Errorf("patch changed fields it did not set: %+v", stored)
+			}
+		})
+	}
+}
+
+func TestUpdateReplacesLabels(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	gw := createGateway(t, r, "edge", map[string]string{"env": "prod", "region": "eu"})
+
+	updated, err := r.Update(context.Background(), gw.ID, model.UpdateGatewayRequest{Labels: map[string]string{"tier": "gold"}})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if want := map[string]string{"tier": "gold"}; !maps.Equal(updated.Labels, want) {
+		t.Errorf("labels = %v, want %v", updated.Labels, want)
+	}
+}
+
+func TestConcurrentPatchesKeepEveryLabel(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	gw := createGateway(t, r, "edge", nil)
+
+	const writers = 16
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v := "yes"
+			if _, err := r.Patch(context.Background(), gw.ID, model.PatchGatewayRequest{
+				Labels: map[string]*string{fmt.Sprintf("writer-%d", i): &v},
+			}); err != nil {
+				t.Errorf("Patch %d: %v", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	stored, err := r.Get(context.Background(), gw.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if len(stored.Labels) != writers {
+		t.Errorf("%d labels survived, want all %d: %v", len(stored.Labels), writers, stored.Labels)
+	}
+}
@@ -0,0 +1,135 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/config"
+)
+
+// Transport params that override the default retry policy for one gateway.
+const (
+	paramRetryMax     = "retry_max"
+	paramRetryBackoff = "retry_backoff"
+)
+
+// retryPolicy controls how transport-level failures are retried.
+type retryPolicy struct {
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	jitter         float64
+}
+
+// retryPolicyFor returns the default policy with any per-gateway overrides
+// from params applied. Malformed overrides are rejected by validateGateway,
+// so they are ignored here.
+func retryPolicyFor(defaults config.RetryConfig, params map[string]string) retryPolicy {
+	p := retryPolicy{
+		maxRetries:     defaults.MaxRetries,
+		initialBackoff: defaults.InitialBackoff,
+		maxBackoff:     defaults.MaxBackoff,
+		jitter:         defaults.Jitter,
+	}
+	if n, err := strconv.Atoi(params[paramRetryMax]); err == nil && n >= 0 {
+		p.maxRetries = n
+	}
+	if d, err := time.ParseDuration(params[paramRetryBackoff]); err == nil && d >= 0 {
+		p.initialBackoff = d
+	}
+	if p.maxBackoff < p.initialBackoff {
+		p.maxBackoff = p.initialBackoff
+	}
+	return p
+}
+
+// validateRetryParams checks the per-gateway retry overrides, if present.
+func validateRetryParams(params map[string]string, verr *ValidationError) {
+	if v, ok := params[paramRetryMax]; ok {
+		if n, err := strconv.Atoi(v); err != nil || n < 0 {
+			verr.add("transport.params."+paramRetryMax, "must be a non-negative integer")
+		}
+	}
+	if v, ok := params[paramRetryBackoff]; ok {
+		if d, err := time.ParseDuration(v); err != nil || d < 0 {
+			verr.add("transport.params."+paramRetryBackoff, "must be a non-negative duration such as 250ms")
+		}
+	}
+}
+
+// backoff returns the delay before retry number n (starting at 1).
+func (p retryPolicy) backoff(n int) time.Duration {
+	d := p.initialBackoff
+	for i := 1; i < n && d < p.maxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, p.maxBackoff)
+	if p.jitter > 0 && d > 0 {
+		spread := float64(d) * p.jitter
+		d += time.Duration(spread * (2*rand.Float64() - 1))
+	}
+	return d
+}
+
+// doWithRetry sends req, retrying when the round trip fails before any
+// response is received. Callers only use it for requests that are safe to
+// repeat under that condition. Retries stop early when the context is done or
+// the next delay would run past its deadline. It returns the number of
+// attempts made.
+func (c *Client) doWithRetry(req *http.Request) (*http.Response, int, error) {
+	ctx := req.Context()
+	attempt := 1
+	for {
+		resp, err := c.httpClient.Do(req)
+		if err == nil || attempt > c.retry.maxRetries || ctx.Err() != nil {
+			return resp, attempt, err
+		}
+
+		delay := c.retry.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+			return nil, attempt, err
+		}
+		if werr := sleepCtx(ctx, delay); werr != nil {
+			return nil, attempt, err
+		}
+
+		next, cerr := cloneRequest(ctx, req)
+		if cerr != nil {
+			return nil, attempt, fmt.Errorf("%w (retry aborted: %v)", err, cerr)
+		}
+		req = next
+		attempt++
+	}
+}
+
+// cloneRequest copies req with a fresh body so it can be sent again.
+func cloneRequest(ctx context.Context, req *http.Request) (*http.Request, error) {
+	next := req.Clone(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		next.Body = body
+	}
+	return next, nil
+}
+
+// sleepCtx waits for d or until ctx is done, whichever comes first.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,210 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/secrets"
+	"github.com/AdamPippert/Lobstertank/internal/transport"
+)
+
+// newRetryClient returns a client with the default retry policy rc for a
+// gateway served at endpoint with transport params.
+func newRetryClient(t *testing.T, rc config.RetryConfig, endpoint string, params map[string]string) *Client {
+	t.Helper()
+	sp, err := secrets.NewBuiltinProvider("")
+	if err != nil {
+		t.Fatalf("NewBuiltinProvider: %v", err)
+	}
+	cf := NewClientFactory(transport.NewProvider(config.TransportConfig{Default: "https"}), sp,
+		rc, config.BreakerConfig{}, clock.NewFake(testEpoch))
+	return cf.ClientFor(&model.Gateway{
+		ID:        "gw-1",
+		Name:      "alpha",
+		Endpoint:  endpoint,
+		Transport: model.TransportConfig{Type: "https", Params: params},
+	})
+}
+
+// flakyGateway serves with handle once it has dropped the connection of its
+// first failures requests without answering. hits counts every request.
+func flakyGateway(t *testing.T, failures int32, handle http.HandlerFunc) (endpoint string, hits *atomic.Int32) {
+	t.Helper()
+	hits = new(atomic.Int32)
+	endpoint = fakeGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) <= failures {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Errorf("Hijack: %v", err)
+				return
+			}
+			conn.Close()
+			return
+		}
+		handle(w, r)
+	})
+	return endpoint, hits
+}
+
+func answer(status int) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(`{"response":"ok"}`))
+	}
+}
+
+func TestRetryPolicyFor(t *testing.T) {
+	defaults := config.RetryConfig{MaxRetries: 2, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Jitter: 0.2}
+	tests := []struct {
+		name   string
+		params map[string]string
+		want   retryPolicy
+	}{
+		{"defaults", nil, retryPolicy{2, 100 * time.Millisecond, time.Second, 0.2}},
+		{"overridden", map[string]string{"retry_max": "5", "retry_backoff": "250ms"}, retryPolicy{5, 250 * time.Millisecond, time.Second, 0.2}},
+		{"retries disabled", map[string]string{"retry_max": "0"}, retryPolicy{0, 100 * time.Millisecond, time.Second, 0.2}},
+		{"backoff above the maximum", map[string]string{"retry_backoff": "5s"}, retryPolicy{2, 5 * time.Second, 5 * time.Second, 0.2}},
+		{"malformed ignored", map[string]string{"retry_max": "-1", "retry_backoff": "soon"}, retryPolicy{2, 100 * time.Millisecond, time.Second, 0.2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryPolicyFor(defaults, tt.params); got != tt.want {
+				t.Errorf("retryPolicyFor = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := retryPolicy{initialBackoff: 100 * time.Millisecond, maxBackoff: time.Second}
+	// Retry n waits the initial backoff doubled n-1 times, up to the maximum.
+	for n, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		if got := p.backoff(n + 1); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", n+1, got, want)
+		}
+	}
+
+	p.jitter = 0.5
+	for range 100 {
+		if got := p.backoff(3); got < 200*time.Millisecond || got > 600*time.Millisecond {
+			t.Fatalf("backoff(3) with jitter 0.5 = %v, want within 400ms ± 200ms", got)
+		}
+	}
+}
+
+func TestHealthCheckRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int32
+		status       int
+		maxRetries   int
+		params       map[string]string
+		wantAttempts int
+		wantStatus   model.Status
+	}{
+		{"recovers within the budget", 2, http.StatusOK, 3, nil, 3, model.StatusOnline},
+		{"budget spent", 5, http.StatusOK, 2, nil, 3, model.StatusOffline},
+		{"retries disabled", 1, http.StatusOK, 0, nil, 1, model.StatusOffline},
+		{"gateway override", 5, http.StatusOK, 4, map[string]string{"retry_max": "1"}, 2, model.StatusOffline},
+		{"error status not retried", 0, http.StatusServiceUnavailable, 3, nil, 1, model.StatusDegraded},
+		{"client error not retried", 0, http.StatusUnauthorized, 3, nil, 1, model.StatusUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint, hits := flakyGateway(t, tt.failures, answer(tt.status))
+			c := newRetryClient(t, config.RetryConfig{MaxRetries: tt.maxRetries}, endpoint, tt.params)
+
+			res, err := c.HealthCheck(context.Background())
+			if err != nil {
+				t.Fatalf("HealthCheck: %v", err)
+			}
+			if res.Attempts != tt.wantAttempts || res.Status != tt.wantStatus {
+				t.Errorf("HealthCheck = %d attempts, %s; want %d, %s", res.Attempts, res.Status, tt.wantAttempts, tt.wantStatus)
+			}
+			if n := hits.Load(); n != int32(tt.wantAttempts) {
+				t.Errorf("gateway saw %d requests, want %d", n, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryWaitsBackoff(t *testing.T) {
+	endpoint, _ := flakyGateway(t, 2, answer(http.StatusOK))
+	c := newRetryClient(t, config.RetryConfig{MaxRetries: 2, InitialBackoff: 30 * time.Millisecond, MaxBackoff: time.Second}, endpoint, nil)
+
+	start := time.Now()
+	res, err := c.HealthCheck(context.Background())
+	if err != nil || res.Status != model.StatusOnline {
+		t.Fatalf("HealthCheck = %+v, %v; want online", res, err)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("two retries took %v, want at least 30ms + 60ms of backoff", elapsed)
+	}
+}
+
+func TestRetryRespectsDeadline(t *testing.T) {
+	endpoint, hits := flakyGateway(t, 5, answer(http.StatusOK))
+	c := newRetryClient(t, config.RetryConfig{MaxRetries: 5, InitialBackoff: time.Minute, MaxBackoff: time.Minute}, endpoint, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The first delay would run past the deadline, so no retry is made.
+	start := time.Now()
+	res, err := c.HealthCheck(ctx)
+	if err != nil || res.Status != model.StatusOffline || res.Attempts != 1 {
+		t.Fatalf("HealthCheck = %+v, %v; want offline after 1 attempt", res, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("HealthCheck took %v, want it to give up without waiting", elapsed)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("gateway saw %d requests, want 1", n)
+	}
+}
+
+func TestSendPromptRetries(t *testing.T) {
+	cutOff := func(w http.ResponseWriter, _ *http.Request) {
+		// Promise more than is sent, so the response breaks off midway.
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte(`{"response":`))
+	}
+	tests := []struct {
+		name         string
+		failures     int32
+		handle       http.HandlerFunc
+		wantErr      bool
+		wantUpstream int // status of the *UpstreamError, if any
+		wantHits     int32
+	}{
+		{"dropped before answering", 2, answer(http.StatusOK), false, 0, 3},
+		{"error answer", 0, answer(http.StatusBadGateway), true, http.StatusBadGateway, 1},
+		{"cut off while answering", 0, cutOff, true, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint, hits := flakyGateway(t, tt.failures, tt.handle)
+			c := newRetryClient(t, config.RetryConfig{MaxRetries: 3}, endpoint, nil)
+
+			_, _, err := c.SendPrompt(context.Background(), "hello", nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SendPrompt: got %v, want error %t", err, tt.wantErr)
+			}
+			var upstream *UpstreamError
+			if errors.As(err, &upstream) != (tt.wantUpstream != 0) || upstream != nil && upstream.StatusCode != tt.wantUpstream {
+				t.Errorf("SendPrompt: got %v, want upstream status %d", err, tt.wantUpstream)
+			}
+			// A prompt the gateway has answered, even in part, may have run,
+			// so it is never sent again.
+			if n := hits.Load(); n != tt.wantHits {
+				t.Errorf("gateway saw %d prompts, want %d", n, tt.wantHits)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/logging"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// inlineTokenParam is the auth param through which a bearer token may be
+// supplied directly instead of by secret reference.
+const inlineTokenParam = "token"
+
+// gatewaySecretRef returns the secrets provider ref under which the registry
+// keeps a gateway's bearer token.
+func (r *Registry) gatewaySecretRef(id string) string {
+	return r.secretPrefix + id + "/token"
+}
+
+// sealInlineToken moves an inline bearer token into the secrets provider and
+// points Auth.SecretRef at it, so the token is never written to the gateways
+// table. prevRef is the secret ref the stored gateway names, or "" for a new
+// one. It reports whether the gateway was changed and returns a function
+// that undoes the write to the provider, for when storing the gateway fails.
+func (r *Registry) sealInlineToken(ctx context.Context, gw *model.Gateway, prevRef string) (bool, func(), error) {
+	rollback := func() {}
+	token, ok := gw.Auth.Params[inlineTokenParam]
+	if !ok {
+		return false, rollback, nil
+	}
+
+	if token != "" {
+		ref := r.gatewaySecretRef(gw.ID)
+		// The stored gateway may already use a sealed token, which the
+		// rollback must put back rather than delete.
+		restore, hadPrev := "", prevRef == ref
+		if hadPrev {
+			var err error
+			if restore, err = r.secrets.Resolve(ctx, ref); err != nil {
+				return false, rollback, fmt.Errorf("read token of gateway %s: %w", gw.ID, err)
+			}
+		}
+		if err := r.secrets.Store(ctx, ref, token); err != nil {
+			return false, rollback, fmt.Errorf("store token for gateway %s: %w", gw.ID, err)
+		}
+		gw.Auth.SecretRef = ref
+
+		rollback = func() {
+			ctx := context.WithoutCancel(ctx)
+			var err error
+			if hadPrev {
+				err = r.secrets.Store(ctx, ref, restore)
+			} else {
+				err = r.secrets.Delete(ctx, ref)
+			}
+			if err != nil {
+				logging.LoggerFromContext(ctx).Warn("failed to roll back gateway token", "id", gw.ID, "ref", ref, "error", err)
+			}
+		}
+	}
+
+	params := maps.Clone(gw.Auth.Params)
+	delete(params, inlineTokenParam)
+	if len(params) == 0 {
+		params = nil
+	}
+	gw.Auth.Params = params
+	return true, rollback, nil
+}
+
+// ownsSecret reports whether ref was created by Lobstertank for a gateway,
+// as opposed to one an operator manages and may share between gateways.
+func (r *Registry) ownsSecret(ref string) bool {
+	return r.secretPrefix != "" && strings.HasPrefix(ref, r.secretPrefix)
+}
+
+// SecretRefs returns the secret refs auth settings name, by field: the
+// secret ref itself and, for mtls, the key and CA bundle refs.
+func SecretRefs(auth model.GatewayAuthConfig) map[string]string {
+	refs := make(map[string]string)
+	if auth.SecretRef != "" {
+		refs["auth.secret_ref"] = auth.SecretRef
+	}
+	for _, param := range []string{paramKeyRef, paramCARef} {
+		if ref := auth.Params[param]; ref != "" {
+			refs["auth.params."+param] = ref
+		}
+	}
+	return refs
+}
+
+// checkSecretRefs rejects secret refs gw newly points at that the registry
+// created for another gateway, so that registering or updating a gateway
+// cannot borrow another one's credentials. prev is the auth settings gw had
+// before the change; refs it already named are left alone.
+func (r *Registry) checkSecretRefs(gw *model.Gateway, prev model.GatewayAuthConfig) error {
+	before := SecretRefs(prev)
+	refs := SecretRefs(gw.Auth)
+	verr := &ValidationError{}
+	for _, field := range slices.Sorted(maps.Keys(refs)) {
+		ref := refs[field]
+		if ref == before[field] || !r.ownsSecret(ref) || (gw.ID != "" && strings.HasPrefix(ref, r.secretPrefix+gw.ID+"/")) {
+			continue
+		}
+		verr.add(field, "must not reference another gateway's secret")
+	}
+	if len(verr.Violations) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// cleanupSecrets deletes the auth secrets a purged gateway owns: its token
+// or certificate, and for mtls its key and CA bundle. It describes the
+// outcome for the audit trail, or returns "" when there was nothing to do.
+func (r *Registry) cleanupSecrets(ctx context.Context, gw *model.Gateway, keep bool) string {
+	refs := SecretRefs(gw.Auth)
+	var outcomes []string
+	seen := make(map[string]bool)
+	for _, field := range slices.Sorted(maps.Keys(refs)) {
+		ref := refs[field]
+		if !r.ownsSecret(ref) || seen[ref] {
+			continue
+		}
+		seen[ref] = true
+
+		if keep {
+			outcomes = append(outcomes, "secret "+ref+" kept")
+			continue
+		}
+		if err := r.secrets.Delete(ctx, ref); err != nil {
+			logging.LoggerFromContext(ctx).Warn("failed to delete gateway secret", "id", gw.ID, "ref", ref, "error", err)
+			outcomes = append(outcomes, "secret "+ref+" cleanup failed: "+err.Error())
+			continue
+		}
+		outcomes = append(outcomes, "secret "+ref+" deleted")
+	}
+	return strings.Join(outcomes, "; ")
+}
+
+// MigrateInlineSecrets seals the inline tokens of gateways registered before
+// tokens were moved into the secrets provider. It returns the number of
+// gateways migrated.
+func (r *Registry) MigrateInlineSecrets(ctx context.Context) (int, error) {
+	gateways, err := r.store.ListGateways(ctx, model.GatewayFilter{}, model.ListSort{})
+	if err != nil {
+		return 0, fmt.Errorf("list gateways: %w", err)
+	}
+
+	migrated := 0
+	for i := range gateways {
+		if _, ok := gateways[i].Auth.Params[inlineTokenParam]; !ok {
+			continue
+		}
+		if err := r.migrateInlineSecret(ctx, gateways[i].ID); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, nil
+}
+
+func (r *Registry) migrateInlineSecret(ctx context.Context, id string) error {
+	unlock := r.lockGateway(id)
+	defer unlock()
+
+	// Re-read under the lock in case the gateway changed since listing.
+	gw, err := r.store.GetGateway(ctx, id)
+	if err != nil {
+		return fmt.Errorf("get gateway %s: %w", id, err)
+	}
+	changed, rollback, err := r.sealInlineToken(ctx, gw, gw.Auth.SecretRef)
+	if err != nil || !changed {
+		return err
+	}
+	if err := r.store.UpdateGateway(ctx, gw); err != nil {
+		rollback()
+		return fmt.Errorf("update gateway %s: %w", id, err)
+	}
+	r.cache.invalidate(id)
+
+	r.auditor.Log(ctx, audit.Event{
+		Action:   "gateway.secret_migrated",
+		Resource: id,
+		Detail:   fmt.Sprintf("moved inline token to %s", gw.Auth.SecretRef),
+	})
+	logging.LoggerFromContext(ctx).Info("gateway token migrated to secrets provider", "id", id)
+	return nil
+}
+
+// redactGateway returns a copy of gw that is safe to include in API
+// responses: any inline bearer token is removed.
+func redactGateway(gw *model.Gateway) *model.Gateway {
+	if _, ok := gw.Auth.Params[inlineTokenParam]; !ok {
+		return gw
+	}
+	out := *gw
+	out.Auth.Params = maps.Clone(gw.Auth.Params)
+	delete(out.Auth.Params, inlineTokenParam)
+	return &out
+}
@@ -0,0 +1,306 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/secrets"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+)
+
+// violatedFields returns the fields err reports, or nil when err is not a
+// validation error.
+func violatedFields(err error) []string {
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		return nil
+	}
+	fields := make([]string, len(verr.Violations))
+	for i, v := range verr.Violations {
+		fields[i] = v.Field
+	}
+	return fields
+}
+
+func TestSecretRefsCannotNameAnotherGatewaysSecret(t *testing.T) {
+	r, _ := newTestRegistry(t)
+	ctx := context.Background()
+
+	victim, err := r.Create(ctx, model.CreateGatewayRequest{
+		Name:      "victim",
+		Endpoint:  "https://victim.example.com",
+		Transport: model.TransportConfig{Type: "https"},
+		Auth:      model.GatewayAuthConfig{Type: "token", Params: map[string]string{"token": "s3cr3t"}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Create victim: %v", err)
+	}
+	stolen := victim.Auth.SecretRef
+	if stolen != r.gatewaySecretRef(victim.ID) {
+		t.Fatalf("victim secret ref = %q, want the sealed token", stolen)
+	}
+	attacker := createGateway(t, r, "attacker", map[string]string{"team": "red"})
+
+	borrowing := model.GatewayAuthConfig{Type: "token", SecretRef: stolen}
+	_, err = r.Create(ctx, model.CreateGatewayRequest{
+		Name:      "thief",
+		Endpoint:  "https://thief.example.com",
+		Transport: model.TransportConfig{Type: "https"},
+		Auth:      borrowing,
+	}, nil)
+	if got := violatedFields(err); len(got) != 1 || got[0] != "auth.secret_ref" {
+		t.Errorf("create naming another gateway's token: err = %v, want an auth.secret_ref violation", err)
+	}
+	mtls := model.GatewayAuthConfig{Type: "mtls", SecretRef: "vault://certs/edge", Params: map[string]string{"key_ref": stolen}}
+	if _, err := r.Update(ctx, attacker.ID, model.UpdateGatewayRequest{Auth: &mtls}); len(violatedFields(err)) != 1 || violatedFields(err)[0] != "auth.params.key_ref" {
+		t.Errorf("update naming another gateway's secret as key_ref: err = %v, want an auth.params.key_ref violation", err)
+	}
+	if _, err := r.UpdateMany(ctx, map[string]string{"team": "red"}, model.UpdateGatewayRequest{Auth: &borrowing}); violatedFields(err) == nil {
+		t.Errorf("bulk update naming another gateway's token: err = %v, want a validation error", err)
+	}
+	_, err = r.Import(ctx, &model.GatewayBundle{Version: 1, Gateways: []model.GatewaySpec{{
+		Name:      "imported",
+		Endpoint:  "https://imported.example.com",
+		Transport: model.TransportConfig{Type: "https"},
+		Auth:      borrowing,
+	}}}, false)
+	if got := violatedFields(err); len(got) != 1 || got[0] != "gateways[0].auth.secret_ref" {
+		t.Errorf("import naming another gateway's token: err = %v, want a gateways[0].auth.secret_ref violation", err)
+	}
+
+	// Secrets an operator manages may be shared, and a gateway keeps its own.
+	shared := model.GatewayAuthConfig{Type: "token", SecretRef: "builtin://shared/token"}
+	if _, err := r.Update(ctx, attacker.ID, model.UpdateGatewayRequest{Auth: &shared}); err != nil {
+		t.Errorf("update naming an operator-managed secret: %v", err)
+	}
+	desc := "still mine"
+	if _, err := r.Update(ctx, victim.ID, model.UpdateGatewayRequest{Description: &desc, Auth: &victim.Auth}); err != nil {
+		t.Errorf("update keeping the gateway's own token: %v", err)
+	}
+}
+
+// recordingSecrets is a secrets provider that records the refs deleted
+// from it.
+type recordingSecrets struct {
+	*secrets.BuiltinProvider
+	deleted []string
+}
+
+func (p *recordingSecrets) Delete(ctx context.Context, ref string) error {
+	p.deleted = append(p.deleted, ref)
+	return p.BuiltinProvider.Delete(ctx, ref)
+}
+
+// failingWrites is a store whose gateway writes fail once armed.
+type failingWrites struct {
+	store.Store
+	fail bool
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (s *failingWrites) CreateGateway(ctx context.Context, gw *model.Gateway) error {
+	if s.fail {
+		return errWriteFailed
+	}
+	return s.Store.CreateGateway(ctx, gw)
+}
+
+func (s *failingWrites) UpdateGateway(ctx context.Context, gw *model.Gateway) error {
+	if s.fail {
+		return errWriteFailed
+	}
+	return s.Store.UpdateGateway(ctx, gw)
+}
+
+// newRecordingRegistry returns a registry over an in-memory store whose
+// writes can be made to fail, keeping secrets in a recording provider.
+func newRecordingRegistry(t *testing.T) (*Registry, *failingWrites, *recordingSecrets) {
+	t.Helper()
+	s, err := store.NewSQLiteStore(":memory:", false, true)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	builtin, err := secrets.NewBuiltinProvider("")
+	if err != nil {
+		t.Fatalf("NewBuiltinProvider: %v", err)
+	}
+	fs, sp := &failingWrites{Store: s}, &recordingSecrets{BuiltinProvider: builtin}
+	return NewRegistry(fs, audit.New(config.AuditConfig{}), clock.NewFake(testEpoch), 0, sp, "builtin://gateways/"), fs, sp
+}
+
+// createMTLSGateway registers a gateway presenting a client certificate
+// whose certificate, key, and CA bundle are all kept by the registry, plus
+// a shared operator-managed secret it does not own.
+func createMTLSGateway(t *testing.T, r *Registry, sp *recordingSecrets, name string) (*model.Gateway, []string) {
+	t.Helper()
+	ctx := context.Background()
+	gw := createGateway(t, r, name, nil)
+	prefix := "builtin://gateways/" + gw.ID + "/"
+	owned := []string{prefix + "ca", prefix + "cert", prefix + "key"}
+	for _, ref := range append(owned, "builtin://shared/ca") {
+		if err := sp.Store(ctx, ref, "pem"); err != nil {
+			t.Fatalf("Store %s: %v", ref, err)
+		}
+	}
+	auth := model.GatewayAuthConfig{Type: "mtls", SecretRef: prefix + "cert",
+		Params: map[string]string{"key_ref": prefix + "key", "ca_ref": prefix + "ca"}}
+	gw, err := r.Update(ctx, gw.ID, model.UpdateGatewayRequest{Auth: &auth})
+	if err != nil {
+		t.Fatalf("Update %s: %v", name, err)
+	}
+	return gw, owned
+}
+
+func TestPurgeDeletesOwnedSecrets(t *testing.T) {
+	r, _, sp := newRecordingRegistry(t)
+	h := newTestHandler(t, r)
+
+	purge := func(id, query string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/gateways/"+id+query, nil)
+		req.SetPathValue("id", id)
+		rec := httptest.NewRecorder()
+		h.Delete(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("DELETE %s: status = %d, want 204: %s", query, rec.Code, rec.Body)
+		}
+	}
+
+	gw, owned := createMTLSGateway(t, r, sp, "edge")
+	purge(gw.ID, "?purge=true")
+	if got := slices.Sorted(slices.Values(sp.deleted)); !slices.Equal(got, owned) {
+		t.Errorf("deleted %v, want the owned refs %v", got, owned)
+	}
+	for _, ref := range owned {
+		if _, err := sp.Resolve(context.Background(), ref); err == nil {
+			t.Errorf("%s still resolves after purge", ref)
+		}
+	}
+
+	// A shared secret is left alone, and keep_secret leaves owned ones too.
+	sp.deleted = nil
+	shared := createGateway(t, r, "shared", nil)
+	auth := model.GatewayAuthConfig{Type: "token", SecretRef: "builtin://shared/ca"}
+	if _, err := r.Update(context.Background(), shared.ID, model.UpdateGatewayRequest{Auth: &auth}); err != nil {
+		t.Fatalf("Update shared: %v", err)
+	}
+	purge(shared.ID, "?purge=true")
+	kept, _ := createMTLSGateway(t, r, sp, "kept")
+	purge(kept.ID, "?purge=true&keep_secret=true")
+	if len(sp.deleted) != 0 {
+		t.Errorf("deleted %v, want nothing", sp.deleted)
+	}
+
+	// A soft delete keeps the secrets for a restore.
+	soft, _ := createMTLSGateway(t, r, sp, "soft")
+	purge(soft.ID, "")
+	if len(sp.deleted) != 0 {
+		t.Errorf("soft delete deleted %v, want nothing", sp.deleted)
+	}
+}
+
+func TestSealedTokenRolledBackWhenWriteFails(t *testing.T) {
+	r, fs, sp := newRecordingRegistry(t)
+	ctx := context.Background()
+	inline := func(token string) model.GatewayAuthConfig {
+		return model.GatewayAuthConfig{Type: "token", Params: map[string]string{"token": token}}
+	}
+
+	// A failed create leaves no secret behind.
+	fs.fail = true
+	_, err := r.Create(ctx, model.CreateGatewayRequest{
+		Name:      "edge",
+		Endpoint:  "https://edge.example.com",
+		Transport: model.TransportConfig{Type: "https"},
+		Auth:      inline("first"),
+	}, nil)
+	if !errors.Is(err, errWriteFailed) {
+		t.Fatalf("Create: err = %v, want the store's error", err)
+	}
+	if len(sp.deleted) != 1 || !strings.HasPrefix(sp.deleted[0], "builtin://gateways/") {
+		t.Fatalf("deleted %v, want the token sealed for the failed create", sp.deleted)
+	}
+	if _, err := sp.Resolve(ctx, sp.deleted[0]); err == nil {
+		t.Errorf("%s still resolves after the failed create", sp.deleted[0])
+	}
+
+	// A failed update puts back the token the gateway already had.
+	fs.fail = false
+	gw, err := r.Create(ctx, model.CreateGatewayRequest{
+		Name:      "edge",
+		Endpoint:  "https://edge.example.com",
+		Transport: model.TransportConfig{Type: "https"},
+		Auth:      inline("first"),
+	}, nil)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	fs.fail = true
+	auth := inline("second")
+	if _, err := r.Update(ctx, gw.ID, model.UpdateGatewayRequest{Auth: &auth}); !errors.Is(err, errWriteFailed) {
+		t.Fatalf("Update: err = %v, want the store's error", err)
+	}
+	if token, err := sp.Resolve(ctx, gw.Auth.SecretRef); err != nil || token != "first" {
+		t.Errorf("token after the failed update = %q, %v; want the original", token, err)
+	}
+}
+
+func TestMigrateInlineSecrets(t *testing.T) {
+	r, _, sp := newRecordingRegistry(t)
+	ctx := context.Background()
+
+	// Rows written before tokens were sealed still hold them inline.
+	legacy := func(id, name, token string) {
+		t.Helper()
+		gw := &model.Gateway{
+			ID:         id,
+			Name:       name,
+			Endpoint:   "https://" + name + ".example.com",
+			Transport:  model.TransportConfig{Type: "https"},
+			Auth:       model.GatewayAuthConfig{Type: "token", Params: map[string]string{"token": token, "header": "X-Token"}},
+			Status:     model.StatusUnknown,
+			EnrolledAt: testEpoch,
+		}
+		if err := r.store.CreateGateway(ctx, gw); err != nil {
+			t.Fatalf("CreateGateway %s: %v", name, err)
+		}
+	}
+	legacy("gw-1", "alpha", "tok-1")
+	legacy("gw-2", "bravo", "tok-2")
+	createGateway(t, r, "sealed", nil)
+
+	n, err := r.MigrateInlineSecrets(ctx)
+	if err != nil || n != 2 {
+		t.Fatalf("MigrateInlineSecrets = %d, %v; want 2 gateways migrated", n, err)
+	}
+	for id, token := range map[string]string{"gw-1": "tok-1", "gw-2": "tok-2"} {
+		gw, err := r.store.GetGateway(ctx, id)
+		if err != nil {
+			t.Fatalf("GetGateway %s: %v", id, err)
+		}
+		if _, ok := gw.Auth.Params[inlineTokenParam]; ok || gw.Auth.Params["header"] != "X-Token" {
+			t.Errorf("%s auth params = %v, want only the header left", id, gw.Auth.Params)
+		}
+		if gw.Auth.SecretRef != r.gatewaySecretRef(id) {
+			t.Errorf("%s secret ref = %q, want %q", id, gw.Auth.SecretRef, r.gatewaySecretRef(id))
+		}
+		if got, err := sp.Resolve(ctx, gw.Auth.SecretRef); err != nil || got != token {
+			t.Errorf("%s sealed token = %q, %v; want %q", id, got, err, token)
+		}
+	}
+
+	if n, err := r.MigrateInlineSecrets(ctx); err != nil || n != 0 {
+		t.Errorf("second MigrateInlineSecrets = %d, %v; want nothing left to migrate", n, err)
+	}
+}
@@ -0,0 +1,83 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/logging"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// RecordUsage adds the usage of one successful prompt to the gateway's
+// counters for the current hour. Failures are logged rather than returned,
+// since the prompt itself already succeeded.
+func (r *Registry) RecordUsage(ctx context.Context, gatewayID string, u model.Usage) {
+	hour := r.clock.Now().UTC().Truncate(time.Hour)
+	if err := r.store.AddUsage(ctx, gatewayID, hour, u); err != nil {
+		logging.LoggerFromContext(ctx).Warn("failed to record gateway usage", "id", gatewayID, "error", err)
+	}
+}
+
+// Usage reports a gateway's token usage since the given time, by model.
+func (r *Registry) Usage(ctx context.Context, id string, since time.Time) (*model.UsageReport, error) {
+	gw, err := r.store.GetGateway(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("get gateway %s: %w", id, err)
+	}
+	if err := authorize(ctx, gw); err != nil {
+		return nil, err
+	}
+	return r.usageReport(ctx, id, since)
+}
+
+// UsageSummary reports token usage since the given time across every
+// gateway the caller's organization owns, by gateway and model.
+func (r *Registry) UsageSummary(ctx context.Context, since time.Time) (*model.UsageReport, error) {
+	report, err := r.usageReport(ctx, "", since)
+	if err != nil {
+		return nil, err
+	}
+
+	gateways, err := r.List(ctx, model.GatewayFilter{}, model.ListSort{})
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(gateways))
+	for _, gw := range gateways {
+		names[gw.ID] = gw.Name
+	}
+
+	usage := report.Usage[:0]
+	report.Totals = model.UsageTotals{}
+	for _, u := range report.Usage {
+		name, ok := names[u.GatewayID]
+		if !ok && callerOrg(ctx) != "" {
+			continue
+		}
+		u.GatewayName = name
+		usage = append(usage, u)
+		report.Totals.Add(u)
+	}
+	report.Usage = usage
+	return report, nil
+}
+
+func (r *Registry) usageReport(ctx context.Context, id string, since time.Time) (*model.UsageReport, error) {
+	since = since.UTC().Truncate(time.Hour)
+	usage, err := r.store.ListUsage(ctx, id, since)
+	if err != nil {
+		return nil, fmt.Errorf("list usage: %w", err)
+	}
+
+	report := &model.UsageReport{
+		GatewayID: id,
+		Since:     since,
+		Until:     r.clock.Now().UTC(),
+		Usage:     usage,
+	}
+	for _, u := range usage {
+		report.Totals.Add(u)
+	}
+	return report, nil
+}
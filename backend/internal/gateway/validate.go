@@ -0,0 +1,114 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// ErrNameConflict is returned when a gateway name is already registered.
+var ErrNameConflict = errors.New("gateway name already in use")
+
+var (
+	knownTransports = map[string]bool{"": true, "https": true, "tailscale": true, "headscale": true, "cloudflare": true}
+	knownAuthTypes  = map[string]bool{"": true, "token": true, "mtls": true, "oidc": true}
+)
+
+// Violation describes a single invalid field in a request.
+type Violation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every violation found in a request.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Field + ": " + v.Message
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) add(field, format string, args ...any) {
+	e.Violations = append(e.Violations, Violation{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// validateGateway checks the user-supplied fields of a gateway record.
+func validateGateway(gw *model.Gateway) error {
+	verr := &ValidationError{}
+
+	if strings.TrimSpace(gw.Name) == "" {
+		verr.add("name", "is required")
+	}
+
+	if !knownTransports[gw.Transport.Type] {
+		verr.add("transport.type", "unknown transport %q", gw.Transport.Type)
+	}
+	if !knownAuthTypes[gw.Auth.Type] {
+		verr.add("auth.type", "unknown auth type %q", gw.Auth.Type)
+	}
+	if gw.Auth.Type == "mtls" && gw.Auth.SecretRef == "" {
+		verr.add("auth.secret_ref", "is required for mtls")
+	}
+
+	if err := validateEndpoint(gw.Endpoint, gw.Transport.Type); err != nil {
+		verr.add("endpoint", "%s", err)
+	}
+
+	validateRetryParams(gw.Transport.Params, verr)
+	validateBreakerParams(gw.Transport.Params, verr)
+
+	if gw.TTLSeconds != nil && *gw.TTLSeconds <= 0 {
+		verr.add("ttl_seconds", "must be positive")
+	}
+
+	if len(verr.Violations) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// Validate checks a gateway the way registration does, for callers that
+// change a gateway's settings without storing them.
+func Validate(gw *model.Gateway) error {
+	return validateGateway(gw)
+}
+
+// validateEndpoint requires an absolute http(s) URL. Gateways reached over a
+// tailnet may instead be given as a bare hostname, optionally with a port.
+func validateEndpoint(endpoint, transportType string) error {
+	if endpoint == "" {
+		return errors.New("is required")
+	}
+
+	if isTailnet(transportType) && !strings.Contains(endpoint, "://") {
+		u, err := url.Parse("http://" + endpoint)
+		if err != nil || u.Hostname() == "" || u.Path != "" {
+			return fmt.Errorf("%q is not a valid hostname", endpoint)
+		}
+		return nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("%q is not a valid URL", endpoint)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%q must use http or https", endpoint)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%q must include a host", endpoint)
+	}
+	return nil
+}
+
+func isTailnet(transportType string) bool {
+	return transportType == "tailscale" || transportType == "headscale"
+}
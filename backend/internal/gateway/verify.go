@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// canaryPrompt is a minimal prompt used to confirm the completions endpoint
+// accepts and answers requests.
+const canaryPrompt = "Reply with the single word: ok"
+
+// Verify runs a post-install check that goes deeper than HealthCheck: it
+// confirms the endpoint accepts connections through the gateway's transport,
+// that /healthz answers successfully, and that /v1/completions answers a
+// canary prompt. Every check runs even if an earlier one fails so the caller
+// sees the full picture.
+func (c *Client) Verify(ctx context.Context) *model.VerifyResult {
+	result := &model.VerifyResult{
+		GatewayID: c.gateway.ID,
+		CheckedAt: time.Now().UTC().Format(time.RFC3339),
+		Passed:    true,
+	}
+
+	checks := []struct {
+		name string
+		run  func(context.Context) error
+	}{
+		{"tcp", c.verifyPort},
+		{"health", c.verifyHealth},
+		{"completions", c.verifyCompletions},
+	}
+
+	for _, chk := range checks {
+		start := time.Now()
+		err := chk.run(ctx)
+		vc := model.VerifyCheck{
+			Name:    chk.name,
+			Passed:  err == nil,
+			Latency: time.Since(start).String(),
+		}
+		if err != nil {
+			vc.Detail = err.Error()
+			result.Passed = false
+		}
+		result.Checks = append(result.Checks, vc)
+	}
+
+	return result
+}
+
+// verifyPort opens a connection to the endpoint through the gateway's
+// transport, so proxies, tailnet dialers, and client certificates apply as
+// they do to prompts. The request that opens it is abandoned once a
+// connection is established, without waiting for a response.
+func (c *Client) verifyPort(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var connected atomic.Bool
+	trace := &httptrace.ClientTrace{
+		GotConn: func(httptrace.GotConnInfo) {
+			connected.Store(true)
+			cancel()
+		},
+	}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodHead, c.baseURL()+"/", nil)
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	if err := c.applyAuth(ctx, req); err != nil {
+		return fmt.Errorf("apply auth: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if resp != nil {
+		resp.Body.Close()
+	}
+	if connected.Load() {
+		return nil
+	}
+	return err
+}
+
+func (c *Client) verifyHealth(ctx context.Context) error {
+	hc, err := c.HealthCheck(ctx)
+	if err != nil {
+		return err
+	}
+	if hc.Status != model.StatusOnline {
+		return fmt.Errorf("status %s: %s", hc.Status, hc.Error)
+	}
+	return nil
+}
+
+func (c *Client) verifyCompletions(ctx context.Context) error {
+	_, _, err := c.SendPrompt(ctx, canaryPrompt, nil)
+	return err
+}
@@ -0,0 +1,110 @@
+package gateway
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/secrets"
+	"github.com/AdamPippert/Lobstertank/internal/transport"
+)
+
+// redirectTransport is a transport provider whose clients dial addr
+// whatever host they are asked for, as a tailnet or tunnel transport does.
+type redirectTransport struct{ addr string }
+
+func (p redirectTransport) HTTPClient(string, map[string]string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, p.addr)
+		},
+	}}
+}
+
+func TestVerifyPortDialsThroughTransport(t *testing.T) {
+	srv := fakeGateway(t, func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+	sp, err := secrets.NewBuiltinProvider("")
+	if err != nil {
+		t.Fatalf("NewBuiltinProvider: %v", err)
+	}
+	cf := NewClientFactory(redirectTransport{addr: srv[len("http://"):]}, sp,
+		config.RetryConfig{}, config.BreakerConfig{}, clock.NewFake(testEpoch))
+
+	// The endpoint's host only resolves through the transport.
+	gw := &model.Gateway{ID: "gw-1", Endpoint: "http://edge.invalid:8080", Transport: model.TransportConfig{Type: "tailscale"}}
+	if err := cf.ClientFor(gw).verifyPort(context.Background()); err != nil {
+		t.Errorf("verifyPort through the transport: %v", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	// serve answers /healthz with health and /v1/completions with
+	// completions.
+	serve := func(health, completions int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/healthz":
+				w.WriteHeader(health)
+			case "/v1/completions":
+				w.WriteHeader(completions)
+				w.Write([]byte(`{"id":"c-1","response":"ok"}`))
+			}
+		}
+	}
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name     string
+		endpoint string
+		want     map[string]bool // check name -> passed
+	}{
+		{"healthy", fakeGateway(t, serve(http.StatusOK, http.StatusOK)),
+			map[string]bool{"tcp": true, "health": true, "completions": true}},
+		{"unhealthy", fakeGateway(t, serve(http.StatusServiceUnavailable, http.StatusOK)),
+			map[string]bool{"tcp": true, "health": false, "completions": true}},
+		{"completions failing", fakeGateway(t, serve(http.StatusOK, http.StatusBadGateway)),
+			map[string]bool{"tcp": true, "health": true, "completions": false}},
+		{"unreachable", closed.URL,
+			map[string]bool{"tcp": false, "health": false, "completions": false}},
+	}
+	sp, err := secrets.NewBuiltinProvider("")
+	if err != nil {
+		t.Fatalf("NewBuiltinProvider: %v", err)
+	}
+	cf := NewClientFactory(transport.NewProvider(config.TransportConfig{Default: "https"}), sp,
+		config.RetryConfig{}, config.BreakerConfig{}, clock.NewFake(testEpoch))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &model.Gateway{ID: "gw-1", Endpoint: tt.endpoint, Transport: model.TransportConfig{Type: "https"}}
+			res := cf.ClientFor(gw).Verify(context.Background())
+
+			passed := true
+			var names []string
+			for _, c := range res.Checks {
+				names = append(names, c.Name)
+				if c.Passed != tt.want[c.Name] {
+					t.Errorf("%s passed = %v, want %v (%s)", c.Name, c.Passed, tt.want[c.Name], c.Detail)
+				}
+				if !c.Passed && c.Detail == "" {
+					t.Errorf("%s failed without detail", c.Name)
+				}
+				passed = passed && c.Passed
+			}
+			if !slices.Equal(names, []string{"tcp", "health", "completions"}) {
+				t.Errorf("checks = %v, want every check, in order", names)
+			}
+			if res.Passed != passed {
+				t.Errorf("Passed = %v, want %v", res.Passed, passed)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+// Package httputil holds the JSON response helpers shared by every HTTP
+// handler.
+package httputil
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/AdamPippert/Lobstertank/internal/logging"
+)
+
+// ErrorResponse is the JSON body of an error response. Handlers that need
+// more fields, such as validation violations, embed it.
+type ErrorResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message,omitempty"`
+}
+
+// WriteJSON writes v as a JSON response with the given status. Encoding
+// failures are logged; by then the status line has already been sent.
+func WriteJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("failed to encode response", "error", err)
+	}
+}
+
+// WriteError writes an ErrorResponse carrying msg. A non-nil err is logged
+// with msg, through r's logger so the line carries the request's attributes,
+// but never sent to the client.
+func WriteError(w http.ResponseWriter, r *http.Request, status int, msg string, err error) {
+	if err != nil {
+		logging.LoggerFromContext(r.Context()).Error(msg, "error", err)
+	}
+	WriteJSON(w, status, ErrorResponse{Error: msg})
+}
+
+// WriteBodyError reports a request body that could not be read or decoded:
+// 413 when it exceeded the size limit, otherwise 400.
+func WriteBodyError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		WriteError(w, r, http.StatusRequestEntityTooLarge, "request body too large", nil)
+		return
+	}
+	WriteError(w, r, http.StatusBadRequest, "invalid request body", nil)
+}
@@ -0,0 +1,119 @@
+package httputil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AdamPippert/Lobstertank/internal/logging"
+)
+
+// captureLogs sends the default logger's output to the returned buffer
+// until the test ends.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func TestWriteJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		v        any
+		wantBody string
+		wantLog  string // "" expects no log
+	}{
+		{"object", http.StatusCreated, map[string]string{"id": "gw-1"}, `{"id":"gw-1"}` + "\n", ""},
+		{"nil", http.StatusOK, nil, "null\n", ""},
+		{"unencodable", http.StatusOK, map[string]any{"ch": make(chan int)}, "", "failed to encode response"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			rec := httptest.NewRecorder()
+			WriteJSON(rec, tt.status, tt.v)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			if rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body, tt.wantBody)
+			}
+			switch {
+			case tt.wantLog == "" && logs.Len() > 0:
+				t.Errorf("unexpected log: %s", logs)
+			case !strings.Contains(logs.String(), tt.wantLog):
+				t.Errorf("log %q does not contain %q", logs, tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantLog bool
+	}{
+		{"without cause", nil, false},
+		{"with cause", errors.New("dial tcp 10.0.0.7:5432: connection refused"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&logs, nil)).With("request_id", "req-1")
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/gateways", nil)
+			req = req.WithContext(logging.ContextWithLogger(req.Context(), logger))
+			rec := httptest.NewRecorder()
+			WriteError(rec, req, http.StatusInternalServerError, "failed to list gateways", tt.err)
+			if rec.Code != http.StatusInternalServerError {
+				t.Errorf("status = %d, want 500", rec.Code)
+			}
+			var body ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Error != "failed to list gateways" {
+				t.Errorf("body = %s (%v), want the message", rec.Body, err)
+			}
+			if tt.err != nil && strings.Contains(rec.Body.String(), "10.0.0.7") {
+				t.Errorf("response leaks the cause: %s", rec.Body)
+			}
+			if got := strings.Contains(logs.String(), "connection refused"); got != tt.wantLog {
+				t.Errorf("cause logged = %v, want %v: %s", got, tt.wantLog, &logs)
+			}
+			if tt.wantLog && !strings.Contains(logs.String(), "request_id=req-1") {
+				t.Errorf("log line lacks the request's attributes: %s", &logs)
+			}
+		})
+	}
+}
+
+func TestWriteBodyError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"too large", &http.MaxBytesError{Limit: 1 << 20}, http.StatusRequestEntityTooLarge},
+		{"wrapped too large", errors.Join(errors.New("decode"), &http.MaxBytesError{Limit: 1 << 20}), http.StatusRequestEntityTooLarge},
+		{"malformed", &json.SyntaxError{}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			WriteBodyError(rec, httptest.NewRequest(http.MethodPost, "/", nil), tt.err)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
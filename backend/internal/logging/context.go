@@ -0,0 +1,29 @@
+// Package logging carries a request-scoped slog.Logger through contexts, so
+// every log line written while serving a request can be tied to it.
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+type contextKey struct{}
+
+// ContextWithLogger returns a copy of ctx carrying l.
+func ContextWithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// LoggerFromContext returns the logger stored in ctx, or slog.Default()
+// when there is none, as in background work.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// With returns a copy of ctx whose logger also carries args.
+func With(ctx context.Context, args ...any) context.Context {
+	return ContextWithLogger(ctx, LoggerFromContext(ctx).With(args...))
+}
@@ -0,0 +1,25 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLoggerFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	base := slog.New(slog.NewTextHandler(&buf, nil))
+
+	if LoggerFromContext(context.Background()) != slog.Default() {
+		t.Error("a context without a logger did not fall back to slog.Default()")
+	}
+
+	ctx := With(ContextWithLogger(context.Background(), base), "request_id", "req-1")
+	ctx = With(ctx, "principal", "alice")
+	LoggerFromContext(ctx).Info("hello")
+	if line := buf.String(); !strings.Contains(line, "request_id=req-1 principal=alice") {
+		t.Errorf("log line %q lacks the attributes added along the way", line)
+	}
+}
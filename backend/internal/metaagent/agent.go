@@ -2,6 +2,12 @@ package metaagent
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/AdamPippert/Lobstertank/internal/audit"
 	"github.com/AdamPippert/Lobstertank/internal/gateway"
@@ -12,23 +18,60 @@ import (
 type Agent struct {
 	registry      *gateway.Registry
 	clientFactory *gateway.ClientFactory
+	prober        *gateway.Prober
 	auditor       *audit.Logger
+
+	rrMu   sync.Mutex
+	rrNext map[string]int // selector key -> next round-robin position
 }
 
-// New creates a meta-agent that can fan-out to multiple gateways.
-func New(r *gateway.Registry, cf *gateway.ClientFactory, a *audit.Logger) *Agent {
-	return &Agent{registry: r, clientFactory: cf, auditor: a}
+// New creates a meta-agent that can fan-out to multiple gateways. Health
+// sweeps check gateways with p.
+func New(r *gateway.Registry, cf *gateway.ClientFactory, p *gateway.Prober, a *audit.Logger) *Agent {
+	return &Agent{registry: r, clientFactory: cf, prober: p, auditor: a, rrNext: make(map[string]int)}
 }
 
+// ErrNoTargets is returned when every requested gateway was skipped, so
+// there is nothing to send the prompt to.
+var ErrNoTargets = errors.New("no gateways available for fan-out")
+
 // FanOutRequest describes a prompt to send to multiple gateways.
 type FanOutRequest struct {
-	GatewayIDs []string `json:"gateway_ids"` // Empty means all gateways.
+	GatewayIDs []string `json:"gateway_ids"`        // Empty (with no group) means all gateways.
+	GroupID    string   `json:"group_id,omitempty"` // Adds the group's members to GatewayIDs.
 	Prompt     string   `json:"prompt"`
+
+	// PromptTemplate renders Prompt as a text/template for each gateway,
+	// with .GatewayID, .GatewayName, and .Labels available. A gateway the
+	// template fails for gets the failure as its error.
+	PromptTemplate bool `json:"prompt_template,omitempty"`
+	// Metadata is forwarded to every gateway with the prompt.
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Overrides replaces the transport or auth of the gateways it names, by
+	// ID, for this fan-out only.
+	Overrides map[string]GatewayOverride `json:"overrides,omitempty"`
+
+	// IncludeOffline also sends the prompt to gateways last seen offline or
+	// past their TTL. Gateways in maintenance are always skipped.
+	IncludeOffline bool `json:"include_offline,omitempty"`
+
+	// Aggregation is "all" (the default), "first", or "quorum". The latter
+	// two cancel outstanding gateway requests once decided and are only
+	// supported by the synchronous fan-out.
+	Aggregation string `json:"aggregation,omitempty"`
 }
 
-// FanOutResponse aggregates responses from multiple gateways.
+// FanOutResponse aggregates responses from multiple gateways. Results are
+// ordered by gateway name, or in request order when gateway IDs were given.
 type FanOutResponse struct {
-	Results []GatewayResult `json:"results"`
+	Aggregation string          `json:"aggregation"`
+	Results     []GatewayResult `json:"results"`
+	Summary     Summary         `json:"summary"`
+
+	// Winner is set for "first" and "quorum" aggregation once decided; it
+	// is absent when no gateway succeeded or no quorum was reached.
+	Winner *Winner `json:"winner,omitempty"`
 }
 
 // GatewayResult holds the response (or error) from a single gateway.
@@ -37,38 +80,288 @@ type GatewayResult struct {
 	GatewayName string `json:"gateway_name"`
 	Response    string `json:"response,omitempty"`
 	Error       string `json:"error,omitempty"`
+	Skipped     bool   `json:"skipped,omitempty"`     // the gateway was not contacted
+	SkipReason  string `json:"skip_reason,omitempty"` // "maintenance", "offline", or "expired"
+	Canceled    bool   `json:"canceled,omitempty"`    // abandoned before the gateway answered
+
+	LatencyMillis int64        `json:"latency_ms,omitempty"` // round trip to the gateway; absent when skipped
+	Usage         *model.Usage `json:"usage,omitempty"`      // tokens the gateway reported; set on success
+
+	unsent bool // failed before the gateway was contacted, e.g. by its prompt template
+}
+
+// Summary totals a completed fan-out. Fastest and slowest cover every
+// gateway that answered, whether it succeeded or not.
+type Summary struct {
+	Total          int   `json:"total"`
+	Succeeded      int   `json:"succeeded"`
+	Failed         int   `json:"failed"`
+	Skipped        int   `json:"skipped"`
+	Canceled       int   `json:"canceled"`
+	FastestMillis  int64 `json:"fastest_ms"`
+	SlowestMillis  int64 `json:"slowest_ms"`
+	DurationMillis int64 `json:"duration_ms"` // wall clock for the whole fan-out
+
+	answered int // results that fastest and slowest cover
+}
+
+// add counts one result.
+func (s *Summary) add(r GatewayResult) {
+	s.Total++
+	switch {
+	case r.Skipped:
+		s.Skipped++
+		return
+	case r.Canceled:
+		s.Canceled++
+		return
+	case r.unsent:
+		s.Failed++
+		return
+	}
+
+	if s.answered == 0 || r.LatencyMillis < s.FastestMillis {
+		s.FastestMillis = r.LatencyMillis
+	}
+	s.answered++
+	s.SlowestMillis = max(s.SlowestMillis, r.LatencyMillis)
+
+	if r.Error != "" {
+		s.Failed++
+	} else {
+		s.Succeeded++
+	}
 }
 
 // FanOut sends a prompt to the specified gateways concurrently and aggregates
-// the results.
+// the results according to req.Aggregation.
 func (a *Agent) FanOut(ctx context.Context, req FanOutRequest) (*FanOutResponse, error) {
-	gateways, err := a.resolveGateways(ctx, req.GatewayIDs)
+	msg, err := newMessage(req)
+	if err != nil {
+		return nil, err
+	}
+	gateways, targets, skipped, err := a.plan(ctx, req)
 	if err != nil {
 		return nil, err
 	}
 
-	results := fanOutToGateways(ctx, a.clientFactory, gateways, req.Prompt)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	mode := aggregationMode(req.Aggregation)
+	agg := newAggregator(mode, len(targets))
+	stream := a.start(ctx, msg, gateways, targets, skipped)
 
-	a.auditor.Log(ctx, audit.Event{
-		Action: "metaagent.fanout",
-		Detail: "fan-out completed",
+	results := make([]GatewayResult, 0, len(stream.order))
+	for r := range stream.Results {
+		results = append(results, r)
+		if agg.add(r) {
+			cancel() // decided; abandon the gateways still outstanding
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return stream.order[results[i].GatewayID] < stream.order[results[j].GatewayID]
 	})
 
-	return &FanOutResponse{Results: results}, nil
+	return &FanOutResponse{
+		Aggregation: mode,
+		Results:     results,
+		Summary:     stream.Summary(),
+		Winner:      agg.winner,
+	}, nil
+}
+
+// aggregationMode returns the effective aggregation mode.
+func aggregationMode(mode string) string {
+	if mode == "" {
+		return AggregateAll
+	}
+	return mode
+}
+
+// requireAllAggregation rejects aggregation modes other than "all" for
+// fan-outs that hand results back as they arrive.
+func requireAllAggregation(req FanOutRequest) error {
+	if mode := aggregationMode(req.Aggregation); mode != AggregateAll {
+		return fmt.Errorf("%w: %q is only supported by synchronous fan-out", ErrInvalidAggregation, mode)
+	}
+	return nil
+}
+
+// Stream is a fan-out in progress.
+type Stream struct {
+	// Results receives each result as soon as it is known, skipped gateways
+	// first, and is closed once every gateway has answered. It is buffered
+	// for every result, so abandoning it leaks nothing.
+	Results <-chan GatewayResult
+
+	order   map[string]int // gateway ID -> position in the response
+	summary Summary
+}
+
+// Summary totals the fan-out. It is only valid once Results is closed.
+func (s *Stream) Summary() Summary {
+	return s.summary
+}
+
+// FanOutStream starts a fan-out without waiting for it. Canceling ctx
+// abandons in-flight gateway requests, which then report errors.
+func (a *Agent) FanOutStream(ctx context.Context, req FanOutRequest) (*Stream, error) {
+	if err := requireAllAggregation(req); err != nil {
+		return nil, err
+	}
+	msg, err := newMessage(req)
+	if err != nil {
+		return nil, err
+	}
+	gateways, targets, skipped, err := a.plan(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return a.start(ctx, msg, gateways, targets, skipped), nil
+}
+
+// start sends msg to the planned targets, reporting skipped gateways first,
+// and audits the fan-out once every target has answered.
+func (a *Agent) start(ctx context.Context, msg message, gateways, targets []model.Gateway, skipped []GatewayResult) *Stream {
+	start := time.Now()
+	out := make(chan GatewayResult, len(skipped)+len(targets))
+	stream := &Stream{Results: out, order: make(map[string]int, len(gateways))}
+	for i, gw := range gateways {
+		stream.order[gw.ID] = i
+	}
+	for _, r := range skipped {
+		stream.summary.add(r)
+		out <- r
+	}
+
+	go func() {
+		defer close(out)
+
+		for r := range a.streamToGateways(ctx, targets, msg) {
+			stream.summary.add(r)
+			out <- r
+		}
+		stream.summary.DurationMillis = time.Since(start).Milliseconds()
+
+		sum := stream.summary
+		detail := fmt.Sprintf("fan-out to %d gateways: %d succeeded, %d failed, %d skipped, %d canceled in %dms",
+			sum.Total, sum.Succeeded, sum.Failed, sum.Skipped, sum.Canceled, sum.DurationMillis)
+		if n := len(msg.overrides); n > 0 {
+			detail += fmt.Sprintf("; settings overridden for %d", n)
+		}
+		a.auditor.Log(ctx, audit.Event{
+			Action: "metaagent.fanout",
+			Detail: detail,
+		})
+	}()
+	return stream
+}
+
+// plan resolves the gateways a fan-out targets, in response order, and sets
+// aside those that should be skipped. It fails with ErrNoTargets when
+// nothing is left.
+func (a *Agent) plan(ctx context.Context, req FanOutRequest) (gateways, targets []model.Gateway, skipped []GatewayResult, err error) {
+	switch aggregationMode(req.Aggregation) {
+	case AggregateAll, AggregateFirst, AggregateQuorum:
+	default:
+		return nil, nil, nil, fmt.Errorf("%w: unknown mode %q (want all, first, or quorum)", ErrInvalidAggregation, req.Aggregation)
+	}
+
+	gateways, err = a.resolveGateways(ctx, req.GatewayIDs, req.GroupID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(req.GatewayIDs) == 0 {
+		sort.SliceStable(gateways, func(i, j int) bool { return gateways[i].Name < gateways[j].Name })
+	}
+	if err := checkOverrides(req.Overrides, gateways); err != nil {
+		return nil, nil, nil, err
+	}
+
+	targets = make([]model.Gateway, 0, len(gateways))
+	for _, gw := range gateways {
+		if reason := a.skipReason(&gw, req.IncludeOffline); reason != "" {
+			skipped = append(skipped, GatewayResult{GatewayID: gw.ID, GatewayName: gw.Name, Skipped: true, SkipReason: reason})
+			continue
+		}
+		targets = append(targets, gw)
+	}
+	if len(targets) == 0 {
+		if len(skipped) == 0 {
+			return nil, nil, nil, fmt.Errorf("%w: no gateways matched", ErrNoTargets)
+		}
+		return nil, nil, nil, fmt.Errorf("%w: all %d matched gateways were skipped (%s); set include_offline to reach offline or expired ones",
+			ErrNoTargets, len(skipped), summarizeSkips(skipped))
+	}
+	return gateways, targets, skipped, nil
 }
 
-func (a *Agent) resolveGateways(ctx context.Context, ids []string) ([]model.Gateway, error) {
-	if len(ids) == 0 {
-		return a.registry.List(ctx)
+// skipReason reports why gw should not receive a fan-out, or "" if it
+// should.
+func (a *Agent) skipReason(gw *model.Gateway, includeOffline bool) string {
+	switch {
+	case a.registry.MaintenanceActive(gw):
+		return "maintenance"
+	case includeOffline:
+		return ""
+	case gw.Status == model.StatusOffline:
+		return "offline"
+	case a.registry.Expired(gw):
+		return "expired"
+	default:
+		return ""
+	}
+}
+
+// summarizeSkips counts skipped results by reason, e.g. "2 offline, 1 expired".
+func summarizeSkips(skipped []GatewayResult) string {
+	counts := make(map[string]int)
+	var order []string
+	for _, r := range skipped {
+		if counts[r.SkipReason] == 0 {
+			order = append(order, r.SkipReason)
+		}
+		counts[r.SkipReason]++
+	}
+	parts := make([]string, 0, len(order))
+	for _, reason := range order {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[reason], reason))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (a *Agent) resolveGateways(ctx context.Context, ids []string, groupID string) ([]model.Gateway, error) {
+	if len(ids) == 0 && groupID == "" {
+		return a.registry.List(ctx, model.GatewayFilter{}, model.ListSort{})
 	}
 
 	gateways := make([]model.Gateway, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	if groupID != "" {
+		members, err := a.registry.ResolveGroup(ctx, groupID)
+		if err != nil {
+			return nil, err
+		}
+		for _, gw := range members {
+			seen[gw.ID] = true
+			gateways = append(gateways, gw)
+		}
+	}
+
+	var listed []string
 	for _, id := range ids {
-		gw, err := a.registry.Get(ctx, id)
+		if !seen[id] {
+			seen[id] = true
+			listed = append(listed, id)
+		}
+	}
+	if len(listed) > 0 {
+		more, err := a.registry.GetMany(ctx, listed)
 		if err != nil {
 			return nil, err
 		}
-		gateways = append(gateways, *gw)
+		gateways = append(gateways, more...)
 	}
 	return gateways, nil
 }
@@ -0,0 +1,288 @@
+package metaagent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/gateway"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/secrets"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+	"github.com/AdamPippert/Lobstertank/internal/transport"
+)
+
+var testEpoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newTestAgent returns an agent over a registry on an in-memory SQLite
+// store, reaching gateways over plain HTTPS clients without retries or
+// circuit breakers.
+func newTestAgent(t *testing.T) (*Agent, *gateway.Registry, *clock.FakeClock) {
+	t.Helper()
+	s, err := store.NewSQLiteStore(":memory:", false, true)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	sp, err := secrets.NewBuiltinProvider("")
+	if err != nil {
+		t.Fatalf("NewBuiltinProvider: %v", err)
+	}
+	clk := clock.NewFake(testEpoch)
+	auditor := audit.New(config.AuditConfig{})
+	r := gateway.NewRegistry(s, auditor, clk, 0, sp, "builtin://gateways/")
+	cf := gateway.NewClientFactory(transport.NewProvider(config.TransportConfig{Default: "https"}), sp,
+		config.RetryConfig{}, config.BreakerConfig{}, clk)
+	return New(r, cf, gateway.NewProber(r, cf, 10, time.Second), auditor), r, clk
+}
+
+// fakeGateway is a gateway served by handle until the test ends, counting
+// the prompts it receives.
+type fakeGateway struct {
+	*model.Gateway
+	prompts atomic.Int32
+}
+
+// addGateway registers a gateway named name that answers every prompt with
+// answer.
+func addGateway(t *testing.T, r *gateway.Registry, name, answer string, ttlSeconds *int) *fakeGateway {
+	t.Helper()
+	return addGatewayFunc(t, r, name, ttlSeconds, func(w http.ResponseWriter, _ *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"response": answer})
+	})
+}
+
+// addGatewayFunc registers a gateway named name whose completions are served
+// by handle.
+func addGatewayFunc(t *testing.T, r *gateway.Registry, name string, ttlSeconds *int, handle http.HandlerFunc) *fakeGateway {
+	t.Helper()
+	fg := &fakeGateway{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fg.prompts.Add(1)
+		handle(w, req)
+	}))
+	t.Cleanup(srv.Close)
+	gw, err := r.Create(context.Background(), model.CreateGatewayRequest{
+		Name:       name,
+		Endpoint:   srv.URL,
+		Transport:  model.TransportConfig{Type: "https"},
+		TTLSeconds: ttlSeconds,
+	}, nil)
+	if err != nil {
+		t.Fatalf("Create %s: %v", name, err)
+	}
+	fg.Gateway = gw
+	return fg
+}
+
+// setStatus records a health check of gw with status.
+func setStatus(t *testing.T, r *gateway.Registry, gw *fakeGateway, status model.Status) {
+	t.Helper()
+	if err := r.UpdateStatus(context.Background(), model.HealthCheckResult{GatewayID: gw.ID, Status: status}); err != nil {
+		t.Fatalf("UpdateStatus %s: %v", gw.Name, err)
+	}
+}
+
+func TestFanOutSkipsUnavailableGateways(t *testing.T) {
+	a, r, clk := newTestAgent(t)
+	ttl := 60
+	online := addGateway(t, r, "a-online", "ok", nil)
+	offline := addGateway(t, r, "b-offline", "ok", nil)
+	expired := addGateway(t, r, "c-expired", "ok", &ttl)
+	maintenance := addGateway(t, r, "d-maintenance", "ok", nil)
+	setStatus(t, r, online, model.StatusOnline)
+	setStatus(t, r, offline, model.StatusOffline)
+	if _, err := r.SetMaintenance(context.Background(), maintenance.ID, model.MaintenanceRequest{Enabled: true}); err != nil {
+		t.Fatalf("SetMaintenance: %v", err)
+	}
+	clk.Advance(2 * time.Minute) // past c-expired's TTL; it was never seen
+
+	tests := []struct {
+		name           string
+		includeOffline bool
+		wantReached    []*fakeGateway
+		wantSkipped    map[string]string // gateway name -> reason
+	}{
+		{"default", false, []*fakeGateway{online},
+			map[string]string{"b-offline": "offline", "c-expired": "expired", "d-maintenance": "maintenance"}},
+		{"include offline", true, []*fakeGateway{online, offline, expired},
+			map[string]string{"d-maintenance": "maintenance"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := map[*fakeGateway]int32{}
+			for _, fg := range []*fakeGateway{online, offline, expired, maintenance} {
+				before[fg] = fg.prompts.Load()
+			}
+
+			resp, err := a.FanOut(context.Background(), FanOutRequest{Prompt: "hello", IncludeOffline: tt.includeOffline})
+			if err != nil {
+				t.Fatalf("FanOut: %v", err)
+			}
+			if len(resp.Results) != 4 {
+				t.Fatalf("got %d results, want one per gateway: %+v", len(resp.Results), resp.Results)
+			}
+			for _, res := range resp.Results {
+				reason, skipped := tt.wantSkipped[res.GatewayName]
+				if res.Skipped != skipped || res.SkipReason != reason {
+					t.Errorf("%s: skipped %v (%q), want %v (%q)", res.GatewayName, res.Skipped, res.SkipReason, skipped, reason)
+				}
+				if skipped && (res.Error != "" || res.LatencyMillis != 0) {
+					t.Errorf("%s: skipped result carries error %q, latency %d", res.GatewayName, res.Error, res.LatencyMillis)
+				}
+			}
+			if resp.Summary.Skipped != len(tt.wantSkipped) || resp.Summary.Succeeded != len(tt.wantReached) {
+				t.Errorf("summary = %+v, want %d skipped, %d succeeded", resp.Summary, len(tt.wantSkipped), len(tt.wantReached))
+			}
+
+			reached := map[*fakeGateway]bool{}
+			for _, fg := range tt.wantReached {
+				reached[fg] = true
+			}
+			for fg, n := range before {
+				if got := fg.prompts.Load() - n; got != 0 != reached[fg] {
+					t.Errorf("%s received %d prompts, want reached %v", fg.Name, got, reached[fg])
+				}
+			}
+		})
+	}
+}
+
+func TestFanOutRefusesWhenEverythingIsSkipped(t *testing.T) {
+	a, r, _ := newTestAgent(t)
+	offline := addGateway(t, r, "offline", "ok", nil)
+	setStatus(t, r, offline, model.StatusOffline)
+
+	_, err := a.FanOut(context.Background(), FanOutRequest{Prompt: "hello"})
+	if !errors.Is(err, ErrNoTargets) || !strings.Contains(err.Error(), "1 offline") {
+		t.Fatalf("FanOut: got %v, want ErrNoTargets naming the offline gateway", err)
+	}
+
+	h := NewHandler(a, nil)
+	rec := httptest.NewRecorder()
+	h.FanOut(rec, httptest.NewRequest(http.MethodPost, "/api/v1/meta/fanout", strings.NewReader(`{"prompt":"hello"}`)))
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "include_offline") {
+		t.Errorf("handler: status = %d, want 422 suggesting include_offline: %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.FanOut(rec, httptest.NewRequest(http.MethodPost, "/api/v1/meta/fanout", strings.NewReader(`{"prompt":"hello","include_offline":true}`)))
+	if rec.Code != http.StatusOK {
+		t.Errorf("handler with include_offline: status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if n := offline.prompts.Load(); n != 1 {
+		t.Errorf("offline gateway received %d prompts, want 1", n)
+	}
+}
+
+func TestFanOutToGroup(t *testing.T) {
+	a, r, _ := newTestAgent(t)
+	ctx := context.Background()
+	alpha := addGateway(t, r, "alpha", "ok", nil)
+	bravo := addGateway(t, r, "bravo", "ok", nil)
+	charlie := addGateway(t, r, "charlie", "ok", nil)
+	group, err := r.CreateGroup(ctx, model.CreateGroupRequest{Name: "fleet", GatewayIDs: []string{alpha.ID, bravo.ID}})
+	if err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		members []*fakeGateway // nil keeps the group as it is
+		want    []*fakeGateway
+	}{
+		{"as created", nil, []*fakeGateway{alpha, bravo}},
+		{"member added", []*fakeGateway{alpha, bravo, charlie}, []*fakeGateway{alpha, bravo, charlie}},
+		{"member removed", []*fakeGateway{charlie}, []*fakeGateway{charlie}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.members != nil {
+				ids := make([]string, len(tt.members))
+				for i, fg := range tt.members {
+					ids[i] = fg.ID
+				}
+				if _, err := r.UpdateGroup(ctx, group.ID, model.UpdateGroupRequest{GatewayIDs: ids}); err != nil {
+					t.Fatalf("UpdateGroup: %v", err)
+				}
+			}
+			before := map[*fakeGateway]int32{}
+			for _, fg := range []*fakeGateway{alpha, bravo, charlie} {
+				before[fg] = fg.prompts.Load()
+			}
+
+			resp, err := a.FanOut(ctx, FanOutRequest{Prompt: "hello", GroupID: group.ID, IncludeOffline: true})
+			if err != nil {
+				t.Fatalf("FanOut: %v", err)
+			}
+			if len(resp.Results) != len(tt.want) {
+				t.Errorf("results = %+v, want %d", resp.Results, len(tt.want))
+			}
+			for fg, n := range before {
+				want := int32(0)
+				if slices.Contains(tt.want, fg) {
+					want = 1
+				}
+				if got := fg.prompts.Load() - n; got != want {
+					t.Errorf("%s received %d prompts, want %d", fg.Name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFanOutIgnoresDeletedGateways(t *testing.T) {
+	a, r, _ := newTestAgent(t)
+	ctx := context.Background()
+	live := addGateway(t, r, "live", "ok", nil)
+	deleted := addGateway(t, r, "deleted", "ok", nil)
+	group, err := r.CreateGroup(ctx, model.CreateGroupRequest{Name: "both", GatewayIDs: []string{live.ID, deleted.ID}})
+	if err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+	if err := r.Delete(ctx, deleted.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		req     FanOutRequest
+		wantErr bool
+	}{
+		{"all gateways", FanOutRequest{}, false},
+		{"group", FanOutRequest{GroupID: group.ID}, false},
+		{"by id", FanOutRequest{GatewayIDs: []string{live.ID, deleted.ID}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.Prompt = "hello"
+			tt.req.IncludeOffline = true
+			resp, err := a.FanOut(ctx, tt.req)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), deleted.ID) {
+					t.Errorf("FanOut: got %v, want the deleted gateway reported missing", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FanOut: %v", err)
+			}
+			if len(resp.Results) != 1 || resp.Results[0].GatewayID != live.ID {
+				t.Errorf("results = %+v, want only the live gateway", resp.Results)
+			}
+		})
+	}
+	if n := deleted.prompts.Load(); n != 0 {
+		t.Errorf("deleted gateway received %d prompts", n)
+	}
+}
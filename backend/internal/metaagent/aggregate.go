@@ -0,0 +1,106 @@
+package metaagent
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Aggregation modes for a synchronous fan-out.
+const (
+	AggregateAll    = "all"    // wait for every gateway
+	AggregateFirst  = "first"  // stop at the first successful response
+	AggregateQuorum = "quorum" // stop once half the gateways (rounded up) succeeded
+)
+
+// ErrInvalidAggregation is returned for an unknown aggregation mode, or one
+// the requested kind of fan-out does not support.
+var ErrInvalidAggregation = errors.New("invalid aggregation")
+
+// Winner is the response an aggregating fan-out settled on.
+type Winner struct {
+	GatewayID   string `json:"gateway_id"`
+	GatewayName string `json:"gateway_name"`
+	Response    string `json:"response"`
+	Agreed      int    `json:"agreed"`  // successful gateways with the same normalized answer, the winner included
+	Dissent     int    `json:"dissent"` // successful gateways with a different answer
+}
+
+// aggregator decides when an aggregating fan-out has its answer.
+type aggregator struct {
+	mode      string
+	need      int // successes required for a quorum
+	successes []GatewayResult
+	winner    *Winner
+}
+
+func newAggregator(mode string, targets int) *aggregator {
+	return &aggregator{mode: mode, need: (targets + 1) / 2}
+}
+
+// add records a result and reports whether the fan-out is decided, after
+// which outstanding gateway requests can be canceled.
+func (g *aggregator) add(r GatewayResult) bool {
+	if g.winner != nil || r.Skipped || r.Error != "" {
+		return g.winner != nil
+	}
+	g.successes = append(g.successes, r)
+
+	switch g.mode {
+	case AggregateFirst:
+		g.winner = &Winner{GatewayID: r.GatewayID, GatewayName: r.GatewayName, Response: r.Response, Agreed: 1}
+	case AggregateQuorum:
+		if len(g.successes) >= g.need {
+			g.winner = majority(g.successes)
+		}
+	}
+	return g.winner != nil
+}
+
+// majority picks the most common normalized answer among successes. Ties go
+// to the answer that arrived first, and the winner is the first gateway to
+// give it.
+func majority(successes []GatewayResult) *Winner {
+	counts := make(map[string]int, len(successes))
+	var best string
+	for _, r := range successes {
+		answer := normalizeResponse(r.Response)
+		counts[answer]++
+		if counts[answer] > counts[best] {
+			best = answer
+		}
+	}
+
+	for _, r := range successes {
+		if normalizeResponse(r.Response) == best {
+			return &Winner{
+				GatewayID:   r.GatewayID,
+				GatewayName: r.GatewayName,
+				Response:    r.Response,
+				Agreed:      counts[best],
+				Dissent:     len(successes) - counts[best],
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeResponse reduces a gateway response to the answer text so that
+// gateways giving the same answer compare equal. OpenClaw responses are
+// JSON with the answer in "response"; other bodies are used as they are.
+// Runs of whitespace collapse to one space.
+func normalizeResponse(raw string) string {
+	return strings.Join(strings.Fields(answerText(raw)), " ")
+}
+
+// answerText extracts the answer from an OpenClaw response body, or returns
+// the body unchanged when it has no "response" field.
+func answerText(raw string) string {
+	var body struct {
+		Response *string `json:"response"`
+	}
+	if err := json.Unmarshal([]byte(raw), &body); err == nil && body.Response != nil {
+		return *body.Response
+	}
+	return raw
+}
@@ -0,0 +1,197 @@
+package metaagent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/AdamPippert/Lobstertank/internal/gateway"
+)
+
+// stub is how a stub gateway answers a prompt.
+type stub struct {
+	answer string // "" with fail unset holds the request until it is canceled
+	fail   bool
+}
+
+// addStub registers a gateway named name that answers as s.
+func addStub(t *testing.T, r *gateway.Registry, name string, s stub) *fakeGateway {
+	t.Helper()
+	switch {
+	case s.fail:
+		return addGatewayFunc(t, r, name, nil, func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		})
+	case s.answer == "":
+		return addGatewayFunc(t, r, name, nil, func(_ http.ResponseWriter, req *http.Request) {
+			// The server only notices the client going away once the
+			// body has been read.
+			io.Copy(io.Discard, req.Body)
+			<-req.Context().Done()
+		})
+	default:
+		return addGateway(t, r, name, s.answer, nil)
+	}
+}
+
+func TestFanOutAggregation(t *testing.T) {
+	tests := []struct {
+		name        string
+		aggregation string
+		stubs       map[string]stub
+		wantWinner  []string // acceptable winning gateways; nil expects no winner
+		wantAnswer  string
+		wantAgreed  int
+		wantDissent int
+	}{
+		{
+			name:        "all waits for every gateway",
+			aggregation: "",
+			stubs:       map[string]stub{"a": {answer: "yes"}, "b": {answer: "no"}, "c": {fail: true}},
+		},
+		{
+			name:        "first skips failures and cancels the rest",
+			aggregation: AggregateFirst,
+			stubs:       map[string]stub{"a": {fail: true}, "b": {}, "c": {answer: "Paris"}},
+			wantWinner:  []string{"c"},
+			wantAnswer:  "Paris",
+			wantAgreed:  1,
+		},
+		{
+			name:        "quorum matches normalized answers",
+			aggregation: AggregateQuorum,
+			stubs:       map[string]stub{"a": {answer: "The answer is  Paris"}, "b": {answer: "The answer is Paris\n"}, "c": {}},
+			wantWinner:  []string{"a", "b"},
+			wantAnswer:  "The answer is Paris",
+			wantAgreed:  2,
+		},
+		{
+			name:        "quorum counts dissent",
+			aggregation: AggregateQuorum,
+			stubs: map[string]stub{
+				"a": {answer: "Lyon"}, "b": {answer: "Paris"}, "c": {answer: "Paris"}, "d": {}, "e": {},
+			},
+			wantWinner:  []string{"b", "c"},
+			wantAnswer:  "Paris",
+			wantAgreed:  2,
+			wantDissent: 1,
+		},
+		{
+			name:        "quorum not reached",
+			aggregation: AggregateQuorum,
+			stubs:       map[string]stub{"a": {answer: "Paris"}, "b": {fail: true}, "c": {fail: true}},
+		},
+		{
+			name:        "first with no success",
+			aggregation: AggregateFirst,
+			stubs:       map[string]stub{"a": {fail: true}, "b": {fail: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, r, _ := newTestAgent(t)
+			for name, s := range tt.stubs {
+				addStub(t, r, name, s)
+			}
+
+			resp, err := a.FanOut(context.Background(), FanOutRequest{Prompt: "capital of France?", Aggregation: tt.aggregation})
+			if err != nil {
+				t.Fatalf("FanOut: %v", err)
+			}
+			if want := aggregationMode(tt.aggregation); resp.Aggregation != want {
+				t.Errorf("aggregation = %q, want %q", resp.Aggregation, want)
+			}
+			if len(resp.Results) != len(tt.stubs) {
+				t.Errorf("got %d results, want %d", len(resp.Results), len(tt.stubs))
+			}
+
+			switch w := resp.Winner; {
+			case tt.wantWinner == nil && w != nil:
+				t.Errorf("winner = %+v, want none", w)
+			case tt.wantWinner == nil:
+			case w == nil:
+				t.Errorf("no winner, want one of %v", tt.wantWinner)
+			default:
+				if !slices.Contains(tt.wantWinner, w.GatewayName) {
+					t.Errorf("winner = %s, want one of %v", w.GatewayName, tt.wantWinner)
+				}
+				if normalizeResponse(w.Response) != tt.wantAnswer || w.Agreed != tt.wantAgreed || w.Dissent != tt.wantDissent {
+					t.Errorf("winner = %q agreed %d dissent %d, want %q agreed %d dissent %d",
+						normalizeResponse(w.Response), w.Agreed, w.Dissent, tt.wantAnswer, tt.wantAgreed, tt.wantDissent)
+				}
+			}
+
+			// Gateways still holding the prompt are canceled once the
+			// fan-out is decided. A failure may race the decision, so
+			// failing gateways can go either way.
+			canceled := 0
+			for _, res := range resp.Results {
+				s := tt.stubs[res.GatewayName]
+				if res.Canceled {
+					canceled++
+				}
+				if want := !s.fail && s.answer == ""; !s.fail && res.Canceled != want {
+					t.Errorf("%s: canceled = %v, want %v", res.GatewayName, res.Canceled, want)
+				}
+			}
+			if resp.Summary.Canceled != canceled {
+				t.Errorf("summary counts %d canceled, want %d", resp.Summary.Canceled, canceled)
+			}
+		})
+	}
+}
+
+func TestFanOutRejectsUnknownAggregation(t *testing.T) {
+	a, r, _ := newTestAgent(t)
+	gw := addStub(t, r, "a", stub{answer: "Paris"})
+
+	if _, err := a.FanOut(context.Background(), FanOutRequest{Prompt: "hi", Aggregation: "fastest"}); !errors.Is(err, ErrInvalidAggregation) {
+		t.Errorf("FanOut: got %v, want ErrInvalidAggregation", err)
+	}
+	if err := requireAllAggregation(FanOutRequest{Aggregation: AggregateQuorum}); !errors.Is(err, ErrInvalidAggregation) {
+		t.Errorf("requireAllAggregation(quorum) = %v, want ErrInvalidAggregation", err)
+	}
+
+	rec := httptest.NewRecorder()
+	NewHandler(a, nil).FanOut(rec, httptest.NewRequest(http.MethodPost, "/api/v1/meta/fanout",
+		strings.NewReader(`{"prompt":"hi","aggregation":"fastest"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("handler: status = %d, want 400: %s", rec.Code, rec.Body)
+	}
+	if n := gw.prompts.Load(); n != 0 {
+		t.Errorf("gateway received %d prompts for a rejected fan-out", n)
+	}
+}
+
+func TestMajority(t *testing.T) {
+	result := func(id, response string) GatewayResult {
+		return GatewayResult{GatewayID: id, GatewayName: id, Response: response}
+	}
+	tests := []struct {
+		name        string
+		successes   []GatewayResult
+		wantID      string
+		wantAgreed  int
+		wantDissent int
+	}{
+		{"unanimous", []GatewayResult{result("a", "x"), result("b", "x")}, "a", 2, 0},
+		{"majority", []GatewayResult{result("a", "x"), result("b", "y"), result("c", "y")}, "b", 2, 1},
+		{"tie goes to the first answer", []GatewayResult{result("a", "x"), result("b", "y")}, "a", 1, 1},
+		{"openclaw bodies", []GatewayResult{
+			result("a", `{"response":"x  y"}`), result("b", `{"response":" x y "}`), result("c", "x y z"),
+		}, "a", 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := majority(tt.successes)
+			if w == nil || w.GatewayID != tt.wantID || w.Agreed != tt.wantAgreed || w.Dissent != tt.wantDissent {
+				t.Errorf("majority = %+v, want %s agreed %d dissent %d", w, tt.wantID, tt.wantAgreed, tt.wantDissent)
+			}
+		})
+	}
+}
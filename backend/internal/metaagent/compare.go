@@ -0,0 +1,123 @@
+package metaagent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CompareResponse groups gateways by the answer they gave to the same
+// prompt.
+type CompareResponse struct {
+	// Clusters holds one entry per distinct answer, largest first, followed
+	// by the unreachable cluster if any gateway failed.
+	Clusters []Cluster `json:"clusters"`
+	// Diff is a unified diff from the largest cluster's answer to the second
+	// largest; empty when every reachable gateway agreed.
+	Diff    string  `json:"diff,omitempty"`
+	Summary Summary `json:"summary"`
+}
+
+// Cluster is a set of gateways that gave the same normalized answer, or
+// that could not be reached.
+type Cluster struct {
+	Response    string          `json:"response,omitempty"`
+	Unreachable bool            `json:"unreachable,omitempty"`
+	Gateways    []ClusterMember `json:"gateways"`
+}
+
+// ClusterMember is a gateway within a cluster.
+type ClusterMember struct {
+	GatewayID   string `json:"gateway_id"`
+	GatewayName string `json:"gateway_name"`
+	Error       string `json:"error,omitempty"` // set in the unreachable cluster
+}
+
+// Compare fans a prompt out and groups the gateways by answer, so that
+// gateways expected to behave the same can be checked at a glance. Skipped
+// gateways are counted in the summary but belong to no cluster.
+func (a *Agent) Compare(ctx context.Context, req FanOutRequest) (*CompareResponse, error) {
+	if err := requireAllAggregation(req); err != nil {
+		return nil, err
+	}
+	fanOut, err := a.FanOut(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		clusters    []Cluster
+		byAnswer    = make(map[string]int) // normalized answer -> index in clusters
+		unreachable = Cluster{Unreachable: true}
+	)
+	for _, r := range fanOut.Results {
+		member := ClusterMember{GatewayID: r.GatewayID, GatewayName: r.GatewayName}
+		switch {
+		case r.Skipped:
+			continue
+		case r.Error != "":
+			member.Error = r.Error
+			unreachable.Gateways = append(unreachable.Gateways, member)
+			continue
+		}
+
+		answer := normalizeAnswer(r.Response)
+		i, ok := byAnswer[answer]
+		if !ok {
+			i = len(clusters)
+			byAnswer[answer] = i
+			clusters = append(clusters, Cluster{Response: answer})
+		}
+		clusters[i].Gateways = append(clusters[i].Gateways, member)
+	}
+
+	// Ties keep the order in which answers were first seen.
+	sort.SliceStable(clusters, func(i, j int) bool {
+		return len(clusters[i].Gateways) > len(clusters[j].Gateways)
+	})
+
+	resp := &CompareResponse{Clusters: clusters, Summary: fanOut.Summary}
+	if len(clusters) >= 2 {
+		resp.Diff = unifiedDiff(clusterLabel(1, clusters[0]), clusterLabel(2, clusters[1]),
+			clusters[0].Response, clusters[1].Response)
+	}
+	if len(unreachable.Gateways) > 0 {
+		resp.Clusters = append(resp.Clusters, unreachable)
+	}
+	if resp.Clusters == nil {
+		resp.Clusters = []Cluster{}
+	}
+	return resp, nil
+}
+
+// normalizeAnswer extracts the answer text and normalizes it for comparison
+// while keeping its lines: JSON answers are re-encoded with sorted keys and
+// indentation, and other answers have runs of whitespace within each line
+// collapsed and blank leading and trailing lines removed.
+func normalizeAnswer(raw string) string {
+	text := answerText(raw)
+
+	var v any
+	if err := json.Unmarshal([]byte(text), &v); err == nil {
+		if out, err := json.MarshalIndent(v, "", "  "); err == nil {
+			return string(out)
+		}
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+// clusterLabel names a cluster in a diff header.
+func clusterLabel(n int, c Cluster) string {
+	names := make([]string, 0, len(c.Gateways))
+	for _, m := range c.Gateways {
+		names = append(names, m.GatewayName)
+	}
+	return fmt.Sprintf("cluster %d (%s)", n, strings.Join(names, ", "))
+}
@@ -0,0 +1,126 @@
+package metaagent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCompareHandler(t *testing.T) {
+	a, r, _ := newTestAgent(t)
+	addGateway(t, r, "a", "Paris is the capital.\nPopulation: 2.1M", nil)
+	addGateway(t, r, "b", "Paris is the capital.\nPopulation: 2.1M\n", nil)
+	addGateway(t, r, "c", "  Paris is  the capital.\nPopulation:\t2.1M", nil)
+	addGateway(t, r, "d", "Paris is the capital.\nPopulation: 2.2M", nil)
+	addStub(t, r, "e", stub{fail: true})
+	h := NewHandler(a, nil)
+
+	rec := httptest.NewRecorder()
+	h.Compare(rec, httptest.NewRequest(http.MethodPost, "/api/v1/meta/compare", strings.NewReader(`{"prompt":"capital of France?"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var resp CompareResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	type cluster struct {
+		response    string
+		unreachable bool
+		gateways    []string
+	}
+	want := []cluster{
+		{"Paris is the capital.\nPopulation: 2.1M", false, []string{"a", "b", "c"}},
+		{"Paris is the capital.\nPopulation: 2.2M", false, []string{"d"}},
+		{"", true, []string{"e"}},
+	}
+	if len(resp.Clusters) != len(want) {
+		t.Fatalf("got %d clusters, want %d: %+v", len(resp.Clusters), len(want), resp.Clusters)
+	}
+	for i, c := range resp.Clusters {
+		var names []string
+		for _, m := range c.Gateways {
+			names = append(names, m.GatewayName)
+			if c.Unreachable != (m.Error != "") {
+				t.Errorf("cluster %d: %s error = %q", i, m.GatewayName, m.Error)
+			}
+		}
+		if c.Response != want[i].response || c.Unreachable != want[i].unreachable || !slices.Equal(names, want[i].gateways) {
+			t.Errorf("cluster %d = %q unreachable %v %v, want %q unreachable %v %v",
+				i, c.Response, c.Unreachable, names, want[i].response, want[i].unreachable, want[i].gateways)
+		}
+	}
+
+	wantDiff := "--- cluster 1 (a, b, c)\n+++ cluster 2 (d)\n@@ -1,2 +1,2 @@\n Paris is the capital.\n-Population: 2.1M\n+Population: 2.2M\n"
+	if resp.Diff != wantDiff {
+		t.Errorf("diff =\n%s\nwant\n%s", resp.Diff, wantDiff)
+	}
+	if resp.Summary.Total != 5 || resp.Summary.Succeeded != 4 || resp.Summary.Failed != 1 {
+		t.Errorf("summary = %+v, want 5 total, 4 succeeded, 1 failed", resp.Summary)
+	}
+}
+
+func TestCompareHandlerRejects(t *testing.T) {
+	a, r, _ := newTestAgent(t)
+	addGateway(t, r, "a", "Paris", nil)
+	h := NewHandler(a, nil)
+
+	for _, tt := range []struct {
+		name string
+		body string
+		want int
+	}{
+		{"no prompt", `{}`, http.StatusBadRequest},
+		{"malformed", `{"prompt":`, http.StatusBadRequest},
+		{"aggregating", `{"prompt":"hi","aggregation":"quorum"}`, http.StatusBadRequest},
+	} {
+		rec := httptest.NewRecorder()
+		h.Compare(rec, httptest.NewRequest(http.MethodPost, "/api/v1/meta/compare", strings.NewReader(tt.body)))
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, rec.Code, tt.want, rec.Body)
+		}
+	}
+}
+
+func TestCompareAgreement(t *testing.T) {
+	a, r, _ := newTestAgent(t)
+	addGateway(t, r, "a", `{"capital":"Paris","country":"France"}`, nil)
+	addGateway(t, r, "b", `{"country": "France", "capital": "Paris"}`, nil)
+
+	rec := httptest.NewRecorder()
+	NewHandler(a, nil).Compare(rec, httptest.NewRequest(http.MethodPost, "/api/v1/meta/compare", strings.NewReader(`{"prompt":"hi"}`)))
+	var resp CompareResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Clusters) != 1 || len(resp.Clusters[0].Gateways) != 2 || resp.Diff != "" {
+		t.Errorf("got clusters %+v, diff %q; want one cluster and no diff", resp.Clusters, resp.Diff)
+	}
+}
+
+func TestNormalizeAnswer(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"plain", "Paris", "Paris"},
+		{"whitespace within lines", "  Paris   is\tthe capital ", "Paris is the capital"},
+		{"keeps lines", "one\n  two  \nthree", "one\ntwo\nthree"},
+		{"trims blank lines", "\n\none\n\n", "one"},
+		{"openclaw body", `{"response":"Paris  is the capital"}`, "Paris is the capital"},
+		{"json answer", `{"response":"{\"b\":1,\"a\":2}"}`, "{\n  \"a\": 2,\n  \"b\": 1\n}"},
+		{"json without response", `{"answer":"Paris"}`, "{\n  \"answer\": \"Paris\"\n}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeAnswer(tt.raw); got != tt.want {
+				t.Errorf("normalizeAnswer(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package metaagent
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	lines := func(n int, change map[int]string) string {
+		var out []string
+		for i := 1; i <= n; i++ {
+			if s, ok := change[i]; ok {
+				out = append(out, s)
+			} else {
+				out = append(out, "line "+string(rune('a'+i-1)))
+			}
+		}
+		return strings.Join(out, "\n")
+	}
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"equal", "same\ntext", "same\ntext", ""},
+		{"change", "x\ny\nz", "x\nY\nz", "@@ -1,3 +1,3 @@\n x\n-y\n+Y\n z\n"},
+		{"insert into empty", "", "new", "@@ -0,0 +1 @@\n+new\n"},
+		{"delete all", "old", "", "@@ -1 +0,0 @@\n-old\n"},
+		{"append", "x\ny", "x\ny\nz", "@@ -1,2 +1,3 @@\n x\n y\n+z\n"},
+		{
+			"context is trimmed",
+			lines(10, nil), lines(10, map[int]string{5: "changed"}),
+			"@@ -2,7 +2,7 @@\n line b\n line c\n line d\n-line e\n+changed\n line f\n line g\n line h\n",
+		},
+		{
+			"distant changes get separate hunks",
+			lines(20, nil), lines(20, map[int]string{2: "first", 18: "second"}),
+			"@@ -1,5 +1,5 @@\n line a\n-line b\n+first\n line c\n line d\n line e\n" +
+				"@@ -15,6 +15,6 @@\n line o\n line p\n line q\n-line r\n+second\n line s\n line t\n",
+		},
+		{
+			"nearby changes share a hunk",
+			lines(12, nil), lines(12, map[int]string{3: "first", 8: "second"}),
+			"@@ -1,11 +1,11 @@\n line a\n line b\n-line c\n+first\n line d\n line e\n line f\n line g\n-line h\n+second\n line i\n line j\n line k\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := unifiedDiff("a", "b", tt.a, tt.b)
+			if tt.want != "" {
+				tt.want = "--- a\n+++ b\n" + tt.want
+			}
+			if got != tt.want {
+				t.Errorf("unifiedDiff =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,23 +2,20 @@ package metaagent
 
 import (
 	"context"
+	"errors"
 	"sync"
+	"time"
 
-	"github.com/AdamPippert/Lobstertank/internal/gateway"
 	"github.com/AdamPippert/Lobstertank/internal/model"
 )
 
-// fanOutToGateways sends a prompt to all gateways concurrently and collects results.
-func fanOutToGateways(
-	ctx context.Context,
-	factory *gateway.ClientFactory,
-	gateways []model.Gateway,
-	prompt string,
-) []GatewayResult {
+// streamToGateways sends a message to all gateways concurrently and delivers
+// each result on the returned channel as soon as its gateway answers. The
+// channel is closed after the last result.
+func (a *Agent) streamToGateways(ctx context.Context, gateways []model.Gateway, msg message) <-chan GatewayResult {
 	var (
-		mu      sync.Mutex
 		wg      sync.WaitGroup
-		results = make([]GatewayResult, 0, len(gateways))
+		results = make(chan GatewayResult, len(gateways))
 	)
 
 	for i := range gateways {
@@ -26,26 +23,46 @@ func fanOutToGateways(
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-
-			client := factory.ClientFor(&gw)
-			resp, err := client.SendPrompt(ctx, prompt)
-
-			result := GatewayResult{
-				GatewayID:   gw.ID,
-				GatewayName: gw.Name,
-			}
-			if err != nil {
-				result.Error = err.Error()
-			} else {
-				result.Response = string(resp)
-			}
-
-			mu.Lock()
-			results = append(results, result)
-			mu.Unlock()
+			results <- a.send(ctx, &gw, msg)
 		}()
 	}
 
-	wg.Wait()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
 	return results
 }
+
+// send delivers a message to one gateway, records the token usage of a
+// successful answer, and reports the outcome. A prompt template that fails
+// to render for the gateway is reported as its error without contacting it.
+func (a *Agent) send(ctx context.Context, gw *model.Gateway, msg message) GatewayResult {
+	result := GatewayResult{GatewayID: gw.ID, GatewayName: gw.Name}
+	prompt, err := msg.render(gw)
+	if err != nil {
+		result.Error = err.Error()
+		result.unsent = true
+		return result
+	}
+
+	start := time.Now()
+	client := a.clientFactory.ClientFor(gw)
+	if o, ok := msg.overrides[gw.ID]; ok {
+		client = a.clientFactory.ClientForOverride(o.apply(gw))
+	}
+	resp, usage, err := client.SendPrompt(ctx, prompt, msg.metadata)
+	result.LatencyMillis = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		result.Canceled = errors.Is(ctx.Err(), context.Canceled)
+		return result
+	}
+
+	result.Response = string(resp)
+	result.Usage = &usage
+	// A fan-out decided by another gateway cancels ctx, but this answer
+	// still consumed tokens.
+	a.registry.RecordUsage(context.WithoutCancel(ctx), gw.ID, usage)
+	return result
+}
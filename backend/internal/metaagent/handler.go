@@ -1,52 +1,266 @@
 package metaagent
 
 import (
+	"context"
 	"encoding/json"
-	"log/slog"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/gateway"
+	"github.com/AdamPippert/Lobstertank/internal/httputil"
+	"github.com/AdamPippert/Lobstertank/internal/logging"
+	"github.com/AdamPippert/Lobstertank/internal/store"
 )
 
 // Handler exposes meta-agent operations over HTTP.
 type Handler struct {
 	agent *Agent
+	jobs  *Jobs
 }
 
 // NewHandler creates a new meta-agent HTTP handler.
-func NewHandler(a *Agent) *Handler {
-	return &Handler{agent: a}
+func NewHandler(a *Agent, j *Jobs) *Handler {
+	return &Handler{agent: a, jobs: j}
 }
 
-// FanOut handles POST /api/v1/meta/fanout.
+// FanOut handles POST /api/v1/meta/fanout. With ?async=true the fan-out runs
+// as a background job and the response is 202 with the pending job.
 func (h *Handler) FanOut(w http.ResponseWriter, r *http.Request) {
+	var async bool
+	if v := r.URL.Query().Get("async"); v != "" {
+		var err error
+		if async, err = strconv.ParseBool(v); err != nil {
+			httputil.WriteError(w, r, http.StatusBadRequest, "invalid async parameter", nil)
+			return
+		}
+	}
+
 	var req FanOutRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid request body")
+		httputil.WriteBodyError(w, r, err)
 		return
 	}
 
 	if req.Prompt == "" {
-		writeError(w, http.StatusBadRequest, "prompt is required")
+		httputil.WriteError(w, r, http.StatusBadRequest, "prompt is required", nil)
+		return
+	}
+
+	if async {
+		h.startJob(w, r, req)
 		return
 	}
 
 	resp, err := h.agent.FanOut(r.Context(), req)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "fan-out failed")
-		slog.Error("fan-out failed", "error", err)
+		writeFanOutError(w, r, "fan-out failed", err)
+		return
+	}
+
+	httputil.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) startJob(w http.ResponseWriter, r *http.Request, req FanOutRequest) {
+	job, err := h.jobs.Start(r.Context(), req)
+	if err != nil {
+		writeFanOutError(w, r, "failed to start fan-out job", err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/meta/jobs/"+job.ID)
+	httputil.WriteJSON(w, http.StatusAccepted, job)
+}
+
+// GetJob handles GET /api/v1/meta/jobs/{id}.
+func (h *Handler) GetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.jobs.Get(r.Context(), r.PathValue("id"))
+	if errors.Is(err, store.ErrJobNotFound) {
+		httputil.WriteError(w, r, http.StatusNotFound, "fan-out job not found", nil)
+		return
+	}
+	if err != nil {
+		httputil.WriteError(w, r, http.StatusInternalServerError, "failed to get fan-out job", err)
+		return
+	}
+
+	httputil.WriteJSON(w, http.StatusOK, job)
+}
+
+// DeleteJob handles DELETE /api/v1/meta/jobs/{id}. A running job is
+// canceled first.
+func (h *Handler) DeleteJob(w http.ResponseWriter, r *http.Request) {
+	err := h.jobs.Delete(r.Context(), r.PathValue("id"))
+	if errors.Is(err, store.ErrJobNotFound) {
+		httputil.WriteError(w, r, http.StatusNotFound, "fan-out job not found", nil)
+		return
+	}
+	if err != nil {
+		httputil.WriteError(w, r, http.StatusInternalServerError, "failed to delete fan-out job", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Compare handles POST /api/v1/meta/compare.
+func (h *Handler) Compare(w http.ResponseWriter, r *http.Request) {
+	var req FanOutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.WriteBodyError(w, r, err)
+		return
+	}
+
+	if req.Prompt == "" {
+		httputil.WriteError(w, r, http.StatusBadRequest, "prompt is required", nil)
+		return
+	}
+
+	resp, err := h.agent.Compare(r.Context(), req)
+	if err != nil {
+		writeFanOutError(w, r, "compare failed", err)
+		return
+	}
+
+	httputil.WriteJSON(w, http.StatusOK, resp)
+}
+
+// Route handles POST /api/v1/meta/route. When every attempt fails the
+// response is 502 with the same body, so the failures can be inspected.
+func (h *Handler) Route(w http.ResponseWriter, r *http.Request) {
+	var req RouteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.WriteBodyError(w, r, err)
+		return
+	}
+
+	if req.Prompt == "" {
+		httputil.WriteError(w, r, http.StatusBadRequest, "prompt is required", nil)
+		return
+	}
+
+	resp, err := h.agent.Route(r.Context(), req)
+	if errors.Is(err, ErrNoTargets) {
+		httputil.WriteJSON(w, http.StatusUnprocessableEntity, httputil.ErrorResponse{Error: "no gateways to route to", Message: err.Error()})
+		return
+	}
+	if err != nil {
+		writeFanOutError(w, r, "route failed", err)
+		return
+	}
+
+	status := http.StatusOK
+	if !resp.Succeeded() {
+		status = http.StatusBadGateway
+	}
+	httputil.WriteJSON(w, status, resp)
+}
+
+// HealthSweep handles POST /api/v1/meta/health. An empty body checks every
+// gateway.
+func (h *Handler) HealthSweep(w http.ResponseWriter, r *http.Request) {
+	var req HealthSweepRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		httputil.WriteBodyError(w, r, err)
+		return
+	}
+
+	report, err := h.agent.HealthSweep(r.Context(), req)
+	switch {
+	case errors.Is(err, store.ErrNotFound), errors.Is(err, store.ErrGroupNotFound):
+		httputil.WriteError(w, r, http.StatusNotFound, "gateway or group not found", err)
+		return
+	case errors.Is(err, gateway.ErrForbidden):
+		httputil.WriteError(w, r, http.StatusForbidden, "forbidden", err)
+		return
+	case err != nil:
+		httputil.WriteError(w, r, http.StatusInternalServerError, "health sweep failed", err)
+		return
+	}
+	httputil.WriteJSON(w, http.StatusOK, report)
+}
+
+// FanOutStream handles POST /api/v1/meta/fanout/stream. Each gateway's
+// result is sent as a "result" event when it arrives, followed by one
+// "summary" event. A client that disconnects cancels the outstanding
+// gateway requests.
+func (h *Handler) FanOutStream(w http.ResponseWriter, r *http.Request) {
+	var req FanOutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.WriteBodyError(w, r, err)
+		return
+	}
+
+	if req.Prompt == "" {
+		httputil.WriteError(w, r, http.StatusBadRequest, "prompt is required", nil)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	stream, err := h.agent.FanOutStream(ctx, req)
+	if err != nil {
+		writeFanOutError(w, r, "fan-out failed", err)
 		return
 	}
 
-	writeJSON(w, http.StatusOK, resp)
+	rc := http.NewResponseController(w)
+	// Slow gateways may keep the stream open past the server's write timeout.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		logging.LoggerFromContext(r.Context()).Debug("cannot clear write deadline for fan-out stream", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	for result := range stream.Results {
+		if err := writeEvent(w, rc, "result", result); err != nil {
+			cancel() // the client is gone; stop waiting on gateways
+			return
+		}
+	}
+	_ = writeEvent(w, rc, "summary", stream.Summary())
 }
 
-func writeJSON(w http.ResponseWriter, status int, v any) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	if err := json.NewEncoder(w).Encode(v); err != nil {
-		slog.Error("failed to encode response", "error", err)
+// writeFanOutError maps an error from starting a fan-out or route to a
+// response.
+func writeFanOutError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidAggregation):
+		httputil.WriteJSON(w, http.StatusBadRequest, httputil.ErrorResponse{Error: "invalid aggregation", Message: err.Error()})
+	case errors.Is(err, ErrInvalidTemplate):
+		httputil.WriteJSON(w, http.StatusBadRequest, httputil.ErrorResponse{Error: "invalid prompt template", Message: err.Error()})
+	case errors.Is(err, ErrInvalidOverride):
+		httputil.WriteJSON(w, http.StatusBadRequest, httputil.ErrorResponse{Error: "invalid gateway override", Message: err.Error()})
+	case errors.Is(err, ErrInvalidRoute):
+		httputil.WriteJSON(w, http.StatusBadRequest, httputil.ErrorResponse{Error: "invalid route request", Message: err.Error()})
+	case errors.Is(err, ErrNoTargets):
+		httputil.WriteJSON(w, http.StatusUnprocessableEntity, httputil.ErrorResponse{Error: "no gateways to fan out to", Message: err.Error()})
+	case errors.Is(err, ErrShuttingDown):
+		httputil.WriteError(w, r, http.StatusServiceUnavailable, "server is shutting down", nil)
+	case errors.Is(err, gateway.ErrForbidden):
+		httputil.WriteError(w, r, http.StatusForbidden, "forbidden", err)
+	case errors.Is(err, store.ErrNotFound), errors.Is(err, store.ErrGroupNotFound):
+		httputil.WriteError(w, r, http.StatusNotFound, "gateway or group not found", err)
+	default:
+		httputil.WriteError(w, r, http.StatusInternalServerError, msg, err)
 	}
 }
 
-func writeError(w http.ResponseWriter, status int, msg string) {
-	writeJSON(w, status, map[string]string{"error": msg})
+// writeEvent writes one Server-Sent Event with a JSON payload and flushes it.
+func writeEvent(w http.ResponseWriter, rc *http.ResponseController, event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	return rc.Flush()
 }
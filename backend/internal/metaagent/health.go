@@ -0,0 +1,159 @@
+package metaagent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// slowestReported is the number of gateways listed in HealthReport.Slowest.
+const slowestReported = 5
+
+// HealthSweepRequest selects the gateways a health sweep checks, the same
+// way a fan-out does, optionally narrowed by labels.
+type HealthSweepRequest struct {
+	GatewayIDs []string          `json:"gateway_ids,omitempty"` // Empty (with no group) means all gateways.
+	GroupID    string            `json:"group_id,omitempty"`    // Adds the group's members to GatewayIDs.
+	Selector   map[string]string `json:"selector,omitempty"`    // gateway labels that must all match
+}
+
+// HealthReport summarizes a health sweep.
+type HealthReport struct {
+	Total int `json:"total"`
+	// Counts holds the number of gateways in each status. Gateways in
+	// maintenance are not checked and are counted as "maintenance".
+	Counts map[model.Status]int `json:"counts"`
+	// Slowest lists the gateways that answered most slowly, slowest first.
+	Slowest []GatewayHealth `json:"slowest"`
+	// NewlyDegraded lists the gateways whose health got worse than their
+	// stored status: online to degraded or offline, or degraded to offline.
+	NewlyDegraded  []GatewayHealth `json:"newly_degraded"`
+	DurationMillis int64           `json:"duration_ms"` // wall clock for the whole sweep
+}
+
+// GatewayHealth is one gateway's result within a health report.
+type GatewayHealth struct {
+	GatewayID      string          `json:"gateway_id"`
+	GatewayName    string          `json:"gateway_name"`
+	Status         model.Status    `json:"status"`
+	PreviousStatus model.Status    `json:"previous_status,omitempty"` // set in NewlyDegraded
+	LatencyMillis  int64           `json:"latency_ms"`
+	Error          string          `json:"error,omitempty"`
+	ErrorKind      model.ErrorKind `json:"error_kind,omitempty"`
+}
+
+// HealthSweep health-checks the selected gateways now, with the prober's
+// concurrency and timeout, and persists their statuses. Unlike the monitor
+// it reports on the whole set at once, so it also answers for gateways the
+// monitor has not reached recently.
+func (a *Agent) HealthSweep(ctx context.Context, req HealthSweepRequest) (*HealthReport, error) {
+	gateways, err := a.resolveGateways(ctx, req.GatewayIDs, req.GroupID)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	report := &HealthReport{
+		Counts:        make(map[model.Status]int),
+		Slowest:       []GatewayHealth{},
+		NewlyDegraded: []GatewayHealth{},
+	}
+	var probed []model.Gateway
+	for _, gw := range gateways {
+		if !labelsMatch(gw.Labels, req.Selector) {
+			continue
+		}
+		report.Total++
+		if a.registry.MaintenanceActive(&gw) {
+			report.Counts[model.StatusMaintenance]++
+			continue
+		}
+		probed = append(probed, gw)
+	}
+
+	results := a.prober.ProbeAll(ctx, probed)
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("health sweep interrupted: %w", err)
+	}
+
+	var answered []GatewayHealth
+	for i, result := range results {
+		gw := &probed[i]
+		h := GatewayHealth{
+			GatewayID:     gw.ID,
+			GatewayName:   gw.Name,
+			Status:        result.Status,
+			LatencyMillis: result.LatencyMillis,
+			Error:         result.Error,
+			ErrorKind:     result.ErrorKind,
+		}
+		report.Counts[result.Status]++
+		if result.Status == model.StatusOnline || result.Status == model.StatusDegraded {
+			answered = append(answered, h)
+		}
+		if worsened(gw.Status, result.Status) {
+			h.PreviousStatus = gw.Status
+			report.NewlyDegraded = append(report.NewlyDegraded, h)
+		}
+	}
+
+	sort.SliceStable(answered, func(i, j int) bool { return answered[i].LatencyMillis > answered[j].LatencyMillis })
+	report.Slowest = append(report.Slowest, answered[:min(len(answered), slowestReported)]...)
+	report.DurationMillis = time.Since(start).Milliseconds()
+
+	a.auditor.Log(ctx, audit.Event{
+		Action: "metaagent.health_sweep",
+		Detail: fmt.Sprintf("health sweep of %d gateways: %s; %d newly degraded in %dms",
+			report.Total, summarizeCounts(report.Counts), len(report.NewlyDegraded), report.DurationMillis),
+	})
+	return report, nil
+}
+
+// healthRank orders the statuses a health check can report from best to
+// worst; other statuses have no rank.
+var healthRank = map[model.Status]int{
+	model.StatusOnline:   1,
+	model.StatusDegraded: 2,
+	model.StatusOffline:  3,
+}
+
+// worsened reports whether a gateway went from a known health to a worse
+// one. A gateway never checked before has nothing to be compared with.
+func worsened(prev, now model.Status) bool {
+	p, n := healthRank[prev], healthRank[now]
+	return p != 0 && n > p
+}
+
+// labelsMatch reports whether labels has every key and value in selector.
+func labelsMatch(labels, selector map[string]string) bool {
+	for k, v := range selector {
+		if got, ok := labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// reportOrder is the order in which summarizeCounts lists statuses.
+var reportOrder = []model.Status{
+	model.StatusOnline, model.StatusDegraded, model.StatusOffline, model.StatusUnknown, model.StatusMaintenance,
+}
+
+// summarizeCounts formats status counts, e.g. "3 online, 1 offline".
+func summarizeCounts(counts map[model.Status]int) string {
+	var parts []string
+	for _, s := range reportOrder {
+		if counts[s] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[s], s))
+		}
+	}
+	if len(parts) == 0 {
+		return "none checked"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,256 @@
+package metaagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/auth"
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+	"github.com/google/uuid"
+)
+
+// maxSweepInterval bounds how long expired jobs linger past their retention.
+const maxSweepInterval = time.Hour
+
+// ErrShuttingDown is returned when a job is started after the server began
+// shutting down.
+var ErrShuttingDown = errors.New("server is shutting down")
+
+// Jobs runs fan-outs in the background and records each result as it
+// arrives, so clients can poll for results instead of holding a request
+// open past the server's write timeout.
+type Jobs struct {
+	agent     *Agent
+	store     store.Store
+	clock     clock.Clock
+	timeout   time.Duration
+	retention time.Duration
+
+	// ctx is the parent of every job; Run cancels it on shutdown.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	active map[string]*activeJob
+}
+
+type activeJob struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewJobs creates a job runner. Jobs may be started before Run is called.
+func NewJobs(a *Agent, s store.Store, clk clock.Clock, cfg config.FanOutConfig) *Jobs {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Jobs{
+		agent:     a,
+		store:     s,
+		clock:     clk,
+		timeout:   cfg.JobTimeout,
+		retention: cfg.JobRetention,
+		ctx:       ctx,
+		cancel:    cancel,
+		active:    make(map[string]*activeJob),
+	}
+}
+
+// Run prunes expired jobs until ctx is canceled, then cancels the jobs still
+// running and waits for them to record their final state.
+func (j *Jobs) Run(ctx context.Context) {
+	for {
+		var sweep <-chan time.Time
+		if j.retention > 0 {
+			sweep = j.clock.After(min(j.retention, maxSweepInterval))
+		}
+
+		select {
+		case <-ctx.Done():
+			j.mu.Lock()
+			j.cancel()
+			j.mu.Unlock()
+			j.wg.Wait()
+			return
+		case <-sweep:
+			n, err := j.store.PruneFanOutJobs(ctx, j.clock.Now().Add(-j.retention))
+			if err != nil {
+				slog.Warn("failed to prune fan-out jobs", "error", err)
+			} else if n > 0 {
+				slog.Debug("pruned fan-out jobs", "count", n)
+			}
+		}
+	}
+}
+
+// Start plans a fan-out, records it as pending, and runs it in the
+// background. Planning errors such as ErrNoTargets are returned directly.
+func (j *Jobs) Start(ctx context.Context, req FanOutRequest) (*model.FanOutJob, error) {
+	if err := requireAllAggregation(req); err != nil {
+		return nil, err
+	}
+	msg, err := newMessage(req)
+	if err != nil {
+		return nil, err
+	}
+	gateways, targets, skipped, err := j.agent.plan(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	now := j.clock.Now().UTC()
+	job := &model.FanOutJob{
+		ID:        uuid.New().String(),
+		Status:    model.JobPending,
+		Total:     len(gateways),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Results:   []model.FanOutJobResult{},
+	}
+	if p, ok := auth.PrincipalFromContext(ctx); ok {
+		job.CreatedBy, job.OrgID = p.Subject, p.Org
+	}
+	if err := j.store.CreateFanOutJob(ctx, job); err != nil {
+		return nil, fmt.Errorf("create fan-out job: %w", err)
+	}
+
+	// The job outlives the request but keeps its values, such as the
+	// principal, for auditing. It ends on its own timeout, on cancellation,
+	// or on shutdown.
+	var (
+		jobCtx context.Context
+		cancel context.CancelFunc
+	)
+	if j.timeout > 0 {
+		jobCtx, cancel = context.WithTimeout(context.WithoutCancel(ctx), j.timeout)
+	} else {
+		jobCtx, cancel = context.WithCancel(context.WithoutCancel(ctx))
+	}
+	stop := context.AfterFunc(j.ctx, cancel)
+	aj := &activeJob{cancel: cancel, done: make(chan struct{})}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.ctx.Err() != nil {
+		stop()
+		cancel()
+		return nil, ErrShuttingDown
+	}
+	j.active[job.ID] = aj
+	j.wg.Add(1)
+
+	go func() {
+		defer j.wg.Done()
+		defer close(aj.done)
+		defer func() {
+			stop()
+			cancel()
+			j.mu.Lock()
+			delete(j.active, job.ID)
+			j.mu.Unlock()
+		}()
+
+		j.run(jobCtx, job.ID, msg, gateways, targets, skipped)
+	}()
+	return job, nil
+}
+
+// run performs a planned fan-out, recording each result and the job's
+// progress.
+func (j *Jobs) run(ctx context.Context, id string, msg message, gateways, targets []model.Gateway, skipped []GatewayResult) {
+	// Writes outlive cancellation so a canceled job still records why each
+	// gateway failed.
+	wctx := context.WithoutCancel(ctx)
+
+	j.setStatus(wctx, id, model.JobRunning)
+	stream := j.agent.start(ctx, msg, gateways, targets, skipped)
+	for r := range stream.Results {
+		result := model.FanOutJobResult{
+			Position:      stream.order[r.GatewayID],
+			GatewayID:     r.GatewayID,
+			GatewayName:   r.GatewayName,
+			Response:      r.Response,
+			Error:         r.Error,
+			Skipped:       r.Skipped,
+			SkipReason:    r.SkipReason,
+			LatencyMillis: r.LatencyMillis,
+			CompletedAt:   j.clock.Now().UTC(),
+		}
+		if err := j.store.InsertFanOutResult(wctx, id, &result); err != nil {
+			slog.Error("failed to record fan-out result", "job", id, "gateway", r.GatewayID, "error", err)
+			continue
+		}
+		j.setStatus(wctx, id, model.JobPartial)
+	}
+	j.setStatus(wctx, id, model.JobComplete)
+}
+
+func (j *Jobs) setStatus(ctx context.Context, id string, status model.JobStatus) {
+	if err := j.store.UpdateFanOutJobStatus(ctx, id, status, j.clock.Now().UTC()); err != nil {
+		slog.Error("failed to update fan-out job status", "job", id, "status", status, "error", err)
+	}
+}
+
+// Get returns a job with the results recorded so far. Jobs started by
+// another principal are reported as not found.
+func (j *Jobs) Get(ctx context.Context, id string) (*model.FanOutJob, error) {
+	job, err := j.store.GetFanOutJob(ctx, id)
+	if err == nil && !ownedByCaller(ctx, job) {
+		err = fmt.Errorf("%w: %s", store.ErrJobNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get fan-out job %s: %w", id, err)
+	}
+	return job, nil
+}
+
+// ownedByCaller reports whether the caller started job. Without a principal,
+// as when auth is disabled, every job is the caller's.
+func ownedByCaller(ctx context.Context, job *model.FanOutJob) bool {
+	p, ok := auth.PrincipalFromContext(ctx)
+	return !ok || (p.Subject == job.CreatedBy && p.Org == job.OrgID)
+}
+
+// Delete cancels a job if it is still running, waits for it to stop, and
+// deletes it along with its results. Like Get, it reports jobs started by
+// another principal as not found.
+func (j *Jobs) Delete(ctx context.Context, id string) error {
+	if _, err := j.Get(ctx, id); err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	aj := j.active[id]
+	j.mu.Unlock()
+
+	if aj != nil {
+		aj.cancel()
+		select {
+		case <-aj.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if err := j.store.DeleteFanOutJob(ctx, id); err != nil {
+		return fmt.Errorf("delete fan-out job %s: %w", id, err)
+	}
+
+	detail := "fan-out job deleted"
+	if aj != nil {
+		detail = "fan-out job canceled"
+	}
+	j.agent.auditor.Log(ctx, audit.Event{
+		Action:   "metaagent.job_deleted",
+		Resource: id,
+		Detail:   detail,
+	})
+	return nil
+}
@@ -0,0 +1,65 @@
+package metaagent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/auth"
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+)
+
+func asPrincipal(subject, org string) context.Context {
+	return auth.ContextWithPrincipal(context.Background(), &auth.Principal{Subject: subject, Roles: []string{"operator"}, Org: org})
+}
+
+func TestJobsVisibleOnlyToTheirCreator(t *testing.T) {
+	s, err := store.NewSQLiteStore(":memory:", false, true)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	j := NewJobs(New(nil, nil, nil, audit.New(config.AuditConfig{})), s, clock.NewFake(now), config.FanOutConfig{})
+
+	job := &model.FanOutJob{ID: "job-1", Status: model.JobComplete, CreatedBy: "alice", OrgID: "acme", CreatedAt: now, UpdatedAt: now}
+	if err := s.CreateFanOutJob(context.Background(), job); err != nil {
+		t.Fatalf("CreateFanOutJob: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		ctx  context.Context
+	}{
+		{"another subject", asPrincipal("mallory", "acme")},
+		{"another organization", asPrincipal("alice", "initech")},
+		{"unscoped", asPrincipal("alice", "")},
+	} {
+		if _, err := j.Get(tt.ctx, job.ID); !errors.Is(err, store.ErrJobNotFound) {
+			t.Errorf("Get as %s: err = %v, want ErrJobNotFound", tt.name, err)
+		}
+		if err := j.Delete(tt.ctx, job.ID); !errors.Is(err, store.ErrJobNotFound) {
+			t.Errorf("Delete as %s: err = %v, want ErrJobNotFound", tt.name, err)
+		}
+	}
+
+	owner := asPrincipal("alice", "acme")
+	got, err := j.Get(owner, job.ID)
+	if err != nil {
+		t.Fatalf("Get as creator: %v", err)
+	}
+	if got.CreatedBy != "alice" || got.OrgID != "acme" {
+		t.Errorf("job owner = %q in %q, want alice in acme", got.CreatedBy, got.OrgID)
+	}
+	if err := j.Delete(owner, job.ID); err != nil {
+		t.Fatalf("Delete as creator: %v", err)
+	}
+	if _, err := j.Get(owner, job.ID); !errors.Is(err, store.ErrJobNotFound) {
+		t.Errorf("Get after Delete: err = %v, want ErrJobNotFound", err)
+	}
+}
@@ -0,0 +1,64 @@
+package metaagent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// ErrInvalidTemplate is returned when a prompt template does not parse.
+var ErrInvalidTemplate = errors.New("invalid prompt template")
+
+// message is what a fan-out sends to each gateway: the prompt, rendered
+// per gateway when it is a template, metadata forwarded as is, and the
+// settings to use instead of a gateway's stored ones.
+type message struct {
+	prompt    string
+	tmpl      *template.Template // nil when the prompt is sent verbatim
+	metadata  map[string]string
+	overrides map[string]GatewayOverride // by gateway ID
+}
+
+// templateData is what a prompt template can refer to, e.g.
+// "You are running on {{.GatewayName}} in {{.Labels.region}}".
+type templateData struct {
+	GatewayID   string
+	GatewayName string
+	Labels      map[string]string
+}
+
+// newMessage prepares a request's prompt, parsing it when it is a template.
+// A template referring to a label a gateway lacks fails for that gateway.
+func newMessage(req FanOutRequest) (message, error) {
+	msg := message{prompt: req.Prompt, metadata: req.Metadata, overrides: req.Overrides}
+	if !req.PromptTemplate {
+		return msg, nil
+	}
+
+	tmpl, err := template.New("prompt").Option("missingkey=error").Parse(req.Prompt)
+	if err != nil {
+		return message{}, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	msg.tmpl = tmpl
+	return msg, nil
+}
+
+// render returns the prompt for gw.
+func (m message) render(gw *model.Gateway) (string, error) {
+	if m.tmpl == nil {
+		return m.prompt, nil
+	}
+
+	var sb strings.Builder
+	data := templateData{GatewayID: gw.ID, GatewayName: gw.Name, Labels: gw.Labels}
+	if data.Labels == nil {
+		data.Labels = map[string]string{}
+	}
+	if err := m.tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("render prompt template: %w", err)
+	}
+	return sb.String(), nil
+}
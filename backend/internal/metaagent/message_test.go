@@ -0,0 +1,153 @@
+package metaagent
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AdamPippert/Lobstertank/internal/gateway"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// sentPrompt is what a gateway received with a prompt.
+type sentPrompt struct {
+	Prompt   string            `json:"prompt"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// addLabeledGateway registers a gateway named name with labels that answers
+// "ok" and delivers each prompt it receives on the returned channel.
+func addLabeledGateway(t *testing.T, r *gateway.Registry, name string, labels map[string]*string) (*fakeGateway, <-chan sentPrompt) {
+	t.Helper()
+	sent := make(chan sentPrompt, 10)
+	fg := addGatewayFunc(t, r, name, nil, func(w http.ResponseWriter, req *http.Request) {
+		var p sentPrompt
+		if err := json.NewDecoder(req.Body).Decode(&p); err != nil {
+			t.Errorf("%s: decode prompt: %v", name, err)
+		}
+		sent <- p
+		w.Write([]byte(`{"response":"ok"}`))
+	})
+	if labels != nil {
+		if _, err := r.Patch(context.Background(), fg.ID, model.PatchGatewayRequest{Labels: labels}); err != nil {
+			t.Fatalf("Patch %s: %v", name, err)
+		}
+	}
+	return fg, sent
+}
+
+// received returns the prompt a gateway was sent, if any.
+func received(sent <-chan sentPrompt) (sentPrompt, bool) {
+	select {
+	case p := <-sent:
+		return p, true
+	default:
+		return sentPrompt{}, false
+	}
+}
+
+func TestFanOutPromptTemplate(t *testing.T) {
+	a, r, _ := newTestAgent(t)
+	eu := "eu"
+	alpha, toAlpha := addLabeledGateway(t, r, "alpha", map[string]*string{"region": &eu})
+	bravo, toBravo := addLabeledGateway(t, r, "bravo", nil)
+	h := NewHandler(a, nil)
+
+	tests := []struct {
+		name      string
+		body      string
+		wantAlpha string
+		wantBravo string // empty when bravo is not sent the prompt
+		wantError string // in bravo's result
+	}{
+		{"rendered per gateway", `{"prompt":"You are {{.GatewayName}} ({{.GatewayID}})","prompt_template":true}`,
+			"You are alpha (" + alpha.ID + ")", "You are bravo (" + bravo.ID + ")", ""},
+		{"sent verbatim without the flag", `{"prompt":"You are {{.GatewayName}}"}`,
+			"You are {{.GatewayName}}", "You are {{.GatewayName}}", ""},
+		{"missing label", `{"prompt":"Serve {{.Labels.region}}","prompt_template":true}`,
+			"Serve eu", "", `map has no entry for key "region"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.FanOut(rec, httptest.NewRequest(http.MethodPost, "/api/v1/meta/fanout", strings.NewReader(tt.body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+			}
+			var resp FanOutResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+
+			if p, ok := received(toAlpha); !ok || p.Prompt != tt.wantAlpha {
+				t.Errorf("alpha was sent %q (sent %t), want %q", p.Prompt, ok, tt.wantAlpha)
+			}
+			p, ok := received(toBravo)
+			if tt.wantBravo == "" {
+				if ok {
+					t.Errorf("bravo was sent %q, want its template to fail before sending", p.Prompt)
+				}
+			} else if !ok || p.Prompt != tt.wantBravo {
+				t.Errorf("bravo was sent %q (sent %t), want %q", p.Prompt, ok, tt.wantBravo)
+			}
+
+			for _, res := range resp.Results {
+				if res.GatewayID != bravo.ID {
+					continue
+				}
+				if tt.wantError == "" && res.Error != "" || !strings.Contains(res.Error, tt.wantError) {
+					t.Errorf("bravo's error = %q, want %q", res.Error, tt.wantError)
+				}
+			}
+			if wantFailed := min(len(tt.wantError), 1); resp.Summary.Failed != wantFailed || resp.Summary.Succeeded != 2-wantFailed {
+				t.Errorf("summary = %+v, want %d failed", resp.Summary, wantFailed)
+			}
+		})
+	}
+}
+
+func TestFanOutForwardsMetadata(t *testing.T) {
+	a, r, _ := newTestAgent(t)
+	_, sent := addLabeledGateway(t, r, "alpha", nil)
+
+	rec := httptest.NewRecorder()
+	NewHandler(a, nil).FanOut(rec, httptest.NewRequest(http.MethodPost, "/api/v1/meta/fanout",
+		strings.NewReader(`{"prompt":"hello","metadata":{"ticket":"T-1","user":"ops"}}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	want := map[string]string{"ticket": "T-1", "user": "ops"}
+	if p, ok := received(sent); !ok || !maps.Equal(p.Metadata, want) {
+		t.Errorf("gateway was sent metadata %v (sent %t), want %v", p.Metadata, ok, want)
+	}
+}
+
+func TestFanOutRejectsBadTemplate(t *testing.T) {
+	a, r, _ := newTestAgent(t)
+	alpha := addGateway(t, r, "alpha", "ok", nil)
+	h := NewHandler(a, nil)
+
+	for _, tt := range []struct {
+		name   string
+		serve  http.HandlerFunc
+		target string
+		body   string
+	}{
+		{"unclosed action", h.FanOut, "/api/v1/meta/fanout", `{"prompt":"You are {{.GatewayName","prompt_template":true}`},
+		{"unknown function", h.FanOut, "/api/v1/meta/fanout", `{"prompt":"{{shout .GatewayName}}","prompt_template":true}`},
+		{"stream", h.FanOutStream, "/api/v1/meta/fanout/stream", `{"prompt":"{{end}}","prompt_template":true}`},
+	} {
+		rec := httptest.NewRecorder()
+		tt.serve(rec, httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body)))
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"invalid prompt template"`) {
+			t.Errorf("%s: status = %d, want 400 invalid prompt template: %s", tt.name, rec.Code, rec.Body)
+		}
+	}
+	if n := alpha.prompts.Load(); n != 0 {
+		t.Errorf("gateway received %d prompts, want none", n)
+	}
+}
@@ -0,0 +1,79 @@
+package metaagent
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/AdamPippert/Lobstertank/internal/gateway"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// ErrInvalidOverride is returned when a fan-out override names a gateway the
+// fan-out does not target or leaves a gateway with invalid settings.
+var ErrInvalidOverride = errors.New("invalid gateway override")
+
+// GatewayOverride replaces a gateway's transport or auth settings for one
+// fan-out, e.g. to try a new token before storing it. Like a merge patch,
+// each field present replaces the stored object as a whole. Overrides are
+// never persisted, and may not name secrets: a token under test is given
+// inline, since a secret ref could name another gateway's credentials.
+type GatewayOverride struct {
+	Transport *model.TransportConfig   `json:"transport,omitempty"`
+	Auth      *model.GatewayAuthConfig `json:"auth,omitempty"`
+}
+
+// apply returns a copy of gw with the override's settings.
+func (o GatewayOverride) apply(gw *model.Gateway) *model.Gateway {
+	out := *gw
+	if o.Transport != nil {
+		out.Transport = model.TransportConfig{Type: o.Transport.Type, Params: maps.Clone(o.Transport.Params)}
+	}
+	if o.Auth != nil {
+		out.Auth = model.GatewayAuthConfig{Type: o.Auth.Type, Params: maps.Clone(o.Auth.Params), SecretRef: o.Auth.SecretRef}
+	}
+	return &out
+}
+
+// checkOverrides verifies that every override targets one of the gateways,
+// names no secrets, and leaves the gateway with valid settings.
+func checkOverrides(overrides map[string]GatewayOverride, gateways []model.Gateway) error {
+	if len(overrides) == 0 {
+		return nil
+	}
+	byID := make(map[string]*model.Gateway, len(gateways))
+	for i := range gateways {
+		byID[gateways[i].ID] = &gateways[i]
+	}
+
+	ids := make([]string, 0, len(overrides))
+	for id := range overrides {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var problems []string
+	for _, id := range ids {
+		gw, ok := byID[id]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: not a gateway this fan-out targets", id))
+			continue
+		}
+		if auth := overrides[id].Auth; auth != nil {
+			if fields := slices.Sorted(maps.Keys(gateway.SecretRefs(*auth))); len(fields) > 0 {
+				problems = append(problems, fmt.Sprintf("%s: %s cannot be overridden", id, strings.Join(fields, ", ")))
+				continue
+			}
+		}
+		if err := gateway.Validate(overrides[id].apply(gw)); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", id, err))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidOverride, strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package metaagent
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+func TestCheckOverrides(t *testing.T) {
+	gateways := []model.Gateway{{
+		ID:        "gw-1",
+		Name:      "edge",
+		Endpoint:  "https://edge.example.com",
+		Transport: model.TransportConfig{Type: "https"},
+		Auth:      model.GatewayAuthConfig{Type: "token", SecretRef: "builtin://gateways/gw-1/token"},
+	}}
+
+	for _, tt := range []struct {
+		name     string
+		override GatewayOverride
+		problem  string // empty when the override is valid
+	}{
+		{"inline token", GatewayOverride{Auth: &model.GatewayAuthConfig{Type: "token", Params: map[string]string{"token": "candidate"}}}, ""},
+		{"secret ref", GatewayOverride{Auth: &model.GatewayAuthConfig{Type: "token", SecretRef: "builtin://gateways/gw-2/token"}}, "auth.secret_ref cannot be overridden"},
+		{"mtls refs", GatewayOverride{Auth: &model.GatewayAuthConfig{
+			Type:      "mtls",
+			SecretRef: "builtin://gateways/gw-2/cert",
+			Params:    map[string]string{"ca_ref": "builtin://gateways/gw-2/ca"},
+		}}, "auth.params.ca_ref, auth.secret_ref cannot be overridden"},
+		{"unknown transport", GatewayOverride{Transport: &model.TransportConfig{Type: "carrier-pigeon"}}, "unknown transport"},
+	} {
+		err := checkOverrides(map[string]GatewayOverride{"gw-1": tt.override}, gateways)
+		switch {
+		case tt.problem == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.problem != "" && (!errors.Is(err, ErrInvalidOverride) || !strings.Contains(err.Error(), tt.problem)):
+			t.Errorf("%s: err = %v, want ErrInvalidOverride reporting %q", tt.name, err, tt.problem)
+		}
+	}
+
+	err := checkOverrides(map[string]GatewayOverride{"gw-9": {}}, gateways)
+	if !errors.Is(err, ErrInvalidOverride) {
+		t.Errorf("override for an untargeted gateway: err = %v, want ErrInvalidOverride", err)
+	}
+}
+
+func TestFanOutOverrideReachesGateway(t *testing.T) {
+	a, r, _ := newTestAgent(t)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	received := map[string]string{} // gateway name -> Authorization header
+	addTokenGateway := func(name string) *fakeGateway {
+		fg := addGatewayFunc(t, r, name, nil, func(w http.ResponseWriter, req *http.Request) {
+			mu.Lock()
+			received[name] = req.Header.Get("Authorization")
+			mu.Unlock()
+			w.Write([]byte(`{"response":"ok"}`))
+		})
+		gw, err := r.Update(ctx, fg.ID, model.UpdateGatewayRequest{
+			Endpoint:  &fg.Endpoint,
+			Transport: &fg.Transport,
+			Auth:      &model.GatewayAuthConfig{Type: "token", Params: map[string]string{"token": name + "-stored"}},
+		})
+		if err != nil {
+			t.Fatalf("Update %s: %v", name, err)
+		}
+		fg.Gateway = gw
+		return fg
+	}
+	edge := addTokenGateway("edge")
+	core := addTokenGateway("core")
+
+	override := GatewayOverride{
+		Transport: &model.TransportConfig{Type: "https", Params: map[string]string{"timeout": "5s"}},
+		Auth:      &model.GatewayAuthConfig{Type: "token", Params: map[string]string{"token": "candidate"}},
+	}
+	resp, err := a.FanOut(ctx, FanOutRequest{
+		Prompt:         "hello",
+		GatewayIDs:     []string{edge.ID, core.ID},
+		IncludeOffline: true,
+		Overrides:      map[string]GatewayOverride{edge.ID: override},
+	})
+	if err != nil {
+		t.Fatalf("FanOut: %v", err)
+	}
+	for _, res := range resp.Results {
+		if res.Error != "" {
+			t.Errorf("%s: %s", res.GatewayName, res.Error)
+		}
+	}
+
+	for _, tt := range []struct {
+		gw   *fakeGateway
+		want string
+	}{
+		{edge, "Bearer candidate"},
+		{core, "Bearer core-stored"},
+	} {
+		if got := received[tt.gw.Name]; got != tt.want {
+			t.Errorf("%s received Authorization %q, want %q", tt.gw.Name, got, tt.want)
+		}
+
+		stored, err := r.Get(ctx, tt.gw.ID)
+		if err != nil {
+			t.Fatalf("Get %s: %v", tt.gw.Name, err)
+		}
+		sa, wa := stored.Auth, tt.gw.Auth
+		if sa.Type != wa.Type || sa.SecretRef != wa.SecretRef || !maps.Equal(sa.Params, wa.Params) ||
+			stored.Transport.Type != tt.gw.Transport.Type || !maps.Equal(stored.Transport.Params, tt.gw.Transport.Params) {
+			t.Errorf("%s stored auth %+v transport %+v, want %+v %+v unchanged",
+				tt.gw.Name, stored.Auth, stored.Transport, tt.gw.Auth, tt.gw.Transport)
+		}
+	}
+
+	// The next fan-out without an override uses the stored token again.
+	if _, err := a.FanOut(ctx, FanOutRequest{Prompt: "hello", GatewayIDs: []string{edge.ID}, IncludeOffline: true}); err != nil {
+		t.Fatalf("FanOut: %v", err)
+	}
+	if got := received[edge.Name]; got != "Bearer edge-stored" {
+		t.Errorf("edge received Authorization %q after the override, want the stored token", got)
+	}
+}
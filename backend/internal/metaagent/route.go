@@ -0,0 +1,228 @@
+package metaagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// Routing strategies for sending a prompt to a single gateway.
+const (
+	RouteLowestLatency = "lowest_latency" // best latency in the latest health checks
+	RouteRoundRobin    = "round_robin"    // rotate through the candidates of each selector
+	RouteRandom        = "random"
+)
+
+// defaultRouteAttempts is the number of gateways tried when a request does
+// not set max_attempts.
+const defaultRouteAttempts = 3
+
+// maxRoundRobinKeys bounds the round-robin positions kept; past it they all
+// start over, so arbitrary selectors cannot grow the agent without limit.
+const maxRoundRobinKeys = 1024
+
+// ErrInvalidRoute is returned for an unknown routing strategy or an invalid
+// attempt budget.
+var ErrInvalidRoute = errors.New("invalid route request")
+
+// RouteRequest describes a prompt for whichever matching gateway a strategy
+// picks.
+type RouteRequest struct {
+	Prompt   string            `json:"prompt"`
+	Selector map[string]string `json:"selector,omitempty"` // gateway labels that must all match; empty matches every gateway
+	Strategy string            `json:"strategy,omitempty"` // "lowest_latency" (the default), "round_robin", or "random"
+
+	// MaxAttempts bounds how many candidates are tried, falling back to the
+	// next one after each failure. Zero means 3.
+	MaxAttempts int `json:"max_attempts,omitempty"`
+
+	// IncludeOffline also considers gateways last seen offline or past their
+	// TTL. Gateways in maintenance are never chosen.
+	IncludeOffline bool `json:"include_offline,omitempty"`
+}
+
+// RouteResponse reports the gateway a routed prompt went to.
+type RouteResponse struct {
+	Strategy string `json:"strategy"`
+	// Result is the chosen gateway's answer, or the last failure when every
+	// attempt failed.
+	Result GatewayResult `json:"result"`
+	// Reason explains why the strategy chose Result's gateway.
+	Reason     string `json:"reason"`
+	Candidates int    `json:"candidates"`
+	// Failed holds the attempts that failed before Result, in order.
+	Failed []GatewayResult `json:"failed,omitempty"`
+}
+
+// Succeeded reports whether any attempt got an answer.
+func (r *RouteResponse) Succeeded() bool {
+	return r.Result.Error == ""
+}
+
+// Route sends a prompt to one gateway matching the selector, chosen by the
+// request's strategy. When the chosen gateway fails, the next candidate in
+// the strategy's order is tried until the attempt budget is spent. A
+// response whose attempts all failed is returned without an error.
+func (a *Agent) Route(ctx context.Context, req RouteRequest) (*RouteResponse, error) {
+	strategy := req.Strategy
+	if strategy == "" {
+		strategy = RouteLowestLatency
+	}
+	attempts := req.MaxAttempts
+	switch {
+	case attempts < 0:
+		return nil, fmt.Errorf("%w: max_attempts must not be negative", ErrInvalidRoute)
+	case attempts == 0:
+		attempts = defaultRouteAttempts
+	}
+
+	candidates, err := a.routeCandidates(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var reasons []string
+	switch strategy {
+	case RouteLowestLatency:
+		reasons = a.orderByLatency(candidates)
+	case RouteRoundRobin:
+		reasons = a.orderRoundRobin(candidates, req.Selector)
+	case RouteRandom:
+		rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+		reasons = make([]string, len(candidates))
+		for i := range reasons {
+			reasons[i] = fmt.Sprintf("random choice among %d candidates", len(candidates))
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown strategy %q (want lowest_latency, round_robin, or random)", ErrInvalidRoute, req.Strategy)
+	}
+
+	resp := &RouteResponse{Strategy: strategy, Candidates: len(candidates)}
+	for i, gw := range candidates[:min(attempts, len(candidates))] {
+		if i > 0 {
+			resp.Failed = append(resp.Failed, resp.Result)
+		}
+		resp.Result = a.send(ctx, &gw, message{prompt: req.Prompt})
+		resp.Reason = reasons[i]
+		if resp.Succeeded() || ctx.Err() != nil {
+			break
+		}
+	}
+	if n := len(resp.Failed); n > 0 {
+		resp.Reason += fmt.Sprintf(", after %d failed %s", n, plural(n, "attempt", "attempts"))
+	}
+
+	detail := fmt.Sprintf("routed to %s by %s", resp.Result.GatewayName, strategy)
+	if !resp.Succeeded() {
+		detail = fmt.Sprintf("routing by %s failed after %d attempts", strategy, len(resp.Failed)+1)
+	}
+	a.auditor.Log(ctx, audit.Event{
+		Action:   "metaagent.route",
+		Resource: resp.Result.GatewayID,
+		Detail:   detail,
+	})
+	return resp, nil
+}
+
+// routeCandidates returns the gateways matching the selector that may
+// receive the prompt, ordered by name.
+func (a *Agent) routeCandidates(ctx context.Context, req RouteRequest) ([]model.Gateway, error) {
+	gateways, err := a.registry.List(ctx, model.GatewayFilter{Labels: req.Selector}, model.ListSort{Field: "name"})
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]model.Gateway, 0, len(gateways))
+	var skipped []GatewayResult
+	for _, gw := range gateways {
+		if reason := a.skipReason(&gw, req.IncludeOffline); reason != "" {
+			skipped = append(skipped, GatewayResult{GatewayID: gw.ID, SkipReason: reason})
+			continue
+		}
+		candidates = append(candidates, gw)
+	}
+	if len(candidates) == 0 {
+		if len(skipped) == 0 {
+			return nil, fmt.Errorf("%w: no gateways matched", ErrNoTargets)
+		}
+		return nil, fmt.Errorf("%w: all %d matched gateways were skipped (%s); set include_offline to reach offline or expired ones",
+			ErrNoTargets, len(skipped), summarizeSkips(skipped))
+	}
+	return candidates, nil
+}
+
+// orderByLatency sorts candidates by the latency of their latest health
+// check. Gateways without one follow, by name.
+func (a *Agent) orderByLatency(candidates []model.Gateway) []string {
+	latency := make(map[string]time.Duration, len(candidates))
+	for _, gw := range candidates {
+		if d, ok := a.registry.RecentLatency(gw.ID); ok {
+			latency[gw.ID] = d
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		di, iok := latency[candidates[i].ID]
+		dj, jok := latency[candidates[j].ID]
+		if iok != jok {
+			return iok
+		}
+		return di < dj
+	})
+
+	reasons := make([]string, len(candidates))
+	for i, gw := range candidates {
+		if d, ok := latency[gw.ID]; ok {
+			reasons[i] = fmt.Sprintf("latency rank %d of %d candidates (%dms in latest health check)", i+1, len(candidates), d.Milliseconds())
+		} else {
+			reasons[i] = fmt.Sprintf("latency rank %d of %d candidates (no recent health check)", i+1, len(candidates))
+		}
+	}
+	return reasons
+}
+
+// orderRoundRobin rotates the name-ordered candidates so that successive
+// routes with the same selector start at successive gateways.
+func (a *Agent) orderRoundRobin(candidates []model.Gateway, selector map[string]string) []string {
+	key := selectorKey(selector)
+
+	a.rrMu.Lock()
+	if _, ok := a.rrNext[key]; !ok && len(a.rrNext) >= maxRoundRobinKeys {
+		clear(a.rrNext)
+	}
+	start := a.rrNext[key] % len(candidates)
+	a.rrNext[key] = start + 1
+	a.rrMu.Unlock()
+
+	rotated := append(candidates[start:len(candidates):len(candidates)], candidates[:start]...)
+	copy(candidates, rotated)
+
+	reasons := make([]string, len(candidates))
+	for i := range candidates {
+		reasons[i] = fmt.Sprintf("round robin position %d of %d for selector %q", (start+i)%len(candidates)+1, len(candidates), key)
+	}
+	return reasons
+}
+
+// selectorKey renders a selector canonically, e.g. "env=prod,region=eu".
+func selectorKey(selector map[string]string) string {
+	pairs := make([]string, 0, len(selector))
+	for k, v := range selector {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
@@ -0,0 +1,180 @@
+package metaagent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/AdamPippert/Lobstertank/internal/gateway"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// addRouteGateway registers a gateway named name, labeled env=env, that
+// answers "ok" or, when failing, 500. Its latest health check found it
+// online with latencyMs.
+func addRouteGateway(t *testing.T, r *gateway.Registry, name, env string, latencyMs int64, failing bool) *fakeGateway {
+	t.Helper()
+	fg := addGatewayFunc(t, r, name, nil, func(w http.ResponseWriter, _ *http.Request) {
+		if failing {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"response":"ok"}`))
+	})
+	if _, err := r.Patch(context.Background(), fg.ID, model.PatchGatewayRequest{Labels: map[string]*string{"env": &env}}); err != nil {
+		t.Fatalf("Patch %s: %v", name, err)
+	}
+	if err := r.UpdateStatus(context.Background(), model.HealthCheckResult{
+		GatewayID: fg.ID, Status: model.StatusOnline, LatencyMillis: latencyMs,
+	}); err != nil {
+		t.Fatalf("UpdateStatus %s: %v", name, err)
+	}
+	return fg
+}
+
+// routeNames returns the names of the gateways a route tried, in order.
+func routeNames(resp *RouteResponse) []string {
+	var names []string
+	for _, res := range resp.Failed {
+		names = append(names, res.GatewayName)
+	}
+	return append(names, resp.Result.GatewayName)
+}
+
+func TestRoute(t *testing.T) {
+	a, r, _ := newTestAgent(t)
+	addRouteGateway(t, r, "alpha", "prod", 30, false)
+	addRouteGateway(t, r, "bravo", "prod", 10, true)
+	addRouteGateway(t, r, "charlie", "prod", 20, false)
+	addRouteGateway(t, r, "delta", "staging", 40, true)
+	addRouteGateway(t, r, "echo", "staging", 50, true)
+
+	tests := []struct {
+		name        string
+		req         RouteRequest
+		wantTried   []string
+		wantSuccess bool
+		wantReason  string
+	}{
+		{"lowest latency falls back", RouteRequest{Selector: map[string]string{"env": "prod"}},
+			[]string{"bravo", "charlie"}, true, "latency rank 2 of 3 candidates (20ms in latest health check), after 1 failed attempt"},
+		{"lowest latency within budget", RouteRequest{Selector: map[string]string{"env": "prod"}, MaxAttempts: 1},
+			[]string{"bravo"}, false, "latency rank 1 of 3 candidates (10ms in latest health check)"},
+		{"every candidate fails", RouteRequest{Selector: map[string]string{"env": "staging"}},
+			[]string{"delta", "echo"}, false, "after 1 failed attempt"},
+		{"budget spent before a success", RouteRequest{MaxAttempts: 2},
+			[]string{"bravo", "charlie"}, true, "after 1 failed attempt"},
+		{"budget larger than the candidates", RouteRequest{MaxAttempts: 10},
+			[]string{"bravo", "charlie"}, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.Prompt = "hello"
+			resp, err := a.Route(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("Route: %v", err)
+			}
+			if got := routeNames(resp); !slices.Equal(got, tt.wantTried) {
+				t.Errorf("tried %v, want %v", got, tt.wantTried)
+			}
+			if resp.Succeeded() != tt.wantSuccess {
+				t.Errorf("succeeded = %t, want %t: %+v", resp.Succeeded(), tt.wantSuccess, resp.Result)
+			}
+			if resp.Strategy != RouteLowestLatency {
+				t.Errorf("strategy = %q, want the default %q", resp.Strategy, RouteLowestLatency)
+			}
+			if !strings.HasSuffix(resp.Reason, tt.wantReason) {
+				t.Errorf("reason = %q, want it to end %q", resp.Reason, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestRouteRoundRobin(t *testing.T) {
+	a, r, _ := newTestAgent(t)
+	addRouteGateway(t, r, "alpha", "prod", 0, false)
+	addRouteGateway(t, r, "bravo", "prod", 0, true)
+	addRouteGateway(t, r, "charlie", "prod", 0, false)
+	addRouteGateway(t, r, "delta", "staging", 0, false)
+	addRouteGateway(t, r, "echo", "staging", 0, false)
+	prod := map[string]string{"env": "prod"}
+	staging := map[string]string{"env": "staging"}
+
+	// Each selector rotates on its own; the failing bravo hands its turn
+	// to the next gateway in the rotation.
+	for i, tt := range []struct {
+		selector  map[string]string
+		wantTried []string
+	}{
+		{prod, []string{"alpha"}},
+		{prod, []string{"bravo", "charlie"}},
+		{staging, []string{"delta"}},
+		{prod, []string{"charlie"}},
+		{staging, []string{"echo"}},
+		{prod, []string{"alpha"}},
+		{staging, []string{"delta"}},
+	} {
+		resp, err := a.Route(context.Background(), RouteRequest{Prompt: "hello", Selector: tt.selector, Strategy: RouteRoundRobin})
+		if err != nil {
+			t.Fatalf("route %d: %v", i, err)
+		}
+		if got := routeNames(resp); !slices.Equal(got, tt.wantTried) || !resp.Succeeded() {
+			t.Errorf("route %d to %v tried %v (succeeded %t), want %v", i, tt.selector, got, resp.Succeeded(), tt.wantTried)
+		}
+	}
+}
+
+func TestRouteRandom(t *testing.T) {
+	a, r, _ := newTestAgent(t)
+	good := addRouteGateway(t, r, "alpha", "prod", 0, false)
+	for _, name := range []string{"bravo", "charlie", "delta"} {
+		addRouteGateway(t, r, name, "prod", 0, true)
+	}
+
+	chosen := map[string]bool{}
+	for range 50 {
+		resp, err := a.Route(context.Background(), RouteRequest{Prompt: "hello", Strategy: RouteRandom, MaxAttempts: 4})
+		if err != nil {
+			t.Fatalf("Route: %v", err)
+		}
+		tried := routeNames(resp)
+		chosen[tried[0]] = true
+		// With a budget covering every candidate, the one that answers is
+		// always reached, after each failing one at most once.
+		if !resp.Succeeded() || resp.Result.GatewayID != good.ID {
+			t.Fatalf("route ended at %s (succeeded %t), want alpha", resp.Result.GatewayName, resp.Succeeded())
+		}
+		if slices.Contains(tried[:len(tried)-1], "alpha") || len(slices.Compact(slices.Sorted(slices.Values(tried)))) != len(tried) {
+			t.Fatalf("tried %v, want distinct failing gateways then alpha", tried)
+		}
+		if resp.Candidates != 4 || !strings.HasPrefix(resp.Reason, "random choice among 4 candidates") {
+			t.Errorf("candidates %d, reason %q", resp.Candidates, resp.Reason)
+		}
+	}
+	if len(chosen) < 2 {
+		t.Errorf("50 random routes always started at %v", chosen)
+	}
+}
+
+func TestRouteInvalid(t *testing.T) {
+	a, r, _ := newTestAgent(t)
+	addRouteGateway(t, r, "alpha", "prod", 0, false)
+
+	for _, tt := range []struct {
+		name string
+		req  RouteRequest
+		want error
+	}{
+		{"unknown strategy", RouteRequest{Strategy: "fastest"}, ErrInvalidRoute},
+		{"negative budget", RouteRequest{MaxAttempts: -1}, ErrInvalidRoute},
+		{"no match", RouteRequest{Selector: map[string]string{"env": "dev"}}, ErrNoTargets},
+	} {
+		tt.req.Prompt = "hello"
+		if _, err := a.Route(context.Background(), tt.req); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
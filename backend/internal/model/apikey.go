@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+// APIKey is a long-lived credential for automation, holding its own roles.
+// Only a hash of its secret is stored; the key itself is shown once, when
+// it is created.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Roles      []string   `json:"roles"`
+	Org        string     `json:"org,omitempty"` // organization its holders are scoped to; empty is unscoped
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // nil never expires
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	Revoked    bool       `json:"revoked"`
+
+	Hash string `json:"-"` // SHA-256 of the key's secret, hex-encoded
+}
+
+// CreateAPIKeyRequest is the payload for creating an API key.
+type CreateAPIKeyRequest struct {
+	Name  string   `json:"name"`
+	Roles []string `json:"roles,omitempty"`
+	Org   string   `json:"org,omitempty"` // defaults to the caller's organization
+	TTL   string   `json:"ttl,omitempty"` // Go duration; unset never expires
+}
+
+// CreatedAPIKey is an API key as created, with the key itself.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"` // shown only in this response
+}
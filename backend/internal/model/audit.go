@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// AuditEvent is an audit event persisted for querying.
+type AuditEvent struct {
+	ID        int64     `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Action    string    `json:"action"`
+	Resource  string    `json:"resource,omitempty"`
+	Subject   string    `json:"subject,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// AuditQuery selects persisted audit events. Zero fields do not filter.
+type AuditQuery struct {
+	Action   string
+	Resource string
+	Since    time.Time // inclusive
+	Until    time.Time // exclusive
+	BeforeID int64     // only events older than this one, for paging
+	Limit    int
+}
+
+// AuditPage is one page of audit events, newest first.
+type AuditPage struct {
+	Events []AuditEvent `json:"events"`
+	// NextCursor fetches the following page; empty on the last one.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
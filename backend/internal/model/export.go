@@ -0,0 +1,33 @@
+package model
+
+// GatewayBundleVersion is the current version of the export document format.
+const GatewayBundleVersion = 1
+
+// GatewayBundle is the portable document produced by a gateway export and
+// accepted by an import. It carries secret references, never secret values.
+type GatewayBundle struct {
+	Version  int           `json:"version" yaml:"version"`
+	Gateways []GatewaySpec `json:"gateways" yaml:"gateways"`
+}
+
+// GatewaySpec is the user-supplied configuration of one gateway. Imports
+// match specs to registered gateways by name.
+type GatewaySpec struct {
+	Name        string            `json:"name" yaml:"name"`
+	Description string            `json:"description,omitempty" yaml:"description,omitempty"`
+	Endpoint    string            `json:"endpoint" yaml:"endpoint"`
+	Transport   TransportConfig   `json:"transport" yaml:"transport"`
+	Auth        GatewayAuthConfig `json:"auth" yaml:"auth"`
+	Labels      map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	TTLSeconds  *int              `json:"ttl_seconds,omitempty" yaml:"ttl_seconds,omitempty"`
+}
+
+// ImportResult reports what an import did, or would do on a dry run, by
+// gateway name.
+type ImportResult struct {
+	DryRun    bool     `json:"dry_run"`
+	Created   []string `json:"created"`
+	Updated   []string `json:"updated"`
+	Unchanged []string `json:"unchanged"`
+	Conflicts []string `json:"conflicts"` // names given more than once in the document
+}
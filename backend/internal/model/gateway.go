@@ -1,6 +1,7 @@
 package model
 
 import (
+	"fmt"
 	"time"
 )
 
@@ -12,6 +13,10 @@ const (
 	StatusOffline  Status = "offline"
 	StatusDegraded Status = "degraded"
 	StatusUnknown  Status = "unknown"
+
+	// StatusMaintenance marks a gateway deliberately taken out of service.
+	// It is set and cleared explicitly, never by health checks.
+	StatusMaintenance Status = "maintenance"
 )
 
 // Gateway represents a registered OpenClaw gateway instance.
@@ -27,19 +32,30 @@ type Gateway struct {
 	EnrolledAt  time.Time         `json:"enrolled_at"`
 	LastSeenAt  *time.Time        `json:"last_seen_at,omitempty"`
 	TTLSeconds  *int              `json:"ttl_seconds,omitempty"`
+
+	MaintenanceReason string     `json:"maintenance_reason,omitempty"`
+	MaintenanceUntil  *time.Time `json:"maintenance_until,omitempty"` // nil means until cleared
+
+	// OrgID scopes the gateway to an organization; only principals of that
+	// organization, or unscoped ones, can see it. Empty for unscoped gateways.
+	OrgID string `json:"org_id,omitempty"`
+
+	// DeletedAt is set once the gateway is deleted. Deleted gateways are
+	// hidden until restored, or removed for good when purged.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 // TransportConfig defines how Lobstertank connects to a gateway.
 type TransportConfig struct {
-	Type   string            `json:"type"` // "https", "tailscale", "headscale", "cloudflare"
-	Params map[string]string `json:"params,omitempty"`
+	Type   string            `json:"type" yaml:"type"` // "https", "tailscale", "headscale", "cloudflare"
+	Params map[string]string `json:"params,omitempty" yaml:"params,omitempty"`
 }
 
 // GatewayAuthConfig defines how Lobstertank authenticates with a gateway.
 type GatewayAuthConfig struct {
-	Type      string            `json:"type"` // "token", "mtls", "oidc"
-	Params    map[string]string `json:"params,omitempty"`
-	SecretRef string            `json:"secret_ref,omitempty"` // URI referencing a secret provider entry
+	Type      string            `json:"type" yaml:"type"` // "token", "mtls", "oidc"
+	Params    map[string]string `json:"params,omitempty" yaml:"params,omitempty"`
+	SecretRef string            `json:"secret_ref,omitempty" yaml:"secret_ref,omitempty"` // URI referencing a secret provider entry
 }
 
 // CreateGatewayRequest is the payload for registering a new gateway.
@@ -51,6 +67,16 @@ type CreateGatewayRequest struct {
 	Auth        GatewayAuthConfig `json:"auth"`
 	Labels      map[string]string `json:"labels,omitempty"`
 	TTLSeconds  *int              `json:"ttl_seconds,omitempty"`
+
+	// OrgID places the gateway in an organization. It defaults to the
+	// caller's; only unscoped callers may name another.
+	OrgID string `json:"org_id,omitempty"`
+
+	// Probe health-checks the endpoint before the gateway is persisted and
+	// records the observed status instead of "unknown".
+	Probe bool `json:"probe,omitempty"`
+	// RequireReachable rejects the registration when the probe fails.
+	RequireReachable bool `json:"require_reachable,omitempty"`
 }
 
 // UpdateGatewayRequest is the payload for updating an existing gateway.
@@ -64,11 +90,184 @@ type UpdateGatewayRequest struct {
 	TTLSeconds  *int               `json:"ttl_seconds,omitempty"`
 }
 
+// PatchGatewayRequest is a JSON Merge Patch (RFC 7396) for a gateway. Absent
+// fields are left unchanged. Labels merge key by key, with a null value
+// removing the label; transport and auth are replaced as whole objects.
+type PatchGatewayRequest struct {
+	Name        *string            `json:"name,omitempty"`
+	Description *string            `json:"description,omitempty"`
+	Endpoint    *string            `json:"endpoint,omitempty"`
+	Transport   *TransportConfig   `json:"transport,omitempty"`
+	Auth        *GatewayAuthConfig `json:"auth,omitempty"`
+	Labels      map[string]*string `json:"labels,omitempty"`
+	TTLSeconds  *int               `json:"ttl_seconds,omitempty"`
+}
+
+// BulkUpdateGatewaysRequest applies one update to every gateway whose labels
+// match the selector. The selector must not be empty, and the update cannot
+// rename gateways.
+type BulkUpdateGatewaysRequest struct {
+	Selector map[string]string    `json:"selector"`
+	Update   UpdateGatewayRequest `json:"update"`
+}
+
+// BulkUpdateResult lists the gateways a bulk update changed.
+type BulkUpdateResult struct {
+	Count int      `json:"count"`
+	IDs   []string `json:"ids"`
+}
+
 // HealthCheckResult is returned when probing a gateway.
 type HealthCheckResult struct {
-	GatewayID string `json:"gateway_id"`
-	Status    Status `json:"status"`
-	Latency   string `json:"latency,omitempty"`
-	Error     string `json:"error,omitempty"`
-	CheckedAt string `json:"checked_at"`
+	GatewayID     string    `json:"gateway_id"`
+	Status        Status    `json:"status"`
+	Latency       string    `json:"latency,omitempty"`
+	LatencyMillis int64     `json:"latency_ms"`
+	Error         string    `json:"error,omitempty"`
+	ErrorKind     ErrorKind `json:"error_kind,omitempty"`
+	Attempts      int       `json:"attempts,omitempty"` // round trips made, including retries
+	CheckedAt     string    `json:"checked_at"`
+}
+
+// ErrorKind classifies why a health check failed, so failure causes can be
+// told apart without parsing error strings.
+type ErrorKind string
+
+const (
+	ErrorKindDNS               ErrorKind = "dns"
+	ErrorKindConnectionRefused ErrorKind = "connection_refused"
+	ErrorKindTLS               ErrorKind = "tls"
+	ErrorKindTimeout           ErrorKind = "timeout"
+	ErrorKindAuth              ErrorKind = "auth"
+	ErrorKindHTTP5xx           ErrorKind = "http_5xx"
+	ErrorKindHTTP4xx           ErrorKind = "http_4xx"
+	ErrorKindCircuitOpen       ErrorKind = "circuit_open"
+	ErrorKindUnknown           ErrorKind = "unknown"
+)
+
+// GatewayFilter narrows a gateway listing. Zero values match everything.
+type GatewayFilter struct {
+	Status Status
+	Labels map[string]string
+}
+
+// Matches reports whether the gateway satisfies every filter criterion.
+func (f GatewayFilter) Matches(gw *Gateway) bool {
+	if f.Status != "" && gw.Status != f.Status {
+		return false
+	}
+	for k, v := range f.Labels {
+		if gw.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// SortFields lists the gateway fields a listing may be ordered by.
+var SortFields = []string{"name", "enrolled_at", "last_seen_at", "status"}
+
+// ListSort orders a gateway listing. The zero value means enrolled_at
+// descending.
+type ListSort struct {
+	Field      string
+	Descending bool
+}
+
+// ParseListSort validates the sort and order query values. Empty values
+// select the default ordering.
+func ParseListSort(field, order string) (ListSort, error) {
+	s := ListSort{Field: "enrolled_at", Descending: true}
+
+	if field != "" {
+		valid := false
+		for _, f := range SortFields {
+			if f == field {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return s, fmt.Errorf("unknown sort field %q", field)
+		}
+		s.Field = field
+	}
+
+	switch order {
+	case "":
+	case "asc":
+		s.Descending = false
+	case "desc":
+		s.Descending = true
+	default:
+		return s, fmt.Errorf("order must be asc or desc, got %q", order)
+	}
+	return s, nil
+}
+
+// PromptRequest is the payload for sending a prompt to a single gateway.
+type PromptRequest struct {
+	Prompt   string            `json:"prompt"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Timeout  string            `json:"timeout,omitempty"` // Go duration, capped by server config
+}
+
+// VerifyCheck is the outcome of one post-install verification step.
+type VerifyCheck struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Detail  string `json:"detail,omitempty"`
+	Latency string `json:"latency,omitempty"`
+}
+
+// VerifyResult is returned when running a full verification of a gateway.
+type VerifyResult struct {
+	GatewayID string        `json:"gateway_id"`
+	Passed    bool          `json:"passed"`
+	Checks    []VerifyCheck `json:"checks"`
+	CheckedAt string        `json:"checked_at"`
+}
+
+// StatusTransition records a change in a gateway's observed status.
+type StatusTransition struct {
+	GatewayID  string    `json:"gateway_id"`
+	From       Status    `json:"from"`
+	To         Status    `json:"to"`
+	Latency    string    `json:"latency,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	ErrorKind  ErrorKind `json:"error_kind,omitempty"`
+	ObservedAt time.Time `json:"observed_at"`
+}
+
+// StatusHistory is a gateway's status timeline over a window.
+type StatusHistory struct {
+	GatewayID     string             `json:"gateway_id"`
+	Since         time.Time          `json:"since"`
+	Until         time.Time          `json:"until"`
+	Transitions   []StatusTransition `json:"transitions"`
+	UptimePercent float64            `json:"uptime_percent"`
+
+	// Checks holds the latest health checks, newest first, regardless of
+	// the window.
+	Checks []HealthCheckResult `json:"checks"`
+}
+
+// CircuitState reports a gateway's client-side circuit breaker. OpenedAt and
+// RetryAt are set while the breaker is open or half-open.
+type CircuitState struct {
+	GatewayID           string     `json:"gateway_id"`
+	State               string     `json:"state"` // closed, open, half_open, or disabled
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Threshold           int        `json:"threshold,omitempty"`
+	Cooldown            string     `json:"cooldown,omitempty"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"`
+}
+
+// MaintenanceRequest enables or clears maintenance mode for a gateway.
+// Reason and Until only apply when enabling.
+type MaintenanceRequest struct {
+	Enabled bool       `json:"enabled"`
+	Reason  string     `json:"reason,omitempty"`
+	Until   *time.Time `json:"until,omitempty"`
 }
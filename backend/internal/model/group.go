@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// Group is a named, explicitly managed set of gateways.
+type Group struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	GatewayIDs  []string  `json:"gateway_ids"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// OrgID scopes the group to an organization, like a gateway's. Its
+	// members belong to the same organization. Empty for unscoped groups.
+	OrgID string `json:"org_id,omitempty"`
+}
+
+// CreateGroupRequest is the payload for creating a gateway group.
+type CreateGroupRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	GatewayIDs  []string `json:"gateway_ids,omitempty"`
+
+	// OrgID places the group in an organization. It defaults to the
+	// caller's; only unscoped callers may name another.
+	OrgID string `json:"org_id,omitempty"`
+}
+
+// UpdateGroupRequest is the payload for updating a gateway group. A non-nil
+// GatewayIDs replaces the membership.
+type UpdateGroupRequest struct {
+	Name        *string  `json:"name,omitempty"`
+	Description *string  `json:"description,omitempty"`
+	GatewayIDs  []string `json:"gateway_ids,omitempty"`
+}
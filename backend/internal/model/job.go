@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// JobStatus is the progress of an asynchronous fan-out.
+type JobStatus string
+
+const (
+	JobPending  JobStatus = "pending"  // accepted, no gateway contacted yet
+	JobRunning  JobStatus = "running"  // gateways contacted, no results yet
+	JobPartial  JobStatus = "partial"  // some results recorded
+	JobComplete JobStatus = "complete" // every gateway has a result
+)
+
+// FanOutJob is an asynchronous fan-out and the results recorded so far.
+type FanOutJob struct {
+	ID        string            `json:"id"`
+	Status    JobStatus         `json:"status"`
+	Total     int               `json:"total"`                // gateways the job will report on, skipped ones included
+	CreatedBy string            `json:"created_by,omitempty"` // subject of the principal that started the job
+	OrgID     string            `json:"org_id,omitempty"`     // organization of that principal; empty is unscoped
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	Results   []FanOutJobResult `json:"results"`
+}
+
+// FanOutJobResult is one gateway's result within a fan-out job. Position
+// orders results the same way a synchronous fan-out does.
+type FanOutJobResult struct {
+	Position      int       `json:"-"`
+	GatewayID     string    `json:"gateway_id"`
+	GatewayName   string    `json:"gateway_name"`
+	Response      string    `json:"response,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	Skipped       bool      `json:"skipped,omitempty"`
+	SkipReason    string    `json:"skip_reason,omitempty"`
+	LatencyMillis int64     `json:"latency_ms,omitempty"`
+	CompletedAt   time.Time `json:"completed_at"`
+}
@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// Usage is the token usage a gateway reported for one prompt. Gateways that
+// report none yield zeros.
+type Usage struct {
+	Model            string `json:"model,omitempty"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+}
+
+// UsageTotals sums the usage of successful prompts. Gateway and model are
+// set when the totals are broken down by them.
+type UsageTotals struct {
+	GatewayID        string `json:"gateway_id,omitempty"`
+	GatewayName      string `json:"gateway_name,omitempty"`
+	Model            string `json:"model,omitempty"`
+	Requests         int64  `json:"requests"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+}
+
+// Add accumulates u into t.
+func (t *UsageTotals) Add(u UsageTotals) {
+	t.Requests += u.Requests
+	t.PromptTokens += u.PromptTokens
+	t.CompletionTokens += u.CompletionTokens
+}
+
+// UsageReport is token usage over a window. Usage is counted per hour, so
+// Since is rounded down to the hour.
+type UsageReport struct {
+	GatewayID string        `json:"gateway_id,omitempty"` // set when the report covers one gateway
+	Since     time.Time     `json:"since"`
+	Until     time.Time     `json:"until"`
+	Totals    UsageTotals   `json:"totals"`
+	Usage     []UsageTotals `json:"usage"` // by gateway and model
+}
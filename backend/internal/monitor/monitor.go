@@ -0,0 +1,183 @@
+// Package monitor periodically probes registered gateways and records
+// status transitions.
+package monitor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/gateway"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// Monitor runs health probes against all gateways on a fixed interval.
+type Monitor struct {
+	registry *gateway.Registry
+	prober   *gateway.Prober
+	auditor  *audit.Logger
+	clock    clock.Clock
+
+	mu       sync.Mutex
+	interval time.Duration
+	spread   time.Duration // window over which each cycle's probes start
+	changed  chan struct{} // signaled when the schedule changes
+}
+
+// New creates a Monitor that probes every cfg.Interval. Each cycle's probes
+// are spread over cfg.Jitter of the interval, cut short where needed so that
+// the last probe can time out before the next cycle is due.
+func New(r *gateway.Registry, p *gateway.Prober, a *audit.Logger, clk clock.Clock, cfg config.MonitorConfig) *Monitor {
+	m := &Monitor{registry: r, prober: p, auditor: a, clock: clk, changed: make(chan struct{}, 1)}
+	m.interval, m.spread = m.scheduleFor(cfg)
+	return m
+}
+
+// scheduleFor returns the interval and spread that cfg calls for.
+func (m *Monitor) scheduleFor(cfg config.MonitorConfig) (interval, spread time.Duration) {
+	spread = time.Duration(cfg.Jitter * float64(cfg.Interval))
+	return cfg.Interval, max(min(spread, cfg.Interval-m.prober.Timeout()), 0)
+}
+
+// SetSchedule changes the interval and jitter from cfg, as New applies them.
+// A running monitor finishes its current cycle first, then counts the new
+// interval from there. cfg.Enabled is ignored.
+func (m *Monitor) SetSchedule(cfg config.MonitorConfig) {
+	interval, spread := m.scheduleFor(cfg)
+
+	m.mu.Lock()
+	m.interval, m.spread = interval, spread
+	m.mu.Unlock()
+
+	select {
+	case m.changed <- struct{}{}:
+	default:
+	}
+}
+
+// schedule returns the current interval and spread.
+func (m *Monitor) schedule() (interval, spread time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.interval, m.spread
+}
+
+// Run probes gateways until the context is canceled. Cycles never overlap:
+// if a cycle overruns the interval, missed ticks are dropped rather than
+// queued.
+func (m *Monitor) Run(ctx context.Context) {
+	interval, spread := m.schedule()
+	slog.Info("gateway monitor started", "interval", interval.String(), "spread", spread.String())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		m.cycle(ctx)
+
+		if !m.wait(ctx, ticker) {
+			slog.Info("gateway monitor stopped")
+			return
+		}
+	}
+}
+
+// wait blocks until the next tick, restarting the ticker whenever the
+// schedule changes. It returns false once the context is canceled.
+func (m *Monitor) wait(ctx context.Context, ticker *time.Ticker) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-m.changed:
+			interval, spread := m.schedule()
+			ticker.Reset(interval)
+			slog.Info("gateway monitor rescheduled", "interval", interval.String(), "spread", spread.String())
+		case <-ticker.C:
+			return true
+		}
+	}
+}
+
+// cycle probes every gateway once and audits any status transitions.
+func (m *Monitor) cycle(ctx context.Context) {
+	gateways, err := m.registry.List(ctx, model.GatewayFilter{}, model.ListSort{})
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Warn("monitor failed to list gateways", "error", err)
+		}
+		return
+	}
+
+	gateways = m.skipMaintenance(ctx, gateways)
+
+	delays := make([]time.Duration, len(gateways))
+	for i := range gateways {
+		delays[i] = m.offset(gateways[i].ID)
+	}
+
+	results := m.prober.ProbeStaggered(ctx, gateways, delays, m.clock)
+	if ctx.Err() != nil {
+		return
+	}
+	for i, result := range results {
+		prev := gateways[i].Status
+		if result.Status == prev {
+			continue
+		}
+		detail := fmt.Sprintf("status %s -> %s", prev, result.Status)
+		if result.ErrorKind != "" {
+			detail += fmt.Sprintf(" (%s)", result.ErrorKind)
+		}
+		m.auditor.Log(ctx, audit.Event{
+			Action:   "gateway.status_changed",
+			Resource: result.GatewayID,
+			Detail:   detail,
+		})
+	}
+}
+
+// offset places a gateway's probe within the cycle's spread window. It is
+// derived from the gateway ID, so each gateway keeps the same offset from
+// cycle to cycle, and so from restart to restart, and is still probed once
+// per interval; the first cycle after startup is staggered the same way.
+func (m *Monitor) offset(id string) time.Duration {
+	_, spread := m.schedule()
+	if spread <= 0 {
+		return 0
+	}
+	// FNV's high bits barely change between IDs that differ only at the
+	// end, which would bunch such gateways together; SHA-256 spreads them.
+	sum := sha256.Sum256([]byte(id))
+	frac := float64(binary.BigEndian.Uint64(sum[:8])>>11) / (1 << 53) // uniform in [0, 1)
+	return time.Duration(frac * float64(spread))
+}
+
+// skipMaintenance drops gateways in active maintenance from the cycle. Those
+// whose maintenance window has passed are taken out of maintenance first so
+// they are probed again.
+func (m *Monitor) skipMaintenance(ctx context.Context, gateways []model.Gateway) []model.Gateway {
+	active := gateways[:0]
+	for _, gw := range gateways {
+		if gw.Status == model.StatusMaintenance {
+			if m.registry.MaintenanceActive(&gw) {
+				continue
+			}
+			updated, err := m.registry.SetMaintenance(ctx, gw.ID, model.MaintenanceRequest{})
+			if err != nil {
+				slog.Warn("monitor failed to end expired maintenance", "id", gw.ID, "error", err)
+				continue
+			}
+			gw = *updated
+		}
+		active = append(active, gw)
+	}
+	return active
+}
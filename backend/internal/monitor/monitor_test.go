@@ -0,0 +1,247 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/gateway"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/secrets"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+	"github.com/AdamPippert/Lobstertank/internal/transport"
+)
+
+var testEpoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// probeTimeout is the per-gateway timeout of test monitors' probers.
+const probeTimeout = 5 * time.Second
+
+// newTestMonitor returns a monitor over a registry on an in-memory SQLite
+// store, probing over plain HTTPS clients on a fake clock.
+func newTestMonitor(t *testing.T, cfg config.MonitorConfig) (*Monitor, *gateway.Registry, *clock.FakeClock) {
+	t.Helper()
+	s, err := store.NewSQLiteStore(":memory:", false, true)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	sp, err := secrets.NewBuiltinProvider("")
+	if err != nil {
+		t.Fatalf("NewBuiltinProvider: %v", err)
+	}
+	clk := clock.NewFake(testEpoch)
+	auditor := audit.New(config.AuditConfig{})
+	r := gateway.NewRegistry(s, auditor, clk, 0, sp, "builtin://gateways/")
+	cf := gateway.NewClientFactory(transport.NewProvider(config.TransportConfig{Default: "https"}), sp,
+		config.RetryConfig{}, config.BreakerConfig{}, clk)
+	p := gateway.NewProber(r, cf, 100, probeTimeout)
+	return New(r, p, auditor, clk, cfg), r, clk
+}
+
+// probeLog records when, on the fake clock, each gateway was probed.
+type probeLog struct {
+	clk *clock.FakeClock
+	mu  sync.Mutex
+	at  map[string]time.Time // gateway name -> probe time
+}
+
+// addGateway registers a healthy gateway named name whose probes are
+// recorded in l.
+func (l *probeLog) addGateway(t *testing.T, r *gateway.Registry, name string) *model.Gateway {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.at[name] = l.clk.Now()
+	}))
+	t.Cleanup(srv.Close)
+	gw, err := r.Create(context.Background(), model.CreateGatewayRequest{
+		Name:      name,
+		Endpoint:  srv.URL,
+		Transport: model.TransportConfig{Type: "https"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Create %s: %v", name, err)
+	}
+	return gw
+}
+
+func (l *probeLog) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.at)
+}
+
+// waitFor polls until cond holds, failing the test after a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestScheduleFor(t *testing.T) {
+	tests := []struct {
+		name       string
+		interval   time.Duration
+		jitter     float64
+		wantSpread time.Duration
+	}{
+		{"no jitter", time.Minute, 0, 0},
+		{"half", time.Minute, 0.5, 30 * time.Second},
+		{"leaves room for the last probe", time.Minute, 0.99, time.Minute - probeTimeout},
+		{"interval shorter than a probe", 2 * time.Second, 0.5, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, _ := newTestMonitor(t, config.MonitorConfig{Interval: tt.interval, Jitter: tt.jitter})
+			interval, spread := m.schedule()
+			if interval != tt.interval || spread != tt.wantSpread {
+				t.Errorf("schedule = %v, %v; want %v, %v", interval, spread, tt.interval, tt.wantSpread)
+			}
+		})
+	}
+}
+
+func TestOffsetsSpreadAcrossWindow(t *testing.T) {
+	m, _, _ := newTestMonitor(t, config.MonitorConfig{Interval: time.Minute, Jitter: 0.5})
+	_, spread := m.schedule()
+
+	const gateways, buckets = 200, 10
+	var filled [buckets]int
+	for i := range gateways {
+		id := fmt.Sprintf("gw-%d", i)
+		off := m.offset(id)
+		if off < 0 || off >= spread {
+			t.Fatalf("offset(%s) = %v, outside [0, %v)", id, off, spread)
+		}
+		if again := m.offset(id); again != off {
+			t.Fatalf("offset(%s) changed from %v to %v", id, off, again)
+		}
+		filled[off*buckets/spread]++
+	}
+	// 200 uniform draws leave a tenth of the window with fewer than 5
+	// gateways with negligible probability.
+	for b, n := range filled {
+		if n < 5 {
+			t.Errorf("bucket %d of the window holds %d gateways; offsets are not spread: %v", b, n, filled)
+		}
+	}
+
+	m.SetSchedule(config.MonitorConfig{Interval: time.Minute})
+	if off := m.offset("gw-1"); off != 0 {
+		t.Errorf("offset without jitter = %v, want 0", off)
+	}
+}
+
+func TestCycleStaggersProbes(t *testing.T) {
+	m, r, clk := newTestMonitor(t, config.MonitorConfig{Interval: time.Minute, Jitter: 0.5})
+	log := &probeLog{clk: clk, at: make(map[string]time.Time)}
+	offsets := make(map[string]time.Duration)
+	for i := range 20 {
+		gw := log.addGateway(t, r, fmt.Sprintf("gw-%02d", i))
+		offsets[gw.Name] = m.offset(gw.ID)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.cycle(context.Background())
+	}()
+
+	// Step through the window, letting every probe due so far finish
+	// before moving on.
+	_, spread := m.schedule()
+	const step = time.Second
+	for elapsed := time.Duration(0); elapsed <= spread; elapsed += step {
+		due := 0
+		for _, off := range offsets {
+			if off <= elapsed {
+				due++
+			}
+		}
+		waitFor(t, fmt.Sprintf("%d probes at +%v", due, elapsed), func() bool { return log.count() == due })
+		if due < len(offsets) {
+			waitFor(t, "probes to wait for their offsets", func() bool { return clk.Waiters() == len(offsets)-due })
+		}
+		clk.Advance(step)
+	}
+	<-done
+
+	first, last := testEpoch.Add(spread), testEpoch
+	for name, at := range log.at {
+		off := offsets[name]
+		if at.Before(testEpoch.Add(off)) || !at.Before(testEpoch.Add(off+step)) {
+			t.Errorf("%s probed at +%v, want within a step of its offset %v", name, at.Sub(testEpoch), off)
+		}
+		first, last = minTime(first, at), maxTime(last, at)
+	}
+	if last.Sub(first) < spread/2 {
+		t.Errorf("probes ran between +%v and +%v; want them spread over the %v window",
+			first.Sub(testEpoch), last.Sub(testEpoch), spread)
+	}
+}
+
+func TestCycleSkipsMaintenance(t *testing.T) {
+	m, r, clk := newTestMonitor(t, config.MonitorConfig{Interval: time.Minute})
+	log := &probeLog{clk: clk, at: make(map[string]time.Time)}
+	ctx := context.Background()
+	held := log.addGateway(t, r, "held")
+	ending := log.addGateway(t, r, "ending")
+	log.addGateway(t, r, "normal")
+
+	until := testEpoch.Add(time.Hour)
+	for _, gw := range []*model.Gateway{held, ending} {
+		if _, err := r.SetMaintenance(ctx, gw.ID, model.MaintenanceRequest{Enabled: true, Until: &until}); err != nil {
+			t.Fatalf("SetMaintenance %s: %v", gw.Name, err)
+		}
+	}
+	if _, err := r.SetMaintenance(ctx, held.ID, model.MaintenanceRequest{Enabled: true}); err != nil {
+		t.Fatalf("SetMaintenance held: %v", err)
+	}
+	clk.Advance(2 * time.Hour) // past ending's window
+
+	m.cycle(ctx)
+
+	if _, ok := log.at["held"]; ok {
+		t.Error("a gateway in maintenance was probed")
+	}
+	for _, name := range []string{"ending", "normal"} {
+		if _, ok := log.at[name]; !ok {
+			t.Errorf("%s was not probed", name)
+		}
+	}
+	gw, err := r.Get(ctx, ending.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if gw.Status != model.StatusOnline {
+		t.Errorf("gateway whose maintenance ended is %s, want online", gw.Status)
+	}
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,128 @@
+// Package ratelimit provides per-principal token-bucket rate limiting.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+)
+
+// sweepInterval is how often idle buckets are looked for and dropped.
+const sweepInterval = time.Minute
+
+// Limiter is a set of token buckets keyed by an arbitrary string, typically
+// the authenticated principal's subject. It is safe for concurrent use.
+type Limiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens added per second
+	burst   float64 // bucket capacity
+	buckets map[string]*bucket
+	clock   clock.Clock
+
+	lastSweep time.Time
+	limited   uint64 // requests refused
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New creates a Limiter that refills rps tokens per second up to burst. A
+// rate of 0 or less allows everything.
+func New(rps float64, burst int, clk clock.Clock) *Limiter {
+	l := &Limiter{
+		buckets: make(map[string]*bucket),
+		clock:   clk,
+	}
+	l.SetRate(rps, burst)
+	return l
+}
+
+// SetRate changes the refill rate and capacity of every bucket. Buckets keep
+// the tokens they hold, up to the new capacity.
+func (l *Limiter) SetRate(rps float64, burst int) {
+	if burst < 1 {
+		burst = 1
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = rps
+	l.burst = float64(burst)
+	if rps <= 0 {
+		clear(l.buckets)
+	}
+	for _, b := range l.buckets {
+		b.tokens = math.Min(l.burst, b.tokens)
+	}
+}
+
+// Allow consumes a token for key. When no token is available it returns
+// false along with how long the caller should wait before retrying.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 {
+		return true, 0
+	}
+
+	now := l.clock.Now()
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed*l.rate)
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	l.limited++
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops buckets that have been idle long enough to refill, which
+// behave exactly like the new bucket a later request would get. l.mu must
+// be held.
+func (l *Limiter) sweep(now time.Time) {
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Stats describes a Limiter's settings and what it has done.
+type Stats struct {
+	RPS     float64 `json:"rps"` // 0 when limiting is disabled
+	Burst   int     `json:"burst"`
+	Keys    int     `json:"keys"`    // principals holding a bucket that has not refilled
+	Limited uint64  `json:"limited"` // requests refused since the server started
+}
+
+// Stats reports the limiter's settings and counters.
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Stats{
+		RPS:     math.Max(l.rate, 0),
+		Burst:   int(l.burst),
+		Keys:    len(l.buckets),
+		Limited: l.limited,
+	}
+}
@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+)
+
+var testEpoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestAllowRejectsBeyondBurstUntilRefill(t *testing.T) {
+	clk := clock.NewFake(testEpoch)
+	l := New(2, 3, clk) // 2 tokens a second, bucket of 3
+
+	for i := range 3 {
+		if ok, _ := l.Allow("alice"); !ok {
+			t.Fatalf("request %d within the burst rejected", i+1)
+		}
+	}
+	ok, wait := l.Allow("alice")
+	if ok {
+		t.Fatal("request beyond the burst allowed")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("wait = %v, want 500ms for one token at 2/s", wait)
+	}
+
+	clk.Advance(wait - time.Millisecond)
+	if ok, _ := l.Allow("alice"); ok {
+		t.Fatal("request allowed before the bucket refilled")
+	}
+	clk.Advance(time.Millisecond)
+	if ok, _ := l.Allow("alice"); !ok {
+		t.Fatal("request rejected after the bucket refilled")
+	}
+}
+
+func TestAllowKeysBucketsSeparately(t *testing.T) {
+	l := New(1, 1, clock.NewFake(testEpoch))
+
+	if ok, _ := l.Allow("alice"); !ok {
+		t.Fatal("first request from alice rejected")
+	}
+	if ok, _ := l.Allow("alice"); ok {
+		t.Fatal("second request from alice allowed")
+	}
+	if ok, _ := l.Allow("bob"); !ok {
+		t.Fatal("bob limited by alice's requests")
+	}
+}
+
+func TestAllowDisabled(t *testing.T) {
+	l := New(0, 1, clock.NewFake(testEpoch))
+	for range 100 {
+		if ok, _ := l.Allow("alice"); !ok {
+			t.Fatal("request rejected with limiting disabled")
+		}
+	}
+}
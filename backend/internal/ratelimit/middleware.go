@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/AdamPippert/Lobstertank/internal/auth"
+	"github.com/AdamPippert/Lobstertank/internal/logging"
+)
+
+// Middleware returns an HTTP middleware that rate-limits requests per
+// authenticated principal. Principals are told apart by organization and
+// subject, so equal subjects in two organizations do not share a bucket.
+// It must be installed after auth.Middleware; a request that reaches it
+// without a principal is refused with 403.
+func Middleware(l *Limiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := auth.PrincipalFromContext(r.Context())
+			if !ok {
+				http.Error(w, `{"error":"forbidden"}`, http.StatusForbidden)
+				return
+			}
+
+			allowed, wait := l.Allow(principalKey(p))
+			if !allowed {
+				retryAfter := int(math.Ceil(wait.Seconds()))
+				logging.LoggerFromContext(r.Context()).Warn("rate limit exceeded",
+					"subject", p.Subject,
+					"org", p.Org,
+					"retry_after", retryAfter,
+				)
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				http.Error(w, `{"error":"rate limit exceeded"}`, http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// principalKey returns the bucket key of p. The separator cannot occur in
+// an organization name taken from a token or certificate, so no two
+// (org, subject) pairs share a key.
+func principalKey(p *auth.Principal) string {
+	return p.Org + "\x00" + p.Subject
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/auth"
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+)
+
+func TestMiddlewareReturns429WithRetryAfter(t *testing.T) {
+	clk := clock.NewFake(testEpoch)
+	h := Middleware(New(0.5, 2, clk))(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(subject string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/meta/fanout", nil)
+		req = req.WithContext(auth.ContextWithPrincipal(req.Context(), &auth.Principal{Subject: subject}))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := range 2 {
+		if rec := request("alice"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i+1, rec.Code)
+		}
+	}
+	rec := request("alice")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("request 3: status = %d, want 429", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want 2 seconds for one token at 0.5/s", got)
+	}
+
+	if rec := request("bob"); rec.Code != http.StatusOK {
+		t.Errorf("another principal: status = %d, want 200", rec.Code)
+	}
+
+	clk.Advance(2 * time.Second)
+	if rec := request("alice"); rec.Code != http.StatusOK {
+		t.Errorf("after refill: status = %d, want 200", rec.Code)
+	}
+}
+
+func TestMiddlewareKeysOnOrgAndSubject(t *testing.T) {
+	h := Middleware(New(1, 1, clock.NewFake(testEpoch)))(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(p *auth.Principal) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/meta/fanout", nil)
+		if p != nil {
+			req = req.WithContext(auth.ContextWithPrincipal(req.Context(), p))
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := request(&auth.Principal{Subject: "ci", Org: "acme"}); code != http.StatusOK {
+		t.Fatalf("acme/ci: status = %d, want 200", code)
+	}
+	if code := request(&auth.Principal{Subject: "ci", Org: "acme"}); code != http.StatusTooManyRequests {
+		t.Errorf("acme/ci again: status = %d, want 429", code)
+	}
+	if code := request(&auth.Principal{Subject: "ci", Org: "globex"}); code != http.StatusOK {
+		t.Errorf("globex/ci: status = %d, want 200; the same subject in another org has its own bucket", code)
+	}
+	if code := request(nil); code != http.StatusForbidden {
+		t.Errorf("no principal: status = %d, want 403", code)
+	}
+}
@@ -11,12 +11,21 @@ import (
 	"sync"
 )
 
-// BuiltinProvider stores secrets in memory with AES-GCM encryption.
-// In production, the encrypted map should be persisted to the data store.
+// BuiltinProvider stores secrets in memory with AES-GCM encryption. Attach a
+// Backend with Persist to keep the encrypted map across restarts.
 type BuiltinProvider struct {
 	mu      sync.RWMutex
 	secrets map[string]string // ref -> base64(encrypted value)
 	aead    cipher.AEAD
+	backend Backend // nil keeps secrets in memory only
+}
+
+// Backend durably stores the builtin provider's values. Values are written
+// exactly as held in memory, so they are encrypted whenever a key is set.
+type Backend interface {
+	ListSecrets(ctx context.Context) (map[string]string, error)
+	PutSecret(ctx context.Context, ref, value string) error
+	DeleteSecret(ctx context.Context, ref string) error
 }
 
 // NewBuiltinProvider creates an in-memory secrets provider using the given
@@ -53,12 +62,29 @@ func NewBuiltinProvider(encKeyBase64 string) (*BuiltinProvider, error) {
 	}, nil
 }
 
-// Resolve decrypts and returns the secret for the given reference.
-func (p *BuiltinProvider) Resolve(_ context.Context, ref string) (string, error) {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
+// Persist loads previously stored secrets from b and writes every later
+// Store and Delete through to it.
+func (p *BuiltinProvider) Persist(ctx context.Context, b Backend) error {
+	stored, err := b.ListSecrets(ctx)
+	if err != nil {
+		return fmt.Errorf("load persisted secrets: %w", err)
+	}
 
-	enc, ok := p.secrets[ref]
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for ref, value := range stored {
+		p.secrets[ref] = value
+	}
+	p.backend = b
+	return nil
+}
+
+// Resolve decrypts and returns the secret for the given reference.
+func (p *BuiltinProvider) Resolve(ctx context.Context, ref string) (string, error) {
+	enc, ok, err := p.lookup(ctx, ref)
+	if err != nil {
+		return "", err
+	}
 	if !ok {
 		return "", fmt.Errorf("secret not found: %s", ref)
 	}
@@ -87,30 +113,72 @@ func (p *BuiltinProvider) Resolve(_ context.Context, ref string) (string, error)
 	return string(plaintext), nil
 }
 
+// lookup returns the stored value for ref. On a miss it rereads the backend,
+// since another process (such as a migration command) may have written it.
+func (p *BuiltinProvider) lookup(ctx context.Context, ref string) (string, bool, error) {
+	p.mu.RLock()
+	enc, ok := p.secrets[ref]
+	backend := p.backend
+	p.mu.RUnlock()
+	if ok || backend == nil {
+		return enc, ok, nil
+	}
+
+	stored, err := backend.ListSecrets(ctx)
+	if err != nil {
+		return "", false, fmt.Errorf("reload persisted secrets: %w", err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for r, v := range stored {
+		if _, exists := p.secrets[r]; !exists {
+			p.secrets[r] = v
+		}
+	}
+	enc, ok = p.secrets[ref]
+	return enc, ok, nil
+}
+
 // Store encrypts and saves a secret under the given reference.
-func (p *BuiltinProvider) Store(_ context.Context, ref string, value string) error {
+func (p *BuiltinProvider) Store(ctx context.Context, ref string, value string) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	if p.aead == nil {
-		p.secrets[ref] = value
-		return nil
+	enc := value
+	if p.aead != nil {
+		nonce := make([]byte, p.aead.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return fmt.Errorf("generate nonce: %w", err)
+		}
+		ciphertext := p.aead.Seal(nonce, nonce, []byte(value), nil)
+		enc = base64.StdEncoding.EncodeToString(ciphertext)
 	}
 
-	nonce := make([]byte, p.aead.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return fmt.Errorf("generate nonce: %w", err)
+	if p.backend != nil {
+		if err := p.backend.PutSecret(ctx, ref, enc); err != nil {
+			return fmt.Errorf("persist secret: %w", err)
+		}
 	}
-
-	ciphertext := p.aead.Seal(nonce, nonce, []byte(value), nil)
-	p.secrets[ref] = base64.StdEncoding.EncodeToString(ciphertext)
+	p.secrets[ref] = enc
 	return nil
 }
 
 // Delete removes a secret by reference.
-func (p *BuiltinProvider) Delete(_ context.Context, ref string) error {
+func (p *BuiltinProvider) Delete(ctx context.Context, ref string) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+
+	if p.backend != nil {
+		if err := p.backend.DeleteSecret(ctx, ref); err != nil {
+			return fmt.Errorf("delete persisted secret: %w", err)
+		}
+	}
 	delete(p.secrets, ref)
 	return nil
 }
+
+// Ping always succeeds: secrets are held in memory, and the database that
+// persists them is checked on its own.
+func (p *BuiltinProvider) Ping(context.Context) error {
+	return nil
+}
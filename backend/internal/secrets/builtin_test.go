@@ -0,0 +1,182 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"maps"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testKey is a base64 AES-256 key.
+var testKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+// memBackend is a Backend over a map, shared by the providers given it.
+type memBackend struct {
+	mu     sync.Mutex
+	values map[string]string
+	lists  int
+	err    error // returned by every call when set
+}
+
+func newMemBackend() *memBackend {
+	return &memBackend{values: map[string]string{}}
+}
+
+func (b *memBackend) ListSecrets(context.Context) (map[string]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lists++
+	if b.err != nil {
+		return nil, b.err
+	}
+	return maps.Clone(b.values), nil
+}
+
+func (b *memBackend) PutSecret(_ context.Context, ref, value string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+	b.values[ref] = value
+	return nil
+}
+
+func (b *memBackend) DeleteSecret(_ context.Context, ref string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+	delete(b.values, ref)
+	return nil
+}
+
+func TestNewBuiltinProviderKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		wantErr string
+	}{
+		{"no key", "", ""},
+		{"valid", testKey, ""},
+		{"not base64", "not-base64!", "decode encryption key"},
+		{"short", base64.StdEncoding.EncodeToString([]byte("too short")), "must be 32 bytes, got 9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewBuiltinProvider(tt.key)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("NewBuiltinProvider: got %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuiltinProviderRoundTrip(t *testing.T) {
+	for _, key := range []string{"", testKey} {
+		encrypted := key != ""
+		p, err := NewBuiltinProvider(key)
+		if err != nil {
+			t.Fatalf("NewBuiltinProvider: %v", err)
+		}
+		b := newMemBackend()
+		if err := p.Persist(context.Background(), b); err != nil {
+			t.Fatalf("Persist: %v", err)
+		}
+		ctx := context.Background()
+		ref := "builtin://gateways/gw-1/token"
+
+		if err := p.Store(ctx, ref, "s3cret"); err != nil {
+			t.Fatalf("encrypted %v: Store: %v", encrypted, err)
+		}
+		if got, err := p.Resolve(ctx, ref); err != nil || got != "s3cret" {
+			t.Errorf("encrypted %v: Resolve = %q, %v; want s3cret", encrypted, got, err)
+		}
+		if stored := b.values[ref]; (stored == "s3cret") == encrypted {
+			t.Errorf("encrypted %v: backend holds %q", encrypted, stored)
+		}
+
+		if err := p.Delete(ctx, ref); err != nil {
+			t.Fatalf("encrypted %v: Delete: %v", encrypted, err)
+		}
+		if _, err := p.Resolve(ctx, ref); err == nil || !strings.Contains(err.Error(), "secret not found") {
+			t.Errorf("encrypted %v: Resolve after Delete: got %v, want not found", encrypted, err)
+		}
+		if _, ok := b.values[ref]; ok {
+			t.Errorf("encrypted %v: Delete left the secret in the backend", encrypted)
+		}
+	}
+}
+
+func TestBuiltinProviderWrongKey(t *testing.T) {
+	ctx := context.Background()
+	b := newMemBackend()
+	writer, _ := NewBuiltinProvider(testKey)
+	if err := writer.Persist(ctx, b); err != nil {
+		t.Fatalf("Persist: %v", err)
+	}
+	if err := writer.Store(ctx, "builtin://a", "s3cret"); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+
+	other := base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210"))
+	reader, _ := NewBuiltinProvider(other)
+	if err := reader.Persist(ctx, b); err != nil {
+		t.Fatalf("Persist: %v", err)
+	}
+	if _, err := reader.Resolve(ctx, "builtin://a"); err == nil || !strings.Contains(err.Error(), "decrypt secret") {
+		t.Errorf("Resolve under another key: got %v, want a decryption error", err)
+	}
+}
+
+func TestBuiltinProviderPersist(t *testing.T) {
+	ctx := context.Background()
+	b := newMemBackend()
+	first, _ := NewBuiltinProvider(testKey)
+	if err := first.Persist(ctx, b); err != nil {
+		t.Fatalf("Persist: %v", err)
+	}
+	if err := first.Store(ctx, "builtin://a", "alpha"); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+
+	// A restarted process loads what the last one stored.
+	second, _ := NewBuiltinProvider(testKey)
+	if err := second.Persist(ctx, b); err != nil {
+		t.Fatalf("Persist: %v", err)
+	}
+	if got, err := second.Resolve(ctx, "builtin://a"); err != nil || got != "alpha" {
+		t.Errorf("Resolve after restart = %q, %v; want alpha", got, err)
+	}
+
+	// A miss rereads the backend, finding what another process wrote since.
+	if err := first.Store(ctx, "builtin://b", "bravo"); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	lists := b.lists
+	if got, err := second.Resolve(ctx, "builtin://b"); err != nil || got != "bravo" {
+		t.Errorf("Resolve of a secret written elsewhere = %q, %v; want bravo", got, err)
+	}
+	if got, err := second.Resolve(ctx, "builtin://b"); err != nil || got != "bravo" || b.lists != lists+1 {
+		t.Errorf("second Resolve = %q, %v after %d backend reads; want bravo from memory", got, err, b.lists-lists)
+	}
+
+	// Backend failures surface, and a failed write is not kept in memory.
+	b.err = errors.New("database is locked")
+	if err := second.Store(ctx, "builtin://c", "charlie"); err == nil || !strings.Contains(err.Error(), "persist secret") {
+		t.Errorf("Store with a failing backend: got %v", err)
+	}
+	if _, err := second.Resolve(ctx, "builtin://c"); err == nil || !strings.Contains(err.Error(), "reload persisted secrets") {
+		t.Errorf("Resolve of the failed write: got %v, want the backend error", err)
+	}
+	if err := second.Delete(ctx, "builtin://a"); err == nil {
+		t.Error("Delete with a failing backend succeeded")
+	}
+	if err := new(BuiltinProvider).Persist(ctx, b); err == nil {
+		t.Error("Persist with a failing backend succeeded")
+	}
+}
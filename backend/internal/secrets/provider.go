@@ -18,6 +18,9 @@ type Provider interface {
 
 	// Delete removes a secret by reference.
 	Delete(ctx context.Context, ref string) error
+
+	// Ping reports whether the provider can currently serve secrets.
+	Ping(ctx context.Context) error
 }
 
 // NewProvider constructs the appropriate secrets provider based on configuration.
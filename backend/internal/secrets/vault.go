@@ -160,3 +160,26 @@ func (p *VaultProvider) Delete(ctx context.Context, ref string) error {
 
 	return nil
 }
+
+// Ping queries Vault's health endpoint. Standby nodes count as healthy, since
+// they forward requests to the active node; a sealed or uninitialized Vault
+// does not.
+func (p *VaultProvider) Ping(ctx context.Context) error {
+	url := p.addr + "/v1/sys/health?standbyok=true&perfstandbyok=true"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("build vault health request: %w", err)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault health request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault health returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVaultPing(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    int // Vault's health status; 0 leaves Vault unreachable
+		wantErr string
+	}{
+		{"active or standby", http.StatusOK, ""},
+		{"sealed", http.StatusServiceUnavailable, "vault health returned HTTP 503"},
+		{"uninitialized", http.StatusNotImplemented, "vault health returned HTTP 501"},
+		{"unreachable", 0, "vault health request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/sys/health" || r.URL.Query().Get("standbyok") != "true" || r.URL.Query().Get("perfstandbyok") != "true" {
+					t.Errorf("unexpected request %s", r.URL)
+				}
+				w.WriteHeader(tt.code)
+			}))
+			defer srv.Close()
+			if tt.code == 0 {
+				srv.Close()
+			}
+
+			p, err := NewVaultProvider(srv.URL+"/", "token", "")
+			if err != nil {
+				t.Fatalf("NewVaultProvider: %v", err)
+			}
+			err = p.Ping(context.Background())
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Ping: got %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
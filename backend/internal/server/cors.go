@@ -0,0 +1,86 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	corsAllowedMethods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+	corsAllowedHeaders = "Authorization, Content-Type, X-Request-ID, Idempotency-Key, Last-Event-ID"
+	corsMaxAge         = "600"
+)
+
+// corsOrigins is the set of browser origins allowed to call the API. It can
+// be replaced while requests are being served.
+type corsOrigins struct {
+	v atomic.Pointer[originSet]
+}
+
+type originSet struct {
+	allowed  map[string]struct{}
+	allowAny bool
+}
+
+func newCORSOrigins(origins []string) *corsOrigins {
+	c := &corsOrigins{}
+	c.set(origins)
+	return c
+}
+
+// set replaces the allowed origins.
+func (c *corsOrigins) set(origins []string) {
+	allowed := make(map[string]struct{}, len(origins))
+	for _, o := range origins {
+		allowed[strings.TrimRight(o, "/")] = struct{}{}
+	}
+	_, allowAny := allowed["*"]
+	c.v.Store(&originSet{allowed: allowed, allowAny: allowAny})
+}
+
+// corsMiddleware returns middleware that adds CORS headers for the given
+// origins and answers preflight requests before they reach routing or auth.
+// An empty origin list disables CORS entirely (same-origin only). The
+// wildcard "*" allows any origin.
+func corsMiddleware(origins *corsOrigins) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			set := origins.v.Load()
+			origin := r.Header.Get("Origin")
+			if len(set.allowed) == 0 || origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Origin")
+			_, ok := set.allowed[origin]
+			if !ok && !set.allowAny {
+				// Let the request proceed without CORS headers; the browser
+				// will block the response. Preflights are rejected outright.
+				if isPreflight(r) {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+
+			if isPreflight(r) {
+				w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+				w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+				w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// corsTestHandler wraps a handler that answers 200 in corsMiddleware for
+// origins, recording whether a request reached it.
+func corsTestHandler(origins []string, reached *bool) http.Handler {
+	return corsMiddleware(newCORSOrigins(origins))(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		*reached = true
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func TestCORSPermittedOrigin(t *testing.T) {
+	var reached bool
+	h := corsTestHandler([]string{"https://ui.example.com/"}, &reached)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/gateways", nil)
+	req.Header.Set("Origin", "https://ui.example.com")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if !reached || rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, reached = %v; want the request served", rec.Code, reached)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://ui.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want the request origin", got)
+	}
+	if got := rec.Header().Get("Vary"); got != "Origin" {
+		t.Errorf("Vary = %q, want Origin", got)
+	}
+}
+
+func TestCORSDeniedOrigin(t *testing.T) {
+	var reached bool
+	h := corsTestHandler([]string{"https://ui.example.com"}, &reached)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/gateways", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q for a denied origin, want none", got)
+	}
+
+	req = httptest.NewRequest(http.MethodOptions, "/api/v1/gateways", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	rec = httptest.NewRecorder()
+	reached = false
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden || reached {
+		t.Errorf("denied preflight: status = %d, reached = %v; want 403 without reaching the handler", rec.Code, reached)
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	var reached bool
+	h := corsTestHandler([]string{"https://ui.example.com"}, &reached)
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/v1/gateways", nil)
+	req.Header.Set("Origin", "https://ui.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "Authorization, Content-Type")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	// Preflights carry no credentials, so they must be answered before
+	// reaching routing and auth.
+	if rec.Code != http.StatusNoContent || reached {
+		t.Fatalf("status = %d, reached = %v; want 204 without reaching the handler", rec.Code, reached)
+	}
+	for header, want := range map[string]string{
+		"Access-Control-Allow-Origin":  "https://ui.example.com",
+		"Access-Control-Allow-Methods": corsAllowedMethods,
+		"Access-Control-Allow-Headers": corsAllowedHeaders,
+		"Access-Control-Max-Age":       corsMaxAge,
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+}
+
+// TestCORSAllowsRequestHeaders checks that browsers may send the request
+// headers the API reads.
+func TestCORSAllowsRequestHeaders(t *testing.T) {
+	allowed := map[string]bool{}
+	for _, h := range strings.Split(corsAllowedHeaders, ",") {
+		allowed[http.CanonicalHeaderKey(strings.TrimSpace(h))] = true
+	}
+	for _, header := range []string{"Authorization", "Content-Type", "X-Request-ID", "Idempotency-Key", "Last-Event-ID"} {
+		if !allowed[http.CanonicalHeaderKey(header)] {
+			t.Errorf("%s is not an allowed CORS request header", header)
+		}
+	}
+}
+
+func TestCORSDisabledByDefault(t *testing.T) {
+	var reached bool
+	h := corsTestHandler(nil, &reached)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/gateways", nil)
+	req.Header.Set("Origin", "https://ui.example.com")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if !reached {
+		t.Fatal("request not served")
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q with no origins configured, want none", got)
+	}
+}
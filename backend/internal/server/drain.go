@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/httputil"
+)
+
+// drainLogInterval is how often shutdown reports the requests still running.
+const drainLogInterval = time.Second
+
+// drainTracker counts in-flight requests and, once shutdown begins, turns
+// new ones away so the server drains instead of taking on more work.
+type drainTracker struct {
+	active   atomic.Int64
+	draining atomic.Bool
+}
+
+// DrainStatus is the response of GET /api/v1/debug/requests.
+type DrainStatus struct {
+	ActiveRequests int64 `json:"active_requests"`
+	Draining       bool  `json:"draining"`
+}
+
+// middleware counts each request while it runs. During draining, requests
+// arriving on kept-alive connections get 503 and the connection is closed.
+func (d *drainTracker) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d.draining.Load() {
+			w.Header().Set("Connection", "close")
+			httputil.WriteError(w, r, http.StatusServiceUnavailable, "server is shutting down", nil)
+			return
+		}
+		d.active.Add(1)
+		defer d.active.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// begin starts draining.
+func (d *drainTracker) begin() {
+	d.draining.Store(true)
+}
+
+func (d *drainTracker) status() DrainStatus {
+	return DrainStatus{ActiveRequests: d.active.Load(), Draining: d.draining.Load()}
+}
+
+// handleStatus handles GET /api/v1/debug/requests.
+func (d *drainTracker) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	httputil.WriteJSON(w, http.StatusOK, d.status())
+}
+
+// logUntilDone reports the in-flight request count every drainLogInterval
+// until ctx is done.
+func (d *drainTracker) logUntilDone(ctx context.Context) {
+	ticker := time.NewTicker(drainLogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			slog.Info("draining requests", "active", d.active.Load())
+		}
+	}
+}
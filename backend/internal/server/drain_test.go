@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDrainTrackerMiddleware(t *testing.T) {
+	d := &drainTracker{}
+	entered, release := make(chan struct{}), make(chan struct{})
+	h := d.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(entered)
+			<-release
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	slow := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+		slow <- rec
+	}()
+	<-entered
+	if got := d.status(); got != (DrainStatus{ActiveRequests: 1}) {
+		t.Errorf("status with one request running = %+v", got)
+	}
+
+	d.begin()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Connection") != "close" {
+		t.Errorf("request while draining: status %d, Connection %q; want 503 closing the connection",
+			rec.Code, rec.Header().Get("Connection"))
+	}
+	if got := d.status(); got != (DrainStatus{ActiveRequests: 1, Draining: true}) {
+		t.Errorf("status while draining = %+v; a refused request was counted", got)
+	}
+
+	close(release)
+	if rec := <-slow; rec.Code != http.StatusNoContent {
+		t.Errorf("request in flight when draining began: status %d, want 204", rec.Code)
+	}
+	if n := d.status().ActiveRequests; n != 0 {
+		t.Errorf("%d requests active after the last finished", n)
+	}
+}
+
+func TestDebugRequestsReportsDraining(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	status := func() DrainStatus {
+		t.Helper()
+		rec := serve(s, http.MethodGet, "/api/v1/debug/requests", testToken, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+		}
+		var got DrainStatus
+		if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return got
+	}
+	// The status request itself is in flight.
+	if got := status(); got != (DrainStatus{ActiveRequests: 1}) {
+		t.Errorf("debug/requests = %+v, want only itself active", got)
+	}
+	if rec := serve(s, http.MethodGet, "/api/v1/debug/requests", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous debug/requests: status = %d, want 401", rec.Code)
+	}
+
+	s.drain.begin()
+	for _, path := range []string{"/readyz", "/api/v1/gateways", "/api/v1/debug/requests"} {
+		if rec := serve(s, http.MethodGet, path, testToken, ""); rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s while draining: status = %d, want 503", path, rec.Code)
+		}
+	}
+}
+
+func TestRunDrainsInFlightRequests(t *testing.T) {
+	s := newTestServer(t, nil)
+	entered, release := make(chan struct{}), make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, _ *http.Request) {
+		close(entered)
+		<-release
+		io.WriteString(w, "finished")
+	})
+	s.httpServer.Handler = s.drain.middleware(mux)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	base := "http://" + s.httpServer.Addr
+
+	type result struct {
+		body string
+		err  error
+	}
+	slow := make(chan result, 1)
+	go func() {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			resp, err := http.Get(base + "/slow")
+			if err != nil && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond) // not listening yet
+				continue
+			}
+			if err != nil {
+				slow <- result{err: err}
+				return
+			}
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			slow <- result{string(body), err}
+			return
+		}
+	}()
+	select {
+	case <-entered:
+	case r := <-slow:
+		t.Fatalf("slow request never arrived: %v", r.err)
+	}
+
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for !s.drain.status().Draining {
+		if time.Now().After(deadline) {
+			t.Fatal("server did not start draining")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Run returned with a request in flight: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if r := <-slow; r.err != nil || r.body != "finished" {
+		t.Errorf("in-flight request: body %q, err %v; want it to finish", r.body, r.err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Run: %v", err)
+	}
+}
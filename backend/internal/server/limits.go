@@ -0,0 +1,26 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/AdamPippert/Lobstertank/internal/httputil"
+)
+
+// maxBodyMiddleware caps request bodies at limit bytes. A declared length
+// over the limit is refused with 413 before the handler runs; otherwise the
+// body is wrapped so reading past the limit fails, which handlers report as
+// 413 through httputil.WriteBodyError.
+func maxBodyMiddleware(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				httputil.WriteError(w, r, http.StatusRequestEntityTooLarge, "request body too large", nil)
+				return
+			}
+			if r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AdamPippert/Lobstertank/internal/httputil"
+)
+
+// decodeHandler decodes a JSON body the way the API's handlers do.
+func decodeHandler(reached *bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*reached = true
+		var v map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			httputil.WriteBodyError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// oversized returns a JSON object body of at least n bytes.
+func oversized(n int) string {
+	return `{"name":"` + strings.Repeat("x", n) + `"}`
+}
+
+func TestMaxBodyRejectsDeclaredLength(t *testing.T) {
+	var reached bool
+	h := maxBodyMiddleware(64)(decodeHandler(&reached))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/gateways", strings.NewReader(oversized(64))))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413", rec.Code)
+	}
+	if reached {
+		t.Error("handler ran for a body declared over the limit")
+	}
+}
+
+func TestMaxBodyRejectsUndeclaredLength(t *testing.T) {
+	var reached bool
+	h := maxBodyMiddleware(64)(decodeHandler(&reached))
+
+	// A chunked body has no declared length, so the limit is only hit
+	// while the handler reads it.
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/gateways", io.NopCloser(strings.NewReader(oversized(64))))
+	r.ContentLength = -1
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413", rec.Code)
+	}
+}
+
+func TestMaxBodyAllowsBodyWithinLimit(t *testing.T) {
+	var reached bool
+	h := maxBodyMiddleware(64)(decodeHandler(&reached))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/gateways", strings.NewReader(`{"name":"small"}`)))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+}
+
+func TestRoutesLimitBodies(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"LT_SERVER_MAX_BODY_BYTES": "256",
+		"LT_PROMPT_MAX_BODY_BYTES": "4096",
+	})
+
+	if rec := serve(s, http.MethodPost, "/api/v1/gateways", testToken, oversized(256)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized gateway: status = %d, want 413", rec.Code)
+	}
+	// Prompt routes take their own, larger limit: a body over the general
+	// limit reaches the handler, which reports the unknown gateway.
+	if rec := serve(s, http.MethodPost, "/api/v1/gateways/missing/prompt", testToken, `{"prompt":"`+strings.Repeat("x", 1024)+`"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("prompt under its own limit: status = %d, want 404", rec.Code)
+	}
+	if rec := serve(s, http.MethodPost, "/api/v1/gateways/missing/prompt", testToken, oversized(4096)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized prompt: status = %d, want 413", rec.Code)
+	}
+}
+
+func TestServerLimitsHeaders(t *testing.T) {
+	s := newTestServer(t, map[string]string{"LT_SERVER_MAX_HEADER_BYTES": "1024"})
+	base := startServer(t, s, "http", http.DefaultClient)
+
+	req, err := http.NewRequest(http.MethodGet, base+"/healthz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Padding", strings.Repeat("x", 8192))
+	// A fresh connection, since net/http measures the limit from the start
+	// of a connection's first request.
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("GET with large headers: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("status = %d, want 431", resp.StatusCode)
+	}
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/gateway"
+)
+
+// errorBody mirrors the JSON error envelope returned by every handler.
+type errorBody struct {
+	Error          string              `json:"error"`
+	Message        string              `json:"message,omitempty"`
+	Violations     []gateway.Violation `json:"violations,omitempty"`
+	UpstreamStatus int                 `json:"upstream_status,omitempty"`
+}
+
+var pathParamRE = regexp.MustCompile(`\{([^}]+)\}`)
+
+// openAPIHandler serves an OpenAPI 3 document describing routes. The
+// document is built once, when the routes are registered.
+func openAPIHandler(routes []route) http.Handler {
+	doc, err := json.MarshalIndent(buildOpenAPI(routes), "", "  ")
+	if err != nil {
+		// Only unsupported types can fail here, which is a programming error.
+		panic("build openapi document: " + err.Error())
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write(doc); err != nil {
+			slog.Error("failed to write openapi document", "error", err)
+		}
+	})
+}
+
+// buildOpenAPI describes routes as an OpenAPI 3 document. Schemas are
+// derived from the request and response types by reflection, following
+// their json tags.
+func buildOpenAPI(routes []route) map[string]any {
+	sg := &schemaGen{schemas: map[string]any{}}
+	errorRef := sg.schemaFor(reflect.TypeFor[errorBody]())
+
+	paths := map[string]map[string]any{}
+	for _, rt := range routes {
+		op := map[string]any{
+			"operationId": operationID(rt),
+			"summary":     rt.summary,
+		}
+
+		var params []any
+		for _, m := range pathParamRE.FindAllStringSubmatch(rt.path, -1) {
+			params = append(params, map[string]any{
+				"name": m[1], "in": "path", "required": true,
+				"schema": map[string]any{"type": "string"},
+			})
+		}
+		for _, q := range rt.query {
+			params = append(params, map[string]any{
+				"name": q.name, "in": "query", "description": q.description,
+				"schema": map[string]any{"type": q.typ},
+			})
+		}
+		for _, hd := range rt.headers {
+			params = append(params, map[string]any{
+				"name": hd.name, "in": "header", "description": hd.description,
+				"schema": map[string]any{"type": hd.typ},
+			})
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		if rt.request != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content":  content(rt.requestType, sg.schemaFor(reflect.TypeOf(rt.request))),
+			}
+		}
+
+		status := rt.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := map[string]any{"description": http.StatusText(status)}
+		if rt.response != nil {
+			success["content"] = content(rt.responseType, sg.schemaFor(reflect.TypeOf(rt.response)))
+		}
+		responses := map[string]any{
+			strconv.Itoa(status): success,
+			"default": map[string]any{
+				"description": "Error",
+				"content":     content("", errorRef),
+			},
+		}
+		if rt.mw != nil {
+			op["security"] = []any{map[string]any{"bearerAuth": []any{}}}
+			responses["401"] = map[string]any{
+				"description": "Missing or invalid credentials",
+				"content":     content("", errorRef),
+			}
+		}
+		op["responses"] = responses
+
+		if paths[rt.path] == nil {
+			paths[rt.path] = map[string]any{}
+		}
+		paths[rt.path][strings.ToLower(rt.method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "Lobstertank API",
+			"description": "Control plane for managing multiple OpenClaw gateways.",
+			"version":     "0.1.0",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": sg.schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+// operationID derives a stable identifier such as "post_gateways_id_health".
+func operationID(rt route) string {
+	path := strings.TrimPrefix(rt.path, "/api/v1")
+	path = strings.NewReplacer("{", "", "}", "").Replace(path)
+	return strings.ToLower(rt.method) + strings.ReplaceAll(path, "/", "_")
+}
+
+func content(mediaType string, schema any) map[string]any {
+	if mediaType == "" {
+		mediaType = "application/json"
+	}
+	return map[string]any{mediaType: map[string]any{"schema": schema}}
+}
+
+// schemaGen collects named struct schemas into components as it walks types.
+type schemaGen struct {
+	schemas map[string]any
+}
+
+var (
+	timeType = reflect.TypeFor[time.Time]()
+	rawType  = reflect.TypeFor[json.RawMessage]()
+)
+
+// schemaFor returns the schema for t. Named structs are emitted once under
+// components and referenced from then on.
+func (g *schemaGen) schemaFor(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == rawType:
+		return map[string]any{} // any JSON value
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schemaFor(t.Elem())}
+	case reflect.Struct:
+		return g.structSchema(t)
+	default:
+		return map[string]any{}
+	}
+}
+
+func (g *schemaGen) structSchema(t reflect.Type) map[string]any {
+	name := t.Name()
+	if t == reflect.TypeFor[errorBody]() {
+		name = "ApiError"
+	}
+	ref := map[string]any{"$ref": "#/components/schemas/" + name}
+	if name == "" {
+		return g.objectSchema(t)
+	}
+	if _, ok := g.schemas[name]; !ok {
+		g.schemas[name] = map[string]any{} // placeholder for recursive types
+		g.schemas[name] = g.objectSchema(t)
+	}
+	return ref
+}
+
+// objectSchema describes a struct's JSON fields. Fields without omitempty
+// that are not pointers are listed as required.
+func (g *schemaGen) objectSchema(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schemaFor(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	s := newTestServer(t, nil)
+	rec := serve(s, http.MethodGet, "/openapi.json", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+
+	var doc struct {
+		OpenAPI    string                               `json:"openapi"`
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]any `json:"properties"`
+				Required   []string       `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	raw := rec.Body.Bytes()
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatalf("document is not valid JSON: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("openapi = %q, want a 3.x document", doc.OpenAPI)
+	}
+
+	gateways := doc.Paths["/api/v1/gateways"]
+	for _, method := range []string{"get", "post"} {
+		if gateways[method] == nil {
+			t.Errorf("/api/v1/gateways has no %s operation", method)
+		}
+	}
+	create, _ := json.Marshal(gateways["post"])
+	if !strings.Contains(string(create), `"#/components/schemas/CreateGatewayRequest"`) {
+		t.Errorf("POST /api/v1/gateways does not take a CreateGatewayRequest: %s", create)
+	}
+	if _, ok := gateways["post"]["security"]; !ok {
+		t.Error("POST /api/v1/gateways does not require authentication")
+	}
+	if _, ok := doc.Paths["/healthz"]["get"]["security"]; ok {
+		t.Error("GET /healthz requires authentication")
+	}
+
+	schema, ok := doc.Components.Schemas["CreateGatewayRequest"]
+	if !ok {
+		t.Fatal("no CreateGatewayRequest schema")
+	}
+	for _, field := range []string{"name", "endpoint", "transport", "labels"} {
+		if _, ok := schema.Properties[field]; !ok {
+			t.Errorf("CreateGatewayRequest has no %s property", field)
+		}
+	}
+	if !slices.Contains(schema.Required, "name") || slices.Contains(schema.Required, "labels") {
+		t.Errorf("CreateGatewayRequest requires %v, want name but not labels", schema.Required)
+	}
+
+	// Every reference names a schema the document defines.
+	for _, ref := range strings.Split(string(raw), `"$ref": "#/components/schemas/`)[1:] {
+		name, _, _ := strings.Cut(ref, `"`)
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("reference to undefined schema %s", name)
+		}
+	}
+
+	// Every documented operation is routed.
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			target := strings.ReplaceAll(path, "{id}", "gw-1")
+			rec := serve(s, strings.ToUpper(method), target, "", "")
+			if rec.Code == http.StatusNotFound && strings.Contains(rec.Body.String(), "404 page not found") ||
+				rec.Code == http.StatusMethodNotAllowed {
+				t.Errorf("%s %s is documented but not routed: %d", strings.ToUpper(method), path, rec.Code)
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"log/slog"
+	"reflect"
+
+	"github.com/AdamPippert/Lobstertank/internal/config"
+)
+
+// Reload applies the reloadable settings of cfg to the running server
+// without dropping connections:
+//
+//   - Log.Level, when Dependencies.LogLevel is set
+//   - Server.CORSAllowedOrigins
+//   - RateLimit
+//   - Monitor.Interval and Monitor.Jitter, when the monitor is enabled
+//
+// Every other setting needs a restart; sections of cfg that change one are
+// logged and otherwise ignored. cfg should already be validated. Reload is
+// safe to call while the server runs, but not from several goroutines.
+func (s *Server) Reload(cfg *config.Config) {
+	next := *s.applied
+	next.Log = cfg.Log
+	next.Server.CORSAllowedOrigins = cfg.Server.CORSAllowedOrigins
+	next.RateLimit = cfg.RateLimit
+	next.Monitor.Interval = cfg.Monitor.Interval
+	next.Monitor.Jitter = cfg.Monitor.Jitter
+
+	if s.deps.LogLevel != nil {
+		s.deps.LogLevel.Set(cfg.Log.Level)
+	}
+	s.cors.set(cfg.Server.CORSAllowedOrigins)
+	for name, l := range s.limiters {
+		rl := cfg.RateLimit.For(name)
+		l.SetRate(rl.RPS, rl.Burst)
+	}
+	if s.deps.Monitor != nil {
+		s.deps.Monitor.SetSchedule(cfg.Monitor)
+	}
+
+	ignored := changedSections(&next, cfg)
+	s.applied = &next
+
+	slog.Info("configuration reloaded",
+		"log_level", cfg.Log.Level.String(),
+		"cors_allowed_origins", cfg.Server.CORSAllowedOrigins,
+		"ratelimit_rps", cfg.RateLimit.RPS,
+		"ratelimit_burst", cfg.RateLimit.Burst,
+		"ratelimit_routes", cfg.RateLimit.Routes,
+		"monitor_interval", cfg.Monitor.Interval.String(),
+	)
+	if len(ignored) > 0 {
+		slog.Warn("configuration changes that need a restart were not applied", "sections", ignored)
+	}
+}
+
+// changedSections returns the names of the top-level sections that differ
+// between a and b.
+func changedSections(a, b *config.Config) []string {
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	var changed []string
+	for i := range va.NumField() {
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			changed = append(changed, va.Type().Field(i).Name)
+		}
+	}
+	return changed
+}
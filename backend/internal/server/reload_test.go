@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AdamPippert/Lobstertank/internal/config"
+)
+
+// corsAllowed reports whether s lets origin read its responses.
+func corsAllowed(s *Server, origin string) bool {
+	r := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	r.Header.Set("Origin", origin)
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, r)
+	return rec.Header().Get("Access-Control-Allow-Origin") == origin
+}
+
+func TestReload(t *testing.T) {
+	s := newTestServer(t, nil)
+	level := new(slog.LevelVar)
+	s.deps.LogLevel = level
+	port, maxBody := s.applied.Server.Port, s.applied.Server.MaxBodyBytes
+
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: level})))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	next := *s.applied
+	next.Log.Level = slog.LevelDebug
+	next.Server.CORSAllowedOrigins = []string{"https://ui.example.com"}
+	next.RateLimit.Routes = map[string]config.RateLimit{"fanout": {RPS: 0.001, Burst: 1}}
+	next.Server.Port++
+	next.Server.MaxBodyBytes *= 2
+	s.Reload(&next)
+
+	// Reloadable settings take effect.
+	if level.Level() != slog.LevelDebug {
+		t.Errorf("log level = %v, want debug", level.Level())
+	}
+	slog.Debug("debug after reload")
+	if !strings.Contains(logs.String(), "debug after reload") {
+		t.Error("debug message not logged after reload")
+	}
+	if !corsAllowed(s, "https://ui.example.com") {
+		t.Error("origin allowed by the reload was refused")
+	}
+	fanout := s.limiters["fanout"]
+	if ok, _ := fanout.Allow("k"); !ok {
+		t.Error("first fan-out refused")
+	}
+	if ok, _ := fanout.Allow("k"); ok {
+		t.Error("fan-out beyond the reloaded burst of 1 allowed")
+	}
+
+	// Restart-only settings are reported and left alone.
+	if !strings.Contains(logs.String(), "need a restart") || !strings.Contains(logs.String(), "sections=[Server]") {
+		t.Errorf("restart-only change not reported: %s", logs.String())
+	}
+	if s.applied.Server.Port != port || s.applied.Server.MaxBodyBytes != maxBody {
+		t.Errorf("applied port %d, max body %d; want the originals %d, %d",
+			s.applied.Server.Port, s.applied.Server.MaxBodyBytes, port, maxBody)
+	}
+	if s.applied.Log.Level != slog.LevelDebug || len(s.applied.Server.CORSAllowedOrigins) != 1 {
+		t.Errorf("applied config does not record the reloaded settings: %+v", s.applied)
+	}
+
+	// A reload without restart-only changes does not warn, and a higher
+	// level silences what the lower one let through.
+	logs.Reset()
+	next.Server.Port, next.Server.MaxBodyBytes = port, maxBody
+	s.Reload(&next)
+	if strings.Contains(logs.String(), "need a restart") {
+		t.Errorf("reload without restart-only changes warned: %s", logs.String())
+	}
+	next.Log.Level = slog.LevelWarn
+	s.Reload(&next)
+	if slog.Default().Enabled(context.Background(), slog.LevelInfo) {
+		t.Error("info still enabled after reloading at warn")
+	}
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/logging"
+	"github.com/google/uuid"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	// maxRequestIDLength bounds a client-supplied request ID; longer ones
+	// are replaced rather than stored.
+	maxRequestIDLength = 128
+)
+
+// requestIDMiddleware tags each request with an ID, taken from the
+// X-Request-ID header when the client sent a usable one, so audit events
+// and log lines can be tied to the request that caused them. The ID is
+// echoed in the response.
+//
+// The request's context also carries a logger with the request ID, method,
+// and path; handlers reach it with logging.LoggerFromContext, and the auth
+// middleware adds the principal.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength || !printableASCII(id) {
+			id = uuid.New().String()
+		}
+		w.Header().Set(requestIDHeader, id)
+		ctx := audit.ContextWithRequestID(r.Context(), id)
+		ctx = logging.With(ctx, "request_id", id, "method", r.Method, "path", r.URL.Path)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func printableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	h := requestIDMiddleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		seen = audit.RequestIDFromContext(r.Context())
+	}))
+
+	for name, tt := range map[string]struct {
+		sent string
+		kept bool
+	}{
+		"supplied":     {"req-123", true},
+		"missing":      {"", false},
+		"too long":     {strings.Repeat("x", maxRequestIDLength+1), false},
+		"unprintable":  {"req\x01", false},
+		"longest kept": {strings.Repeat("x", maxRequestIDLength), true},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+		if tt.sent != "" {
+			r.Header.Set(requestIDHeader, tt.sent)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+
+		echoed := rec.Header().Get(requestIDHeader)
+		if echoed == "" || echoed != seen {
+			t.Errorf("%s: echoed %q, context %q; want the same non-empty ID", name, echoed, seen)
+		}
+		if (echoed == tt.sent) != tt.kept {
+			t.Errorf("%s: sent %q, got %q; kept = %v, want %v", name, tt.sent, echoed, echoed == tt.sent, tt.kept)
+		}
+	}
+}
+
+// readAuditLog decodes the audit events written to the file at path.
+func readAuditLog(t *testing.T, path string) []audit.Event {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open audit log: %v", err)
+	}
+	defer f.Close()
+
+	var events []audit.Event
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e audit.Event
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("decode audit line %q: %v", sc.Text(), err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestAuditEventsRecordSubjectAndRequestID(t *testing.T) {
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	s := newTestServer(t, map[string]string{
+		"LT_AUDIT_OUTPUT": "file",
+		"LT_AUDIT_PATH":   auditPath,
+	})
+
+	send := func(method, path, requestID, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+testToken)
+		r.Header.Set(requestIDHeader, requestID)
+		rec := httptest.NewRecorder()
+		s.httpServer.Handler.ServeHTTP(rec, r)
+		return rec
+	}
+
+	rec := send(http.MethodPost, "/api/v1/gateways", "req-create",
+		`{"name":"edge","endpoint":"https://edge.example.com","transport":{"type":"https"}}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, want 201: %s", rec.Code, rec.Body)
+	}
+	var gw model.Gateway
+	if err := json.NewDecoder(rec.Body).Decode(&gw); err != nil {
+		t.Fatalf("decode gateway: %v", err)
+	}
+	if rec := send(http.MethodDelete, "/api/v1/gateways/"+gw.ID, "req-delete", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: status = %d, want 204: %s", rec.Code, rec.Body)
+	}
+
+	want := map[string]string{ // action -> request ID
+		"gateway.created": "req-create",
+		"gateway.deleted": "req-delete",
+	}
+	for _, e := range readAuditLog(t, auditPath) {
+		if e.Subject != "token-user" || e.RequestID == "" {
+			t.Errorf("%s event = %+v, want subject token-user and a request ID", e.Action, e)
+		}
+		if id, ok := want[e.Action]; ok {
+			if e.RequestID != id {
+				t.Errorf("%s request ID = %q, want %q", e.Action, e.RequestID, id)
+			}
+			delete(want, e.Action)
+		}
+	}
+	for action := range want {
+		t.Errorf("no %s event logged", action)
+	}
+}
+
+func TestRequestLoggerCarriesRequestAttributes(t *testing.T) {
+	s := newTestServer(t, nil)
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/gateways",
+		strings.NewReader(`{"name":"edge","endpoint":"https://edge.example.com","transport":{"type":"https"}}`))
+	r.Header.Set("Authorization", "Bearer "+testToken)
+	r.Header.Set(requestIDHeader, "req-log")
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, want 201: %s", rec.Code, rec.Body)
+	}
+
+	// The registry logs with the request's logger, several layers down.
+	var line string
+	for _, l := range strings.Split(logs.String(), "\n") {
+		if strings.Contains(l, `msg="gateway registered"`) {
+			line = l
+		}
+	}
+	for _, attr := range []string{"request_id=req-log", "method=POST", "path=/api/v1/gateways", "principal=token-user"} {
+		if !strings.Contains(line, attr) {
+			t.Errorf("registration log %q lacks %s", line, attr)
+		}
+	}
+}
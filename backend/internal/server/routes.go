@@ -1,40 +1,363 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
+	"sync"
+	"time"
 
+	"github.com/AdamPippert/Lobstertank/internal/audit"
 	"github.com/AdamPippert/Lobstertank/internal/auth"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/events"
 	"github.com/AdamPippert/Lobstertank/internal/gateway"
+	"github.com/AdamPippert/Lobstertank/internal/httputil"
+	"github.com/AdamPippert/Lobstertank/internal/logging"
 	"github.com/AdamPippert/Lobstertank/internal/metaagent"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/ratelimit"
+	"github.com/AdamPippert/Lobstertank/internal/secrets"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+	"github.com/AdamPippert/Lobstertank/internal/webhook"
 )
 
+// route describes one API endpoint. The table drives both mux registration
+// and the OpenAPI document served at /openapi.json, so the two cannot drift.
+type route struct {
+	method  string
+	path    string
+	handler http.HandlerFunc
+	mw      func(http.Handler) http.Handler // nil for unauthenticated routes
+
+	summary      string
+	query        []queryParam
+	headers      []queryParam
+	request      any    // zero value of the body type; nil when there is no body
+	requestType  string // media type of the request body; defaults to application/json
+	maxBody      int64  // request body limit; 0 uses LT_SERVER_MAX_BODY_BYTES
+	status       int    // success status; defaults to 200
+	response     any    // zero value of the response type; nil when there is no body
+	responseType string // media type of the response body; defaults to application/json
+}
+
+type queryParam struct {
+	name, typ, description string
+}
+
+var filterParams = []queryParam{
+	{"status", "string", "Only gateways with this status"},
+	{"label", "string", "key=value; repeat to require several labels"},
+}
+
 func registerRoutes(
 	mux *http.ServeMux,
 	gw *gateway.Handler,
 	meta *metaagent.Handler,
+	hooks *webhook.Handler,
+	evts *events.Handler,
+	tokens *auth.Handler,
+	audits *audit.Handler,
+	db store.Store,
+	secretProvider secrets.Provider,
 	authProvider auth.Provider,
-) {
-	authMW := auth.Middleware(authProvider)
+	auditor *audit.Logger,
+	limiters map[string]*ratelimit.Limiter,
+	cors *corsOrigins,
+	drain *drainTracker,
+	cfg *config.Config,
+) http.Handler {
+	authMW := auth.Middleware(authProvider, auditor)
+	if cfg.Auth.Provider == "oidc" || cfg.Auth.Provider == "mtls" {
+		// OIDC roles come from the IdP's groups, and mTLS roles from the
+		// client certificate, so a caller granted no role is denied rather
+		// than treated as a plain user. Other providers' tokens carry their
+		// roles explicitly.
+		authenticate, requireRole := authMW, auth.RequireAnyRole()
+		authMW = func(next http.Handler) http.Handler { return authenticate(requireRole(next)) }
+	}
+
+	// Prompt routes are rate-limited per principal, each with its own
+	// buckets and, optionally, its own limit; reads are not limited.
+	promptMW := func(name string) func(http.Handler) http.Handler {
+		rateMW := ratelimit.Middleware(limiters[name])
+		return func(next http.Handler) http.Handler { return authMW(rateMW(next)) }
+	}
+
+	// Prompts may be larger than other request bodies.
+	promptBody := cfg.Prompt.MaxBodyBytes
+
+	// Administrative routes additionally require the admin role.
+	requireAdmin := auth.RequireRole("admin")
+	adminMW := func(next http.Handler) http.Handler { return authMW(requireAdmin(next)) }
+
+	routes := []route{
+		// Health checks — unauthenticated.
+		{method: "GET", path: "/healthz", handler: handleHealthz,
+			summary: "Liveness probe", response: map[string]string{}},
+		{method: "GET", path: "/readyz", handler: readyzHandler(db, secretProvider),
+			summary: "Readiness probe; 503 when the database or secrets provider is unreachable", response: readinessReport{}},
+
+		// Gateway CRUD — authenticated.
+		{method: "GET", path: "/api/v1/gateways", handler: gw.List, mw: authMW,
+			summary: "List gateways",
+			query: append([]queryParam{
+				{"sort", "string", "One of name, enrolled_at, last_seen_at, status"},
+				{"order", "string", "asc or desc"},
+				{"deleted", "boolean", "List deleted gateways that can still be restored instead"},
+			}, filterParams...),
+			response: []model.Gateway{}},
+		{method: "POST", path: "/api/v1/gateways", handler: gw.Create, mw: authMW,
+			summary: "Register a gateway",
+			query:   []queryParam{{"probe", "boolean", "Health-check the endpoint before registering"}},
+			headers: []queryParam{{"Idempotency-Key", "string", "Repeated creates with the same key return the original gateway"}},
+			request: model.CreateGatewayRequest{}, status: http.StatusCreated, response: model.Gateway{}},
+		{method: "PATCH", path: "/api/v1/gateways", handler: gw.BulkUpdate, mw: authMW,
+			summary: "Apply one update to every gateway matching a label selector, atomically",
+			request: model.BulkUpdateGatewaysRequest{}, response: model.BulkUpdateResult{}},
+		{method: "GET", path: "/api/v1/gateways/{id}", handler: gw.Get, mw: authMW,
+			summary: "Get a gateway", response: model.Gateway{}},
+		{method: "PUT", path: "/api/v1/gateways/{id}", handler: gw.Update, mw: authMW,
+			summary: "Update a gateway", request: model.UpdateGatewayRequest{}, response: model.Gateway{}},
+		{method: "PATCH", path: "/api/v1/gateways/{id}", handler: gw.Patch, mw: authMW,
+			summary: "Merge-patch a gateway", request: model.PatchGatewayRequest{}, requestType: "application/merge-patch+json",
+			response: model.Gateway{}},
+		{method: "DELETE", path: "/api/v1/gateways/{id}", handler: gw.Delete, mw: authMW,
+			summary: "Delete a gateway; it can be restored until purged",
+			query: []queryParam{
+				{"purge", "boolean", "Remove the gateway for good instead"},
+				{"keep_secret", "boolean", "When purging, keep the secret Lobstertank stored for the gateway"},
+			},
+			status: http.StatusNoContent},
+		{method: "POST", path: "/api/v1/gateways/{id}/restore", handler: gw.Restore, mw: authMW,
+			summary: "Restore a deleted gateway", response: model.Gateway{}},
+
+		// Gateway actions.
+		{method: "POST", path: "/api/v1/gateways/health", handler: gw.HealthCheckAll, mw: authMW,
+			summary: "Health-check all gateways, or a filtered subset, in parallel",
+			query:   filterParams, response: []model.HealthCheckResult{}},
+		{method: "GET", path: "/api/v1/gateways/export", handler: gw.Export, mw: authMW,
+			summary: "Export every gateway as a YAML bundle", response: model.GatewayBundle{},
+			responseType: "application/yaml"},
+		{method: "POST", path: "/api/v1/gateways/import", handler: gw.Import, mw: authMW, maxBody: gateway.MaxImportBytes,
+			summary: "Create or update gateways from a bundle",
+			query:   []queryParam{{"dry_run", "boolean", "Report what would change without writing anything"}},
+			request: model.GatewayBundle{}, requestType: "application/yaml", response: model.ImportResult{}},
+		{method: "POST", path: "/api/v1/gateways/{id}/health", handler: gw.HealthCheck, mw: authMW,
+			summary: "Health-check a gateway", response: model.HealthCheckResult{}},
+		{method: "POST", path: "/api/v1/gateways/{id}/prompt", handler: gw.Prompt, mw: promptMW("prompt"), maxBody: promptBody,
+			summary: "Send a prompt to a gateway and relay its response",
+			request: model.PromptRequest{}, response: json.RawMessage{}},
+		{method: "POST", path: "/api/v1/gateways/{id}/verify", handler: gw.Verify, mw: authMW,
+			summary: "Run post-install verification checks", response: model.VerifyResult{}},
+		{method: "GET", path: "/api/v1/gateways/{id}/history", handler: gw.History, mw: authMW,
+			summary: "Status history, uptime, and the latest health checks",
+			query: []queryParam{
+				{"since", "string", "RFC 3339 time or Go duration; defaults to 24h"},
+				{"limit", "integer", "Number of latest health checks to return, 1 to 1000; defaults to 20"},
+			},
+			response: model.StatusHistory{}},
+		{method: "GET", path: "/api/v1/gateways/{id}/usage", handler: gw.Usage, mw: authMW,
+			summary:  "Token usage by model",
+			query:    []queryParam{{"since", "string", "RFC 3339 time or lookback such as 24h or 7d; defaults to 24h"}},
+			response: model.UsageReport{}},
+		{method: "GET", path: "/api/v1/gateways/{id}/circuit", handler: gw.Circuit, mw: authMW,
+			summary: "Circuit breaker state", response: model.CircuitState{}},
+		{method: "PUT", path: "/api/v1/gateways/{id}/maintenance", handler: gw.Maintenance, mw: authMW,
+			summary: "Enable or clear maintenance mode", request: model.MaintenanceRequest{}, response: model.Gateway{}},
+
+		// Gateway groups.
+		{method: "GET", path: "/api/v1/groups", handler: gw.ListGroups, mw: authMW,
+			summary: "List groups", response: []model.Group{}},
+		{method: "POST", path: "/api/v1/groups", handler: gw.CreateGroup, mw: authMW,
+			summary: "Create a group", request: model.CreateGroupRequest{}, status: http.StatusCreated, response: model.Group{}},
+		{method: "GET", path: "/api/v1/groups/{id}", handler: gw.GetGroup, mw: authMW,
+			summary: "Get a group", response: model.Group{}},
+		{method: "PUT", path: "/api/v1/groups/{id}", handler: gw.UpdateGroup, mw: authMW,
+			summary: "Update a group", request: model.UpdateGroupRequest{}, response: model.Group{}},
+		{method: "DELETE", path: "/api/v1/groups/{id}", handler: gw.DeleteGroup, mw: authMW,
+			summary: "Delete a group", status: http.StatusNoContent},
+
+		// Meta-agent — fan-out.
+		{method: "POST", path: "/api/v1/meta/fanout", handler: meta.FanOut, mw: promptMW("fanout"), maxBody: promptBody,
+			summary: "Send a prompt to several gateways concurrently",
+			query:   []queryParam{{"async", "boolean", "Run as a background job and return 202 with the job to poll"}},
+			request: metaagent.FanOutRequest{}, response: metaagent.FanOutResponse{}},
+		{method: "POST", path: "/api/v1/meta/fanout/stream", handler: meta.FanOutStream, mw: promptMW("fanout"), maxBody: promptBody,
+			summary: "Fan out a prompt and stream each result as Server-Sent Events",
+			request: metaagent.FanOutRequest{}, response: metaagent.GatewayResult{}, responseType: "text/event-stream"},
+		{method: "POST", path: "/api/v1/meta/compare", handler: meta.Compare, mw: promptMW("compare"), maxBody: promptBody,
+			summary: "Fan out a prompt and group gateways by identical answers",
+			request: metaagent.FanOutRequest{}, response: metaagent.CompareResponse{}},
+		{method: "POST", path: "/api/v1/meta/route", handler: meta.Route, mw: promptMW("route"), maxBody: promptBody,
+			summary: "Send a prompt to one matching gateway chosen by a routing strategy",
+			request: metaagent.RouteRequest{}, response: metaagent.RouteResponse{}},
+		{method: "POST", path: "/api/v1/meta/health", handler: meta.HealthSweep, mw: authMW,
+			summary: "Health-check the selected gateways now and report on the fleet",
+			request: metaagent.HealthSweepRequest{}, response: metaagent.HealthReport{}},
+		{method: "GET", path: "/api/v1/meta/usage", handler: gw.UsageSummary, mw: authMW,
+			summary:  "Token usage across gateways, by gateway and model",
+			query:    []queryParam{{"since", "string", "RFC 3339 time or lookback such as 24h or 7d; defaults to 24h"}},
+			response: model.UsageReport{}},
+		{method: "GET", path: "/api/v1/meta/jobs/{id}", handler: meta.GetJob, mw: authMW,
+			summary: "Get an asynchronous fan-out job and the results recorded so far", response: model.FanOutJob{}},
+		{method: "DELETE", path: "/api/v1/meta/jobs/{id}", handler: meta.DeleteJob, mw: authMW,
+			summary: "Cancel a fan-out job if running and delete it", status: http.StatusNoContent},
+
+		// Live gateway events.
+		{method: "GET", path: "/api/v1/events", handler: evts.Stream, mw: authMW,
+			summary:  "Stream gateway lifecycle events as Server-Sent Events",
+			response: events.Event{}, responseType: "text/event-stream"},
+
+		// Credentials.
+		{method: "POST", path: "/api/v1/auth/token", handler: tokens.IssueToken, mw: adminMW,
+			summary: "Issue a signed, expiring token for a subject (admin only)",
+			request: auth.IssueTokenRequest{}, status: http.StatusCreated, response: auth.IssueTokenResponse{}},
+		{method: "POST", path: "/api/v1/apikeys", handler: tokens.CreateAPIKey, mw: adminMW,
+			summary: "Create an API key; the key is returned only in this response (admin only)",
+			request: model.CreateAPIKeyRequest{}, status: http.StatusCreated, response: model.CreatedAPIKey{}},
+		{method: "GET", path: "/api/v1/apikeys", handler: tokens.ListAPIKeys, mw: adminMW,
+			summary: "List API keys, including revoked ones (admin only)", response: []model.APIKey{}},
+		{method: "DELETE", path: "/api/v1/apikeys/{id}", handler: tokens.RevokeAPIKey, mw: adminMW,
+			summary: "Revoke an API key (admin only)", status: http.StatusNoContent},
 
-	// Health check — unauthenticated.
-	mux.HandleFunc("GET /healthz", handleHealthz)
+		// Audit trail.
+		{method: "GET", path: "/api/v1/audit", handler: audits.Query, mw: adminMW,
+			summary: "Query persisted audit events, newest first (admin only)",
+			query: []queryParam{
+				{"action", "string", "Only events with this action, e.g. gateway.deleted"},
+				{"resource", "string", "Only events about this resource"},
+				{"since", "string", "RFC 3339 time; only events at or after it"},
+				{"until", "string", "RFC 3339 time; only events before it"},
+				{"limit", "integer", "Events per page, 1 to 1000; defaults to 100"},
+				{"cursor", "string", "next_cursor from the previous page"},
+			},
+			response: model.AuditPage{}},
 
-	// Gateway CRUD — authenticated.
-	mux.Handle("GET /api/v1/gateways", authMW(http.HandlerFunc(gw.List)))
-	mux.Handle("POST /api/v1/gateways", authMW(http.HandlerFunc(gw.Create)))
-	mux.Handle("GET /api/v1/gateways/{id}", authMW(http.HandlerFunc(gw.Get)))
-	mux.Handle("PUT /api/v1/gateways/{id}", authMW(http.HandlerFunc(gw.Update)))
-	mux.Handle("DELETE /api/v1/gateways/{id}", authMW(http.HandlerFunc(gw.Delete)))
+		// Diagnostics.
+		{method: "GET", path: "/api/v1/debug/requests", handler: drain.handleStatus, mw: adminMW,
+			summary:  "Count in-flight requests and report whether the server is draining (admin only)",
+			response: DrainStatus{}},
+		{method: "GET", path: "/api/v1/debug/store", handler: storeStatsHandler(db), mw: adminMW,
+			summary:  "Report call counts, errors, and latency of each data store operation (admin only)",
+			response: []store.OperationStats{}},
+		{method: "GET", path: "/api/v1/debug/ratelimit", handler: rateLimitStatsHandler(limiters), mw: adminMW,
+			summary:  "Report each rate-limited route's limit, tracked principals, and refused requests (admin only)",
+			response: map[string]ratelimit.Stats{}},
 
-	// Gateway actions.
-	mux.Handle("POST /api/v1/gateways/{id}/health", authMW(http.HandlerFunc(gw.HealthCheck)))
+		// Webhooks.
+		{method: "POST", path: "/api/v1/webhooks/test", handler: hooks.Test, mw: adminMW,
+			summary: "Send a synthetic status event to every configured webhook (admin only)", response: []webhook.TestResult{}},
+	}
 
-	// Meta-agent — fan-out.
-	mux.Handle("POST /api/v1/meta/fanout", authMW(http.HandlerFunc(meta.FanOut)))
+	for _, rt := range routes {
+		var h http.Handler = rt.handler
+		if rt.mw != nil {
+			h = rt.mw(h)
+		}
+		limit := rt.maxBody
+		if limit == 0 {
+			limit = cfg.Server.MaxBodyBytes
+		}
+		h = maxBodyMiddleware(limit)(h)
+		mux.Handle(rt.method+" "+rt.path, h)
+	}
+
+	// API description — unauthenticated, generated from the table above.
+	mux.Handle("GET /openapi.json", openAPIHandler(routes))
+
+	// CORS wraps the whole mux so preflight requests are answered before
+	// method routing and auth.
+	return corsMiddleware(cors)(requestIDMiddleware(mux))
 }
 
 func handleHealthz(w http.ResponseWriter, _ *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte(`{"status":"ok"}`))
+	httputil.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readinessTimeout bounds each dependency check behind /readyz.
+const readinessTimeout = 2 * time.Second
+
+// readinessReport is the /readyz response: an overall status plus one entry
+// per dependency.
+type readinessReport struct {
+	Status string                    `json:"status"` // "ok" or "unavailable"
+	Checks map[string]readinessCheck `json:"checks"`
+}
+
+type readinessCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// readyzHandler reports whether the server can serve traffic: the data store
+// and the secrets provider must both answer. The checks run concurrently,
+// each under its own timeout, so a hung dependency cannot hang the probe.
+func readyzHandler(db store.Store, sp secrets.Provider) http.HandlerFunc {
+	checks := map[string]struct {
+		ping func(context.Context) error
+		fail string // reported to the unauthenticated caller; details are logged
+	}{
+		"database": {db.Ping, "database unreachable"},
+		"secrets":  {sp.Ping, "secrets provider unreachable"},
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := readinessReport{Status: "ok", Checks: make(map[string]readinessCheck, len(checks))}
+		var (
+			mu sync.Mutex
+			wg sync.WaitGroup
+		)
+		for name, c := range checks {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+				defer cancel()
+
+				result := readinessCheck{Status: "ok"}
+				if err := c.ping(ctx); err != nil {
+					logging.LoggerFromContext(ctx).Warn("readiness check failed", "dependency", name, "error", err)
+					result = readinessCheck{Status: "unavailable", Error: c.fail}
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				report.Checks[name] = result
+				if result.Error != "" {
+					report.Status = "unavailable"
+				}
+			}()
+		}
+		wg.Wait()
+
+		status := http.StatusOK
+		if report.Status != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+		httputil.WriteJSON(w, status, report)
+	}
+}
+
+// rateLimitStatsHandler reports the state of each rate-limited route's
+// limiter.
+func rateLimitStatsHandler(limiters map[string]*ratelimit.Limiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		stats := make(map[string]ratelimit.Stats, len(limiters))
+		for name, l := range limiters {
+			stats[name] = l.Stats()
+		}
+		httputil.WriteJSON(w, http.StatusOK, stats)
+	}
+}
+
+// storeStatsHandler reports the data store's per-operation statistics, or
+// none when the store keeps none.
+func storeStatsHandler(db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		stats := []store.OperationStats{}
+		if sr, ok := db.(store.StatsReporter); ok {
+			stats = sr.StoreStats()
+		}
+		httputil.WriteJSON(w, http.StatusOK, stats)
+	}
 }
@@ -2,64 +2,161 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/AdamPippert/Lobstertank/internal/audit"
 	"github.com/AdamPippert/Lobstertank/internal/auth"
+	"github.com/AdamPippert/Lobstertank/internal/clock"
 	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/events"
 	"github.com/AdamPippert/Lobstertank/internal/gateway"
 	"github.com/AdamPippert/Lobstertank/internal/metaagent"
+	"github.com/AdamPippert/Lobstertank/internal/monitor"
+	"github.com/AdamPippert/Lobstertank/internal/ratelimit"
+	"github.com/AdamPippert/Lobstertank/internal/secrets"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+	"github.com/AdamPippert/Lobstertank/internal/webhook"
 )
 
 // Dependencies holds all injected service dependencies for the server.
 type Dependencies struct {
 	Config        *config.Config
+	Store         store.Store
+	Secrets       secrets.Provider
 	Registry      *gateway.Registry
 	ClientFactory *gateway.ClientFactory
+	Prober        *gateway.Prober
 	MetaAgent     *metaagent.Agent
+	Jobs          *metaagent.Jobs
+	Monitor       *monitor.Monitor // optional; nil disables background probing
+	Webhooks      *webhook.Dispatcher
+	Events        *events.Hub
 	AuthProvider  auth.Provider
+	ClientCerts   *auth.MTLSProvider // optional; verifies client certificates on the TLS listener
 	Auditor       *audit.Logger
+	Clock         clock.Clock
+	LogLevel      *slog.LevelVar // optional; set by Reload
 }
 
 // Server wraps the net/http.Server with application-specific setup.
 type Server struct {
 	httpServer *http.Server
 	deps       Dependencies
+	drain      *drainTracker
+
+	// Settings Reload can change; see reload.go.
+	applied  *config.Config // configuration in effect
+	cors     *corsOrigins
+	limiters map[string]*ratelimit.Limiter // by name in config.RateLimitRoutes
 }
 
 // New creates a configured Server ready to run.
 func New(deps Dependencies) *Server {
 	mux := http.NewServeMux()
 
-	gatewayHandler := gateway.NewHandler(deps.Registry, deps.ClientFactory, deps.Auditor)
-	metaHandler := metaagent.NewHandler(deps.MetaAgent)
+	gatewayHandler := gateway.NewHandler(deps.Registry, deps.ClientFactory, deps.Prober, deps.Auditor, deps.Config.Prompt)
+	metaHandler := metaagent.NewHandler(deps.MetaAgent, deps.Jobs)
+	webhookHandler := webhook.NewHandler(deps.Webhooks, deps.Auditor)
+	eventHandler := events.NewHandler(deps.Events)
+	authHandler := auth.NewHandler(deps.AuthProvider, deps.Auditor, deps.Config.Auth.HMACMaxTTL)
+	auditHandler := audit.NewHandler(deps.Auditor)
+
+	limiters := make(map[string]*ratelimit.Limiter, len(config.RateLimitRoutes))
+	for _, name := range config.RateLimitRoutes {
+		rl := deps.Config.RateLimit.For(name)
+		limiters[name] = ratelimit.New(rl.RPS, rl.Burst, deps.Clock)
+	}
+	cors := newCORSOrigins(deps.Config.Server.CORSAllowedOrigins)
+
+	drain := &drainTracker{}
+	handler := registerRoutes(mux, gatewayHandler, metaHandler, webhookHandler, eventHandler, authHandler, auditHandler, deps.Store, deps.Secrets, deps.AuthProvider, deps.Auditor, limiters, cors, drain, deps.Config)
 
-	registerRoutes(mux, gatewayHandler, metaHandler, deps.AuthProvider)
+	srvCfg := deps.Config.Server
+	addr := fmt.Sprintf("%s:%d", srvCfg.Host, srvCfg.Port)
 
-	addr := fmt.Sprintf("%s:%d", deps.Config.Server.Host, deps.Config.Server.Port)
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if deps.ClientCerts != nil {
+		deps.ClientCerts.ConfigureTLS(tlsConfig)
+	}
 
 	return &Server{
 		httpServer: &http.Server{
 			Addr:              addr,
-			Handler:           mux,
-			ReadHeaderTimeout: 10 * time.Second,
-			ReadTimeout:       30 * time.Second,
-			WriteTimeout:      60 * time.Second,
-			IdleTimeout:       120 * time.Second,
+			Handler:           drain.middleware(handler),
+			ReadHeaderTimeout: srvCfg.ReadHeaderTimeout,
+			ReadTimeout:       srvCfg.ReadTimeout,
+			WriteTimeout:      srvCfg.WriteTimeout,
+			IdleTimeout:       srvCfg.IdleTimeout,
+			MaxHeaderBytes:    srvCfg.MaxHeaderBytes,
+			TLSConfig:         tlsConfig,
 		},
-		deps: deps,
+		deps:     deps,
+		drain:    drain,
+		applied:  deps.Config,
+		cors:     cors,
+		limiters: limiters,
 	}
 }
 
 // Run starts the HTTP server and blocks until the context is canceled.
 func (s *Server) Run(ctx context.Context) error {
+	// Background workers get their own context so they stop on shutdown and
+	// on listener failure alike; Run waits for them before returning.
+	bgCtx, stopBackground := context.WithCancel(ctx)
+	var bgWG sync.WaitGroup
+	defer bgWG.Wait()
+	defer stopBackground()
+
+	if s.deps.Monitor != nil {
+		bgWG.Add(1)
+		go func() {
+			defer bgWG.Done()
+			s.deps.Monitor.Run(bgCtx)
+		}()
+	}
+
+	bgWG.Add(6)
+	go func() {
+		defer bgWG.Done()
+		s.deps.Registry.Run(bgCtx)
+	}()
+	go func() {
+		defer bgWG.Done()
+		s.deps.Registry.FollowChanges(bgCtx)
+	}()
+	go func() {
+		defer bgWG.Done()
+		s.deps.Webhooks.Run(bgCtx)
+	}()
+	go func() {
+		defer bgWG.Done()
+		s.deps.Auditor.Run(bgCtx)
+	}()
+	go func() {
+		defer bgWG.Done()
+		s.deps.Jobs.Run(bgCtx)
+	}()
+	go func() {
+		defer bgWG.Done()
+		s.deps.Events.Run(bgCtx)
+	}()
+
 	errCh := make(chan error, 1)
 	go func() {
-		slog.Info("lobstertank server starting", "addr", s.httpServer.Addr)
-		if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if srvCfg := s.deps.Config.Server; srvCfg.TLSCertFile != "" {
+			slog.Info("lobstertank server starting", "addr", s.httpServer.Addr, "tls", true)
+			err = s.httpServer.ListenAndServeTLS(srvCfg.TLSCertFile, srvCfg.TLSKeyFile)
+		} else {
+			slog.Info("lobstertank server starting", "addr", s.httpServer.Addr, "tls", false)
+			err = s.httpServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			errCh <- err
 		}
 		close(errCh)
@@ -67,16 +164,18 @@ func (s *Server) Run(ctx context.Context) error {
 
 	select {
 	case <-ctx.Done():
-		slog.Info("shutdown signal received, draining connections")
+		s.drain.begin()
+		slog.Info("shutdown signal received, draining connections", "active", s.drain.status().ActiveRequests)
 	case err := <-errCh:
 		return fmt.Errorf("server error: %w", err)
 	}
 
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
+	go s.drain.logUntilDone(shutdownCtx)
 
 	if err := s.httpServer.Shutdown(shutdownCtx); err != nil {
-		return fmt.Errorf("graceful shutdown failed: %w", err)
+		return fmt.Errorf("graceful shutdown failed with %d requests active: %w", s.drain.status().ActiveRequests, err)
 	}
 
 	slog.Info("server stopped gracefully")
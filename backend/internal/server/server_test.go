@@ -0,0 +1,432 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/auth"
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/events"
+	"github.com/AdamPippert/Lobstertank/internal/gateway"
+	"github.com/AdamPippert/Lobstertank/internal/metaagent"
+	"github.com/AdamPippert/Lobstertank/internal/secrets"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+	"github.com/AdamPippert/Lobstertank/internal/transport"
+	"github.com/AdamPippert/Lobstertank/internal/webhook"
+)
+
+// testToken is the shared-secret bearer token test servers accept.
+const testToken = "test-token"
+
+// newTestServer builds a server the way main does, configured from env on
+// top of defaults suited to tests: a loopback listener on a free port, an
+// in-memory SQLite store, no background monitor, and shared-secret auth
+// with testToken.
+func newTestServer(t *testing.T, env map[string]string) *Server {
+	t.Helper()
+	settings := map[string]string{
+		"LT_SERVER_HOST":       "127.0.0.1",
+		"LT_SERVER_PORT":       strconv.Itoa(freePort(t)),
+		"LT_DB_DSN":            ":memory:",
+		"LT_MONITOR_ENABLED":   "false",
+		"LT_AUTH_TOKEN_SECRET": testToken,
+	}
+	for k, v := range env {
+		settings[k] = v
+	}
+	for k, v := range settings {
+		t.Setenv(k, v)
+	}
+	cfg, err := config.LoadFile("")
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	clk := clock.Real()
+	auditor := audit.New(cfg.Audit)
+	sp, err := secrets.NewProvider(cfg.Secrets)
+	if err != nil {
+		t.Fatalf("secrets provider: %v", err)
+	}
+	db, err := store.New(cfg.Database)
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	auditor.SetStore(db)
+
+	authProvider, err := auth.NewProvider(cfg.Auth, sp, clk)
+	if err != nil {
+		t.Fatalf("auth provider: %v", err)
+	}
+	clientCerts, _ := authProvider.(*auth.MTLSProvider)
+
+	registry := gateway.NewRegistry(db, auditor, clk, cfg.Health.HistoryRetention, sp, cfg.Secrets.GatewayPrefix)
+	hub := events.NewHub()
+	registry.SetEventHub(hub)
+	webhooks := webhook.New(cfg.Webhook, clk)
+	registry.AddNotifier(webhooks)
+	cf := gateway.NewClientFactory(transport.NewProvider(cfg.Transport), sp, cfg.Retry, cfg.Breaker, clk)
+	prober := gateway.NewProber(registry, cf, cfg.Health.Concurrency, cfg.Health.Timeout)
+	agent := metaagent.New(registry, cf, prober, auditor)
+
+	return New(Dependencies{
+		Config:        cfg,
+		Store:         db,
+		Secrets:       sp,
+		Registry:      registry,
+		ClientFactory: cf,
+		Prober:        prober,
+		MetaAgent:     agent,
+		Jobs:          metaagent.NewJobs(agent, db, clk, cfg.FanOut),
+		Webhooks:      webhooks,
+		Events:        hub,
+		AuthProvider:  auth.NewAPIKeyProvider(db, clk, authProvider),
+		ClientCerts:   clientCerts,
+		Auditor:       auditor,
+		Clock:         clk,
+	})
+}
+
+// freePort returns a loopback TCP port nothing is listening on.
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("find free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// startServer runs s until the test ends, then checks that it shut down
+// gracefully. It returns once s answers /healthz through client over
+// scheme.
+func startServer(t *testing.T, s *Server, scheme string, client *http.Client) string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Run: %v", err)
+		}
+	})
+
+	base := scheme + "://" + s.httpServer.Addr
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := client.Get(base + "/healthz")
+		if err == nil {
+			resp.Body.Close()
+			return base
+		}
+		select {
+		case err := <-done:
+			t.Fatalf("server exited before serving: %v", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server not serving at %s: %v", base, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// writeSelfSignedCert writes a self-signed certificate for 127.0.0.1 and
+// its key to dir, returning their paths and a pool trusting the certificate.
+func writeSelfSignedCert(t *testing.T, dir string) (certFile, keyFile string, pool *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "lobstertank test server"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	pool = x509.NewCertPool()
+	pool.AddCert(cert)
+	return certFile, keyFile, pool
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func TestRunServesPlainHTTPWithoutTLS(t *testing.T) {
+	s := newTestServer(t, nil)
+	base := startServer(t, s, "http", http.DefaultClient)
+
+	resp, err := http.Get(base + "/healthz")
+	if err != nil {
+		t.Fatalf("GET /healthz: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+	if resp.TLS != nil {
+		t.Error("response came over TLS")
+	}
+}
+
+func TestServerTimeoutsFromConfig(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"LT_SERVER_READ_HEADER_TIMEOUT": "100ms",
+		"LT_SERVER_READ_TIMEOUT":        "7s",
+		"LT_SERVER_WRITE_TIMEOUT":       "0s",
+		"LT_SERVER_IDLE_TIMEOUT":        "9s",
+	})
+	hs := s.httpServer
+	if hs.ReadHeaderTimeout != 100*time.Millisecond || hs.ReadTimeout != 7*time.Second ||
+		hs.WriteTimeout != 0 || hs.IdleTimeout != 9*time.Second {
+		t.Errorf("timeouts = %v/%v/%v/%v, want 100ms/7s/0s/9s",
+			hs.ReadHeaderTimeout, hs.ReadTimeout, hs.WriteTimeout, hs.IdleTimeout)
+	}
+
+	// A client that never finishes its headers is cut off.
+	startServer(t, s, "http", http.DefaultClient)
+	conn, err := net.Dial("tcp", hs.Addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET /healthz HTTP/1.1\r\n"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Errorf("connection with unfinished headers was not closed by the server: %v", err)
+	}
+}
+
+func TestRunServesHTTPSWithCert(t *testing.T) {
+	certFile, keyFile, pool := writeSelfSignedCert(t, t.TempDir())
+	s := newTestServer(t, map[string]string{
+		"LT_SERVER_TLS_CERT": certFile,
+		"LT_SERVER_TLS_KEY":  keyFile,
+	})
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	base := startServer(t, s, "https", client)
+	defer client.CloseIdleConnections()
+
+	req, err := http.NewRequest(http.MethodGet, base+"/api/v1/gateways", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("GET /api/v1/gateways over TLS: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+	if resp.TLS == nil || resp.TLS.Version < tls.VersionTLS12 {
+		t.Errorf("connection state = %+v, want TLS 1.2 or later", resp.TLS)
+	}
+
+	// Protocol versions before TLS 1.2 are refused.
+	old := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:    pool,
+		MaxVersion: tls.VersionTLS11,
+	}}}
+	defer old.CloseIdleConnections()
+	if resp, err := old.Get(base + "/healthz"); err == nil {
+		resp.Body.Close()
+		t.Error("TLS 1.1 handshake succeeded")
+	}
+
+	// The listener speaks only TLS.
+	resp, err = http.Get("http://" + s.httpServer.Addr + "/healthz")
+	if err != nil {
+		t.Fatalf("plain HTTP request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("plain HTTP request to the TLS listener: status = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestNewRequiresClientCertsWithMTLS(t *testing.T) {
+	certFile, keyFile, _ := writeSelfSignedCert(t, t.TempDir())
+	s := newTestServer(t, map[string]string{
+		"LT_SERVER_TLS_CERT":   certFile,
+		"LT_SERVER_TLS_KEY":    keyFile,
+		"LT_AUTH_PROVIDER":     "mtls",
+		"LT_AUTH_MTLS_CA_FILE": certFile,
+	})
+
+	c := s.httpServer.TLSConfig
+	if c == nil || c.ClientAuth != tls.RequireAndVerifyClientCert || c.ClientCAs == nil {
+		t.Fatalf("TLS config = %+v, want client certificates required against the CA bundle", c)
+	}
+}
+
+func TestLoadRequiresTLSWithMTLS(t *testing.T) {
+	certFile, _, _ := writeSelfSignedCert(t, t.TempDir())
+	t.Setenv("LT_AUTH_PROVIDER", "mtls")
+	t.Setenv("LT_AUTH_MTLS_CA_FILE", certFile)
+
+	if _, err := config.LoadFile(""); err == nil || !strings.Contains(err.Error(), "LT_SERVER_TLS_CERT") {
+		t.Errorf("LoadFile without a server certificate: err = %v, want LT_SERVER_TLS_CERT required", err)
+	}
+}
+
+func TestReadyzReflectsStoreConnectivity(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	probe := func(path string) (int, readinessReport) {
+		rec := serve(s, http.MethodGet, path, "", "")
+		var report readinessReport
+		if path == "/readyz" {
+			if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+				t.Fatalf("decode %s: %v", path, err)
+			}
+		}
+		return rec.Code, report
+	}
+
+	if code, report := probe("/readyz"); code != http.StatusOK || report.Checks["database"].Status != "ok" {
+		t.Fatalf("healthy store: status %d, report %+v; want 200 with the database ok", code, report)
+	}
+
+	s.deps.Store.Close()
+	code, report := probe("/readyz")
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("closed store: status %d, want 503", code)
+	}
+	if db := report.Checks["database"]; db.Status != "unavailable" || db.Error != "database unreachable" {
+		t.Errorf("closed store: database check = %+v, want unavailable", db)
+	}
+	if report.Checks["secrets"].Status != "ok" {
+		t.Errorf("closed store: secrets check = %+v, want ok", report.Checks["secrets"])
+	}
+
+	// Liveness does not depend on the database.
+	if code, _ := probe("/healthz"); code != http.StatusOK {
+		t.Errorf("/healthz with a closed store: status %d, want 200", code)
+	}
+}
+
+// serve sends a request through s's handler as the holder of bearer token,
+// if any.
+func serve(s *Server, method, path, token, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestIssueTokenRequiresAdmin(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"LT_AUTH_PROVIDER": "hmac",
+		"LT_AUTH_HMAC_KEY": base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")),
+	})
+
+	// The shared secret is an admin and can mint tokens.
+	rec := serve(s, http.MethodPost, "/api/v1/auth/token", testToken, `{"subject":"alice","roles":["viewer"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("mint as admin: status = %d, want 201: %s", rec.Code, rec.Body)
+	}
+	var minted auth.IssueTokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&minted); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if rec := serve(s, http.MethodGet, "/api/v1/gateways", minted.Token, ""); rec.Code != http.StatusOK {
+		t.Errorf("read with minted token: status = %d, want 200", rec.Code)
+	}
+	if rec := serve(s, http.MethodPost, "/api/v1/auth/token", minted.Token, `{"subject":"mallory","roles":["admin"]}`); rec.Code != http.StatusForbidden {
+		t.Errorf("mint as viewer: status = %d, want 403", rec.Code)
+	}
+	if rec := serve(s, http.MethodPost, "/api/v1/auth/token", "", `{"subject":"mallory"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("mint anonymously: status = %d, want 401", rec.Code)
+	}
+}
+
+func TestWebhookTestRequiresAdmin(t *testing.T) {
+	var hits atomic.Int32
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(hook.Close)
+	s := newTestServer(t, map[string]string{
+		"LT_WEBHOOK_1_URL": hook.URL,
+		"LT_AUTH_PROVIDER": "hmac",
+		"LT_AUTH_HMAC_KEY": base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")),
+	})
+	rec := serve(s, http.MethodPost, "/api/v1/auth/token", testToken, `{"subject":"alice","roles":["user"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("mint: status = %d, want 201: %s", rec.Code, rec.Body)
+	}
+	var minted auth.IssueTokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&minted); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if rec := serve(s, http.MethodPost, "/api/v1/webhooks/test", minted.Token, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("as a user: status = %d, want 403", rec.Code)
+	}
+	if n := hits.Load(); n != 0 {
+		t.Fatalf("a user's request reached the webhook %d times", n)
+	}
+	if rec := serve(s, http.MethodPost, "/api/v1/webhooks/test", testToken, ""); rec.Code != http.StatusOK {
+		t.Errorf("as an admin: status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("an admin's request reached the webhook %d times, want 1", n)
+	}
+}
@@ -0,0 +1,629 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/store/migrations"
+)
+
+// BackupVersion is the current version of the backup document format.
+const BackupVersion = 1
+
+// ErrRestoreConflict is returned when a restore meets records that already
+// exist and differ, and the conflict policy is ConflictFail.
+var ErrRestoreConflict = errors.New("backup conflicts with existing records")
+
+// Backup is a snapshot of a store's contents. It is read and restored
+// through the Store interface, so a backup taken with one driver can be
+// restored with another. Idempotency keys, fan-out jobs, and token usage
+// counters are not included: the first two are short-lived, and usage can
+// only be read back summed. API keys are included by hash, so clients keep
+// working after a restore; the secrets themselves are never stored.
+type Backup struct {
+	Version       int       `json:"version"`
+	SchemaVersion int       `json:"schema_version"` // of the database backed up, for reference
+	CreatedAt     time.Time `json:"created_at"`
+
+	Gateways      []model.Gateway           `json:"gateways"` // live and deleted
+	Groups        []model.Group             `json:"groups"`
+	Secrets       map[string]string         `json:"secrets"` // as stored by the builtin provider
+	StatusHistory []model.StatusTransition  `json:"status_history"`
+	HealthChecks  []model.HealthCheckResult `json:"health_checks"`
+	AuditEvents   []model.AuditEvent        `json:"audit_events"` // oldest first
+	APIKeys       []BackupAPIKey            `json:"api_keys"`     // oldest first
+}
+
+// BackupAPIKey is an API key as a backup holds it, with the hash that the
+// key's JSON form leaves out.
+type BackupAPIKey struct {
+	model.APIKey
+	Hash string `json:"hash"`
+}
+
+// auditPageSize is how many audit events a backup reads at a time.
+const auditPageSize = 1000
+
+// TakeBackup reads everything a Backup holds from s in one transaction, so
+// the snapshot is consistent while the store stays in use.
+func TakeBackup(ctx context.Context, s Store, now time.Time) (*Backup, error) {
+	b := &Backup{
+		Version:       BackupVersion,
+		SchemaVersion: migrations.Latest(),
+		CreatedAt:     now.UTC(),
+	}
+	err := s.InTx(ctx, func(tx Store) error {
+		var err error
+		if b.Gateways, err = listAllGateways(ctx, tx); err != nil {
+			return err
+		}
+		if b.Groups, err = tx.ListGroups(ctx); err != nil {
+			return fmt.Errorf("list groups: %w", err)
+		}
+		if b.Secrets, err = tx.ListSecrets(ctx); err != nil {
+			return fmt.Errorf("list secrets: %w", err)
+		}
+
+		b.StatusHistory = []model.StatusTransition{}
+		b.HealthChecks = []model.HealthCheckResult{}
+		for _, gw := range b.Gateways {
+			transitions, err := tx.ListStatusTransitions(ctx, gw.ID, time.Time{})
+			if err != nil {
+				return fmt.Errorf("list status history of %s: %w", gw.ID, err)
+			}
+			b.StatusHistory = append(b.StatusHistory, transitions...)
+
+			checks, err := tx.ListHealthChecks(ctx, gw.ID, math.MaxInt32)
+			if err != nil {
+				return fmt.Errorf("list health checks of %s: %w", gw.ID, err)
+			}
+			slices.Reverse(checks) // oldest first, as they are restored
+			b.HealthChecks = append(b.HealthChecks, checks...)
+		}
+
+		if b.AuditEvents, err = listAllAuditEvents(ctx, tx); err != nil {
+			return err
+		}
+
+		keys, err := tx.ListAPIKeys(ctx)
+		if err != nil {
+			return fmt.Errorf("list api keys: %w", err)
+		}
+		b.APIKeys = make([]BackupAPIKey, len(keys))
+		for i, k := range keys {
+			b.APIKeys[i] = BackupAPIKey{APIKey: k, Hash: k.Hash}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func listAllGateways(ctx context.Context, s Store) ([]model.Gateway, error) {
+	live, err := s.ListGateways(ctx, model.GatewayFilter{}, model.ListSort{})
+	if err != nil {
+		return nil, fmt.Errorf("list gateways: %w", err)
+	}
+	deleted, err := s.ListDeletedGateways(ctx, model.GatewayFilter{}, model.ListSort{})
+	if err != nil {
+		return nil, fmt.Errorf("list deleted gateways: %w", err)
+	}
+	return append(live, deleted...), nil
+}
+
+// listAllAuditEvents pages through the audit log and returns it oldest
+// first.
+func listAllAuditEvents(ctx context.Context, s Store) ([]model.AuditEvent, error) {
+	events := []model.AuditEvent{}
+	q := model.AuditQuery{Limit: auditPageSize}
+	for {
+		page, err := s.ListAuditEvents(ctx, q)
+		if err != nil {
+			return nil, fmt.Errorf("list audit events: %w", err)
+		}
+		events = append(events, page...)
+		if len(page) < auditPageSize {
+			break
+		}
+		q.BeforeID = page[len(page)-1].ID
+	}
+	slices.Reverse(events)
+	return events, nil
+}
+
+// ConflictPolicy decides what a restore does with a record that already
+// exists in the store and differs from the backup's.
+type ConflictPolicy string
+
+// Conflict policies.
+const (
+	ConflictFail      ConflictPolicy = "fail"      // restore nothing
+	ConflictSkip      ConflictPolicy = "skip"      // keep the existing record
+	ConflictOverwrite ConflictPolicy = "overwrite" // replace it with the backup's
+)
+
+// RestoreResult reports what a restore did, or would do on a dry run.
+type RestoreResult struct {
+	DryRun   bool          `json:"dry_run"`
+	Gateways RestoreCounts `json:"gateways"`
+	Groups   RestoreCounts `json:"groups"`
+	Secrets  RestoreCounts `json:"secrets"`
+	APIKeys  RestoreCounts `json:"api_keys"`
+
+	// History rows and audit events added. Rows already present are not
+	// added again.
+	StatusHistory int `json:"status_history"`
+	HealthChecks  int `json:"health_checks"`
+	AuditEvents   int `json:"audit_events"`
+
+	// Conflicts names every conflicting record, e.g. "gateway <id> (<name>)".
+	Conflicts []string `json:"conflicts"`
+}
+
+// RestoreCounts counts the records of one kind by what a restore did with
+// them.
+type RestoreCounts struct {
+	Created     int `json:"created"`
+	Overwritten int `json:"overwritten"`
+	Skipped     int `json:"skipped"`   // conflicting records kept as they are
+	Unchanged   int `json:"unchanged"` // already identical to the backup's
+}
+
+// Restore writes a backup into s. Gateways and groups match existing ones
+// by ID, or by name when another one holds the name (for gateways, within
+// the same organization); secrets match by ref, and API keys by ID. Records identical to the
+// backup's are left alone, and differing ones are handled by policy:
+// overwriting a gateway replaces it along with its history. History and
+// audit events are added for the gateways the restore writes, skipping audit
+// events the store already holds.
+//
+// Everything is written in one transaction, so a failed restore leaves the
+// store as it was. On a dry run nothing is written and the result describes
+// what would happen. With ConflictFail, a restore meeting any conflict
+// writes nothing and returns the result with ErrRestoreConflict.
+func Restore(ctx context.Context, s Store, b *Backup, policy ConflictPolicy, dryRun bool) (*RestoreResult, error) {
+	if b.Version != BackupVersion {
+		return nil, fmt.Errorf("unsupported backup version %d (expected %d)", b.Version, BackupVersion)
+	}
+	switch policy {
+	case ConflictFail, ConflictSkip, ConflictOverwrite:
+	default:
+		return nil, fmt.Errorf("unknown conflict policy %q", policy)
+	}
+
+	if dryRun {
+		p, err := planRestore(ctx, s, b, policy)
+		if err != nil {
+			return nil, err
+		}
+		p.result.DryRun = true
+		return p.result, nil
+	}
+
+	var result *RestoreResult
+	err := s.InTx(ctx, func(tx Store) error {
+		p, err := planRestore(ctx, tx, b, policy)
+		if err != nil {
+			return err
+		}
+		result = p.result
+		if policy == ConflictFail && len(result.Conflicts) > 0 {
+			return fmt.Errorf("%w: %d conflicting record(s)", ErrRestoreConflict, len(result.Conflicts))
+		}
+		return p.apply(ctx, tx, b)
+	})
+	return result, err
+}
+
+// restorePlan lists the writes a restore makes.
+type restorePlan struct {
+	result *RestoreResult
+
+	purgeGateways []string         // existing gateways being overwritten
+	gateways      []*model.Gateway // backup gateways to create
+	deleteGroups  []string
+	groups        []*model.Group
+	regroup       []*model.Group // groups kept that lose purged members
+	secrets       []string       // refs to put
+	deleteAPIKeys []string
+	apiKeys       []*BackupAPIKey
+	auditEvents   []int           // indexes into the backup's events
+	present       map[string]bool // gateway IDs in the store once restored
+}
+
+func planRestore(ctx context.Context, s Store, b *Backup, policy ConflictPolicy) (*restorePlan, error) {
+	p := &restorePlan{
+		result:  &RestoreResult{Conflicts: []string{}},
+		present: make(map[string]bool),
+	}
+
+	existing, err := listAllGateways(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*model.Gateway, len(existing))
+	type orgName struct{ org, name string }
+	liveByName := make(map[orgName]*model.Gateway, len(existing))
+	for i := range existing {
+		gw := &existing[i]
+		byID[gw.ID] = gw
+		if gw.DeletedAt == nil {
+			liveByName[orgName{gw.OrgID, gw.Name}] = gw
+		}
+		p.present[gw.ID] = true
+	}
+
+	for i := range b.Gateways {
+		gw := &b.Gateways[i]
+		same := byID[gw.ID]
+		var holder *model.Gateway // another live gateway holding the name
+		if other := liveByName[orgName{gw.OrgID, gw.Name}]; gw.DeletedAt == nil && other != nil && other.ID != gw.ID {
+			holder = other
+		}
+
+		switch {
+		case same == nil && holder == nil:
+			p.result.Gateways.Created++
+			p.gateways = append(p.gateways, gw)
+			p.present[gw.ID] = true
+			continue
+		case holder == nil && gatewaysEqual(same, gw):
+			p.result.Gateways.Unchanged++
+			continue
+		}
+
+		p.result.Conflicts = append(p.result.Conflicts, fmt.Sprintf("gateway %s (%s)", gw.ID, gw.Name))
+		if policy != ConflictOverwrite {
+			p.result.Gateways.Skipped++
+			continue
+		}
+		p.result.Gateways.Overwritten++
+		for _, old := range []*model.Gateway{same, holder} {
+			if old != nil {
+				p.purgeGateways = append(p.purgeGateways, old.ID)
+				delete(p.present, old.ID)
+			}
+		}
+		p.gateways = append(p.gateways, gw)
+		p.present[gw.ID] = true
+	}
+
+	if err := p.planGroups(ctx, s, b, policy); err != nil {
+		return nil, err
+	}
+	if err := p.planSecrets(ctx, s, b, policy); err != nil {
+		return nil, err
+	}
+	if err := p.planAPIKeys(ctx, s, b, policy); err != nil {
+		return nil, err
+	}
+
+	restored := make(map[string]bool, len(p.gateways))
+	for _, gw := range p.gateways {
+		restored[gw.ID] = true
+	}
+	for _, t := range b.StatusHistory {
+		if restored[t.GatewayID] {
+			p.result.StatusHistory++
+		}
+	}
+	for _, c := range b.HealthChecks {
+		if restored[c.GatewayID] {
+			p.result.HealthChecks++
+		}
+	}
+
+	events, err := listAllAuditEvents(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[model.AuditEvent]bool, len(events))
+	for _, e := range events {
+		seen[auditKey(e)] = true
+	}
+	for i, e := range b.AuditEvents {
+		if !seen[auditKey(e)] {
+			p.auditEvents = append(p.auditEvents, i)
+		}
+	}
+	p.result.AuditEvents = len(p.auditEvents)
+	return p, nil
+}
+
+func (p *restorePlan) planGroups(ctx context.Context, s Store, b *Backup, policy ConflictPolicy) error {
+	existing, err := s.ListGroups(ctx)
+	if err != nil {
+		return fmt.Errorf("list groups: %w", err)
+	}
+	byID := make(map[string]*model.Group, len(existing))
+	byName := make(map[string]*model.Group, len(existing))
+	for i := range existing {
+		byID[existing[i].ID] = &existing[i]
+		byName[existing[i].Name] = &existing[i]
+	}
+	replaced := make(map[string]bool, len(existing))
+
+	for i := range b.Groups {
+		g := &b.Groups[i]
+		same := byID[g.ID]
+		var holder *model.Group
+		if other := byName[g.Name]; other != nil && other.ID != g.ID {
+			holder = other
+		}
+
+		switch {
+		case same == nil && holder == nil:
+			p.result.Groups.Created++
+			p.groups = append(p.groups, g)
+			continue
+		case holder == nil && groupsEqual(same, g):
+			p.result.Groups.Unchanged++
+			continue
+		}
+
+		p.result.Conflicts = append(p.result.Conflicts, fmt.Sprintf("group %s (%s)", g.ID, g.Name))
+		if policy != ConflictOverwrite {
+			p.result.Groups.Skipped++
+			continue
+		}
+		p.result.Groups.Overwritten++
+		for _, old := range []*model.Group{same, holder} {
+			if old != nil {
+				p.deleteGroups = append(p.deleteGroups, old.ID)
+				replaced[old.ID] = true
+			}
+		}
+		p.groups = append(p.groups, g)
+	}
+
+	// Purging a gateway drops it from its groups; put overwritten gateways
+	// back into the groups the restore keeps.
+	for i := range existing {
+		g := &existing[i]
+		if !replaced[g.ID] && slices.ContainsFunc(g.GatewayIDs, p.purged) {
+			p.regroup = append(p.regroup, g)
+		}
+	}
+	return nil
+}
+
+func (p *restorePlan) planSecrets(ctx context.Context, s Store, b *Backup, policy ConflictPolicy) error {
+	existing, err := s.ListSecrets(ctx)
+	if err != nil {
+		return fmt.Errorf("list secrets: %w", err)
+	}
+
+	refs := make([]string, 0, len(b.Secrets))
+	for ref := range b.Secrets {
+		refs = append(refs, ref)
+	}
+	slices.Sort(refs)
+	for _, ref := range refs {
+		value, ok := existing[ref]
+		switch {
+		case !ok:
+			p.result.Secrets.Created++
+			p.secrets = append(p.secrets, ref)
+		case value == b.Secrets[ref]:
+			p.result.Secrets.Unchanged++
+		default:
+			p.result.Conflicts = append(p.result.Conflicts, "secret "+ref)
+			if policy != ConflictOverwrite {
+				p.result.Secrets.Skipped++
+				continue
+			}
+			p.result.Secrets.Overwritten++
+			p.secrets = append(p.secrets, ref)
+		}
+	}
+	return nil
+}
+
+func (p *restorePlan) planAPIKeys(ctx context.Context, s Store, b *Backup, policy ConflictPolicy) error {
+	existing, err := s.ListAPIKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("list api keys: %w", err)
+	}
+	byID := make(map[string]*model.APIKey, len(existing))
+	for i := range existing {
+		byID[existing[i].ID] = &existing[i]
+	}
+
+	for i := range b.APIKeys {
+		k := &b.APIKeys[i]
+		same := byID[k.ID]
+		switch {
+		case same == nil:
+			p.result.APIKeys.Created++
+			p.apiKeys = append(p.apiKeys, k)
+			continue
+		case apiKeysEqual(same, k):
+			p.result.APIKeys.Unchanged++
+			continue
+		}
+
+		p.result.Conflicts = append(p.result.Conflicts, fmt.Sprintf("api key %s (%s)", k.ID, k.Name))
+		if policy != ConflictOverwrite {
+			p.result.APIKeys.Skipped++
+			continue
+		}
+		p.result.APIKeys.Overwritten++
+		p.deleteAPIKeys = append(p.deleteAPIKeys, k.ID)
+		p.apiKeys = append(p.apiKeys, k)
+	}
+	return nil
+}
+
+// apply makes the planned writes. Gateways are written before the groups
+// and history that refer to them.
+func (p *restorePlan) apply(ctx context.Context, s Store, b *Backup) error {
+	for _, id := range p.purgeGateways {
+		if err := s.PurgeGateway(ctx, id); err != nil && !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("purge gateway %s: %w", id, err)
+		}
+	}
+	restored := make(map[string]bool, len(p.gateways))
+	for _, gw := range p.gateways {
+		if err := restoreGateway(ctx, s, gw); err != nil {
+			return err
+		}
+		restored[gw.ID] = true
+	}
+
+	for _, id := range p.deleteGroups {
+		if err := s.DeleteGroup(ctx, id); err != nil && !errors.Is(err, ErrGroupNotFound) {
+			return fmt.Errorf("delete group %s: %w", id, err)
+		}
+	}
+	for _, g := range p.groups {
+		if err := s.CreateGroup(ctx, p.withPresentMembers(g)); err != nil {
+			return fmt.Errorf("restore group %s: %w", g.ID, err)
+		}
+	}
+	for _, g := range p.regroup {
+		if err := s.UpdateGroup(ctx, p.withPresentMembers(g)); err != nil {
+			return fmt.Errorf("restore members of group %s: %w", g.ID, err)
+		}
+	}
+
+	for _, ref := range p.secrets {
+		if err := s.PutSecret(ctx, ref, b.Secrets[ref]); err != nil {
+			return fmt.Errorf("restore secret %s: %w", ref, err)
+		}
+	}
+
+	for _, id := range p.deleteAPIKeys {
+		if err := s.DeleteAPIKey(ctx, id); err != nil && !errors.Is(err, ErrAPIKeyNotFound) {
+			return fmt.Errorf("delete api key %s: %w", id, err)
+		}
+	}
+	for _, k := range p.apiKeys {
+		key := k.APIKey
+		key.Hash = k.Hash
+		if err := s.CreateAPIKey(ctx, &key); err != nil {
+			return fmt.Errorf("restore api key %s: %w", k.ID, err)
+		}
+	}
+
+	for i := range b.StatusHistory {
+		t := &b.StatusHistory[i]
+		if !restored[t.GatewayID] {
+			continue
+		}
+		if err := s.InsertStatusTransition(ctx, t); err != nil {
+			return fmt.Errorf("restore status history of %s: %w", t.GatewayID, err)
+		}
+	}
+	for i := range b.HealthChecks {
+		c := &b.HealthChecks[i]
+		if !restored[c.GatewayID] {
+			continue
+		}
+		checkedAt, err := time.Parse(time.RFC3339, c.CheckedAt)
+		if err != nil {
+			return fmt.Errorf("restore health check of %s: invalid checked_at: %w", c.GatewayID, err)
+		}
+		if err := s.InsertHealthCheck(ctx, c, checkedAt); err != nil {
+			return fmt.Errorf("restore health check of %s: %w", c.GatewayID, err)
+		}
+	}
+
+	for _, i := range p.auditEvents {
+		e := b.AuditEvents[i]
+		if err := s.AppendAuditEvent(ctx, &e); err != nil {
+			return fmt.Errorf("restore audit event %d: %w", b.AuditEvents[i].ID, err)
+		}
+	}
+	return nil
+}
+
+// purged reports whether the restore purges gateway id.
+func (p *restorePlan) purged(id string) bool {
+	return slices.Contains(p.purgeGateways, id)
+}
+
+// withPresentMembers returns g without the members that are not in the store
+// once restored, such as gateways the restore skipped.
+func (p *restorePlan) withPresentMembers(g *model.Group) *model.Group {
+	group := *g
+	group.GatewayIDs = slices.DeleteFunc(slices.Clone(g.GatewayIDs), func(id string) bool {
+		return !p.present[id]
+	})
+	return &group
+}
+
+// restoreGateway creates a gateway as the backup recorded it, including the
+// maintenance window and deletion that creating it does not set.
+func restoreGateway(ctx context.Context, s Store, gw *model.Gateway) error {
+	if err := s.CreateGateway(ctx, gw); err != nil {
+		return fmt.Errorf("restore gateway %s: %w", gw.ID, err)
+	}
+	if gw.MaintenanceReason != "" || gw.MaintenanceUntil != nil {
+		if err := s.SetGatewayMaintenance(ctx, gw.ID, string(gw.Status), gw.MaintenanceReason, gw.MaintenanceUntil); err != nil {
+			return fmt.Errorf("restore gateway %s: %w", gw.ID, err)
+		}
+	}
+	if gw.DeletedAt != nil {
+		if err := s.DeleteGateway(ctx, gw.ID, *gw.DeletedAt); err != nil {
+			return fmt.Errorf("restore gateway %s: %w", gw.ID, err)
+		}
+	}
+	return nil
+}
+
+// gatewaysEqual compares gateways as JSON, which treats nil and empty maps
+// and equal instants in different zones alike.
+func gatewaysEqual(a, b *model.Gateway) bool {
+	ja, errA := json.Marshal(normalizeGateway(*a))
+	jb, errB := json.Marshal(normalizeGateway(*b))
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
+
+func normalizeGateway(gw model.Gateway) model.Gateway {
+	gw.EnrolledAt = gw.EnrolledAt.UTC()
+	for _, t := range []**time.Time{&gw.LastSeenAt, &gw.MaintenanceUntil, &gw.DeletedAt} {
+		if *t != nil {
+			u := (*t).UTC()
+			*t = &u
+		}
+	}
+	return gw
+}
+
+func groupsEqual(a, b *model.Group) bool {
+	ma, mb := slices.Sorted(slices.Values(a.GatewayIDs)), slices.Sorted(slices.Values(b.GatewayIDs))
+	return a.Name == b.Name && a.Description == b.Description && a.OrgID == b.OrgID &&
+		a.CreatedAt.Equal(b.CreatedAt) && reflect.DeepEqual(ma, mb)
+}
+
+func apiKeysEqual(a *model.APIKey, b *BackupAPIKey) bool {
+	return a.Name == b.Name && a.Hash == b.Hash && slices.Equal(a.Roles, b.Roles) && a.Org == b.Org &&
+		a.CreatedBy == b.CreatedBy && a.CreatedAt.Equal(b.CreatedAt) && sameInstant(a.ExpiresAt, b.ExpiresAt) &&
+		sameInstant(a.LastUsedAt, b.LastUsedAt) && a.Revoked == b.Revoked
+}
+
+// sameInstant reports whether two optional times are both unset or equal.
+func sameInstant(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// auditKey identifies an audit event by its content, since restored events
+// get new IDs. Timestamps are compared to the microsecond every driver
+// keeps.
+func auditKey(e model.AuditEvent) model.AuditEvent {
+	e.ID = 0
+	e.Timestamp = e.Timestamp.UTC().Truncate(time.Microsecond)
+	return e
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteBusyTimeout is how long a SQLite connection waits for a lock held
+// by another connection before failing with SQLITE_BUSY.
+const sqliteBusyTimeout = 5 * time.Second
+
+// sqliteReadConns is how many connections serve reads. In WAL mode readers
+// neither block the writer nor each other.
+const sqliteReadConns = 4
+
+// Retries of a write that failed with SQLITE_BUSY or SQLITE_LOCKED despite
+// the busy timeout; each retry doubles the delay before the next.
+const (
+	sqliteBusyRetries = 3
+	sqliteBusyBackoff = 50 * time.Millisecond
+)
+
+// sqliteWriter is the SQLite store's single write connection. Its
+// ExecContext retries statements that failed because the database was
+// busy, so a lock held by another process past the busy timeout does not
+// surface to callers at once.
+type sqliteWriter struct {
+	*sql.DB
+}
+
+func (w sqliteWriter) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	var result sql.Result
+	err := retryBusy(ctx, func() error {
+		var err error
+		result, err = w.DB.ExecContext(ctx, query, args...)
+		return err
+	})
+	return result, err
+}
+
+// retryBusy runs fn, running it again with backoff while it fails with
+// SQLITE_BUSY or SQLITE_LOCKED, up to sqliteBusyRetries times.
+func retryBusy(ctx context.Context, fn func() error) error {
+	backoff := sqliteBusyBackoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !isBusy(err) || attempt == sqliteBusyRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// isBusy reports whether err is SQLite failing to get a lock.
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
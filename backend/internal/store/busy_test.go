@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestRetryBusy(t *testing.T) {
+	busy := sqlite3.Error{Code: sqlite3.ErrBusy}
+	other := errors.New("constraint failed")
+
+	tests := []struct {
+		name      string
+		failures  int   // leading calls that fail
+		err       error // how they fail
+		wantCalls int
+		wantErr   error
+	}{
+		{"succeeds at once", 0, busy, 1, nil},
+		{"succeeds after busy", 2, sqlite3.Error{Code: sqlite3.ErrLocked}, 3, nil},
+		{"gives up", sqliteBusyRetries + 1, busy, sqliteBusyRetries + 1, busy},
+		{"other errors are not retried", 1, other, 1, other},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := retryBusy(context.Background(), func() error {
+				calls++
+				if calls <= tt.failures {
+					return tt.err
+				}
+				return nil
+			})
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetryBusyStopsWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls := 0
+	err := retryBusy(ctx, func() error {
+		calls++
+		return sqlite3.Error{Code: sqlite3.ErrBusy}
+	})
+	if calls != 1 || !isBusy(err) {
+		t.Errorf("calls = %d, err = %v; want one busy attempt", calls, err)
+	}
+}
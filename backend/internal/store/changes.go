@@ -0,0 +1,116 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ChangeKind names the kind of gateway write a Change reports.
+type ChangeKind string
+
+// Kinds of gateway writes reported by a ChangeFeed.
+const (
+	ChangeCreated     ChangeKind = "created"
+	ChangeUpdated     ChangeKind = "updated"
+	ChangeDeleted     ChangeKind = "deleted"
+	ChangeRestored    ChangeKind = "restored"
+	ChangePurged      ChangeKind = "purged"
+	ChangeMaintenance ChangeKind = "maintenance" // maintenance window set or cleared
+	ChangeStatus      ChangeKind = "status"      // a status transition was recorded
+)
+
+// Change is a gateway write made through any store sharing the database.
+type Change struct {
+	Kind      ChangeKind
+	GatewayID string
+	Data      json.RawMessage // the recorded model.StatusTransition for ChangeStatus
+
+	// Local is set for writes made through the store being watched, which
+	// the process has already acted on.
+	Local bool
+}
+
+// ChangeFeed is implemented by stores that can report gateway writes as they
+// happen, so that replicas sharing a database stay consistent.
+type ChangeFeed interface {
+	// WatchChanges calls ready once it is listening, then fn for each change
+	// until ctx is canceled or the connection is lost. Changes made while
+	// nobody listened are not replayed, so callers should resync in ready.
+	// It always returns a non-nil error.
+	WatchChanges(ctx context.Context, ready func(), fn func(Change)) error
+}
+
+// changeChannel is the Postgres notification channel gateway writes are
+// announced on.
+const changeChannel = "lobstertank_gateway_changes"
+
+// changeMessage is the payload of a change notification. Origin identifies
+// the store that made the write, so a replica can tell its own writes.
+type changeMessage struct {
+	Origin    string          `json:"origin"`
+	Kind      ChangeKind      `json:"kind"`
+	GatewayID string          `json:"gateway_id"`
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+// notifyChange announces a gateway write to other replicas when change
+// notifications are enabled. The write has already succeeded, so a failure
+// is logged rather than returned; other replicas catch up when their caches
+// expire.
+func (s *PostgresStore) notifyChange(ctx context.Context, kind ChangeKind, gatewayID string, data any) {
+	if !s.notifyChanges {
+		return
+	}
+
+	msg := changeMessage{Origin: s.origin, Kind: kind, GatewayID: gatewayID}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			slog.Warn("failed to encode change notification", "kind", kind, "id", gatewayID, "error", err)
+			return
+		}
+		msg.Data = raw
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		slog.Warn("failed to encode change notification", "kind", kind, "id", gatewayID, "error", err)
+		return
+	}
+
+	if _, err := s.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", changeChannel, string(payload)); err != nil {
+		slog.Warn("failed to send change notification", "kind", kind, "id", gatewayID, "error", err)
+	}
+}
+
+// WatchChanges listens on a dedicated connection outside the pool, since a
+// pooled connection would be handed back with the LISTEN still active.
+func (s *PostgresStore) WatchChanges(ctx context.Context, ready func(), fn func(Change)) error {
+	conn, err := pgx.Connect(ctx, s.dsn)
+	if err != nil {
+		return fmt.Errorf("connect change listener: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+changeChannel); err != nil {
+		return fmt.Errorf("listen for changes: %w", err)
+	}
+	ready()
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("wait for change notification: %w", err)
+		}
+
+		var msg changeMessage
+		if err := json.Unmarshal([]byte(n.Payload), &msg); err != nil {
+			slog.Warn("ignoring malformed change notification", "error", err)
+			continue
+		}
+		fn(Change{Kind: msg.Kind, GatewayID: msg.GatewayID, Data: msg.Data, Local: msg.Origin == s.origin})
+	}
+}
@@ -0,0 +1,57 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+)
+
+// Delays between attempts to reach a database that is not up yet; each
+// failed attempt doubles the delay up to the maximum.
+const (
+	minConnectBackoff = 500 * time.Millisecond
+	maxConnectBackoff = 10 * time.Second
+)
+
+// pingTimeout bounds a single connectivity check.
+const pingTimeout = 5 * time.Second
+
+// pingWithRetry checks that the database answers ping, retrying with
+// exponential backoff for up to timeout. A timeout of 0 fails on the first
+// unanswered ping. Each failed attempt is logged, so that a server waiting
+// for its database to start shows why it is not serving yet. Backoff is
+// measured on clk.
+func pingWithRetry(ctx context.Context, clk clock.Clock, driver string, ping func(context.Context) error, timeout time.Duration) error {
+	deadline := clk.Now().Add(timeout)
+	backoff := minConnectBackoff
+	for attempt := 1; ; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+		err := ping(pingCtx)
+		cancel()
+		if err == nil {
+			if attempt > 1 {
+				slog.Info("database reachable", "driver", driver, "attempts", attempt)
+			}
+			return nil
+		}
+
+		wait := min(backoff, deadline.Sub(clk.Now()))
+		if wait <= 0 {
+			if attempt > 1 {
+				return fmt.Errorf("ping %s: giving up after %d attempts: %w", driver, attempt, err)
+			}
+			return fmt.Errorf("ping %s: %w", driver, err)
+		}
+		slog.Warn("database not reachable; retrying", "driver", driver, "attempt", attempt, "error", err, "retry_in", wait)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("ping %s: %w", driver, ctx.Err())
+		case <-clk.After(wait):
+		}
+		backoff = min(2*backoff, maxConnectBackoff)
+	}
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+)
+
+var errRefused = errors.New("connection refused")
+
+var testEpoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// flakyPing returns a ping that fails its first failures calls, and the
+// clock times at which it was called.
+func flakyPing(clk clock.Clock, failures int) (func(context.Context) error, *[]time.Time) {
+	var calls []time.Time
+	return func(context.Context) error {
+		calls = append(calls, clk.Now())
+		if len(calls) <= failures {
+			return errRefused
+		}
+		return nil
+	}, &calls
+}
+
+// startPing runs pingWithRetry in the background and returns its result.
+func startPing(ctx context.Context, clk clock.Clock, ping func(context.Context) error, timeout time.Duration) <-chan error {
+	done := make(chan error, 1)
+	go func() { done <- pingWithRetry(ctx, clk, "postgres", ping, timeout) }()
+	return done
+}
+
+// waitForSleep waits until pingWithRetry is sleeping on clk.
+func waitForSleep(t *testing.T, clk *clock.FakeClock) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); clk.Waiters() == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("pingWithRetry never slept")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// sleepFor checks that pingWithRetry sleeps for exactly wait, advancing
+// the clock to wake it.
+func sleepFor(t *testing.T, clk *clock.FakeClock, wait time.Duration) {
+	t.Helper()
+	waitForSleep(t, clk)
+	clk.Advance(wait - time.Nanosecond)
+	if clk.Waiters() == 0 {
+		t.Fatalf("pingWithRetry woke before %v", wait)
+	}
+	clk.Advance(time.Nanosecond)
+}
+
+// elapsed returns the offsets of times from testEpoch.
+func elapsed(times []time.Time) []time.Duration {
+	out := make([]time.Duration, len(times))
+	for i, at := range times {
+		out[i] = at.Sub(testEpoch)
+	}
+	return out
+}
+
+func TestPingWithRetrySucceedsAfterFailures(t *testing.T) {
+	clk := clock.NewFake(testEpoch)
+	ping, calls := flakyPing(clk, 3)
+	done := startPing(context.Background(), clk, ping, time.Minute)
+
+	for _, wait := range []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second} {
+		sleepFor(t, clk, wait)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("pingWithRetry = %v, want nil", err)
+	}
+	want := []time.Duration{0, 500 * time.Millisecond, 1500 * time.Millisecond, 3500 * time.Millisecond}
+	if got := elapsed(*calls); !slices.Equal(got, want) {
+		t.Errorf("pinged at %v, want %v", got, want)
+	}
+}
+
+func TestPingWithRetryGivesUp(t *testing.T) {
+	clk := clock.NewFake(testEpoch)
+	ping, calls := flakyPing(clk, 1<<30)
+	done := startPing(context.Background(), clk, ping, 40*time.Second)
+
+	// The backoff doubles up to its maximum, and the last wait is cut short
+	// at the deadline.
+	waits := []time.Duration{
+		500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second,
+		8 * time.Second, 10 * time.Second, 10 * time.Second, 4500 * time.Millisecond,
+	}
+	for _, wait := range waits {
+		sleepFor(t, clk, wait)
+	}
+	err := <-done
+	if !errors.Is(err, errRefused) || !strings.Contains(err.Error(), "giving up after 9 attempts") {
+		t.Fatalf("pingWithRetry = %v, want giving up after 9 attempts on the ping error", err)
+	}
+	if got := elapsed(*calls); got[len(got)-1] != 40*time.Second {
+		t.Errorf("pinged at %v, want the last attempt at the deadline", got)
+	}
+}
+
+func TestPingWithRetryWithoutTimeout(t *testing.T) {
+	clk := clock.NewFake(testEpoch)
+	ping, calls := flakyPing(clk, 1)
+
+	err := pingWithRetry(context.Background(), clk, "postgres", ping, 0)
+	if !errors.Is(err, errRefused) || strings.Contains(err.Error(), "giving up") {
+		t.Errorf("pingWithRetry = %v, want the first ping's error", err)
+	}
+	if len(*calls) != 1 {
+		t.Errorf("pinged %d times, want 1", len(*calls))
+	}
+}
+
+func TestPingWithRetryStopsWhenCanceled(t *testing.T) {
+	clk := clock.NewFake(testEpoch)
+	ping, calls := flakyPing(clk, 1<<30)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := startPing(ctx, clk, ping, time.Minute)
+
+	waitForSleep(t, clk)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("pingWithRetry = %v, want context.Canceled", err)
+	}
+	if len(*calls) != 1 {
+		t.Errorf("pinged %d times, want 1", len(*calls))
+	}
+}
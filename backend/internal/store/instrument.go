@@ -0,0 +1,489 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the latency histogram
+// kept for each store operation.
+var latencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// OperationStats summarizes the calls made to one Store method since the
+// process started.
+type OperationStats struct {
+	Operation    string  `json:"operation"`
+	Calls        int64   `json:"calls"`
+	Errors       int64   `json:"errors"` // not counting records not found
+	Rows         int64   `json:"rows"`   // returned, or removed by prunes
+	TotalSeconds float64 `json:"total_seconds"`
+	MaxSeconds   float64 `json:"max_seconds"`
+
+	// Buckets is a cumulative latency histogram: each bucket counts the
+	// calls that took at most LE seconds. Calls slower than the last bucket
+	// are counted only in Calls.
+	Buckets []LatencyBucket `json:"buckets"`
+}
+
+// LatencyBucket is one bucket of an OperationStats histogram.
+type LatencyBucket struct {
+	LE    float64 `json:"le"`
+	Count int64   `json:"count"`
+}
+
+// StatsReporter is implemented by stores that keep per-operation
+// statistics, as the stores returned by New do.
+type StatsReporter interface {
+	// StoreStats returns the statistics of every operation called so far,
+	// ordered by operation name.
+	StoreStats() []OperationStats
+}
+
+// instrumentedStore wraps a Store to time every operation, keep statistics
+// on it, and log the operations slower than slow.
+type instrumentedStore struct {
+	inner Store
+	slow  time.Duration // 0 disables the slow operation log
+	stats *operationStats
+}
+
+// Instrument wraps s to keep per-operation statistics, which it reports
+// through StatsReporter, and to log a warning for every operation that
+// takes longer than slow. A zero slow disables the warnings.
+func Instrument(s Store, slow time.Duration) Store {
+	return &instrumentedStore{inner: s, slow: slow, stats: &operationStats{ops: make(map[string]*OperationStats)}}
+}
+
+// Unwrap returns the store an instrumented store wraps, or s itself, so
+// that callers can reach driver-specific methods.
+func Unwrap(s Store) Store {
+	if is, ok := s.(*instrumentedStore); ok {
+		return is.inner
+	}
+	return s
+}
+
+type operationStats struct {
+	mu  sync.Mutex
+	ops map[string]*OperationStats
+}
+
+func (s *instrumentedStore) StoreStats() []OperationStats {
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+
+	out := make([]OperationStats, 0, len(s.stats.ops))
+	for _, op := range s.stats.ops {
+		st := *op
+		st.Buckets = slices.Clone(op.Buckets)
+		out = append(out, st)
+	}
+	slices.SortFunc(out, func(a, b OperationStats) int {
+		return strings.Compare(a.Operation, b.Operation)
+	})
+	return out
+}
+
+// observe records one call of op that began at start.
+func (s *instrumentedStore) observe(op string, start time.Time, rows int64, err error) {
+	elapsed := time.Since(start)
+	failed := err != nil && !isNotFound(err)
+
+	if s.slow > 0 && elapsed > s.slow {
+		attrs := []any{"operation", op, "duration", elapsed.String(), "rows", rows}
+		if failed {
+			attrs = append(attrs, "error", err)
+		}
+		slog.Warn("slow store operation", attrs...)
+	}
+
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+	st, ok := s.stats.ops[op]
+	if !ok {
+		st = &OperationStats{Operation: op, Buckets: make([]LatencyBucket, len(latencyBuckets))}
+		for i, le := range latencyBuckets {
+			st.Buckets[i].LE = le
+		}
+		s.stats.ops[op] = st
+	}
+	seconds := elapsed.Seconds()
+	st.Calls++
+	if failed {
+		st.Errors++
+	}
+	st.Rows += rows
+	st.TotalSeconds += seconds
+	st.MaxSeconds = max(st.MaxSeconds, seconds)
+	for i := range st.Buckets {
+		if seconds <= st.Buckets[i].LE {
+			st.Buckets[i].Count++
+		}
+	}
+}
+
+// isNotFound reports whether err only says that a record does not exist,
+// which callers expect rather than a database failure.
+func isNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, ErrGroupNotFound) || errors.Is(err, ErrJobNotFound) ||
+		errors.Is(err, ErrAPIKeyNotFound)
+}
+
+// countFound counts a lookup's result as one row when found.
+func countFound(found bool) int64 {
+	if found {
+		return 1
+	}
+	return 0
+}
+
+// InTx instruments the transaction as a whole and each operation in it,
+// sharing the statistics of s.
+func (s *instrumentedStore) InTx(ctx context.Context, fn func(Store) error) error {
+	start := time.Now()
+	err := s.inner.InTx(ctx, func(tx Store) error {
+		return fn(&instrumentedStore{inner: tx, slow: s.slow, stats: s.stats})
+	})
+	s.observe("InTx", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) Close() error {
+	return s.inner.Close()
+}
+
+func (s *instrumentedStore) ListGateways(ctx context.Context, filter model.GatewayFilter, sort model.ListSort) ([]model.Gateway, error) {
+	start := time.Now()
+	v, err := s.inner.ListGateways(ctx, filter, sort)
+	s.observe("ListGateways", start, int64(len(v)), err)
+	return v, err
+}
+
+func (s *instrumentedStore) GetGateway(ctx context.Context, id string) (*model.Gateway, error) {
+	start := time.Now()
+	v, err := s.inner.GetGateway(ctx, id)
+	s.observe("GetGateway", start, countFound(v != nil), err)
+	return v, err
+}
+
+func (s *instrumentedStore) GetGatewayByName(ctx context.Context, orgID, name string) (*model.Gateway, error) {
+	start := time.Now()
+	v, err := s.inner.GetGatewayByName(ctx, orgID, name)
+	s.observe("GetGatewayByName", start, countFound(v != nil), err)
+	return v, err
+}
+
+func (s *instrumentedStore) ListGatewaysByIDs(ctx context.Context, ids []string) ([]model.Gateway, []string, error) {
+	start := time.Now()
+	v, missing, err := s.inner.ListGatewaysByIDs(ctx, ids)
+	s.observe("ListGatewaysByIDs", start, int64(len(v)), err)
+	return v, missing, err
+}
+
+func (s *instrumentedStore) CreateGateway(ctx context.Context, gw *model.Gateway) error {
+	start := time.Now()
+	err := s.inner.CreateGateway(ctx, gw)
+	s.observe("CreateGateway", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) UpdateGateway(ctx context.Context, gw *model.Gateway) error {
+	start := time.Now()
+	err := s.inner.UpdateGateway(ctx, gw)
+	s.observe("UpdateGateway", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) DeleteGateway(ctx context.Context, id string, deletedAt time.Time) error {
+	start := time.Now()
+	err := s.inner.DeleteGateway(ctx, id, deletedAt)
+	s.observe("DeleteGateway", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) UpdateGatewayStatus(ctx context.Context, id string, status string, lastSeen *time.Time) error {
+	start := time.Now()
+	err := s.inner.UpdateGatewayStatus(ctx, id, status, lastSeen)
+	s.observe("UpdateGatewayStatus", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) SetGatewayMaintenance(ctx context.Context, id string, status string, reason string, until *time.Time) error {
+	start := time.Now()
+	err := s.inner.SetGatewayMaintenance(ctx, id, status, reason, until)
+	s.observe("SetGatewayMaintenance", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) ListDeletedGateways(ctx context.Context, filter model.GatewayFilter, sort model.ListSort) ([]model.Gateway, error) {
+	start := time.Now()
+	v, err := s.inner.ListDeletedGateways(ctx, filter, sort)
+	s.observe("ListDeletedGateways", start, int64(len(v)), err)
+	return v, err
+}
+
+func (s *instrumentedStore) GetDeletedGateway(ctx context.Context, id string) (*model.Gateway, error) {
+	start := time.Now()
+	v, err := s.inner.GetDeletedGateway(ctx, id)
+	s.observe("GetDeletedGateway", start, countFound(v != nil), err)
+	return v, err
+}
+
+func (s *instrumentedStore) RestoreGateway(ctx context.Context, id string) error {
+	start := time.Now()
+	err := s.inner.RestoreGateway(ctx, id)
+	s.observe("RestoreGateway", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) PurgeGateway(ctx context.Context, id string) error {
+	start := time.Now()
+	err := s.inner.PurgeGateway(ctx, id)
+	s.observe("PurgeGateway", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) InsertStatusTransition(ctx context.Context, t *model.StatusTransition) error {
+	start := time.Now()
+	err := s.inner.InsertStatusTransition(ctx, t)
+	s.observe("InsertStatusTransition", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) ListStatusTransitions(ctx context.Context, gatewayID string, since time.Time) ([]model.StatusTransition, error) {
+	start := time.Now()
+	v, err := s.inner.ListStatusTransitions(ctx, gatewayID, since)
+	s.observe("ListStatusTransitions", start, int64(len(v)), err)
+	return v, err
+}
+
+func (s *instrumentedStore) PruneStatusHistory(ctx context.Context, before time.Time) (int64, error) {
+	start := time.Now()
+	v, err := s.inner.PruneStatusHistory(ctx, before)
+	s.observe("PruneStatusHistory", start, v, err)
+	return v, err
+}
+
+func (s *instrumentedStore) InsertHealthCheck(ctx context.Context, r *model.HealthCheckResult, checkedAt time.Time) error {
+	start := time.Now()
+	err := s.inner.InsertHealthCheck(ctx, r, checkedAt)
+	s.observe("InsertHealthCheck", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) ListHealthChecks(ctx context.Context, gatewayID string, limit int) ([]model.HealthCheckResult, error) {
+	start := time.Now()
+	v, err := s.inner.ListHealthChecks(ctx, gatewayID, limit)
+	s.observe("ListHealthChecks", start, int64(len(v)), err)
+	return v, err
+}
+
+func (s *instrumentedStore) PruneHealthChecks(ctx context.Context, gatewayID string, before time.Time) (int64, error) {
+	start := time.Now()
+	v, err := s.inner.PruneHealthChecks(ctx, gatewayID, before)
+	s.observe("PruneHealthChecks", start, v, err)
+	return v, err
+}
+
+func (s *instrumentedStore) ListGroups(ctx context.Context) ([]model.Group, error) {
+	start := time.Now()
+	v, err := s.inner.ListGroups(ctx)
+	s.observe("ListGroups", start, int64(len(v)), err)
+	return v, err
+}
+
+func (s *instrumentedStore) GetGroup(ctx context.Context, id string) (*model.Group, error) {
+	start := time.Now()
+	v, err := s.inner.GetGroup(ctx, id)
+	s.observe("GetGroup", start, countFound(v != nil), err)
+	return v, err
+}
+
+func (s *instrumentedStore) CreateGroup(ctx context.Context, g *model.Group) error {
+	start := time.Now()
+	err := s.inner.CreateGroup(ctx, g)
+	s.observe("CreateGroup", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) UpdateGroup(ctx context.Context, g *model.Group) error {
+	start := time.Now()
+	err := s.inner.UpdateGroup(ctx, g)
+	s.observe("UpdateGroup", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) DeleteGroup(ctx context.Context, id string) error {
+	start := time.Now()
+	err := s.inner.DeleteGroup(ctx, id)
+	s.observe("DeleteGroup", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) ListSecrets(ctx context.Context) (map[string]string, error) {
+	start := time.Now()
+	v, err := s.inner.ListSecrets(ctx)
+	s.observe("ListSecrets", start, int64(len(v)), err)
+	return v, err
+}
+
+func (s *instrumentedStore) PutSecret(ctx context.Context, ref, value string) error {
+	start := time.Now()
+	err := s.inner.PutSecret(ctx, ref, value)
+	s.observe("PutSecret", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) DeleteSecret(ctx context.Context, ref string) error {
+	start := time.Now()
+	err := s.inner.DeleteSecret(ctx, ref)
+	s.observe("DeleteSecret", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) GetIdempotencyKey(ctx context.Context, key string) (string, error) {
+	start := time.Now()
+	v, err := s.inner.GetIdempotencyKey(ctx, key)
+	s.observe("GetIdempotencyKey", start, countFound(err == nil), err)
+	return v, err
+}
+
+func (s *instrumentedStore) PutIdempotencyKey(ctx context.Context, key, gatewayID string, createdAt time.Time) error {
+	start := time.Now()
+	err := s.inner.PutIdempotencyKey(ctx, key, gatewayID, createdAt)
+	s.observe("PutIdempotencyKey", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) CreateFanOutJob(ctx context.Context, job *model.FanOutJob) error {
+	start := time.Now()
+	err := s.inner.CreateFanOutJob(ctx, job)
+	s.observe("CreateFanOutJob", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) GetFanOutJob(ctx context.Context, id string) (*model.FanOutJob, error) {
+	start := time.Now()
+	v, err := s.inner.GetFanOutJob(ctx, id)
+	s.observe("GetFanOutJob", start, countFound(v != nil), err)
+	return v, err
+}
+
+func (s *instrumentedStore) UpdateFanOutJobStatus(ctx context.Context, id string, status model.JobStatus, updatedAt time.Time) error {
+	start := time.Now()
+	err := s.inner.UpdateFanOutJobStatus(ctx, id, status, updatedAt)
+	s.observe("UpdateFanOutJobStatus", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) InsertFanOutResult(ctx context.Context, jobID string, r *model.FanOutJobResult) error {
+	start := time.Now()
+	err := s.inner.InsertFanOutResult(ctx, jobID, r)
+	s.observe("InsertFanOutResult", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) DeleteFanOutJob(ctx context.Context, id string) error {
+	start := time.Now()
+	err := s.inner.DeleteFanOutJob(ctx, id)
+	s.observe("DeleteFanOutJob", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) PruneFanOutJobs(ctx context.Context, before time.Time) (int64, error) {
+	start := time.Now()
+	v, err := s.inner.PruneFanOutJobs(ctx, before)
+	s.observe("PruneFanOutJobs", start, v, err)
+	return v, err
+}
+
+func (s *instrumentedStore) AddUsage(ctx context.Context, gatewayID string, hour time.Time, u model.Usage) error {
+	start := time.Now()
+	err := s.inner.AddUsage(ctx, gatewayID, hour, u)
+	s.observe("AddUsage", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) ListUsage(ctx context.Context, gatewayID string, since time.Time) ([]model.UsageTotals, error) {
+	start := time.Now()
+	v, err := s.inner.ListUsage(ctx, gatewayID, since)
+	s.observe("ListUsage", start, int64(len(v)), err)
+	return v, err
+}
+
+func (s *instrumentedStore) AppendAuditEvent(ctx context.Context, e *model.AuditEvent) error {
+	start := time.Now()
+	err := s.inner.AppendAuditEvent(ctx, e)
+	s.observe("AppendAuditEvent", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) ListAuditEvents(ctx context.Context, q model.AuditQuery) ([]model.AuditEvent, error) {
+	start := time.Now()
+	v, err := s.inner.ListAuditEvents(ctx, q)
+	s.observe("ListAuditEvents", start, int64(len(v)), err)
+	return v, err
+}
+
+func (s *instrumentedStore) PruneAuditEvents(ctx context.Context, before time.Time) (int64, error) {
+	start := time.Now()
+	v, err := s.inner.PruneAuditEvents(ctx, before)
+	s.observe("PruneAuditEvents", start, v, err)
+	return v, err
+}
+
+func (s *instrumentedStore) CreateAPIKey(ctx context.Context, k *model.APIKey) error {
+	start := time.Now()
+	err := s.inner.CreateAPIKey(ctx, k)
+	s.observe("CreateAPIKey", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) GetAPIKey(ctx context.Context, id string) (*model.APIKey, error) {
+	start := time.Now()
+	v, err := s.inner.GetAPIKey(ctx, id)
+	s.observe("GetAPIKey", start, countFound(v != nil), err)
+	return v, err
+}
+
+func (s *instrumentedStore) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	start := time.Now()
+	v, err := s.inner.ListAPIKeys(ctx)
+	s.observe("ListAPIKeys", start, int64(len(v)), err)
+	return v, err
+}
+
+func (s *instrumentedStore) RevokeAPIKey(ctx context.Context, id string) error {
+	start := time.Now()
+	err := s.inner.RevokeAPIKey(ctx, id)
+	s.observe("RevokeAPIKey", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) DeleteAPIKey(ctx context.Context, id string) error {
+	start := time.Now()
+	err := s.inner.DeleteAPIKey(ctx, id)
+	s.observe("DeleteAPIKey", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	start := time.Now()
+	err := s.inner.TouchAPIKey(ctx, id, usedAt)
+	s.observe("TouchAPIKey", start, 0, err)
+	return err
+}
+
+func (s *instrumentedStore) Ping(ctx context.Context) error {
+	start := time.Now()
+	err := s.inner.Ping(ctx)
+	s.observe("Ping", start, 0, err)
+	return err
+}
@@ -0,0 +1,173 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// sleepyStore is a fake store whose gateway reads take delay and return
+// the gateways it holds, or err.
+type sleepyStore struct {
+	Store // nil; only the methods below are called
+	delay time.Duration
+	gws   []model.Gateway
+	err   error
+}
+
+func (s *sleepyStore) ListGateways(context.Context, model.GatewayFilter, model.ListSort) ([]model.Gateway, error) {
+	time.Sleep(s.delay)
+	return s.gws, s.err
+}
+
+func (s *sleepyStore) GetGateway(_ context.Context, id string) (*model.Gateway, error) {
+	time.Sleep(s.delay)
+	for i := range s.gws {
+		if s.gws[i].ID == id {
+			return &s.gws[i], nil
+		}
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return nil, fmt.Errorf("gateway %s: %w", id, ErrNotFound)
+}
+
+func (s *sleepyStore) InTx(_ context.Context, fn func(Store) error) error {
+	return fn(s)
+}
+
+// statsFor returns the statistics of op, failing the test if it has none.
+func statsFor(t *testing.T, s Store, op string) OperationStats {
+	t.Helper()
+	for _, st := range s.(StatsReporter).StoreStats() {
+		if st.Operation == op {
+			return st
+		}
+	}
+	t.Fatalf("no statistics for %s", op)
+	return OperationStats{}
+}
+
+func TestInstrumentLogsSlowOperations(t *testing.T) {
+	failure := errors.New("connection reset")
+	tests := []struct {
+		name    string
+		delay   time.Duration
+		slow    time.Duration
+		err     error
+		wantLog []string // nil expects no log
+	}{
+		{"fast", 0, 50 * time.Millisecond, nil, nil},
+		{"slow", 60 * time.Millisecond, 20 * time.Millisecond, nil,
+			[]string{"slow store operation", "operation=ListGateways", "rows=2"}},
+		{"slow failure", 60 * time.Millisecond, 20 * time.Millisecond, failure,
+			[]string{"operation=ListGateways", `error="connection reset"`}},
+		{"disabled", 30 * time.Millisecond, 0, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			s := Instrument(&sleepyStore{delay: tt.delay, gws: make([]model.Gateway, 2), err: tt.err}, tt.slow)
+			s.ListGateways(context.Background(), model.GatewayFilter{}, model.ListSort{})
+
+			if tt.wantLog == nil && logs.Len() > 0 {
+				t.Errorf("unexpected log: %s", logs)
+			}
+			for _, want := range tt.wantLog {
+				if !strings.Contains(logs.String(), want) {
+					t.Errorf("log %q does not contain %q", logs, want)
+				}
+			}
+		})
+	}
+}
+
+func TestInstrumentKeepsStatistics(t *testing.T) {
+	inner := &sleepyStore{gws: []model.Gateway{{ID: "gw-1"}, {ID: "gw-2"}, {ID: "gw-3"}}}
+	s := Instrument(inner, 0)
+	ctx := context.Background()
+
+	s.ListGateways(ctx, model.GatewayFilter{}, model.ListSort{})
+	s.GetGateway(ctx, "gw-1")
+	s.GetGateway(ctx, "missing") // not found is not an error
+	inner.err = errors.New("connection reset")
+	s.ListGateways(ctx, model.GatewayFilter{}, model.ListSort{})
+	inner.gws, inner.delay = nil, 30*time.Millisecond
+	s.GetGateway(ctx, "gw-1")
+
+	list := statsFor(t, s, "ListGateways")
+	if list.Calls != 2 || list.Errors != 1 || list.Rows != 6 {
+		t.Errorf("ListGateways = %d calls, %d errors, %d rows; want 2, 1, 6", list.Calls, list.Errors, list.Rows)
+	}
+	get := statsFor(t, s, "GetGateway")
+	if get.Calls != 3 || get.Errors != 1 || get.Rows != 1 {
+		t.Errorf("GetGateway = %d calls, %d errors, %d rows; want 3, 1, 1", get.Calls, get.Errors, get.Rows)
+	}
+	if get.MaxSeconds < 0.03 || get.TotalSeconds < get.MaxSeconds {
+		t.Errorf("GetGateway took %vs at most, %vs in all; want the 30ms call counted", get.MaxSeconds, get.TotalSeconds)
+	}
+
+	// The histogram is cumulative: buckets from 50ms up hold every call,
+	// those under 30ms leave out the slow one.
+	for _, b := range get.Buckets {
+		if b.LE >= 0.05 && b.Count != 3 || b.LE < 0.03 && b.Count > 2 {
+			t.Errorf("bucket le=%v counts %d calls", b.LE, b.Count)
+		}
+	}
+
+	stats := s.(StatsReporter).StoreStats()
+	if len(stats) != 2 || stats[0].Operation != "GetGateway" || stats[1].Operation != "ListGateways" {
+		t.Errorf("StoreStats = %+v, want GetGateway and ListGateways in order", stats)
+	}
+	stats[0].Buckets[0].Count = 99
+	if statsFor(t, s, "GetGateway").Buckets[0].Count == 99 {
+		t.Error("StoreStats returned the live histogram")
+	}
+}
+
+func TestInstrumentTransactions(t *testing.T) {
+	s := Instrument(&sleepyStore{gws: []model.Gateway{{ID: "gw-1"}}}, 0)
+	err := s.InTx(context.Background(), func(tx Store) error {
+		if _, ok := tx.(*instrumentedStore); !ok {
+			t.Errorf("transaction store is %T, want it instrumented", tx)
+		}
+		tx.GetGateway(context.Background(), "gw-1")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("InTx: %v", err)
+	}
+	if st := statsFor(t, s, "InTx"); st.Calls != 1 {
+		t.Errorf("InTx calls = %d, want 1", st.Calls)
+	}
+	if st := statsFor(t, s, "GetGateway"); st.Calls != 1 || st.Rows != 1 {
+		t.Errorf("GetGateway in a transaction = %+v, want it counted", st)
+	}
+}
+
+func TestNewInstruments(t *testing.T) {
+	s, err := New(config.DatabaseConfig{Driver: "sqlite", DSN: ":memory:", AutoMigrate: true})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	if _, ok := s.(StatsReporter); !ok {
+		t.Fatalf("New returned %T, want it to report statistics", s)
+	}
+	if _, ok := Unwrap(s).(*SQLiteStore); !ok {
+		t.Errorf("Unwrap = %T, want the SQLite store", Unwrap(s))
+	}
+	if _, err := s.GetGateway(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetGateway: got %v, want ErrNotFound through the wrapper", err)
+	}
+	if st := statsFor(t, s, "GetGateway"); st.Calls != 1 || st.Errors != 0 {
+		t.Errorf("GetGateway = %+v, want one call and no errors", st)
+	}
+}
@@ -0,0 +1,288 @@
+// Package migrations applies the database schema as an ordered chain of
+// numbered migrations, recording each applied version in the
+// schema_migrations table.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Sentinel errors returned by the Migrator.
+var (
+	// ErrAhead is returned when the database has migrations applied that
+	// this binary does not know, i.e. it was migrated by a newer release.
+	ErrAhead = errors.New("database schema is newer than this binary")
+	// ErrPending is returned by Check when migrations are waiting to be
+	// applied.
+	ErrPending = errors.New("database schema migrations are pending")
+)
+
+// advisoryLockKey serializes migrations across Postgres clients, so that
+// replicas starting together do not race to apply the same version.
+const advisoryLockKey = 0x4c54_4d49 // "LTMI"
+
+// mysqlLockName is the MySQL named lock that serves the same purpose, and
+// mysqlLockTimeout is how many seconds a client waits for it.
+const (
+	mysqlLockName    = "lobstertank_schema_migrations"
+	mysqlLockTimeout = 60
+)
+
+// Migration is one numbered step of the schema. Each migration runs in its
+// own transaction together with the record of its version.
+type Migration struct {
+	Version int
+	Name    string
+
+	// Up lists the statements applied for every driver, unless Drivers
+	// has statements for the driver in use.
+	Up      []string
+	Drivers map[string][]string
+
+	// Func, when set, runs after the statements, for steps SQL alone cannot
+	// express portably.
+	Func func(ctx context.Context, tx *sql.Tx, driver string) error
+}
+
+// statements returns the SQL the migration applies on driver.
+func (m *Migration) statements(driver string) []string {
+	if stmts, ok := m.Drivers[driver]; ok {
+		return stmts
+	}
+	return m.Up
+}
+
+// Latest returns the version the schema reaches once every known migration
+// is applied.
+func Latest() int {
+	return chain[len(chain)-1].Version
+}
+
+// State is a known migration and when it was applied.
+type State struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"` // nil while pending
+}
+
+// Migrator applies migrations to one database.
+type Migrator struct {
+	db     *sql.DB
+	driver string // "sqlite", "postgres", or "mysql"
+}
+
+// New creates a Migrator for a database opened with the given driver.
+func New(db *sql.DB, driver string) *Migrator {
+	return &Migrator{db: db, driver: driver}
+}
+
+// Current returns the highest applied version, or 0 for a database no
+// migration has touched.
+func (m *Migrator) Current(ctx context.Context) (int, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return 0, err
+	}
+	var v sql.NullInt64
+	if err := m.db.QueryRowContext(ctx, "SELECT MAX(version) FROM schema_migrations").Scan(&v); err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+	return int(v.Int64), nil
+}
+
+// Status lists every known migration with when it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]State, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := m.db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("query schema migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			v  int
+			at time.Time
+		)
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, fmt.Errorf("scan schema migration: %w", err)
+		}
+		applied[v] = at.UTC()
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate schema migrations: %w", err)
+	}
+
+	states := make([]State, 0, len(chain))
+	for _, mig := range chain {
+		s := State{Version: mig.Version, Name: mig.Name}
+		if at, ok := applied[mig.Version]; ok {
+			s.AppliedAt = &at
+		}
+		states = append(states, s)
+	}
+	return states, nil
+}
+
+// Check verifies that the database is at exactly the latest version. It
+// fails with ErrAhead or ErrPending otherwise.
+func (m *Migrator) Check(ctx context.Context) error {
+	current, err := m.Current(ctx)
+	if err != nil {
+		return err
+	}
+	if err := checkAhead(current); err != nil {
+		return err
+	}
+	if current < Latest() {
+		return fmt.Errorf("%w: database is at version %d, this binary needs %d", ErrPending, current, Latest())
+	}
+	return nil
+}
+
+// Up applies every pending migration in order and returns how many it
+// applied. It refuses to touch a database that is ahead of this binary.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	current, err := m.Current(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkAhead(current); err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for i := range chain {
+		mig := &chain[i]
+		if mig.Version <= current {
+			continue
+		}
+		ran, err := m.apply(ctx, mig)
+		if err != nil {
+			return applied, err
+		}
+		if ran {
+			applied++
+		}
+	}
+	return applied, nil
+}
+
+// apply runs one migration in a transaction and records its version. It
+// reports false when another client applied the migration first.
+func (m *Migrator) apply(ctx context.Context, mig *Migration) (bool, error) {
+	start := time.Now()
+
+	// A MySQL named lock belongs to the session rather than the
+	// transaction, so the migration holds one connection throughout and
+	// releases the lock before handing it back.
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return false, fmt.Errorf("begin migration %d: %w", mig.Version, err)
+	}
+	defer conn.Close()
+	if m.driver == "mysql" {
+		var got sql.NullInt64
+		if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", mysqlLockName, mysqlLockTimeout).Scan(&got); err != nil {
+			return false, fmt.Errorf("lock schema migrations: %w", err)
+		}
+		if got.Int64 != 1 {
+			return false, fmt.Errorf("lock schema migrations: timed out after %ds", mysqlLockTimeout)
+		}
+		defer conn.ExecContext(context.Background(), "DO RELEASE_LOCK(?)", mysqlLockName)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("begin migration %d: %w", mig.Version, err)
+	}
+	defer tx.Rollback()
+
+	if m.driver == "postgres" {
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", advisoryLockKey); err != nil {
+			return false, fmt.Errorf("lock schema migrations: %w", err)
+		}
+	}
+	var n int
+	if err := tx.QueryRowContext(ctx,
+		m.bind("SELECT COUNT(*) FROM schema_migrations WHERE version = ?"), mig.Version,
+	).Scan(&n); err != nil {
+		return false, fmt.Errorf("check migration %d: %w", mig.Version, err)
+	}
+	if n > 0 {
+		return false, nil
+	}
+
+	for _, stmt := range mig.statements(m.driver) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return false, fmt.Errorf("migration %d (%s): %w", mig.Version, mig.Name, err)
+		}
+	}
+	if mig.Func != nil {
+		if err := mig.Func(ctx, tx, m.driver); err != nil {
+			return false, fmt.Errorf("migration %d (%s): %w", mig.Version, mig.Name, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		m.bind("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)"),
+		mig.Version, mig.Name, time.Now().UTC(),
+	); err != nil {
+		return false, fmt.Errorf("record migration %d: %w", mig.Version, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("commit migration %d: %w", mig.Version, err)
+	}
+
+	slog.Info("applied schema migration", "version", mig.Version, "name", mig.Name,
+		"driver", m.driver, "duration", time.Since(start).String())
+	return true, nil
+}
+
+// ensureTable creates the version table if it does not exist yet.
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	if _, err := m.db.ExecContext(ctx, createMigrationsTableSQL); err != nil {
+		return fmt.Errorf("create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// bind rewrites ? placeholders as $n for Postgres.
+func (m *Migrator) bind(query string) string {
+	if m.driver != "postgres" {
+		return query
+	}
+	out := make([]byte, 0, len(query)+8)
+	n := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] == '?' {
+			n++
+			out = fmt.Appendf(out, "$%d", n)
+			continue
+		}
+		out = append(out, query[i])
+	}
+	return string(out)
+}
+
+func checkAhead(current int) error {
+	if current > Latest() {
+		return fmt.Errorf("%w: database is at version %d, this binary knows up to %d", ErrAhead, current, Latest())
+	}
+	return nil
+}
+
+// createMigrationsTableSQL is the DDL for the applied-version record.
+const createMigrationsTableSQL = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version    INTEGER PRIMARY KEY,
+    name       TEXT NOT NULL,
+    applied_at TIMESTAMP NOT NULL
+)`
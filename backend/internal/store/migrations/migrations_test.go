@@ -0,0 +1,102 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openDB opens a fresh SQLite database no migration has touched.
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "lobstertank.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestUpIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	m := New(openDB(t), "sqlite")
+
+	if v, err := m.Current(ctx); err != nil || v != 0 {
+		t.Fatalf("Current on a fresh database = %d, %v; want 0", v, err)
+	}
+	if err := m.Check(ctx); !errors.Is(err, ErrPending) {
+		t.Errorf("Check on a fresh database: got %v, want ErrPending", err)
+	}
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatalf("first Up: %v", err)
+	}
+	if applied != len(chain) {
+		t.Errorf("first Up applied %d migrations, want %d", applied, len(chain))
+	}
+
+	applied, err = m.Up(ctx)
+	if err != nil {
+		t.Fatalf("second Up: %v", err)
+	}
+	if applied != 0 {
+		t.Errorf("second Up applied %d migrations, want 0", applied)
+	}
+
+	if v, err := m.Current(ctx); err != nil || v != Latest() {
+		t.Errorf("Current = %d, %v; want %d", v, err, Latest())
+	}
+	if err := m.Check(ctx); err != nil {
+		t.Errorf("Check after Up: %v", err)
+	}
+
+	states, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if len(states) != len(chain) {
+		t.Fatalf("Status listed %d migrations, want %d", len(states), len(chain))
+	}
+	for _, s := range states {
+		if s.AppliedAt == nil {
+			t.Errorf("migration %d (%s) not recorded as applied", s.Version, s.Name)
+		}
+	}
+
+	// Each version is recorded exactly once.
+	var rows int
+	if err := m.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations").Scan(&rows); err != nil {
+		t.Fatalf("count schema_migrations: %v", err)
+	}
+	if rows != len(chain) {
+		t.Errorf("schema_migrations has %d rows, want %d", rows, len(chain))
+	}
+}
+
+func TestUpRefusesNewerSchema(t *testing.T) {
+	ctx := context.Background()
+	m := New(openDB(t), "sqlite")
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if _, err := m.db.ExecContext(ctx,
+		"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		Latest()+1, "from the future", time.Now().UTC(),
+	); err != nil {
+		t.Fatalf("record future migration: %v", err)
+	}
+
+	if _, err := m.Up(ctx); !errors.Is(err, ErrAhead) {
+		t.Errorf("Up: got %v, want ErrAhead", err)
+	}
+	if err := m.Check(ctx); !errors.Is(err, ErrAhead) {
+		t.Errorf("Check: got %v, want ErrAhead", err)
+	}
+}
@@ -0,0 +1,162 @@
+package migrations
+
+// mysqlTableOptions follows every MySQL CREATE TABLE.
+const mysqlTableOptions = "ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin"
+
+// mysqlSchema is migration 1 on MySQL. MySQL support arrived with version
+// 7, so this creates the schema as it stands at version 7 and migrations 2
+// through 7 have nothing to do on MySQL. The DDL differs from the other
+// drivers in ways MySQL requires:
+//
+//   - Keys and indexed columns are VARCHAR, since TEXT cannot be indexed
+//     without a prefix length, and free text uses parenthesized defaults
+//     (MySQL 8.0.13 or MariaDB 10.2 and later).
+//   - Timestamps are DATETIME(6), which keeps microseconds and, unlike
+//     TIMESTAMP, is neither converted between zones nor limited to 2038.
+//   - The JSON columns use the native JSON type.
+//   - MySQL has no partial indexes, so live gateway names are kept unique
+//     through a generated column that is NULL for deleted gateways.
+//   - Tables use a binary collation so that names, labels, and keys compare
+//     case-sensitively, as they do on SQLite and Postgres.
+//
+// MySQL commits DDL implicitly, so a migration that fails partway is not
+// rolled back; every statement tolerates having run before.
+var mysqlSchema = []string{
+	`CREATE TABLE IF NOT EXISTS gateways (
+    id                 VARCHAR(64) PRIMARY KEY,
+    name               VARCHAR(255) NOT NULL,
+    description        TEXT NOT NULL DEFAULT (''),
+    endpoint           TEXT NOT NULL,
+    transport_type     VARCHAR(64) NOT NULL DEFAULT 'https',
+    transport_params   JSON NOT NULL DEFAULT ('{}'),
+    auth_type          VARCHAR(64) NOT NULL DEFAULT '',
+    auth_params        JSON NOT NULL DEFAULT ('{}'),
+    auth_secret_ref    TEXT NOT NULL DEFAULT (''),
+    status             VARCHAR(32) NOT NULL DEFAULT 'unknown',
+    labels             JSON NOT NULL DEFAULT ('{}'),
+    enrolled_at        DATETIME(6) NOT NULL,
+    last_seen_at       DATETIME(6),
+    ttl_seconds        INTEGER,
+    maintenance_reason TEXT NOT NULL DEFAULT (''),
+    maintenance_until  DATETIME(6),
+    org_id             VARCHAR(255) NOT NULL DEFAULT '',
+    deleted_at         DATETIME(6),
+    live_name          VARCHAR(255) AS (IF(deleted_at IS NULL, name, NULL)) STORED,
+    UNIQUE INDEX idx_gateways_live_name (live_name),
+    INDEX idx_gateways_org (org_id)
+) ` + mysqlTableOptions,
+
+	`CREATE TABLE IF NOT EXISTS gateway_status_history (
+    gateway_id  VARCHAR(64) NOT NULL,
+    from_status VARCHAR(32) NOT NULL,
+    to_status   VARCHAR(32) NOT NULL,
+    latency     VARCHAR(64) NOT NULL DEFAULT '',
+    error       TEXT NOT NULL DEFAULT (''),
+    error_kind  VARCHAR(64) NOT NULL DEFAULT '',
+    observed_at DATETIME(6) NOT NULL,
+    INDEX idx_status_history_gateway (gateway_id, observed_at),
+    FOREIGN KEY (gateway_id) REFERENCES gateways (id) ON DELETE CASCADE
+) ` + mysqlTableOptions,
+
+	`CREATE TABLE IF NOT EXISTS gateway_health_history (
+    gateway_id VARCHAR(64) NOT NULL,
+    status     VARCHAR(32) NOT NULL,
+    latency    VARCHAR(64) NOT NULL DEFAULT '',
+    latency_ms BIGINT NOT NULL DEFAULT 0,
+    error      TEXT NOT NULL DEFAULT (''),
+    error_kind VARCHAR(64) NOT NULL DEFAULT '',
+    attempts   INTEGER NOT NULL DEFAULT 0,
+    checked_at DATETIME(6) NOT NULL,
+    INDEX idx_health_history_gateway (gateway_id, checked_at),
+    FOREIGN KEY (gateway_id) REFERENCES gateways (id) ON DELETE CASCADE
+) ` + mysqlTableOptions,
+
+	`CREATE TABLE IF NOT EXISTS gateway_groups (
+    id          VARCHAR(64) PRIMARY KEY,
+    name        VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT (''),
+    created_at  DATETIME(6) NOT NULL
+) ` + mysqlTableOptions,
+
+	`CREATE TABLE IF NOT EXISTS gateway_group_members (
+    group_id   VARCHAR(64) NOT NULL,
+    gateway_id VARCHAR(64) NOT NULL,
+    PRIMARY KEY (group_id, gateway_id),
+    FOREIGN KEY (group_id) REFERENCES gateway_groups (id) ON DELETE CASCADE,
+    FOREIGN KEY (gateway_id) REFERENCES gateways (id) ON DELETE CASCADE
+) ` + mysqlTableOptions,
+
+	`CREATE TABLE IF NOT EXISTS secrets (
+    ref   VARCHAR(512) PRIMARY KEY,
+    value TEXT NOT NULL
+) ` + mysqlTableOptions,
+
+	// key is a reserved word in MySQL, so it is quoted here and in queries.
+	"CREATE TABLE IF NOT EXISTS idempotency_keys (\n" +
+		"    `key`      VARCHAR(255) PRIMARY KEY,\n" +
+		"    gateway_id VARCHAR(64) NOT NULL,\n" +
+		"    created_at DATETIME(6) NOT NULL,\n" +
+		"    FOREIGN KEY (gateway_id) REFERENCES gateways (id) ON DELETE CASCADE\n" +
+		") " + mysqlTableOptions,
+
+	`CREATE TABLE IF NOT EXISTS fanout_jobs (
+    id         VARCHAR(64) PRIMARY KEY,
+    status     VARCHAR(32) NOT NULL,
+    total      INTEGER NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    updated_at DATETIME(6) NOT NULL
+) ` + mysqlTableOptions,
+
+	`CREATE TABLE IF NOT EXISTS fanout_results (
+    job_id       VARCHAR(64) NOT NULL,
+    position     INTEGER NOT NULL,
+    gateway_id   VARCHAR(64) NOT NULL,
+    gateway_name VARCHAR(255) NOT NULL,
+    response     MEDIUMTEXT NOT NULL DEFAULT (''),
+    error        TEXT NOT NULL DEFAULT (''),
+    skipped      BOOLEAN NOT NULL DEFAULT FALSE,
+    skip_reason  TEXT NOT NULL DEFAULT (''),
+    latency_ms   BIGINT NOT NULL DEFAULT 0,
+    completed_at DATETIME(6) NOT NULL,
+    PRIMARY KEY (job_id, gateway_id),
+    FOREIGN KEY (job_id) REFERENCES fanout_jobs (id) ON DELETE CASCADE
+) ` + mysqlTableOptions,
+
+	`CREATE TABLE IF NOT EXISTS gateway_usage (
+    gateway_id        VARCHAR(64) NOT NULL,
+    model             VARCHAR(255) NOT NULL,
+    hour              DATETIME(6) NOT NULL,
+    requests          BIGINT NOT NULL DEFAULT 0,
+    prompt_tokens     BIGINT NOT NULL DEFAULT 0,
+    completion_tokens BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (gateway_id, model, hour),
+    INDEX idx_gateway_usage_hour (hour),
+    FOREIGN KEY (gateway_id) REFERENCES gateways (id) ON DELETE CASCADE
+) ` + mysqlTableOptions,
+
+	`CREATE TABLE IF NOT EXISTS audit_events (
+    id         BIGINT AUTO_INCREMENT PRIMARY KEY,
+    timestamp  DATETIME(6) NOT NULL,
+    action     VARCHAR(255) NOT NULL,
+    resource   TEXT NOT NULL DEFAULT (''),
+    subject    TEXT NOT NULL DEFAULT (''),
+    detail     TEXT NOT NULL DEFAULT (''),
+    request_id TEXT NOT NULL DEFAULT (''),
+    INDEX idx_audit_events_timestamp (timestamp),
+    INDEX idx_audit_events_action (action, timestamp)
+) ` + mysqlTableOptions,
+}
+
+// mysqlAPIKeysTableSQL is migration 8 on MySQL.
+const mysqlAPIKeysTableSQL = `CREATE TABLE IF NOT EXISTS api_keys (
+    id           VARCHAR(64) PRIMARY KEY,
+    name         VARCHAR(255) NOT NULL,
+    key_hash     VARCHAR(64) NOT NULL,
+    roles        JSON NOT NULL DEFAULT ('[]'),
+    org_id       VARCHAR(255) NOT NULL DEFAULT '',
+    created_by   TEXT NOT NULL DEFAULT (''),
+    created_at   DATETIME(6) NOT NULL,
+    expires_at   DATETIME(6),
+    last_used_at DATETIME(6),
+    revoked      BOOLEAN NOT NULL DEFAULT FALSE
+) ` + mysqlTableOptions
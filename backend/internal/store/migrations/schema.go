@@ -0,0 +1,437 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// createGatewaysTableSQL is the DDL for the gateways table.
+// Compatible with both PostgreSQL and SQLite.
+const createGatewaysTableSQL = `
+CREATE TABLE IF NOT EXISTS gateways (
+    id               TEXT PRIMARY KEY,
+    name             TEXT NOT NULL,
+    description      TEXT NOT NULL DEFAULT '',
+    endpoint         TEXT NOT NULL,
+    transport_type   TEXT NOT NULL DEFAULT 'https',
+    transport_params TEXT NOT NULL DEFAULT '{}',
+    auth_type        TEXT NOT NULL DEFAULT '',
+    auth_params      TEXT NOT NULL DEFAULT '{}',
+    auth_secret_ref  TEXT NOT NULL DEFAULT '',
+    status           TEXT NOT NULL DEFAULT 'unknown',
+    labels           TEXT NOT NULL DEFAULT '{}',
+    enrolled_at      TIMESTAMP NOT NULL,
+    last_seen_at     TIMESTAMP,
+    ttl_seconds      INTEGER,
+    maintenance_reason TEXT NOT NULL DEFAULT '',
+    maintenance_until  TIMESTAMP
+)`
+
+// createGatewaysNameIndexSQL enforces unique gateway names.
+const createGatewaysNameIndexSQL = `
+CREATE UNIQUE INDEX IF NOT EXISTS idx_gateways_name ON gateways (name)`
+
+// createStatusHistoryTableSQL is the DDL for gateway status transitions.
+const createStatusHistoryTableSQL = `
+CREATE TABLE IF NOT EXISTS gateway_status_history (
+    gateway_id  TEXT NOT NULL REFERENCES gateways (id) ON DELETE CASCADE,
+    from_status TEXT NOT NULL,
+    to_status   TEXT NOT NULL,
+    latency     TEXT NOT NULL DEFAULT '',
+    error       TEXT NOT NULL DEFAULT '',
+    error_kind  TEXT NOT NULL DEFAULT '',
+    observed_at TIMESTAMP NOT NULL
+)`
+
+// createStatusHistoryIndexSQL supports per-gateway range queries and pruning.
+const createStatusHistoryIndexSQL = `
+CREATE INDEX IF NOT EXISTS idx_status_history_gateway ON gateway_status_history (gateway_id, observed_at)`
+
+// createHealthHistoryTableSQL is the DDL for individual health check
+// results.
+const createHealthHistoryTableSQL = `
+CREATE TABLE IF NOT EXISTS gateway_health_history (
+    gateway_id TEXT NOT NULL REFERENCES gateways (id) ON DELETE CASCADE,
+    status     TEXT NOT NULL,
+    latency    TEXT NOT NULL DEFAULT '',
+    latency_ms BIGINT NOT NULL DEFAULT 0,
+    error      TEXT NOT NULL DEFAULT '',
+    error_kind TEXT NOT NULL DEFAULT '',
+    attempts   INTEGER NOT NULL DEFAULT 0,
+    checked_at TIMESTAMP NOT NULL
+)`
+
+// createHealthHistoryIndexSQL supports latest-first queries and pruning per
+// gateway.
+const createHealthHistoryIndexSQL = `
+CREATE INDEX IF NOT EXISTS idx_health_history_gateway ON gateway_health_history (gateway_id, checked_at)`
+
+// createGroupsTableSQL is the DDL for named gateway groups.
+const createGroupsTableSQL = `
+CREATE TABLE IF NOT EXISTS gateway_groups (
+    id          TEXT PRIMARY KEY,
+    name        TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMP NOT NULL
+)`
+
+// createGroupMembersTableSQL is the DDL for group membership.
+const createGroupMembersTableSQL = `
+CREATE TABLE IF NOT EXISTS gateway_group_members (
+    group_id   TEXT NOT NULL REFERENCES gateway_groups (id) ON DELETE CASCADE,
+    gateway_id TEXT NOT NULL REFERENCES gateways (id) ON DELETE CASCADE,
+    PRIMARY KEY (group_id, gateway_id)
+)`
+
+// createSecretsTableSQL is the DDL for secrets held by the builtin provider.
+const createSecretsTableSQL = `
+CREATE TABLE IF NOT EXISTS secrets (
+    ref   TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+)`
+
+// createIdempotencyKeysTableSQL is the DDL for client-supplied idempotency
+// keys of gateway registrations.
+const createIdempotencyKeysTableSQL = `
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key        TEXT PRIMARY KEY,
+    gateway_id TEXT NOT NULL REFERENCES gateways (id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL
+)`
+
+// createFanOutJobsTableSQL is the DDL for asynchronous fan-out jobs.
+const createFanOutJobsTableSQL = `
+CREATE TABLE IF NOT EXISTS fanout_jobs (
+    id         TEXT PRIMARY KEY,
+    status     TEXT NOT NULL,
+    total      INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+)`
+
+// createFanOutResultsTableSQL is the DDL for per-gateway results of fan-out
+// jobs. Gateways are not referenced so results outlive their deletion.
+const createFanOutResultsTableSQL = `
+CREATE TABLE IF NOT EXISTS fanout_results (
+    job_id       TEXT NOT NULL REFERENCES fanout_jobs (id) ON DELETE CASCADE,
+    position     INTEGER NOT NULL,
+    gateway_id   TEXT NOT NULL,
+    gateway_name TEXT NOT NULL,
+    response     TEXT NOT NULL DEFAULT '',
+    error        TEXT NOT NULL DEFAULT '',
+    skipped      BOOLEAN NOT NULL DEFAULT FALSE,
+    skip_reason  TEXT NOT NULL DEFAULT '',
+    latency_ms   BIGINT NOT NULL DEFAULT 0,
+    completed_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (job_id, gateway_id)
+)`
+
+// createUsageTableSQL is the DDL for hourly token usage counters.
+const createUsageTableSQL = `
+CREATE TABLE IF NOT EXISTS gateway_usage (
+    gateway_id        TEXT NOT NULL REFERENCES gateways (id) ON DELETE CASCADE,
+    model             TEXT NOT NULL,
+    hour              TIMESTAMP NOT NULL,
+    requests          BIGINT NOT NULL DEFAULT 0,
+    prompt_tokens     BIGINT NOT NULL DEFAULT 0,
+    completion_tokens BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (gateway_id, model, hour)
+)`
+
+// createUsageHourIndexSQL supports usage queries across every gateway.
+const createUsageHourIndexSQL = `
+CREATE INDEX IF NOT EXISTS idx_gateway_usage_hour ON gateway_usage (hour)`
+
+// createAuditEventsTableSQL is the DDL for persisted audit events. The id
+// column's type, which differs between drivers, is filled in with %s.
+const createAuditEventsTableSQL = `
+CREATE TABLE IF NOT EXISTS audit_events (
+    id         %s,
+    timestamp  TIMESTAMP NOT NULL,
+    action     TEXT NOT NULL,
+    resource   TEXT NOT NULL DEFAULT '',
+    subject    TEXT NOT NULL DEFAULT '',
+    detail     TEXT NOT NULL DEFAULT '',
+    request_id TEXT NOT NULL DEFAULT ''
+)`
+
+// createAuditEventsTimeIndexSQL supports time-window queries and pruning.
+const createAuditEventsTimeIndexSQL = `
+CREATE INDEX IF NOT EXISTS idx_audit_events_timestamp ON audit_events (timestamp)`
+
+// createAuditEventsActionIndexSQL supports queries by action.
+const createAuditEventsActionIndexSQL = `
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events (action, timestamp)`
+
+// createAPIKeysTableSQL is the DDL for API keys. Only a hash of each key's
+// secret is stored; roles is a JSON array.
+const createAPIKeysTableSQL = `
+CREATE TABLE IF NOT EXISTS api_keys (
+    id           TEXT PRIMARY KEY,
+    name         TEXT NOT NULL,
+    key_hash     TEXT NOT NULL,
+    roles        TEXT NOT NULL DEFAULT '[]',
+    org_id       TEXT NOT NULL DEFAULT '',
+    created_by   TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMP NOT NULL,
+    expires_at   TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked      BOOLEAN NOT NULL DEFAULT FALSE
+)`
+
+// chain is every migration, in version order. Append new migrations to the
+// end; never edit or renumber one that has shipped.
+var chain = []Migration{
+	{
+		// The schema as it stood before versioned migrations. Every
+		// statement tolerates existing tables, so databases created by
+		// earlier releases adopt it unchanged.
+		Version: 1,
+		Name:    "initial schema",
+		Drivers: map[string][]string{"mysql": mysqlSchema},
+		Up: []string{
+			createGatewaysTableSQL,
+			createGatewaysNameIndexSQL,
+			createStatusHistoryTableSQL,
+			createStatusHistoryIndexSQL,
+			createGroupsTableSQL,
+			createGroupMembersTableSQL,
+			createSecretsTableSQL,
+			createIdempotencyKeysTableSQL,
+			createFanOutJobsTableSQL,
+			createFanOutResultsTableSQL,
+			createUsageTableSQL,
+			createUsageHourIndexSQL,
+			createHealthHistoryTableSQL,
+			createHealthHistoryIndexSQL,
+		},
+	},
+	{
+		Version: 2,
+		Name:    "add columns missing from pre-migration databases",
+		Func:    addLegacyColumns,
+	},
+	{
+		Version: 3,
+		Name:    "scope gateways to organizations",
+		Drivers: map[string][]string{"mysql": {}},
+		Up: []string{
+			"ALTER TABLE gateways ADD COLUMN org_id TEXT NOT NULL DEFAULT ''",
+			"CREATE INDEX IF NOT EXISTS idx_gateways_org ON gateways (org_id)",
+		},
+	},
+	{
+		Version: 4,
+		Name:    "persist audit events",
+		Drivers: map[string][]string{
+			"sqlite": {
+				fmt.Sprintf(createAuditEventsTableSQL, "INTEGER PRIMARY KEY AUTOINCREMENT"),
+				createAuditEventsTimeIndexSQL,
+				createAuditEventsActionIndexSQL,
+			},
+			"postgres": {
+				fmt.Sprintf(createAuditEventsTableSQL, "BIGSERIAL PRIMARY KEY"),
+				createAuditEventsTimeIndexSQL,
+				createAuditEventsActionIndexSQL,
+			},
+			"mysql": {},
+		},
+	},
+	{
+		// SQLite once stored enrollment times as RFC 3339 text, which
+		// dropped sub-second precision and sorts apart from the driver's
+		// own timestamp format. Rewrite those rows in that format, in UTC.
+		Version: 5,
+		Name:    "normalize sqlite enrollment times",
+		Drivers: map[string][]string{
+			"sqlite": {
+				`UPDATE gateways SET enrolled_at = strftime('%Y-%m-%d %H:%M:%S', enrolled_at) || '+00:00'
+                WHERE enrolled_at LIKE '____-__-__T%'`,
+			},
+			"postgres": {},
+			"mysql":    {},
+		},
+	},
+	{
+		// Deleting a gateway now only marks it deleted until it is purged.
+		// Names need only be unique among gateways that are not deleted, so
+		// a deleted gateway's name can be reused.
+		Version: 6,
+		Name:    "soft-delete gateways",
+		Drivers: map[string][]string{"mysql": {}},
+		Up: []string{
+			"ALTER TABLE gateways ADD COLUMN deleted_at TIMESTAMP",
+			"DROP INDEX IF EXISTS idx_gateways_name",
+			"CREATE UNIQUE INDEX IF NOT EXISTS idx_gateways_live_name ON gateways (name) WHERE deleted_at IS NULL",
+		},
+	},
+	{
+		// Postgres stores the JSON columns as JSONB so label selectors can
+		// use a GIN index. SQLite keeps them as text.
+		Version: 7,
+		Name:    "store gateway JSON columns as jsonb",
+		Drivers: map[string][]string{
+			"sqlite":   {},
+			"postgres": postgresJSONBColumns(),
+			"mysql":    {},
+		},
+	},
+	{
+		Version: 8,
+		Name:    "add api keys",
+		Drivers: map[string][]string{"mysql": {mysqlAPIKeysTableSQL}},
+		Up:      []string{createAPIKeysTableSQL},
+	},
+	{
+		Version: 9,
+		Name:    "scope groups to organizations",
+		Drivers: map[string][]string{"mysql": {}},
+		Up: []string{
+			"ALTER TABLE gateway_groups ADD COLUMN org_id TEXT NOT NULL DEFAULT ''",
+			"CREATE INDEX IF NOT EXISTS idx_gateway_groups_org ON gateway_groups (org_id)",
+		},
+		Func: addMySQLGroupOrg,
+	},
+	{
+		Version: 10,
+		Name:    "record fan-out job owners",
+		Drivers: map[string][]string{"mysql": {}},
+		Up: []string{
+			"ALTER TABLE fanout_jobs ADD COLUMN created_by TEXT NOT NULL DEFAULT ''",
+			"ALTER TABLE fanout_jobs ADD COLUMN org_id TEXT NOT NULL DEFAULT ''",
+		},
+		Func: addMySQLJobOwner,
+	},
+	{
+		// Each organization names its gateways independently. The index
+		// keeps its name, so a MySQL rerun drops and rebuilds it again.
+		Version: 11,
+		Name:    "scope gateway names to organizations",
+		Drivers: map[string][]string{
+			"mysql": {`ALTER TABLE gateways
+        DROP INDEX idx_gateways_live_name,
+        ADD UNIQUE INDEX idx_gateways_live_name (org_id, live_name)`},
+		},
+		Up: []string{
+			"DROP INDEX IF EXISTS idx_gateways_live_name",
+			"CREATE UNIQUE INDEX IF NOT EXISTS idx_gateways_live_name ON gateways (org_id, name) WHERE deleted_at IS NULL",
+		},
+	},
+}
+
+// toJSONBFuncSQL creates a session-local function converting a text column
+// to JSONB. Malformed values, which non-strict reads already treat as empty,
+// become empty objects rather than failing the migration.
+const toJSONBFuncSQL = `
+CREATE OR REPLACE FUNCTION pg_temp.lt_to_jsonb(t TEXT) RETURNS JSONB LANGUAGE plpgsql AS $$
+BEGIN
+    RETURN t::jsonb;
+EXCEPTION WHEN invalid_text_representation THEN
+    RETURN '{}'::jsonb;
+END
+$$`
+
+// postgresJSONBColumns returns the statements converting the gateway JSON
+// columns to JSONB in place. A text default cannot be cast to JSONB, so each
+// column's default is dropped first and set again after.
+func postgresJSONBColumns() []string {
+	stmts := []string{toJSONBFuncSQL}
+	for _, col := range []string{"transport_params", "auth_params", "labels"} {
+		stmts = append(stmts,
+			fmt.Sprintf("ALTER TABLE gateways ALTER COLUMN %s DROP DEFAULT", col),
+			fmt.Sprintf("ALTER TABLE gateways ALTER COLUMN %s TYPE JSONB USING pg_temp.lt_to_jsonb(%s)", col, col),
+			fmt.Sprintf("ALTER TABLE gateways ALTER COLUMN %s SET DEFAULT '{}'", col),
+		)
+	}
+	return append(stmts, "CREATE INDEX IF NOT EXISTS idx_gateways_labels ON gateways USING GIN (labels)")
+}
+
+// addMySQLGroupOrg is migration 9 on MySQL, which cannot add a column only
+// if it is missing; a rerun after the implicit commit finds it there.
+func addMySQLGroupOrg(ctx context.Context, tx *sql.Tx, driver string) error {
+	if driver != "mysql" {
+		return nil
+	}
+	return addMySQLColumns(ctx, tx, "gateway_groups", "org_id", `ALTER TABLE gateway_groups
+        ADD COLUMN org_id VARCHAR(255) NOT NULL DEFAULT '',
+        ADD INDEX idx_gateway_groups_org (org_id)`)
+}
+
+// addMySQLJobOwner is migration 10 on MySQL; see addMySQLGroupOrg.
+func addMySQLJobOwner(ctx context.Context, tx *sql.Tx, driver string) error {
+	if driver != "mysql" {
+		return nil
+	}
+	return addMySQLColumns(ctx, tx, "fanout_jobs", "created_by", `ALTER TABLE fanout_jobs
+        ADD COLUMN created_by VARCHAR(255) NOT NULL DEFAULT '',
+        ADD COLUMN org_id VARCHAR(255) NOT NULL DEFAULT ''`)
+}
+
+// addMySQLColumns runs alter, which adds columns to table, unless column,
+// the first of them, already exists.
+func addMySQLColumns(ctx context.Context, tx *sql.Tx, table, column, alter string) error {
+	var n int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM information_schema.COLUMNS
+        WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`, table, column,
+	).Scan(&n); err != nil {
+		return fmt.Errorf("inspect column %s.%s: %w", table, column, err)
+	}
+	if n > 0 {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, alter); err != nil {
+		return fmt.Errorf("add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
+// legacyColumn is a column added to a table after the table first shipped,
+// before versioned migrations existed. CREATE TABLE IF NOT EXISTS leaves
+// such tables untouched, so migration 2 adds whichever are missing.
+type legacyColumn struct {
+	table      string
+	name       string
+	definition string
+}
+
+// legacyColumns lists added columns in the order they were introduced.
+var legacyColumns = []legacyColumn{
+	{table: "gateway_status_history", name: "error_kind", definition: "TEXT NOT NULL DEFAULT ''"},
+	{table: "gateways", name: "maintenance_reason", definition: "TEXT NOT NULL DEFAULT ''"},
+	{table: "gateways", name: "maintenance_until", definition: "TIMESTAMP"},
+}
+
+// addLegacyColumns adds any legacyColumns missing from existing tables.
+// SQLite has no ADD COLUMN IF NOT EXISTS, so its table info is checked
+// first. MySQL databases never predate migrations, so there is nothing to
+// add.
+func addLegacyColumns(ctx context.Context, tx *sql.Tx, driver string) error {
+	if driver == "mysql" {
+		return nil
+	}
+	for _, c := range legacyColumns {
+		if driver == "postgres" {
+			stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s", c.table, c.name, c.definition)
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("add column %s.%s: %w", c.table, c.name, err)
+			}
+			continue
+		}
+
+		var n int
+		if err := tx.QueryRowContext(ctx,
+			"SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", c.table, c.name,
+		).Scan(&n); err != nil {
+			return fmt.Errorf("inspect column %s.%s: %w", c.table, c.name, err)
+		}
+		if n > 0 {
+			continue
+		}
+		stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.name, c.definition)
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("add column %s.%s: %w", c.table, c.name, err)
+		}
+	}
+	return nil
+}
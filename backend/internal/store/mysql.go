@@ -0,0 +1,1014 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/go-sql-driver/mysql"
+)
+
+// MySQLStore implements Store using MySQL or MariaDB via
+// go-sql-driver/mysql.
+type MySQLStore struct {
+	db     dbtx // the pool, or the transaction the store is bound to
+	pool   *sql.DB
+	strict bool // fail reads of rows with malformed JSON columns
+}
+
+// NewMySQLStore creates a MySQL-backed store. The dsn is in
+// go-sql-driver/mysql's format, e.g.,
+// "lobstertank:pass@tcp(localhost:3306)/lobstertank"; see openMySQL for the
+// options it overrides. MySQL 8.0.13 or MariaDB 10.2 is the oldest server
+// supported. When strict is set, rows with malformed JSON columns fail to
+// load instead of being read back with empty maps. With autoMigrate, pending
+// schema migrations are applied; otherwise the schema must already be
+// current.
+func NewMySQLStore(dsn string, strict, autoMigrate bool) (*MySQLStore, error) {
+	db, err := openMySQL(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := migrate(ctx, db, "mysql", autoMigrate); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	slog.Info("mysql store initialized")
+	return &MySQLStore{db: db, pool: db, strict: strict}, nil
+}
+
+// openMySQL opens a MySQL connection pool and verifies that the server is
+// reachable. Whatever the DSN says, timestamps are parsed into time.Time
+// in UTC, and affected-row counts include rows an UPDATE matched without
+// changing, as the other drivers report them.
+func openMySQL(dsn string) (*sql.DB, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parse mysql dsn: %w", err)
+	}
+	cfg.ParseTime = true
+	cfg.Loc = time.UTC
+	cfg.ClientFoundRows = true
+
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("open mysql connection: %w", err)
+	}
+	db := sql.OpenDB(connector)
+
+	// Configure connection pool.
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(10)
+	db.SetConnMaxLifetime(5 * time.Minute)
+	db.SetConnMaxIdleTime(1 * time.Minute)
+
+	// Verify connectivity.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping mysql: %w", err)
+	}
+	return db, nil
+}
+
+func (s *MySQLStore) ListGateways(ctx context.Context, filter model.GatewayFilter, sort model.ListSort) ([]model.Gateway, error) {
+	return s.listGateways(ctx, false, filter, sort)
+}
+
+func (s *MySQLStore) ListDeletedGateways(ctx context.Context, filter model.GatewayFilter, sort model.ListSort) ([]model.Gateway, error) {
+	return s.listGateways(ctx, true, filter, sort)
+}
+
+func (s *MySQLStore) listGateways(ctx context.Context, deleted bool, filter model.GatewayFilter, sort model.ListSort) ([]model.Gateway, error) {
+	orderBy, err := mysqlOrderByClause(sort)
+	if err != nil {
+		return nil, err
+	}
+	// JSON_CONTAINS matches every label of the selector, as @> does on
+	// Postgres; an empty selector matches every gateway.
+	query := fmt.Sprintf("SELECT %s FROM gateways WHERE %s AND (? = '' OR status = ?) AND JSON_CONTAINS(labels, ?) ORDER BY %s",
+		gatewayColumns, deletedPredicate(deleted), orderBy)
+	rows, err := s.db.QueryContext(ctx, query, string(filter.Status), string(filter.Status), marshalJSONMap(filter.Labels))
+	if err != nil {
+		return nil, fmt.Errorf("query gateways: %w", err)
+	}
+	defer rows.Close()
+
+	gateways := make([]model.Gateway, 0)
+	for rows.Next() {
+		gw, err := scanGateway(rows, s.strict)
+		if err != nil {
+			return nil, fmt.Errorf("scan gateway row: %w", err)
+		}
+		gateways = append(gateways, *gw)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate gateway rows: %w", err)
+	}
+
+	return gateways, nil
+}
+
+// mysqlOrderByClause builds the ORDER BY expression for a listing like
+// orderByClause does. MySQL has no NULLS LAST, so gateways never seen are
+// sorted last by ordering on "column IS NULL" first.
+func mysqlOrderByClause(sort model.ListSort) (string, error) {
+	if sort.Field == "" {
+		return "enrolled_at DESC, id ASC", nil
+	}
+
+	column, ok := sortColumns[sort.Field]
+	if !ok {
+		return "", fmt.Errorf("unknown sort field %q", sort.Field)
+	}
+
+	dir := "ASC"
+	if sort.Descending {
+		dir = "DESC"
+	}
+	return fmt.Sprintf("%s IS NULL, %s %s, id ASC", column, column, dir), nil
+}
+
+func (s *MySQLStore) GetGateway(ctx context.Context, id string) (*model.Gateway, error) {
+	return s.getGateway(ctx, id, false)
+}
+
+func (s *MySQLStore) GetDeletedGateway(ctx context.Context, id string) (*model.Gateway, error) {
+	return s.getGateway(ctx, id, true)
+}
+
+func (s *MySQLStore) getGateway(ctx context.Context, id string, deleted bool) (*model.Gateway, error) {
+	query := fmt.Sprintf("SELECT %s FROM gateways WHERE id = ? AND %s", gatewayColumns, deletedPredicate(deleted))
+	row := s.db.QueryRowContext(ctx, query, id)
+	gw, err := scanGateway(row, s.strict)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
+		return nil, fmt.Errorf("scan gateway: %w", err)
+	}
+	return gw, nil
+}
+
+func (s *MySQLStore) GetGatewayByName(ctx context.Context, orgID, name string) (*model.Gateway, error) {
+	query := fmt.Sprintf("SELECT %s FROM gateways WHERE org_id = ? AND name = ? AND deleted_at IS NULL", gatewayColumns)
+	row := s.db.QueryRowContext(ctx, query, orgID, name)
+	gw, err := scanGateway(row, s.strict)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		return nil, fmt.Errorf("scan gateway: %w", err)
+	}
+	return gw, nil
+}
+
+func (s *MySQLStore) ListGatewaysByIDs(ctx context.Context, ids []string) ([]model.Gateway, []string, error) {
+	if len(ids) == 0 {
+		return []model.Gateway{}, []string{}, nil
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM gateways WHERE id IN (%s) AND deleted_at IS NULL", gatewayColumns, placeholders(len(ids)))
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query gateways: %w", err)
+	}
+	defer rows.Close()
+
+	var found []model.Gateway
+	for rows.Next() {
+		gw, err := scanGateway(rows, s.strict)
+		if err != nil {
+			return nil, nil, fmt.Errorf("scan gateway row: %w", err)
+		}
+		found = append(found, *gw)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("iterate gateway rows: %w", err)
+	}
+
+	gateways, missing := orderGatewaysByIDs(ids, found)
+	return gateways, missing, nil
+}
+
+func (s *MySQLStore) CreateGateway(ctx context.Context, gw *model.Gateway) error {
+	query := `INSERT INTO gateways (
+        id, name, description, endpoint,
+        transport_type, transport_params,
+        auth_type, auth_params, auth_secret_ref,
+        status, labels, enrolled_at, last_seen_at, ttl_seconds, org_id
+    ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	var ttl *int64
+	if gw.TTLSeconds != nil {
+		v := int64(*gw.TTLSeconds)
+		ttl = &v
+	}
+
+	_, err := s.db.ExecContext(ctx, query,
+		gw.ID,
+		gw.Name,
+		gw.Description,
+		gw.Endpoint,
+		gw.Transport.Type,
+		marshalJSONMap(gw.Transport.Params),
+		gw.Auth.Type,
+		marshalJSONMap(gw.Auth.Params),
+		gw.Auth.SecretRef,
+		string(gw.Status),
+		marshalJSONMap(gw.Labels),
+		gw.EnrolledAt.UTC(),
+		utcTime(gw.LastSeenAt),
+		ttl,
+		gw.OrgID,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%w: %s", ErrConflict, gw.Name)
+		}
+		return fmt.Errorf("insert gateway: %w", err)
+	}
+	return nil
+}
+
+func (s *MySQLStore) UpdateGateway(ctx context.Context, gw *model.Gateway) error {
+	query := `UPDATE gateways SET
+        name = ?,
+        description = ?,
+        endpoint = ?,
+        transport_type = ?,
+        transport_params = ?,
+        auth_type = ?,
+        auth_params = ?,
+        auth_secret_ref = ?,
+        status = ?,
+        labels = ?,
+        last_seen_at = ?,
+        ttl_seconds = ?
+    WHERE id = ? AND deleted_at IS NULL`
+
+	var ttl *int64
+	if gw.TTLSeconds != nil {
+		v := int64(*gw.TTLSeconds)
+		ttl = &v
+	}
+
+	result, err := s.db.ExecContext(ctx, query,
+		gw.Name,
+		gw.Description,
+		gw.Endpoint,
+		gw.Transport.Type,
+		marshalJSONMap(gw.Transport.Params),
+		gw.Auth.Type,
+		marshalJSONMap(gw.Auth.Params),
+		gw.Auth.SecretRef,
+		string(gw.Status),
+		marshalJSONMap(gw.Labels),
+		utcTime(gw.LastSeenAt),
+		ttl,
+		gw.ID,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%w: %s", ErrConflict, gw.Name)
+		}
+		return fmt.Errorf("update gateway: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, gw.ID)
+	}
+	return nil
+}
+
+func (s *MySQLStore) DeleteGateway(ctx context.Context, id string, deletedAt time.Time) error {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE gateways SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL", deletedAt.UTC(), id)
+	if err != nil {
+		return fmt.Errorf("delete gateway: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return nil
+}
+
+func (s *MySQLStore) RestoreGateway(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE gateways SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%w: %s", ErrConflict, id)
+		}
+		return fmt.Errorf("restore gateway: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return nil
+}
+
+func (s *MySQLStore) PurgeGateway(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM gateways WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("purge gateway: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return nil
+}
+
+func (s *MySQLStore) UpdateGatewayStatus(ctx context.Context, id string, status string, lastSeen *time.Time) error {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE gateways SET status = ?, last_seen_at = ? WHERE id = ? AND deleted_at IS NULL",
+		status, utcTime(lastSeen), id,
+	)
+	if err != nil {
+		return fmt.Errorf("update gateway status: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return nil
+}
+
+func (s *MySQLStore) SetGatewayMaintenance(ctx context.Context, id string, status string, reason string, until *time.Time) error {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE gateways SET status = ?, maintenance_reason = ?, maintenance_until = ? WHERE id = ? AND deleted_at IS NULL",
+		status, reason, utcTime(until), id,
+	)
+	if err != nil {
+		return fmt.Errorf("update gateway maintenance: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return nil
+}
+
+func (s *MySQLStore) InsertStatusTransition(ctx context.Context, t *model.StatusTransition) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO gateway_status_history (
+            gateway_id, from_status, to_status, latency, error, error_kind, observed_at
+        ) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		t.GatewayID, string(t.From), string(t.To), t.Latency, t.Error, string(t.ErrorKind), t.ObservedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("insert status transition: %w", err)
+	}
+	return nil
+}
+
+func (s *MySQLStore) ListStatusTransitions(ctx context.Context, gatewayID string, since time.Time) ([]model.StatusTransition, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT gateway_id, from_status, to_status, latency, error, error_kind, observed_at
+        FROM gateway_status_history
+        WHERE gateway_id = ? AND observed_at >= ?
+        ORDER BY observed_at ASC`,
+		gatewayID, since.UTC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query status history: %w", err)
+	}
+	defer rows.Close()
+
+	transitions := make([]model.StatusTransition, 0)
+	for rows.Next() {
+		var t model.StatusTransition
+		if err := rows.Scan(&t.GatewayID, &t.From, &t.To, &t.Latency, &t.Error, &t.ErrorKind, &t.ObservedAt); err != nil {
+			return nil, fmt.Errorf("scan status transition: %w", err)
+		}
+		transitions = append(transitions, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate status history rows: %w", err)
+	}
+	return transitions, nil
+}
+
+func (s *MySQLStore) PruneStatusHistory(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx,
+		"DELETE FROM gateway_status_history WHERE observed_at < ?", before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("prune status history: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("check rows affected: %w", err)
+	}
+	return n, nil
+}
+
+func (s *MySQLStore) InsertHealthCheck(ctx context.Context, r *model.HealthCheckResult, checkedAt time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO gateway_health_history (
+            gateway_id, status, latency, latency_ms, error, error_kind, attempts, checked_at
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.GatewayID, string(r.Status), r.Latency, r.LatencyMillis, r.Error, string(r.ErrorKind), r.Attempts, checkedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("insert health check: %w", err)
+	}
+	return nil
+}
+
+func (s *MySQLStore) ListHealthChecks(ctx context.Context, gatewayID string, limit int) ([]model.HealthCheckResult, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT gateway_id, status, latency, latency_ms, error, error_kind, attempts, checked_at
+        FROM gateway_health_history
+        WHERE gateway_id = ?
+        ORDER BY checked_at DESC
+        LIMIT ?`,
+		gatewayID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query health history: %w", err)
+	}
+	defer rows.Close()
+
+	checks := make([]model.HealthCheckResult, 0)
+	for rows.Next() {
+		var (
+			r         model.HealthCheckResult
+			checkedAt time.Time
+		)
+		if err := rows.Scan(&r.GatewayID, &r.Status, &r.Latency, &r.LatencyMillis, &r.Error, &r.ErrorKind, &r.Attempts, &checkedAt); err != nil {
+			return nil, fmt.Errorf("scan health check: %w", err)
+		}
+		r.CheckedAt = checkedAt.UTC().Format(time.RFC3339)
+		checks = append(checks, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate health history rows: %w", err)
+	}
+	return checks, nil
+}
+
+func (s *MySQLStore) PruneHealthChecks(ctx context.Context, gatewayID string, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx,
+		"DELETE FROM gateway_health_history WHERE gateway_id = ? AND checked_at < ?", gatewayID, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("prune health history: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("check rows affected: %w", err)
+	}
+	return n, nil
+}
+
+func (s *MySQLStore) ListGroups(ctx context.Context) ([]model.Group, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT id, name, description, created_at, org_id FROM gateway_groups ORDER BY name ASC")
+	if err != nil {
+		return nil, fmt.Errorf("query groups: %w", err)
+	}
+	defer rows.Close()
+
+	groups := make([]model.Group, 0)
+	for rows.Next() {
+		var g model.Group
+		if err := rows.Scan(&g.ID, &g.Name, &g.Description, &g.CreatedAt, &g.OrgID); err != nil {
+			return nil, fmt.Errorf("scan group row: %w", err)
+		}
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate group rows: %w", err)
+	}
+	rows.Close()
+
+	for i := range groups {
+		members, err := s.groupMembers(ctx, groups[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		groups[i].GatewayIDs = members
+	}
+	return groups, nil
+}
+
+func (s *MySQLStore) GetGroup(ctx context.Context, id string) (*model.Group, error) {
+	var g model.Group
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, name, description, created_at, org_id FROM gateway_groups WHERE id = ?", id,
+	).Scan(&g.ID, &g.Name, &g.Description, &g.CreatedAt, &g.OrgID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrGroupNotFound, id)
+		}
+		return nil, fmt.Errorf("scan group: %w", err)
+	}
+
+	members, err := s.groupMembers(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	g.GatewayIDs = members
+	return &g, nil
+}
+
+func (s *MySQLStore) CreateGroup(ctx context.Context, g *model.Group) error {
+	tx, err := beginTx(ctx, s.pool, s.db)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }() // no-op after commit
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO gateway_groups (id, name, description, created_at, org_id) VALUES (?, ?, ?, ?, ?)",
+		g.ID, g.Name, g.Description, g.CreatedAt.UTC(), g.OrgID,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%w: %s", ErrGroupConflict, g.Name)
+		}
+		return fmt.Errorf("insert group: %w", err)
+	}
+
+	if err := insertGroupMembers(ctx, tx.Tx, "?", "?", g); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *MySQLStore) UpdateGroup(ctx context.Context, g *model.Group) error {
+	tx, err := beginTx(ctx, s.pool, s.db)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }() // no-op after commit
+
+	result, err := tx.ExecContext(ctx,
+		"UPDATE gateway_groups SET name = ?, description = ? WHERE id = ?",
+		g.Name, g.Description, g.ID,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%w: %s", ErrGroupConflict, g.Name)
+		}
+		return fmt.Errorf("update group: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrGroupNotFound, g.ID)
+	}
+
+	// Deleted members are kept, so restoring them puts them back in the group.
+	if _, err := tx.ExecContext(ctx,
+		"DELETE FROM gateway_group_members WHERE group_id = ? AND gateway_id IN (SELECT id FROM gateways WHERE deleted_at IS NULL)",
+		g.ID,
+	); err != nil {
+		return fmt.Errorf("clear group members: %w", err)
+	}
+	if err := insertGroupMembers(ctx, tx.Tx, "?", "?", g); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *MySQLStore) DeleteGroup(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM gateway_groups WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete group: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrGroupNotFound, id)
+	}
+	return nil
+}
+
+func (s *MySQLStore) groupMembers(ctx context.Context, groupID string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT m.gateway_id
+        FROM gateway_group_members m JOIN gateways g ON g.id = m.gateway_id
+        WHERE m.group_id = ? AND g.deleted_at IS NULL
+        ORDER BY m.gateway_id`, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("query group members: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan group member: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate group member rows: %w", err)
+	}
+	return ids, nil
+}
+
+func (s *MySQLStore) ListSecrets(ctx context.Context) (map[string]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT ref, value FROM secrets")
+	if err != nil {
+		return nil, fmt.Errorf("query secrets: %w", err)
+	}
+	defer rows.Close()
+
+	secrets := make(map[string]string)
+	for rows.Next() {
+		var ref, value string
+		if err := rows.Scan(&ref, &value); err != nil {
+			return nil, fmt.Errorf("scan secret: %w", err)
+		}
+		secrets[ref] = value
+	}
+	return secrets, rows.Err()
+}
+
+func (s *MySQLStore) PutSecret(ctx context.Context, ref, value string) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO secrets (ref, value) VALUES (?, ?) ON DUPLICATE KEY UPDATE value = VALUES(value)",
+		ref, value,
+	)
+	if err != nil {
+		return fmt.Errorf("put secret: %w", err)
+	}
+	return nil
+}
+
+func (s *MySQLStore) DeleteSecret(ctx context.Context, ref string) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM secrets WHERE ref = ?", ref); err != nil {
+		return fmt.Errorf("delete secret: %w", err)
+	}
+	return nil
+}
+
+func (s *MySQLStore) GetIdempotencyKey(ctx context.Context, key string) (string, error) {
+	var gatewayID string
+	err := s.db.QueryRowContext(ctx, "SELECT gateway_id FROM idempotency_keys WHERE `key` = ?", key).Scan(&gatewayID)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("%w: idempotency key %q", ErrNotFound, key)
+	}
+	if err != nil {
+		return "", fmt.Errorf("get idempotency key: %w", err)
+	}
+	return gatewayID, nil
+}
+
+func (s *MySQLStore) PutIdempotencyKey(ctx context.Context, key, gatewayID string, createdAt time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO idempotency_keys (`key`, gateway_id, created_at) VALUES (?, ?, ?) "+
+			"ON DUPLICATE KEY UPDATE gateway_id = VALUES(gateway_id), created_at = VALUES(created_at)",
+		key, gatewayID, createdAt,
+	)
+	if err != nil {
+		return fmt.Errorf("put idempotency key: %w", err)
+	}
+	return nil
+}
+
+func (s *MySQLStore) CreateFanOutJob(ctx context.Context, job *model.FanOutJob) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO fanout_jobs (id, status, total, created_by, org_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		job.ID, string(job.Status), job.Total, job.CreatedBy, job.OrgID, job.CreatedAt.UTC(), job.UpdatedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("insert fan-out job: %w", err)
+	}
+	return nil
+}
+
+func (s *MySQLStore) GetFanOutJob(ctx context.Context, id string) (*model.FanOutJob, error) {
+	var job model.FanOutJob
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, status, total, created_by, org_id, created_at, updated_at FROM fanout_jobs WHERE id = ?", id,
+	).Scan(&job.ID, &job.Status, &job.Total, &job.CreatedBy, &job.OrgID, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+		}
+		return nil, fmt.Errorf("scan fan-out job: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT position, gateway_id, gateway_name, response, error, skipped, skip_reason, latency_ms, completed_at
+        FROM fanout_results
+        WHERE job_id = ?
+        ORDER BY position ASC`, id)
+	if err != nil {
+		return nil, fmt.Errorf("query fan-out results: %w", err)
+	}
+	defer rows.Close()
+
+	job.Results = make([]model.FanOutJobResult, 0, job.Total)
+	for rows.Next() {
+		var r model.FanOutJobResult
+		if err := rows.Scan(&r.Position, &r.GatewayID, &r.GatewayName, &r.Response, &r.Error,
+			&r.Skipped, &r.SkipReason, &r.LatencyMillis, &r.CompletedAt); err != nil {
+			return nil, fmt.Errorf("scan fan-out result: %w", err)
+		}
+		job.Results = append(job.Results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate fan-out result rows: %w", err)
+	}
+	return &job, nil
+}
+
+func (s *MySQLStore) UpdateFanOutJobStatus(ctx context.Context, id string, status model.JobStatus, updatedAt time.Time) error {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE fanout_jobs SET status = ?, updated_at = ? WHERE id = ?",
+		string(status), updatedAt.UTC(), id,
+	)
+	if err != nil {
+		return fmt.Errorf("update fan-out job status: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	return nil
+}
+
+func (s *MySQLStore) InsertFanOutResult(ctx context.Context, jobID string, r *model.FanOutJobResult) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO fanout_results (
+            job_id, position, gateway_id, gateway_name, response, error, skipped, skip_reason, latency_ms, completed_at
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		jobID, r.Position, r.GatewayID, r.GatewayName, r.Response, r.Error,
+		r.Skipped, r.SkipReason, r.LatencyMillis, r.CompletedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("insert fan-out result: %w", err)
+	}
+	return nil
+}
+
+func (s *MySQLStore) DeleteFanOutJob(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM fanout_jobs WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete fan-out job: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	return nil
+}
+
+func (s *MySQLStore) PruneFanOutJobs(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx,
+		"DELETE FROM fanout_jobs WHERE updated_at < ?", before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("prune fan-out jobs: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("check rows affected: %w", err)
+	}
+	return n, nil
+}
+
+func (s *MySQLStore) AddUsage(ctx context.Context, gatewayID string, hour time.Time, u model.Usage) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO gateway_usage (
+            gateway_id, model, hour, requests, prompt_tokens, completion_tokens
+        ) VALUES (?, ?, ?, 1, ?, ?)
+        ON DUPLICATE KEY UPDATE
+            requests          = requests + 1,
+            prompt_tokens     = prompt_tokens + VALUES(prompt_tokens),
+            completion_tokens = completion_tokens + VALUES(completion_tokens)`,
+		gatewayID, u.Model, hour.UTC(), u.PromptTokens, u.CompletionTokens,
+	)
+	if err != nil {
+		return fmt.Errorf("add usage: %w", err)
+	}
+	return nil
+}
+
+func (s *MySQLStore) ListUsage(ctx context.Context, gatewayID string, since time.Time) ([]model.UsageTotals, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT gateway_id, model, SUM(requests), SUM(prompt_tokens), SUM(completion_tokens)
+        FROM gateway_usage
+        WHERE hour >= ? AND (? = '' OR gateway_id = ?)
+        GROUP BY gateway_id, model
+        ORDER BY gateway_id, model`,
+		since.UTC(), gatewayID, gatewayID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query usage: %w", err)
+	}
+	defer rows.Close()
+
+	usage := make([]model.UsageTotals, 0)
+	for rows.Next() {
+		var u model.UsageTotals
+		if err := rows.Scan(&u.GatewayID, &u.Model, &u.Requests, &u.PromptTokens, &u.CompletionTokens); err != nil {
+			return nil, fmt.Errorf("scan usage: %w", err)
+		}
+		usage = append(usage, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate usage rows: %w", err)
+	}
+	return usage, nil
+}
+
+func (s *MySQLStore) AppendAuditEvent(ctx context.Context, e *model.AuditEvent) error {
+	result, err := s.db.ExecContext(ctx,
+		`INSERT INTO audit_events (timestamp, action, resource, subject, detail, request_id)
+        VALUES (?, ?, ?, ?, ?, ?)`,
+		e.Timestamp.UTC(), e.Action, e.Resource, e.Subject, e.Detail, e.RequestID,
+	)
+	if err != nil {
+		return fmt.Errorf("insert audit event: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("read audit event id: %w", err)
+	}
+	e.ID = id
+	return nil
+}
+
+func (s *MySQLStore) ListAuditEvents(ctx context.Context, q model.AuditQuery) ([]model.AuditEvent, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+auditEventColumns+`
+        FROM audit_events
+        WHERE (? = '' OR action = ?) AND (? = '' OR resource = ?)
+          AND timestamp >= ? AND timestamp < ? AND (? = 0 OR id < ?)
+        ORDER BY id DESC
+        LIMIT ?`,
+		q.Action, q.Action, q.Resource, q.Resource,
+		q.Since.UTC(), auditUntil(q), q.BeforeID, q.BeforeID, q.Limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query audit events: %w", err)
+	}
+	return scanAuditEvents(rows)
+}
+
+func (s *MySQLStore) PruneAuditEvents(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx,
+		"DELETE FROM audit_events WHERE timestamp < ?", before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("prune audit events: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("check rows affected: %w", err)
+	}
+	return n, nil
+}
+
+func (s *MySQLStore) CreateAPIKey(ctx context.Context, k *model.APIKey) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO api_keys (id, name, key_hash, roles, org_id, created_by, created_at, expires_at, last_used_at, revoked)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		k.ID, k.Name, k.Hash, marshalRoles(k.Roles), k.Org, k.CreatedBy,
+		k.CreatedAt.UTC(), utcTime(k.ExpiresAt), utcTime(k.LastUsedAt), k.Revoked,
+	)
+	if err != nil {
+		return fmt.Errorf("insert api key: %w", err)
+	}
+	return nil
+}
+
+func (s *MySQLStore) GetAPIKey(ctx context.Context, id string) (*model.APIKey, error) {
+	k, err := scanAPIKey(s.db.QueryRowContext(ctx,
+		"SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id)
+		}
+		return nil, fmt.Errorf("scan api key: %w", err)
+	}
+	return k, nil
+}
+
+func (s *MySQLStore) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+apiKeyColumns+" FROM api_keys ORDER BY created_at ASC, id ASC")
+	if err != nil {
+		return nil, fmt.Errorf("query api keys: %w", err)
+	}
+	return scanAPIKeys(rows)
+}
+
+func (s *MySQLStore) RevokeAPIKey(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE api_keys SET revoked = TRUE WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("revoke api key: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id)
+	}
+	return nil
+}
+
+func (s *MySQLStore) DeleteAPIKey(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM api_keys WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete api key: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id)
+	}
+	return nil
+}
+
+func (s *MySQLStore) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = ? WHERE id = ?", usedAt.UTC(), id)
+	if err != nil {
+		return fmt.Errorf("touch api key: %w", err)
+	}
+	return nil
+}
+
+func (s *MySQLStore) InTx(ctx context.Context, fn func(Store) error) error {
+	tx, err := beginTx(ctx, s.pool, s.db)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }() // no-op after commit
+
+	bound := *s
+	bound.db = tx.Tx
+	if err := fn(&bound); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *MySQLStore) Ping(ctx context.Context) error {
+	if err := s.pool.PingContext(ctx); err != nil {
+		return fmt.Errorf("ping mysql: %w", err)
+	}
+	return nil
+}
+
+func (s *MySQLStore) Close() error {
+	return s.pool.Close()
+}
@@ -0,0 +1,81 @@
+//go:build integration
+
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/AdamPippert/Lobstertank/internal/store"
+	"github.com/AdamPippert/Lobstertank/internal/store/storetest"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// TestMySQLConformance runs the suite against the MySQL or MariaDB database
+// at LT_TEST_MYSQL_DSN, emptying its tables before every subtest. It is
+// skipped when the variable is unset.
+func TestMySQLConformance(t *testing.T) {
+	dsn := os.Getenv("LT_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("LT_TEST_MYSQL_DSN is not set")
+	}
+
+	storetest.RunConformance(t, func() store.Store {
+		s, err := store.NewMySQLStore(dsn, false, true)
+		if err != nil {
+			t.Fatalf("NewMySQLStore: %v", err)
+		}
+		truncateMySQL(t, dsn)
+		return s
+	})
+}
+
+// truncateMySQL deletes every row the store keeps, leaving the schema and
+// its migration history in place.
+func truncateMySQL(t *testing.T, dsn string) {
+	t.Helper()
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatalf("open mysql: %v", err)
+	}
+	defer db.Close()
+
+	// Foreign key checks are per session, so everything runs on one
+	// connection.
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("connect to mysql: %v", err)
+	}
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(ctx, `SELECT table_name FROM information_schema.tables
+        WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE' AND table_name <> 'schema_migrations'`)
+	if err != nil {
+		t.Fatalf("list tables: %v", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("scan table name: %v", err)
+		}
+		tables = append(tables, "`"+strings.ReplaceAll(name, "`", "``")+"`")
+	}
+	rows.Close()
+
+	if _, err := conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 0"); err != nil {
+		t.Fatalf("disable foreign key checks: %v", err)
+	}
+	for _, name := range tables {
+		if _, err := conn.ExecContext(ctx, "TRUNCATE TABLE "+name); err != nil {
+			t.Fatalf("truncate %s: %v", name, err)
+		}
+	}
+	if _, err := conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 1"); err != nil {
+		t.Fatalf("enable foreign key checks: %v", err)
+	}
+}
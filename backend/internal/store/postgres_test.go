@@ -0,0 +1,150 @@
+//go:build integration
+
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+	"github.com/AdamPippert/Lobstertank/internal/store/storetest"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// TestPostgresConformance runs the suite against the Postgres database at
+// LT_TEST_POSTGRES_DSN, emptying its tables before every subtest. It is
+// skipped when the variable is unset.
+func TestPostgresConformance(t *testing.T) {
+	dsn := os.Getenv("LT_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("LT_TEST_POSTGRES_DSN is not set")
+	}
+
+	storetest.RunConformance(t, func() store.Store {
+		s, err := store.NewPostgresStore(dsn, false, true, 0)
+		if err != nil {
+			t.Fatalf("NewPostgresStore: %v", err)
+		}
+		truncatePostgres(t, dsn)
+		return s
+	})
+}
+
+// truncatePostgres deletes every row the store keeps, leaving the schema
+// and its migration history in place.
+func truncatePostgres(t *testing.T, dsn string) {
+	t.Helper()
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatalf("open postgres: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	rows, err := db.QueryContext(ctx, `SELECT quote_ident(tablename) FROM pg_tables
+        WHERE schemaname = current_schema() AND tablename <> 'schema_migrations'`)
+	if err != nil {
+		t.Fatalf("list tables: %v", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("scan table name: %v", err)
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	for _, name := range tables {
+		if _, err := db.ExecContext(ctx, "TRUNCATE "+name+" CASCADE"); err != nil {
+			t.Fatalf("truncate %s: %v", name, err)
+		}
+	}
+}
+
+// TestPostgresChangeFeed checks that gateway writes through either of two
+// stores sharing the database reach a listener on one of them, marked local
+// only when made through that store.
+func TestPostgresChangeFeed(t *testing.T) {
+	dsn := os.Getenv("LT_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("LT_TEST_POSTGRES_DSN is not set")
+	}
+	open := func() store.Store {
+		s, err := store.New(config.DatabaseConfig{Driver: "postgres", DSN: dsn, AutoMigrate: true, NotifyChanges: true})
+		if err != nil {
+			t.Fatalf("store.New: %v", err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	}
+	local, remote := open(), open()
+	truncatePostgres(t, dsn)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ready := make(chan struct{})
+	changes := make(chan store.Change, 16)
+	errc := make(chan error, 1)
+	go func() {
+		feed := store.Unwrap(local).(store.ChangeFeed)
+		errc <- feed.WatchChanges(ctx, func() { close(ready) }, func(c store.Change) { changes <- c })
+	}()
+	select {
+	case <-ready:
+	case err := <-errc:
+		t.Fatalf("WatchChanges: %v", err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("WatchChanges never started listening")
+	}
+
+	enrolled := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	transition := &model.StatusTransition{GatewayID: "gw-1", From: model.StatusUnknown, To: model.StatusOnline, ObservedAt: enrolled}
+	for _, tt := range []struct {
+		name  string
+		write func(s store.Store) error
+		via   store.Store
+		want  store.ChangeKind
+	}{
+		{"created", func(s store.Store) error {
+			return s.CreateGateway(ctx, &model.Gateway{
+				ID: "gw-1", Name: "alpha", Endpoint: "https://alpha.example.com",
+				Transport: model.TransportConfig{Type: "https"}, Status: model.StatusUnknown, EnrolledAt: enrolled,
+			})
+		}, remote, store.ChangeCreated},
+		{"maintenance", func(s store.Store) error {
+			return s.SetGatewayMaintenance(ctx, "gw-1", string(model.StatusMaintenance), "upgrade", nil)
+		}, local, store.ChangeMaintenance},
+		{"status", func(s store.Store) error { return s.InsertStatusTransition(ctx, transition) }, remote, store.ChangeStatus},
+		{"deleted", func(s store.Store) error { return s.DeleteGateway(ctx, "gw-1", enrolled) }, local, store.ChangeDeleted},
+		{"purged", func(s store.Store) error { return s.PurgeGateway(ctx, "gw-1") }, remote, store.ChangePurged},
+	} {
+		if err := tt.write(tt.via); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		select {
+		case c := <-changes:
+			if c.Kind != tt.want || c.GatewayID != "gw-1" || c.Local != (tt.via == local) {
+				t.Errorf("%s: got %+v, want a %s change to gw-1 with Local %t", tt.name, c, tt.want, tt.via == local)
+			}
+			if tt.want == store.ChangeStatus {
+				var got model.StatusTransition
+				if err := json.Unmarshal(c.Data, &got); err != nil || got.To != model.StatusOnline {
+					t.Errorf("status change data = %s, want the transition", c.Data)
+				}
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s: no change notification", tt.name)
+		}
+	}
+
+	cancel()
+	if err := <-errc; err == nil {
+		t.Error("WatchChanges returned nil after cancel")
+	}
+}
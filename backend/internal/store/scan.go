@@ -1,10 +1,19 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
 )
 
 // scanner abstracts sql.Row and sql.Rows for shared scanning logic.
@@ -12,8 +21,9 @@ type scanner interface {
 	Scan(dest ...any) error
 }
 
-// scanGateway reads a single row into a model.Gateway.
-func scanGateway(row scanner) (*model.Gateway, error) {
+// scanGateway reads a single row into a model.Gateway. Malformed JSON columns
+// are an error in strict mode; otherwise they are logged and read as empty.
+func scanGateway(row scanner, strict bool) (*model.Gateway, error) {
 	var (
 		gw              model.Gateway
 		transportParams string
@@ -21,6 +31,8 @@ func scanGateway(row scanner) (*model.Gateway, error) {
 		labels          string
 		lastSeenAt      sql.NullTime
 		ttlSeconds      sql.NullInt64
+		maintUntil      sql.NullTime
+		deletedAt       sql.NullTime
 	)
 
 	err := row.Scan(
@@ -38,36 +50,151 @@ func scanGateway(row scanner) (*model.Gateway, error) {
 		&gw.EnrolledAt,
 		&lastSeenAt,
 		&ttlSeconds,
+		&gw.MaintenanceReason,
+		&maintUntil,
+		&gw.OrgID,
+		&deletedAt,
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := json.Unmarshal([]byte(transportParams), &gw.Transport.Params); err != nil {
-		gw.Transport.Params = map[string]string{}
+	if err := decodeJSONMap(gw.ID, "transport_params", transportParams, &gw.Transport.Params, strict, false); err != nil {
+		return nil, err
 	}
-	if err := json.Unmarshal([]byte(authParams), &gw.Auth.Params); err != nil {
-		gw.Auth.Params = map[string]string{}
+	// auth_params may hold inline credentials, so its raw value is never logged.
+	if err := decodeJSONMap(gw.ID, "auth_params", authParams, &gw.Auth.Params, strict, true); err != nil {
+		return nil, err
 	}
-	if err := json.Unmarshal([]byte(labels), &gw.Labels); err != nil {
-		gw.Labels = map[string]string{}
+	if err := decodeJSONMap(gw.ID, "labels", labels, &gw.Labels, strict, false); err != nil {
+		return nil, err
 	}
 
+	gw.EnrolledAt = gw.EnrolledAt.UTC()
 	if lastSeenAt.Valid {
-		gw.LastSeenAt = &lastSeenAt.Time
+		gw.LastSeenAt = utcTime(&lastSeenAt.Time)
 	}
 	if ttlSeconds.Valid {
 		v := int(ttlSeconds.Int64)
 		gw.TTLSeconds = &v
 	}
+	if maintUntil.Valid {
+		gw.MaintenanceUntil = utcTime(&maintUntil.Time)
+	}
+	if deletedAt.Valid {
+		gw.DeletedAt = utcTime(&deletedAt.Time)
+	}
 
 	return &gw, nil
 }
 
+// decodeJSONMap unmarshals a stored JSON object column. On malformed input it
+// returns an error in strict mode, and otherwise logs the offending gateway
+// and column and falls back to an empty map.
+func decodeJSONMap(id, column, raw string, dst *map[string]string, strict, sensitive bool) error {
+	err := json.Unmarshal([]byte(raw), dst)
+	if err == nil {
+		return nil
+	}
+	if strict {
+		return fmt.Errorf("gateway %s: malformed %s column: %w", id, column, err)
+	}
+
+	attrs := []any{"id", id, "column", column, "error", err}
+	if sensitive {
+		attrs = append(attrs, "length", len(raw))
+	} else {
+		attrs = append(attrs, "value", raw)
+	}
+	slog.Warn("discarding malformed JSON column", attrs...)
+
+	*dst = map[string]string{}
+	return nil
+}
+
 // gatewayColumns is the ordered column list for SELECT queries.
 const gatewayColumns = `id, name, description, endpoint, transport_type, transport_params,
     auth_type, auth_params, auth_secret_ref, status, labels,
-    enrolled_at, last_seen_at, ttl_seconds`
+    enrolled_at, last_seen_at, ttl_seconds, maintenance_reason, maintenance_until, org_id, deleted_at`
+
+// placeholders returns n comma-separated ? placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// orderGatewaysByIDs arranges the gateways a ListGatewaysByIDs query found
+// in the order of ids, without repeats, and lists the IDs not found.
+func orderGatewaysByIDs(ids []string, found []model.Gateway) ([]model.Gateway, []string) {
+	byID := make(map[string]*model.Gateway, len(found))
+	for i := range found {
+		byID[found[i].ID] = &found[i]
+	}
+
+	gateways := make([]model.Gateway, 0, len(found))
+	missing := make([]string, 0)
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if gw, ok := byID[id]; ok {
+			gateways = append(gateways, *gw)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	return gateways, missing
+}
+
+// deletedPredicate selects either the deleted gateways or the rest.
+func deletedPredicate(deleted bool) string {
+	if deleted {
+		return "deleted_at IS NOT NULL"
+	}
+	return "deleted_at IS NULL"
+}
+
+// sortColumns whitelists the columns a listing may be ordered by. Only
+// values from this map are ever interpolated into ORDER BY.
+var sortColumns = map[string]string{
+	"name":         "name",
+	"enrolled_at":  "enrolled_at",
+	"last_seen_at": "last_seen_at",
+	"status":       "status",
+}
+
+// orderByClause builds the ORDER BY expression for a listing. Gateways never
+// seen sort last in either direction, and the ID breaks ties so paging is
+// stable across both drivers.
+func orderByClause(sort model.ListSort) (string, error) {
+	if sort.Field == "" {
+		return "enrolled_at DESC, id ASC", nil
+	}
+
+	column, ok := sortColumns[sort.Field]
+	if !ok {
+		return "", fmt.Errorf("unknown sort field %q", sort.Field)
+	}
+
+	dir := "ASC"
+	if sort.Descending {
+		dir = "DESC"
+	}
+	return fmt.Sprintf("%s %s NULLS LAST, id ASC", column, dir), nil
+}
+
+// utcTime returns t in UTC, or nil for a nil t. Timestamps are stored and
+// returned in UTC by both drivers: a TIMESTAMP column keeps no zone, so
+// Postgres would otherwise store the wall-clock time of whatever zone t
+// was in, and SQLite would keep the zone in its text form.
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
 
 // marshalJSONMap serializes a map to a JSON string for storage.
 func marshalJSONMap(m map[string]string) string {
@@ -81,3 +208,127 @@ func marshalJSONMap(m map[string]string) string {
 	return string(data)
 }
 
+// insertGroupMembers writes a group's membership rows within tx. The
+// placeholders are passed in because the drivers use different syntax.
+func insertGroupMembers(ctx context.Context, tx *sql.Tx, p1, p2 string, g *model.Group) error {
+	query := fmt.Sprintf("INSERT INTO gateway_group_members (group_id, gateway_id) VALUES (%s, %s)", p1, p2)
+	for _, gwID := range g.GatewayIDs {
+		if _, err := tx.ExecContext(ctx, query, g.ID, gwID); err != nil {
+			return fmt.Errorf("insert group member %s: %w", gwID, err)
+		}
+	}
+	return nil
+}
+
+// isUniqueViolation reports whether err is a unique-constraint violation from
+// either supported driver.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505"
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+			sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1062 // ER_DUP_ENTRY
+	}
+	return false
+}
+
+// apiKeyColumns is the ordered column list for API key queries.
+const apiKeyColumns = `id, name, key_hash, roles, org_id, created_by, created_at, expires_at, last_used_at, revoked`
+
+// scanAPIKey reads a row selected with apiKeyColumns. Malformed roles are an
+// error whatever the strict setting, since guessing at them could grant
+// access.
+func scanAPIKey(row scanner) (*model.APIKey, error) {
+	var (
+		k          model.APIKey
+		roles      string
+		expiresAt  sql.NullTime
+		lastUsedAt sql.NullTime
+	)
+	err := row.Scan(&k.ID, &k.Name, &k.Hash, &roles, &k.Org, &k.CreatedBy, &k.CreatedAt, &expiresAt, &lastUsedAt, &k.Revoked)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(roles), &k.Roles); err != nil {
+		return nil, fmt.Errorf("api key %s: malformed roles column: %w", k.ID, err)
+	}
+	if k.Roles == nil {
+		k.Roles = []string{}
+	}
+	k.CreatedAt = k.CreatedAt.UTC()
+	if expiresAt.Valid {
+		k.ExpiresAt = utcTime(&expiresAt.Time)
+	}
+	if lastUsedAt.Valid {
+		k.LastUsedAt = utcTime(&lastUsedAt.Time)
+	}
+	return &k, nil
+}
+
+// scanAPIKeys reads API key rows selected with apiKeyColumns.
+func scanAPIKeys(rows *sql.Rows) ([]model.APIKey, error) {
+	defer rows.Close()
+
+	keys := make([]model.APIKey, 0)
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan api key: %w", err)
+		}
+		keys = append(keys, *k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate api key rows: %w", err)
+	}
+	return keys, nil
+}
+
+// marshalRoles serializes a role list to a JSON string for storage.
+func marshalRoles(roles []string) string {
+	if roles == nil {
+		return "[]"
+	}
+	data, err := json.Marshal(roles)
+	if err != nil {
+		return "[]"
+	}
+	return string(data)
+}
+
+// auditEventColumns is the ordered column list for audit event queries.
+const auditEventColumns = `id, timestamp, action, resource, subject, detail, request_id`
+
+// auditUntil returns the exclusive upper time bound of an audit query; a
+// zero Until leaves the window open.
+func auditUntil(q model.AuditQuery) time.Time {
+	if q.Until.IsZero() {
+		return time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+	}
+	return q.Until.UTC()
+}
+
+// scanAuditEvents reads audit event rows selected with auditEventColumns.
+func scanAuditEvents(rows *sql.Rows) ([]model.AuditEvent, error) {
+	defer rows.Close()
+
+	events := make([]model.AuditEvent, 0)
+	for rows.Next() {
+		var e model.AuditEvent
+		if err := rows.Scan(&e.ID, &e.Timestamp, &e.Action, &e.Resource, &e.Subject, &e.Detail, &e.RequestID); err != nil {
+			return nil, fmt.Errorf("scan audit event: %w", err)
+		}
+		e.Timestamp = e.Timestamp.UTC()
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate audit event rows: %w", err)
+	}
+	return events, nil
+}
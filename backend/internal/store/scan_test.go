@@ -0,0 +1,129 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// captureLogs sends the default logger's output to the returned buffer
+// until the test ends.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func TestDecodeJSONMap(t *testing.T) {
+	tests := []struct {
+		name      string
+		raw       string
+		strict    bool
+		sensitive bool
+		want      map[string]string
+		wantErr   bool
+		wantLog   string // logged when not strict; "" expects no log
+		notLogged string
+	}{
+		{name: "valid", raw: `{"env":"prod"}`, want: map[string]string{"env": "prod"}},
+		{name: "valid strict", raw: `{"env":"prod"}`, strict: true, want: map[string]string{"env": "prod"}},
+		{name: "malformed strict", raw: `{"env":`, strict: true, wantErr: true},
+		{name: "malformed", raw: `{"env":`, want: map[string]string{}, wantLog: `value="{\"env\":"`},
+		{name: "malformed sensitive", raw: `{"token":"s3cret"`, sensitive: true, want: map[string]string{},
+			wantLog: "length=17", notLogged: "s3cret"},
+		{name: "wrong type", raw: `["a"]`, want: map[string]string{}, wantLog: "column=labels"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			var got map[string]string
+			err := decodeJSONMap("gw-1", "labels", tt.raw, &got, tt.strict, tt.sensitive)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeJSONMap error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !strings.Contains(err.Error(), "gw-1") || !strings.Contains(err.Error(), "labels") {
+					t.Errorf("error %q does not name the gateway and column", err)
+				}
+				return
+			}
+			if len(got) != len(tt.want) || got == nil {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			}
+			switch {
+			case tt.wantLog == "" && logs.Len() > 0:
+				t.Errorf("unexpected log: %s", logs)
+			case !strings.Contains(logs.String(), tt.wantLog):
+				t.Errorf("log %q does not contain %q", logs, tt.wantLog)
+			case tt.notLogged != "" && strings.Contains(logs.String(), tt.notLogged):
+				t.Errorf("log %q leaks %q", logs, tt.notLogged)
+			}
+		})
+	}
+}
+
+func TestScanGatewayMalformedColumn(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "lobstertank.db")
+	lenient, err := NewSQLiteStore(path, false, true)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { lenient.Close() })
+	gw := &model.Gateway{
+		ID:        "gw-1",
+		Name:      "alpha",
+		Endpoint:  "https://alpha.example.com",
+		Transport: model.TransportConfig{Type: "https", Params: map[string]string{"insecure": "true"}},
+		Auth:      model.GatewayAuthConfig{Type: "none"},
+		Status:    model.StatusUnknown,
+		Labels:    map[string]string{"env": "prod"},
+	}
+	if err := lenient.CreateGateway(ctx, gw); err != nil {
+		t.Fatalf("CreateGateway: %v", err)
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`UPDATE gateways SET labels = '{"env":' WHERE id = 'gw-1'`); err != nil {
+		t.Fatalf("corrupt labels: %v", err)
+	}
+
+	captureLogs(t)
+	got, err := lenient.GetGateway(ctx, "gw-1")
+	if err != nil {
+		t.Fatalf("lenient GetGateway: %v", err)
+	}
+	if len(got.Labels) != 0 || got.Transport.Params["insecure"] != "true" {
+		t.Errorf("lenient read = labels %v, params %v; want no labels and the params intact", got.Labels, got.Transport.Params)
+	}
+
+	strict, err := NewSQLiteStore(path, true, false)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore strict: %v", err)
+	}
+	t.Cleanup(func() { strict.Close() })
+	if _, err := strict.GetGateway(ctx, "gw-1"); err == nil || !strings.Contains(err.Error(), "malformed labels column") {
+		t.Errorf("strict GetGateway: got %v, want a malformed column error", err)
+	}
+	if _, err := strict.ListGateways(ctx, model.GatewayFilter{}, model.ListSort{}); err == nil {
+		t.Error("strict ListGateways read the malformed row")
+	}
+}
@@ -3,28 +3,67 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
+	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/AdamPippert/Lobstertank/internal/model"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 // SQLiteStore implements Store using SQLite via mattn/go-sqlite3.
 type SQLiteStore struct {
-	db *sql.DB
+	db     dbtx    // the write connection, or the transaction the store is bound to
+	pool   *sql.DB // the single write connection
+	reads  dbtx    // the read-only pool, or the bound transaction
+	strict bool    // fail reads of rows with malformed JSON columns
 }
 
 // NewSQLiteStore creates a SQLite-backed store.
 // The dsn is the database file path (e.g., "lobstertank.db") or ":memory:"
-// for an in-memory database.
-func NewSQLiteStore(dsn string) (*SQLiteStore, error) {
+// for an in-memory database. When strict is set, rows with malformed JSON
+// columns fail to load instead of being read back with empty maps. With
+// autoMigrate, pending schema migrations are applied; otherwise the schema
+// must already be current. Writes go through one connection and reads
+// through a pool of read-only ones, so long reads do not hold up writes.
+func NewSQLiteStore(dsn string, strict, autoMigrate bool) (*SQLiteStore, error) {
 	if dsn == "" {
 		dsn = ":memory:"
 	}
 
-	db, err := sql.Open("sqlite3", dsn)
+	db, err := openSQLite(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := migrate(ctx, db, "sqlite", autoMigrate); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	var reads dbtx = db
+	if !isMemorySQLite(dsn) {
+		if reads, err = openSQLiteReads(dsn); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	slog.Info("sqlite store initialized", "dsn", dsn)
+	return &SQLiteStore{db: sqliteWriter{db}, pool: db, reads: reads, strict: strict}, nil
+}
+
+// openSQLite opens and configures a SQLite connection.
+func openSQLite(dsn string) (*sql.DB, error) {
+	// Transactions take the write lock when they begin, so one that reads
+	// before writing waits for other writers instead of failing midway.
+	db, err := sql.Open("sqlite3", sqliteDSN(dsn, "_txlock=immediate"))
 	if err != nil {
 		return nil, fmt.Errorf("open sqlite connection: %w", err)
 	}
@@ -32,6 +71,11 @@ func NewSQLiteStore(dsn string) (*SQLiteStore, error) {
 	// SQLite performs best with a single writer connection.
 	db.SetMaxOpenConns(1)
 
+	if _, err := db.Exec(fmt.Sprintf("PRAGMA busy_timeout = %d", sqliteBusyTimeout.Milliseconds())); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("set busy timeout: %w", err)
+	}
+
 	// Enable WAL mode for better concurrent read performance.
 	if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
 		db.Close()
@@ -43,22 +87,58 @@ func NewSQLiteStore(dsn string) (*SQLiteStore, error) {
 		db.Close()
 		return nil, fmt.Errorf("enable foreign keys: %w", err)
 	}
+	return db, nil
+}
 
-	// Run migrations.
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if _, err := db.ExecContext(ctx, createGatewaysTableSQL); err != nil {
+// openSQLiteReads opens the pool of read-only connections to the database
+// at dsn, which openSQLite has already put in WAL mode.
+func openSQLiteReads(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", sqliteDSN(dsn,
+		fmt.Sprintf("_busy_timeout=%d", sqliteBusyTimeout.Milliseconds()), "_query_only=true"))
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite read connections: %w", err)
+	}
+	db.SetMaxOpenConns(sqliteReadConns)
+	if err := db.Ping(); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("create gateways table: %w", err)
+		return nil, fmt.Errorf("open sqlite read connections: %w", err)
 	}
+	return db, nil
+}
 
-	slog.Info("sqlite store initialized", "dsn", dsn)
-	return &SQLiteStore{db: db}, nil
+// sqliteDSN adds connection parameters to dsn.
+func sqliteDSN(dsn string, params ...string) string {
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + strings.Join(params, "&")
 }
 
-func (s *SQLiteStore) ListGateways(ctx context.Context) ([]model.Gateway, error) {
-	query := fmt.Sprintf("SELECT %s FROM gateways ORDER BY enrolled_at DESC", gatewayColumns)
-	rows, err := s.db.QueryContext(ctx, query)
+// isMemorySQLite reports whether dsn names an in-memory database, which
+// exists only on the connection that opened it and so cannot be shared
+// with a separate read pool.
+func isMemorySQLite(dsn string) bool {
+	return dsn == ":memory:" || strings.HasPrefix(dsn, ":memory:?") || strings.Contains(dsn, "mode=memory")
+}
+
+func (s *SQLiteStore) ListGateways(ctx context.Context, filter model.GatewayFilter, sort model.ListSort) ([]model.Gateway, error) {
+	return s.listGateways(ctx, false, filter, sort)
+}
+
+func (s *SQLiteStore) ListDeletedGateways(ctx context.Context, filter model.GatewayFilter, sort model.ListSort) ([]model.Gateway, error) {
+	return s.listGateways(ctx, true, filter, sort)
+}
+
+func (s *SQLiteStore) listGateways(ctx context.Context, deleted bool, filter model.GatewayFilter, sort model.ListSort) ([]model.Gateway, error) {
+	orderBy, err := orderByClause(sort)
+	if err != nil {
+		return nil, err
+	}
+	where, args := sqliteGatewayFilter(filter)
+	query := fmt.Sprintf("SELECT %s FROM gateways WHERE %s AND %s ORDER BY %s",
+		gatewayColumns, deletedPredicate(deleted), where, orderBy)
+	rows, err := s.reads.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("query gateways: %w", err)
 	}
@@ -66,7 +146,7 @@ func (s *SQLiteStore) ListGateways(ctx context.Context) ([]model.Gateway, error)
 
 	gateways := make([]model.Gateway, 0)
 	for rows.Next() {
-		gw, err := scanGateway(rows)
+		gw, err := scanGateway(rows, s.strict)
 		if err != nil {
 			return nil, fmt.Errorf("scan gateway row: %w", err)
 		}
@@ -79,26 +159,101 @@ func (s *SQLiteStore) ListGateways(ctx context.Context) ([]model.Gateway, error)
 	return gateways, nil
 }
 
+// sqliteGatewayFilter returns the condition selecting the gateways that
+// match filter, and its arguments. Each label is looked up with json_each
+// rather than a json_extract path so that any key matches exactly; rows with
+// malformed labels, which non-strict reads tolerate, match no label.
+func sqliteGatewayFilter(filter model.GatewayFilter) (string, []any) {
+	where := "(? = '' OR status = ?)"
+	args := []any{string(filter.Status), string(filter.Status)}
+
+	keys := make([]string, 0, len(filter.Labels))
+	for k := range filter.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		where += ` AND EXISTS (
+            SELECT 1 FROM json_each(CASE WHEN json_valid(labels) THEN labels ELSE '{}' END)
+            WHERE key = ? AND value = ?)`
+		args = append(args, k, filter.Labels[k])
+	}
+	return where, args
+}
+
 func (s *SQLiteStore) GetGateway(ctx context.Context, id string) (*model.Gateway, error) {
-	query := fmt.Sprintf("SELECT %s FROM gateways WHERE id = ?", gatewayColumns)
-	row := s.db.QueryRowContext(ctx, query, id)
-	gw, err := scanGateway(row)
+	return s.getGateway(ctx, id, false)
+}
+
+func (s *SQLiteStore) GetDeletedGateway(ctx context.Context, id string) (*model.Gateway, error) {
+	return s.getGateway(ctx, id, true)
+}
+
+func (s *SQLiteStore) getGateway(ctx context.Context, id string, deleted bool) (*model.Gateway, error) {
+	query := fmt.Sprintf("SELECT %s FROM gateways WHERE id = ? AND %s", gatewayColumns, deletedPredicate(deleted))
+	row := s.reads.QueryRowContext(ctx, query, id)
+	gw, err := scanGateway(row, s.strict)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("gateway not found: %s", id)
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
 		}
 		return nil, fmt.Errorf("scan gateway: %w", err)
 	}
 	return gw, nil
 }
 
+func (s *SQLiteStore) GetGatewayByName(ctx context.Context, orgID, name string) (*model.Gateway, error) {
+	query := fmt.Sprintf("SELECT %s FROM gateways WHERE org_id = ? AND name = ? AND deleted_at IS NULL", gatewayColumns)
+	row := s.reads.QueryRowContext(ctx, query, orgID, name)
+	gw, err := scanGateway(row, s.strict)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		return nil, fmt.Errorf("scan gateway: %w", err)
+	}
+	return gw, nil
+}
+
+func (s *SQLiteStore) ListGatewaysByIDs(ctx context.Context, ids []string) ([]model.Gateway, []string, error) {
+	if len(ids) == 0 {
+		return []model.Gateway{}, []string{}, nil
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM gateways WHERE id IN (%s) AND deleted_at IS NULL", gatewayColumns, placeholders(len(ids)))
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := s.reads.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query gateways: %w", err)
+	}
+	defer rows.Close()
+
+	var found []model.Gateway
+	for rows.Next() {
+		gw, err := scanGateway(rows, s.strict)
+		if err != nil {
+			return nil, nil, fmt.Errorf("scan gateway row: %w", err)
+		}
+		found = append(found, *gw)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("iterate gateway rows: %w", err)
+	}
+
+	gateways, missing := orderGatewaysByIDs(ids, found)
+	return gateways, missing, nil
+}
+
 func (s *SQLiteStore) CreateGateway(ctx context.Context, gw *model.Gateway) error {
 	query := `INSERT INTO gateways (
         id, name, description, endpoint,
         transport_type, transport_params,
         auth_type, auth_params, auth_secret_ref,
-        status, labels, enrolled_at, last_seen_at, ttl_seconds
-    ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+        status, labels, enrolled_at, last_seen_at, ttl_seconds, org_id
+    ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	var ttl *int64
 	if gw.TTLSeconds != nil {
@@ -118,11 +273,15 @@ func (s *SQLiteStore) CreateGateway(ctx context.Context, gw *model.Gateway) erro
 		gw.Auth.SecretRef,
 		string(gw.Status),
 		marshalJSONMap(gw.Labels),
-		gw.EnrolledAt.Format(time.RFC3339),
-		gw.LastSeenAt,
+		gw.EnrolledAt.UTC(),
+		utcTime(gw.LastSeenAt),
 		ttl,
+		gw.OrgID,
 	)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%w: %s", ErrConflict, gw.Name)
+		}
 		return fmt.Errorf("insert gateway: %w", err)
 	}
 	return nil
@@ -142,7 +301,7 @@ func (s *SQLiteStore) UpdateGateway(ctx context.Context, gw *model.Gateway) erro
         labels = ?,
         last_seen_at = ?,
         ttl_seconds = ?
-    WHERE id = ?`
+    WHERE id = ? AND deleted_at IS NULL`
 
 	var ttl *int64
 	if gw.TTLSeconds != nil {
@@ -161,11 +320,14 @@ func (s *SQLiteStore) UpdateGateway(ctx context.Context, gw *model.Gateway) erro
 		gw.Auth.SecretRef,
 		string(gw.Status),
 		marshalJSONMap(gw.Labels),
-		gw.LastSeenAt,
+		utcTime(gw.LastSeenAt),
 		ttl,
 		gw.ID,
 	)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%w: %s", ErrConflict, gw.Name)
+		}
 		return fmt.Errorf("update gateway: %w", err)
 	}
 
@@ -174,13 +336,14 @@ func (s *SQLiteStore) UpdateGateway(ctx context.Context, gw *model.Gateway) erro
 		return fmt.Errorf("check rows affected: %w", err)
 	}
 	if n == 0 {
-		return fmt.Errorf("gateway not found: %s", gw.ID)
+		return fmt.Errorf("%w: %s", ErrNotFound, gw.ID)
 	}
 	return nil
 }
 
-func (s *SQLiteStore) DeleteGateway(ctx context.Context, id string) error {
-	result, err := s.db.ExecContext(ctx, "DELETE FROM gateways WHERE id = ?", id)
+func (s *SQLiteStore) DeleteGateway(ctx context.Context, id string, deletedAt time.Time) error {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE gateways SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL", deletedAt.UTC(), id)
 	if err != nil {
 		return fmt.Errorf("delete gateway: %w", err)
 	}
@@ -190,15 +353,51 @@ func (s *SQLiteStore) DeleteGateway(ctx context.Context, id string) error {
 		return fmt.Errorf("check rows affected: %w", err)
 	}
 	if n == 0 {
-		return fmt.Errorf("gateway not found: %s", id)
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) RestoreGateway(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE gateways SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%w: %s", ErrConflict, id)
+		}
+		return fmt.Errorf("restore gateway: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) PurgeGateway(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM gateways WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("purge gateway: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
 	}
 	return nil
 }
 
 func (s *SQLiteStore) UpdateGatewayStatus(ctx context.Context, id string, status string, lastSeen *time.Time) error {
 	result, err := s.db.ExecContext(ctx,
-		"UPDATE gateways SET status = ?, last_seen_at = ? WHERE id = ?",
-		status, lastSeen, id,
+		"UPDATE gateways SET status = ?, last_seen_at = ? WHERE id = ? AND deleted_at IS NULL",
+		status, utcTime(lastSeen), id,
 	)
 	if err != nil {
 		return fmt.Errorf("update gateway status: %w", err)
@@ -209,11 +408,703 @@ func (s *SQLiteStore) UpdateGatewayStatus(ctx context.Context, id string, status
 		return fmt.Errorf("check rows affected: %w", err)
 	}
 	if n == 0 {
-		return fmt.Errorf("gateway not found: %s", id)
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) SetGatewayMaintenance(ctx context.Context, id string, status string, reason string, until *time.Time) error {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE gateways SET status = ?, maintenance_reason = ?, maintenance_until = ? WHERE id = ? AND deleted_at IS NULL",
+		status, reason, utcTime(until), id,
+	)
+	if err != nil {
+		return fmt.Errorf("update gateway maintenance: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) InsertStatusTransition(ctx context.Context, t *model.StatusTransition) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO gateway_status_history (
+            gateway_id, from_status, to_status, latency, error, error_kind, observed_at
+        ) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		t.GatewayID, string(t.From), string(t.To), t.Latency, t.Error, string(t.ErrorKind), t.ObservedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("insert status transition: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) ListStatusTransitions(ctx context.Context, gatewayID string, since time.Time) ([]model.StatusTransition, error) {
+	rows, err := s.reads.QueryContext(ctx,
+		`SELECT gateway_id, from_status, to_status, latency, error, error_kind, observed_at
+        FROM gateway_status_history
+        WHERE gateway_id = ? AND observed_at >= ?
+        ORDER BY observed_at ASC`,
+		gatewayID, since.UTC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query status history: %w", err)
+	}
+	defer rows.Close()
+
+	transitions := make([]model.StatusTransition, 0)
+	for rows.Next() {
+		var t model.StatusTransition
+		if err := rows.Scan(&t.GatewayID, &t.From, &t.To, &t.Latency, &t.Error, &t.ErrorKind, &t.ObservedAt); err != nil {
+			return nil, fmt.Errorf("scan status transition: %w", err)
+		}
+		transitions = append(transitions, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate status history rows: %w", err)
+	}
+	return transitions, nil
+}
+
+func (s *SQLiteStore) PruneStatusHistory(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx,
+		"DELETE FROM gateway_status_history WHERE observed_at < ?", before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("prune status history: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("check rows affected: %w", err)
+	}
+	return n, nil
+}
+
+func (s *SQLiteStore) InsertHealthCheck(ctx context.Context, r *model.HealthCheckResult, checkedAt time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO gateway_health_history (
+            gateway_id, status, latency, latency_ms, error, error_kind, attempts, checked_at
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.GatewayID, string(r.Status), r.Latency, r.LatencyMillis, r.Error, string(r.ErrorKind), r.Attempts, checkedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("insert health check: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) ListHealthChecks(ctx context.Context, gatewayID string, limit int) ([]model.HealthCheckResult, error) {
+	rows, err := s.reads.QueryContext(ctx,
+		`SELECT gateway_id, status, latency, latency_ms, error, error_kind, attempts, checked_at
+        FROM gateway_health_history
+        WHERE gateway_id = ?
+        ORDER BY checked_at DESC
+        LIMIT ?`,
+		gatewayID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query health history: %w", err)
+	}
+	defer rows.Close()
+
+	checks := make([]model.HealthCheckResult, 0)
+	for rows.Next() {
+		var (
+			r         model.HealthCheckResult
+			checkedAt time.Time
+		)
+		if err := rows.Scan(&r.GatewayID, &r.Status, &r.Latency, &r.LatencyMillis, &r.Error, &r.ErrorKind, &r.Attempts, &checkedAt); err != nil {
+			return nil, fmt.Errorf("scan health check: %w", err)
+		}
+		r.CheckedAt = checkedAt.UTC().Format(time.RFC3339)
+		checks = append(checks, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate health history rows: %w", err)
+	}
+	return checks, nil
+}
+
+func (s *SQLiteStore) PruneHealthChecks(ctx context.Context, gatewayID string, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx,
+		"DELETE FROM gateway_health_history WHERE gateway_id = ? AND checked_at < ?", gatewayID, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("prune health history: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("check rows affected: %w", err)
+	}
+	return n, nil
+}
+
+func (s *SQLiteStore) ListGroups(ctx context.Context) ([]model.Group, error) {
+	rows, err := s.reads.QueryContext(ctx,
+		"SELECT id, name, description, created_at, org_id FROM gateway_groups ORDER BY name ASC")
+	if err != nil {
+		return nil, fmt.Errorf("query groups: %w", err)
+	}
+	defer rows.Close()
+
+	groups := make([]model.Group, 0)
+	for rows.Next() {
+		var g model.Group
+		if err := rows.Scan(&g.ID, &g.Name, &g.Description, &g.CreatedAt, &g.OrgID); err != nil {
+			return nil, fmt.Errorf("scan group row: %w", err)
+		}
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate group rows: %w", err)
+	}
+	rows.Close()
+
+	for i := range groups {
+		members, err := s.groupMembers(ctx, groups[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		groups[i].GatewayIDs = members
+	}
+	return groups, nil
+}
+
+func (s *SQLiteStore) GetGroup(ctx context.Context, id string) (*model.Group, error) {
+	var g model.Group
+	err := s.reads.QueryRowContext(ctx,
+		"SELECT id, name, description, created_at, org_id FROM gateway_groups WHERE id = ?", id,
+	).Scan(&g.ID, &g.Name, &g.Description, &g.CreatedAt, &g.OrgID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrGroupNotFound, id)
+		}
+		return nil, fmt.Errorf("scan group: %w", err)
+	}
+
+	members, err := s.groupMembers(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	g.GatewayIDs = members
+	return &g, nil
+}
+
+func (s *SQLiteStore) CreateGroup(ctx context.Context, g *model.Group) error {
+	tx, err := beginTx(ctx, s.pool, s.db)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }() // no-op after commit
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO gateway_groups (id, name, description, created_at, org_id) VALUES (?, ?, ?, ?, ?)",
+		g.ID, g.Name, g.Description, g.CreatedAt.UTC(), g.OrgID,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%w: %s", ErrGroupConflict, g.Name)
+		}
+		return fmt.Errorf("insert group: %w", err)
+	}
+
+	if err := insertGroupMembers(ctx, tx.Tx, "?", "?", g); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) UpdateGroup(ctx context.Context, g *model.Group) error {
+	tx, err := beginTx(ctx, s.pool, s.db)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }() // no-op after commit
+
+	result, err := tx.ExecContext(ctx,
+		"UPDATE gateway_groups SET name = ?, description = ? WHERE id = ?",
+		g.Name, g.Description, g.ID,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("%w: %s", ErrGroupConflict, g.Name)
+		}
+		return fmt.Errorf("update group: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrGroupNotFound, g.ID)
+	}
+
+	// Deleted members are kept, so restoring them puts them back in the group.
+	if _, err := tx.ExecContext(ctx,
+		"DELETE FROM gateway_group_members WHERE group_id = ? AND gateway_id IN (SELECT id FROM gateways WHERE deleted_at IS NULL)",
+		g.ID,
+	); err != nil {
+		return fmt.Errorf("clear group members: %w", err)
+	}
+	if err := insertGroupMembers(ctx, tx.Tx, "?", "?", g); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) DeleteGroup(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM gateway_groups WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete group: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrGroupNotFound, id)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) groupMembers(ctx context.Context, groupID string) ([]string, error) {
+	rows, err := s.reads.QueryContext(ctx,
+		`SELECT m.gateway_id
+        FROM gateway_group_members m JOIN gateways g ON g.id = m.gateway_id
+        WHERE m.group_id = ? AND g.deleted_at IS NULL
+        ORDER BY m.gateway_id`, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("query group members: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan group member: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate group member rows: %w", err)
+	}
+	return ids, nil
+}
+
+func (s *SQLiteStore) ListSecrets(ctx context.Context) (map[string]string, error) {
+	rows, err := s.reads.QueryContext(ctx, "SELECT ref, value FROM secrets")
+	if err != nil {
+		return nil, fmt.Errorf("query secrets: %w", err)
+	}
+	defer rows.Close()
+
+	secrets := make(map[string]string)
+	for rows.Next() {
+		var ref, value string
+		if err := rows.Scan(&ref, &value); err != nil {
+			return nil, fmt.Errorf("scan secret: %w", err)
+		}
+		secrets[ref] = value
+	}
+	return secrets, rows.Err()
+}
+
+func (s *SQLiteStore) PutSecret(ctx context.Context, ref, value string) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO secrets (ref, value) VALUES (?, ?) ON CONFLICT (ref) DO UPDATE SET value = excluded.value",
+		ref, value,
+	)
+	if err != nil {
+		return fmt.Errorf("put secret: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) DeleteSecret(ctx context.Context, ref string) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM secrets WHERE ref = ?", ref); err != nil {
+		return fmt.Errorf("delete secret: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) GetIdempotencyKey(ctx context.Context, key string) (string, error) {
+	var gatewayID string
+	err := s.reads.QueryRowContext(ctx, "SELECT gateway_id FROM idempotency_keys WHERE key = ?", key).Scan(&gatewayID)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("%w: idempotency key %q", ErrNotFound, key)
+	}
+	if err != nil {
+		return "", fmt.Errorf("get idempotency key: %w", err)
+	}
+	return gatewayID, nil
+}
+
+func (s *SQLiteStore) PutIdempotencyKey(ctx context.Context, key, gatewayID string, createdAt time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO idempotency_keys (key, gateway_id, created_at) VALUES (?, ?, ?) "+
+			"ON CONFLICT (key) DO UPDATE SET gateway_id = excluded.gateway_id, created_at = excluded.created_at",
+		key, gatewayID, createdAt,
+	)
+	if err != nil {
+		return fmt.Errorf("put idempotency key: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) CreateFanOutJob(ctx context.Context, job *model.FanOutJob) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO fanout_jobs (id, status, total, created_by, org_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		job.ID, string(job.Status), job.Total, job.CreatedBy, job.OrgID, job.CreatedAt.UTC(), job.UpdatedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("insert fan-out job: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) GetFanOutJob(ctx context.Context, id string) (*model.FanOutJob, error) {
+	var job model.FanOutJob
+	err := s.reads.QueryRowContext(ctx,
+		"SELECT id, status, total, created_by, org_id, created_at, updated_at FROM fanout_jobs WHERE id = ?", id,
+	).Scan(&job.ID, &job.Status, &job.Total, &job.CreatedBy, &job.OrgID, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+		}
+		return nil, fmt.Errorf("scan fan-out job: %w", err)
+	}
+
+	rows, err := s.reads.QueryContext(ctx,
+		`SELECT position, gateway_id, gateway_name, response, error, skipped, skip_reason, latency_ms, completed_at
+        FROM fanout_results
+        WHERE job_id = ?
+        ORDER BY position ASC`, id)
+	if err != nil {
+		return nil, fmt.Errorf("query fan-out results: %w", err)
+	}
+	defer rows.Close()
+
+	job.Results = make([]model.FanOutJobResult, 0, job.Total)
+	for rows.Next() {
+		var r model.FanOutJobResult
+		if err := rows.Scan(&r.Position, &r.GatewayID, &r.GatewayName, &r.Response, &r.Error,
+			&r.Skipped, &r.SkipReason, &r.LatencyMillis, &r.CompletedAt); err != nil {
+			return nil, fmt.Errorf("scan fan-out result: %w", err)
+		}
+		job.Results = append(job.Results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate fan-out result rows: %w", err)
+	}
+	return &job, nil
+}
+
+func (s *SQLiteStore) UpdateFanOutJobStatus(ctx context.Context, id string, status model.JobStatus, updatedAt time.Time) error {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE fanout_jobs SET status = ?, updated_at = ? WHERE id = ?",
+		string(status), updatedAt.UTC(), id,
+	)
+	if err != nil {
+		return fmt.Errorf("update fan-out job status: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) InsertFanOutResult(ctx context.Context, jobID string, r *model.FanOutJobResult) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO fanout_results (
+            job_id, position, gateway_id, gateway_name, response, error, skipped, skip_reason, latency_ms, completed_at
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		jobID, r.Position, r.GatewayID, r.GatewayName, r.Response, r.Error,
+		r.Skipped, r.SkipReason, r.LatencyMillis, r.CompletedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("insert fan-out result: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) DeleteFanOutJob(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM fanout_jobs WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete fan-out job: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) PruneFanOutJobs(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx,
+		"DELETE FROM fanout_jobs WHERE updated_at < ?", before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("prune fan-out jobs: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("check rows affected: %w", err)
+	}
+	return n, nil
+}
+
+func (s *SQLiteStore) AddUsage(ctx context.Context, gatewayID string, hour time.Time, u model.Usage) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO gateway_usage (
+            gateway_id, model, hour, requests, prompt_tokens, completion_tokens
+        ) VALUES (?, ?, ?, 1, ?, ?)
+        ON CONFLICT (gateway_id, model, hour) DO UPDATE SET
+            requests          = gateway_usage.requests + 1,
+            prompt_tokens     = gateway_usage.prompt_tokens + excluded.prompt_tokens,
+            completion_tokens = gateway_usage.completion_tokens + excluded.completion_tokens`,
+		gatewayID, u.Model, hour.UTC(), u.PromptTokens, u.CompletionTokens,
+	)
+	if err != nil {
+		return fmt.Errorf("add usage: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) ListUsage(ctx context.Context, gatewayID string, since time.Time) ([]model.UsageTotals, error) {
+	rows, err := s.reads.QueryContext(ctx,
+		`SELECT gateway_id, model, SUM(requests), SUM(prompt_tokens), SUM(completion_tokens)
+        FROM gateway_usage
+        WHERE hour >= ? AND (? = '' OR gateway_id = ?)
+        GROUP BY gateway_id, model
+        ORDER BY gateway_id, model`,
+		since.UTC(), gatewayID, gatewayID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query usage: %w", err)
+	}
+	defer rows.Close()
+
+	usage := make([]model.UsageTotals, 0)
+	for rows.Next() {
+		var u model.UsageTotals
+		if err := rows.Scan(&u.GatewayID, &u.Model, &u.Requests, &u.PromptTokens, &u.CompletionTokens); err != nil {
+			return nil, fmt.Errorf("scan usage: %w", err)
+		}
+		usage = append(usage, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate usage rows: %w", err)
+	}
+	return usage, nil
+}
+
+func (s *SQLiteStore) AppendAuditEvent(ctx context.Context, e *model.AuditEvent) error {
+	result, err := s.db.ExecContext(ctx,
+		`INSERT INTO audit_events (timestamp, action, resource, subject, detail, request_id)
+        VALUES (?, ?, ?, ?, ?, ?)`,
+		e.Timestamp.UTC(), e.Action, e.Resource, e.Subject, e.Detail, e.RequestID,
+	)
+	if err != nil {
+		return fmt.Errorf("insert audit event: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("read audit event id: %w", err)
+	}
+	e.ID = id
+	return nil
+}
+
+func (s *SQLiteStore) ListAuditEvents(ctx context.Context, q model.AuditQuery) ([]model.AuditEvent, error) {
+	rows, err := s.reads.QueryContext(ctx,
+		`SELECT `+auditEventColumns+`
+        FROM audit_events
+        WHERE (? = '' OR action = ?) AND (? = '' OR resource = ?)
+          AND timestamp >= ? AND timestamp < ? AND (? = 0 OR id < ?)
+        ORDER BY id DESC
+        LIMIT ?`,
+		q.Action, q.Action, q.Resource, q.Resource,
+		q.Since.UTC(), auditUntil(q), q.BeforeID, q.BeforeID, q.Limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query audit events: %w", err)
+	}
+	return scanAuditEvents(rows)
+}
+
+func (s *SQLiteStore) PruneAuditEvents(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx,
+		"DELETE FROM audit_events WHERE timestamp < ?", before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("prune audit events: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("check rows affected: %w", err)
+	}
+	return n, nil
+}
+
+func (s *SQLiteStore) CreateAPIKey(ctx context.Context, k *model.APIKey) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO api_keys (id, name, key_hash, roles, org_id, created_by, created_at, expires_at, last_used_at, revoked)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		k.ID, k.Name, k.Hash, marshalRoles(k.Roles), k.Org, k.CreatedBy,
+		k.CreatedAt.UTC(), utcTime(k.ExpiresAt), utcTime(k.LastUsedAt), k.Revoked,
+	)
+	if err != nil {
+		return fmt.Errorf("insert api key: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) GetAPIKey(ctx context.Context, id string) (*model.APIKey, error) {
+	k, err := scanAPIKey(s.reads.QueryRowContext(ctx,
+		"SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id)
+		}
+		return nil, fmt.Errorf("scan api key: %w", err)
+	}
+	return k, nil
+}
+
+func (s *SQLiteStore) ListAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	rows, err := s.reads.QueryContext(ctx,
+		"SELECT "+apiKeyColumns+" FROM api_keys ORDER BY created_at ASC, id ASC")
+	if err != nil {
+		return nil, fmt.Errorf("query api keys: %w", err)
+	}
+	return scanAPIKeys(rows)
+}
+
+func (s *SQLiteStore) RevokeAPIKey(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE api_keys SET revoked = TRUE WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("revoke api key: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) DeleteAPIKey(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM api_keys WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("delete api key: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = ? WHERE id = ?", usedAt.UTC(), id)
+	if err != nil {
+		return fmt.Errorf("touch api key: %w", err)
+	}
+	return nil
+}
+
+// CopyTo writes a copy of the database to a new file at path through
+// SQLite's online backup API, which gives a consistent copy while the store
+// stays in use. It refuses to overwrite an existing file.
+func (s *SQLiteStore) CopyTo(ctx context.Context, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("copy database: %s already exists", path)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("copy database: %w", err)
+	}
+
+	dest, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return fmt.Errorf("open copy: %w", err)
+	}
+	defer dest.Close()
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("open copy: %w", err)
+	}
+	defer destConn.Close()
+	srcConn, err := s.pool.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("copy database: %w", err)
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(d any) error {
+		return srcConn.Raw(func(src any) error {
+			b, err := d.(*sqlite3.SQLiteConn).Backup("main", src.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return fmt.Errorf("start database copy: %w", err)
+			}
+			for done := false; !done; {
+				if done, err = b.Step(-1); err != nil {
+					b.Close()
+					return fmt.Errorf("copy database: %w", err)
+				}
+			}
+			if err := b.Finish(); err != nil {
+				return fmt.Errorf("finish database copy: %w", err)
+			}
+			return nil
+		})
+	})
+}
+
+func (s *SQLiteStore) InTx(ctx context.Context, fn func(Store) error) error {
+	tx, err := beginTx(ctx, s.pool, s.db)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }() // no-op after commit
+
+	bound := *s
+	bound.db, bound.reads = tx.Tx, tx.Tx
+	if err := fn(&bound); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Ping runs a trivial query, since PingContext on SQLite only checks that
+// the handle is open.
+func (s *SQLiteStore) Ping(ctx context.Context) error {
+	var one int
+	if err := s.db.QueryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+		return fmt.Errorf("ping sqlite: %w", err)
 	}
 	return nil
 }
 
 func (s *SQLiteStore) Close() error {
-	return s.db.Close()
+	if reads, ok := s.reads.(*sql.DB); ok && reads != s.pool {
+		reads.Close()
+	}
+	return s.pool.Close()
 }
@@ -2,35 +2,231 @@ package store
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/AdamPippert/Lobstertank/internal/config"
 	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/store/migrations"
+)
+
+// Sentinel errors returned by Store implementations.
+var (
+	// ErrNotFound is returned when the requested record does not exist.
+	ErrNotFound = errors.New("gateway not found")
+	// ErrConflict is returned when a write violates a uniqueness constraint.
+	ErrConflict = errors.New("gateway already exists")
+	// ErrGroupNotFound is returned when the requested group does not exist.
+	ErrGroupNotFound = errors.New("group not found")
+	// ErrGroupConflict is returned when a group name is already taken.
+	ErrGroupConflict = errors.New("group already exists")
+	// ErrJobNotFound is returned when the requested fan-out job does not exist.
+	ErrJobNotFound = errors.New("fan-out job not found")
+	// ErrAPIKeyNotFound is returned when the requested API key does not exist.
+	ErrAPIKeyNotFound = errors.New("api key not found")
 )
 
 // Store defines the persistence interface for Lobstertank.
 type Store interface {
-	// Gateway operations
-	ListGateways(ctx context.Context) ([]model.Gateway, error)
+	// Gateway operations. Deleted gateways are invisible to every one of
+	// these except DeleteGateway, which is what marks them.
+	ListGateways(ctx context.Context, filter model.GatewayFilter, sort model.ListSort) ([]model.Gateway, error)
 	GetGateway(ctx context.Context, id string) (*model.Gateway, error)
+	// GetGatewayByName looks a gateway up by name within an organization.
+	GetGatewayByName(ctx context.Context, orgID, name string) (*model.Gateway, error)
+	// ListGatewaysByIDs looks gateways up in one query. It returns those
+	// found in the order of ids, without repeats, and the IDs of the rest.
+	ListGatewaysByIDs(ctx context.Context, ids []string) ([]model.Gateway, []string, error)
 	CreateGateway(ctx context.Context, gw *model.Gateway) error
 	UpdateGateway(ctx context.Context, gw *model.Gateway) error
-	DeleteGateway(ctx context.Context, id string) error
+	DeleteGateway(ctx context.Context, id string, deletedAt time.Time) error
 	UpdateGatewayStatus(ctx context.Context, id string, status string, lastSeen *time.Time) error
+	SetGatewayMaintenance(ctx context.Context, id string, status string, reason string, until *time.Time) error
+
+	// Deleted gateways. RestoreGateway returns ErrConflict when another
+	// gateway has taken the name meanwhile. PurgeGateway removes a gateway
+	// and everything recorded about it, whether or not it was deleted.
+	ListDeletedGateways(ctx context.Context, filter model.GatewayFilter, sort model.ListSort) ([]model.Gateway, error)
+	GetDeletedGateway(ctx context.Context, id string) (*model.Gateway, error)
+	RestoreGateway(ctx context.Context, id string) error
+	PurgeGateway(ctx context.Context, id string) error
+
+	// Status history operations
+	InsertStatusTransition(ctx context.Context, t *model.StatusTransition) error
+	ListStatusTransitions(ctx context.Context, gatewayID string, since time.Time) ([]model.StatusTransition, error)
+	PruneStatusHistory(ctx context.Context, before time.Time) (int64, error)
+
+	// Health check history: every persisted check, not only transitions.
+	// ListHealthChecks returns a gateway's latest checks, newest first.
+	InsertHealthCheck(ctx context.Context, r *model.HealthCheckResult, checkedAt time.Time) error
+	ListHealthChecks(ctx context.Context, gatewayID string, limit int) ([]model.HealthCheckResult, error)
+	PruneHealthChecks(ctx context.Context, gatewayID string, before time.Time) (int64, error)
+
+	// Group operations
+	ListGroups(ctx context.Context) ([]model.Group, error)
+	GetGroup(ctx context.Context, id string) (*model.Group, error)
+	CreateGroup(ctx context.Context, g *model.Group) error
+	UpdateGroup(ctx context.Context, g *model.Group) error
+	DeleteGroup(ctx context.Context, id string) error
+
+	// Secrets persisted on behalf of the builtin secrets provider. Values
+	// are stored exactly as given; encryption is the provider's job.
+	ListSecrets(ctx context.Context) (map[string]string, error)
+	PutSecret(ctx context.Context, ref, value string) error
+	DeleteSecret(ctx context.Context, ref string) error
+
+	// Idempotency keys map a client-supplied key to the gateway it created.
+	// GetIdempotencyKey returns ErrNotFound for unknown keys.
+	GetIdempotencyKey(ctx context.Context, key string) (string, error)
+	PutIdempotencyKey(ctx context.Context, key, gatewayID string, createdAt time.Time) error
+
+	// Fan-out jobs. GetFanOutJob includes the results recorded so far,
+	// ordered by position. Deleting a job deletes its results.
+	CreateFanOutJob(ctx context.Context, job *model.FanOutJob) error
+	GetFanOutJob(ctx context.Context, id string) (*model.FanOutJob, error)
+	UpdateFanOutJobStatus(ctx context.Context, id string, status model.JobStatus, updatedAt time.Time) error
+	InsertFanOutResult(ctx context.Context, jobID string, r *model.FanOutJobResult) error
+	DeleteFanOutJob(ctx context.Context, id string) error
+	PruneFanOutJobs(ctx context.Context, before time.Time) (int64, error) // by last update
+
+	// Token usage, counted per gateway, model, and hour. AddUsage adds one
+	// prompt's usage to the hour's counters. ListUsage sums the counters
+	// from since on by gateway and model, for one gateway or, when
+	// gatewayID is empty, all of them.
+	AddUsage(ctx context.Context, gatewayID string, hour time.Time, u model.Usage) error
+	ListUsage(ctx context.Context, gatewayID string, since time.Time) ([]model.UsageTotals, error)
+
+	// Audit events. ListAuditEvents returns the matching events newest
+	// first; AppendAuditEvent sets the event's ID.
+	AppendAuditEvent(ctx context.Context, e *model.AuditEvent) error
+	ListAuditEvents(ctx context.Context, q model.AuditQuery) ([]model.AuditEvent, error)
+	PruneAuditEvents(ctx context.Context, before time.Time) (int64, error)
+
+	// API keys. Revoked keys are kept, so they are still listed and can
+	// be looked up; TouchAPIKey records when a key was last used.
+	// DeleteAPIKey is for restores, which replace keys outright.
+	CreateAPIKey(ctx context.Context, k *model.APIKey) error
+	GetAPIKey(ctx context.Context, id string) (*model.APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]model.APIKey, error) // oldest first
+	RevokeAPIKey(ctx context.Context, id string) error
+	DeleteAPIKey(ctx context.Context, id string) error
+	TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error
+
+	// InTx calls fn with a store whose operations all run in one
+	// transaction, committed if fn returns nil and rolled back otherwise.
+	// The store passed to fn must not be used after fn returns.
+	InTx(ctx context.Context, fn func(Store) error) error
 
 	// Lifecycle
+	Ping(ctx context.Context) error // reports whether the database is reachable
 	Close() error
 }
 
-// New constructs the appropriate store based on the database driver config.
+// dbtx runs statements for a store: on its connection pool, or on the
+// transaction InTx bound it to.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// storeTx is a transaction a store method runs its statements in. When the
+// store is bound to a transaction already, it is that transaction, and
+// committing or rolling it back is left to whoever began it.
+type storeTx struct {
+	*sql.Tx
+	owned bool
+}
+
+// beginTx begins a transaction on pool unless db is one already.
+func beginTx(ctx context.Context, pool *sql.DB, db dbtx) (*storeTx, error) {
+	if tx, ok := db.(*sql.Tx); ok {
+		return &storeTx{Tx: tx}, nil
+	}
+	tx, err := pool.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &storeTx{Tx: tx, owned: true}, nil
+}
+
+func (t *storeTx) Commit() error {
+	if !t.owned {
+		return nil
+	}
+	return t.Tx.Commit()
+}
+
+func (t *storeTx) Rollback() error {
+	if !t.owned {
+		return nil
+	}
+	return t.Tx.Rollback()
+}
+
+// New constructs the appropriate store based on the database driver config,
+// instrumented to keep per-operation statistics and log slow operations.
+// Unwrap returns the driver's store.
 func New(cfg config.DatabaseConfig) (Store, error) {
+	s, err := newDriverStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return Instrument(s, cfg.SlowQueryThreshold), nil
+}
+
+func newDriverStore(cfg config.DatabaseConfig) (Store, error) {
 	switch cfg.Driver {
 	case "sqlite":
-		return NewSQLiteStore(cfg.DSN)
+		return NewSQLiteStore(cfg.DSN, cfg.StrictJSON, cfg.AutoMigrate)
 	case "postgres":
-		return NewPostgresStore(cfg.DSN)
+		s, err := NewPostgresStore(cfg.DSN, cfg.StrictJSON, cfg.AutoMigrate, cfg.ConnectTimeout)
+		if err != nil {
+			return nil, err
+		}
+		s.notifyChanges = cfg.NotifyChanges
+		return s, nil
+	case "mysql":
+		return NewMySQLStore(cfg.DSN, cfg.StrictJSON, cfg.AutoMigrate)
 	default:
-		return nil, fmt.Errorf("unknown database driver: %s", cfg.Driver)
+		return nil, unknownDriverError(cfg.Driver)
+	}
+}
+
+// Open connects to the configured database without touching its schema,
+// for running migrations out-of-band.
+func Open(cfg config.DatabaseConfig) (*sql.DB, error) {
+	switch cfg.Driver {
+	case "sqlite":
+		return openSQLite(cfg.DSN)
+	case "postgres":
+		return openPostgres(cfg.DSN, cfg.ConnectTimeout)
+	case "mysql":
+		return openMySQL(cfg.DSN)
+	default:
+		return nil, unknownDriverError(cfg.Driver)
+	}
+}
+
+func unknownDriverError(driver string) error {
+	return fmt.Errorf("unknown database driver %q (supported: sqlite, postgres, mysql)", driver)
+}
+
+// migrate applies pending schema migrations to a newly opened database, or
+// without autoMigrate only verifies that none are pending.
+func migrate(ctx context.Context, db *sql.DB, driver string, autoMigrate bool) error {
+	m := migrations.New(db, driver)
+	if !autoMigrate {
+		err := m.Check(ctx)
+		if errors.Is(err, migrations.ErrPending) {
+			return fmt.Errorf("%w; run \"lobstertank migrate --up\"", err)
+		}
+		return err
+	}
+	if _, err := m.Up(ctx); err != nil {
+		return fmt.Errorf("migrate schema: %w", err)
 	}
+	return nil
 }
@@ -0,0 +1,235 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+)
+
+// seedBackup fills s with one of every record a backup holds: a live gateway
+// in maintenance, a deleted one, a group, a secret, history, an audit event,
+// and an API key.
+func seedBackup(t *testing.T, s store.Store) {
+	t.Helper()
+	ctx := context.Background()
+	mustCreate(t, s, newGateway("gw-1", "alpha"))
+	mustCreate(t, s, newGateway("gw-2", "bravo"))
+	until := enrolled.Add(time.Hour)
+	if err := s.SetGatewayMaintenance(ctx, "gw-1", string(model.StatusMaintenance), "upgrade", &until); err != nil {
+		t.Fatalf("SetGatewayMaintenance: %v", err)
+	}
+	if err := s.DeleteGateway(ctx, "gw-2", enrolled.Add(2*time.Hour)); err != nil {
+		t.Fatalf("DeleteGateway: %v", err)
+	}
+	if err := s.CreateGroup(ctx, &model.Group{ID: "grp-1", Name: "fleet", GatewayIDs: []string{"gw-1"}, CreatedAt: enrolled}); err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+	if err := s.PutSecret(ctx, "builtin://gateways/gw-1/token", "sealed"); err != nil {
+		t.Fatalf("PutSecret: %v", err)
+	}
+	if err := s.InsertStatusTransition(ctx, &model.StatusTransition{
+		GatewayID: "gw-1", From: model.StatusUnknown, To: model.StatusOnline, ObservedAt: enrolled,
+	}); err != nil {
+		t.Fatalf("InsertStatusTransition: %v", err)
+	}
+	if err := s.InsertHealthCheck(ctx, &model.HealthCheckResult{GatewayID: "gw-1", Status: model.StatusOnline, Attempts: 1}, enrolled); err != nil {
+		t.Fatalf("InsertHealthCheck: %v", err)
+	}
+	if err := s.AppendAuditEvent(ctx, &model.AuditEvent{Timestamp: enrolled, Action: "gateway.registered", Resource: "gw-1"}); err != nil {
+		t.Fatalf("AppendAuditEvent: %v", err)
+	}
+	if err := s.CreateAPIKey(ctx, &model.APIKey{
+		ID: "key-1", Name: "ci", Roles: []string{"operator"}, CreatedAt: enrolled, LastUsedAt: &until, Hash: "5f4dcc3b",
+	}); err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+}
+
+func mustBackup(t *testing.T, s store.Store) *store.Backup {
+	t.Helper()
+	b, err := store.TakeBackup(context.Background(), s, enrolled)
+	if err != nil {
+		t.Fatalf("TakeBackup: %v", err)
+	}
+	return b
+}
+
+// sameContents reports how two backups differ in what they hold, ignoring
+// when they were taken and the IDs audit events get on restore.
+func sameContents(t *testing.T, got, want *store.Backup) {
+	t.Helper()
+	if len(got.Gateways) != len(want.Gateways) {
+		t.Fatalf("%d gateways, want %d", len(got.Gateways), len(want.Gateways))
+	}
+	byID := make(map[string]model.Gateway, len(got.Gateways))
+	for _, gw := range got.Gateways {
+		byID[gw.ID] = gw
+	}
+	for _, w := range want.Gateways {
+		g, ok := byID[w.ID]
+		switch {
+		case !ok:
+			t.Errorf("gateway %s missing", w.ID)
+		case g.Name != w.Name || g.Status != w.Status || g.MaintenanceReason != w.MaintenanceReason ||
+			!sameTime(g.MaintenanceUntil, w.MaintenanceUntil) || !sameTime(g.DeletedAt, w.DeletedAt):
+			t.Errorf("gateway %s = %+v, want %+v", w.ID, g, w)
+		}
+	}
+	if len(got.Groups) != len(want.Groups) || len(got.Groups) > 0 && got.Groups[0].Name != want.Groups[0].Name {
+		t.Errorf("groups = %+v, want %+v", got.Groups, want.Groups)
+	}
+	if !maps.Equal(got.Secrets, want.Secrets) {
+		t.Errorf("secrets = %v, want %v", got.Secrets, want.Secrets)
+	}
+	if len(got.StatusHistory) != len(want.StatusHistory) || len(got.HealthChecks) != len(want.HealthChecks) {
+		t.Errorf("%d transitions and %d health checks, want %d and %d",
+			len(got.StatusHistory), len(got.HealthChecks), len(want.StatusHistory), len(want.HealthChecks))
+	}
+	if len(got.AuditEvents) != len(want.AuditEvents) {
+		t.Errorf("%d audit events, want %d", len(got.AuditEvents), len(want.AuditEvents))
+	}
+	if len(got.APIKeys) != len(want.APIKeys) {
+		t.Fatalf("%d API keys, want %d", len(got.APIKeys), len(want.APIKeys))
+	}
+	for i, w := range want.APIKeys {
+		g := got.APIKeys[i]
+		if g.ID != w.ID || g.Hash != w.Hash || !slices.Equal(g.Roles, w.Roles) || !sameTime(g.LastUsedAt, w.LastUsedAt) {
+			t.Errorf("API key %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func sameTime(a, b *time.Time) bool {
+	return a == nil && b == nil || a != nil && b != nil && a.Equal(*b)
+}
+
+func testBackupRoundTrip(t *testing.T, s store.Store, fresh func() store.Store) {
+	ctx := context.Background()
+	seedBackup(t, s)
+	b := mustBackup(t, s)
+
+	dst := fresh()
+	result, err := store.Restore(ctx, dst, b, store.ConflictFail, false)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if result.Gateways.Created != 2 || result.Groups.Created != 1 || result.Secrets.Created != 1 || result.APIKeys.Created != 1 ||
+		result.StatusHistory != 1 || result.HealthChecks != 1 || result.AuditEvents != 1 {
+		t.Errorf("Restore = %+v, want everything created", result)
+	}
+	sameContents(t, mustBackup(t, dst), b)
+
+	// Restoring the same backup again finds nothing to do.
+	result, err = store.Restore(ctx, dst, b, store.ConflictFail, false)
+	if err != nil {
+		t.Fatalf("second Restore: %v", err)
+	}
+	if result.Gateways.Unchanged != 2 || result.Groups.Unchanged != 1 || result.Secrets.Unchanged != 1 || result.APIKeys.Unchanged != 1 ||
+		result.StatusHistory != 0 || result.HealthChecks != 0 || result.AuditEvents != 0 {
+		t.Errorf("second Restore = %+v, want everything unchanged", result)
+	}
+}
+
+func testRestoreConflicts(t *testing.T, s store.Store, fresh func() store.Store) {
+	ctx := context.Background()
+	seedBackup(t, s)
+	b := mustBackup(t, s)
+
+	tests := []struct {
+		policy       store.ConflictPolicy
+		wantErr      error
+		wantCounts   store.RestoreCounts // of gateways and of secrets
+		wantRestored bool                // whether the backup's records replace the store's
+		wantDeleted  bool                // whether the backup's deleted gateway is added
+	}{
+		{store.ConflictSkip, nil, store.RestoreCounts{Skipped: 1}, false, true},
+		{store.ConflictOverwrite, nil, store.RestoreCounts{Overwritten: 1}, true, true},
+		{store.ConflictFail, store.ErrRestoreConflict, store.RestoreCounts{Skipped: 1}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			dst := fresh()
+			local := newGateway("gw-1", "alpha")
+			local.Description = "edited since the backup"
+			mustCreate(t, dst, local)
+			if err := dst.PutSecret(ctx, "builtin://gateways/gw-1/token", "rotated"); err != nil {
+				t.Fatalf("PutSecret: %v", err)
+			}
+			if err := dst.CreateAPIKey(ctx, &model.APIKey{ID: "key-1", Name: "ci", CreatedAt: enrolled, Hash: "reissued"}); err != nil {
+				t.Fatalf("CreateAPIKey: %v", err)
+			}
+
+			result, err := store.Restore(ctx, dst, b, tt.policy, false)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Restore: got %v, want %v", err, tt.wantErr)
+			}
+			if len(result.Conflicts) != 3 {
+				t.Errorf("conflicts = %v, want gw-1, its secret, and key-1", result.Conflicts)
+			}
+			gwCounts := result.Gateways
+			gwCounts.Created = 0 // gw-2, which does not conflict
+			if gwCounts != tt.wantCounts || result.Secrets != tt.wantCounts || result.APIKeys != tt.wantCounts {
+				t.Errorf("gateways %+v, secrets %+v, API keys %+v; want %+v each",
+					result.Gateways, result.Secrets, result.APIKeys, tt.wantCounts)
+			}
+
+			wantDescription, wantSecret, wantHash := local.Description, "rotated", "reissued"
+			if tt.wantRestored {
+				wantDescription, wantSecret, wantHash = b.Gateways[0].Description, b.Secrets["builtin://gateways/gw-1/token"], b.APIKeys[0].Hash
+			}
+			if got := mustGet(t, dst, "gw-1"); got.Description != wantDescription {
+				t.Errorf("gw-1 description = %q, want %q", got.Description, wantDescription)
+			}
+			if got, err := dst.ListSecrets(ctx); err != nil || got["builtin://gateways/gw-1/token"] != wantSecret {
+				t.Errorf("secrets = %v, %v; want the token %q", got, err, wantSecret)
+			}
+			if got, err := dst.GetAPIKey(ctx, "key-1"); err != nil || got.Hash != wantHash {
+				t.Errorf("API key = %+v, %v; want hash %q", got, err, wantHash)
+			}
+			_, err = dst.GetDeletedGateway(ctx, "gw-2")
+			if got := err == nil; got != tt.wantDeleted {
+				t.Errorf("deleted gateway restored = %t, want %t", got, tt.wantDeleted)
+			}
+		})
+	}
+}
+
+func testRestoreDryRun(t *testing.T, s store.Store, fresh func() store.Store) {
+	ctx := context.Background()
+	seedBackup(t, s)
+	b := mustBackup(t, s)
+
+	dst := fresh()
+	result, err := store.Restore(ctx, dst, b, store.ConflictOverwrite, true)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if !result.DryRun || result.Gateways.Created != 2 || result.Secrets.Created != 1 || result.APIKeys.Created != 1 || result.AuditEvents != 1 {
+		t.Errorf("dry run = %+v, want it to report everything created", result)
+	}
+	sameContents(t, mustBackup(t, dst), mustBackup(t, fresh()))
+}
+
+func testRestoreRollsBack(t *testing.T, s store.Store, fresh func() store.Store) {
+	ctx := context.Background()
+	seedBackup(t, s)
+	b := mustBackup(t, s)
+	// The health check is applied after the gateways, groups, secrets, and
+	// status history are written.
+	b.HealthChecks[0].CheckedAt = "yesterday"
+
+	dst := fresh()
+	mustCreate(t, dst, newGateway("gw-9", "zulu"))
+	before := mustBackup(t, dst)
+	if _, err := store.Restore(ctx, dst, b, store.ConflictOverwrite, false); err == nil || !strings.Contains(err.Error(), "invalid checked_at") {
+		t.Fatalf("Restore: got %v, want the invalid checked_at reported", err)
+	}
+	sameContents(t, mustBackup(t, dst), before)
+}
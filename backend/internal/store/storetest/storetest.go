@@ -0,0 +1,1120 @@
+// Package storetest holds a conformance suite that every store.Store
+// implementation must pass, so the drivers cannot drift apart.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/model"
+	"github.com/AdamPippert/Lobstertank/internal/store"
+)
+
+// RunConformance runs the suite against stores built by newStore. Each
+// subtest gets a fresh store, which is closed when the subtest ends.
+func RunConformance(t *testing.T, newStore func() store.Store) {
+	// withFresh adapts a test that needs a second, empty store.
+	withFresh := func(run func(*testing.T, store.Store, func() store.Store)) func(*testing.T, store.Store) {
+		return func(t *testing.T, s store.Store) {
+			run(t, s, func() store.Store {
+				fresh := newStore()
+				t.Cleanup(func() { fresh.Close() })
+				return fresh
+			})
+		}
+	}
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s store.Store)
+	}{
+		{"CreateGet", testCreateGet},
+		{"List", testList},
+		{"Sort", testSort},
+		{"Update", testUpdate},
+		{"Delete", testDelete},
+		{"Restore", testRestore},
+		{"Purge", testPurge},
+		{"DeletedGroupMember", testDeletedGroupMember},
+		{"GroupOrg", testGroupOrg},
+		{"UpdateStatus", testUpdateStatus},
+		{"DuplicateID", testDuplicateID},
+		{"NameOrg", testNameOrg},
+		{"NotFound", testNotFound},
+		{"Labels", testLabels},
+		{"LabelFilter", testLabelFilter},
+		{"TTL", testTTL},
+		{"LastSeenAt", testLastSeenAt},
+		{"EnrolledAtZone", testEnrolledAtZone},
+		{"APIKeys", testAPIKeys},
+		{"ListByIDs", testListByIDs},
+		{"Maintenance", testMaintenance},
+		{"StatusHistory", testStatusHistory},
+		{"HealthChecks", testHealthChecks},
+		{"Groups", testGroups},
+		{"Secrets", testSecrets},
+		{"IdempotencyKeys", testIdempotencyKeys},
+		{"FanOutJobs", testFanOutJobs},
+		{"Usage", testUsage},
+		{"AuditEvents", testAuditEvents},
+		{"InTx", testInTx},
+		{"BackupRoundTrip", withFresh(testBackupRoundTrip)},
+		{"RestoreConflicts", withFresh(testRestoreConflicts)},
+		{"RestoreDryRun", withFresh(testRestoreDryRun)},
+		{"RestoreRollsBack", withFresh(testRestoreRollsBack)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStore()
+			t.Cleanup(func() { s.Close() })
+			tt.run(t, s)
+		})
+	}
+}
+
+// enrolled is a fixed enrollment time with sub-second precision, which
+// every driver must keep to the microsecond.
+var enrolled = time.Date(2024, 3, 14, 15, 9, 26, 535897000, time.UTC)
+
+func newGateway(id, name string) *model.Gateway {
+	return &model.Gateway{
+		ID:          id,
+		Name:        name,
+		Description: "conformance gateway " + name,
+		Endpoint:    "https://" + name + ".example.com",
+		Transport:   model.TransportConfig{Type: "https", Params: map[string]string{"timeout": "5s"}},
+		Auth:        model.GatewayAuthConfig{Type: "token", SecretRef: "builtin://gateways/" + id + "/token"},
+		Status:      model.StatusUnknown,
+		EnrolledAt:  enrolled,
+	}
+}
+
+func mustCreate(t *testing.T, s store.Store, gw *model.Gateway) {
+	t.Helper()
+	if err := s.CreateGateway(context.Background(), gw); err != nil {
+		t.Fatalf("CreateGateway(%s): %v", gw.ID, err)
+	}
+}
+
+func mustGet(t *testing.T, s store.Store, id string) *model.Gateway {
+	t.Helper()
+	gw, err := s.GetGateway(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetGateway(%s): %v", id, err)
+	}
+	return gw
+}
+
+func testCreateGet(t *testing.T, s store.Store) {
+	want := newGateway("gw-1", "alpha")
+	mustCreate(t, s, want)
+
+	got := mustGet(t, s, want.ID)
+	if got.Name != want.Name || got.Description != want.Description || got.Endpoint != want.Endpoint {
+		t.Errorf("got %q %q %q, want %q %q %q", got.Name, got.Description, got.Endpoint, want.Name, want.Description, want.Endpoint)
+	}
+	if got.Transport.Type != "https" || got.Transport.Params["timeout"] != "5s" {
+		t.Errorf("transport = %+v, want https with timeout 5s", got.Transport)
+	}
+	if got.Auth.Type != "token" || got.Auth.SecretRef != want.Auth.SecretRef {
+		t.Errorf("auth = %+v, want token with secret ref %s", got.Auth, want.Auth.SecretRef)
+	}
+	if got.Status != model.StatusUnknown {
+		t.Errorf("status = %s, want %s", got.Status, model.StatusUnknown)
+	}
+	if !got.EnrolledAt.Equal(enrolled.Truncate(time.Microsecond)) {
+		t.Errorf("enrolled_at = %s, want %s", got.EnrolledAt, enrolled)
+	}
+
+	byName, err := s.GetGatewayByName(context.Background(), "", want.Name)
+	if err != nil {
+		t.Fatalf("GetGatewayByName: %v", err)
+	}
+	if byName.ID != want.ID {
+		t.Errorf("GetGatewayByName returned %s, want %s", byName.ID, want.ID)
+	}
+}
+
+func testList(t *testing.T, s store.Store) {
+	for _, gw := range []*model.Gateway{newGateway("gw-b", "bravo"), newGateway("gw-a", "alpha"), newGateway("gw-c", "charlie")} {
+		mustCreate(t, s, gw)
+	}
+
+	gateways, err := s.ListGateways(context.Background(), model.GatewayFilter{}, model.ListSort{Field: "name"})
+	if err != nil {
+		t.Fatalf("ListGateways: %v", err)
+	}
+	var names []string
+	for _, gw := range gateways {
+		names = append(names, gw.Name)
+	}
+	if len(names) != 3 || names[0] != "alpha" || names[1] != "bravo" || names[2] != "charlie" {
+		t.Errorf("names = %v, want [alpha bravo charlie]", names)
+	}
+}
+
+func testSort(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	alpha, bravo, charlie := newGateway("gw-a", "alpha"), newGateway("gw-b", "bravo"), newGateway("gw-c", "charlie")
+	alpha.EnrolledAt = enrolled.Add(2 * time.Hour)
+	charlie.EnrolledAt = enrolled.Add(time.Hour)
+	for _, gw := range []*model.Gateway{alpha, bravo, charlie} {
+		mustCreate(t, s, gw)
+	}
+	// bravo is never seen, so it sorts last by last_seen_at either way.
+	for id, status := range map[string]model.Status{"gw-a": model.StatusOnline, "gw-c": model.StatusOffline} {
+		seen := mustGet(t, s, id).EnrolledAt.Add(time.Hour)
+		if err := s.UpdateGatewayStatus(ctx, id, string(status), &seen); err != nil {
+			t.Fatalf("UpdateGatewayStatus(%s): %v", id, err)
+		}
+	}
+
+	tests := []struct {
+		sort model.ListSort
+		want []string
+	}{
+		{model.ListSort{}, []string{"alpha", "charlie", "bravo"}},
+		{model.ListSort{Field: "name"}, []string{"alpha", "bravo", "charlie"}},
+		{model.ListSort{Field: "name", Descending: true}, []string{"charlie", "bravo", "alpha"}},
+		{model.ListSort{Field: "enrolled_at"}, []string{"bravo", "charlie", "alpha"}},
+		{model.ListSort{Field: "enrolled_at", Descending: true}, []string{"alpha", "charlie", "bravo"}},
+		{model.ListSort{Field: "last_seen_at"}, []string{"charlie", "alpha", "bravo"}},
+		{model.ListSort{Field: "last_seen_at", Descending: true}, []string{"alpha", "charlie", "bravo"}},
+		{model.ListSort{Field: "status"}, []string{"charlie", "alpha", "bravo"}},
+		{model.ListSort{Field: "status", Descending: true}, []string{"bravo", "alpha", "charlie"}},
+	}
+	for _, tt := range tests {
+		gateways, err := s.ListGateways(ctx, model.GatewayFilter{}, tt.sort)
+		if err != nil {
+			t.Fatalf("ListGateways(%+v): %v", tt.sort, err)
+		}
+		var names []string
+		for _, gw := range gateways {
+			names = append(names, gw.Name)
+		}
+		if fmt.Sprint(names) != fmt.Sprint(tt.want) {
+			t.Errorf("sort %+v: names = %v, want %v", tt.sort, names, tt.want)
+		}
+	}
+
+	if _, err := s.ListGateways(ctx, model.GatewayFilter{}, model.ListSort{Field: "endpoint; DROP TABLE gateways"}); err == nil {
+		t.Error("ListGateways accepted a sort field outside the whitelist")
+	}
+}
+
+func testUpdate(t *testing.T, s store.Store) {
+	gw := newGateway("gw-1", "alpha")
+	mustCreate(t, s, gw)
+
+	gw.Name = "renamed"
+	gw.Endpoint = "https://renamed.example.com"
+	gw.Transport.Params = map[string]string{"timeout": "9s"}
+	if err := s.UpdateGateway(context.Background(), gw); err != nil {
+		t.Fatalf("UpdateGateway: %v", err)
+	}
+
+	got := mustGet(t, s, gw.ID)
+	if got.Name != "renamed" || got.Endpoint != gw.Endpoint || got.Transport.Params["timeout"] != "9s" {
+		t.Errorf("after update got %q %q %v", got.Name, got.Endpoint, got.Transport.Params)
+	}
+	if !got.EnrolledAt.Equal(enrolled.Truncate(time.Microsecond)) {
+		t.Errorf("update changed enrolled_at to %s", got.EnrolledAt)
+	}
+}
+
+func testDelete(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	mustCreate(t, s, newGateway("gw-1", "alpha"))
+	mustCreate(t, s, newGateway("gw-2", "bravo"))
+	deletedAt := enrolled.Add(time.Hour)
+	if err := s.DeleteGateway(ctx, "gw-1", deletedAt); err != nil {
+		t.Fatalf("DeleteGateway: %v", err)
+	}
+
+	if _, err := s.GetGateway(ctx, "gw-1"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetGateway after delete: got %v, want ErrNotFound", err)
+	}
+	if _, err := s.GetGatewayByName(ctx, "", "alpha"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetGatewayByName after delete: got %v, want ErrNotFound", err)
+	}
+	if err := s.UpdateGatewayStatus(ctx, "gw-1", string(model.StatusOnline), nil); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("UpdateGatewayStatus after delete: got %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteGateway(ctx, "gw-1", deletedAt); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("second DeleteGateway: got %v, want ErrNotFound", err)
+	}
+	if gateways, err := s.ListGateways(ctx, model.GatewayFilter{}, model.ListSort{}); err != nil || len(gateways) != 1 || gateways[0].ID != "gw-2" {
+		t.Errorf("ListGateways after delete = %v, %v; want only gw-2", gateways, err)
+	}
+
+	deleted, err := s.ListDeletedGateways(ctx, model.GatewayFilter{}, model.ListSort{})
+	if err != nil || len(deleted) != 1 || deleted[0].ID != "gw-1" {
+		t.Fatalf("ListDeletedGateways = %v, %v; want only gw-1", deleted, err)
+	}
+	if deleted[0].DeletedAt == nil || !deleted[0].DeletedAt.Equal(deletedAt) {
+		t.Errorf("deleted_at = %v, want %s", deleted[0].DeletedAt, deletedAt)
+	}
+	if _, err := s.GetDeletedGateway(ctx, "gw-2"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetDeletedGateway of a live gateway: got %v, want ErrNotFound", err)
+	}
+
+	// The name of a deleted gateway is free for reuse.
+	mustCreate(t, s, newGateway("gw-3", "alpha"))
+}
+
+func testRestore(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	gw := newGateway("gw-1", "alpha")
+	gw.Labels = map[string]string{"env": "prod"}
+	mustCreate(t, s, gw)
+	if err := s.DeleteGateway(ctx, "gw-1", enrolled.Add(time.Hour)); err != nil {
+		t.Fatalf("DeleteGateway: %v", err)
+	}
+	if err := s.RestoreGateway(ctx, "gw-1"); err != nil {
+		t.Fatalf("RestoreGateway: %v", err)
+	}
+
+	got := mustGet(t, s, "gw-1")
+	if got.DeletedAt != nil || got.Labels["env"] != "prod" || got.Auth.SecretRef != gw.Auth.SecretRef {
+		t.Errorf("restored gateway = %+v, want it as created", got)
+	}
+	if err := s.RestoreGateway(ctx, "gw-1"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("RestoreGateway of a live gateway: got %v, want ErrNotFound", err)
+	}
+
+	// A gateway whose name was taken while it was deleted stays deleted.
+	if err := s.DeleteGateway(ctx, "gw-1", enrolled.Add(time.Hour)); err != nil {
+		t.Fatalf("DeleteGateway: %v", err)
+	}
+	mustCreate(t, s, newGateway("gw-2", "alpha"))
+	if err := s.RestoreGateway(ctx, "gw-1"); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("RestoreGateway with its name taken: got %v, want ErrConflict", err)
+	}
+}
+
+func testPurge(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	mustCreate(t, s, newGateway("gw-1", "alpha"))
+	mustCreate(t, s, newGateway("gw-2", "bravo"))
+	if err := s.DeleteGateway(ctx, "gw-1", enrolled.Add(time.Hour)); err != nil {
+		t.Fatalf("DeleteGateway: %v", err)
+	}
+
+	for _, id := range []string{"gw-1", "gw-2"} {
+		if err := s.PurgeGateway(ctx, id); err != nil {
+			t.Fatalf("PurgeGateway(%s): %v", id, err)
+		}
+		if err := s.PurgeGateway(ctx, id); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("second PurgeGateway(%s): got %v, want ErrNotFound", id, err)
+		}
+	}
+	if deleted, err := s.ListDeletedGateways(ctx, model.GatewayFilter{}, model.ListSort{}); err != nil || len(deleted) != 0 {
+		t.Errorf("ListDeletedGateways after purge = %v, %v; want none", deleted, err)
+	}
+	if err := s.RestoreGateway(ctx, "gw-1"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("RestoreGateway after purge: got %v, want ErrNotFound", err)
+	}
+}
+
+func testDeletedGroupMember(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	mustCreate(t, s, newGateway("gw-1", "alpha"))
+	mustCreate(t, s, newGateway("gw-2", "bravo"))
+	g := &model.Group{ID: "grp-1", Name: "fleet", GatewayIDs: []string{"gw-1", "gw-2"}, CreatedAt: enrolled}
+	if err := s.CreateGroup(ctx, g); err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+	if err := s.DeleteGateway(ctx, "gw-1", enrolled.Add(time.Hour)); err != nil {
+		t.Fatalf("DeleteGateway: %v", err)
+	}
+
+	members := func() []string {
+		t.Helper()
+		got, err := s.GetGroup(ctx, "grp-1")
+		if err != nil {
+			t.Fatalf("GetGroup: %v", err)
+		}
+		return got.GatewayIDs
+	}
+	if got := members(); len(got) != 1 || got[0] != "gw-2" {
+		t.Errorf("members after delete = %v, want [gw-2]", got)
+	}
+
+	// Updating the group keeps the deleted member for a restore.
+	g.Name, g.GatewayIDs = "fleet-2", []string{"gw-2"}
+	if err := s.UpdateGroup(ctx, g); err != nil {
+		t.Fatalf("UpdateGroup: %v", err)
+	}
+	if err := s.RestoreGateway(ctx, "gw-1"); err != nil {
+		t.Fatalf("RestoreGateway: %v", err)
+	}
+	if got := members(); len(got) != 2 {
+		t.Errorf("members after restore = %v, want [gw-1 gw-2]", got)
+	}
+}
+
+func testGroupOrg(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	g := &model.Group{ID: "grp-1", Name: "fleet", GatewayIDs: []string{}, CreatedAt: enrolled, OrgID: "acme"}
+	if err := s.CreateGroup(ctx, g); err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+	got, err := s.GetGroup(ctx, "grp-1")
+	if err != nil {
+		t.Fatalf("GetGroup: %v", err)
+	}
+	if got.OrgID != "acme" {
+		t.Errorf("GetGroup org = %q, want acme", got.OrgID)
+	}
+	groups, err := s.ListGroups(ctx)
+	if err != nil {
+		t.Fatalf("ListGroups: %v", err)
+	}
+	if len(groups) != 1 || groups[0].OrgID != "acme" {
+		t.Errorf("ListGroups = %+v, want fleet in acme", groups)
+	}
+}
+
+func testUpdateStatus(t *testing.T, s store.Store) {
+	mustCreate(t, s, newGateway("gw-1", "alpha"))
+	seen := enrolled.Add(time.Hour)
+	if err := s.UpdateGatewayStatus(context.Background(), "gw-1", string(model.StatusOnline), &seen); err != nil {
+		t.Fatalf("UpdateGatewayStatus: %v", err)
+	}
+
+	got := mustGet(t, s, "gw-1")
+	if got.Status != model.StatusOnline {
+		t.Errorf("status = %s, want online", got.Status)
+	}
+	if got.LastSeenAt == nil || !got.LastSeenAt.Equal(seen.Truncate(time.Microsecond)) {
+		t.Errorf("last_seen_at = %v, want %s", got.LastSeenAt, seen)
+	}
+}
+
+func testDuplicateID(t *testing.T, s store.Store) {
+	mustCreate(t, s, newGateway("gw-1", "alpha"))
+	err := s.CreateGateway(context.Background(), newGateway("gw-1", "bravo"))
+	if !errors.Is(err, store.ErrConflict) {
+		t.Errorf("duplicate ID: got %v, want ErrConflict", err)
+	}
+	err = s.CreateGateway(context.Background(), newGateway("gw-2", "alpha"))
+	if !errors.Is(err, store.ErrConflict) {
+		t.Errorf("duplicate name: got %v, want ErrConflict", err)
+	}
+}
+
+func testNameOrg(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	acme, initech := newGateway("gw-1", "edge"), newGateway("gw-2", "edge")
+	acme.OrgID, initech.OrgID = "acme", "initech"
+	mustCreate(t, s, acme)
+	mustCreate(t, s, initech)
+
+	for _, want := range []*model.Gateway{acme, initech} {
+		got, err := s.GetGatewayByName(ctx, want.OrgID, "edge")
+		if err != nil || got.ID != want.ID {
+			t.Errorf("GetGatewayByName(%s) = %v, %v; want %s", want.OrgID, got, err, want.ID)
+		}
+	}
+	if _, err := s.GetGatewayByName(ctx, "", "edge"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetGatewayByName unscoped: got %v, want ErrNotFound", err)
+	}
+
+	dup := newGateway("gw-3", "edge")
+	dup.OrgID = "acme"
+	if err := s.CreateGateway(ctx, dup); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("duplicate name in org: got %v, want ErrConflict", err)
+	}
+	renamed := newGateway("gw-4", "core")
+	renamed.OrgID = "acme"
+	mustCreate(t, s, renamed)
+	renamed.Name = "edge"
+	if err := s.UpdateGateway(ctx, renamed); !errors.Is(err, store.ErrConflict) {
+		t.Errorf("rename onto a name in org: got %v, want ErrConflict", err)
+	}
+}
+
+func testNotFound(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	checks := map[string]error{}
+	_, checks["GetGateway"] = s.GetGateway(ctx, "missing")
+	_, checks["GetGatewayByName"] = s.GetGatewayByName(ctx, "", "missing")
+	_, checks["GetDeletedGateway"] = s.GetDeletedGateway(ctx, "missing")
+	checks["UpdateGateway"] = s.UpdateGateway(ctx, newGateway("missing", "missing"))
+	checks["DeleteGateway"] = s.DeleteGateway(ctx, "missing", enrolled)
+	checks["RestoreGateway"] = s.RestoreGateway(ctx, "missing")
+	checks["PurgeGateway"] = s.PurgeGateway(ctx, "missing")
+	checks["UpdateGatewayStatus"] = s.UpdateGatewayStatus(ctx, "missing", string(model.StatusOnline), nil)
+	for op, err := range checks {
+		if !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("%s: got %v, want ErrNotFound", op, err)
+		}
+	}
+}
+
+func testLabels(t *testing.T, s store.Store) {
+	gw := newGateway("gw-1", "alpha")
+	gw.Labels = map[string]string{"env": "prod", "region": "eu-west-1", "quoted": `a "b" c`}
+	mustCreate(t, s, gw)
+
+	got := mustGet(t, s, gw.ID)
+	if len(got.Labels) != len(gw.Labels) {
+		t.Fatalf("labels = %v, want %v", got.Labels, gw.Labels)
+	}
+	for k, v := range gw.Labels {
+		if got.Labels[k] != v {
+			t.Errorf("label %s = %q, want %q", k, got.Labels[k], v)
+		}
+	}
+
+	unlabeled := newGateway("gw-2", "bravo")
+	mustCreate(t, s, unlabeled)
+	if got := mustGet(t, s, unlabeled.ID); len(got.Labels) != 0 {
+		t.Errorf("unlabeled gateway has labels %v", got.Labels)
+	}
+}
+
+func testLabelFilter(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	for _, gw := range []struct {
+		id, name string
+		status   model.Status
+		labels   map[string]string
+	}{
+		{"gw-1", "alpha", model.StatusOnline, map[string]string{"env": "prod", "region": "eu"}},
+		{"gw-2", "bravo", model.StatusOffline, map[string]string{"env": "prod", "region": "us"}},
+		{"gw-3", "charlie", model.StatusOnline, map[string]string{"env": "dev", `odd "key".x`: "y"}},
+		{"gw-4", "delta", model.StatusOnline, nil},
+	} {
+		g := newGateway(gw.id, gw.name)
+		g.Status, g.Labels = gw.status, gw.labels
+		mustCreate(t, s, g)
+	}
+
+	tests := []struct {
+		name   string
+		filter model.GatewayFilter
+		want   []string
+	}{
+		{"none", model.GatewayFilter{}, []string{"gw-1", "gw-2", "gw-3", "gw-4"}},
+		{"one label", model.GatewayFilter{Labels: map[string]string{"env": "prod"}}, []string{"gw-1", "gw-2"}},
+		{"two labels", model.GatewayFilter{Labels: map[string]string{"env": "prod", "region": "us"}}, []string{"gw-2"}},
+		{"odd key", model.GatewayFilter{Labels: map[string]string{`odd "key".x`: "y"}}, []string{"gw-3"}},
+		{"no match", model.GatewayFilter{Labels: map[string]string{"env": "staging"}}, nil},
+		{"empty value", model.GatewayFilter{Labels: map[string]string{"env": ""}}, nil},
+		{"status", model.GatewayFilter{Status: model.StatusOnline}, []string{"gw-1", "gw-3", "gw-4"}},
+		{"status and label", model.GatewayFilter{Status: model.StatusOnline, Labels: map[string]string{"env": "prod"}}, []string{"gw-1"}},
+	}
+	for _, tt := range tests {
+		gateways, err := s.ListGateways(ctx, tt.filter, model.ListSort{Field: "name"})
+		if err != nil {
+			t.Fatalf("%s: ListGateways: %v", tt.name, err)
+		}
+		var got []string
+		for _, gw := range gateways {
+			got = append(got, gw.ID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func testTTL(t *testing.T, s store.Store) {
+	mustCreate(t, s, newGateway("gw-1", "alpha"))
+	if got := mustGet(t, s, "gw-1"); got.TTLSeconds != nil {
+		t.Errorf("ttl_seconds = %d, want nil", *got.TTLSeconds)
+	}
+
+	gw := newGateway("gw-2", "bravo")
+	ttl := 300
+	gw.TTLSeconds = &ttl
+	mustCreate(t, s, gw)
+	if got := mustGet(t, s, gw.ID); got.TTLSeconds == nil || *got.TTLSeconds != ttl {
+		t.Errorf("ttl_seconds = %v, want %d", got.TTLSeconds, ttl)
+	}
+
+	gw.TTLSeconds = nil
+	if err := s.UpdateGateway(context.Background(), gw); err != nil {
+		t.Fatalf("UpdateGateway: %v", err)
+	}
+	if got := mustGet(t, s, gw.ID); got.TTLSeconds != nil {
+		t.Errorf("ttl_seconds after clearing = %d, want nil", *got.TTLSeconds)
+	}
+}
+
+func testLastSeenAt(t *testing.T, s store.Store) {
+	mustCreate(t, s, newGateway("gw-1", "alpha"))
+	if got := mustGet(t, s, "gw-1"); got.LastSeenAt != nil {
+		t.Errorf("last_seen_at = %s, want nil", got.LastSeenAt)
+	}
+
+	seen := time.Date(2024, 3, 14, 18, 0, 0, 0, time.FixedZone("UTC+2", 2*60*60))
+	if err := s.UpdateGatewayStatus(context.Background(), "gw-1", string(model.StatusOnline), &seen); err != nil {
+		t.Fatalf("UpdateGatewayStatus: %v", err)
+	}
+	got := mustGet(t, s, "gw-1")
+	if got.LastSeenAt == nil || !got.LastSeenAt.Equal(seen) || got.LastSeenAt.Location() != time.UTC {
+		t.Errorf("last_seen_at = %v, want %s in UTC", got.LastSeenAt, seen.UTC())
+	}
+
+	if err := s.UpdateGatewayStatus(context.Background(), "gw-1", string(model.StatusOffline), nil); err != nil {
+		t.Fatalf("UpdateGatewayStatus: %v", err)
+	}
+	if got := mustGet(t, s, "gw-1"); got.LastSeenAt != nil {
+		t.Errorf("last_seen_at after clearing = %s, want nil", got.LastSeenAt)
+	}
+}
+
+func testEnrolledAtZone(t *testing.T, s store.Store) {
+	gw := newGateway("gw-1", "alpha")
+	gw.EnrolledAt = enrolled.In(time.FixedZone("UTC-5", -5*60*60))
+	mustCreate(t, s, gw)
+
+	got := mustGet(t, s, gw.ID)
+	if !got.EnrolledAt.Equal(enrolled.Truncate(time.Microsecond)) {
+		t.Errorf("enrolled_at = %s, want %s", got.EnrolledAt, enrolled)
+	}
+	if got.EnrolledAt.Location() != time.UTC {
+		t.Errorf("enrolled_at location = %s, want UTC", got.EnrolledAt.Location())
+	}
+}
+
+func testAPIKeys(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	expires := enrolled.Add(24 * time.Hour)
+	keys := []model.APIKey{
+		{ID: "key-1", Name: "ci", Roles: []string{"admin", "user"}, Org: "acme", CreatedBy: "cli", CreatedAt: enrolled, ExpiresAt: &expires, Hash: "h1"},
+		{ID: "key-2", Name: "deploy", Roles: []string{}, CreatedBy: "cli", CreatedAt: enrolled.Add(time.Second), Hash: "h2"},
+	}
+	for i := range keys {
+		if err := s.CreateAPIKey(ctx, &keys[i]); err != nil {
+			t.Fatalf("CreateAPIKey(%s): %v", keys[i].ID, err)
+		}
+	}
+
+	got, err := s.GetAPIKey(ctx, "key-1")
+	if err != nil {
+		t.Fatalf("GetAPIKey: %v", err)
+	}
+	if got.Name != "ci" || got.Org != "acme" || got.Hash != "h1" || fmt.Sprint(got.Roles) != "[admin user]" {
+		t.Errorf("GetAPIKey = %+v, want the key as created", got)
+	}
+	if !got.CreatedAt.Equal(enrolled) || got.ExpiresAt == nil || !got.ExpiresAt.Equal(expires) {
+		t.Errorf("times = %v, %v; want %v, %v", got.CreatedAt, got.ExpiresAt, enrolled, expires)
+	}
+	if got.LastUsedAt != nil || got.Revoked {
+		t.Errorf("new key: last used %v, revoked %v; want neither", got.LastUsedAt, got.Revoked)
+	}
+
+	used := enrolled.Add(time.Hour)
+	if err := s.TouchAPIKey(ctx, "key-1", used); err != nil {
+		t.Fatalf("TouchAPIKey: %v", err)
+	}
+	if err := s.RevokeAPIKey(ctx, "key-2"); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+
+	list, err := s.ListAPIKeys(ctx)
+	if err != nil {
+		t.Fatalf("ListAPIKeys: %v", err)
+	}
+	if len(list) != 2 || list[0].ID != "key-1" || list[1].ID != "key-2" {
+		t.Fatalf("ListAPIKeys = %+v, want key-1, key-2", list)
+	}
+	if list[0].LastUsedAt == nil || !list[0].LastUsedAt.Equal(used) {
+		t.Errorf("last used = %v, want %v", list[0].LastUsedAt, used)
+	}
+	if list[0].Revoked || !list[1].Revoked {
+		t.Errorf("revoked = %v, %v; want false, true", list[0].Revoked, list[1].Revoked)
+	}
+	if list[1].ExpiresAt != nil || len(list[1].Roles) != 0 || list[1].Org != "" {
+		t.Errorf("key-2 = %+v, want no expiry, roles, or org", list[1])
+	}
+
+	if _, err := s.GetAPIKey(ctx, "missing"); !errors.Is(err, store.ErrAPIKeyNotFound) {
+		t.Errorf("GetAPIKey(missing): got %v, want ErrAPIKeyNotFound", err)
+	}
+	if err := s.RevokeAPIKey(ctx, "missing"); !errors.Is(err, store.ErrAPIKeyNotFound) {
+		t.Errorf("RevokeAPIKey(missing): got %v, want ErrAPIKeyNotFound", err)
+	}
+
+	if err := s.DeleteAPIKey(ctx, "key-2"); err != nil {
+		t.Fatalf("DeleteAPIKey: %v", err)
+	}
+	if _, err := s.GetAPIKey(ctx, "key-2"); !errors.Is(err, store.ErrAPIKeyNotFound) {
+		t.Errorf("GetAPIKey after delete: got %v, want ErrAPIKeyNotFound", err)
+	}
+	if err := s.DeleteAPIKey(ctx, "key-2"); !errors.Is(err, store.ErrAPIKeyNotFound) {
+		t.Errorf("second DeleteAPIKey: got %v, want ErrAPIKeyNotFound", err)
+	}
+}
+
+func testListByIDs(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	for _, gw := range []*model.Gateway{newGateway("gw-1", "alpha"), newGateway("gw-2", "bravo"), newGateway("gw-3", "charlie")} {
+		mustCreate(t, s, gw)
+	}
+	if err := s.DeleteGateway(ctx, "gw-3", enrolled.Add(time.Hour)); err != nil {
+		t.Fatalf("DeleteGateway: %v", err)
+	}
+
+	found, missing, err := s.ListGatewaysByIDs(ctx, []string{"gw-2", "gw-missing", "gw-1", "gw-2", "gw-3"})
+	if err != nil {
+		t.Fatalf("ListGatewaysByIDs: %v", err)
+	}
+	var ids []string
+	for _, gw := range found {
+		ids = append(ids, gw.ID)
+	}
+	if fmt.Sprint(ids) != "[gw-2 gw-1]" {
+		t.Errorf("found %v, want [gw-2 gw-1] in the order asked for, without repeats", ids)
+	}
+	if fmt.Sprint(missing) != "[gw-missing gw-3]" {
+		t.Errorf("missing %v, want [gw-missing gw-3]; deleted gateways are missing", missing)
+	}
+	if len(found) > 0 && found[0].Endpoint != "https://bravo.example.com" {
+		t.Errorf("found[0] = %+v, want bravo in full", found[0])
+	}
+
+	found, missing, err = s.ListGatewaysByIDs(ctx, nil)
+	if err != nil || len(found) != 0 || len(missing) != 0 {
+		t.Errorf("ListGatewaysByIDs(nil) = %v, %v, %v; want nothing", found, missing, err)
+	}
+}
+
+func testMaintenance(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	mustCreate(t, s, newGateway("gw-1", "alpha"))
+	until := enrolled.Add(2 * time.Hour)
+	if err := s.SetGatewayMaintenance(ctx, "gw-1", string(model.StatusMaintenance), "kernel upgrade", &until); err != nil {
+		t.Fatalf("SetGatewayMaintenance: %v", err)
+	}
+	got := mustGet(t, s, "gw-1")
+	if got.Status != model.StatusMaintenance || got.MaintenanceReason != "kernel upgrade" ||
+		got.MaintenanceUntil == nil || !got.MaintenanceUntil.Equal(until) {
+		t.Errorf("in maintenance: status %s, reason %q, until %v", got.Status, got.MaintenanceReason, got.MaintenanceUntil)
+	}
+
+	if err := s.SetGatewayMaintenance(ctx, "gw-1", string(model.StatusUnknown), "", nil); err != nil {
+		t.Fatalf("SetGatewayMaintenance: %v", err)
+	}
+	got = mustGet(t, s, "gw-1")
+	if got.Status != model.StatusUnknown || got.MaintenanceReason != "" || got.MaintenanceUntil != nil {
+		t.Errorf("out of maintenance: status %s, reason %q, until %v", got.Status, got.MaintenanceReason, got.MaintenanceUntil)
+	}
+
+	if err := s.SetGatewayMaintenance(ctx, "missing", string(model.StatusMaintenance), "", nil); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("SetGatewayMaintenance(missing): got %v, want ErrNotFound", err)
+	}
+}
+
+func testStatusHistory(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	mustCreate(t, s, newGateway("gw-1", "alpha"))
+	mustCreate(t, s, newGateway("gw-2", "bravo"))
+	transitions := []model.StatusTransition{
+		{GatewayID: "gw-1", From: model.StatusUnknown, To: model.StatusOnline, Latency: "12ms", ObservedAt: enrolled},
+		{GatewayID: "gw-1", From: model.StatusOnline, To: model.StatusOffline, Error: "dial tcp: connection refused",
+			ErrorKind: model.ErrorKindConnectionRefused, ObservedAt: enrolled.Add(time.Hour)},
+		{GatewayID: "gw-2", From: model.StatusUnknown, To: model.StatusOnline, ObservedAt: enrolled.Add(time.Hour)},
+		{GatewayID: "gw-1", From: model.StatusOffline, To: model.StatusOnline, ObservedAt: enrolled.Add(2 * time.Hour)},
+	}
+	for i := range transitions {
+		if err := s.InsertStatusTransition(ctx, &transitions[i]); err != nil {
+			t.Fatalf("InsertStatusTransition %d: %v", i, err)
+		}
+	}
+
+	got, err := s.ListStatusTransitions(ctx, "gw-1", enrolled.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("ListStatusTransitions: %v", err)
+	}
+	if len(got) != 2 || got[0].To != model.StatusOffline || got[1].To != model.StatusOnline {
+		t.Fatalf("transitions since an hour in = %+v, want offline then online, oldest first", got)
+	}
+	if got[0].Error != transitions[1].Error || got[0].ErrorKind != model.ErrorKindConnectionRefused || !got[0].ObservedAt.Equal(enrolled.Add(time.Hour)) {
+		t.Errorf("transition = %+v, want it as inserted", got[0])
+	}
+
+	n, err := s.PruneStatusHistory(ctx, enrolled.Add(90*time.Minute))
+	if err != nil || n != 3 {
+		t.Errorf("PruneStatusHistory = %d, %v; want 3 pruned", n, err)
+	}
+	if got, err := s.ListStatusTransitions(ctx, "gw-1", time.Time{}); err != nil || len(got) != 1 {
+		t.Errorf("transitions after prune = %+v, %v; want the last one", got, err)
+	}
+}
+
+func testHealthChecks(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	mustCreate(t, s, newGateway("gw-1", "alpha"))
+	mustCreate(t, s, newGateway("gw-2", "bravo"))
+
+	// Inserted out of order; listing orders them by check time.
+	for _, minute := range []int{2, 0, 4, 1, 3} {
+		r := &model.HealthCheckResult{
+			GatewayID:     "gw-1",
+			Status:        model.StatusOnline,
+			Latency:       fmt.Sprintf("%dms", minute),
+			LatencyMillis: int64(minute),
+			Attempts:      1,
+		}
+		if minute == 3 {
+			r.Status, r.Error, r.ErrorKind = model.StatusOffline, "i/o timeout", model.ErrorKindTimeout
+		}
+		if err := s.InsertHealthCheck(ctx, r, enrolled.Add(time.Duration(minute)*time.Minute)); err != nil {
+			t.Fatalf("InsertHealthCheck: %v", err)
+		}
+	}
+	if err := s.InsertHealthCheck(ctx, &model.HealthCheckResult{GatewayID: "gw-2", Status: model.StatusOnline}, enrolled.Add(time.Hour)); err != nil {
+		t.Fatalf("InsertHealthCheck gw-2: %v", err)
+	}
+
+	checks, err := s.ListHealthChecks(ctx, "gw-1", 3)
+	if err != nil {
+		t.Fatalf("ListHealthChecks: %v", err)
+	}
+	var latencies []int64
+	for _, c := range checks {
+		latencies = append(latencies, c.LatencyMillis)
+	}
+	if fmt.Sprint(latencies) != "[4 3 2]" {
+		t.Fatalf("latest 3 checks by latency = %v, want [4 3 2], newest first", latencies)
+	}
+	want := enrolled.Add(3 * time.Minute).UTC().Format(time.RFC3339)
+	if c := checks[1]; c.GatewayID != "gw-1" || c.Status != model.StatusOffline || c.Error != "i/o timeout" ||
+		c.ErrorKind != model.ErrorKindTimeout || c.Latency != "3ms" || c.Attempts != 1 || c.CheckedAt != want {
+		t.Errorf("check = %+v, want it as inserted, checked at %s", c, want)
+	}
+
+	n, err := s.PruneHealthChecks(ctx, "gw-1", enrolled.Add(2*time.Minute))
+	if err != nil || n != 2 {
+		t.Errorf("PruneHealthChecks = %d, %v; want 2 pruned", n, err)
+	}
+	if checks, err := s.ListHealthChecks(ctx, "gw-1", 10); err != nil || len(checks) != 3 {
+		t.Errorf("gw-1 checks after prune = %d, %v; want 3", len(checks), err)
+	}
+	if checks, err := s.ListHealthChecks(ctx, "gw-2", 10); err != nil || len(checks) != 1 {
+		t.Errorf("gw-2 checks = %d, %v; want 1, untouched by pruning gw-1", len(checks), err)
+	}
+}
+
+func testGroups(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	mustCreate(t, s, newGateway("gw-1", "alpha"))
+	mustCreate(t, s, newGateway("gw-2", "bravo"))
+	edge := &model.Group{ID: "grp-1", Name: "edge", Description: "edge fleet", GatewayIDs: []string{"gw-2", "gw-1"}, CreatedAt: enrolled}
+	core := &model.Group{ID: "grp-2", Name: "core", GatewayIDs: []string{}, CreatedAt: enrolled}
+	for _, g := range []*model.Group{edge, core} {
+		if err := s.CreateGroup(ctx, g); err != nil {
+			t.Fatalf("CreateGroup(%s): %v", g.ID, err)
+		}
+	}
+
+	got, err := s.GetGroup(ctx, "grp-1")
+	if err != nil {
+		t.Fatalf("GetGroup: %v", err)
+	}
+	if got.Name != "edge" || got.Description != "edge fleet" || fmt.Sprint(got.GatewayIDs) != "[gw-1 gw-2]" || !got.CreatedAt.Equal(enrolled) {
+		t.Errorf("GetGroup = %+v, want edge with gw-1 and gw-2", got)
+	}
+	groups, err := s.ListGroups(ctx)
+	if err != nil || len(groups) != 2 || groups[0].Name != "core" || groups[1].Name != "edge" || len(groups[0].GatewayIDs) != 0 {
+		t.Errorf("ListGroups = %+v, %v; want core then edge", groups, err)
+	}
+
+	edge.Name, edge.GatewayIDs = "edge-2", []string{"gw-1"}
+	if err := s.UpdateGroup(ctx, edge); err != nil {
+		t.Fatalf("UpdateGroup: %v", err)
+	}
+	if got, err := s.GetGroup(ctx, "grp-1"); err != nil || got.Name != "edge-2" || fmt.Sprint(got.GatewayIDs) != "[gw-1]" {
+		t.Errorf("after update GetGroup = %+v, %v; want edge-2 with gw-1", got, err)
+	}
+
+	dup := &model.Group{ID: "grp-3", Name: "core", CreatedAt: enrolled}
+	if err := s.CreateGroup(ctx, dup); !errors.Is(err, store.ErrGroupConflict) {
+		t.Errorf("CreateGroup with a taken name: got %v, want ErrGroupConflict", err)
+	}
+	edge.Name = "core"
+	if err := s.UpdateGroup(ctx, edge); !errors.Is(err, store.ErrGroupConflict) {
+		t.Errorf("UpdateGroup to a taken name: got %v, want ErrGroupConflict", err)
+	}
+
+	if err := s.DeleteGroup(ctx, "grp-1"); err != nil {
+		t.Fatalf("DeleteGroup: %v", err)
+	}
+	checks := map[string]error{}
+	_, checks["GetGroup"] = s.GetGroup(ctx, "grp-1")
+	checks["UpdateGroup"] = s.UpdateGroup(ctx, &model.Group{ID: "grp-1", Name: "gone"})
+	checks["DeleteGroup"] = s.DeleteGroup(ctx, "grp-1")
+	for op, err := range checks {
+		if !errors.Is(err, store.ErrGroupNotFound) {
+			t.Errorf("%s of a deleted group: got %v, want ErrGroupNotFound", op, err)
+		}
+	}
+	// The gateways outlive the group.
+	mustGet(t, s, "gw-1")
+}
+
+func testSecrets(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	for ref, value := range map[string]string{"builtin://a": "one", "builtin://b": "two"} {
+		if err := s.PutSecret(ctx, ref, value); err != nil {
+			t.Fatalf("PutSecret(%s): %v", ref, err)
+		}
+	}
+	if err := s.PutSecret(ctx, "builtin://a", "uno"); err != nil {
+		t.Fatalf("PutSecret overwrite: %v", err)
+	}
+	if err := s.DeleteSecret(ctx, "builtin://b"); err != nil {
+		t.Fatalf("DeleteSecret: %v", err)
+	}
+	if err := s.DeleteSecret(ctx, "builtin://missing"); err != nil {
+		t.Errorf("DeleteSecret of a missing ref: %v", err)
+	}
+
+	got, err := s.ListSecrets(ctx)
+	if err != nil {
+		t.Fatalf("ListSecrets: %v", err)
+	}
+	if len(got) != 1 || got["builtin://a"] != "uno" {
+		t.Errorf("ListSecrets = %v, want only builtin://a = uno", got)
+	}
+}
+
+func testIdempotencyKeys(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	mustCreate(t, s, newGateway("gw-1", "alpha"))
+	mustCreate(t, s, newGateway("gw-2", "bravo"))
+
+	if _, err := s.GetIdempotencyKey(ctx, "key-1"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetIdempotencyKey of an unknown key: got %v, want ErrNotFound", err)
+	}
+	if err := s.PutIdempotencyKey(ctx, "key-1", "gw-1", enrolled); err != nil {
+		t.Fatalf("PutIdempotencyKey: %v", err)
+	}
+	if id, err := s.GetIdempotencyKey(ctx, "key-1"); err != nil || id != "gw-1" {
+		t.Errorf("GetIdempotencyKey = %q, %v; want gw-1", id, err)
+	}
+	if err := s.PutIdempotencyKey(ctx, "key-1", "gw-2", enrolled.Add(time.Hour)); err != nil {
+		t.Fatalf("PutIdempotencyKey again: %v", err)
+	}
+	if id, err := s.GetIdempotencyKey(ctx, "key-1"); err != nil || id != "gw-2" {
+		t.Errorf("GetIdempotencyKey after a second put = %q, %v; want gw-2", id, err)
+	}
+
+	// Keys go with the gateway they created.
+	if err := s.PurgeGateway(ctx, "gw-2"); err != nil {
+		t.Fatalf("PurgeGateway: %v", err)
+	}
+	if _, err := s.GetIdempotencyKey(ctx, "key-1"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetIdempotencyKey after purging its gateway: got %v, want ErrNotFound", err)
+	}
+}
+
+func testFanOutJobs(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	jobs := []*model.FanOutJob{
+		{ID: "job-1", Status: model.JobPending, Total: 3, CreatedBy: "alice", OrgID: "acme", CreatedAt: enrolled, UpdatedAt: enrolled},
+		{ID: "job-2", Status: model.JobPending, Total: 1, CreatedAt: enrolled, UpdatedAt: enrolled.Add(time.Hour)},
+	}
+	for _, job := range jobs {
+		if err := s.CreateFanOutJob(ctx, job); err != nil {
+			t.Fatalf("CreateFanOutJob(%s): %v", job.ID, err)
+		}
+	}
+
+	// Results arrive in completion order; the job lists them by position.
+	results := []model.FanOutJobResult{
+		{Position: 2, GatewayID: "gw-3", GatewayName: "charlie", Skipped: true, SkipReason: "offline", CompletedAt: enrolled},
+		{Position: 0, GatewayID: "gw-1", GatewayName: "alpha", Response: "ok", LatencyMillis: 42, CompletedAt: enrolled.Add(time.Second)},
+	}
+	for i := range results {
+		if err := s.InsertFanOutResult(ctx, "job-1", &results[i]); err != nil {
+			t.Fatalf("InsertFanOutResult: %v", err)
+		}
+	}
+	if err := s.UpdateFanOutJobStatus(ctx, "job-1", model.JobPartial, enrolled.Add(time.Minute)); err != nil {
+		t.Fatalf("UpdateFanOutJobStatus: %v", err)
+	}
+
+	job, err := s.GetFanOutJob(ctx, "job-1")
+	if err != nil {
+		t.Fatalf("GetFanOutJob: %v", err)
+	}
+	if job.Status != model.JobPartial || job.Total != 3 || job.CreatedBy != "alice" || job.OrgID != "acme" ||
+		!job.CreatedAt.Equal(enrolled) || !job.UpdatedAt.Equal(enrolled.Add(time.Minute)) {
+		t.Errorf("GetFanOutJob = %+v, want job-1 partial, updated a minute in", job)
+	}
+	if len(job.Results) != 2 || job.Results[0].GatewayID != "gw-1" || job.Results[1].GatewayID != "gw-3" {
+		t.Fatalf("results = %+v, want gw-1 then gw-3", job.Results)
+	}
+	if r := job.Results[0]; r.Response != "ok" || r.LatencyMillis != 42 || r.Skipped || !r.CompletedAt.Equal(enrolled.Add(time.Second)) {
+		t.Errorf("result = %+v, want it as inserted", r)
+	}
+	if r := job.Results[1]; !r.Skipped || r.SkipReason != "offline" || r.GatewayName != "charlie" {
+		t.Errorf("skipped result = %+v, want it as inserted", r)
+	}
+	if job, err := s.GetFanOutJob(ctx, "job-2"); err != nil || job.Results == nil || len(job.Results) != 0 {
+		t.Errorf("job without results = %+v, %v; want an empty result list", job, err)
+	}
+
+	// job-1 was last updated before job-2.
+	n, err := s.PruneFanOutJobs(ctx, enrolled.Add(30*time.Minute))
+	if err != nil || n != 1 {
+		t.Errorf("PruneFanOutJobs = %d, %v; want job-1 pruned", n, err)
+	}
+	if err := s.DeleteFanOutJob(ctx, "job-2"); err != nil {
+		t.Fatalf("DeleteFanOutJob: %v", err)
+	}
+
+	checks := map[string]error{}
+	_, checks["GetFanOutJob pruned"] = s.GetFanOutJob(ctx, "job-1")
+	_, checks["GetFanOutJob deleted"] = s.GetFanOutJob(ctx, "job-2")
+	checks["UpdateFanOutJobStatus"] = s.UpdateFanOutJobStatus(ctx, "job-2", model.JobComplete, enrolled)
+	checks["DeleteFanOutJob"] = s.DeleteFanOutJob(ctx, "job-2")
+	for op, err := range checks {
+		if !errors.Is(err, store.ErrJobNotFound) {
+			t.Errorf("%s: got %v, want ErrJobNotFound", op, err)
+		}
+	}
+}
+
+func testUsage(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	mustCreate(t, s, newGateway("gw-1", "alpha"))
+	mustCreate(t, s, newGateway("gw-2", "bravo"))
+	hour := enrolled.Truncate(time.Hour)
+	for _, u := range []struct {
+		gw   string
+		hour time.Time
+		use  model.Usage
+	}{
+		{"gw-1", hour.Add(-time.Hour), model.Usage{Model: "small", PromptTokens: 1000, CompletionTokens: 1000}},
+		{"gw-1", hour, model.Usage{Model: "small", PromptTokens: 10, CompletionTokens: 20}},
+		{"gw-1", hour, model.Usage{Model: "small", PromptTokens: 5, CompletionTokens: 7}},
+		{"gw-1", hour.Add(time.Hour), model.Usage{Model: "small", PromptTokens: 1, CompletionTokens: 1}},
+		{"gw-1", hour, model.Usage{Model: "large", PromptTokens: 100, CompletionTokens: 200}},
+		{"gw-2", hour, model.Usage{}},
+	} {
+		if err := s.AddUsage(ctx, u.gw, u.hour, u.use); err != nil {
+			t.Fatalf("AddUsage: %v", err)
+		}
+	}
+
+	all, err := s.ListUsage(ctx, "", hour)
+	if err != nil {
+		t.Fatalf("ListUsage: %v", err)
+	}
+	want := []model.UsageTotals{
+		{GatewayID: "gw-1", Model: "large", Requests: 1, PromptTokens: 100, CompletionTokens: 200},
+		{GatewayID: "gw-1", Model: "small", Requests: 3, PromptTokens: 16, CompletionTokens: 28},
+		{GatewayID: "gw-2", Model: "", Requests: 1},
+	}
+	if fmt.Sprint(all) != fmt.Sprint(want) {
+		t.Errorf("ListUsage since the hour = %+v, want %+v", all, want)
+	}
+
+	one, err := s.ListUsage(ctx, "gw-2", time.Time{})
+	if err != nil || len(one) != 1 || one[0].GatewayID != "gw-2" {
+		t.Errorf("ListUsage(gw-2) = %+v, %v; want only gw-2", one, err)
+	}
+}
+
+func testAuditEvents(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	events := []*model.AuditEvent{
+		{Timestamp: enrolled, Action: "gateway.created", Resource: "gw-1", Subject: "alice", Detail: "created", RequestID: "req-1"},
+		{Timestamp: enrolled.Add(time.Minute), Action: "gateway.updated", Resource: "gw-1", Subject: "bob"},
+		{Timestamp: enrolled.Add(2 * time.Minute), Action: "gateway.created", Resource: "gw-2", Subject: "alice"},
+		{Timestamp: enrolled.Add(3 * time.Minute), Action: "gateway.deleted", Resource: "gw-1", Subject: "alice"},
+	}
+	for i, e := range events {
+		if err := s.AppendAuditEvent(ctx, e); err != nil {
+			t.Fatalf("AppendAuditEvent %d: %v", i, err)
+		}
+		if i > 0 && e.ID <= events[i-1].ID {
+			t.Errorf("event %d ID = %d, want it above the previous %d", i, e.ID, events[i-1].ID)
+		}
+	}
+
+	ids := func(q model.AuditQuery) []int64 {
+		t.Helper()
+		got, err := s.ListAuditEvents(ctx, q)
+		if err != nil {
+			t.Fatalf("ListAuditEvents(%+v): %v", q, err)
+		}
+		var ids []int64
+		for _, e := range got {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+	id := func(i ...int) []int64 {
+		var out []int64
+		for _, n := range i {
+			out = append(out, events[n].ID)
+		}
+		return out
+	}
+	for _, tt := range []struct {
+		name string
+		q    model.AuditQuery
+		want []int64
+	}{
+		{"all", model.AuditQuery{Limit: 10}, id(3, 2, 1, 0)},
+		{"limit", model.AuditQuery{Limit: 2}, id(3, 2)},
+		{"action", model.AuditQuery{Action: "gateway.created", Limit: 10}, id(2, 0)},
+		{"resource", model.AuditQuery{Resource: "gw-1", Limit: 10}, id(3, 1, 0)},
+		{"window", model.AuditQuery{Since: enrolled.Add(time.Minute), Until: enrolled.Add(3 * time.Minute), Limit: 10}, id(2, 1)},
+		{"page", model.AuditQuery{BeforeID: events[2].ID, Limit: 10}, id(1, 0)},
+	} {
+		if got := ids(tt.q); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: IDs %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	got, err := s.ListAuditEvents(ctx, model.AuditQuery{Action: "gateway.created", Resource: "gw-1", Limit: 1})
+	if err != nil || len(got) != 1 {
+		t.Fatalf("ListAuditEvents = %+v, %v; want the first event", got, err)
+	}
+	if e := got[0]; e.Subject != "alice" || e.Detail != "created" || e.RequestID != "req-1" || !e.Timestamp.Equal(enrolled) {
+		t.Errorf("event = %+v, want it as appended", e)
+	}
+
+	n, err := s.PruneAuditEvents(ctx, enrolled.Add(2*time.Minute))
+	if err != nil || n != 2 {
+		t.Errorf("PruneAuditEvents = %d, %v; want 2 pruned", n, err)
+	}
+	if got := ids(model.AuditQuery{Limit: 10}); fmt.Sprint(got) != fmt.Sprint(id(3, 2)) {
+		t.Errorf("after prune: IDs %v, want %v", got, id(3, 2))
+	}
+}
+
+func testInTx(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	errAbort := errors.New("abort")
+	err := s.InTx(ctx, func(tx store.Store) error {
+		mustCreate(t, tx, newGateway("gw-1", "alpha"))
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Errorf("InTx = %v, want fn's error", err)
+	}
+	if _, err := s.GetGateway(ctx, "gw-1"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetGateway after a rolled back create: got %v, want ErrNotFound", err)
+	}
+
+	if err := s.InTx(ctx, func(tx store.Store) error {
+		mustCreate(t, tx, newGateway("gw-1", "alpha"))
+		return tx.UpdateGatewayStatus(ctx, "gw-1", string(model.StatusOnline), nil)
+	}); err != nil {
+		t.Fatalf("InTx: %v", err)
+	}
+	if got := mustGet(t, s, "gw-1"); got.Status != model.StatusOnline {
+		t.Errorf("after commit status = %s, want online", got.Status)
+	}
+}
@@ -0,0 +1,43 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+)
+
+// WithClientTLS returns a copy of c whose TLS connections present cert. When
+// roots is non-nil it replaces the system pool for verifying the server. The
+// original client and its transport are left untouched.
+func WithClientTLS(c *http.Client, cert tls.Certificate, roots *x509.CertPool) *http.Client {
+	out := *c
+	out.Transport = withClientTLS(c.Transport, cert, roots)
+	return &out
+}
+
+func withClientTLS(rt http.RoundTripper, cert tls.Certificate, roots *x509.CertPool) http.RoundTripper {
+	switch t := rt.(type) {
+	case *cfAccessTransport:
+		wrapped := *t
+		wrapped.base = withClientTLS(t.base, cert, roots)
+		return &wrapped
+	case *http.Transport:
+		return cloneWithClientTLS(t, cert, roots)
+	default:
+		return cloneWithClientTLS(http.DefaultTransport.(*http.Transport), cert, roots)
+	}
+}
+
+func cloneWithClientTLS(t *http.Transport, cert tls.Certificate, roots *x509.CertPool) *http.Transport {
+	t = t.Clone()
+	cfg := t.TLSClientConfig.Clone()
+	if cfg == nil {
+		cfg = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	cfg.Certificates = []tls.Certificate{cert}
+	if roots != nil {
+		cfg.RootCAs = roots
+	}
+	t.TLSClientConfig = cfg
+	return t
+}
@@ -1,10 +1,28 @@
 package transport
 
 import (
+	"context"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/logging"
+)
+
+const (
+	// headscaleResolveTTL is how long a node's resolved address is reused
+	// before the Headscale API is asked again.
+	headscaleResolveTTL = 5 * time.Minute
+
+	// headscaleAPITimeout bounds one call to the Headscale API.
+	headscaleAPITimeout = 10 * time.Second
 )
 
 // newHeadscaleClient returns an http.Client configured for Headscale transport.
@@ -15,6 +33,11 @@ import (
 // to Tailscale. This transport configures the HTTP client for communication
 // with gateways reachable through the Headscale network.
 //
+// When api_url, api_key, and node_name are all set, connections go to the
+// node's tailnet address as reported by the Headscale API, keeping the
+// endpoint's port; the endpoint's host is still used for TLS verification.
+// Otherwise the endpoint is dialed directly.
+//
 // Supported params:
 //   - api_url:   The Headscale server API URL (e.g., "https://headscale.example.com").
 //   - api_key:   API key for authenticating with the Headscale control server.
@@ -25,18 +48,20 @@ func newHeadscaleClient(params map[string]string) *http.Client {
 		KeepAlive: 30 * time.Second,
 	}
 
+	dial := dialer.DialContext
+	if params["api_url"] != "" && params["api_key"] != "" && params["node_name"] != "" {
+		dial = newHeadscaleResolver(params["api_url"], params["api_key"], params["node_name"]).dialContext(dialer)
+	}
+
 	tlsConfig := &tls.Config{
 		MinVersion: tls.VersionTLS12,
 	}
 
-	// When a custom API URL is provided, we may need to trust self-signed
-	// certificates for the Headscale control server. In production, this
-	// should be handled via system trust store configuration.
 	return &http.Client{
 		Timeout: 30 * time.Second,
 		Transport: &http.Transport{
-			DialContext:           dialer.DialContext,
-			TLSClientConfig:      tlsConfig,
+			DialContext:           dial,
+			TLSClientConfig:       tlsConfig,
 			MaxIdleConns:          50,
 			MaxIdleConnsPerHost:   10,
 			IdleConnTimeout:       90 * time.Second,
@@ -45,3 +70,128 @@ func newHeadscaleClient(params map[string]string) *http.Client {
 		},
 	}
 }
+
+// headscaleResolver finds a node's tailnet address through the Headscale
+// API and caches it for headscaleResolveTTL.
+type headscaleResolver struct {
+	apiURL   string
+	apiKey   string
+	nodeName string
+	client   *http.Client
+
+	mu      sync.Mutex
+	addr    string // last resolved address; "" before the first lookup
+	expires time.Time
+}
+
+func newHeadscaleResolver(apiURL, apiKey, nodeName string) *headscaleResolver {
+	return &headscaleResolver{
+		apiURL:   strings.TrimRight(apiURL, "/"),
+		apiKey:   apiKey,
+		nodeName: nodeName,
+		client: &http.Client{
+			Timeout: headscaleAPITimeout,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{MinVersion: tls.VersionTLS12},
+			},
+		},
+	}
+}
+
+// dialContext returns a DialContext that dials the node's resolved address
+// on the port the caller asked for.
+func (r *headscaleResolver) dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		ip, err := r.resolve(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+	}
+}
+
+// resolve returns the node's address, asking the Headscale API when the
+// cached one has expired. If the API cannot be reached, the last known
+// address is used rather than failing every request.
+func (r *headscaleResolver) resolve(ctx context.Context) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if r.addr != "" && now.Before(r.expires) {
+		return r.addr, nil
+	}
+
+	addr, err := r.lookup(ctx)
+	if err != nil {
+		if r.addr != "" {
+			logging.LoggerFromContext(ctx).Warn("headscale node lookup failed; using last known address",
+				"node", r.nodeName, "addr", r.addr, "error", err)
+			return r.addr, nil
+		}
+		return "", fmt.Errorf("resolve headscale node %q: %w", r.nodeName, err)
+	}
+	r.addr, r.expires = addr, now.Add(headscaleResolveTTL)
+	return addr, nil
+}
+
+// headscaleNode is the part of a Headscale API node this transport uses.
+type headscaleNode struct {
+	Name        string   `json:"name"`
+	GivenName   string   `json:"givenName"`
+	IPAddresses []string `json:"ipAddresses"`
+}
+
+// lookup asks the Headscale API for the node's addresses, preferring IPv4.
+func (r *headscaleResolver) lookup(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.apiURL+"/api/v1/node", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+r.apiKey)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("headscale API returned %s", resp.Status)
+	}
+
+	var body struct {
+		Nodes []headscaleNode `json:"nodes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("decode headscale nodes: %w", err)
+	}
+
+	for _, n := range body.Nodes {
+		if n.GivenName != r.nodeName && n.Name != r.nodeName {
+			continue
+		}
+		var fallback string
+		for _, s := range n.IPAddresses {
+			ip, err := netip.ParseAddr(s)
+			if err != nil {
+				continue
+			}
+			if ip.Is4() {
+				return ip.String(), nil
+			}
+			if fallback == "" {
+				fallback = ip.String()
+			}
+		}
+		if fallback != "" {
+			return fallback, nil
+		}
+		return "", errors.New("node has no addresses")
+	}
+	return "", errors.New("node not found")
+}
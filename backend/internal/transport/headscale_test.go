@@ -0,0 +1,140 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testHeadscaleKey = "hs-api-key"
+
+// headscaleAPI is a mock Headscale server listing nodes.
+type headscaleAPI struct {
+	nodes  []headscaleNode
+	status atomic.Int32 // answered with instead of the list when non-zero
+	calls  atomic.Int32
+	url    string
+}
+
+func newHeadscaleAPI(t *testing.T, nodes ...headscaleNode) *headscaleAPI {
+	t.Helper()
+	api := &headscaleAPI{nodes: nodes}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api.calls.Add(1)
+		if r.URL.Path != "/api/v1/node" || r.Header.Get("Authorization") != "Bearer "+testHeadscaleKey {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if code := api.status.Load(); code != 0 {
+			w.WriteHeader(int(code))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"nodes": api.nodes})
+	}))
+	t.Cleanup(srv.Close)
+	api.url = srv.URL
+	return api
+}
+
+func TestHeadscaleDialsResolvedNode(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "host "+r.Host)
+	}))
+	t.Cleanup(gateway.Close)
+	_, port, err := net.SplitHostPort(gateway.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("split gateway address: %v", err)
+	}
+
+	api := newHeadscaleAPI(t,
+		headscaleNode{Name: "other", IPAddresses: []string{"100.64.0.9"}},
+		headscaleNode{Name: "edge-1-abcdef", GivenName: "edge-1", IPAddresses: []string{"fd7a:115c:a1e0::1", "127.0.0.1"}},
+	)
+	client := newHeadscaleClient(map[string]string{
+		"api_url":   api.url + "/",
+		"api_key":   testHeadscaleKey,
+		"node_name": "edge-1",
+	})
+
+	// The endpoint's host does not resolve; only the API knows where the
+	// node is. The endpoint's port is kept.
+	for i := range 2 {
+		resp, err := client.Get("http://edge-1.tailnet.invalid:" + port + "/healthz")
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if want := "host edge-1.tailnet.invalid:" + port; string(body) != want {
+			t.Errorf("request %d: gateway answered %q, want %q", i, body, want)
+		}
+		// Close pooled connections so the second request dials again.
+		client.CloseIdleConnections()
+	}
+	if n := api.calls.Load(); n != 1 {
+		t.Errorf("headscale API called %d times, want 1; the address is cached", n)
+	}
+}
+
+func TestHeadscaleResolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		nodes   []headscaleNode
+		node    string
+		want    string
+		wantErr bool
+	}{
+		{"by given name", []headscaleNode{{Name: "edge-1-abc", GivenName: "edge-1", IPAddresses: []string{"100.64.0.1"}}}, "edge-1", "100.64.0.1", false},
+		{"by name", []headscaleNode{{Name: "edge-1", IPAddresses: []string{"100.64.0.1"}}}, "edge-1", "100.64.0.1", false},
+		{"prefers ipv4", []headscaleNode{{Name: "edge-1", IPAddresses: []string{"fd7a:115c:a1e0::1", "100.64.0.1"}}}, "edge-1", "100.64.0.1", false},
+		{"ipv6 only", []headscaleNode{{Name: "edge-1", IPAddresses: []string{"bogus", "fd7a:115c:a1e0::1"}}}, "edge-1", "fd7a:115c:a1e0::1", false},
+		{"no addresses", []headscaleNode{{Name: "edge-1"}}, "edge-1", "", true},
+		{"not found", []headscaleNode{{Name: "edge-2", IPAddresses: []string{"100.64.0.2"}}}, "edge-1", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newHeadscaleAPI(t, tt.nodes...)
+			got, err := newHeadscaleResolver(api.url, testHeadscaleKey, tt.node).resolve(context.Background())
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("resolve = %q, %v; want %q, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHeadscaleResolveKeepsLastKnownAddress(t *testing.T) {
+	api := newHeadscaleAPI(t, headscaleNode{Name: "edge-1", IPAddresses: []string{"100.64.0.1"}})
+	r := newHeadscaleResolver(api.url, testHeadscaleKey, "edge-1")
+	ctx := context.Background()
+	if _, err := r.resolve(ctx); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	// The cached address has expired and the API is down.
+	r.expires = time.Time{}
+	api.status.Store(http.StatusBadGateway)
+	if got, err := r.resolve(ctx); err != nil || got != "100.64.0.1" {
+		t.Errorf("resolve with the API down = %q, %v; want the last known address", got, err)
+	}
+	if n := api.calls.Load(); n != 2 {
+		t.Errorf("headscale API called %d times, want 2", n)
+	}
+
+	// Without a last known address the failure is reported.
+	fresh := newHeadscaleResolver(api.url, testHeadscaleKey, "edge-1")
+	if got, err := fresh.resolve(ctx); err == nil {
+		t.Errorf("resolve with the API down and nothing cached = %q, want an error", got)
+	}
+
+	wrongKey := newHeadscaleResolver(api.url, "wrong", "edge-1")
+	api.status.Store(0)
+	if got, err := wrongKey.resolve(ctx); err == nil {
+		t.Errorf("resolve with a rejected API key = %q, want an error", got)
+	}
+}
@@ -0,0 +1,234 @@
+// Package webhook notifies external receivers of gateway status transitions.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of the request body, prefixed
+// with "sha256=", when the endpoint has a signing secret.
+const SignatureHeader = "X-Lobstertank-Signature"
+
+// initialBackoff is the delay before the first redelivery, doubled on each
+// subsequent attempt.
+const initialBackoff = time.Second
+
+// Event is the JSON body POSTed to webhook endpoints.
+type Event struct {
+	GatewayID  string            `json:"gateway_id"`
+	Name       string            `json:"name"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	From       model.Status      `json:"from"`
+	To         model.Status      `json:"to"`
+	Error      string            `json:"error,omitempty"`
+	ErrorKind  model.ErrorKind   `json:"error_kind,omitempty"`
+	ObservedAt time.Time         `json:"observed_at"`
+	Test       bool              `json:"test,omitempty"` // set on synthetic events from the test endpoint
+}
+
+// TestResult reports the outcome of delivering a test event to one endpoint.
+type TestResult struct {
+	Endpoint   string `json:"endpoint"`
+	Delivered  bool   `json:"delivered"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Dispatcher delivers events asynchronously. Each endpoint has its own
+// bounded queue and worker, so a slow or dead receiver delays only its own
+// events and never blocks the caller; events that do not fit are dropped.
+type Dispatcher struct {
+	endpoints  []*endpoint
+	client     *http.Client
+	maxRetries int
+	clock      clock.Clock
+}
+
+type endpoint struct {
+	config.WebhookEndpoint
+	queue chan []byte
+}
+
+// New creates a Dispatcher for the configured endpoints. Call Run to start
+// delivering.
+func New(cfg config.WebhookConfig, clk clock.Clock) *Dispatcher {
+	d := &Dispatcher{
+		client:     &http.Client{Timeout: cfg.Timeout},
+		maxRetries: cfg.MaxRetries,
+		clock:      clk,
+	}
+	for _, ep := range cfg.Endpoints {
+		d.endpoints = append(d.endpoints, &endpoint{
+			WebhookEndpoint: ep,
+			queue:           make(chan []byte, cfg.QueueSize),
+		})
+	}
+	return d
+}
+
+// NotifyTransition queues an event for every endpoint whose selector matches
+// the gateway. It never blocks.
+func (d *Dispatcher) NotifyTransition(gw *model.Gateway, t model.StatusTransition) {
+	if len(d.endpoints) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(Event{
+		GatewayID:  gw.ID,
+		Name:       gw.Name,
+		Labels:     gw.Labels,
+		From:       t.From,
+		To:         t.To,
+		Error:      t.Error,
+		ErrorKind:  t.ErrorKind,
+		ObservedAt: t.ObservedAt,
+	})
+	if err != nil {
+		slog.Error("failed to marshal webhook event", "error", err)
+		return
+	}
+
+	for _, ep := range d.endpoints {
+		if !(model.GatewayFilter{Labels: ep.Selector}).Matches(gw) {
+			continue
+		}
+		select {
+		case ep.queue <- body:
+		default:
+			slog.Warn("webhook queue full, dropping event", "webhook", ep.Name, "gateway_id", gw.ID)
+		}
+	}
+}
+
+// Run delivers queued events until the context is canceled. Events still
+// queued at that point are discarded.
+func (d *Dispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, ep := range d.endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case body := <-ep.queue:
+					d.deliver(ctx, ep, body)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Test sends a synthetic event to every endpoint, ignoring selectors, and
+// reports each outcome. Failed deliveries are not retried.
+func (d *Dispatcher) Test(ctx context.Context) []TestResult {
+	body, err := json.Marshal(Event{
+		GatewayID:  "00000000-0000-0000-0000-000000000000",
+		Name:       "lobstertank-webhook-test",
+		From:       model.StatusOnline,
+		To:         model.StatusOffline,
+		Error:      "synthetic test event",
+		ObservedAt: d.clock.Now().UTC(),
+		Test:       true,
+	})
+	if err != nil {
+		return nil
+	}
+
+	results := make([]TestResult, len(d.endpoints))
+	var wg sync.WaitGroup
+	for i, ep := range d.endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := TestResult{Endpoint: ep.Name}
+			code, err := d.post(ctx, ep, body)
+			res.StatusCode = code
+			if err != nil {
+				res.Error = err.Error()
+			} else {
+				res.Delivered = true
+			}
+			results[i] = res
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// Endpoints reports how many endpoints are configured.
+func (d *Dispatcher) Endpoints() int {
+	return len(d.endpoints)
+}
+
+// deliver posts body to ep, retrying with exponential backoff.
+func (d *Dispatcher) deliver(ctx context.Context, ep *endpoint, body []byte) {
+	backoff := initialBackoff
+	for attempt := 0; ; attempt++ {
+		_, err := d.post(ctx, ep, body)
+		if err == nil {
+			return
+		}
+		if attempt >= d.maxRetries || ctx.Err() != nil {
+			slog.Warn("webhook delivery failed", "webhook", ep.Name, "attempts", attempt+1, "error", err)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.clock.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post makes one delivery attempt. Any non-2xx response is an error.
+func (d *Dispatcher) post(ctx context.Context, ep *endpoint, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Lobstertank-Webhook")
+	if ep.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(ep.Secret, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("send: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("receiver returned HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the signature header value for body under secret. Receivers
+// verify a delivery by recomputing it and comparing in constant time.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,215 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+	"github.com/AdamPippert/Lobstertank/internal/model"
+)
+
+var testEpoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// delivery is one request a receiver got.
+type delivery struct {
+	body      []byte
+	signature string
+}
+
+// receiver is a webhook endpoint that records deliveries and answers each
+// attempt with the next status in codes, then 200.
+type receiver struct {
+	*httptest.Server
+	mu         sync.Mutex
+	codes      []int
+	deliveries chan delivery
+}
+
+func newReceiver(t *testing.T, codes ...int) *receiver {
+	t.Helper()
+	rc := &receiver{codes: codes, deliveries: make(chan delivery, 10)}
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rc.deliveries <- delivery{body: body, signature: r.Header.Get(SignatureHeader)}
+		rc.mu.Lock()
+		code := http.StatusOK
+		if len(rc.codes) > 0 {
+			code, rc.codes = rc.codes[0], rc.codes[1:]
+		}
+		rc.mu.Unlock()
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(rc.Close)
+	return rc
+}
+
+// next returns the next delivery, failing the test if none arrives.
+func (rc *receiver) next(t *testing.T) delivery {
+	t.Helper()
+	select {
+	case d := <-rc.deliveries:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery")
+		return delivery{}
+	}
+}
+
+// runDispatcher runs d until the test ends.
+func runDispatcher(t *testing.T, d *Dispatcher) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// transition is a gateway going offline at testEpoch.
+var transition = model.StatusTransition{
+	From:       model.StatusOnline,
+	To:         model.StatusOffline,
+	Error:      "connection refused",
+	ErrorKind:  model.ErrorKindConnectionRefused,
+	ObservedAt: testEpoch,
+}
+
+func TestNotifyTransition(t *testing.T) {
+	prod, all := newReceiver(t), newReceiver(t)
+	d := New(config.WebhookConfig{
+		Endpoints: []config.WebhookEndpoint{
+			{Name: "prod", URL: prod.URL, Secret: "s3cret", Selector: map[string]string{"env": "prod"}},
+			{Name: "all", URL: all.URL},
+		},
+		QueueSize: 10,
+		Timeout:   5 * time.Second,
+	}, clock.NewFake(testEpoch))
+	runDispatcher(t, d)
+
+	dev := &model.Gateway{ID: "gw-dev", Name: "dev-edge", Labels: map[string]string{"env": "dev"}}
+	live := &model.Gateway{ID: "gw-prod", Name: "prod-edge", Labels: map[string]string{"env": "prod"}}
+	d.NotifyTransition(dev, transition)
+	d.NotifyTransition(live, transition)
+
+	got := prod.next(t)
+	if want := Sign("s3cret", got.body); got.signature != want {
+		t.Errorf("signature = %q, want %q", got.signature, want)
+	}
+	var ev Event
+	if err := json.Unmarshal(got.body, &ev); err != nil {
+		t.Fatalf("decode event: %v", err)
+	}
+	want := Event{GatewayID: "gw-prod", Name: "prod-edge", From: model.StatusOnline, To: model.StatusOffline,
+		Error: "connection refused", ErrorKind: model.ErrorKindConnectionRefused, ObservedAt: testEpoch}
+	if ev.Labels["env"] != "prod" || ev.GatewayID != want.GatewayID || ev.Name != want.Name || ev.From != want.From ||
+		ev.To != want.To || ev.Error != want.Error || ev.ErrorKind != want.ErrorKind || !ev.ObservedAt.Equal(want.ObservedAt) || ev.Test {
+		t.Errorf("event = %+v, want %+v", ev, want)
+	}
+
+	// The unfiltered endpoint gets both events, unsigned, in order.
+	for _, id := range []string{"gw-dev", "gw-prod"} {
+		got := all.next(t)
+		if got.signature != "" {
+			t.Errorf("unsigned endpoint got signature %q", got.signature)
+		}
+		if err := json.Unmarshal(got.body, &ev); err != nil || ev.GatewayID != id {
+			t.Errorf("event = %s, want %s", got.body, id)
+		}
+	}
+	select {
+	case extra := <-prod.deliveries:
+		t.Errorf("selector let through %s", extra.body)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		codes        []int
+		maxRetries   int
+		wantAttempts int
+	}{
+		{"succeeds first time", nil, 2, 1},
+		{"succeeds on retry", []int{http.StatusInternalServerError, http.StatusBadGateway}, 2, 3},
+		{"gives up", []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError}, 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := newReceiver(t, tt.codes...)
+			clk := clock.NewFake(testEpoch)
+			d := New(config.WebhookConfig{
+				Endpoints:  []config.WebhookEndpoint{{Name: "rc", URL: rc.URL}},
+				QueueSize:  1,
+				MaxRetries: tt.maxRetries,
+				Timeout:    5 * time.Second,
+			}, clk)
+			ep := d.endpoints[0]
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				d.deliver(context.Background(), ep, []byte(`{}`))
+			}()
+
+			// Each retry waits twice as long as the one before.
+			backoff := initialBackoff
+			for attempt := 1; attempt < tt.wantAttempts; attempt++ {
+				rc.next(t)
+				waitForWaiter(t, clk)
+				clk.Advance(backoff - time.Millisecond)
+				if clk.Waiters() != 1 {
+					t.Fatalf("attempt %d: retried before %v", attempt+1, backoff)
+				}
+				clk.Advance(time.Millisecond)
+				backoff *= 2
+			}
+			rc.next(t)
+			<-done
+			if n := len(rc.deliveries); n != 0 {
+				t.Errorf("%d attempts beyond the expected %d", n, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+// waitForWaiter waits until something waits on clk.
+func waitForWaiter(t *testing.T, clk *clock.FakeClock) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for clk.Waiters() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("nothing waited on the clock")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestNotifyTransitionNeverBlocks(t *testing.T) {
+	rc := newReceiver(t)
+	d := New(config.WebhookConfig{
+		Endpoints: []config.WebhookEndpoint{{Name: "rc", URL: rc.URL}},
+		QueueSize: 2,
+	}, clock.NewFake(testEpoch))
+
+	// Nothing is delivering, so events past the queue size are dropped.
+	gw := &model.Gateway{ID: "gw-1", Name: "edge"}
+	for range 5 {
+		d.NotifyTransition(gw, transition)
+	}
+	if n := len(d.endpoints[0].queue); n != 2 {
+		t.Errorf("queued %d events, want 2", n)
+	}
+}
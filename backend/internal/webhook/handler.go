@@ -0,0 +1,43 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/httputil"
+)
+
+// Handler exposes webhook operations over HTTP.
+type Handler struct {
+	dispatcher *Dispatcher
+	auditor    *audit.Logger
+}
+
+// NewHandler creates a new webhook HTTP handler.
+func NewHandler(d *Dispatcher, a *audit.Logger) *Handler {
+	return &Handler{dispatcher: d, auditor: a}
+}
+
+// Test handles POST /api/v1/webhooks/test.
+func (h *Handler) Test(w http.ResponseWriter, r *http.Request) {
+	if h.dispatcher.Endpoints() == 0 {
+		httputil.WriteError(w, r, http.StatusBadRequest, "no webhook endpoints configured", nil)
+		return
+	}
+
+	results := h.dispatcher.Test(r.Context())
+
+	delivered := 0
+	for _, res := range results {
+		if res.Delivered {
+			delivered++
+		}
+	}
+	h.auditor.Log(r.Context(), audit.Event{
+		Action: "webhook.tested",
+		Detail: fmt.Sprintf("test event delivered to %d of %d webhooks", delivered, len(results)),
+	})
+
+	httputil.WriteJSON(w, http.StatusOK, results)
+}
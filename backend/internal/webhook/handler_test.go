@@ -0,0 +1,75 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdamPippert/Lobstertank/internal/audit"
+	"github.com/AdamPippert/Lobstertank/internal/clock"
+	"github.com/AdamPippert/Lobstertank/internal/config"
+)
+
+func TestHandlerTest(t *testing.T) {
+	ok, failing := newReceiver(t), newReceiver(t, http.StatusServiceUnavailable)
+	tests := []struct {
+		name       string
+		endpoints  []config.WebhookEndpoint
+		wantStatus int
+		want       []TestResult
+	}{
+		{"no endpoints", nil, http.StatusBadRequest, nil},
+		{
+			name: "reports each endpoint",
+			endpoints: []config.WebhookEndpoint{
+				{Name: "ok", URL: ok.URL, Selector: map[string]string{"env": "prod"}},
+				{Name: "failing", URL: failing.URL},
+			},
+			wantStatus: http.StatusOK,
+			want: []TestResult{
+				{Endpoint: "ok", Delivered: true, StatusCode: http.StatusOK},
+				{Endpoint: "failing", StatusCode: http.StatusServiceUnavailable, Error: "receiver returned HTTP 503"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(config.WebhookConfig{Endpoints: tt.endpoints, QueueSize: 1, MaxRetries: 3, Timeout: 5 * time.Second},
+				clock.NewFake(testEpoch))
+			h := NewHandler(d, audit.New(config.AuditConfig{}))
+			rec := httptest.NewRecorder()
+			h.Test(rec, httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/test", nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.want == nil {
+				return
+			}
+
+			var got []TestResult
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode results: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("results = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("result %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+
+			// Test events ignore selectors, are marked, and are not retried.
+			var ev Event
+			if err := json.Unmarshal(ok.next(t).body, &ev); err != nil || !ev.Test {
+				t.Errorf("test event = %+v (%v), want one marked as a test", ev, err)
+			}
+			failing.next(t)
+			if n := len(failing.deliveries); n != 0 {
+				t.Errorf("failed test delivery retried %d times", n)
+			}
+		})
+	}
+}